@@ -0,0 +1,142 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// AppliedBinlogEventCount is the number of binlog events applied to a table,
+// as recorded on the target
+type AppliedBinlogEventCount struct {
+	Table         string
+	EventsApplied uint64
+
+	// When the last applied event was written on the source, and when it was
+	// applied to the target
+	LastEventTime time.Time
+	LastAppliedAt time.Time
+}
+
+// AppliedBinlogEvents counts the binlog events applied to each table in a
+// table next to the resume state on the target, see
+// Config.RecordAppliedBinlogEvents. The counts are updated in the
+// transactions applying the events, so operators can tell from SQL whether a
+// table saw changes recently.
+//
+// Events applied again after resuming from a state older than the last
+// applied event are counted again, unless ForceResumeStateUpdatesToDB is set.
+type AppliedBinlogEvents struct {
+	DB       *sql.DB
+	Database string
+	Table    string
+
+	logger *logrus.Entry
+}
+
+func (f *Ferry) NewAppliedBinlogEvents() *AppliedBinlogEvents {
+	return &AppliedBinlogEvents{
+		DB:       f.stateTablesDB(),
+		Database: f.Config.ResumeStateFromDB,
+		Table:    fmt.Sprintf("_ghostferry_%d__binlog_events_applied", f.MyServerId),
+		logger:   f.loggerFor("applied_binlog_events"),
+	}
+}
+
+// Initialize creates the table of the counts, unless it was created by a
+// previous run that is resumed
+func (a *AppliedBinlogEvents) Initialize() error {
+	if a.logger == nil {
+		a.logger = logrus.WithField("tag", "applied_binlog_events")
+	}
+
+	return createStateTable(a.DB, a.Database, a.Table, `
+    table_name varchar(255) CHARACTER SET ascii NOT NULL,
+    events_applied bigint(20) UNSIGNED NOT NULL,
+    last_event_timestamp TIMESTAMP NOT NULL,
+    last_applied_timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (table_name)
+`, "applied binlog events")
+}
+
+// RecordSql returns the statement adding the DML events of a batch to the
+// counts of their tables, to be run in the transaction applying the batch.
+// It is empty if the batch has no DML events.
+func (a *AppliedBinlogEvents) RecordSql(events []DXLEventWrapper) string {
+	type tableCount struct {
+		events    uint64
+		lastEvent time.Time
+	}
+
+	tables := make([]string, 0)
+	counts := make(map[string]*tableCount)
+	for _, ev := range events {
+		if _, ok := ev.DXLEvent.(DMLEvent); !ok {
+			continue
+		}
+
+		table := ev.DXLEvent.Database() + "." + ev.DXLEvent.Table()
+		count, found := counts[table]
+		if !found {
+			count = &tableCount{}
+			counts[table] = count
+			tables = append(tables, table)
+		}
+		count.events++
+		if ev.ReplicationEvent != nil && ev.ReplicationEvent.EventTime.After(count.lastEvent) {
+			count.lastEvent = ev.ReplicationEvent.EventTime
+		}
+	}
+
+	if len(tables) == 0 {
+		return ""
+	}
+
+	values := make([]string, len(tables))
+	for i, table := range tables {
+		count := counts[table]
+		// unix(0) is not a valid timestamp in MySQL
+		lastEvent := int64(1)
+		if count.lastEvent.Unix() > lastEvent {
+			lastEvent = count.lastEvent.Unix()
+		}
+		values[i] = fmt.Sprintf("(%s, %d, FROM_UNIXTIME(%d))", quoteString(table), count.events, lastEvent)
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (table_name, events_applied, last_event_timestamp) VALUES %s "+
+			"ON DUPLICATE KEY UPDATE events_applied = events_applied + VALUES(events_applied), last_event_timestamp = VALUES(last_event_timestamp)",
+		a.tableName(),
+		strings.Join(values, ", "),
+	)
+}
+
+// Counts returns the recorded counts of all tables that had events applied
+func (a *AppliedBinlogEvents) Counts() ([]AppliedBinlogEventCount, error) {
+	rows, err := a.DB.Query("SELECT table_name, events_applied, UNIX_TIMESTAMP(last_event_timestamp), UNIX_TIMESTAMP(last_applied_timestamp) FROM " + a.tableName() + " ORDER BY table_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []AppliedBinlogEventCount{}
+	for rows.Next() {
+		var count AppliedBinlogEventCount
+		var lastEvent, lastApplied int64
+		if err := rows.Scan(&count.Table, &count.EventsApplied, &lastEvent, &lastApplied); err != nil {
+			return nil, err
+		}
+		count.LastEventTime = time.Unix(lastEvent, 0)
+		count.LastAppliedAt = time.Unix(lastApplied, 0)
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func (a *AppliedBinlogEvents) tableName() string {
+	return QuotedTableNameFromString(a.Database, a.Table)
+}
@@ -0,0 +1,200 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuditEntryTypeDDL = "ddl"
+	AuditEntryTypeDML = "dml"
+
+	AuditOutcomeApplied = "applied"
+	AuditOutcomeFailed  = "failed"
+)
+
+// AuditLogEntry describes a statement (or a transaction of statements)
+// applied to the target.
+type AuditLogEntry struct {
+	Time          time.Time
+	Type          string
+	Statement     string
+	StartPosition BinlogPosition
+	EndPosition   BinlogPosition
+	EventTime     time.Time
+	Outcome       string
+	Error         string `json:",omitempty"`
+}
+
+// AuditLog records the statements applied to the target to an append-only
+// file and/or a table on the target, see AuditLogConfig.
+type AuditLog struct {
+	Config *AuditLogConfig
+	DB     *sql.DB
+
+	mutex    sync.Mutex
+	file     *os.File
+	fileSize int64
+	logger   *logrus.Entry
+}
+
+func NewAuditLog(config *AuditLogConfig, db *sql.DB, logger *logrus.Entry) (*AuditLog, error) {
+	a := &AuditLog{
+		Config: config,
+		DB:     db,
+		logger: logger,
+	}
+
+	if config.Filename != "" {
+		if err := a.openFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Database != "" {
+		if err := a.initializeTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Record writes the entry to all configured destinations. Failing to record
+// an entry must not stop the run, so errors are only logged.
+func (a *AuditLog) Record(entry AuditLogEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.file != nil {
+		if err := a.writeToFile(entry); err != nil {
+			a.logger.WithError(err).Error("failed to write audit log entry to file")
+		}
+	}
+
+	if a.Config.Database != "" {
+		if err := a.writeToTable(entry); err != nil {
+			a.logger.WithError(err).Error("failed to write audit log entry to target table")
+		}
+	}
+}
+
+func (a *AuditLog) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+func (a *AuditLog) openFile() error {
+	file, err := os.OpenFile(a.Config.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("opening audit log %s: %v", a.Config.Filename, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	a.file = file
+	a.fileSize = info.Size()
+	return nil
+}
+
+func (a *AuditLog) writeToFile(entry AuditLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if a.fileSize > 0 && a.fileSize+int64(len(line)) > a.Config.maxFileSize {
+		if err = a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.fileSize += int64(n)
+	return err
+}
+
+// rotate renames the audit log to <Filename>.1, shifting older files and
+// removing those beyond MaxFiles, and starts a new file.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", a.Config.Filename, a.Config.MaxFiles))
+	for i := a.Config.MaxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", a.Config.Filename, i)
+		if _, err := os.Stat(from); err == nil {
+			if err = os.Rename(from, fmt.Sprintf("%s.%d", a.Config.Filename, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(a.Config.Filename, a.Config.Filename+".1"); err != nil {
+		return err
+	}
+
+	return a.openFile()
+}
+
+func (a *AuditLog) tableName() string {
+	return QuotedTableNameFromString(a.Config.Database, a.Config.Table)
+}
+
+func (a *AuditLog) initializeTable() error {
+	return createStateTable(a.DB, a.Config.Database, a.Config.Table, `
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    applied_at TIMESTAMP(6) NOT NULL,
+    type varchar(8) CHARACTER SET ascii NOT NULL,
+    statement LONGTEXT NOT NULL,
+    start_filename varchar(255) CHARACTER SET ascii NOT NULL,
+    start_pos int(11) UNSIGNED NOT NULL,
+    end_filename varchar(255) CHARACTER SET ascii NOT NULL,
+    end_pos int(11) UNSIGNED NOT NULL,
+    event_timestamp TIMESTAMP(6) NULL,
+    outcome varchar(16) CHARACTER SET ascii NOT NULL,
+    error TEXT,
+    PRIMARY KEY (id)
+`, "audit log")
+}
+
+func (a *AuditLog) writeToTable(entry AuditLogEntry) error {
+	var eventTime interface{}
+	if !entry.EventTime.IsZero() {
+		eventTime = entry.EventTime
+	}
+
+	_, err := a.DB.Exec(
+		"INSERT INTO "+a.tableName()+" (applied_at, type, statement, start_filename, start_pos, end_filename, end_pos, event_timestamp, outcome, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.Time,
+		entry.Type,
+		entry.Statement,
+		entry.StartPosition.EventPosition.Name,
+		entry.StartPosition.EventPosition.Pos,
+		entry.EndPosition.EventPosition.Name,
+		entry.EndPosition.EventPosition.Pos,
+		eventTime,
+		entry.Outcome,
+		entry.Error,
+	)
+	return err
+}
@@ -0,0 +1,61 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyncAutoIncrements advances the AUTO_INCREMENT values of the copied target
+// tables to the ones of the source tables plus the headroom of the
+// AutoIncrementSyncConfig, except for the Config.StreamOnlyTables. It is to be
+// called once the writes to the source stopped and the binlog streaming
+// stopped, right before the cutover.
+func (f *Ferry) SyncAutoIncrements() error {
+	logger := f.loggerFor("auto_increment_sync")
+	headroom := f.Config.AutoIncrementSync.Headroom
+
+	tables := f.copiedTables()
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].String() < tables[j].String()
+	})
+
+	sourceValues, err := autoIncrementValues(f.SourceDB, tableSchemaNames(tables, nil))
+	if err != nil {
+		return err
+	}
+	targetValues, err := autoIncrementValues(f.TargetDB, tableSchemaNames(tables, f.Config.DatabaseRewrites))
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		sourceValue, found := sourceValues[table.String()]
+		if !found {
+			continue
+		}
+
+		schemaName, tableName := f.targetSchemaAndTableName(table)
+		targetValue := targetValues[fmt.Sprintf("%s.%s", schemaName, tableName)]
+		value := sourceValue + headroom
+		if targetValue >= value {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", QuotedTableNameFromString(schemaName, tableName), value)
+		if _, err = f.TargetDB.Exec(query); err != nil {
+			return fmt.Errorf("advancing the AUTO_INCREMENT of %s.%s: %v", schemaName, tableName, err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"table":  fmt.Sprintf("%s.%s", schemaName, tableName),
+			"source": sourceValue,
+			"target": targetValue,
+			"value":  value,
+		}).Info("advanced the AUTO_INCREMENT of the target table")
+		f.Metrics.Count("AutoIncrementSync", 1, []MetricTag{{Name: "table", Value: fmt.Sprintf("%s.%s", schemaName, tableName)}}, 1.0)
+	}
+
+	return nil
+}
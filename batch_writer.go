@@ -1,8 +1,12 @@
 package ghostferry
 
 import (
+	"context"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -25,18 +29,178 @@ type BatchWriter struct {
 	TableRewrites    map[string]string
 
 	WriteRetries int
+	RetryPolicy  *RetryPolicyConfig
 
-	stmtCache *StmtCache
-	logger    *logrus.Entry
+	// Only track the progress of the batches but never write them to the
+	// target, see Config.BenchmarkMode
+	DiscardWrites bool
+
+	// If set, the batches are also written to the sink
+	Sink Sink
+
+	// If set, the chunked columns of the rows inserted by the batches are
+	// transferred in the transaction of the batch
+	BlobChunker *BlobChunker
+
+	// If set, the values of the batches are converted before they are
+	// written, see Config.DateTimeConversion
+	DateTimeConverter *DateTimeConverter
+
+	// The maximum number of prepared statements cached, see
+	// Config.StmtCacheSize
+	//
+	// Optional: defaults to no limit
+	StmtCacheSize int
+
+	stmtCache     *StmtCache
+	logger        *logrus.Entry
+	metrics       *Metrics
+	rowsDiscarded uint64
+	inFlight      int32
+
+	// the number of rows written at once for the tables whose batches were
+	// too large to be written, see writeRowBatchInChunks
+	batchSizes      map[string]int
+	batchSizesMutex sync.Mutex
+
+	// guards the WriteRetries changed while batches are written, see
+	// SetWriteRetries
+	writeRetriesMutex sync.RWMutex
+
+	incrediblyVerboseLogging bool
+}
+
+// SetWriteRetries changes the WriteRetries while batches are written, see
+// Ferry.UpdateTunables
+func (w *BatchWriter) SetWriteRetries(writeRetries int) {
+	w.writeRetriesMutex.Lock()
+	defer w.writeRetriesMutex.Unlock()
+
+	w.WriteRetries = writeRetries
+}
+
+func (w *BatchWriter) writeRetries() int {
+	w.writeRetriesMutex.RLock()
+	defer w.writeRetriesMutex.RUnlock()
+
+	return w.WriteRetries
 }
 
 func (w *BatchWriter) Initialize() {
-	w.stmtCache = NewStmtCache()
-	w.logger = logrus.WithField("tag", "batch_writer")
+	w.stmtCache = NewBoundedStmtCache(w.StmtCacheSize, "batch_writer", w.metrics)
+	w.batchSizes = make(map[string]int)
+	if w.logger == nil {
+		w.logger = logrus.WithField("tag", "batch_writer")
+	}
 }
 
 func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
-	return WithRetries(w.WriteRetries, 0, w.logger, "write batch to target", func() (err error) {
+	atomic.AddInt32(&w.inFlight, 1)
+	defer atomic.AddInt32(&w.inFlight, -1)
+
+	if w.DateTimeConverter != nil {
+		if err := w.DateTimeConverter.ConvertRowBatch(batch); err != nil {
+			return err
+		}
+	}
+
+	if w.Sink != nil {
+		sinkBatch := batch
+		if w.BlobChunker != nil {
+			var err error
+			sinkBatch, err = w.BlobChunker.WithWholeValues(batch)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := WithRetryPolicy(w.RetryPolicy, w.writeRetries(), w.logger, "write batch to sink", func() error {
+			return w.Sink.WriteRowBatch(sinkBatch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.DiscardWrites {
+		return w.discardRowBatch(batch)
+	}
+
+	return w.writeRowBatchInChunks(batch)
+}
+
+// BatchSize returns the number of rows written at once for the table, which
+// is reduced for the rest of the run whenever a batch of the table is too
+// large to be written, e.g. due to the max_allowed_packet. Returns 0 if the
+// batches of the table are written as they are read.
+func (w *BatchWriter) BatchSize(table string) int {
+	w.batchSizesMutex.Lock()
+	defer w.batchSizesMutex.Unlock()
+
+	return w.batchSizes[table]
+}
+
+func (w *BatchWriter) reduceBatchSize(table string, batchSize int) {
+	w.batchSizesMutex.Lock()
+	defer w.batchSizesMutex.Unlock()
+
+	if current, found := w.batchSizes[table]; !found || batchSize < current {
+		w.batchSizes[table] = batchSize
+	}
+}
+
+// writeRowBatchInChunks writes the rows of the batch in chunks of the
+// BatchSize of its table. A chunk too large to be written is not retried as
+// it is, the BatchSize of the table is halved and the chunk is written in
+// smaller chunks instead.
+func (w *BatchWriter) writeRowBatchInChunks(batch RowBatch) error {
+	dataBatch, ok := batch.(*DataRowBatch)
+	if !ok || dataBatch.Size() == 0 {
+		return w.writeRowBatchToTarget(batch)
+	}
+
+	table := batch.TableSchema().String()
+	rows := dataBatch.Values()
+	for len(rows) > 0 {
+		chunkSize := w.BatchSize(table)
+		if chunkSize == 0 || chunkSize > len(rows) {
+			chunkSize = len(rows)
+		}
+
+		chunk := dataBatch.withValues(rows[:chunkSize])
+		err := w.writeRowBatchToTarget(chunk)
+		if err != nil && IsPacketTooLarge(err) && chunkSize > 1 {
+			w.logger.WithError(err).WithField("table", table).Warnf("batch of %d rows too large to be written, writing at most %d rows at once from now on", chunkSize, chunkSize/2)
+			w.reduceBatchSize(table, chunkSize/2)
+			w.metrics.Gauge("BatchWriter.BatchSize", float64(w.BatchSize(table)), []MetricTag{{Name: "table", Value: table}}, 1.0)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		rows = rows[chunkSize:]
+	}
+
+	return nil
+}
+
+func (w *BatchWriter) writeRowBatchToTarget(batch RowBatch) error {
+	start := time.Now()
+	attempts := 0
+	var tooLargeErr error
+	writeErr := WithRetryPolicy(w.RetryPolicy, w.writeRetries(), w.logger, "write batch to target", func() (err error) {
+		attempts++
+
+		// writing the same rows again fails the same way, the batch is
+		// written in smaller chunks instead, see writeRowBatchInChunks
+		defer func() {
+			if err != nil && IsPacketTooLarge(err) && batch.Size() > 1 {
+				tooLargeErr = err
+				err = nil
+			}
+		}()
+
 		db := batch.TableSchema().Schema
 		if targetDbName, exists := w.DatabaseRewrites[db]; exists {
 			db = targetDbName
@@ -52,10 +216,15 @@ func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
 			return
 		}
 
+		defer w.DB.LogIfSlow(time.Now(), "row batch write", logrus.Fields{
+			"table": batch.TableSchema().String(),
+			"rows":  batch.Size(),
+		})
+
 		txInUse := false
 		tx, dbErr := w.DB.Begin()
 		if dbErr != nil {
-			err = fmt.Errorf("unable to begin transaction in BatchWriter: %v", dbErr)
+			err = fmt.Errorf("unable to begin transaction in BatchWriter: %w", dbErr)
 			return
 		}
 
@@ -67,6 +236,15 @@ func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
 			}
 		}()
 
+		var blobRows []RowData
+		if insertBatch, ok := batch.(InsertRowBatch); ok && w.BlobChunker != nil {
+			blobRows, dbErr = w.BlobChunker.RowsToTransfer(tx, insertBatch, db, table)
+			if dbErr != nil {
+				err = dbErr
+				return
+			}
+		}
+
 		query, args, dbErr := batch.AsSQLQuery(db, table)
 		if dbErr != nil {
 			err = fmt.Errorf("during generating sql batch query: %v", dbErr)
@@ -82,6 +260,15 @@ func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
 			txInUse = true
 		}
 
+		// the inline verifier must see the whole values
+		if len(blobRows) > 0 {
+			dbErr = w.BlobChunker.Transfer(tx, batch.TableSchema(), blobRows, db, table)
+			if dbErr != nil {
+				err = dbErr
+				return
+			}
+		}
+
 		// Note that the state tracker expects us the track based on the original
 		// database and table names as opposed to the target ones.
 		stateTableName := batch.TableSchema().String()
@@ -132,7 +319,7 @@ func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
 		if txInUse {
 			err = tx.Commit()
 			if err != nil {
-				err = fmt.Errorf("during row-copy commit (%s): %v", query, err)
+				err = fmt.Errorf("during row-copy commit (%s): %w", query, err)
 			} else {
 				// avoid rolling it back (too late anyways) on function exit
 				tx = nil
@@ -146,6 +333,75 @@ func (w *BatchWriter) WriteRowBatch(batch RowBatch) error {
 
 		return
 	})
+	if tooLargeErr != nil {
+		writeErr = tooLargeErr
+	}
+
+	w.emitWriteMetrics(batch, attempts, time.Since(start), writeErr)
+	return writeErr
+}
+
+// emitWriteMetrics reports the rows and bytes written per table, which the
+// metrics backends turn into copy rates, the latency of the writes and the
+// number of retries they took.
+func (w *BatchWriter) emitWriteMetrics(batch RowBatch, attempts int, latency time.Duration, err error) {
+	tags := []MetricTag{{Name: "table", Value: batch.TableSchema().String()}}
+
+	if attempts > 1 {
+		w.metrics.Count("BatchWriter.Retries", int64(attempts-1), tags, 1.0)
+	}
+
+	if err != nil || batch.Size() == 0 {
+		return
+	}
+
+	w.metrics.Count("BatchWriter.Rows", int64(batch.Size()), tags, 1.0)
+	w.metrics.Timer("BatchWriter.WriteLatency", latency, tags, 1.0)
+
+	if insertBatch, ok := batch.(InsertRowBatch); ok {
+		var bytes uint64
+		for _, rowData := range insertBatch.Values() {
+			bytes += rowData.ByteSize()
+		}
+		w.metrics.Count("BatchWriter.Bytes", int64(bytes), tags, 1.0)
+	}
+}
+
+// InFlightBatches returns the number of batches currently being written.
+func (w *BatchWriter) InFlightBatches() int {
+	return int(atomic.LoadInt32(&w.inFlight))
+}
+
+// DiscardedRows returns the number of rows dropped instead of being written
+// to the target since the writer was created.
+func (w *BatchWriter) DiscardedRows() uint64 {
+	return atomic.LoadUint64(&w.rowsDiscarded)
+}
+
+func (w *BatchWriter) discardRowBatch(batch RowBatch) error {
+	atomic.AddUint64(&w.rowsDiscarded, uint64(batch.Size()))
+
+	if w.StateTracker == nil {
+		return nil
+	}
+
+	stateTableName := batch.TableSchema().String()
+	if insertBatch, ok := batch.(InsertRowBatch); ok && insertBatch.Size() > 0 {
+		if paginationKey := insertBatch.TableSchema().PaginationKey; paginationKey != nil {
+			values := insertBatch.Values()
+			endPaginationKeypos, err := NewPaginationKeyDataFromRow(values[len(values)-1], paginationKey)
+			if err != nil {
+				return err
+			}
+			w.StateTracker.UpdateLastSuccessfulPaginationKey(stateTableName, endPaginationKeypos)
+		}
+	}
+
+	if batch.IsTableComplete() {
+		w.StateTracker.MarkTableAsCompleted(stateTableName)
+	}
+
+	return nil
 }
 
 func (w *BatchWriter) handleInsertRowBatch(tx *sql.Tx, batch InsertRowBatch, db, table string) (endPaginationKeypos *PaginationKeyData, txUpdated bool, err error) {
@@ -209,18 +465,22 @@ func (w *BatchWriter) queueStatement(tx *sql.Tx, query string, args []interface{
 		return
 	}
 
-	stmt, stmtErr := w.stmtCache.StmtFor(w.DB, query)
+	stmt, release, stmtErr := w.stmtCache.StmtFor(w.DB, query)
 	if stmtErr != nil {
 		err = stmtErr
 		return
 	}
+	defer release()
 
-	if IncrediblyVerboseLogging {
+	if w.incrediblyVerboseLogging {
 		w.logger.Debugf("Applying copy statements: %s (%v)", query, args)
 	}
-	_, err = tx.Stmt(stmt).Exec(args...)
+	ctx, cancel := w.DB.QueryTimeoutContext(context.Background())
+	defer cancel()
+
+	_, err = tx.Stmt(stmt).ExecContext(ctx, args...)
 	if err != nil {
-		err = fmt.Errorf("during copy statement: %v", err)
+		err = fmt.Errorf("during copy statement: %w", err)
 		return
 	}
 
@@ -0,0 +1,118 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BidirectionalFerry replicates between two databases in both directions,
+// for example to keep two clusters in sync during a migration window where
+// applications write to both.
+//
+// The Forward ferry copies the data and replicates from its Source to its
+// Target, the Reverse ferry only replicates from the Target back to the
+// Source. To prevent replication loops, each ferry skips the writes of the
+// sessions the other ferry opened to its source, which are recorded as they
+// are opened. The writes of the Target user of the other ferry and of the
+// users of its ComponentCredentials are skipped as well, so all these users
+// must be dedicated to Ghostferry.
+//
+// Neither ferry performs a cutover: both run until they are stopped.
+type BidirectionalFerry struct {
+	Forward *Ferry
+	Reverse *Ferry
+
+	logger *logrus.Entry
+}
+
+func NewBidirectionalFerry(forward, reverse *Ferry) (*BidirectionalFerry, error) {
+	if !sameDatabase(forward.Config.Source, reverse.Config.Target) || !sameDatabase(forward.Config.Target, reverse.Config.Source) {
+		return nil, fmt.Errorf("the reverse ferry must replicate from the target to the source of the forward ferry")
+	}
+
+	if !forward.Config.DisableCutover || !reverse.Config.DisableCutover {
+		return nil, fmt.Errorf("bidirectional replication requires DisableCutover on both ferries")
+	}
+
+	for _, pair := range [][2]*Ferry{{forward, reverse}, {reverse, forward}} {
+		f, other := pair[0], pair[1]
+		if f.Config.LoopPrevention.IgnoredUser == "" {
+			f.Config.LoopPrevention.IgnoredUser = other.Config.Target.User
+		} else if f.Config.LoopPrevention.IgnoredUser != other.Config.Target.User {
+			return nil, fmt.Errorf("LoopPrevention.IgnoredUser (%s) must be the Target user of the opposite ferry (%s)", f.Config.LoopPrevention.IgnoredUser, other.Config.Target.User)
+		}
+		f.Config.LoopPrevention.componentUsers = other.Config.Target.users()[1:]
+
+		ignoredSessions := &sync.Map{}
+		f.Config.LoopPrevention.ignoredSessions = ignoredSessions
+		other.Config.Target.recordSession = func(id uint32) {
+			ignoredSessions.Store(id, true)
+		}
+
+		if err := f.Config.LoopPrevention.Validate(); err != nil {
+			return nil, fmt.Errorf("LoopPrevention invalid: %v", err)
+		}
+	}
+
+	return &BidirectionalFerry{
+		Forward: forward,
+		Reverse: reverse,
+		logger:  logrus.WithField("tag", "bidirectional"),
+	}, nil
+}
+
+func (b *BidirectionalFerry) Initialize() error {
+	for _, f := range []*Ferry{b.Forward, b.Reverse} {
+		if err := f.Initialize(); err != nil {
+			return err
+		}
+	}
+
+	// the data is copied by the forward ferry only
+	for _, table := range b.Reverse.Tables.AsSlice() {
+		b.Reverse.StateTracker.MarkTableAsCompleted(table.String())
+	}
+
+	return nil
+}
+
+func (b *BidirectionalFerry) Start() error {
+	if err := b.Forward.Start(); err != nil {
+		return fmt.Errorf("failed to start forward ferry: %v", err)
+	}
+
+	if err := b.Reverse.Start(); err != nil {
+		return fmt.Errorf("failed to start reverse ferry: %v", err)
+	}
+
+	return nil
+}
+
+// Run runs both ferries until they are stopped
+func (b *BidirectionalFerry) Run() {
+	b.logger.Info("starting bidirectional replication")
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	for _, f := range []*Ferry{b.Forward, b.Reverse} {
+		go func(f *Ferry) {
+			defer wg.Done()
+			f.Run()
+		}(f)
+	}
+
+	wg.Wait()
+}
+
+// StopReplication stops the replication in both directions
+func (b *BidirectionalFerry) StopReplication() {
+	b.Forward.FlushBinlogAndStopStreaming()
+	b.Reverse.FlushBinlogAndStopStreaming()
+}
+
+func sameDatabase(a, b *DatabaseConfig) bool {
+	return a.Address() == b.Address()
+}
@@ -0,0 +1,198 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+const bigQueryScope = "https://www.googleapis.com/auth/bigquery"
+
+type Config struct {
+	// The Google Cloud project of the BigQuery datasets. If set, the copied
+	// rows and the binlog DML events are also streamed into BigQuery.
+	Project string
+
+	// The dataset to write all tables to.
+	//
+	// Optional: defaults to the name of the database of each table (after
+	// DatabaseRewrites)
+	Dataset string
+
+	// The BigQuery table to write a table to, by the name of the source table
+	// ("db.table"), either as "table" or "dataset.table".
+	//
+	// Optional: defaults to the name of the table (after TableRewrites)
+	TableMappings map[string]string
+
+	// The BigQuery column to write a column to, by the name of the source
+	// table ("db.table") and the name of the column. Columns mapped to an
+	// empty name are not written.
+	//
+	// Optional: defaults to the names of the columns
+	ColumnMappings map[string]map[string]string
+
+	// Optional: defaults to "_change_type"
+	ChangeTypeColumn string
+
+	// Optional: defaults to "_version"
+	VersionColumn string
+
+	// A JSON credentials file of Google Cloud: the key of a service account,
+	// the credentials of a user, or the configuration of workload identity
+	// federation (external_account) or of a service account impersonation.
+	//
+	// Optional: defaults to the Application Default Credentials, i.e. the
+	// file of GOOGLE_APPLICATION_CREDENTIALS, the credentials of gcloud, or
+	// the service account of the metadata server
+	CredentialsFile string
+
+	// A file containing an OAuth access token, which is read again every
+	// minute, such that it can be refreshed externally. This is incompatible
+	// with CredentialsFile.
+	//
+	// Optional: defaults to the credentials of CredentialsFile
+	AccessTokenFile string
+
+	// The email of a service account to impersonate with the credentials
+	// above, which requires the roles/iam.serviceAccountTokenCreator role on
+	// the service account.
+	//
+	// Optional: defaults to using the credentials directly
+	ImpersonateServiceAccount string
+
+	// The host:port of the BigQuery Storage Write API.
+	//
+	// Optional: defaults to bigquerystorage.googleapis.com:443
+	Endpoint string
+
+	// The timeout of each append to BigQuery, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to 30s
+	Timeout string
+
+	timeout time.Duration
+}
+
+func (c *Config) Enabled() bool {
+	return c.Project != ""
+}
+
+func (c *Config) Validate() error {
+	if c.ChangeTypeColumn == "" {
+		c.ChangeTypeColumn = "_change_type"
+	}
+
+	if c.VersionColumn == "" {
+		c.VersionColumn = "_version"
+	}
+
+	for table := range c.TableMappings {
+		if !strings.Contains(table, ".") {
+			return fmt.Errorf("TableMappings must be keyed by db.table (set to %s)", table)
+		}
+	}
+
+	for table := range c.ColumnMappings {
+		if !strings.Contains(table, ".") {
+			return fmt.Errorf("ColumnMappings must be keyed by db.table (set to %s)", table)
+		}
+	}
+
+	if c.CredentialsFile != "" && c.AccessTokenFile != "" {
+		return fmt.Errorf("CredentialsFile and AccessTokenFile are mutually exclusive")
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "30s"
+	}
+
+	var err error
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout specified: %v", err)
+	}
+
+	return nil
+}
+
+// clientOptions returns the options of the Storage Write client, which
+// authenticate it as configured
+func (c *Config) clientOptions() ([]option.ClientOption, error) {
+	var options []option.ClientOption
+	if c.Endpoint != "" {
+		options = append(options, option.WithEndpoint(c.Endpoint))
+	}
+
+	var credentials []option.ClientOption
+	if c.CredentialsFile != "" {
+		credentialsType, err := credentialsFileType(c.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, option.WithAuthCredentialsFile(credentialsType, c.CredentialsFile))
+	} else if c.AccessTokenFile != "" {
+		credentials = append(credentials, option.WithTokenSource(accessTokenFile(c.AccessTokenFile)))
+	}
+
+	if c.ImpersonateServiceAccount != "" {
+		tokenSource, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: c.ImpersonateServiceAccount,
+			Scopes:          []string{bigQueryScope},
+		}, credentials...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to impersonate %s: %v", c.ImpersonateServiceAccount, err)
+		}
+		credentials = []option.ClientOption{option.WithTokenSource(tokenSource)}
+	}
+
+	return append(options, credentials...), nil
+}
+
+// credentialsFileType returns the type of a credentials file, which the
+// client requires to be given explicitly
+func credentialsFileType(filename string) (option.CredentialsType, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CredentialsFile: %v", err)
+	}
+
+	var credentials struct {
+		Type option.CredentialsType `json:"type"`
+	}
+	if err = json.Unmarshal(data, &credentials); err != nil {
+		return "", fmt.Errorf("failed to parse CredentialsFile: %v", err)
+	}
+
+	switch credentials.Type {
+	case option.ServiceAccount, option.AuthorizedUser, option.ExternalAccount, option.ImpersonatedServiceAccount:
+		return credentials.Type, nil
+	}
+	return "", fmt.Errorf("unsupported type of CredentialsFile (set to %s)", credentials.Type)
+}
+
+// accessTokenFile is a token source reading the token of the
+// AccessTokenFile. The token expires after a minute, such that the file is
+// read again.
+type accessTokenFile string
+
+func (f accessTokenFile) Token() (*oauth2.Token, error) {
+	token, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{
+		AccessToken: strings.TrimSpace(string(token)),
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(time.Minute),
+	}, nil
+}
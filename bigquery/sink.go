@@ -0,0 +1,549 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"github.com/Shopify/ghostferry"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	ChangeTypeInsert = "INSERT"
+	ChangeTypeUpdate = "UPDATE"
+	ChangeTypeDelete = "DELETE"
+
+	// AppendRows requests are limited to 10 MB, which leaves room for the
+	// request around the rows
+	maxAppendBytes = 9 * 1024 * 1024
+)
+
+// Sink streams the copied rows and the binlog DML events into BigQuery
+// tables through the Storage Write API, as a change log: every write appends
+// a row with the values of the source row, plus the change type and an
+// increasing version, from which the current state of the table can be
+// derived (e.g. by the last version of each primary key that is not deleted).
+// It is meant to be set as the Sink of the Ferry.
+//
+// The rows of each table are appended to a committed stream created for the
+// run, at explicit offsets. An append whose result is unknown, e.g. due to a
+// network error, is sent again at the same offset before any other rows of
+// the table, which BigQuery refuses if the rows were appended already, so
+// every append is applied exactly once. Batches retried by the ferry and
+// writes repeated on resume are appended again with later versions, so they
+// do not change the derived state. Schema changes are not replicated and
+// must be applied separately.
+//
+// The rows are encoded as protocol buffers, with a message type derived from
+// the columns of the source table: integers as INT64 (unsigned BIGINTs as
+// STRING, to be written to NUMERIC columns), floating point numbers as
+// DOUBLE, binary strings as BYTES, and all other values as STRING.
+type Sink struct {
+	Config *Config
+
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	client   *managedwriter.Client
+	versions ghostferry.SinkVersions
+
+	streamsMutex sync.Mutex
+	streams      map[string]*tableStream
+
+	logger *logrus.Entry
+}
+
+// field is a field of the message type of the rows written to a BigQuery
+// table
+type field struct {
+	name      string
+	protoType descriptorpb.FieldDescriptorProto_Type
+	// the index of the column in the source rows, or one of the *Field
+	// constants
+	column int
+}
+
+const (
+	changeTypeField = -1
+	versionField    = -2
+)
+
+// tableStream is the committed stream that the rows of a table are appended
+// to. Its mutex is held while appending, so the rows of a write are appended
+// one after the other.
+type tableStream struct {
+	mutex sync.Mutex
+
+	dataset string
+	table   string
+
+	// the name of the stream once it was created
+	name   string
+	writer *managedwriter.ManagedStream
+	// the offset of the next row appended to the stream
+	offset int64
+	// the last append whose result is unknown, which is sent again at the
+	// same offset before any other rows
+	pending *appendRequest
+}
+
+type appendRequest struct {
+	descriptor *descriptorpb.DescriptorProto
+	rows       [][]byte
+}
+
+// NewSink connects to the Storage Write API with the credentials of the
+// config. The DatabaseRewrites and TableRewrites of the ferry config apply to
+// the names of the BigQuery datasets and tables. The options are applied
+// after the ones of the config, e.g. to connect to an emulator.
+func NewSink(config *Config, ferryConfig *ghostferry.Config, logger *logrus.Entry, options ...option.ClientOption) (*Sink, error) {
+	if ferryConfig.AllowMinimalBinlogRowImage {
+		return nil, fmt.Errorf("the BigQuery sink requires full binlog row images and is incompatible with AllowMinimalBinlogRowImage")
+	}
+
+	clientOptions, err := config.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := managedwriter.NewClient(context.Background(), config.Project, append(clientOptions, options...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BigQuery client: %v", err)
+	}
+
+	return &Sink{
+		Config:           config,
+		DatabaseRewrites: ferryConfig.DatabaseRewrites,
+		TableRewrites:    ferryConfig.TableRewrites,
+		client:           client,
+		streams:          make(map[string]*tableStream),
+		logger:           logger,
+	}, nil
+}
+
+func (s *Sink) WriteRowBatch(batch ghostferry.RowBatch) error {
+	insertBatch, ok := batch.(ghostferry.InsertRowBatch)
+	if !ok || insertBatch.Size() == 0 {
+		return nil
+	}
+
+	table := batch.TableSchema()
+	fields := s.fields(table)
+	rows := make([][]byte, 0, insertBatch.Size())
+	for _, values := range insertBatch.Values() {
+		row, err := s.row(table, fields, values, ChangeTypeInsert)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	return s.appendRows(table, fields, rows)
+}
+
+func (s *Sink) WriteBinlogEvents(events []ghostferry.DXLEventWrapper) error {
+	var table *ghostferry.TableSchema
+	var fields []field
+	var rows [][]byte
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		err := s.appendRows(table, fields, rows)
+		rows = nil
+		return err
+	}
+
+	appendRow := func(values ghostferry.RowData, changeType string) error {
+		row, err := s.row(table, fields, values, changeType)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		return nil
+	}
+
+	for _, ev := range events {
+		dmlEvent, ok := ev.DXLEvent.(ghostferry.DMLEvent)
+		if !ok {
+			s.logger.WithField("table", ev.DXLEvent.Table()).Warnf("not replicating schema change to BigQuery at %v", ev.DXLEvent.BinlogPosition())
+			continue
+		}
+
+		if table != dmlEvent.TableSchema() {
+			if err := flush(); err != nil {
+				return err
+			}
+			table = dmlEvent.TableSchema()
+			fields = s.fields(table)
+		}
+
+		var err error
+		oldValues, newValues := dmlEvent.OldValues(), dmlEvent.NewValues()
+		switch {
+		case oldValues == nil:
+			err = appendRow(newValues, ChangeTypeInsert)
+		case newValues == nil:
+			err = appendRow(oldValues, ChangeTypeDelete)
+		case ghostferry.PrimaryKeyChanged(table, oldValues, newValues):
+			err = appendRow(oldValues, ChangeTypeDelete)
+			if err == nil {
+				err = appendRow(newValues, ChangeTypeInsert)
+			}
+		default:
+			err = appendRow(newValues, ChangeTypeUpdate)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+func (s *Sink) Close() error {
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+
+	var firstErr error
+	for _, stream := range s.streams {
+		stream.mutex.Lock()
+		if stream.writer != nil {
+			if err := stream.writer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			stream.writer = nil
+		}
+		stream.mutex.Unlock()
+	}
+
+	if err := s.client.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// fields returns the fields of the rows written for the table: the
+// replicated columns under their mapped names, followed by the change type
+// and the version
+func (s *Sink) fields(table *ghostferry.TableSchema) []field {
+	columnMapping := s.Config.ColumnMappings[table.String()]
+
+	fields := make([]field, 0, len(table.Columns)+2)
+	for i, column := range table.Columns {
+		name := column.Name
+		if mapped, exists := columnMapping[name]; exists {
+			if mapped == "" {
+				// the column is not replicated
+				continue
+			}
+			name = mapped
+		}
+		fields = append(fields, field{name: name, protoType: protoType(column), column: i})
+	}
+
+	return append(fields,
+		field{name: s.Config.ChangeTypeColumn, protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING, column: changeTypeField},
+		field{name: s.Config.VersionColumn, protoType: descriptorpb.FieldDescriptorProto_TYPE_INT64, column: versionField},
+	)
+}
+
+func protoType(column schema.TableColumn) descriptorpb.FieldDescriptorProto_Type {
+	switch column.Type {
+	case schema.TYPE_NUMBER:
+		if column.IsUnsigned && strings.HasPrefix(column.RawType, "bigint") {
+			// does not fit into INT64
+			return descriptorpb.FieldDescriptorProto_TYPE_STRING
+		}
+		return descriptorpb.FieldDescriptorProto_TYPE_INT64
+	case schema.TYPE_FLOAT:
+		return descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	case schema.TYPE_BINARY, schema.TYPE_VARBINARY:
+		return descriptorpb.FieldDescriptorProto_TYPE_BYTES
+	}
+	return descriptorpb.FieldDescriptorProto_TYPE_STRING
+}
+
+// rowDescriptor returns the message type of the rows with the fields
+func rowDescriptor(fields []field) *descriptorpb.DescriptorProto {
+	descriptor := &descriptorpb.DescriptorProto{Name: proto.String("GhostferryRow")}
+	for i, field := range fields {
+		descriptor.Field = append(descriptor.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(field.name),
+			Number: proto.Int32(int32(i + 1)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   field.protoType.Enum(),
+		})
+	}
+	return descriptor
+}
+
+// row encodes the values of a source row as a message of the fields
+func (s *Sink) row(table *ghostferry.TableSchema, fields []field, values ghostferry.RowData, changeType string) ([]byte, error) {
+	var row []byte
+	for i, field := range fields {
+		var value interface{}
+		switch {
+		case field.column == changeTypeField:
+			value = changeType
+		case field.column == versionField:
+			value = int64(s.versions.Next())
+		case field.column < len(values):
+			value = values[field.column]
+		}
+		if value == nil {
+			// NULL
+			continue
+		}
+
+		var err error
+		row, err = appendValue(row, protowire.Number(i+1), field.protoType, value)
+		if err != nil {
+			return nil, fmt.Errorf("encoding column %s of %s: %v", field.name, table.String(), err)
+		}
+	}
+	return row, nil
+}
+
+// appendValue encodes a column value as a field of the given type
+func appendValue(b []byte, number protowire.Number, protoType descriptorpb.FieldDescriptorProto_Type, value interface{}) ([]byte, error) {
+	switch protoType {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64:
+		i, err := int64Value(value)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, number, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(i)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		f, err := float64Value(value)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, number, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(f)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		if v, ok := value.([]byte); ok {
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			return protowire.AppendBytes(b, v), nil
+		}
+	}
+
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, fmt.Sprintf("%v", ghostferry.SinkValue(value))), nil
+}
+
+func int64Value(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("%d is out of range of INT64", v)
+		}
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint:
+		return int64(v), nil
+	}
+	return strconv.ParseInt(fmt.Sprintf("%v", ghostferry.SinkValue(value)), 10, 64)
+}
+
+func float64Value(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	}
+	return strconv.ParseFloat(fmt.Sprintf("%v", ghostferry.SinkValue(value)), 64)
+}
+
+// destination returns the dataset and the table in BigQuery that a table is
+// written to
+func (s *Sink) destination(table *ghostferry.TableSchema) (dataset, name string) {
+	if mapped, exists := s.Config.TableMappings[table.String()]; exists {
+		parts := strings.SplitN(mapped, ".", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1]
+		}
+		return s.dataset(table), mapped
+	}
+
+	name = table.Name
+	if rewrite, exists := s.TableRewrites[name]; exists {
+		name = rewrite
+	}
+
+	return s.dataset(table), name
+}
+
+func (s *Sink) dataset(table *ghostferry.TableSchema) string {
+	if s.Config.Dataset != "" {
+		return s.Config.Dataset
+	}
+
+	db := table.Schema
+	if rewrite, exists := s.DatabaseRewrites[db]; exists {
+		db = rewrite
+	}
+	return db
+}
+
+func (s *Sink) stream(table *ghostferry.TableSchema) *tableStream {
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+
+	stream, exists := s.streams[table.String()]
+	if !exists {
+		dataset, name := s.destination(table)
+		stream = &tableStream{dataset: dataset, table: name}
+		s.streams[table.String()] = stream
+	}
+	return stream
+}
+
+// appendRows appends the encoded rows to the stream of the table, in as few
+// requests as their size allows
+func (s *Sink) appendRows(table *ghostferry.TableSchema, fields []field, rows [][]byte) error {
+	stream := s.stream(table)
+	descriptor := rowDescriptor(fields)
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.pending != nil {
+		if err := s.append(stream, stream.pending); err != nil {
+			return err
+		}
+	}
+
+	for len(rows) > 0 {
+		size, count := 0, 0
+		for count < len(rows) && (count == 0 || size+len(rows[count]) < maxAppendBytes) {
+			size += len(rows[count])
+			count++
+		}
+
+		if err := s.append(stream, &appendRequest{descriptor: descriptor, rows: rows[:count]}); err != nil {
+			return err
+		}
+		rows = rows[count:]
+	}
+
+	return nil
+}
+
+// append appends the rows of a request at the offset of the stream. If the
+// result of the append is unknown, the request is kept as the pending one
+// of the stream.
+func (s *Sink) append(stream *tableStream, request *appendRequest) error {
+	if err := s.open(stream, request.descriptor); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.timeout)
+	defer cancel()
+
+	result, err := stream.writer.AppendRows(ctx, request.rows, managedwriter.WithOffset(stream.offset), managedwriter.UpdateSchemaDescriptor(request.descriptor))
+	var response *storagepb.AppendRowsResponse
+	if err == nil {
+		response, err = result.FullResponse(ctx)
+	}
+
+	if response == nil && err != nil {
+		// the rows may have been appended or not, and the connection is
+		// reopened to send them again
+		stream.pending = request
+		stream.writer.Close()
+		stream.writer = nil
+		return fmt.Errorf("appending to BigQuery table %s.%s failed: %v", stream.dataset, stream.table, err)
+	}
+	stream.pending = nil
+
+	if len(response.GetRowErrors()) > 0 {
+		rowError := response.GetRowErrors()[0]
+		return fmt.Errorf("appending to BigQuery table %s.%s failed for %d rows, first at row %d: %s", stream.dataset, stream.table, len(response.GetRowErrors()), rowError.GetIndex(), rowError.GetMessage())
+	}
+	if err != nil && storageErrorCode(err) != storagepb.StorageError_OFFSET_ALREADY_EXISTS {
+		return fmt.Errorf("appending to BigQuery table %s.%s failed: %v", stream.dataset, stream.table, err)
+	}
+	if err != nil {
+		s.logger.WithField("offset", stream.offset).Infof("rows of BigQuery table %s.%s were appended already", stream.dataset, stream.table)
+	}
+
+	stream.offset += int64(len(request.rows))
+	return nil
+}
+
+// open opens the connection of the stream, creating the stream on the first
+// append of the run
+func (s *Sink) open(stream *tableStream, descriptor *descriptorpb.DescriptorProto) error {
+	if stream.writer != nil {
+		return nil
+	}
+
+	options := []managedwriter.WriterOption{managedwriter.WithSchemaDescriptor(descriptor)}
+	if stream.name == "" {
+		options = append(options,
+			managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(s.Config.Project, stream.dataset, stream.table)),
+			managedwriter.WithType(managedwriter.CommittedStream),
+		)
+	} else {
+		options = append(options, managedwriter.WithStreamName(stream.name))
+	}
+
+	// the context is retained for the connection of the stream
+	writer, err := s.client.NewManagedStream(context.Background(), options...)
+	if err != nil {
+		return fmt.Errorf("opening stream of BigQuery table %s.%s failed: %v", stream.dataset, stream.table, err)
+	}
+
+	if stream.name == "" {
+		stream.name = writer.StreamName()
+		s.logger.WithField("stream", stream.name).Infof("created stream of BigQuery table %s.%s", stream.dataset, stream.table)
+	}
+	stream.writer = writer
+	return nil
+}
+
+// storageErrorCode returns the code of the StorageError detailing an error
+// of the Storage Write API, if any
+func storageErrorCode(err error) storagepb.StorageError_StorageErrorCode {
+	apiErr, ok := apierror.FromError(err)
+	if !ok {
+		return storagepb.StorageError_STORAGE_ERROR_CODE_UNSPECIFIED
+	}
+
+	storageErr := &storagepb.StorageError{}
+	if apiErr.Details().ExtractProtoMessage(storageErr) != nil {
+		return storagepb.StorageError_STORAGE_ERROR_CODE_UNSPECIFIED
+	}
+	return storageErr.GetCode()
+}
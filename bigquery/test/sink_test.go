@@ -0,0 +1,330 @@
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeBigQueryWrite serves the Storage Write API like BigQuery for committed
+// streams, keeping the appended rows decoded with their writer schema
+type fakeBigQueryWrite struct {
+	storagepb.UnimplementedBigQueryWriteServer
+
+	mutex   sync.Mutex
+	streams map[string][]map[string]interface{}
+	parents []string
+	offsets []int64
+
+	// the number of appends that fail after their rows were appended, as if
+	// the connection broke before the response
+	brokenAppends int
+	// the message of a RowError for the first row of every append
+	rowError string
+}
+
+func (this *fakeBigQueryWrite) CreateWriteStream(ctx context.Context, req *storagepb.CreateWriteStreamRequest) (*storagepb.WriteStream, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.parents = append(this.parents, req.GetParent())
+	name := req.GetParent() + "/streams/" + strconv.Itoa(len(this.parents))
+	this.streams[name] = nil
+	return &storagepb.WriteStream{Name: name, Type: req.GetWriteStream().GetType(), Location: "US"}, nil
+}
+
+func (this *fakeBigQueryWrite) GetWriteStream(ctx context.Context, req *storagepb.GetWriteStreamRequest) (*storagepb.WriteStream, error) {
+	return &storagepb.WriteStream{Name: req.GetName(), Type: storagepb.WriteStream_COMMITTED, Location: "US"}, nil
+}
+
+func (this *fakeBigQueryWrite) AppendRows(server storagepb.BigQueryWrite_AppendRowsServer) error {
+	// the stream and the writer schema are only sent when they change
+	var name string
+	var message protoreflect.MessageDescriptor
+
+	for {
+		req, err := server.Recv()
+		if err != nil {
+			return err
+		}
+
+		if req.GetWriteStream() != "" {
+			name = req.GetWriteStream()
+		}
+		if descriptor := req.GetProtoRows().GetWriterSchema().GetProtoDescriptor(); descriptor != nil {
+			file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+				Name:        proto.String("row.proto"),
+				MessageType: []*descriptorpb.DescriptorProto{descriptor},
+			}, nil)
+			if err != nil {
+				return err
+			}
+			message = file.Messages().Get(0)
+		}
+
+		response, err := this.append(name, message, req)
+		if err != nil {
+			return err
+		}
+		if err = server.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (this *fakeBigQueryWrite) append(name string, message protoreflect.MessageDescriptor, req *storagepb.AppendRowsRequest) (*storagepb.AppendRowsResponse, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	offset := req.GetOffset().GetValue()
+	this.offsets = append(this.offsets, offset)
+
+	if this.rowError != "" {
+		return &storagepb.AppendRowsResponse{
+			RowErrors: []*storagepb.RowError{{Index: 0, Message: this.rowError}},
+		}, nil
+	}
+
+	if offset < int64(len(this.streams[name])) {
+		st, err := status.New(codes.AlreadyExists, "offset already exists").WithDetails(&storagepb.StorageError{
+			Code: storagepb.StorageError_OFFSET_ALREADY_EXISTS,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &storagepb.AppendRowsResponse{
+			Response: &storagepb.AppendRowsResponse_Error{Error: st.Proto()},
+		}, nil
+	}
+
+	for _, serializedRow := range req.GetProtoRows().GetRows().GetSerializedRows() {
+		decoded := dynamicpb.NewMessage(message)
+		if err := proto.Unmarshal(serializedRow, decoded); err != nil {
+			return nil, err
+		}
+
+		row := map[string]interface{}{}
+		decoded.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+			row[string(field.Name())] = value.Interface()
+			return true
+		})
+		this.streams[name] = append(this.streams[name], row)
+	}
+
+	if this.brokenAppends > 0 {
+		this.brokenAppends--
+		return nil, status.Error(codes.Unavailable, "connection reset")
+	}
+
+	return &storagepb.AppendRowsResponse{
+		Response: &storagepb.AppendRowsResponse_AppendResult_{
+			AppendResult: &storagepb.AppendRowsResponse_AppendResult{Offset: wrapperspb.Int64(offset)},
+		},
+	}, nil
+}
+
+type BigQuerySinkTestSuite struct {
+	suite.Suite
+
+	server      *grpc.Server
+	bigQuery    *fakeBigQueryWrite
+	table       *ghostferry.TableSchema
+	config      *bigquery.Config
+	ferryConfig *ghostferry.Config
+	sink        *bigquery.Sink
+}
+
+func (this *BigQuerySinkTestSuite) SetupTest() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	this.Require().Nil(err)
+
+	this.bigQuery = &fakeBigQueryWrite{streams: map[string][]map[string]interface{}{}}
+	this.server = grpc.NewServer()
+	storagepb.RegisterBigQueryWriteServer(this.server, this.bigQuery)
+	go this.server.Serve(listener)
+
+	columns := []schema.TableColumn{
+		{Name: "id", Type: schema.TYPE_NUMBER},
+		{Name: "data", Type: schema.TYPE_STRING},
+		{Name: "secret", Type: schema.TYPE_STRING},
+		{Name: "score", Type: schema.TYPE_FLOAT},
+		{Name: "counter", Type: schema.TYPE_NUMBER, IsUnsigned: true, RawType: "bigint(20) unsigned"},
+	}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{Schema: "gftest", Name: "table1", Columns: columns, PKColumns: []int{0}},
+	}
+
+	this.config = &bigquery.Config{
+		Project:        "project",
+		TableMappings:  map[string]string{"gftest.table1": "warehouse.orders"},
+		ColumnMappings: map[string]map[string]string{"gftest.table1": {"data": "payload", "secret": ""}},
+	}
+	this.Require().Nil(this.config.Validate())
+	this.ferryConfig = &ghostferry.Config{}
+
+	this.sink, err = bigquery.NewSink(this.config, this.ferryConfig, logrus.WithField("tag", "test"),
+		option.WithEndpoint(listener.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	this.Require().Nil(err)
+}
+
+func (this *BigQuerySinkTestSuite) TearDownTest() {
+	this.sink.Close()
+	this.server.Stop()
+}
+
+// rows returns the rows appended to the only stream
+func (this *BigQuerySinkTestSuite) rows() []map[string]interface{} {
+	this.bigQuery.mutex.Lock()
+	defer this.bigQuery.mutex.Unlock()
+
+	this.Require().Equal([]string{"projects/project/datasets/warehouse/tables/orders"}, this.bigQuery.parents)
+	return this.bigQuery.streams["projects/project/datasets/warehouse/tables/orders/streams/1"]
+}
+
+func (this *BigQuerySinkTestSuite) TestWriteRowBatchWithMappings() {
+	batch := ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a"), "x", 1.5, uint64(math.MaxUint64)},
+		{int64(2), nil, "y", nil, uint64(7)},
+	})
+	this.Require().Nil(this.sink.WriteRowBatch(batch))
+
+	rows := this.rows()
+	this.Require().Equal(2, len(rows))
+	row := rows[0]
+	this.Require().Equal(int64(1), row["id"])
+	this.Require().Equal("a", row["payload"])
+	this.Require().Equal(1.5, row["score"])
+	this.Require().Equal("18446744073709551615", row["counter"])
+	this.Require().Equal(bigquery.ChangeTypeInsert, row["_change_type"])
+	this.Require().NotContains(row, "secret")
+	this.Require().NotContains(row, "data")
+
+	// NULLs are omitted
+	row = rows[1]
+	this.Require().Equal(int64(2), row["id"])
+	this.Require().Equal("7", row["counter"])
+	this.Require().NotContains(row, "payload")
+	this.Require().NotContains(row, "score")
+
+	this.Require().True(rows[1]["_version"].(int64) > rows[0]["_version"].(int64))
+}
+
+func (this *BigQuerySinkTestSuite) TestWriteBinlogEventsAsChangeLog() {
+	tableMapEvent := &replication.TableMapEvent{Schema: []byte("gftest"), Table: []byte("table1")}
+	pos := ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 100})
+
+	updates, err := ghostferry.NewBinlogUpdateEvents(this.table, &replication.RowsEvent{
+		Table: tableMapEvent,
+		Rows: [][]interface{}{
+			{int64(1), []byte("a"), "x", nil, nil}, {int64(1), []byte("b"), "x", nil, nil},
+			{int64(2), []byte("c"), "x", nil, nil}, {int64(3), []byte("c"), "x", nil, nil},
+		},
+	}, pos, time.Now())
+	this.Require().Nil(err)
+
+	var events []ghostferry.DXLEventWrapper
+	for _, ev := range updates {
+		events = append(events, ghostferry.DXLEventWrapper{DXLEvent: ev})
+	}
+	this.Require().Nil(this.sink.WriteBinlogEvents(events))
+
+	rows := this.rows()
+	this.Require().Equal(3, len(rows))
+	this.Require().Equal(bigquery.ChangeTypeUpdate, rows[0]["_change_type"])
+	this.Require().Equal("b", rows[0]["payload"])
+	this.Require().Equal(bigquery.ChangeTypeDelete, rows[1]["_change_type"])
+	this.Require().Equal(int64(2), rows[1]["id"])
+	this.Require().Equal(bigquery.ChangeTypeInsert, rows[2]["_change_type"])
+	this.Require().Equal(int64(3), rows[2]["id"])
+}
+
+func (this *BigQuerySinkTestSuite) TestAppendsAtTheOffsetsOfTheStream() {
+	this.Require().Nil(this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(1)}, {int64(2)}})))
+	this.Require().Nil(this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(3)}})))
+
+	this.Require().Equal(3, len(this.rows()))
+	this.Require().Equal([]int64{0, 2}, this.bigQuery.offsets)
+}
+
+func (this *BigQuerySinkTestSuite) TestAppendsRowsOfUnknownResultOnce() {
+	this.bigQuery.brokenAppends = 1
+
+	err := this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(1)}, {int64(2)}}))
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "appending to BigQuery table warehouse.orders failed")
+
+	// the rows of the broken append are sent again at the same offset first
+	this.Require().Nil(this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(3)}})))
+
+	rows := this.rows()
+	this.Require().Equal(3, len(rows))
+	this.Require().Equal(int64(1), rows[0]["id"])
+	this.Require().Equal(int64(2), rows[1]["id"])
+	this.Require().Equal(int64(3), rows[2]["id"])
+	this.Require().Equal([]int64{0, 0, 2}, this.bigQuery.offsets)
+}
+
+func (this *BigQuerySinkTestSuite) TestRowErrors() {
+	this.bigQuery.rowError = "invalid"
+
+	err := this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(1)}, {int64(2)}}))
+	this.Require().EqualError(err, "appending to BigQuery table warehouse.orders failed for 1 rows, first at row 0: invalid")
+}
+
+func (this *BigQuerySinkTestSuite) TestValidatesCredentials() {
+	config := &bigquery.Config{Project: "project", CredentialsFile: "key.json", AccessTokenFile: "token"}
+	this.Require().EqualError(config.Validate(), "CredentialsFile and AccessTokenFile are mutually exclusive")
+}
+
+func (this *BigQuerySinkTestSuite) TestRejectsUnsupportedCredentialsFile() {
+	credentialsFile, err := ioutil.TempFile("", "ghostferry-bigquery-credentials")
+	this.Require().Nil(err)
+	defer os.Remove(credentialsFile.Name())
+	_, err = credentialsFile.WriteString(`{"type": "api_key"}`)
+	this.Require().Nil(err)
+	credentialsFile.Close()
+
+	config := &bigquery.Config{Project: "project", CredentialsFile: credentialsFile.Name()}
+	this.Require().Nil(config.Validate())
+	_, err = bigquery.NewSink(config, this.ferryConfig, logrus.WithField("tag", "test"))
+	this.Require().EqualError(err, "unsupported type of CredentialsFile (set to api_key)")
+}
+
+func (this *BigQuerySinkTestSuite) TestRequiresFullRowImages() {
+	this.ferryConfig.AllowMinimalBinlogRowImage = true
+	_, err := bigquery.NewSink(this.config, this.ferryConfig, logrus.WithField("tag", "test"))
+	this.Require().EqualError(err, "the BigQuery sink requires full binlog row images and is incompatible with AllowMinimalBinlogRowImage")
+}
+
+func TestBigQuerySink(t *testing.T) {
+	suite.Run(t, new(BigQuerySinkTestSuite))
+}
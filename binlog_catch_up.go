@@ -0,0 +1,135 @@
+package ghostferry
+
+import (
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// CatchUpStatus describes how far the binlog streaming is behind the current
+// position of the source, for deciding whether to proceed with the cutover.
+type CatchUpStatus struct {
+	Time             time.Time
+	StreamedPosition mysql.Position
+	SourcePosition   mysql.Position
+
+	// The bytes of binlogs the source wrote after the last streamed event
+	BytesBehind uint64
+
+	// How long ago the last streamed event was written on the source, in
+	// seconds
+	Lag float64
+
+	// How long streaming the bytes behind is expected to take, in seconds, at
+	// the rate the streaming caught up since the previous status. -1 if the
+	// streaming did not catch up since then.
+	EstimatedRemaining float64
+
+	// Whether the lag and the bytes behind are within the CatchUpConfig
+	CaughtUp bool
+}
+
+// CatchUpStatus compares the last streamed position to the current position
+// of the source.
+func (s *BinlogStreamer) CatchUpStatus() (CatchUpStatus, error) {
+	s.ensureLogger()
+	config := s.catchUpConfig()
+
+	status := CatchUpStatus{
+		Time:             time.Now(),
+		StreamedPosition: s.GetLastStreamedBinlogPosition(),
+	}
+
+	var err error
+	status.SourcePosition, err = ShowMasterStatusBinlogPosition(s.DB)
+	if err != nil {
+		return status, err
+	}
+
+	if status.StreamedPosition.Name != status.SourcePosition.Name && status.StreamedPosition.Compare(status.SourcePosition) < 0 {
+		binaryLogs, err := ShowBinaryLogs(s.DB)
+		if err != nil {
+			return status, err
+		}
+		status.BytesBehind = BinlogBytesBetween(status.StreamedPosition, status.SourcePosition, binaryLogs)
+	} else {
+		status.BytesBehind = BinlogBytesBetween(status.StreamedPosition, status.SourcePosition, nil)
+	}
+
+	lag := status.Time.Sub(s.lastProcessedEventTime)
+	status.Lag = lag.Seconds()
+	status.CaughtUp = status.StreamedPosition.Name != "" && lag <= config.maxLag && (config.MaxBytesBehind == 0 || status.BytesBehind <= config.MaxBytesBehind)
+
+	s.catchUpMutex.Lock()
+	status.EstimatedRemaining = estimateRemaining(s.lastCatchUpStatus, status)
+	s.lastCatchUpStatus = &status
+	s.catchUpMutex.Unlock()
+
+	if s.metrics != nil {
+		s.metrics.Gauge("BinlogStreamer.BytesBehind", float64(status.BytesBehind), nil, 1.0)
+	}
+
+	return status, nil
+}
+
+func (s *BinlogStreamer) catchUpConfig() *CatchUpConfig {
+	if s.CatchUpConfig != nil && s.CatchUpConfig.checkInterval > 0 {
+		return s.CatchUpConfig
+	}
+
+	// not validated, e.g. as the streamer is used on its own
+	config := &CatchUpConfig{}
+	if s.CatchUpConfig != nil {
+		*config = *s.CatchUpConfig
+	}
+	if err := config.Validate(); err != nil {
+		s.logger.WithError(err).Warn("invalid CatchUpConfig, using the defaults")
+		config = &CatchUpConfig{}
+		config.Validate()
+	}
+	return config
+}
+
+// estimateRemaining returns the seconds the streaming is expected to take to
+// stream the bytes behind of the status, at the rate it caught up since the
+// previous status
+func estimateRemaining(previous *CatchUpStatus, status CatchUpStatus) float64 {
+	if status.BytesBehind == 0 {
+		return 0
+	}
+	if previous == nil || previous.BytesBehind <= status.BytesBehind {
+		return -1
+	}
+
+	elapsed := status.Time.Sub(previous.Time).Seconds()
+	if elapsed <= 0 {
+		return -1
+	}
+	rate := float64(previous.BytesBehind-status.BytesBehind) / elapsed
+	return float64(status.BytesBehind) / rate
+}
+
+// BinlogBytesBetween returns the bytes of binlogs from one position up to
+// another, given the binlog files of the database, which are only needed if
+// the positions are in different files.
+func BinlogBytesBetween(from, to mysql.Position, binaryLogs []BinaryLog) uint64 {
+	if from.Compare(to) >= 0 {
+		return 0
+	}
+	if from.Name == to.Name {
+		return uint64(to.Pos - from.Pos)
+	}
+
+	bytes := uint64(to.Pos)
+	for _, binaryLog := range binaryLogs {
+		file := mysql.Position{Name: binaryLog.Name}
+		if binaryLog.Name == from.Name {
+			if binaryLog.Size > uint64(from.Pos) {
+				bytes += binaryLog.Size - uint64(from.Pos)
+			}
+		} else if file.Compare(mysql.Position{Name: from.Name}) > 0 && file.Compare(mysql.Position{Name: to.Name}) < 0 {
+			bytes += binaryLog.Size
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,260 @@
+package ghostferry
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	BinlogEventFilterInsert = "INSERT"
+	BinlogEventFilterUpdate = "UPDATE"
+	BinlogEventFilterDelete = "DELETE"
+)
+
+var binlogEventFilterEvents = map[string]bool{
+	BinlogEventFilterInsert: true,
+	BinlogEventFilterUpdate: true,
+	BinlogEventFilterDelete: true,
+}
+
+// BinlogEventFilter skips the binlog events of rows matching the rules of
+// their table, see Config.BinlogEventFilter.
+//
+// The columns of the rules are looked up by name for each event, so the rules
+// keep working after schema changes of the tables. A condition on a column
+// the table no longer has does not match.
+//
+// After a skipped UPDATE, the row on the target no longer matches the before
+// image of the next events of the row. The UPDATE and DELETE events of the
+// tables whose UPDATEs may be skipped therefore match their row by the
+// pagination key only, see MatchByPaginationKey.
+type BinlogEventFilter struct {
+	Config *BinlogEventFilterConfig
+}
+
+// NewBinlogEventFilter validates the columns of the rules against the tables
+func NewBinlogEventFilter(config *BinlogEventFilterConfig, tables TableSchemaCache) (*BinlogEventFilter, error) {
+	for schemaName, tableRules := range config.Rules {
+		for tableName, rules := range tableRules {
+			table := tables.Get(schemaName, tableName)
+			if table == nil {
+				// the table may have been filtered
+				continue
+			}
+
+			if binlogEventFilterSkipsUpdates(rules) && table.PaginationKey == nil {
+				return nil, fmt.Errorf("table %s has no pagination key to match the rows of its events by, which is required to skip its UPDATEs", table)
+			}
+
+			for _, rule := range rules {
+				columns := append([]string{}, rule.ChangedColumnsWithin...)
+				for _, condition := range rule.Conditions {
+					columns = append(columns, condition.Column)
+				}
+
+				for _, name := range columns {
+					if table.FindColumn(name) < 0 {
+						return nil, fmt.Errorf("column %s of table %s does not exist", name, table)
+					}
+				}
+			}
+		}
+	}
+
+	return &BinlogEventFilter{Config: config}, nil
+}
+
+// Skip returns whether the event matches any of the rules of its table
+func (f *BinlogEventFilter) Skip(ev DMLEvent) bool {
+	tableRules, found := f.Config.Rules[ev.Database()]
+	if !found {
+		return false
+	}
+
+	for _, rule := range tableRules[ev.Table()] {
+		if binlogEventFilterRuleMatches(rule, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchByPaginationKey makes the UPDATE or DELETE event match its row on the
+// target by the pagination key only, if UPDATEs of its table may be skipped.
+// An UPDATE then sets the values of all the columns of its image, overwriting
+// the changes of the UPDATEs skipped before. With a minimal binlog row image,
+// the columns it did not change keep their values on the target.
+func (f *BinlogEventFilter) MatchByPaginationKey(ev DMLEvent) {
+	tableRules, found := f.Config.Rules[ev.Database()]
+	if !found || !binlogEventFilterSkipsUpdates(tableRules[ev.Table()]) {
+		return
+	}
+
+	table := ev.TableSchema()
+	if table.PaginationKey == nil {
+		return
+	}
+
+	image := make(RowImage, (len(table.Columns)+7)/8)
+	for _, idx := range table.PaginationKey.ColumnIndices {
+		image[idx/8] |= 1 << uint(idx%8)
+	}
+
+	switch e := ev.(type) {
+	case *BinlogUpdateEvent:
+		e.oldImage = image
+	case *BinlogDeleteEvent:
+		e.oldImage = image
+	}
+}
+
+func binlogEventFilterSkipsUpdates(rules []BinlogEventFilterRule) bool {
+	for _, rule := range rules {
+		if len(rule.Events) == 0 {
+			return true
+		}
+		for _, event := range rule.Events {
+			if strings.ToUpper(event) == BinlogEventFilterUpdate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func binlogEventFilterRuleMatches(rule BinlogEventFilterRule, ev DMLEvent) bool {
+	var eventType string
+	row := ev.NewValues()
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		eventType = BinlogEventFilterInsert
+	case *BinlogUpdateEvent:
+		eventType = BinlogEventFilterUpdate
+	case *BinlogDeleteEvent:
+		eventType = BinlogEventFilterDelete
+		row = ev.OldValues()
+	default:
+		return false
+	}
+
+	if len(rule.Events) > 0 {
+		applies := false
+		for _, event := range rule.Events {
+			if strings.ToUpper(event) == eventType {
+				applies = true
+				break
+			}
+		}
+		if !applies {
+			return false
+		}
+	}
+
+	table := ev.TableSchema()
+	for _, condition := range rule.Conditions {
+		index := table.FindColumn(condition.Column)
+		if index < 0 || index >= len(row) || !condition.matches(row[index]) {
+			return false
+		}
+	}
+
+	if len(rule.ChangedColumnsWithin) > 0 && eventType == BinlogEventFilterUpdate {
+		within := make(map[string]bool)
+		for _, name := range rule.ChangedColumnsWithin {
+			within[name] = true
+		}
+
+		oldValues := ev.OldValues()
+		for i, column := range table.Columns {
+			if within[column.Name] || i >= len(row) || i >= len(oldValues) {
+				continue
+			}
+			if !binlogValuesEqual(oldValues[i], row[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (c BinlogEventFilterCondition) matches(value interface{}) bool {
+	switch strings.ToUpper(c.Operator) {
+	case "IS NULL":
+		return value == nil
+	case "IS NOT NULL":
+		return value != nil
+	}
+
+	// a comparison with NULL is never true, as in SQL
+	if value == nil {
+		return false
+	}
+
+	switch strings.ToUpper(c.Operator) {
+	case "=":
+		return compareBinlogValue(value, c.Value) == 0
+	case "!=":
+		return compareBinlogValue(value, c.Value) != 0
+	case "<":
+		return compareBinlogValue(value, c.Value) < 0
+	case "<=":
+		return compareBinlogValue(value, c.Value) <= 0
+	case ">":
+		return compareBinlogValue(value, c.Value) > 0
+	case ">=":
+		return compareBinlogValue(value, c.Value) >= 0
+	case "IN", "NOT IN":
+		in := false
+		for _, operand := range c.Values {
+			if compareBinlogValue(value, operand) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (strings.ToUpper(c.Operator) == "IN")
+	}
+	return false
+}
+
+// compareBinlogValue compares the value of a column with the operand of a
+// condition, as numbers if both are numeric and as strings otherwise
+func compareBinlogValue(value interface{}, operand string) int {
+	var str string
+	switch v := value.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		str = fmt.Sprintf("%v", v)
+	}
+
+	number, err := strconv.ParseFloat(str, 64)
+	if err == nil {
+		operandNumber, err := strconv.ParseFloat(operand, 64)
+		if err == nil {
+			switch {
+			case number < operandNumber:
+				return -1
+			case number > operandNumber:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	return strings.Compare(str, operand)
+}
+
+func binlogValuesEqual(a, b interface{}) bool {
+	aBytes, aIsBytes := a.([]byte)
+	bBytes, bIsBytes := b.([]byte)
+	if aIsBytes || bIsBytes {
+		return aIsBytes && bIsBytes && bytes.Equal(aBytes, bBytes) && (aBytes == nil) == (bBytes == nil)
+	}
+	return fmt.Sprintf("%T %v", a, a) == fmt.Sprintf("%T %v", b, b)
+}
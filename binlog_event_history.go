@@ -0,0 +1,129 @@
+package ghostferry
+
+import (
+	"container/ring"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// BinlogEventRecord describes a binlog event handled by the BinlogWriter in
+// the state dumps, see Config.StateDumpBinlogEvents
+type BinlogEventRecord struct {
+	Position  BinlogPosition
+	EventTime time.Time
+	EventType string `json:",omitempty"`
+	Table     string `json:",omitempty"`
+	// The statement applied to the target for the event, or the statement of
+	// the source for query events that were not applied yet
+	Statement string `json:",omitempty"`
+}
+
+// BinlogEventHistorySnapshot is the content of a BinlogEventHistory at the
+// time the state was dumped
+type BinlogEventHistorySnapshot struct {
+	// The most recently applied events, oldest first
+	Applied []BinlogEventRecord
+	// The oldest events received by the BinlogWriter that were not applied
+	// yet, the first of which is usually the one the ferry failed on
+	Pending []BinlogEventRecord
+}
+
+// BinlogEventHistory keeps the last applied and the first pending binlog
+// events of the BinlogWriter, such that the state dumped when the ferry dies
+// tells what was being replicated without reading the source binlogs.
+type BinlogEventHistory struct {
+	size int
+
+	mutex   sync.Mutex
+	applied *ring.Ring
+	pending []BinlogEventRecord
+}
+
+func NewBinlogEventHistory(size int) *BinlogEventHistory {
+	return &BinlogEventHistory{
+		size:    size,
+		applied: ring.New(size),
+		pending: make([]BinlogEventRecord, 0, size),
+	}
+}
+
+func newBinlogEventRecord(ev *ReplicationEvent) BinlogEventRecord {
+	record := BinlogEventRecord{
+		Position:  ev.BinlogPosition,
+		EventTime: ev.EventTime,
+	}
+	if ev.BinlogEvent == nil {
+		return record
+	}
+
+	record.EventType = ev.BinlogEvent.Header.EventType.String()
+	switch event := ev.BinlogEvent.Event.(type) {
+	case *replication.RowsEvent:
+		record.Table = string(event.Table.Schema) + "." + string(event.Table.Table)
+	case *replication.QueryEvent:
+		record.Statement = string(event.Query)
+	}
+	return record
+}
+
+// Received records an event handed to the BinlogWriter as pending. Events
+// beyond the size of the history are not recorded until earlier ones are
+// applied.
+func (h *BinlogEventHistory) Received(record BinlogEventRecord) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.pending) < h.size {
+		h.pending = append(h.pending, record)
+	}
+}
+
+// Applied records the events written to the target, and drops all pending
+// events up to the given position, including the events that were filtered
+// and not written at all.
+func (h *BinlogEventHistory) Applied(records []BinlogEventRecord, lastPosition BinlogPosition) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, record := range records {
+		h.applied.Value = record
+		h.applied = h.applied.Next()
+	}
+
+	pending := h.pending[:0]
+	for _, record := range h.pending {
+		if record.Position.Compare(lastPosition) > 0 {
+			pending = append(pending, record)
+		}
+	}
+	h.pending = pending
+}
+
+func (h *BinlogEventHistory) Snapshot() *BinlogEventHistorySnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	snapshot := &BinlogEventHistorySnapshot{
+		Applied: make([]BinlogEventRecord, 0, h.size),
+		Pending: make([]BinlogEventRecord, len(h.pending)),
+	}
+
+	// the ring points to the oldest (or next empty) element
+	h.applied.Do(func(value interface{}) {
+		if value != nil {
+			snapshot.Applied = append(snapshot.Applied, value.(BinlogEventRecord))
+		}
+	})
+	copy(snapshot.Pending, h.pending)
+	return snapshot
+}
@@ -0,0 +1,203 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// BinlogRetentionMonitor periodically checks that the binlogs holding the
+// position the run would resume from are still kept by the source, and
+// alerts when they are about to be purged, e.g. as the run is paused or
+// lagging for long. A run whose resume position is purged can only be
+// restarted from scratch.
+//
+// The age of the resume position is approximated by the apply lag of the
+// binlog writer, which is 0 while it is caught up with the source.
+type BinlogRetentionMonitor struct {
+	Config   *BinlogRetentionConfig
+	DB       *sql.DB
+	Position func() mysql.Position
+	Age      func(now time.Time) time.Duration
+
+	// If set, the retention is the binlog retention hours of the RDS
+	// configuration, see DatabaseConfig.IsRDS
+	RDS bool
+
+	// Optional: notified when the resume position becomes at risk
+	Notify func(event, summary string, details map[string]string)
+
+	atRisk bool
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+func (f *Ferry) NewBinlogRetentionMonitor() *BinlogRetentionMonitor {
+	f.ensureInitialized()
+
+	return &BinlogRetentionMonitor{
+		Config: &f.Config.BinlogRetention,
+		DB:     f.SourceDB,
+		RDS:    f.Source.IsRDS(),
+		Position: func() mysql.Position {
+			return resumeBinlogPosition(f.StateTracker.Serialize(nil, nil), f.inlineVerifier != nil)
+		},
+		Age:     f.BinlogWriter.ApplyLag,
+		Notify:  f.notify,
+		logger:  f.loggerFor("binlog_retention"),
+		metrics: f.Metrics,
+	}
+}
+
+func (m *BinlogRetentionMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Config.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Check(now)
+		}
+	}
+}
+
+// Check reports the time left until the resume position is expected to be
+// purged at the given time, and returns whether it is at risk
+func (m *BinlogRetentionMonitor) Check(now time.Time) bool {
+	if m.logger == nil {
+		m.logger = logrus.WithField("tag", "binlog_retention")
+	}
+
+	pos := m.Position()
+	if pos.Name == "" {
+		return false
+	}
+
+	details := map[string]string{"resume_position": pos.String()}
+
+	if m.DB != nil {
+		if err := CheckBinlogPositionAvailable(m.DB, pos); err != nil {
+			m.logger.WithError(err).Error("the resume position is no longer available on the source")
+			m.alert(fmt.Sprintf("the resume position is no longer available: %v", err), details)
+			return true
+		}
+	}
+
+	retention, err := m.retention()
+	if err != nil {
+		m.logger.WithError(err).Warn("failed to read the binlog retention of the source")
+		return m.atRisk
+	}
+
+	// the source does not purge binlogs on its own
+	if retention == 0 {
+		m.recovered()
+		return false
+	}
+
+	age := m.Age(now)
+	remaining := retention - age
+	m.metrics.Gauge("BinlogRetention.Remaining", remaining.Seconds(), nil, 1.0)
+
+	if remaining > m.Config.warningMargin {
+		m.recovered()
+		return false
+	}
+
+	summary := fmt.Sprintf("the binlogs of resume position %s are expected to be purged in %s", pos, remaining.Round(time.Second))
+	details["remaining_seconds"] = fmt.Sprintf("%.0f", remaining.Seconds())
+	m.logger.WithFields(logrus.Fields{
+		"resume_position": pos,
+		"age":             age.Round(time.Second),
+		"retention":       retention,
+		"remaining":       remaining.Round(time.Second),
+	}).Warn("the resume position is at risk of being purged from the source")
+	m.alert(summary, details)
+
+	return true
+}
+
+func (m *BinlogRetentionMonitor) retention() (time.Duration, error) {
+	if m.Config.retention > 0 {
+		return m.Config.retention, nil
+	}
+	return BinlogRetention(m.DB, m.RDS)
+}
+
+// alert notifies once each time the resume position becomes at risk
+func (m *BinlogRetentionMonitor) alert(summary string, details map[string]string) {
+	if m.atRisk {
+		return
+	}
+	m.atRisk = true
+
+	m.metrics.Count("BinlogRetention.AtRisk", 1, nil, 1.0)
+	if m.Notify != nil {
+		m.Notify(NotificationBinlogRetentionAtRisk, summary, details)
+	}
+}
+
+func (m *BinlogRetentionMonitor) recovered() {
+	if m.atRisk {
+		m.logger.Info("the resume position is no longer at risk of being purged")
+	}
+	m.atRisk = false
+}
+
+// BinlogRetention returns how long the database keeps its binlogs before
+// purging them, or 0 if they are not purged automatically. RDS and Aurora
+// purge the binlogs according to their binlog retention hours instead of the
+// variables of MySQL.
+func BinlogRetention(db *sql.DB, rds bool) (time.Duration, error) {
+	if rds {
+		return rdsBinlogRetention(db)
+	}
+
+	// binlog_expire_logs_seconds supersedes expire_logs_days as of MySQL 8.0
+	value, secondsErr := queryVariable(db, "global.binlog_expire_logs_seconds")
+	if secondsErr == nil {
+		seconds, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing binlog_expire_logs_seconds %q: %v", value, err)
+		}
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second, nil
+		}
+	}
+
+	// expire_logs_days is removed in later versions of MySQL 8.0
+	value, err := queryVariable(db, "global.expire_logs_days")
+	if err != nil {
+		if secondsErr == nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	days, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing expire_logs_days %q: %v", value, err)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// resumeBinlogPosition returns the position the binlog streaming resumes
+// from for the state, see Ferry.Start
+func resumeBinlogPosition(state *SerializableState, inlineVerifier bool) mysql.Position {
+	pos := state.LastWrittenBinlogPosition
+	if inlineVerifier {
+		pos = state.MinBinlogPosition()
+	}
+
+	if pos.ResumePosition.Name == "" {
+		return pos.EventPosition
+	}
+	return pos.ResumePosition
+}
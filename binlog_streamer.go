@@ -6,6 +6,9 @@ import (
 	sqlorig "database/sql"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
@@ -60,8 +63,34 @@ type BinlogStreamer struct {
 	DBConfig     *DatabaseConfig
 	MyServerId   uint32
 	ErrorHandler ErrorHandler
+
+	// The range of server ids to generate MyServerId from, if it is not set
+	MyServerIdMin uint32
+	MyServerIdMax uint32
+
 	ReadRetries  int
 
+	// If set, decides whether failures to read the binlogs are retried, see
+	// ErrorPolicyConfig
+	ErrorPolicy *ErrorPolicyConfig
+
+	// Decides when the streaming is caught up with the source, see
+	// CatchUpStatus. Optional: defaults to the defaults of CatchUpConfig
+	CatchUpConfig *CatchUpConfig
+
+	// If set, events for which this returns true are not emitted to the
+	// event listeners
+	SkipEvent func(*ReplicationEvent) bool
+
+	// If set, streaming stops right before the first transaction starting at
+	// or after this position, such that the target is left at this point in
+	// time of the source.
+	StopAtPosition *mysql.Position
+
+	// If set, streaming stops right before the first transaction written on
+	// the source after this time.
+	StopAtTime time.Time
+
 	binlogSyncer   *replication.BinlogSyncer
 	binlogStreamer *replication.BinlogStreamer
 	// what is the last event that we ever received from the streamer
@@ -79,11 +108,26 @@ type BinlogStreamer struct {
 	targetBinlogPosition           mysql.Position
 	lastProcessedEventTime         time.Time
 	lastLagMetricEmittedTime       time.Time
+	// 1 while no event was received within the last timeout, i.e. all
+	// events of the source were streamed, see IsIdle
+	idle int32
 
 	stopRequested bool
+	// when streaming stopped at StopAtPosition or StopAtTime
+	stopPointReachedAt time.Time
+	// the server_id is only checked for collisions when first connecting, as
+	// the source may still list this streamer as a replica when reconnecting
+	serverIdChecked bool
+	// the previous status returned by CatchUpStatus, to estimate the rate at
+	// which the streaming catches up
+	catchUpMutex      sync.Mutex
+	lastCatchUpStatus *CatchUpStatus
 
 	logger         *logrus.Entry
+	metrics        *Metrics
 	eventListeners []func(*ReplicationEvent) error
+
+	incrediblyVerboseLogging bool
 }
 
 func (s *BinlogStreamer) ensureLogger() {
@@ -101,6 +145,17 @@ func (s *BinlogStreamer) createBinlogSyncer() error {
 		if err != nil {
 			return err
 		}
+
+		// unlike the MySQL driver, the replication client does not default
+		// to verifying the name of the host it connects to
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = s.DBConfig.Host
+		}
+	} else if s.DBConfig.IsRDS() {
+		// RDS commonly requires secure transport, verified against the
+		// system root certificates as for the SQL connections
+		tlsConfig = &tls.Config{ServerName: s.DBConfig.Host}
 	}
 
 	if s.MyServerId == 0 {
@@ -109,17 +164,47 @@ func (s *BinlogStreamer) createBinlogSyncer() error {
 			s.logger.WithError(err).Error("could not generate unique server_id")
 			return err
 		}
+	} else if !s.serverIdChecked {
+		// the source disconnects replicas registering with the server_id of
+		// another replica, which would make streaming fail in confusing ways
+		collision, err := serverIdCollision(s.MyServerId, s.DB)
+		if err != nil {
+			s.logger.WithError(err).Error("could not check if server_id is unique")
+			return err
+		}
+		if collision != "" {
+			return fmt.Errorf("server_id %d is already used by %s", s.MyServerId, collision)
+		}
+	}
+	s.serverIdChecked = true
+
+	host, port, err := s.DBConfig.DialAddress()
+	if err != nil {
+		return err
+	}
+
+	// the TIMESTAMP values are formatted like the copied ones
+	timeZone, err := s.DBConfig.Location()
+	if err != nil {
+		return err
+	}
+
+	// the binlog replication client only supports password authentication,
+	// see DatabaseConfig.IAMAuthRegion
+	credentials := &CredentialsConfig{User: s.DBConfig.User, Pass: s.DBConfig.Pass}
+	if s.DBConfig.ComponentCredentials.BinlogStreamer != nil {
+		credentials = s.DBConfig.ComponentCredentials.BinlogStreamer
 	}
 
 	syncerConfig := replication.BinlogSyncerConfig{
 		ServerID:                s.MyServerId,
-		Host:                    s.DBConfig.Host,
-		Port:                    s.DBConfig.Port,
-		User:                    s.DBConfig.User,
-		Password:                s.DBConfig.Pass,
+		Host:                    host,
+		Port:                    port,
+		User:                    credentials.User,
+		Password:                credentials.Pass,
 		TLSConfig:               tlsConfig,
 		UseDecimal:              true,
-		TimestampStringLocation: time.UTC,
+		TimestampStringLocation: timeZone,
 	}
 
 	s.binlogSyncer = replication.NewBinlogSyncer(syncerConfig)
@@ -200,15 +285,28 @@ func (s *BinlogStreamer) Run() {
 		})
 
 		if err != nil {
-			s.ErrorHandler.Fatal("binlog_streamer", err)
+			if s.ErrorPolicy.ActionFor("binlog_streamer", err) != ErrorActionRetry {
+				s.ErrorHandler.Fatal("binlog_streamer", err)
+			}
+
+			s.logger.WithError(err).Warnf("failed to read binlogs, reconnecting in %s", s.ErrorPolicy.retryInterval)
+			time.Sleep(s.ErrorPolicy.retryInterval)
+			if err = s.reconnect(); err != nil {
+				s.logger.WithError(err).Error("giving up reconnecting binlog streamer")
+				s.ErrorHandler.Fatal("binlog_streamer", err)
+				return
+			}
+			continue
 		}
 
 		if timedOut {
 			s.lastProcessedEventTime = time.Now()
+			atomic.StoreInt32(&s.idle, 1)
 			continue
 		}
+		atomic.StoreInt32(&s.idle, 0)
 
-		if IncrediblyVerboseLogging {
+		if s.incrediblyVerboseLogging {
 			s.logger.WithFields(logrus.Fields{
 				"header": ev.Header,
 				"event":  ev.Event,
@@ -244,6 +342,18 @@ func (s *BinlogStreamer) Run() {
 			// as it will contain the wrong thing.
 			continue
 		case *replication.QueryEvent:
+			if s.isStopPoint(ev, e) {
+				s.logger.WithFields(logrus.Fields{
+					"position":   s.lastStreamedBinlogPosition,
+					"event_time": time.Unix(int64(ev.Header.Timestamp), 0),
+				}).Info("reached the stop point, stopping binlog streamer")
+
+				s.stopPointReachedAt = time.Now()
+				s.targetBinlogPosition = s.lastStreamedBinlogPosition
+				s.stopRequested = true
+				continue
+			}
+
 			// This event tells us about table structure change which means
 			// the cached schemas of the tables would be invalidated.
 			err = s.emitEvent(ev)
@@ -264,6 +374,37 @@ func (s *BinlogStreamer) Run() {
 	s.logger.Info("binlog streamer stopped")
 }
 
+// reconnect restarts streaming from the last position it can resume from,
+// without emitting the events that were already emitted again. It retries
+// until the ErrorPolicy.ReconnectTimeout, and stops retrying once the
+// streamer was stopped at a position it already streamed up to.
+func (s *BinlogStreamer) reconnect() error {
+	deadline := time.Now().Add(s.ErrorPolicy.reconnectTimeout)
+
+	for {
+		s.binlogSyncer.Close()
+
+		if s.stopRequested && s.lastStreamedBinlogPosition.Compare(s.targetBinlogPosition) >= 0 {
+			return nil
+		}
+
+		_, err := s.ConnectBinlogStreamerToMysqlFrom(BinlogPosition{
+			EventPosition:  s.lastStreamedBinlogPosition,
+			ResumePosition: s.lastResumeBinlogPosition,
+		})
+		if err == nil {
+			return nil
+		}
+
+		if !time.Now().Add(s.ErrorPolicy.retryInterval).Before(deadline) {
+			return fmt.Errorf("failed to reconnect binlog streamer within %s: %v", s.ErrorPolicy.reconnectTimeout, err)
+		}
+
+		s.logger.WithError(err).Warnf("failed to reconnect binlog streamer, retrying in %s", s.ErrorPolicy.retryInterval)
+		time.Sleep(s.ErrorPolicy.retryInterval)
+	}
+}
+
 func (s *BinlogStreamer) AddEventListener(listener func(*ReplicationEvent) error) {
 	s.eventListeners = append(s.eventListeners, listener)
 }
@@ -276,6 +417,12 @@ func (s *BinlogStreamer) IsAlmostCaughtUp() bool {
 	return time.Now().Sub(s.lastProcessedEventTime) < caughtUpThreshold
 }
 
+// IsIdle returns whether the streamer is waiting for new events at the end of
+// the binlogs of the source
+func (s *BinlogStreamer) IsIdle() bool {
+	return atomic.LoadInt32(&s.idle) == 1
+}
+
 func (s *BinlogStreamer) FlushAndStop() {
 	s.logger.Info("requesting binlog streamer to stop")
 	// Must first read the binlog position before requesting stop
@@ -297,6 +444,38 @@ func (s *BinlogStreamer) FlushAndStop() {
 	s.stopRequested = true
 }
 
+// StopPointReachedAt returns when streaming stopped at the StopAtPosition or
+// StopAtTime, or the zero time if it did not
+func (s *BinlogStreamer) StopPointReachedAt() time.Time {
+	return s.stopPointReachedAt
+}
+
+// isStopPoint returns whether the query event starts a transaction (or is a
+// schema change) at or after the StopAtPosition or StopAtTime. Transactions
+// are only ever stopped before, such that none is partially applied.
+func (s *BinlogStreamer) isStopPoint(ev *replication.BinlogEvent, queryEvent *replication.QueryEvent) bool {
+	if s.StopAtPosition == nil && s.StopAtTime.IsZero() {
+		return false
+	}
+
+	query := strings.ToUpper(strings.TrimSpace(string(queryEvent.Query)))
+	if query == "COMMIT" || query == "ROLLBACK" {
+		return false
+	}
+
+	if s.StopAtPosition != nil {
+		start := mysql.Position{
+			Name: s.lastStreamedBinlogPosition.Name,
+			Pos:  ev.Header.LogPos - ev.Header.EventSize,
+		}
+		if start.Compare(*s.StopAtPosition) >= 0 {
+			return true
+		}
+	}
+
+	return !s.StopAtTime.IsZero() && time.Unix(int64(ev.Header.Timestamp), 0).After(s.StopAtTime)
+}
+
 func (s *BinlogStreamer) updateLastStreamedPosAndTime(ev *replication.BinlogEvent) {
 	if ev.Header.LogPos == 0 || ev.Header.Timestamp == 0 {
 		// This shouldn't happen, as the cases where it does happen are excluded.
@@ -314,7 +493,7 @@ func (s *BinlogStreamer) updateLastStreamedPosAndTime(ev *replication.BinlogEven
 
 	if time.Since(s.lastLagMetricEmittedTime) >= time.Second {
 		lag := time.Since(eventTime)
-		metrics.Gauge("BinlogStreamer.Lag", lag.Seconds(), nil, 1.0)
+		s.metrics.Gauge("BinlogStreamer.Lag", lag.Seconds(), nil, 1.0)
 		s.lastLagMetricEmittedTime = time.Now()
 	}
 }
@@ -362,7 +541,7 @@ func (s *BinlogStreamer) emitEvent(ev *replication.BinlogEvent) error {
 	// we may still be searching for the first event to stream to listeners, if
 	// we resumed reading upstream events from an earlier event
 	if pos.Compare(s.suppressEmitUpToBinlogPosition) <= 0 {
-		if IncrediblyVerboseLogging {
+		if s.incrediblyVerboseLogging {
 			s.logger.Debugf("Skip emitting event at binlog position %v: waiting for event %v", pos, s.suppressEmitUpToBinlogPosition);
 		}
 		return nil
@@ -377,6 +556,9 @@ func (s *BinlogStreamer) emitEvent(ev *replication.BinlogEvent) error {
 		BinlogEvent:    ev,
 		EventTime:      time.Unix(int64(ev.Header.Timestamp), 0),
 	}
+	if s.SkipEvent != nil && s.SkipEvent(event) {
+		return nil
+	}
 	for _, listener := range s.eventListeners {
 		err := listener(event)
 		if err != nil {
@@ -386,54 +568,85 @@ func (s *BinlogStreamer) emitEvent(ev *replication.BinlogEvent) error {
 	return nil
 }
 
-func (s *BinlogStreamer) generateNewServerId() (uint32, error) {
-	var id uint32
+// the number of random server_ids tried before giving up, which only fails
+// if nearly all server_ids of the range are taken
+const maxServerIdAttempts = 100
 
-	for {
-		id = randomServerId()
+func (s *BinlogStreamer) generateNewServerId() (uint32, error) {
+	for attempt := 0; attempt < maxServerIdAttempts; attempt++ {
+		id := randomServerId(s.MyServerIdMin, s.MyServerIdMax)
 
-		exists, err := idExistsOnServer(id, s.DB)
+		collision, err := serverIdCollision(id, s.DB)
 		if err != nil {
 			return 0, err
 		}
-		if !exists {
-			break
+		if collision == "" {
+			return id, nil
 		}
 
-		s.logger.WithField("server_id", id).Warn("server_id was taken, retrying")
+		s.logger.WithField("server_id", id).Warnf("server_id was taken by %s, retrying", collision)
 	}
 
-	return id, nil
+	return 0, fmt.Errorf("no unused server_id found between %d and %d after %d attempts", s.MyServerIdMin, s.MyServerIdMax, maxServerIdAttempts)
 }
 
-func idExistsOnServer(id uint32, db *sql.DB) (bool, error) {
+// serverIdCollision returns what uses the server_id on the source: the
+// source itself or one of its replicas. Returns an empty string if the
+// server_id is unused.
+func serverIdCollision(id uint32, db *sql.DB) (string, error) {
+	var sourceId uint32
+	err := db.QueryRow("SELECT @@server_id").Scan(&sourceId)
+	if err != nil {
+		return "", fmt.Errorf("could not get server_id of the source: %s", err)
+	}
+	if sourceId == id {
+		return "the source", nil
+	}
+
 	curIds, err := idsOnServer(db)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
 	for _, idd := range curIds {
 		if idd == id {
-			return true, nil
+			return "a replica of the source", nil
 		}
 	}
 
-	return false, nil
+	return "", nil
 }
 
+// idsOnServer lists the server_ids of the replicas connected to the server.
+// SHOW REPLICAS replaces SHOW SLAVE HOSTS in newer MySQL versions.
 func idsOnServer(db *sql.DB) ([]uint32, error) {
 	rows, err := db.Query("SHOW SLAVE HOSTS")
 	if err != nil {
-		return nil, fmt.Errorf("could not get slave hosts: %s", err)
+		var replicasErr error
+		rows, replicasErr = db.Query("SHOW REPLICAS")
+		if replicasErr != nil {
+			return nil, fmt.Errorf("could not get slave hosts: %s", err)
+		}
 	}
 	defer rows.Close()
 
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("could not get slave hosts: %s", err)
+	}
+
 	server_ids := make([]uint32, 0)
 	for rows.Next() {
+		// the first column is the server_id, the others differ between
+		// MySQL versions and configurations
 		var server_id uint32
-		var host, port, master_id, slave_uuid sqlorig.NullString
+		values := make([]interface{}, len(columns))
+		values[0] = &server_id
+		for i := 1; i < len(values); i++ {
+			values[i] = &sqlorig.RawBytes{}
+		}
 
-		err = rows.Scan(&server_id, &host, &port, &master_id, &slave_uuid)
+		err = rows.Scan(values...)
 		if err != nil {
 			return nil, fmt.Errorf("could not scan SHOW SLAVE HOSTS row, err: %s", err.Error())
 		}
@@ -441,5 +654,5 @@ func idsOnServer(db *sql.DB) ([]uint32, error) {
 		server_ids = append(server_ids, server_id)
 	}
 
-	return server_ids, nil
+	return server_ids, rows.Err()
 }
@@ -1,9 +1,13 @@
 package ghostferry
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go-mysql/replication"
@@ -19,6 +23,8 @@ const (
 	WriterStateInit BinlogWriterState = "Init"
 	WriterStateWaitingForEvents BinlogWriterState = "WaitingForEvents"
 	WriterStateProcessingEvents BinlogWriterState = "ProcessingEvents"
+	WriterStateThrottled BinlogWriterState = "Throttled"
+	WriterStateDelayed BinlogWriterState = "Delayed"
 	WriterStateApplyingEvents BinlogWriterState = "ApplyingEvents"
 	WriterStateAppliedEvents BinlogWriterState = "AppliedEvents"
 )
@@ -31,41 +37,147 @@ type BinlogWriter struct {
 
 	BatchSize          int
 	WriteRetries       int
+	RetryPolicy        *RetryPolicyConfig
 	ApplySchemaChanges bool
 	LockStrategy       string
+	MetricTags         []MetricTag
+
+	// Only track the position of the events but never write them to the
+	// target, see Config.BenchmarkMode
+	DiscardWrites bool
+
+	// If set, the events are also written to the sink
+	Sink Sink
 
 	ErrorHandler                ErrorHandler
 	StateTracker                *StateTracker
 	ForceResumeStateUpdatesToDB bool
 
+	// If set, the applied events are counted by table on the target, see
+	// Config.RecordAppliedBinlogEvents
+	AppliedEvents *AppliedBinlogEvents
+
 	CopyFilter  CopyFilter
 	TableFilter TableFilter
 	TableSchema TableSchemaCache
 
+	// How to handle online schema changes of copied tables on the source, see
+	// Config.OnlineSchemaChangePolicy
+	OnlineSchemaChangePolicy string
+
+	// How to handle updates changing the pagination key of a row of a table
+	// being copied, see Config.PaginationKeyChangePolicy. The source is read
+	// to copy such rows again.
+	PaginationKeyChangePolicy string
+	SourceDB                  *sql.DB
+
+	// How to handle updates and deletes matching no row on the target, see
+	// Config.UnmatchedDMLPolicy
+	UnmatchedDMLPolicy string
+
+	// If set, the rows affected by the events are compared with the expected
+	// ones, see Config.RowsAffectedAccounting
+	RowsAffectedAccounting bool
+
+	// If set, a reloaded table schema is compared with the source, see
+	// Config.SchemaDriftCheckOnReload
+	SchemaDriftCheckOnReload bool
+
+	// If set, used to build the statements of schema changes
+	DDLRewriter *DDLRewriter
+	DDLDenylist DDLDenylistConfig
+
+	// If set, the schema changes applied to the target are recorded, and all
+	// other transactions as well if AuditDML is set
+	AuditLog *AuditLog
+	AuditDML bool
+
+	// If set, the applied source positions are mapped to the binlog
+	// coordinates of the target
+	PositionMap *PositionMap
+
+	// If set, the values of the events are converted before they are
+	// written, see Config.DateTimeConversion
+	DateTimeConverter *DateTimeConverter
+
+	// The events of the quarantined tables are dropped, see TableQuarantine
+	Quarantine *TableQuarantine
+
+	// If set, the rows are only copied once the writer stopped, see
+	// Config.DelayDataIterationUntilBinlogWriterShutdown
+	DataIterationDelayed bool
+
+	// If set, the events of rows matching its rules are dropped, see
+	// Config.BinlogEventFilter
+	EventFilter *BinlogEventFilter
+
+	// If set, the last applied and the pending events are recorded for the
+	// state dumps, see Config.StateDumpBinlogEvents
+	EventHistory *BinlogEventHistory
+
+	// If non-zero, the events are held until they were written on the source
+	// at least this long ago, keeping the target behind on purpose like
+	// MySQL's MASTER_DELAY. While an event is held, the following events are
+	// buffered until the buffer is full, after which streaming blocks.
+	// Shutdown interrupts the wait.
+	ApplyDelay time.Duration
+
+	// If set, returns whether all events of the source were streamed, see
+	// ApplyLag. Without it, the lag is always measured from the last applied
+	// event.
+	StreamingIdle func() bool
+
 	stateRWMutex *sync.RWMutex
-	stateTS      time.Time
-	state        BinlogWriterState
+	// guards the TableSchema while tables are added to it or reloaded, as it
+	// is shared with the Ferry, see RegisterTables
+	tableSchemaMutex     *sync.RWMutex
+	stateTS              time.Time
+	state                BinlogWriterState
+	lastAppliedEventTime time.Time
 
 	queryAnalyzer     *QueryAnalyzer
+	// the positions the tables completed their copy at, if the rows affected
+	// are accounted, see TrackTableCompletions
+	tableCompletions *tableCompletions
+	// migrations applied to the helper tables of online schema changes, by
+	// the table they will replace
+	onlineSchemaChanges map[QualifiedTableName][]string
 	binlogEventBuffer chan *ReplicationEvent
+	// tables to add to the TableSchema between batches, see RegisterTables
+	tableRegistrations chan *tableRegistration
+	// closed by Shutdown
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	// guards the WriteRetries changed while events are written, see
+	// SetWriteRetries
+	writeRetriesMutex sync.RWMutex
 	logger            *logrus.Entry
+	metrics           *Metrics
+	eventsDiscarded   uint64
+
+	incrediblyVerboseLogging bool
 }
 
 func NewBinlogWriter(f *Ferry) *BinlogWriter {
 	return &BinlogWriter{
-		DB:               f.TargetDB,
+		DB:               f.componentDB(f.binlogWriterDB, f.TargetDB),
 		DatabaseRewrites: f.Config.DatabaseRewrites,
 		TableRewrites:    f.Config.TableRewrites,
-		Throttler:        f.ReplicationThrottler,
+		Throttler:        f.guardedThrottler(f.ReplicationThrottler),
 
 		BatchSize:          f.Config.BinlogEventBatchSize,
 		WriteRetries:       f.Config.DBWriteRetries,
+		RetryPolicy:        &f.Config.WriteRetryPolicy,
 		ApplySchemaChanges: f.Config.ReplicateSchemaChanges,
 		LockStrategy:       f.Config.LockStrategy,
+		MetricTags:         metricTagsFromMap(f.Config.BinlogWriterMetricTags),
+		DiscardWrites:      f.Config.BenchmarkMode || f.Config.ClickHouseSink.Exclusive,
+		Sink:               f.Sink,
 
 		ErrorHandler:                f.ErrorHandler,
 		StateTracker:                f.StateTracker,
 		ForceResumeStateUpdatesToDB: f.ForceResumeStateUpdatesToDB,
+		AppliedEvents:               f.appliedBinlogEvents,
 
 		stateRWMutex: &sync.RWMutex{},
 		state:        WriterStateInit,
@@ -74,17 +186,53 @@ func NewBinlogWriter(f *Ferry) *BinlogWriter {
 		CopyFilter:  f.CopyFilter,
 		TableFilter: f.TableFilter,
 		TableSchema: f.Tables,
+
+		tableSchemaMutex: &f.tablesMutex,
+
+		PaginationKeyChangePolicy: f.Config.PaginationKeyChangePolicy,
+		SourceDB:                  f.SourceDB,
+		UnmatchedDMLPolicy:        f.Config.UnmatchedDMLPolicy,
+		RowsAffectedAccounting:    f.Config.RowsAffectedAccounting,
+		SchemaDriftCheckOnReload:  f.Config.SchemaDriftCheckOnReload,
+
+		OnlineSchemaChangePolicy: f.Config.OnlineSchemaChangePolicy,
+		DDLRewriter:              f.newDDLRewriter(),
+		DDLDenylist:              f.Config.DDLDenylist,
+		AuditLog:                 f.auditLog,
+		AuditDML:                 f.Config.AuditLog.IncludeDML,
+		PositionMap:              f.positionMap,
+		DateTimeConverter:        f.dateTimeConverter,
+		Quarantine:               f.quarantine,
+		DataIterationDelayed:     f.Config.DelayDataIterationUntilBinlogWriterShutdown,
+		EventFilter:              f.binlogEventFilter,
+		EventHistory:             f.binlogEventHistory,
+
+		tableRegistrations: make(chan *tableRegistration),
+		shutdown:           make(chan struct{}),
+
+		logger:  f.loggerFor("binlog_writer"),
+		metrics: f.Metrics,
+
+		incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 	}
 }
 
 func (b *BinlogWriter) Run() {
-	b.logger = logrus.WithField("tag", "binlog_writer")
+	if b.logger == nil {
+		b.logger = logrus.WithField("tag", "binlog_writer")
+	}
+	if b.tableSchemaMutex == nil {
+		b.tableSchemaMutex = &sync.RWMutex{}
+	}
 	b.queryAnalyzer = NewQueryAnalyzer()
+	b.queryAnalyzer.logger = b.logger.WithField("tag", "query_analyzer")
+	b.queryAnalyzer.incrediblyVerboseLogging = b.incrediblyVerboseLogging
+	b.onlineSchemaChanges = make(map[QualifiedTableName][]string)
 	b.binlogEventBuffer = make(chan *ReplicationEvent, b.BatchSize)
 
 	batch := make([]DXLEventWrapper, 0, b.BatchSize)
 	for {
-		if IncrediblyVerboseLogging {
+		if b.incrediblyVerboseLogging {
 			b.logger.Debugf("Have %d/%d elements in batch, waiting for elements from binlog queue", len(batch), b.BatchSize)
 		}
 		b.setWriterState(WriterStateWaitingForEvents)
@@ -92,7 +240,13 @@ func (b *BinlogWriter) Run() {
 		var replicationEvent *ReplicationEvent
 		if len(batch) == 0 {
 			// if we don't have anything in the batch yet, do a blocking read
-			replicationEvent = <-b.binlogEventBuffer
+			select {
+			case replicationEvent = <-b.binlogEventBuffer:
+			case registration := <-b.tableRegistrations:
+				b.registerTables(registration.tables)
+				close(registration.done)
+				continue
+			}
 			if replicationEvent == nil {
 				// Channel is closed, no more events to write
 				b.logger.Debugf("Binlog queue closed")
@@ -117,9 +271,26 @@ func (b *BinlogWriter) Run() {
 			}
 		}
 
-		if IncrediblyVerboseLogging {
+		if b.incrediblyVerboseLogging {
 			b.logger.Debugf("Received element from binlog queue: %v", replicationEvent)
 		}
+
+		if wait := b.applyDelayWait(replicationEvent, time.Now()); wait > 0 {
+			// the events received before are older, and were held long enough
+			b.applyBatch(batch)
+			batch = make([]DXLEventWrapper, 0, b.BatchSize)
+
+			b.setWriterState(WriterStateDelayed)
+			if !b.waitForApplyDelay(wait) {
+				// the held event is streamed again when resuming
+				b.logger.Info("shutting down while holding a binlog event for the apply delay")
+				break
+			}
+		}
+
+		if b.EventHistory != nil {
+			b.EventHistory.Received(newBinlogEventRecord(replicationEvent))
+		}
 		b.setWriterState(WriterStateProcessingEvents)
 
 		dxlEvents, err := b.handleReplicationEvent(replicationEvent)
@@ -145,7 +316,25 @@ func (b *BinlogWriter) Run() {
 				batch = make([]DXLEventWrapper, 0, b.BatchSize)
 			}
 
-			if IncrediblyVerboseLogging {
+			if ddlEvent, ok := dxlEvent.DXLEvent.(DDLEvent); ok {
+				// the batch was applied above, as schema changes build
+				// their own transaction
+				if b.truncatesCopiedTable(ddlEvent) {
+					b.applyTruncation(dxlEvent)
+					continue
+				}
+				if b.changesCopiedTable(ddlEvent) {
+					b.applySchemaChange(dxlEvent)
+					continue
+				}
+			} else if renameEvent, ok := dxlEvent.DXLEvent.(*RenameTableEvent); ok {
+				if tables := b.renamedCopiedTables(renameEvent); len(tables) > 0 {
+					b.applyRenameOfCopiedTables(dxlEvent, tables)
+					continue
+				}
+			}
+
+			if b.incrediblyVerboseLogging {
 				b.logger.Debugf("Queuing DXL event %v to batch of %d/%d elements", dxlEvent, len(batch), b.BatchSize)
 			}
 			batch = append(batch, dxlEvent)
@@ -153,16 +342,26 @@ func (b *BinlogWriter) Run() {
 				b.logger.Debugf("Commit of batch %d/%d elements on full batch", len(batch), b.BatchSize)
 				b.applyBatch(batch)
 				batch = make([]DXLEventWrapper, 0, b.BatchSize)
+			} else if dxlEvent.PostApplyCallback != nil {
+				// the callback may change the schema used to handle the
+				// following events
+				b.logger.Debugf("Commit of batch %d/%d elements on post-apply callback", len(batch), b.BatchSize)
+				b.applyBatch(batch)
+				batch = make([]DXLEventWrapper, 0, b.BatchSize)
 			}
 		}
 	}
+
+	if b.PositionMap != nil {
+		b.PositionMap.Flush()
+	}
 }
 
 func (b *BinlogWriter) setWriterState(state BinlogWriterState) {
 	b.stateRWMutex.Lock()
 	defer b.stateRWMutex.Unlock()
 
-	b.state = WriterStateWaitingForEvents
+	b.state = state
 	b.stateTS = time.Now()
 }
 
@@ -173,17 +372,75 @@ func (b *BinlogWriter) GetWriterState() (state BinlogWriterState, stateTS time.T
 	return b.state, b.stateTS
 }
 
+// ApplyLag returns the time between the last applied binlog event being
+// written on the source and now, or 0 if none was applied yet. An empty
+// buffer doesn't mean the writer caught up, as the streamer may still be
+// reading events from the source, so the lag is only 0 once the streaming is
+// idle too, see StreamingIdle.
+func (b *BinlogWriter) ApplyLag(now time.Time) time.Duration {
+	b.stateRWMutex.Lock()
+	defer b.stateRWMutex.Unlock()
+
+	if b.lastAppliedEventTime.IsZero() {
+		return 0
+	}
+
+	if b.state == WriterStateWaitingForEvents && len(b.binlogEventBuffer) == 0 && b.StreamingIdle != nil && b.StreamingIdle() {
+		return 0
+	}
+
+	return now.Sub(b.lastAppliedEventTime)
+}
+
+// applyDelayWait returns how long the event is still to be held at the given
+// time, see ApplyDelay
+func (b *BinlogWriter) applyDelayWait(ev *ReplicationEvent, now time.Time) time.Duration {
+	if b.ApplyDelay <= 0 || ev.EventTime.IsZero() {
+		return 0
+	}
+	return ev.EventTime.Add(b.ApplyDelay).Sub(now)
+}
+
+// waitForApplyDelay holds the writer for the given time, registering the
+// tables meanwhile. It returns false if the writer was shut down before.
+func (b *BinlogWriter) waitForApplyDelay(wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case registration := <-b.tableRegistrations:
+			b.registerTables(registration.tables)
+			close(registration.done)
+		case <-b.shutdown:
+			return false
+		}
+	}
+}
+
 func (b *BinlogWriter) applyBatch(batch []DXLEventWrapper) {
 	if len(batch) == 0 {
 		return
 	}
 
+	// wait for the throttler before entering the applying state, such that
+	// a paused writer is not considered to be busy applying events
+	b.setWriterState(WriterStateThrottled)
+	WaitForThrottle(b.Throttler)
+
 	b.setWriterState(WriterStateApplyingEvents)
 	defer b.setWriterState(WriterStateAppliedEvents)
 
-	err := WithRetries(b.WriteRetries, 0, b.logger, "write events to target", func() error {
+	attempts := 0
+	err := WithRetryPolicy(b.RetryPolicy, b.writeRetries(), b.logger, "write events to target", func() error {
+		attempts++
 		return b.writeEvents(batch)
 	})
+	if attempts > 1 {
+		b.metrics.Count("BinlogWriter.Retries", int64(attempts-1), b.MetricTags, 1.0)
+	}
 	if err != nil {
 		b.ErrorHandler.Fatal("binlog_writer", err)
 	}
@@ -203,8 +460,24 @@ func (b *BinlogWriter) Stop() {
 	close(b.binlogEventBuffer)
 }
 
+// Shutdown makes the writer return without applying the event it holds for
+// the ApplyDelay, unlike Stop which applies all buffered events first. The
+// events buffered afterwards are dropped, as the state does not include them.
+func (b *BinlogWriter) Shutdown() {
+	if b.shutdown == nil {
+		return
+	}
+
+	b.shutdownOnce.Do(func() {
+		close(b.shutdown)
+	})
+}
+
 func (b *BinlogWriter) BufferBinlogEvents(event *ReplicationEvent) error {
-	b.binlogEventBuffer <- event
+	select {
+	case b.binlogEventBuffer <- event:
+	case <-b.shutdown:
+	}
 	return nil
 }
 
@@ -219,18 +492,21 @@ type ReloadTableSchemasCallback struct {
 
 func (c *ReloadTableSchemasCallback) Notify() error {
 	for _, table := range c.TableStructuresToReload {
+		created := c.BinlogWriter.TableSchema.Get(table.SchemaName, table.TableName) == nil
+
 		err := c.BinlogWriter.ReloadTableSchema(table)
 		if err != nil {
 			return err
 		}
 
-		// since we block the binlog writing when an alteration of
-		// schemas occurs, we can assume that all tables have been
-		// copied completely.
-		// This is particularly important if a new table is created,
-		// since we want to make sure we don't start a copy when we
-		// stop and resume the migration (via data_iterator and
-		// batch_writer)
+		// the rows of a created table are all written by the binlog
+		// writer, so it must not be copied when we stop and resume the
+		// migration (via data_iterator and batch_writer). The copy of an
+		// altered table continues with the new schema, see
+		// applySchemaChange.
+		if !created {
+			continue
+		}
 		err = c.BinlogWriter.MarkTableAsCopied(table)
 		if err != nil {
 			return err
@@ -253,6 +529,11 @@ func (b *BinlogWriter) handleRowsEvent(ev *ReplicationEvent, rowsEvent *replicat
 		return events, nil
 	}
 
+	if b.Quarantine.Contains(table.String()) {
+		atomic.AddUint64(&b.eventsDiscarded, 1)
+		return events, nil
+	}
+
 	dmlEvs, err := NewBinlogDMLEvents(table, ev.BinlogEvent, ev.BinlogPosition, ev.EventTime)
 	if err != nil {
 		return events, err
@@ -270,13 +551,44 @@ func (b *BinlogWriter) handleRowsEvent(ev *ReplicationEvent, rowsEvent *replicat
 			}
 		}
 
+		if b.EventFilter != nil {
+			if b.EventFilter.Skip(dmlEv) {
+				atomic.AddUint64(&b.eventsDiscarded, 1)
+				b.metrics.Count("BinlogEventFilter.Skipped", 1, []MetricTag{{Name: "table", Value: table.String()}}, 1.0)
+				continue
+			}
+			b.EventFilter.MatchByPaginationKey(dmlEv)
+		}
+
+		if b.DateTimeConverter != nil {
+			if err := b.DateTimeConverter.ConvertDMLEvent(dmlEv); err != nil {
+				return events, err
+			}
+		}
+
 		events = append(events, DXLEventWrapper{DXLEvent: dmlEv, ReplicationEvent: ev})
+
+		if updateEv, ok := dmlEv.(*BinlogUpdateEvent); ok {
+			recopyEvs, err := b.handlePaginationKeyChange(updateEv)
+			if err != nil {
+				return events, err
+			}
+			for _, recopyEv := range recopyEvs {
+				if b.DateTimeConverter != nil {
+					if err := b.DateTimeConverter.ConvertDMLEvent(recopyEv); err != nil {
+						return events, err
+					}
+				}
+				events = append(events, DXLEventWrapper{DXLEvent: recopyEv, ReplicationEvent: ev})
+			}
+		}
+
 		b.logger.WithFields(logrus.Fields{
 			"database": dmlEv.Database(),
 			"table":    dmlEv.Table(),
 		}).Debugf("received event %T at %v", dmlEv, ev.EventTime)
 
-		metrics.Count("RowEvent", 1, []MetricTag{
+		b.metrics.Count("RowEvent", 1, []MetricTag{
 			MetricTag{"table", dmlEv.Table()},
 			MetricTag{"source", "binlog"},
 		}, 1.0)
@@ -286,9 +598,26 @@ func (b *BinlogWriter) handleRowsEvent(ev *ReplicationEvent, rowsEvent *replicat
 }
 
 func (b *BinlogWriter) handleQueryEvent(ev *ReplicationEvent, queryEvent *replication.QueryEvent) ([]DXLEventWrapper, error) {
+	if statement := ParseTransactionControlStatement(string(queryEvent.Query)); statement != "" {
+		b.handleTransactionControlStatement(ev, statement)
+		return nil, nil
+	}
+
+	// online schema changes are only detected if the schema changes are
+	// applied, otherwise their statements are ignored like any other
+	if b.ApplySchemaChanges && b.OnlineSchemaChangePolicy != "" && b.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyIgnore {
+		onlineSchemaChange, err := b.queryAnalyzer.ParseOnlineSchemaChange(string(queryEvent.Query), string(queryEvent.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("parsing query event failed: %s", err)
+		}
+		if onlineSchemaChange != nil && b.TableSchema.Get(onlineSchemaChange.Table.SchemaName, onlineSchemaChange.Table.TableName) != nil {
+			return b.handleOnlineSchemaChange(ev, onlineSchemaChange)
+		}
+	}
+
 	schemaEvents, err := b.queryAnalyzer.ParseSchemaChanges(string(queryEvent.Query), string(queryEvent.Schema))
 	if err != nil {
-		if IncrediblyVerboseLogging {
+		if b.incrediblyVerboseLogging {
 			b.logger.Warnf("parsing query event failed (%s): %s", err, string(queryEvent.Query))
 		}
 		return nil, fmt.Errorf("parsing query event failed: %s", err)
@@ -296,12 +625,22 @@ func (b *BinlogWriter) handleQueryEvent(ev *ReplicationEvent, queryEvent *replic
 
 	events := make([]DXLEventWrapper, 0)
 	tableStructuresToReload := make([]*QualifiedTableName, 0)
+	renames := make([]TableRename, 0)
+	var renameStatement string
 	for _, schemaEvent := range schemaEvents {
 		if !b.ApplySchemaChanges {
 			b.logger.Warnf("ignoring schema event for %s: disabled", schemaEvent.AffectedTable)
 			return events, nil
 		}
 
+		if schemaEvent.DeletedTable != nil && schemaEvent.CreatedTable != nil {
+			// all tables of a RENAME TABLE statement are renamed by a
+			// single event, see handleRenameTable
+			renames = append(renames, TableRename{From: *schemaEvent.DeletedTable, To: *schemaEvent.CreatedTable})
+			renameStatement = schemaEvent.SchemaStatement
+			continue
+		}
+
 		applicableDatabases, err := b.TableFilter.ApplicableDatabases([]string{schemaEvent.AffectedTable.SchemaName})
 		if err != nil {
 			b.logger.WithError(err).Errorf("could not apply database filter on %s", schemaEvent.AffectedTable)
@@ -312,28 +651,25 @@ func (b *BinlogWriter) handleQueryEvent(ev *ReplicationEvent, queryEvent *replic
 			continue
 		}
 
+		denied, err := b.checkDDLDenylist(ev, schemaEvent.SchemaStatement, schemaEvent.AffectedTable)
+		if err != nil {
+			return events, err
+		}
+		if denied {
+			continue
+		}
+
 		// Does this SQL statement change the schema of the DB?
 		if schemaEvent.IsSchemaChange {
 			// we need to handle all schema changes, except those that *only*
 			// drop a table, as we don't need to re-parse (actually, we can't)
 			//the new schema after the schema change has been applied
-			var tableToReload *QualifiedTableName
+			//
+			// XXX: Should we mark the deleted table as invalid somehow?
 			if schemaEvent.DeletedTable == nil {
 				// a table was created or altered. In either case, the "affected
 				// table" is what we need to reload
-				//
-				// XXX: Should we mark the old table as invalid somehow if this
-				// is actually a rename?
-				tableToReload = schemaEvent.AffectedTable
-			} else {
-				// a table was either deleted or renamed. We do not care about
-				// deletions, as we can't load the new schema anyways
-				//
-				// XXX: Should we mark the deleted table as invalid somehow?
-				tableToReload = schemaEvent.CreatedTable
-			}
-			if tableToReload != nil {
-				tableStructuresToReload = append(tableStructuresToReload, tableToReload)
+				tableStructuresToReload = append(tableStructuresToReload, schemaEvent.AffectedTable)
 			}
 		}
 
@@ -360,17 +696,111 @@ func (b *BinlogWriter) handleQueryEvent(ev *ReplicationEvent, queryEvent *replic
 		}
 		events = append(events, wrapper)
 
-		metrics.Count("SchemaEvent", 1, []MetricTag{
+		b.metrics.Count("SchemaEvent", 1, []MetricTag{
 			MetricTag{"table", ddlEv.Table()},
 			MetricTag{"source", "binlog"},
 		}, 1.0)
 	}
 
+	if len(renames) > 0 {
+		renameEvent, err := b.handleRenameTable(ev, renameStatement, renames)
+		if err != nil {
+			return events, err
+		}
+		if renameEvent != nil {
+			events = append(events, *renameEvent)
+		}
+	}
+
 	return events, nil
 }
 
+// handleOnlineSchemaChange handles the statements of gh-ost and
+// pt-online-schema-change migrating a copied table. Replicating the helper
+// table is pointless, and the cut-over cannot be replicated as the helper
+// table does not exist on the target.
+func (b *BinlogWriter) handleOnlineSchemaChange(ev *ReplicationEvent, change *OnlineSchemaChange) ([]DXLEventWrapper, error) {
+	logger := b.logger.WithFields(logrus.Fields{
+		"tool":  change.Tool,
+		"phase": change.Phase,
+		"table": change.Table.String(),
+	})
+
+	b.metrics.Count("OnlineSchemaChange", 1, []MetricTag{
+		MetricTag{"table", change.Table.String()},
+		MetricTag{"phase", change.Phase},
+	}, 1.0)
+
+	if b.OnlineSchemaChangePolicy == OnlineSchemaChangePolicyAbort {
+		return nil, fmt.Errorf(
+			"%s is migrating %s on the source (%s %s), set OnlineSchemaChangePolicy to pause or follow to tolerate online schema changes",
+			change.Tool,
+			change.Table,
+			change.HelperTable,
+			change.Phase,
+		)
+	}
+
+	switch change.Phase {
+	case OnlineSchemaChangeStarted:
+		logger.Warn("online schema change started on the source")
+		delete(b.onlineSchemaChanges, change.Table)
+		return nil, nil
+	case OnlineSchemaChangeAltered:
+		logger.Infof("online schema change migrates the table: %s", change.AlterClause)
+		b.onlineSchemaChanges[change.Table] = append(b.onlineSchemaChanges[change.Table], change.AlterClause)
+		return nil, nil
+	}
+
+	var alterClauses []string
+	var callback DXLEventCallback
+	if b.OnlineSchemaChangePolicy == OnlineSchemaChangePolicyFollow {
+		alterClauses = b.onlineSchemaChanges[change.Table]
+		if len(alterClauses) == 0 {
+			return nil, fmt.Errorf("%s replaced %s on the source, but its migration was not seen", change.Tool, change.Table)
+		}
+		logger.Warnf("online schema change cut-over, applying the migration to the target")
+		callback = &ReloadTableSchemaCallback{BinlogWriter: b, Table: change.Table}
+	} else {
+		logger.Warn("online schema change cut-over, pausing replication")
+		callback = &PauseForOnlineSchemaChangeCallback{BinlogWriter: b, OnlineSchemaChange: change}
+	}
+	delete(b.onlineSchemaChanges, change.Table)
+
+	return []DXLEventWrapper{
+		DXLEventWrapper{
+			DXLEvent:          NewOnlineSchemaChangeEvent(change.Table, alterClauses, ev.BinlogPosition, ev.EventTime),
+			ReplicationEvent:  ev,
+			PostApplyCallback: callback,
+		},
+	}, nil
+}
+
+// handleTransactionControlStatement handles XA and SAVEPOINT statements. None
+// of them needs to be applied to the target:
+//
+// - the row events of an XA transaction are logged (and applied by us) when
+//   the transaction is prepared, so committing it is a no-op
+// - the row events undone by a ROLLBACK TO SAVEPOINT of a transactional
+//   table are never logged
+//
+// Rolling back a prepared XA transaction cannot be undone on the target, as
+// we do not know the rows it changed before. This is reported, so that the
+// affected data can be verified.
+func (b *BinlogWriter) handleTransactionControlStatement(ev *ReplicationEvent, statement string) {
+	if statement == TransactionControlXARollback {
+		b.logger.WithField("position", ev.BinlogPosition).Warn("prepared XA transaction rolled back on the source, its changes may remain on the target")
+		b.metrics.Count("XARollback", 1, nil, 1.0)
+		return
+	}
+
+	if b.incrediblyVerboseLogging {
+		b.logger.Debugf("ignoring %s statement at %v", statement, ev.BinlogPosition)
+	}
+}
+
 func (b *BinlogWriter) handleReplicationEvent(ev *ReplicationEvent) ([]DXLEventWrapper, error) {
-	if IncrediblyVerboseLogging {
+	if b.incrediblyVerboseLogging {
 		b.logger.Debugf("Handling %T replication event: %v", ev.BinlogEvent.Event, ev)
 	}
 	switch event := ev.BinlogEvent.Event.(type) {
@@ -383,13 +813,76 @@ func (b *BinlogWriter) handleReplicationEvent(ev *ReplicationEvent) ([]DXLEventW
 	}
 }
 
+type tableRegistration struct {
+	tables []*TableSchema
+	done   chan struct{}
+}
+
+// SetWriteRetries changes the WriteRetries while events are written, see
+// Ferry.UpdateTunables
+func (b *BinlogWriter) SetWriteRetries(writeRetries int) {
+	b.writeRetriesMutex.Lock()
+	defer b.writeRetriesMutex.Unlock()
+
+	b.WriteRetries = writeRetries
+}
+
+func (b *BinlogWriter) writeRetries() int {
+	b.writeRetriesMutex.RLock()
+	defer b.writeRetriesMutex.RUnlock()
+
+	return b.WriteRetries
+}
+
+// RegisterTables adds the tables to the TableSchema once the writer applied
+// its current batch, returning once the events of the tables that follow are
+// applied. As the TableSchema is not synchronized, this must be used instead
+// of adding tables to it while the writer runs.
+func (b *BinlogWriter) RegisterTables(ctx context.Context, tables []*TableSchema) error {
+	if b.tableRegistrations == nil {
+		return errors.New("binlog writer was not created with NewBinlogWriter, tables cannot be registered")
+	}
+
+	registration := &tableRegistration{tables: tables, done: make(chan struct{})}
+	select {
+	case b.tableRegistrations <- registration:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	<-registration.done
+	return nil
+}
+
+func (b *BinlogWriter) registerTables(tables []*TableSchema) {
+	b.tableSchemaMutex.Lock()
+	defer b.tableSchemaMutex.Unlock()
+
+	for _, table := range tables {
+		b.logger.WithField("table", table.String()).Info("registering table, applying its binlog events from now on")
+		b.TableSchema[table.String()] = table
+	}
+}
+
 func (b *BinlogWriter) ReloadTableSchema(table *QualifiedTableName) error {
 	b.logger.Infof("Re-loading schema of %s from target DB", table)
-	tableSchema, err := schema.NewTableFromSqlDB(b.DB.DB, table.SchemaName, table.TableName)
+	targetSchemaName := table.SchemaName
+	if rewrite, exists := b.DatabaseRewrites[targetSchemaName]; exists {
+		targetSchemaName = rewrite
+	}
+	targetTableName := table.TableName
+	if rewrite, exists := b.TableRewrites[targetTableName]; exists {
+		targetTableName = rewrite
+	}
+	tableSchema, err := schema.NewTableFromSqlDB(b.DB.DB, targetSchemaName, targetTableName)
 	if err != nil {
 		return err
 	}
+	// the cached schemas are always keyed by the source names
+	tableSchema.Schema = table.SchemaName
+	tableSchema.Name = table.TableName
 
+	b.tableSchemaMutex.Lock()
 	existingTable := b.TableSchema.Get(table.SchemaName, table.TableName)
 	if existingTable == nil {
 		b.logger.Infof("Initializing schema of %s.%s from target DB", table.SchemaName, table.TableName)
@@ -398,11 +891,55 @@ func (b *BinlogWriter) ReloadTableSchema(table *QualifiedTableName) error {
 		}
 	} else {
 		existingTable.Table = tableSchema
+		// the fingerprint query selects the columns of the previous schema
+		existingTable.rowMd5Query = ""
 	}
+	b.tableSchemaMutex.Unlock()
 
+	if b.SchemaDriftCheckOnReload {
+		return b.checkReloadedSchemaDrift(table, targetSchemaName)
+	}
 	return nil
 }
 
+// checkReloadedSchemaDrift compares the reloaded schema of the table on the
+// target with the source, so a schema change that did not fully apply on the
+// target fails the run right away instead of the writes to the table
+func (b *BinlogWriter) checkReloadedSchemaDrift(table *QualifiedTableName, targetSchemaName string) error {
+	targetTableName := table.TableName
+	if rewrite, exists := b.TableRewrites[targetTableName]; exists {
+		targetTableName = rewrite
+	}
+
+	sourceDefinition, err := LoadTableDefinition(b.SourceDB, table.SchemaName, table.TableName)
+	if err != nil {
+		return fmt.Errorf("loading definition of %s from source: %v", table, err)
+	}
+	// the table was dropped or renamed again on the source since, and the
+	// change is yet to be applied
+	if len(sourceDefinition.Columns) == 0 {
+		b.logger.Debugf("Skipping schema drift check of %s, as it no longer exists on the source", table)
+		return nil
+	}
+
+	targetDefinition, err := LoadTableDefinition(b.DB, targetSchemaName, targetTableName)
+	if err != nil {
+		return fmt.Errorf("loading definition of %s.%s from target: %v", targetSchemaName, targetTableName, err)
+	}
+
+	differences := DiffTableDefinitions(sourceDefinition, targetDefinition)
+	if len(differences) == 0 {
+		return nil
+	}
+
+	b.metrics.Count("BinlogWriter.SchemaDrift", 1, []MetricTag{{Name: "table", Value: table.String()}}, 1.0)
+	return SchemaDriftError{Drifts: []SchemaDrift{{
+		SourceTable: table.String(),
+		TargetTable: fmt.Sprintf("%s.%s", targetSchemaName, targetTableName),
+		Differences: differences,
+	}}}
+}
+
 func (b *BinlogWriter) MarkTableAsCopied(table *QualifiedTableName) error {
 	b.logger.Infof("Notifying copy process of %s schema in target DB", table)
 	query, args, err := b.StateTracker.GetStoreRowCopyDoneSql(table.String())
@@ -414,7 +951,7 @@ func (b *BinlogWriter) MarkTableAsCopied(table *QualifiedTableName) error {
 	if query == "" {
 		b.logger.Debug("Skip applying copy-done statement: state writer opt-out")
 	} else {
-		if IncrediblyVerboseLogging {
+		if b.incrediblyVerboseLogging {
 			b.logger.Debugf("Applying copy-done statement: %s (%v)", query, args)
 		}
 		_, err = b.DB.Exec(query, args...)
@@ -428,13 +965,23 @@ func (b *BinlogWriter) MarkTableAsCopied(table *QualifiedTableName) error {
 	return nil
 }
 
-func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
-	WaitForThrottle(b.Throttler)
+// DiscardedEvents returns the number of events dropped instead of being
+// written to the target since the writer was created.
+func (b *BinlogWriter) DiscardedEvents() uint64 {
+	return atomic.LoadUint64(&b.eventsDiscarded)
+}
 
-	queryBuffer := []byte("BEGIN;\n")
+func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
+	queryBuffer := make([]byte, 0)
+	accountRowsAffected := b.accountsRowsAffected()
+	accountedEvents := 0
 	locksToObtain := make(map[string]*sync.RWMutex)
+	auditStatements := make([]string, 0)
+	auditEntryType := AuditEntryTypeDML
+	var historyRecords []BinlogEventRecord
+	var appliedEvents []DXLEventWrapper
 
-	for _, ev := range events {
+	for i, ev := range events {
 		eventDatabaseName := ev.DXLEvent.Database()
 		if targetDatabaseName, exists := b.DatabaseRewrites[eventDatabaseName]; exists {
 			eventDatabaseName = targetDatabaseName
@@ -445,14 +992,50 @@ func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
 			eventTableName = targetTableName
 		}
 
-		sql, err := ev.DXLEvent.AsSQLString(eventDatabaseName, eventTableName)
+		var sql string
+		var err error
+		if ddlEvent, ok := ev.DXLEvent.(DDLEvent); ok && b.DDLRewriter != nil {
+			sql, err = b.DDLRewriter.AsSQLString(ddlEvent, eventDatabaseName, eventTableName)
+		} else {
+			sql, err = ev.DXLEvent.AsSQLString(eventDatabaseName, eventTableName)
+		}
 		if err != nil {
 			return fmt.Errorf("generating sql query at pos %v: %v", ev.DXLEvent.BinlogPosition(), err)
 		}
+		if sql == "" {
+			continue
+		}
 
 		queryBuffer = append(queryBuffer, sql...)
 		queryBuffer = append(queryBuffer, ";\n"...)
 
+		if b.AppliedEvents != nil {
+			appliedEvents = append(appliedEvents, ev)
+		}
+
+		if _, ok := ev.DXLEvent.(DMLEvent); ok && accountRowsAffected {
+			queryBuffer = append(queryBuffer, rowsAffectedRecord(i)...)
+			queryBuffer = append(queryBuffer, ";\n"...)
+			accountedEvents++
+		}
+
+		if b.AuditLog != nil {
+			switch ev.DXLEvent.(type) {
+			case DDLEvent, *OnlineSchemaChangeEvent, *RenameTableEvent:
+				auditEntryType = AuditEntryTypeDDL
+			}
+			auditStatements = append(auditStatements, sql)
+		}
+
+		if b.EventHistory != nil {
+			historyRecords = append(historyRecords, BinlogEventRecord{
+				Position:  ev.ReplicationEvent.BinlogPosition,
+				EventTime: ev.ReplicationEvent.EventTime,
+				Table:     ev.DXLEvent.Database() + "." + ev.DXLEvent.Table(),
+				Statement: sql,
+			})
+		}
+
 		// for DML events, we need to make sure we synchronize with the
 		// data-iterator - for details on why, see the corresponding
 		// data-iterator code
@@ -469,6 +1052,13 @@ func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
 	startEv := events[0].ReplicationEvent
 	endEv := events[len(events)-1].ReplicationEvent
 
+	if b.AppliedEvents != nil {
+		if sql := b.AppliedEvents.RecordSql(appliedEvents); sql != "" {
+			queryBuffer = append(queryBuffer, sql...)
+			queryBuffer = append(queryBuffer, ";\n"...)
+		}
+	}
+
 	var args []interface{}
 	if b.ForceResumeStateUpdatesToDB && b.StateTracker != nil {
 		var sql string
@@ -483,12 +1073,30 @@ func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
 		}
 	}
 
-	queryBuffer = append(queryBuffer, "COMMIT"...)
-	query := string(queryBuffer)
-	if IncrediblyVerboseLogging {
+	query := "BEGIN;\n" + string(queryBuffer) + "COMMIT"
+	if b.incrediblyVerboseLogging {
 		b.logger.Debugf("Applying binlog statements: %s (%v)", query, args)
 	}
 
+	if b.Sink != nil {
+		if err := b.Sink.WriteBinlogEvents(events); err != nil {
+			return fmt.Errorf("writing events at pos %v -> %v to sink: %w", startEv.BinlogPosition, endEv.BinlogPosition, err)
+		}
+	}
+
+	if b.DiscardWrites {
+		atomic.AddUint64(&b.eventsDiscarded, uint64(len(events)))
+		if b.StateTracker != nil {
+			b.StateTracker.UpdateLastWrittenBinlogPosition(endEv.BinlogPosition)
+		}
+		b.EventHistory.Applied(historyRecords, endEv.BinlogPosition)
+
+		b.stateRWMutex.Lock()
+		b.lastAppliedEventTime = endEv.EventTime
+		b.stateRWMutex.Unlock()
+		return nil
+	}
+
 	for _, lock := range locksToObtain {
 		if lock != nil {
 			lock.Lock()
@@ -496,14 +1104,73 @@ func (b *BinlogWriter) writeEvents(events []DXLEventWrapper) error {
 		}
 	}
 
-	_, err := b.DB.Exec(query, args...)
+	defer b.DB.LogIfSlow(time.Now(), "binlog batch write", logrus.Fields{
+		"events":        len(events),
+		"startPosition": startEv.BinlogPosition,
+		"endPosition":   endEv.BinlogPosition,
+	})
+
+	var err error
+	if accountedEvents > 0 {
+		err = b.execAccountingRowsAffected(strings.TrimSuffix(string(queryBuffer), ";\n"), args, events)
+	} else {
+		_, err = b.DB.Exec(query, args...)
+	}
+	if b.AuditLog != nil && len(auditStatements) > 0 && (auditEntryType == AuditEntryTypeDDL || b.AuditDML) {
+		entry := AuditLogEntry{
+			Time:          time.Now(),
+			Type:          auditEntryType,
+			Statement:     strings.Join(auditStatements, ";\n"),
+			StartPosition: startEv.BinlogPosition,
+			EndPosition:   endEv.BinlogPosition,
+			EventTime:     endEv.EventTime,
+			Outcome:       AuditOutcomeApplied,
+		}
+		if err != nil {
+			entry.Outcome = AuditOutcomeFailed
+			entry.Error = err.Error()
+		}
+		b.AuditLog.Record(entry)
+	}
 	if err != nil {
-		return fmt.Errorf("exec query at pos %v -> %v (%d bytes): %v", startEv.BinlogPosition, endEv.BinlogPosition, len(query), err)
+		return fmt.Errorf("exec query at pos %v -> %v (%d bytes): %w", startEv.BinlogPosition, endEv.BinlogPosition, len(query), err)
 	}
 
 	if b.StateTracker != nil {
 		b.StateTracker.UpdateLastWrittenBinlogPosition(endEv.BinlogPosition)
 	}
+	b.EventHistory.Applied(historyRecords, endEv.BinlogPosition)
+
+	b.stateRWMutex.Lock()
+	b.lastAppliedEventTime = endEv.EventTime
+	b.stateRWMutex.Unlock()
+
+	if b.PositionMap != nil {
+		b.PositionMap.Record(endEv.BinlogPosition, endEv.EventTime)
+	}
+
+	b.emitApplyMetrics(events, time.Now())
 
 	return nil
 }
+
+// emitApplyMetrics reports the size of an applied batch and, for every table
+// in it, the end-to-end latency between the oldest event of that table being
+// written on the source and the batch being committed on the target.
+func (b *BinlogWriter) emitApplyMetrics(events []DXLEventWrapper, committedAt time.Time) {
+	b.metrics.Histogram("BinlogWriter.BatchSize", float64(len(events)), b.MetricTags, 1.0)
+
+	oldestEventTimes := make(map[string]time.Time)
+	for _, ev := range events {
+		table := ev.DXLEvent.Table()
+		if oldest, found := oldestEventTimes[table]; !found || ev.ReplicationEvent.EventTime.Before(oldest) {
+			oldestEventTimes[table] = ev.ReplicationEvent.EventTime
+		}
+	}
+
+	for table, eventTime := range oldestEventTimes {
+		tags := append([]MetricTag{{"table", table}}, b.MetricTags...)
+		latency := committedAt.Sub(eventTime)
+		b.metrics.Histogram("BinlogWriter.ApplyLatency", float64(latency/time.Millisecond), tags, 1.0)
+	}
+}
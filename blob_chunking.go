@@ -0,0 +1,321 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// BlobChunker transfers the contents of the columns of the BlobChunking
+// config in chunks, see BlobChunkingConfig.
+//
+// The DataIterator selects empty values for these columns (or NULL, if the
+// value is NULL), and the BatchWriter inserts the rows with them. For the rows
+// inserted by a batch, the values are then read from the source with
+// SUBSTRING and appended to the empty values with CONCAT, in the transaction
+// of the batch. The sinks receive the rows with the whole values, see
+// WithWholeValues.
+type BlobChunker struct {
+	Config   *BlobChunkingConfig
+	SourceDB *sql.DB
+
+	logger *logrus.Entry
+}
+
+func NewBlobChunker(config *BlobChunkingConfig, sourceDB *sql.DB, tables TableSchemaCache, logger *logrus.Entry) (*BlobChunker, error) {
+	for schemaName, tableConfig := range config.Columns {
+		for tableName, columns := range tableConfig {
+			table := tables.Get(schemaName, tableName)
+			if table == nil {
+				// the table may have been filtered
+				continue
+			}
+
+			if table.PaginationKey == nil {
+				return nil, fmt.Errorf("table %s has no pagination key, its columns cannot be transferred in chunks", table)
+			}
+
+			for _, name := range columns {
+				index := table.FindColumn(name)
+				if index < 0 {
+					return nil, fmt.Errorf("column %s of table %s does not exist", name, table)
+				}
+
+				column := table.Columns[index]
+				rawType := strings.ToLower(column.RawType)
+				if !strings.HasSuffix(rawType, "blob") && !strings.HasSuffix(rawType, "text") {
+					return nil, fmt.Errorf("column %s of table %s is not a BLOB or TEXT column", name, table)
+				}
+
+				for _, paginationKeyColumn := range table.PaginationKey.Columns {
+					if paginationKeyColumn.Name == column.Name {
+						return nil, fmt.Errorf("column %s of table %s is part of the pagination key", name, table)
+					}
+				}
+			}
+		}
+	}
+
+	if logger == nil {
+		logger = logrus.WithField("tag", "blob_chunker")
+	}
+
+	return &BlobChunker{
+		Config:   config,
+		SourceDB: sourceDB,
+		logger:   logger,
+	}, nil
+}
+
+// ColumnsToSelect returns the columns to select when copying the rows of the
+// table, with empty values for the chunked columns, or nil if the table has
+// no chunked columns
+func (c *BlobChunker) ColumnsToSelect(table *TableSchema) []string {
+	chunkedColumns := c.chunkedColumnIndices(table)
+	if len(chunkedColumns) == 0 {
+		return nil
+	}
+
+	columns := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		name := quoteField(column.Name)
+		if chunkedColumns[i] {
+			columns[i] = "IF(" + name + " IS NULL, NULL, '') AS " + name
+		} else {
+			columns[i] = name
+		}
+	}
+
+	return columns
+}
+
+// RowsToTransfer locks the rows of the batch on the target, and returns the
+// rows missing from the target, which the batch inserts. The chunked columns
+// of these rows must be transferred once they are inserted.
+//
+// The rows already on the target were written by the BinlogWriter with the
+// whole values, and are left alone, as they are by the batch. Locking the
+// missing rows prevents the BinlogWriter from inserting them until the batch
+// is committed.
+func (c *BlobChunker) RowsToTransfer(tx *sql.Tx, batch InsertRowBatch, schemaName, tableName string) ([]RowData, error) {
+	table := batch.TableSchema()
+	if len(c.chunkedColumnIndices(table)) == 0 || batch.Size() == 0 {
+		return nil, nil
+	}
+
+	paginationKey := table.PaginationKey
+	quotedColumns := make([]string, len(paginationKey.Columns))
+	for i, column := range paginationKey.Columns {
+		quotedColumns[i] = quoteField(column.Name)
+	}
+
+	values := "(" + strings.Repeat("?,", len(quotedColumns)-1) + "?)"
+	args := make([]interface{}, 0, len(quotedColumns)*batch.Size())
+	for _, row := range batch.Values() {
+		for _, index := range paginationKey.ColumnIndices {
+			args = append(args, row[index])
+		}
+	}
+
+	query := "SELECT " + strings.Join(quotedColumns, ",") +
+		" FROM " + QuotedTableNameFromString(schemaName, tableName) +
+		" WHERE (" + strings.Join(quotedColumns, ",") + ") IN (" +
+		strings.Repeat(values+",", batch.Size()-1) + values + ") FOR UPDATE"
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("locking rows of %s for chunked transfer: %v", table, err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		values, err := ScanGenericRow(rows, len(quotedColumns))
+		if err != nil {
+			return nil, err
+		}
+		existing[blobChunkRowKey(values)] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []RowData
+	for _, row := range batch.Values() {
+		values := make([]interface{}, len(paginationKey.ColumnIndices))
+		for i, index := range paginationKey.ColumnIndices {
+			values[i] = row[index]
+		}
+
+		if !existing[blobChunkRowKey(values)] {
+			missing = append(missing, row)
+		}
+	}
+
+	return missing, nil
+}
+
+// Transfer appends the values of the chunked columns of the rows, read in
+// chunks from the source, to their empty values on the target
+func (c *BlobChunker) Transfer(tx *sql.Tx, table *TableSchema, rows []RowData, schemaName, tableName string) error {
+	chunkedColumns := c.chunkedColumnIndices(table)
+
+	sourceTable := QuotedTableName(table)
+	targetTable := QuotedTableNameFromString(schemaName, tableName)
+
+	var where []string
+	for _, column := range table.PaginationKey.Columns {
+		where = append(where, quoteField(column.Name)+" = ?")
+	}
+	whereSql := strings.Join(where, " AND ")
+
+	var chunkCount int
+	for _, row := range rows {
+		keyArgs := make([]interface{}, len(table.PaginationKey.ColumnIndices))
+		for i, index := range table.PaginationKey.ColumnIndices {
+			keyArgs[i] = row[index]
+		}
+
+		for index := range chunkedColumns {
+			// the value is NULL on the source
+			if row[index] == nil {
+				continue
+			}
+
+			column := quoteField(table.Columns[index].Name)
+
+			var length uint64
+			err := c.querySource("SELECT CHAR_LENGTH("+column+") FROM "+sourceTable+" WHERE "+whereSql, keyArgs, &length)
+			if err != nil {
+				return fmt.Errorf("reading length of %s of %s: %v", column, table, err)
+			}
+
+			for offset := uint64(1); offset <= length; offset += c.Config.ChunkSize {
+				var chunk []byte
+				args := append([]interface{}{offset, c.Config.ChunkSize}, keyArgs...)
+				err = c.querySource("SELECT SUBSTRING("+column+", ?, ?) FROM "+sourceTable+" WHERE "+whereSql, args, &chunk)
+				if err != nil {
+					return fmt.Errorf("reading chunk of %s of %s at %d: %v", column, table, offset, err)
+				}
+
+				args = append([]interface{}{chunk}, keyArgs...)
+				_, err = tx.Exec("UPDATE "+targetTable+" SET "+column+" = CONCAT("+column+", ?) WHERE "+whereSql, args...)
+				if err != nil {
+					return fmt.Errorf("writing chunk of %s of %s at %d: %v", column, table, offset, err)
+				}
+				chunkCount++
+			}
+		}
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"table":  table.String(),
+		"rows":   len(rows),
+		"chunks": chunkCount,
+	}).Debug("transferred chunked columns")
+	return nil
+}
+
+// WithWholeValues returns a copy of the batch with the whole values of the
+// chunked columns read from the source, for the sinks, which receive the rows
+// as they are. The batch itself keeps the empty values to insert on the
+// target.
+func (c *BlobChunker) WithWholeValues(batch RowBatch) (RowBatch, error) {
+	dataBatch, ok := batch.(*DataRowBatch)
+	if !ok || dataBatch.Size() == 0 {
+		return batch, nil
+	}
+
+	table := batch.TableSchema()
+	chunkedColumns := c.chunkedColumnIndices(table)
+	if len(chunkedColumns) == 0 {
+		return batch, nil
+	}
+
+	sourceTable := QuotedTableName(table)
+
+	var where []string
+	for _, column := range table.PaginationKey.Columns {
+		where = append(where, quoteField(column.Name)+" = ?")
+	}
+	whereSql := strings.Join(where, " AND ")
+
+	rows := make([]RowData, dataBatch.Size())
+	for i, row := range dataBatch.Values() {
+		rows[i] = append(RowData{}, row...)
+
+		var indices []int
+		var columns []string
+		for index := range chunkedColumns {
+			// the value is NULL on the source
+			if row[index] == nil {
+				continue
+			}
+			indices = append(indices, index)
+			columns = append(columns, quoteField(table.Columns[index].Name))
+		}
+		if len(indices) == 0 {
+			continue
+		}
+
+		keyArgs := make([]interface{}, len(table.PaginationKey.ColumnIndices))
+		for j, index := range table.PaginationKey.ColumnIndices {
+			keyArgs[j] = row[index]
+		}
+
+		values := make([][]byte, len(indices))
+		dest := make([]interface{}, len(indices))
+		for j := range values {
+			dest[j] = &values[j]
+		}
+
+		ctx, cancel := c.SourceDB.QueryTimeoutContext(context.Background())
+		err := c.SourceDB.QueryRowContext(ctx, "SELECT "+strings.Join(columns, ",")+" FROM "+sourceTable+" WHERE "+whereSql, keyArgs...).Scan(dest...)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("reading chunked columns of %s: %v", table, err)
+		}
+
+		for j, index := range indices {
+			rows[i][index] = values[j]
+		}
+	}
+
+	return dataBatch.withValues(rows), nil
+}
+
+func (c *BlobChunker) querySource(query string, args []interface{}, dest interface{}) error {
+	ctx, cancel := c.SourceDB.QueryTimeoutContext(context.Background())
+	defer cancel()
+
+	return c.SourceDB.QueryRowContext(ctx, query, args...).Scan(dest)
+}
+
+func (c *BlobChunker) chunkedColumnIndices(table *TableSchema) map[int]bool {
+	columns := c.Config.ColumnsFor(table.Schema, table.Name)
+	if len(columns) == 0 {
+		return nil
+	}
+
+	indices := make(map[int]bool)
+	for _, name := range columns {
+		if index := table.FindColumn(name); index >= 0 {
+			indices[index] = true
+		}
+	}
+	return indices
+}
+
+func blobChunkRowKey(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		if bytes, ok := value.([]byte); ok {
+			value = string(bytes)
+		}
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,184 @@
+package ghostferry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClickHouseSink writes the copied rows and the binlog DML events into
+// ClickHouse tables using the ReplacingMergeTree engine, through the HTTP
+// interface of ClickHouse.
+//
+// Each table must have the columns of the source table, plus a UInt64
+// version column and a UInt8 deleted column, e.g.:
+//
+//	ENGINE = ReplacingMergeTree(_version, _is_deleted) ORDER BY (id)
+//
+// Every written row gets a new, increasing version, such that the last write
+// of a row wins when ClickHouse merges the parts of the table. Deletes are
+// written as the deleted row with the deleted column set. Schema changes are
+// not replicated and must be applied to ClickHouse separately.
+type ClickHouseSink struct {
+	Config *ClickHouseSinkConfig
+
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	client   *http.Client
+	versions SinkVersions
+
+	logger *logrus.Entry
+}
+
+func NewClickHouseSink(config *ClickHouseSinkConfig, databaseRewrites, tableRewrites map[string]string, logger *logrus.Entry) *ClickHouseSink {
+	return &ClickHouseSink{
+		Config:           config,
+		DatabaseRewrites: databaseRewrites,
+		TableRewrites:    tableRewrites,
+		client:           &http.Client{Timeout: config.timeout},
+		logger:           logger,
+	}
+}
+
+func (s *ClickHouseSink) WriteRowBatch(batch RowBatch) error {
+	table := batch.TableSchema()
+
+	switch b := batch.(type) {
+	case InsertRowBatch:
+		if b.Size() == 0 {
+			return nil
+		}
+
+		rows := make([]map[string]interface{}, 0, b.Size())
+		for _, values := range b.Values() {
+			rows = append(rows, s.row(table, values, false))
+		}
+		return s.insert(table, rows)
+	case *TruncateTableBatch:
+		return s.exec(fmt.Sprintf("TRUNCATE TABLE %s", s.quotedTableName(table)), nil)
+	}
+
+	return nil
+}
+
+func (s *ClickHouseSink) WriteBinlogEvents(events []DXLEventWrapper) error {
+	var table *TableSchema
+	var rows []map[string]interface{}
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		err := s.insert(table, rows)
+		rows = nil
+		return err
+	}
+
+	for _, ev := range events {
+		dmlEvent, ok := ev.DXLEvent.(DMLEvent)
+		if !ok {
+			s.logger.WithField("table", ev.DXLEvent.Table()).Warnf("not replicating schema change to ClickHouse at %v", ev.DXLEvent.BinlogPosition())
+			continue
+		}
+
+		// inserts are batched per table, in the order of the events
+		if table != nil && table != dmlEvent.TableSchema() {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		table = dmlEvent.TableSchema()
+
+		oldValues, newValues := dmlEvent.OldValues(), dmlEvent.NewValues()
+		if oldValues != nil && (newValues == nil || PrimaryKeyChanged(table, oldValues, newValues)) {
+			rows = append(rows, s.row(table, oldValues, true))
+		}
+		if newValues != nil {
+			rows = append(rows, s.row(table, newValues, false))
+		}
+	}
+
+	return flush()
+}
+
+func (s *ClickHouseSink) Close() error {
+	return nil
+}
+
+func (s *ClickHouseSink) row(table *TableSchema, values RowData, deleted bool) map[string]interface{} {
+	row := make(map[string]interface{}, len(table.Columns)+2)
+	for i, column := range table.Columns {
+		if i < len(values) {
+			row[column.Name] = SinkValue(values[i])
+		}
+	}
+
+	row[s.Config.VersionColumn] = s.versions.Next()
+	if deleted {
+		row[s.Config.DeletedColumn] = 1
+	} else {
+		row[s.Config.DeletedColumn] = 0
+	}
+
+	return row
+}
+
+func (s *ClickHouseSink) insert(table *TableSchema, rows []map[string]interface{}) error {
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("encoding row of %s: %v", table.String(), err)
+		}
+	}
+
+	return s.exec(fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.quotedTableName(table)), body)
+}
+
+func (s *ClickHouseSink) exec(query string, body *bytes.Buffer) error {
+	if body == nil {
+		body = &bytes.Buffer{}
+	}
+
+	req, err := http.NewRequest("POST", s.Config.Address+"/?query="+url.QueryEscape(query), body)
+	if err != nil {
+		return err
+	}
+	if s.Config.User != "" {
+		req.Header.Set("X-ClickHouse-User", s.Config.User)
+		req.Header.Set("X-ClickHouse-Key", s.Config.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ClickHouse query %q failed: %v", query, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("ClickHouse query %q failed with status %d: %s", query, res.StatusCode, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
+
+func (s *ClickHouseSink) quotedTableName(table *TableSchema) string {
+	db := table.Schema
+	if rewrite, exists := s.DatabaseRewrites[db]; exists {
+		db = rewrite
+	}
+
+	name := table.Name
+	if rewrite, exists := s.TableRewrites[name]; exists {
+		name = rewrite
+	}
+
+	return QuotedTableNameFromString(db, name)
+}
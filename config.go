@@ -7,10 +7,17 @@ import (
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"io/ioutil"
+	"math"
+	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
+	siddontangmysql "github.com/siddontang/go-mysql/mysql"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,6 +25,7 @@ const (
 	VerifierTypeChecksumTable  = "ChecksumTable"
 	VerifierTypeIterative      = "Iterative"
 	VerifierTypeInline         = "Inline"
+	VerifierTypeSampling       = "Sampling"
 	VerifierTypeNoVerification = "NoVerification"
 
 	LockStrategySourceDB     = "LockOnSourceDB"
@@ -25,165 +33,2727 @@ const (
 	LockStrategyNone         = "None"
 )
 
+const (
+	IsolationLevelReadCommitted  = "READ COMMITTED"
+	IsolationLevelRepeatableRead = "REPEATABLE READ"
+
+	RowLockExclusive = "exclusive"
+	RowLockShared    = "shared"
+)
+
+// The default sql_mode of the sessions on the target, such that the rows valid
+// on the source can be written whatever the sql_mode of the target server:
+// zero values of AUTO_INCREMENT columns are kept, and zero dates are
+// accepted. Values that do not fit fail the copy instead of being truncated.
+const DefaultTargetSQLMode = "STRICT_ALL_TABLES,NO_AUTO_VALUE_ON_ZERO"
+
 type TLSConfig struct {
-	CertPath   string
+	// The CA bundle to verify the certificate of the server with
+	//
+	// Optional: defaults to the system root certificates
+	CertPath string
+
+	// The name to verify the certificate of the server against
+	//
+	// Optional: defaults to the Host of the database
 	ServerName string
 
+	// The certificate and private key to authenticate with, for users
+	// created with REQUIRE X509 or REQUIRE SUBJECT. Both must be set, in PEM
+	// format.
+	//
+	// Optional: defaults to no client certificate
+	ClientCertPath string
+	ClientKeyPath  string
+
+	// The minimum TLS version to negotiate. Valid choices are:
+	// 1.0
+	// 1.1
+	// 1.2
+	// 1.3
+	//
+	// Optional: defaults to the default of crypto/tls
+	MinVersion string
+
 	tlsConfig *tls.Config
 }
 
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (this *TLSConfig) Validate() error {
+	if (this.ClientCertPath == "") != (this.ClientKeyPath == "") {
+		return fmt.Errorf("ClientCertPath and ClientKeyPath must be specified together")
+	}
+
+	if _, ok := tlsVersions[this.MinVersion]; this.MinVersion != "" && !ok {
+		return fmt.Errorf("invalid MinVersion specified (set to %s)", this.MinVersion)
+	}
+
+	return nil
+}
+
 func (this *TLSConfig) BuildConfig() (*tls.Config, error) {
 	if this.tlsConfig == nil {
-		certPool := x509.NewCertPool()
-		pem, err := ioutil.ReadFile(this.CertPath)
+		tlsConfig := &tls.Config{
+			ServerName: this.ServerName,
+			MinVersion: tlsVersions[this.MinVersion],
+		}
+
+		if this.CertPath != "" {
+			certPool := x509.NewCertPool()
+			pem, err := ioutil.ReadFile(this.CertPath)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok := certPool.AppendCertsFromPEM(pem); !ok {
+				return nil, errors.New("unable to append pem")
+			}
+			tlsConfig.RootCAs = certPool
+		}
+
+		if this.ClientCertPath != "" {
+			certificate, err := tls.LoadX509KeyPair(this.ClientCertPath, this.ClientKeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+
+		this.tlsConfig = tlsConfig
+	}
+
+	return this.tlsConfig, nil
+}
+
+// ClientCertificate returns the parsed client certificate, or nil if none is
+// configured
+func (this *TLSConfig) ClientCertificate() (*x509.Certificate, error) {
+	tlsConfig, err := this.BuildConfig()
+	if err != nil || len(tlsConfig.Certificates) == 0 {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+}
+
+type DatabaseConfig struct {
+	Host       string
+	Port       uint16
+
+	// The path of the Unix socket to connect to instead of Host and Port,
+	// for databases on the same host as Ghostferry. The binlogs are streamed
+	// through a private socket relaying to it, as the replication client only
+	// connects to a host and port.
+	//
+	// Optional: defaults to connecting over TCP
+	Socket string
+
+	User       string
+	Pass       string
+	Collation  string
+	Params     map[string]string
+	// SQL query comments to differentiate Ghostferry's binlog events
+	// Optional: defaults to empty string (no comments)
+	Marginalia string
+
+	// The maximum time a single statement executed by Ghostferry (such as a
+	// row-copy SELECT or a write to the target) may take before it is
+	// cancelled and treated as failed, in the format of time.ParseDuration.
+	// Note that this also applies to schema changes replicated to the target,
+	// if ReplicateSchemaChanges is enabled.
+	//
+	// Optional: defaults to no timeout
+	QueryTimeout string
+
+	// Log any statement executed by Ghostferry that takes longer than this,
+	// in the format of time.ParseDuration, along with the table and position
+	// it operated on.
+	//
+	// Optional: defaults to no slow-query logging
+	SlowQueryThreshold string
+
+	TLS *TLSConfig
+
+	// The platform hosting the database, see PlatformRDS for how this
+	// changes the connection and the preflight checks. Valid choices are:
+	// mysql
+	// rds
+	// aurora
+	//
+	// Optional: defaults to "mysql"
+	Platform string
+
+	// Authenticate with IAM authentication tokens for the User instead of
+	// Pass, generated for the database in this AWS region. The AWS
+	// credentials are looked up by the default credential chain of the AWS
+	// SDK: the environment, the shared credentials and config files
+	// (AWS_PROFILE), web identity tokens, and the role of the ECS task or
+	// the EC2 instance. Only supported for rds and aurora.
+	//
+	// NOTE: The binlog replication client only supports password
+	// authentication, so the binlogs of the Source (and of the Target with
+	// the ForeignWriteGuard) are streamed by a password user given as
+	// ComponentCredentials.BinlogStreamer.
+	//
+	// Optional: defaults to password authentication
+	IAMAuthRegion string
+
+	// Use the compressed client protocol, trading CPU for bandwidth when
+	// the database is reached over a slow or long-haul network.
+	//
+	// NOTE: The binlog replication client does not support compression, so
+	// this only applies to the connections used for copying and verifying.
+	//
+	// Optional: defaults to false
+	Compress bool
+
+	// Connection attributes sent when connecting, such that the connections
+	// of Ghostferry can be identified in performance_schema (e.g. by a
+	// "run_id"). Keys and values must not contain commas or colons.
+	//
+	// Optional: defaults to a "program_name" of "ghostferry"
+	ConnectionAttributes map[string]string
+
+	// The time_zone of all sessions, as an offset such as "+02:00" or as a
+	// named time zone (which requires the time zone tables of the server to
+	// be loaded). TIMESTAMP values are read and written in this time zone, so
+	// the Source and the Target must use the same one for the values to be
+	// copied unchanged. See DateTimeConversion to convert DATETIME values.
+	//
+	// Optional: defaults to "+00:00"
+	TimeZone string
+
+	// The sql_mode of all sessions, as a comma-separated list of modes.
+	// NO_BACKSLASH_ESCAPES is always added, as the statements built by
+	// Ghostferry rely on it.
+	//
+	// Optional: defaults to "STRICT_ALL_TABLES" for the Source, and to
+	// DefaultTargetSQLMode for the Target
+	SQLMode string
+
+	// Connect to the database through an SSH tunnel over a bastion host, for
+	// databases not reachable directly. Host and Port are then resolved by
+	// the bastion host. Cannot be combined with IAMAuthRegion.
+	//
+	// Optional: defaults to connecting directly
+	SSHTunnel *SSHTunnelConfig
+
+	// the SSHTunnel or SocketRelay opened by DialAddress, shared with the
+	// copies of the config, see withCredentials
+	tunnels *databaseTunnels
+
+	// called with the ID of every session opened to the database, see
+	// BidirectionalFerry
+	recordSession func(id uint32)
+
+	// The settings of the connection pool to the database, shared by all
+	// components without a pool of their own in ComponentConnectionPools.
+	//
+	// Optional: defaults to the database/sql defaults
+	ConnectionPool ConnectionPoolConfig
+
+	// Dedicated connection pools of components, such that a component
+	// exhausting its pool cannot starve the others of connections.
+	//
+	// Optional: defaults to all components sharing ConnectionPool
+	ComponentConnectionPools ComponentConnectionPoolsConfig
+
+	// Distinct users of the components writing to the database, such that
+	// each can be granted only the privileges it needs and its activity be
+	// audited on its own. A component with a user of its own connects with a
+	// dedicated pool. Only the BinlogStreamer is supported for the Source.
+	//
+	// Optional: defaults to all components connecting as User
+	ComponentCredentials ComponentCredentialsConfig
+}
+
+type CredentialsConfig struct {
+	User string
+	Pass string
+}
+
+func (c *CredentialsConfig) Validate(iamAuth bool) error {
+	if c.User == "" {
+		return fmt.Errorf("user is empty")
+	}
+	// the users authenticate with IAM authentication tokens as well
+	if iamAuth && c.Pass != "" {
+		return fmt.Errorf("IAMAuthRegion and Pass cannot both be specified")
+	}
+	return nil
+}
+
+// The users of the components writing to the target, and of the binlog
+// streaming.
+type ComponentCredentialsConfig struct {
+	// The writes of the row copy, including the positions of the row copy
+	// in the state tables.
+	BatchWriter *CredentialsConfig
+
+	// The writes of the binlog events, including the DDL statements
+	// replicated by DDLRewrites, and the binlog positions in the state
+	// tables.
+	BinlogWriter *CredentialsConfig
+
+	// The creation, the reads and the writes of the state tables when
+	// resuming from the target, see Config.ResumeStateFromDB.
+	StateTracker *CredentialsConfig
+
+	// The replication connection streaming the binlogs, which requires the
+	// REPLICATION SLAVE and REPLICATION CLIENT privileges. It always
+	// authenticates with Pass, as the binlog replication client does not
+	// support IAM authentication tokens, and is required with
+	// IAMAuthRegion.
+	BinlogStreamer *CredentialsConfig
+}
+
+func (c *ComponentCredentialsConfig) Validate(iamAuth bool) error {
+	credentials := map[string]*CredentialsConfig{
+		"BatchWriter":  c.BatchWriter,
+		"BinlogWriter": c.BinlogWriter,
+		"StateTracker": c.StateTracker,
+	}
+
+	for component, credential := range credentials {
+		if credential == nil {
+			continue
+		}
+
+		if err := credential.Validate(iamAuth); err != nil {
+			return fmt.Errorf("%s: %v", component, err)
+		}
+	}
+
+	if c.BinlogStreamer != nil {
+		if err := c.BinlogStreamer.Validate(false); err != nil {
+			return fmt.Errorf("BinlogStreamer: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writersConfigured returns whether any of the writing components has a
+// user of its own
+func (c *ComponentCredentialsConfig) writersConfigured() bool {
+	return c.BatchWriter != nil || c.BinlogWriter != nil || c.StateTracker != nil
+}
+
+type ConnectionPoolConfig struct {
+	// The maximum number of open connections.
+	//
+	// Optional: defaults to no limit
+	MaxOpenConns int
+
+	// The maximum number of idle connections kept open.
+	//
+	// Optional: defaults to 2
+	MaxIdleConns int
+
+	// The maximum time a connection is reused for, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to reusing connections forever
+	ConnMaxLifetime string
+
+	// Session variables set on each connection of the pool, by name, as SQL
+	// expressions such as "0" or "'READ-COMMITTED'". For instance, setting
+	// sql_log_bin to 0 for the BatchWriter keeps the rows copied out of the
+	// binlogs of the target, and unique_checks or foreign_key_checks relax
+	// the checks of the target during the bulk load. The variables of a
+	// pool in ComponentConnectionPools are set in addition to the ones of
+	// ConnectionPool. The time_zone and the sql_mode are set by TimeZone and
+	// SQLMode.
+	//
+	// Optional: defaults to no session variables
+	SessionVariables map[string]string
+}
+
+// matches the names of system variables, which the driver sets by name
+var sessionVariableNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// session variables set otherwise, or clashing with the parameters of the
+// driver
+var reservedSessionVariables = map[string]bool{
+	"time_zone": true,
+	"sql_mode":  true,
+	"charset":   true,
+	"collation": true,
+	"compress":  true,
+	"loc":       true,
+	"strict":    true,
+	"timeout":   true,
+	"tls":       true,
+}
+
+func (c *ConnectionPoolConfig) Validate() error {
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return fmt.Errorf("MaxOpenConns and MaxIdleConns must not be negative")
+	}
+
+	if c.ConnMaxLifetime != "" {
+		if _, err := time.ParseDuration(c.ConnMaxLifetime); err != nil {
+			return fmt.Errorf("invalid ConnMaxLifetime: %v", err)
+		}
+	}
+
+	for name, value := range c.SessionVariables {
+		if !sessionVariableNameRegexp.MatchString(name) || reservedSessionVariables[name] {
+			return fmt.Errorf("invalid SessionVariables: %s cannot be set", name)
+		}
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("invalid SessionVariables: no value for %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Apply configures the pool of the database with the settings
+func (c *ConnectionPoolConfig) Apply(db *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+
+	if c.ConnMaxLifetime != "" {
+		// validated by Validate
+		lifetime, _ := time.ParseDuration(c.ConnMaxLifetime)
+		db.SetConnMaxLifetime(lifetime)
+	}
+}
+
+// The dedicated connection pools of the components, which only apply to the
+// databases the components connect to.
+type ComponentConnectionPoolsConfig struct {
+	// The reads of the row copy from the source. The chunked columns are
+	// read with a pool of their own with the same settings, as the reads of
+	// the rows they belong to hold their connections meanwhile, see
+	// BlobChunkingConfig.
+	DataIterator *ConnectionPoolConfig
+
+	// The writes of the row copy to the target.
+	BatchWriter *ConnectionPoolConfig
+
+	// The writes of the binlog events to the target.
+	BinlogWriter *ConnectionPoolConfig
+
+	// The reads of the verifiers from the source and the target.
+	Verifier *ConnectionPoolConfig
+}
+
+func (c *ComponentConnectionPoolsConfig) Validate() error {
+	pools := map[string]*ConnectionPoolConfig{
+		"DataIterator": c.DataIterator,
+		"BatchWriter":  c.BatchWriter,
+		"BinlogWriter": c.BinlogWriter,
+		"Verifier":     c.Verifier,
+	}
+
+	for component, pool := range pools {
+		if pool == nil {
+			continue
+		}
+
+		if err := pool.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", component, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateDataIterationIsolationLevel() error {
+	if c.DataIterationIsolationLevel == "" {
+		return nil
+	}
+	if c.DataIterationIsolationLevel != IsolationLevelReadCommitted && c.DataIterationIsolationLevel != IsolationLevelRepeatableRead {
+		return fmt.Errorf("Invalid DataIterationIsolationLevel specified (set to %s)", c.DataIterationIsolationLevel)
+	}
+
+	if pool := c.Source.ComponentConnectionPools.DataIterator; pool != nil {
+		if current, found := pool.SessionVariables["transaction_isolation"]; found && current != c.dataIterationTransactionIsolation() {
+			return fmt.Errorf("DataIterationIsolationLevel cannot be combined with SessionVariables setting transaction_isolation")
+		}
+	}
+	return nil
+}
+
+// the value of the transaction_isolation session variable for the
+// DataIterationIsolationLevel
+func (c *Config) dataIterationTransactionIsolation() string {
+	return quoteString(strings.Replace(c.DataIterationIsolationLevel, " ", "-", 1))
+}
+
+// DataIteratorConnectionPool returns the settings of the dedicated pool of
+// the data iterator, which it gets with a DataIterationIsolationLevel even
+// without Source.ComponentConnectionPools.DataIterator, or nil if it reads
+// with the shared pool
+func (c *Config) DataIteratorConnectionPool() *ConnectionPoolConfig {
+	pool := c.Source.ComponentConnectionPools.DataIterator
+	if c.DataIterationIsolationLevel == "" {
+		return pool
+	}
+
+	withIsolationLevel := &ConnectionPoolConfig{}
+	if pool != nil {
+		*withIsolationLevel = *pool
+	}
+
+	sessionVariables := make(map[string]string, len(withIsolationLevel.SessionVariables)+1)
+	for name, value := range withIsolationLevel.SessionVariables {
+		sessionVariables[name] = value
+	}
+	sessionVariables["transaction_isolation"] = c.dataIterationTransactionIsolation()
+	withIsolationLevel.SessionVariables = sessionVariables
+	return withIsolationLevel
+}
+
+// connectionPools returns the shared and the dedicated connection pools
+func (c *DatabaseConfig) connectionPools() []*ConnectionPoolConfig {
+	pools := []*ConnectionPoolConfig{&c.ConnectionPool}
+	components := c.ComponentConnectionPools
+	for _, pool := range []*ConnectionPoolConfig{components.DataIterator, components.BatchWriter, components.BinlogWriter, components.Verifier} {
+		if pool != nil {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
+
+// users returns User and the distinct users of the writing components
+func (c *DatabaseConfig) users() []string {
+	users := []string{c.User}
+	components := c.ComponentCredentials
+	for _, credentials := range []*CredentialsConfig{components.BatchWriter, components.BinlogWriter, components.StateTracker} {
+		if credentials != nil && credentials.User != c.User {
+			users = append(users, credentials.User)
+		}
+	}
+	return users
+}
+
+// withCredentials returns a copy of the config connecting with the
+// credentials, or the config itself if the credentials are nil
+func (c *DatabaseConfig) withCredentials(credentials *CredentialsConfig) *DatabaseConfig {
+	if credentials == nil {
+		return c
+	}
+	// the copy connects through the same tunnel
+	c.sharedTunnels()
+	config := *c
+	config.User = credentials.User
+	config.Pass = credentials.Pass
+	return &config
+}
+
+// IsRDS returns whether the database is hosted on Amazon RDS or Aurora
+func (c *DatabaseConfig) IsRDS() bool {
+	return c.Platform == PlatformRDS || c.Platform == PlatformAurora
+}
+
+// Address returns the address of the database, for identifying it
+func (c *DatabaseConfig) Address() string {
+	if c.Socket != "" {
+		return c.Socket
+	}
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// DialAddress returns the host and port to connect to the database at, which
+// are the local end of the SSHTunnel if one is configured, or of a
+// SocketRelay for a Socket. The tunnel or relay is opened on first use, and
+// closed with CloseTunnel.
+func (c *DatabaseConfig) DialAddress() (string, uint16, error) {
+	if c.Socket == "" && c.SSHTunnel == nil {
+		return c.Host, c.Port, nil
+	}
+
+	tunnels := c.sharedTunnels()
+	tunnels.mutex.Lock()
+	defer tunnels.mutex.Unlock()
+
+	if c.Socket != "" {
+		if tunnels.socketRelay == nil {
+			relay, err := OpenSocketRelay(c.Socket, nil)
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to relay the connections to %s: %v", c.Socket, err)
+			}
+			tunnels.socketRelay = relay
+		}
+
+		host, port := tunnels.socketRelay.LocalAddr()
+		return host, port, nil
+	}
+
+	if tunnels.sshTunnel == nil {
+		tunnel, err := OpenSSHTunnel(c.SSHTunnel, fmt.Sprintf("%s:%d", c.Host, c.Port), nil)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to open SSH tunnel: %v", err)
+		}
+		tunnels.sshTunnel = tunnel
+	}
+
+	host, port := tunnels.sshTunnel.LocalAddr()
+	return host, port, nil
+}
+
+// CloseTunnel closes the SSHTunnel or SocketRelay opened by DialAddress, if
+// any. The connections through it fail from then on.
+func (c *DatabaseConfig) CloseTunnel() error {
+	return c.sharedTunnels().close()
+}
+
+func (c *DatabaseConfig) MySQLConfig() (*mysql.Config, error) {
+	var err error
+	net, addr := "unix", c.Socket
+	if c.Socket == "" {
+		host, port, err := c.DialAddress()
 		if err != nil {
 			return nil, err
 		}
+		net, addr = "tcp", fmt.Sprintf("%s:%d", host, port)
+	}
+
+	cfg := &mysql.Config{
+		User:      c.User,
+		Passwd:    c.Pass,
+		Net:       net,
+		Addr:      addr,
+		Collation: c.Collation,
+		Params:    c.Params,
+
+		MultiStatements: true,
+
+		ConnectionAttributes: c.connectionAttributesDSN(),
+	}
+
+	if c.Compress {
+		if err := cfg.Apply(mysql.EnableCompression(true)); err != nil {
+			return nil, fmt.Errorf("failed to enable compression: %v", err)
+		}
+	}
+
+	if c.IAMAuthRegion != "" {
+		// the token is sent in cleartext, which is safe as RDS requires TLS
+		// for IAM authentication
+		cfg.AllowCleartextPasswords = true
+	}
+
+	if c.TLS == nil && c.IsRDS() && c.SSHTunnel == nil {
+		cfg.TLSConfig = "true"
+	} else if c.TLS != nil || c.IsRDS() {
+		tlsConfig := &tls.Config{}
+		if c.TLS != nil {
+			tlsConfig, err = c.TLS.BuildConfig()
+			if err != nil {
+				return nil, fmt.Errorf("failed to build TLS config: %v", err)
+			}
+		}
+
+		// the driver verifies the name of the address it connects to, which
+		// is the local end of the tunnel
+		if c.SSHTunnel != nil && tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = c.Host
+		}
+
+		cfgName := fmt.Sprintf("%s@%s:%s", c.User, c.Host, c.Port)
+
+		err = mysql.RegisterTLSConfig(cfgName, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register TLS config: %v", err)
+		}
+
+		cfg.TLSConfig = cfgName
+	}
+
+	return cfg, nil
+}
+
+func (c *DatabaseConfig) Validate() error {
+	if c.Socket != "" {
+		if c.SSHTunnel != nil {
+			return fmt.Errorf("Socket cannot be combined with SSHTunnel")
+		}
+	} else {
+		if c.Host == "" {
+			return fmt.Errorf("host is empty")
+		}
+
+		if c.Port == 0 {
+			return fmt.Errorf("port is not specified")
+		}
+	}
+
+	if c.User == "" {
+		return fmt.Errorf("user is empty")
+	}
+
+	if c.Platform == "" {
+		c.Platform = PlatformMySQL
+	} else if c.Platform != PlatformMySQL && !c.IsRDS() {
+		return fmt.Errorf("invalid Platform specified (set to %s)", c.Platform)
+	}
+
+	if c.IAMAuthRegion != "" {
+		if !c.IsRDS() {
+			return fmt.Errorf("IAMAuthRegion is only supported for the rds and aurora platforms")
+		}
+		if c.Pass != "" {
+			return fmt.Errorf("IAMAuthRegion and Pass cannot both be specified")
+		}
+	}
+
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return fmt.Errorf("TLS invalid: %v", err)
+		}
+	}
+
+	if c.SSHTunnel != nil {
+		if err := c.SSHTunnel.Validate(); err != nil {
+			return fmt.Errorf("SSHTunnel invalid: %v", err)
+		}
+		if c.IAMAuthRegion != "" {
+			return fmt.Errorf("IAMAuthRegion cannot be combined with SSHTunnel")
+		}
+	}
+
+	if _, _, err := c.queryTimeouts(); err != nil {
+		return err
+	}
+
+	if c.ConnectionAttributes == nil {
+		c.ConnectionAttributes = make(map[string]string)
+	}
+	for key, value := range c.ConnectionAttributes {
+		if key == "" || strings.ContainsAny(key, ",:") || strings.ContainsAny(value, ",:") {
+			return fmt.Errorf("invalid ConnectionAttributes: %s:%s", key, value)
+		}
+	}
+	if c.ConnectionAttributes["program_name"] == "" {
+		c.ConnectionAttributes["program_name"] = "ghostferry"
+	}
+
+	if err := c.ConnectionPool.Validate(); err != nil {
+		return fmt.Errorf("ConnectionPool invalid: %v", err)
+	}
+
+	if err := c.ComponentConnectionPools.Validate(); err != nil {
+		return fmt.Errorf("ComponentConnectionPools invalid: %v", err)
+	}
+
+	if err := c.ComponentCredentials.Validate(c.IAMAuthRegion != ""); err != nil {
+		return fmt.Errorf("ComponentCredentials invalid: %v", err)
+	}
+
+	if c.TimeZone == "" {
+		c.TimeZone = "+00:00"
+	}
+	if _, err := c.Location(); err != nil {
+		return fmt.Errorf("invalid TimeZone: %v", err)
+	}
+
+	err := c.assertParamSet("time_zone", "'"+c.TimeZone+"'")
+	if err != nil {
+		return err
+	}
+
+	if c.SQLMode == "" {
+		c.SQLMode = "STRICT_ALL_TABLES"
+	}
+
+	err = c.assertParamSet("sql_mode", "'"+strings.Join(c.SQLModes(), ",")+"'")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// matches time zone offsets such as "+02:00" or "-05:30"
+var timeZoneOffsetRegexp = regexp.MustCompile(`^([+-])(\d{1,2}):(\d{2})$`)
+
+// SQLModes returns the modes of the sql_mode of the sessions, including
+// NO_BACKSLASH_ESCAPES
+func (c *DatabaseConfig) SQLModes() []string {
+	modes := make([]string, 0)
+	for _, mode := range strings.Split(c.SQLMode, ",") {
+		mode = strings.ToUpper(strings.TrimSpace(mode))
+		if mode != "" && mode != "NO_BACKSLASH_ESCAPES" {
+			modes = append(modes, mode)
+		}
+	}
+	return append(modes, "NO_BACKSLASH_ESCAPES")
+}
+
+// Location returns the TimeZone of the sessions as a time.Location
+func (c *DatabaseConfig) Location() (*time.Location, error) {
+	return loadTimeZone(c.TimeZone)
+}
+
+// loadTimeZone returns the location of a MySQL time_zone, an offset or a
+// named time zone
+func loadTimeZone(name string) (*time.Location, error) {
+	if match := timeZoneOffsetRegexp.FindStringSubmatch(name); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes, _ := strconv.Atoi(match[3])
+		offset := hours*60*60 + minutes*60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	// the time zone of the server is not known to Ghostferry
+	if strings.EqualFold(name, "SYSTEM") {
+		return nil, fmt.Errorf("SYSTEM is not supported")
+	}
+
+	return time.LoadLocation(name)
+}
+
+func (c *DatabaseConfig) SqlDB(logger *logrus.Entry) (*sql.DB, error) {
+	return c.sqlDB(logger, c.ConnectionPool.SessionVariables)
+}
+
+func (c *DatabaseConfig) sqlDB(logger *logrus.Entry, sessionVariables map[string]string) (*sql.DB, error) {
+	dbCfg, err := c.MySQLConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build database config: %s", err)
+	}
+
+	if len(sessionVariables) > 0 {
+		// the driver sets the parameters it does not know as session
+		// variables on connecting
+		params := make(map[string]string, len(dbCfg.Params)+len(sessionVariables))
+		for name, value := range dbCfg.Params {
+			params[name] = value
+		}
+		for name, value := range sessionVariables {
+			params[name] = value
+		}
+		dbCfg.Params = params
+	}
+
+	queryTimeout, slowQueryThreshold, err := c.queryTimeouts()
+	if err != nil {
+		return nil, err
+	}
+
+	if logger != nil {
+		logger.WithField("dsn", MaskedDSN(dbCfg)).Info("connecting to database")
+	} else {
+		logger = logrus.WithField("tag", "sqlwrapper")
+	}
+
+	driverName := "mysql"
+	if c.IAMAuthRegion != "" {
+		_, driverName = rdsIAMAuthDriverFor(c.IAMAuthRegion)
+	}
+
+	var db *sql.DB
+	if c.recordSession != nil {
+		db = sql.OpenDB(&sessionRecordingConnector{driver: c.sqlDriver(), dsn: dbCfg.FormatDSN(), record: c.recordSession}, c.Marginalia)
+	} else {
+		db, err = sql.Open(driverName, dbCfg.FormatDSN(), c.Marginalia)
+		if err != nil {
+			return db, err
+		}
+	}
+
+	db.SetQueryTimeout(queryTimeout)
+	db.SetSlowQueryLog(slowQueryThreshold, logger)
+	c.ConnectionPool.Apply(db)
+	return db, nil
+}
+
+// ComponentSqlDB returns a dedicated connection pool to the database with the
+// settings and the session variables of the pool
+func (c *DatabaseConfig) ComponentSqlDB(pool *ConnectionPoolConfig, logger *logrus.Entry) (*sql.DB, error) {
+	sessionVariables := make(map[string]string)
+	for name, value := range c.ConnectionPool.SessionVariables {
+		sessionVariables[name] = value
+	}
+	for name, value := range pool.SessionVariables {
+		sessionVariables[name] = value
+	}
+
+	db, err := c.sqlDB(logger, sessionVariables)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.Apply(db)
+	return db, nil
+}
+
+func (c *DatabaseConfig) queryTimeouts() (queryTimeout, slowQueryThreshold time.Duration, err error) {
+	if c.QueryTimeout != "" {
+		queryTimeout, err = time.ParseDuration(c.QueryTimeout)
+		if err != nil {
+			err = fmt.Errorf("invalid QueryTimeout: %v", err)
+			return
+		}
+	}
+
+	if c.SlowQueryThreshold != "" {
+		slowQueryThreshold, err = time.ParseDuration(c.SlowQueryThreshold)
+		if err != nil {
+			err = fmt.Errorf("invalid SlowQueryThreshold: %v", err)
+			return
+		}
+	}
+
+	return
+}
+
+func (c *DatabaseConfig) connectionAttributesDSN() string {
+	keys := make([]string, 0, len(c.ConnectionAttributes))
+	for key := range c.ConnectionAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]string, len(keys))
+	for i, key := range keys {
+		attributes[i] = key + ":" + c.ConnectionAttributes[key]
+	}
+	return strings.Join(attributes, ",")
+}
+
+func (c *DatabaseConfig) assertParamSet(param, value string) error {
+	if c.Params == nil {
+		c.Params = make(map[string]string)
+	}
+
+	if c.Params[param] != "" && c.Params[param] != value {
+		return fmt.Errorf("%s must be set to %s", param, value)
+	}
+	c.Params[param] = value
+
+	return nil
+}
+
+type InlineVerifierConfig struct {
+	// The maximum expected downtime during cutover, in the format of
+	// time.ParseDuration. If nothing is specified, the InlineVerifier will not
+	// try to estimate the downtime and will always allow cutover.
+	MaxExpectedDowntime string
+
+	// The interval at which the periodic binlog reverification occurs, in the
+	// format of time.ParseDuration. Default: 1s.
+	VerifyBinlogEventsInterval string
+
+	verifyBinlogEventsInterval time.Duration
+	maxExpectedDowntime        time.Duration
+}
+
+func (c *InlineVerifierConfig) Validate() error {
+	var err error
+	if c.MaxExpectedDowntime != "" {
+		c.maxExpectedDowntime, err = time.ParseDuration(c.MaxExpectedDowntime)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.maxExpectedDowntime = time.Duration(0)
+	}
+
+	if c.VerifyBinlogEventsInterval == "" {
+		c.VerifyBinlogEventsInterval = "1s"
+	}
+
+	c.verifyBinlogEventsInterval, err = time.ParseDuration(c.VerifyBinlogEventsInterval)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type RetryPolicyConfig struct {
+	// The maximum random delay before retrying a write that failed due to a
+	// deadlock (MySQL error 1213) or a lock wait timeout (error 1205), in the
+	// format of time.ParseDuration. Apart from this jitter, such writes are
+	// retried immediately.
+	//
+	// Optional: defaults to 50ms
+	LockContentionJitter string
+
+	// The delay before retrying a write that failed due to a broken or
+	// refused connection, in the format of time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	ConnectionErrorBackoff string
+
+	// If true, errors caused by the statement itself (such as syntax errors,
+	// unknown columns or constraint violations) are retried like any other
+	// error. By default, such errors fail immediately, as retrying the same
+	// statement cannot make it succeed.
+	//
+	// Optional: defaults to false
+	RetrySemanticErrors bool
+
+	lockContentionJitter   time.Duration
+	connectionErrorBackoff time.Duration
+}
+
+func (c *RetryPolicyConfig) Validate() error {
+	var err error
+	if c.LockContentionJitter == "" {
+		c.LockContentionJitter = "50ms"
+	}
+
+	c.lockContentionJitter, err = time.ParseDuration(c.LockContentionJitter)
+	if err != nil {
+		return err
+	}
+
+	if c.ConnectionErrorBackoff == "" {
+		c.ConnectionErrorBackoff = "1s"
+	}
+
+	c.connectionErrorBackoff, err = time.ParseDuration(c.ConnectionErrorBackoff)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const (
+	ErrorActionFatal     = "fatal"
+	ErrorActionSkipTable = "skip_table"
+	ErrorActionRetry     = "retry"
+)
+
+// The actions supported by each component, see ErrorPolicyConfig
+var errorPolicyActions = map[string][]string{
+	"data_iterator":   []string{ErrorActionFatal, ErrorActionSkipTable, ErrorActionRetry},
+	"binlog_streamer": []string{ErrorActionFatal, ErrorActionRetry},
+}
+
+type CatchUpConfig struct {
+	// The binlog streaming is caught up with the source once the last
+	// streamed event was written on the source at most this long ago, in the
+	// format of time.ParseDuration.
+	//
+	// Optional: defaults to 10s
+	MaxLag string
+
+	// If set, the binlog streaming is only caught up with the source once the
+	// current binlog position of the source is at most this many bytes of
+	// binlogs ahead of the last streamed event.
+	//
+	// Optional: defaults to not considering the bytes behind
+	MaxBytesBehind uint64
+
+	// How often WaitUntilBinlogStreamerCatchesUp checks whether the binlog
+	// streaming caught up, in the format of time.ParseDuration.
+	//
+	// Optional: defaults to 500ms
+	CheckInterval string
+
+	maxLag        time.Duration
+	checkInterval time.Duration
+}
+
+func (c *CatchUpConfig) Validate() error {
+	if c.MaxLag == "" {
+		c.MaxLag = "10s"
+	}
+	if c.CheckInterval == "" {
+		c.CheckInterval = "500ms"
+	}
+
+	var err error
+	c.maxLag, err = time.ParseDuration(c.MaxLag)
+	if err != nil {
+		return fmt.Errorf("invalid MaxLag specified: %v", err)
+	}
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+	return nil
+}
+
+type ErrorPolicyConfig struct {
+	// The action taken on the errors of a component, by the name of the
+	// component as passed to the ErrorHandler. The actions are:
+	//
+	// - fatal: the error is passed to ErrorHandler.Fatal, which aborts the run
+	//   by default.
+	// - skip_table: the table is quarantined and the run continues with the
+	//   other tables. Its copy is stopped, its binlog events are dropped and
+	//   it is not verified, so it is left incomplete on the target. The
+	//   quarantined tables are reported in Progress.QuarantinedTables, and to
+	//   the ErrorHandler if it implements TableErrorHandler. The run fails
+	//   before the cutover unless AllowCutoverWithQuarantinedTables is set.
+	//   Only supported by "data_iterator".
+	// - retry: the failed operation is retried until it succeeds, every
+	//   RetryInterval, or for the binlog_streamer until the
+	//   ReconnectTimeout. The copy of a table resumes where it failed. Errors
+	//   caused by the statement itself (see ClassifyError) are still fatal.
+	//   Supported by "data_iterator" and "binlog_streamer".
+	//
+	// Optional: defaults to fatal for all components
+	Components map[string]string
+
+	// The delay between the attempts of the retry action, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to 5s
+	RetryInterval string
+
+	// How long the binlog_streamer keeps reconnecting with the retry action
+	// after failing to read the binlogs, in the format of
+	// time.ParseDuration. The last error is then passed to
+	// ErrorHandler.Fatal.
+	//
+	// Optional: defaults to 10m
+	ReconnectTimeout string
+
+	// Let the cutover proceed while tables are quarantined, acknowledging
+	// that they are incomplete on the target.
+	//
+	// Optional: defaults to false
+	AllowCutoverWithQuarantinedTables bool
+
+	retryInterval    time.Duration
+	reconnectTimeout time.Duration
+}
+
+func (c *ErrorPolicyConfig) Validate() error {
+	for component, action := range c.Components {
+		actions, found := errorPolicyActions[component]
+		if !found {
+			return fmt.Errorf("unsupported component %s", component)
+		}
+
+		supported := false
+		for _, a := range actions {
+			if a == action {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("unsupported action %s for component %s, must be one of %s", action, component, strings.Join(actions, ", "))
+		}
+	}
+
+	if c.RetryInterval == "" {
+		c.RetryInterval = "5s"
+	}
+
+	var err error
+	c.retryInterval, err = time.ParseDuration(c.RetryInterval)
+	if err != nil {
+		return err
+	}
+
+	if c.ReconnectTimeout == "" {
+		c.ReconnectTimeout = "10m"
+	}
+
+	c.reconnectTimeout, err = time.ParseDuration(c.ReconnectTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid ReconnectTimeout specified: %v", err)
+	}
+
+	return nil
+}
+
+// ActionFor returns the action to take on an error of the component
+func (c *ErrorPolicyConfig) ActionFor(component string, err error) string {
+	if c == nil {
+		return ErrorActionFatal
+	}
+
+	action, found := c.Components[component]
+	if !found {
+		return ErrorActionFatal
+	}
+
+	// retrying the same statement cannot make it succeed
+	if action == ErrorActionRetry && ClassifyError(err) == ErrorClassSemantic {
+		return ErrorActionFatal
+	}
+
+	return action
+}
+
+type RunLockConfig struct {
+	// If true, an advisory lock (GET_LOCK) is acquired on the target when the
+	// ferry is initialized and held until the run is complete, such that a
+	// second ferry for the same source and target fails to start instead of
+	// corrupting the state of the first one.
+	Enabled bool
+
+	// The name of the lock, at most 64 characters. Ferries sharing a target
+	// with different sources can use the same name to exclude each other.
+	//
+	// Optional: defaults to a name derived from the source and the target
+	Name string
+
+	// How often the connection holding the lock is checked, in the format of
+	// time.ParseDuration. The run is aborted once the lock is lost, e.g.
+	// because the connection dropped, as another ferry could then start.
+	//
+	// Optional: defaults to 10s
+	CheckInterval string
+
+	checkInterval time.Duration
+}
+
+func (c *RunLockConfig) Validate() error {
+	if len(c.Name) > 64 {
+		return fmt.Errorf("Name must be at most 64 characters (set to %s)", c.Name)
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "10s"
+	}
+
+	var err error
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type ForeignWriteGuardConfig struct {
+	// If true, the binlog of the target is streamed to detect writes to the
+	// copied tables that do not originate from Ghostferry.
+	//
+	// Writes are attributed to Ghostferry if they are performed by a session
+	// of the Target user, so this user must not be shared with applications.
+	Enabled bool
+
+	// What to do when a foreign write is detected. Valid choices are:
+	// fail
+	// warn
+	//
+	// Optional: defaults to "warn"
+	Action string
+
+	// The interval at which the sessions of the Target user are looked up,
+	// in the format of time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	SessionRefreshInterval string
+
+	sessionRefreshInterval time.Duration
+}
+
+func (c *ForeignWriteGuardConfig) Validate() error {
+	if c.Action == "" {
+		c.Action = ForeignWriteActionWarn
+	} else if c.Action != ForeignWriteActionFail && c.Action != ForeignWriteActionWarn {
+		return fmt.Errorf("invalid Action specified (set to %s)", c.Action)
+	}
+
+	if c.SessionRefreshInterval == "" {
+		c.SessionRefreshInterval = "1s"
+	}
+
+	var err error
+	c.sessionRefreshInterval, err = time.ParseDuration(c.SessionRefreshInterval)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type CutoverValidationConfig struct {
+	// If true, a validation suite runs before the cutover of copydb and
+	// sharding, once the binlog streaming stopped, and the cutover only
+	// happens if all of its checks pass. The report of the checks is logged
+	// either way.
+	Enabled bool
+
+	// The checks not to run, by name:
+	// binlog_drained: all streamed binlog events were applied to the target
+	// verification: the verification during cutover found no differences
+	// foreign_writes: the ForeignWriteGuard detected no writes to the target
+	// auto_increment: the AUTO_INCREMENT values of the target are not behind
+	//   the ones of the source
+	// triggers: the triggers of the source tables exist on the target
+	// foreign_keys: the foreign keys of the source tables exist on the target
+	//
+	// As sharding only copies the rows of a shard, the AUTO_INCREMENT values
+	// of its target may well be behind, skip auto_increment if they are not
+	// used after the cutover, or enable AutoIncrementSync.
+	//
+	// Optional: defaults to running all checks
+	SkipChecks []string
+}
+
+func (c *CutoverValidationConfig) Validate() error {
+	for _, check := range c.SkipChecks {
+		if !cutoverChecks[check] {
+			return fmt.Errorf("invalid SkipChecks specified (unknown check %s)", check)
+		}
+	}
+	return nil
+}
+
+func (c *CutoverValidationConfig) skipped(check string) bool {
+	for _, skipped := range c.SkipChecks {
+		if skipped == check {
+			return true
+		}
+	}
+	return false
+}
+
+type AutoIncrementSyncConfig struct {
+	// If true, the AUTO_INCREMENT values of the target tables are advanced to
+	// the ones of the source tables before the cutover of copydb and
+	// sharding, once the binlog streaming stopped. Otherwise the target may
+	// assign ids already used on the source, e.g. of rows deleted before the
+	// copy, resulting in duplicate key errors or reused ids after the
+	// cutover. The values of the target are never decreased.
+	Enabled bool
+
+	// Added to the AUTO_INCREMENT values of the source, to leave room for
+	// rows written to the source until the applications use the target.
+	//
+	// Optional: defaults to 0
+	Headroom uint64
+}
+
+type ClickHouseSinkConfig struct {
+	// The URL of the HTTP interface of ClickHouse, e.g.
+	// http://localhost:8123. If set, the copied rows and the binlog DML events
+	// are also written into the ReplacingMergeTree tables of the same names
+	// (after DatabaseRewrites and TableRewrites) in ClickHouse.
+	Address string
+
+	// Optional: defaults to the default user of ClickHouse
+	User     string
+	Password string
+
+	// Optional: defaults to "_version"
+	VersionColumn string
+
+	// Optional: defaults to "_is_deleted"
+	DeletedColumn string
+
+	// Only write to ClickHouse and discard the writes to the MySQL target.
+	// As for the BenchmarkMode, this is incompatible with verifiers, schema
+	// change replication and resuming state from the target DB.
+	//
+	// Optional: defaults to false
+	Exclusive bool
+
+	// The timeout of each request to ClickHouse, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to 30s
+	Timeout string
+
+	timeout time.Duration
+}
+
+func (c *ClickHouseSinkConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+func (c *ClickHouseSinkConfig) Validate() error {
+	if c.VersionColumn == "" {
+		c.VersionColumn = "_version"
+	}
+
+	if c.DeletedColumn == "" {
+		c.DeletedColumn = "_is_deleted"
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "30s"
+	}
+
+	var err error
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout specified: %v", err)
+	}
+
+	return nil
+}
+
+type LoopPreventionConfig struct {
+	// Skip the binlog transactions on the source that were performed by
+	// sessions of this user. When replicating between two databases in both
+	// directions, this is the Target user of the ferry replicating in the
+	// opposite direction, such that its writes are not replicated back.
+	//
+	// This user must not be shared with applications, as their writes would
+	// not be replicated either.
+	IgnoredUser string
+
+	// The interval at which the sessions of the IgnoredUser are looked up,
+	// in the format of time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	SessionRefreshInterval string
+
+	// How to handle a transaction of a session that ended before it was
+	// looked up, which cannot be attributed to the IgnoredUser or not:
+	//
+	// - "fail": fail the run, as the transaction may be replicated back
+	// - "warn": replicate the transaction, logging a warning and emitting a
+	//   "LoopPrevention.UnknownSession" metric
+	//
+	// This does not apply to a BidirectionalFerry, which records the
+	// sessions of the opposite ferry as they are opened.
+	//
+	// Optional: defaults to "fail"
+	UnknownSessionAction string
+
+	// the users of the components of the opposite ferry writing with
+	// credentials of their own, whose sessions are skipped as well, see
+	// BidirectionalFerry
+	componentUsers []string
+
+	// the IDs of the sessions the opposite ferry opened to the source, see
+	// BidirectionalFerry
+	ignoredSessions *sync.Map
+
+	sessionRefreshInterval time.Duration
+}
+
+func (c *LoopPreventionConfig) Enabled() bool {
+	return c.IgnoredUser != ""
+}
+
+func (c *LoopPreventionConfig) Validate() error {
+	if c.SessionRefreshInterval == "" {
+		c.SessionRefreshInterval = "1s"
+	}
+
+	var err error
+	c.sessionRefreshInterval, err = time.ParseDuration(c.SessionRefreshInterval)
+	if err != nil {
+		return err
+	}
+
+	if c.UnknownSessionAction == "" {
+		c.UnknownSessionAction = LoopPreventionUnknownSessionFail
+	} else if c.UnknownSessionAction != LoopPreventionUnknownSessionFail && c.UnknownSessionAction != LoopPreventionUnknownSessionWarn {
+		return fmt.Errorf("invalid UnknownSessionAction specified (set to %s)", c.UnknownSessionAction)
+	}
+
+	return nil
+}
+
+type LagAlertConfig struct {
+	// Log a warning and emit a "LagAlert" metric when the apply lag of the
+	// binlog writer exceeds this duration, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to no warnings
+	WarningLag string
+
+	// The apply lag considered critical, in the format of
+	// time.ParseDuration. Once the lag has been above it for
+	// CriticalLagDuration, the CriticalCallback is called and, if
+	// ExitOnCritical is set, Ghostferry fails.
+	//
+	// Optional: defaults to no critical alerts
+	CriticalLag string
+
+	// Optional: defaults to 0s, alerting as soon as the lag is critical
+	CriticalLagDuration string
+
+	// Called once each time the lag becomes critical. The apply lag in
+	// seconds is sent along with the Payload of the callback.
+	//
+	// Optional: defaults to no callback
+	CriticalCallback HTTPCallback
+
+	// Optional: defaults to false
+	ExitOnCritical bool
+
+	// The interval at which the apply lag is checked and reported as the
+	// "BinlogWriter.ApplyLag" gauge.
+	//
+	// Optional: defaults to 1s
+	CheckInterval string
+
+	warningLag          time.Duration
+	criticalLag         time.Duration
+	criticalLagDuration time.Duration
+	checkInterval       time.Duration
+}
+
+func (c *LagAlertConfig) Enabled() bool {
+	return c.WarningLag != "" || c.CriticalLag != ""
+}
+
+func (c *LagAlertConfig) Validate() error {
+	var err error
+
+	if c.WarningLag != "" {
+		c.warningLag, err = time.ParseDuration(c.WarningLag)
+		if err != nil {
+			return fmt.Errorf("invalid WarningLag specified: %v", err)
+		}
+	}
+
+	if c.CriticalLag != "" {
+		c.criticalLag, err = time.ParseDuration(c.CriticalLag)
+		if err != nil {
+			return fmt.Errorf("invalid CriticalLag specified: %v", err)
+		}
+	} else if c.CriticalLagDuration != "" || c.CriticalCallback.URI != "" || c.ExitOnCritical {
+		return fmt.Errorf("CriticalLagDuration, CriticalCallback and ExitOnCritical require CriticalLag")
+	}
+
+	if c.CriticalLagDuration != "" {
+		c.criticalLagDuration, err = time.ParseDuration(c.CriticalLagDuration)
+		if err != nil {
+			return fmt.Errorf("invalid CriticalLagDuration specified: %v", err)
+		}
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "1s"
+	}
+
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type BinlogRetentionConfig struct {
+	// Alert when the binlogs holding the position a run resumes from are
+	// expected to be purged from the source within this margin, in the
+	// format of time.ParseDuration, e.g. while the run is paused or lagging.
+	// A run can no longer be resumed once they are purged.
+	//
+	// Optional: defaults to no alerts
+	WarningMargin string
+
+	// How long the source keeps its binlogs, in the format of
+	// time.ParseDuration. Needed for sources that purge binlogs by other
+	// means than MySQL.
+	//
+	// Optional: defaults to binlog_expire_logs_seconds, or expire_logs_days
+	// before MySQL 8.0, of the source, or to the binlog retention hours of
+	// mysql.rds_show_configuration on RDS and Aurora
+	Retention string
+
+	// Optional: defaults to 1m
+	CheckInterval string
+
+	warningMargin time.Duration
+	retention     time.Duration
+	checkInterval time.Duration
+}
+
+func (c *BinlogRetentionConfig) Enabled() bool {
+	return c.WarningMargin != ""
+}
+
+func (c *BinlogRetentionConfig) Validate() error {
+	var err error
+
+	c.warningMargin, err = time.ParseDuration(c.WarningMargin)
+	if err != nil {
+		return fmt.Errorf("invalid WarningMargin specified: %v", err)
+	}
+	if c.warningMargin < 0 {
+		return fmt.Errorf("invalid WarningMargin specified (set to %s)", c.WarningMargin)
+	}
+
+	if c.Retention != "" {
+		c.retention, err = time.ParseDuration(c.Retention)
+		if err != nil {
+			return fmt.Errorf("invalid Retention specified: %v", err)
+		}
+		if c.retention <= 0 {
+			return fmt.Errorf("invalid Retention specified (set to %s)", c.Retention)
+		}
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "1m"
+	}
+
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type TableRecopyConfig struct {
+	// The tables to copy again from scratch when resuming, as schema.table
+	// on the source, e.g. to recover from data problems of single tables
+	// without restarting the whole run. The tables are truncated on the
+	// target, as the copy does not overwrite existing rows, and their copy
+	// state is reset, while the other tables resume where they stopped.
+	//
+	// The reset is recorded in the state until the table is copied, so
+	// resuming again before then continues its copy instead of truncating it
+	// again. Once the copy of the table completed, resuming with the table
+	// listed copies it again.
+	Tables []string
+}
+
+func (c *TableRecopyConfig) Enabled() bool {
+	return len(c.Tables) > 0
+}
+
+func (c *TableRecopyConfig) Validate() error {
+	for _, table := range c.Tables {
+		parts := strings.Split(table, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid table specified (set to %s), expected schema.table", table)
+		}
+	}
+	return nil
+}
+
+type TableCopyHooksConfig struct {
+	// Called for each table right before and right after its copy is marked
+	// as completed, e.g. to flip a feature flag of the application or the
+	// routing of a proxy for the table. The callbacks receive the copied
+	// table as Table and "before_complete" or "after_complete" as Phase,
+	// along with the Payload.
+	//
+	// The run fails if a callback keeps failing.
+	//
+	// Optional: defaults to no callbacks
+	BeforeComplete HTTPCallback
+	AfterComplete  HTTPCallback
+
+	// The number of attempts at calling a callback before the run fails.
+	//
+	// Optional: defaults to 5
+	Attempts int
+
+	// Optional: defaults to 1s
+	RetryInterval string
+
+	// The timeout of a single attempt.
+	//
+	// Optional: defaults to 10s
+	Timeout string
+
+	retryInterval time.Duration
+	timeout       time.Duration
+}
+
+func (c *TableCopyHooksConfig) Enabled() bool {
+	return c.BeforeComplete.URI != "" || c.AfterComplete.URI != ""
+}
+
+func (c *TableCopyHooksConfig) Validate() error {
+	var err error
+
+	if c.Attempts == 0 {
+		c.Attempts = 5
+	} else if c.Attempts < 0 {
+		return fmt.Errorf("invalid Attempts specified (set to %d)", c.Attempts)
+	}
+
+	if c.RetryInterval == "" {
+		c.RetryInterval = "1s"
+	}
+	c.retryInterval, err = time.ParseDuration(c.RetryInterval)
+	if err != nil {
+		return fmt.Errorf("invalid RetryInterval specified: %v", err)
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout specified: %v", err)
+	}
+	if c.timeout <= 0 {
+		return fmt.Errorf("invalid Timeout specified (set to %s)", c.Timeout)
+	}
+
+	return nil
+}
+
+type QueryKillerConfig struct {
+	// Kill the reads of the data copy in flight on the source with KILL QUERY
+	// once the copy has been throttled for this long, in the format of
+	// time.ParseDuration. The killed batches are read again once the
+	// throttling ends.
+	//
+	// Only the reads done in a transaction, i.e. with row locks, can be
+	// tracked and killed.
+	//
+	// Optional: defaults to never killing the reads
+	ThrottledFor string
+
+	// Optional: defaults to 1s
+	CheckInterval string
+
+	throttledFor  time.Duration
+	checkInterval time.Duration
+}
+
+func (c *QueryKillerConfig) Enabled() bool {
+	return c.ThrottledFor != ""
+}
+
+func (c *QueryKillerConfig) Validate() error {
+	var err error
+
+	c.throttledFor, err = time.ParseDuration(c.ThrottledFor)
+	if err != nil {
+		return fmt.Errorf("invalid ThrottledFor specified: %v", err)
+	}
+	if c.throttledFor < 0 {
+		return fmt.Errorf("invalid ThrottledFor specified (set to %s)", c.ThrottledFor)
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "1s"
+	}
+
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type SizingConfig struct {
+	// The time a batch of DataIterationBatchSize rows is assumed to take to
+	// copy, in the format of time.ParseDuration. It is only used to project
+	// the duration of the copy before it starts.
+	//
+	// Optional: defaults to 100ms
+	BatchDuration string
+
+	// The number of largest tables listed in the SizingReport.
+	//
+	// Optional: defaults to 5
+	LargestTables int
+
+	batchDuration time.Duration
+}
+
+func (c *SizingConfig) Validate() error {
+	var err error
+
+	if c.BatchDuration == "" {
+		c.BatchDuration = "100ms"
+	}
+
+	c.batchDuration, err = time.ParseDuration(c.BatchDuration)
+	if err != nil {
+		return fmt.Errorf("invalid BatchDuration specified: %v", err)
+	}
+	if c.batchDuration <= 0 {
+		return fmt.Errorf("invalid BatchDuration specified (set to %s)", c.BatchDuration)
+	}
+
+	if c.LargestTables == 0 {
+		c.LargestTables = 5
+	}
+	if c.LargestTables < 0 {
+		return fmt.Errorf("invalid LargestTables specified (set to %d)", c.LargestTables)
+	}
+
+	return nil
+}
+
+type TargetGuardConfig struct {
+	// Pause the writes to the target while its free disk space is below this
+	// size. The free space is read with the FreeDiskSpaceQuery, or estimated
+	// from the DiskCapacityMB otherwise.
+	//
+	// Optional: defaults to not checking the disk space
+	MinFreeDiskSpaceMB int64
+
+	// The size of the volume holding the data of the target. The free space
+	// is estimated as this size minus the size of all tables on the target,
+	// as MySQL does not expose the free space of the file system.
+	DiskCapacityMB int64
+
+	// A query returning the free disk space of the target in bytes, e.g.
+	// from a table filled by the monitoring of the host. Takes precedence
+	// over DiskCapacityMB.
+	FreeDiskSpaceQuery string
+
+	// Pause the writes to the target while fewer connections than this are
+	// left until max_connections is reached.
+	//
+	// Optional: defaults to not checking the connections
+	MinFreeConnections int
+
+	// Optional: defaults to 10s
+	CheckInterval string
+
+	checkInterval time.Duration
+}
+
+func (c *TargetGuardConfig) Enabled() bool {
+	return c.MinFreeDiskSpaceMB > 0 || c.MinFreeConnections > 0
+}
+
+func (c *TargetGuardConfig) Validate() error {
+	if c.MinFreeDiskSpaceMB > 0 && c.DiskCapacityMB <= 0 && c.FreeDiskSpaceQuery == "" {
+		return fmt.Errorf("MinFreeDiskSpaceMB requires DiskCapacityMB or FreeDiskSpaceQuery")
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "10s"
+	}
+
+	var err error
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type SlackNotificationsConfig struct {
+	// The URL of the Slack incoming webhook to post the notifications to.
+	//
+	// Optional: defaults to no Slack notifications
+	WebhookURL string
+
+	// The events to notify, see the Notification* constants.
+	//
+	// Optional: defaults to all events
+	Events []string
+}
+
+type PagerDutyNotificationsConfig struct {
+	// The integration key of the PagerDuty service to trigger alerts on,
+	// using the Events API v2.
+	//
+	// Optional: defaults to no PagerDuty alerts
+	RoutingKey string
+
+	// The events to alert on, see the Notification* constants.
+	//
+	// Optional: defaults to fatal_error and lag_critical
+	Events []string
+
+	// Optional: defaults to https://events.pagerduty.com/v2/enqueue
+	EventsURL string
+}
+
+type NotificationsConfig struct {
+	// Notify Slack and/or PagerDuty of the lifecycle events of the run:
+	// run_started, row_copy_completed, lag_critical (see LagAlert),
+	// binlog_retention_at_risk (see BinlogRetention), fatal_error (reported
+	// by the default PanicErrorHandler) and cutover_completed, with a short
+	// summary of the run.
+	Slack     SlackNotificationsConfig
+	PagerDuty PagerDutyNotificationsConfig
+
+	// The timeout of sending a notification.
+	//
+	// Optional: defaults to 10s
+	Timeout string
+
+	timeout time.Duration
+}
+
+func (c *NotificationsConfig) Enabled() bool {
+	return c.Slack.WebhookURL != "" || c.PagerDuty.RoutingKey != ""
+}
+
+func (c *NotificationsConfig) Validate() error {
+	if c.Slack.Events == nil {
+		c.Slack.Events = notificationEvents
+	}
+	if c.PagerDuty.Events == nil {
+		c.PagerDuty.Events = []string{NotificationFatalError, NotificationLagCritical}
+	}
+	if c.PagerDuty.EventsURL == "" {
+		c.PagerDuty.EventsURL = "https://events.pagerduty.com/v2/enqueue"
+	}
+
+	for _, events := range [][]string{c.Slack.Events, c.PagerDuty.Events} {
+		for _, event := range events {
+			known := false
+			for _, knownEvent := range notificationEvents {
+				known = known || event == knownEvent
+			}
+			if !known {
+				return fmt.Errorf("unknown event %s", event)
+			}
+		}
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+
+	var err error
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout specified: %v", err)
+	}
+
+	return nil
+}
+
+// TableDiscoveryConfig configures looking for applicable tables created on the
+// source during the row copy. The new tables are added to the schema cache,
+// their binlog events are applied from then on, and their rows are copied.
+//
+// The tables must exist on the target. Tables created after the row copy
+// completed are not copied, and the verifiers do not verify the new tables.
+type TableDiscoveryConfig struct {
+	// How often to look for new tables, in the format of time.ParseDuration.
+	//
+	// Optional: defaults to disabled
+	Interval string
+
+	interval time.Duration
+}
+
+func (c *TableDiscoveryConfig) Enabled() bool {
+	return c.Interval != ""
+}
+
+func (c *TableDiscoveryConfig) Validate() error {
+	var err error
+	c.interval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid Interval specified: %v", err)
+	}
+	if c.interval <= 0 {
+		return fmt.Errorf("invalid Interval specified (set to %s)", c.Interval)
+	}
+	return nil
+}
+
+// KeyRangeSplitConfig splits the copy of large tables into contiguous ranges
+// of their pagination keys, each copied by its own cursor, such that a single
+// huge table is not copied by a single cursor. Only tables paginated by a
+// single numeric column are split, and the ranges are split evenly between
+// the lowest and the target pagination key, whether or not the values in
+// between are used.
+//
+// The position of each range is stored in the state, and the ranges of a
+// table are kept when resuming, even if the config changed. With the
+// LockStrategy LockInGhostferry, the batches of the ranges of a table are still
+// read and written one at a time.
+type KeyRangeSplitConfig struct {
+	// The number of ranges a table is split into. Each range is copied
+	// concurrently, in addition to the DataIterationConcurrency tables
+	// copied at the same time.
+	//
+	// Optional: defaults to disabled
+	Ranges int
+
+	// The minimum difference between the lowest and the target pagination
+	// key of a table for the table to be split.
+	//
+	// Optional: defaults to 1000000
+	MinKeySpan uint64
+}
+
+func (c *KeyRangeSplitConfig) Enabled() bool {
+	return c.Ranges != 0
+}
+
+func (c *KeyRangeSplitConfig) Validate() error {
+	if c.Ranges < 2 {
+		return fmt.Errorf("invalid Ranges specified (set to %d), must be at least 2", c.Ranges)
+	}
+
+	if c.MinKeySpan == 0 {
+		c.MinKeySpan = 1000000
+	} else if c.MinKeySpan < uint64(c.Ranges) {
+		return fmt.Errorf("invalid MinKeySpan specified (set to %d), must be at least the number of Ranges", c.MinKeySpan)
+	}
+
+	return nil
+}
+
+// DistributedCopyConfig shares the row copy between several processes: a
+// coordinator, which streams the binlogs and performs the cutover, and any
+// number of workers, e.g. on other machines. All of them copy the tables they
+// lease from a table next to the state tables in the ResumeStateFromDB. A
+// lease is extended by heartbeats, and expires if the process holding it
+// stops, so another process copies the table from its last stored position.
+//
+// The coordinator must be started first. The workers use the same config,
+// including the MyServerId, which names the state tables, with the Role set
+// to worker. The coordinator continues once all tables are copied.
+//
+// The rows copied by a process are only coordinated with the binlog events
+// written by the same process, so a distributed copy is incompatible with
+// the LockStrategy LockInGhostferry, the Inline verifier and the
+// ReplicateSchemaChanges, whose truncations and schema changes of tables
+// being copied pause their copy in the coordinator only.
+type DistributedCopyConfig struct {
+	// The role of this process in the copy. Valid choices are:
+	// coordinator: streams the binlogs, copies tables and performs the
+	//   cutover once all tables are copied
+	// worker: only copies tables
+	//
+	// Optional: defaults to copying all tables in this process
+	Role string
+
+	// Identifies the process in the leases.
+	//
+	// Optional: defaults to "<hostname>-<pid>"
+	WorkerId string
+
+	// How long a lease is valid without heartbeat, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to "1m"
+	LeaseDuration string
+
+	// How often the leases are extended, and the tables copied by other
+	// processes are looked up, in the format of time.ParseDuration. Must be
+	// shorter than the LeaseDuration.
+	//
+	// Optional: defaults to a third of the LeaseDuration
+	HeartbeatInterval string
+
+	leaseDuration     time.Duration
+	heartbeatInterval time.Duration
+}
+
+func (c *DistributedCopyConfig) Enabled() bool {
+	return c.Role != ""
+}
+
+// IsWorker returns whether this process only copies tables
+func (c *DistributedCopyConfig) IsWorker() bool {
+	return c.Role == DistributedCopyRoleWorker
+}
+
+func (c *DistributedCopyConfig) Validate() error {
+	if c.Role != DistributedCopyRoleCoordinator && c.Role != DistributedCopyRoleWorker {
+		return fmt.Errorf("invalid Role specified (set to %s)", c.Role)
+	}
+
+	if c.WorkerId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("WorkerId must be specified, as the hostname cannot be determined: %v", err)
+		}
+		c.WorkerId = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	if c.LeaseDuration == "" {
+		c.LeaseDuration = "1m"
+	}
+
+	var err error
+	c.leaseDuration, err = time.ParseDuration(c.LeaseDuration)
+	if err != nil {
+		return fmt.Errorf("invalid LeaseDuration specified: %v", err)
+	}
+	if c.leaseDuration <= 0 {
+		return fmt.Errorf("invalid LeaseDuration specified (set to %s)", c.LeaseDuration)
+	}
+
+	if c.HeartbeatInterval == "" {
+		c.heartbeatInterval = c.leaseDuration / 3
+		return nil
+	}
+
+	c.heartbeatInterval, err = time.ParseDuration(c.HeartbeatInterval)
+	if err != nil {
+		return fmt.Errorf("invalid HeartbeatInterval specified: %v", err)
+	}
+	if c.heartbeatInterval <= 0 || c.heartbeatInterval >= c.leaseDuration {
+		return fmt.Errorf("invalid HeartbeatInterval specified (set to %s), must be shorter than the LeaseDuration", c.HeartbeatInterval)
+	}
+
+	return nil
+}
+
+type ProgressHistoryConfig struct {
+	// How often to record the progress into the history, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to disabled
+	Interval string
+
+	// The number of most recent snapshots to keep in the table.
+	//
+	// Optional: defaults to 10080 (a week of snapshots recorded every minute)
+	MaxRows int
+
+	interval time.Duration
+}
+
+func (c *ProgressHistoryConfig) Enabled() bool {
+	return c.Interval != ""
+}
+
+func (c *ProgressHistoryConfig) Validate() error {
+	var err error
+	c.interval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid Interval specified: %v", err)
+	}
+	if c.interval <= 0 {
+		return fmt.Errorf("invalid Interval specified (set to %s)", c.Interval)
+	}
+
+	if c.MaxRows == 0 {
+		c.MaxRows = 10080
+	} else if c.MaxRows < 0 {
+		return fmt.Errorf("invalid MaxRows specified (set to %d)", c.MaxRows)
+	}
+
+	return nil
+}
+
+type MetricsConfig struct {
+	// Where the metrics are emitted to. Valid choices are:
+	// statsd: sent to the StatsD agent at the StatsDAddress, with DogStatsD
+	//   style tags
+	// prometheus: served in the Prometheus text format on the /metrics
+	//   endpoint of the ControlServer
+	// log: logged as structured log entries
+	//
+	// The metrics configured here also become the global metrics. Optional:
+	// defaults to the Metrics given to the Ferry or the global metrics (see
+	// SetGlobalMetrics), which do not emit anything unless set up by the
+	// application.
+	Sink string
+
+	// Optional: defaults to 127.0.0.1:8125
+	StatsDAddress string
+
+	// The prefix of the names of all metrics.
+	//
+	// Optional: defaults to ghostferry
+	Prefix string
+
+	// Tags attached to all metrics.
+	//
+	// Optional: defaults to no tags
+	Tags map[string]string
+}
+
+func (c *MetricsConfig) Validate() error {
+	switch c.Sink {
+	case "", MetricsSinkPrometheus, MetricsSinkLog:
+	case MetricsSinkStatsD:
+		if c.StatsDAddress == "" {
+			c.StatsDAddress = "127.0.0.1:8125"
+		}
+	default:
+		return fmt.Errorf("unknown Sink %s", c.Sink)
+	}
+
+	if c.Prefix == "" {
+		c.Prefix = "ghostferry"
+	}
+
+	return nil
+}
+
+type DDLDenylistConfig struct {
+	// The classes of schema changes that must never be applied to the
+	// target. Valid choices are:
+	// DROP TABLE
+	// TRUNCATE
+	// RENAME TABLE
+	// ALTER TABLE
+	// CREATE TABLE
+	//
+	// Statements on databases, such as DROP DATABASE, are never applied to
+	// the target, so they need not be denied.
+	//
+	// Optional: defaults to applying all schema changes
+	Statements []string
+
+	// What to do when a denied schema change is replicated. Valid choices are:
+	// skip: do not apply the statement and log an error
+	// halt: stop the run
+	//
+	// Optional: defaults to "halt"
+	Action string
+}
+
+func (c *DDLDenylistConfig) Validate() error {
+	for _, statement := range c.Statements {
+		known := false
+		for _, class := range ddlClasses {
+			if strings.ToUpper(statement) == class {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid statement class specified (set to %s)", statement)
+		}
+	}
+
+	if c.Action == "" {
+		c.Action = DDLDenylistActionHalt
+	} else if c.Action != DDLDenylistActionSkip && c.Action != DDLDenylistActionHalt {
+		return fmt.Errorf("invalid Action specified (set to %s)", c.Action)
+	}
+
+	return nil
+}
+
+// Denies returns whether schema changes of the class must not be applied
+func (c *DDLDenylistConfig) Denies(class string) bool {
+	for _, statement := range c.Statements {
+		if strings.ToUpper(statement) == class {
+			return true
+		}
+	}
+	return false
+}
+
+type AuditLogConfig struct {
+	// Append the statements applied to the target as JSON lines to this
+	// file.
+	//
+	// Optional: defaults to not writing an audit log file
+	Filename string
+
+	// The size in megabytes after which the audit log file is rotated to
+	// <Filename>.1, shifting older files to <Filename>.2 and so on.
+	//
+	// Optional: defaults to 100
+	MaxFileSizeMB int
+
+	// The number of rotated audit log files to keep.
+	//
+	// Optional: defaults to 5
+	MaxFiles int
+
+	// Insert the statements applied to the target into a table of this
+	// database on the target. The database and table are created if they do
+	// not exist.
+	//
+	// Optional: defaults to not writing an audit log table
+	Database string
+
+	// Optional: defaults to "ghostferry_audit_log"
+	Table string
+
+	// Also record every binlog transaction applied to the target, not only
+	// schema changes. This can produce a large amount of audit entries.
+	//
+	// Optional: defaults to false
+	IncludeDML bool
+
+	maxFileSize int64
+}
+
+func (c *AuditLogConfig) Enabled() bool {
+	return c.Filename != "" || c.Database != ""
+}
+
+func (c *AuditLogConfig) Validate() error {
+	if c.MaxFileSizeMB == 0 {
+		c.MaxFileSizeMB = 100
+	} else if c.MaxFileSizeMB < 0 {
+		return fmt.Errorf("invalid MaxFileSizeMB specified (set to %d)", c.MaxFileSizeMB)
+	}
+	c.maxFileSize = int64(c.MaxFileSizeMB) * 1024 * 1024
+
+	if c.MaxFiles == 0 {
+		c.MaxFiles = 5
+	} else if c.MaxFiles < 0 {
+		return fmt.Errorf("invalid MaxFiles specified (set to %d)", c.MaxFiles)
+	}
+
+	if c.Table == "" {
+		c.Table = "ghostferry_audit_log"
+	}
+
+	return nil
+}
+
+type PositionMapConfig struct {
+	// Record the source binlog positions applied to the target, along with
+	// the binlog coordinates of the target at that time, into a table of
+	// this database on the target. The database and table are created if
+	// they do not exist.
+	//
+	// Optional: defaults to not recording positions
+	Database string
+
+	// Optional: defaults to "ghostferry_position_map"
+	Table string
+
+	// The minimum time between two recorded positions, in the format of
+	// time.ParseDuration. The last applied position is always recorded when
+	// the binlog writer stops.
+	//
+	// Optional: defaults to "1s"
+	RecordInterval string
+
+	// The number of most recent positions to keep in the table.
+	//
+	// Optional: defaults to 10000
+	MaxRows int
+
+	recordInterval time.Duration
+}
+
+func (c *PositionMapConfig) Enabled() bool {
+	return c.Database != ""
+}
+
+func (c *PositionMapConfig) Validate() error {
+	if c.Table == "" {
+		c.Table = "ghostferry_position_map"
+	}
+
+	if c.RecordInterval == "" {
+		c.RecordInterval = "1s"
+	}
+
+	var err error
+	c.recordInterval, err = time.ParseDuration(c.RecordInterval)
+	if err != nil {
+		return fmt.Errorf("invalid RecordInterval specified: %v", err)
+	}
+
+	if c.MaxRows == 0 {
+		c.MaxRows = 10000
+	} else if c.MaxRows < 0 {
+		return fmt.Errorf("invalid MaxRows specified (set to %d)", c.MaxRows)
+	}
+
+	return nil
+}
+
+type NativeReplicationHandoffConfig struct {
+	// After the binlog streaming is stopped, configure the target as a
+	// replica of the source, starting from the last source position applied
+	// by Ghostferry, instead of cutting over.
+	Enabled bool
+
+	// The address of the source as reachable from the target, if it differs
+	// from the Source connection of Ghostferry.
+	//
+	// Optional: defaults to the Source Host and Port
+	SourceHost string
+	SourcePort uint16
+
+	// The replication user on the source, which requires the REPLICATION
+	// SLAVE privilege.
+	//
+	// Optional: defaults to the Source ComponentCredentials.BinlogStreamer,
+	// or to the Source User and Pass
+	User     string
+	Password string
+
+	// The replication channel of the target to configure.
+	//
+	// Optional: defaults to the default channel
+	Channel string
+
+	// Only configure the replication, without starting it.
+	//
+	// Optional: defaults to false
+	SkipStart bool
+}
+
+func (c *NativeReplicationHandoffConfig) Validate(source *DatabaseConfig) error {
+	if c.SourceHost == "" && source.Socket != "" {
+		return fmt.Errorf("SourceHost must be specified, as the Source is connected to through a Socket")
+	}
+
+	if c.SourceHost == "" {
+		c.SourceHost = source.Host
+	}
+
+	if c.SourcePort == 0 {
+		c.SourcePort = source.Port
+	}
+
+	if c.User == "" {
+		c.User = source.User
+		c.Password = source.Pass
+		if streamer := source.ComponentCredentials.BinlogStreamer; streamer != nil {
+			c.User = streamer.User
+			c.Password = streamer.Pass
+		}
+	}
+
+	return nil
+}
+
+type DumpLoadConfig struct {
+	// Seed the target from a directory written by mydumper instead of
+	// copying the rows from the source. The binlog streaming starts from the
+	// binlog coordinates recorded in the metadata file of the dump.
+	//
+	// Optional: defaults to copying the rows from the source
+	Directory string
+
+	// Seed the target from a SQL file written by mysqldump, optionally gzip
+	// compressed, instead of copying the rows from the source. The dump must
+	// be created with --master-data (or --source-data), and the binlog
+	// streaming starts from the binlog coordinates recorded in it.
+	//
+	// Optional: defaults to copying the rows from the source
+	File string
+
+	// The database of the tables dumped to File, if mysqldump was not run
+	// with --databases or --all-databases.
+	//
+	// Optional: defaults to the databases selected in File
+	Database string
+}
+
+func (c *DumpLoadConfig) Enabled() bool {
+	return c.Directory != "" || c.File != ""
+}
+
+func (c *DumpLoadConfig) Validate() error {
+	if c.Directory != "" && c.File != "" {
+		return fmt.Errorf("Directory and File cannot both be specified")
+	}
+
+	if c.Database != "" && c.File == "" {
+		return fmt.Errorf("Database is only supported for File")
+	}
+
+	return nil
+}
+
+type StartPositionConfig struct {
+	// Stream the binlogs from these coordinates of the source without
+	// copying any rows, for a target that was seeded by other means, e.g.
+	// restored from a backup taken at this position.
+	//
+	// Optional: defaults to copying the rows from the source
+	BinlogPosition *siddontangmysql.Position
+
+	// Like BinlogPosition, but stream the binlogs from the first transaction
+	// of the source that is not in this GTID set, e.g. the gtid_executed of
+	// the backup the target was restored from.
+	//
+	// Optional: defaults to copying the rows from the source
+	GTIDSet string
+
+	// As no rows are copied, the target must already hold the data of all
+	// applicable tables as of the start position. This must be set to
+	// confirm that it does.
+	//
+	// Required when BinlogPosition or GTIDSet is set
+	ConfirmTargetSeeded bool
+}
+
+func (c *StartPositionConfig) Enabled() bool {
+	return c.BinlogPosition != nil || c.GTIDSet != ""
+}
+
+func (c *StartPositionConfig) Validate() error {
+	if c.BinlogPosition != nil && c.GTIDSet != "" {
+		return fmt.Errorf("BinlogPosition and GTIDSet cannot both be specified")
+	}
+
+	if c.BinlogPosition != nil && (c.BinlogPosition.Name == "" || c.BinlogPosition.Pos < 4) {
+		return fmt.Errorf("invalid BinlogPosition specified (set to %s)", c.BinlogPosition)
+	}
 
-		if ok := certPool.AppendCertsFromPEM(pem); !ok {
-			return nil, errors.New("unable to append pem")
+	if c.GTIDSet != "" {
+		if _, err := siddontangmysql.ParseMysqlGTIDSet(c.GTIDSet); err != nil {
+			return fmt.Errorf("invalid GTIDSet specified: %v", err)
 		}
+	}
 
-		this.tlsConfig = &tls.Config{
-			RootCAs:    certPool,
-			ServerName: this.ServerName,
-		}
+	if !c.ConfirmTargetSeeded {
+		return fmt.Errorf("no rows are copied when starting from a position, set ConfirmTargetSeeded to confirm that the target already holds them")
 	}
 
-	return this.tlsConfig, nil
+	return nil
 }
 
-type DatabaseConfig struct {
-	Host       string
-	Port       uint16
-	User       string
-	Pass       string
-	Collation  string
-	Params     map[string]string
-	// SQL query comments to differentiate Ghostferry's binlog events
-	// Optional: defaults to empty string (no comments)
-	Marginalia string
+// StateEncryptionConfig encrypts the state written to the StateFilename or
+// dumped to stdout with AES-GCM, as it can contain row data and details of
+// the databases. The encrypted state is read back when resuming from a state
+// file. The key is either read from an environment variable, or is a data
+// key encrypted with AWS KMS that is decrypted when Ghostferry starts.
+type StateEncryptionConfig struct {
+	// The environment variable holding the base64-encoded key, of 16, 24 or
+	// 32 bytes for AES-128, AES-192 or AES-256.
+	//
+	// Optional: defaults to not encrypting the state
+	KeyEnv string
 
-	TLS *TLSConfig
+	// The base64-encoded data key encrypted with AWS KMS, e.g. the
+	// CiphertextBlob returned by "aws kms generate-data-key". It is
+	// decrypted with the AWS credentials of the default credential chain,
+	// see DatabaseConfig.IAMAuthRegion. Cannot be combined with KeyEnv.
+	//
+	// Optional: defaults to not encrypting the state
+	KMSEncryptedKey string
+
+	// The region of the KMS key.
+	//
+	// Required when KMSEncryptedKey is set
+	KMSRegion string
+
+	// Optional: defaults to "https://kms.<KMSRegion>.amazonaws.com"
+	KMSEndpoint string
+
+	key []byte
 }
 
-func (c *DatabaseConfig) MySQLConfig() (*mysql.Config, error) {
-	cfg := &mysql.Config{
-		User:      c.User,
-		Passwd:    c.Pass,
-		Net:       "tcp",
-		Addr:      fmt.Sprintf("%s:%d", c.Host, c.Port),
-		Collation: c.Collation,
-		Params:    c.Params,
+func (c *StateEncryptionConfig) Enabled() bool {
+	return c.KeyEnv != "" || c.KMSEncryptedKey != ""
+}
 
-		MultiStatements: true,
+func (c *StateEncryptionConfig) Validate() error {
+	if c.KeyEnv != "" && c.KMSEncryptedKey != "" {
+		return fmt.Errorf("KeyEnv and KMSEncryptedKey cannot both be specified")
 	}
 
-	if c.TLS != nil {
-		tlsConfig, err := c.TLS.BuildConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to build TLS config: %v", err)
-		}
+	if c.KMSEncryptedKey != "" && c.KMSRegion == "" {
+		return fmt.Errorf("KMSRegion must be specified with KMSEncryptedKey")
+	}
 
-		cfgName := fmt.Sprintf("%s@%s:%s", c.User, c.Host, c.Port)
+	return c.LoadKey()
+}
 
-		err = mysql.RegisterTLSConfig(cfgName, tlsConfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to register TLS config: %v", err)
-		}
+type BlobChunkingConfig struct {
+	// The BLOB and TEXT columns whose contents are transferred in chunks
+	// instead of with the rows of their batch, by SchemaName => TableName =>
+	// ColumnNames. The rows are copied with empty values for these columns,
+	// which are then appended to chunk by chunk in the transaction of the
+	// batch, so neither max_allowed_packet nor the memory of Ghostferry limit
+	// the size of the batches.
+	//
+	// The tables must have a pagination key. Changes replicated from the
+	// binlogs are not affected, and still contain the whole values. The
+	// sinks receive the rows with the whole values as well, read from the
+	// source for each batch.
+	//
+	// Optional: defaults to transferring all columns with their rows
+	Columns map[string]map[string][]string
 
-		cfg.TLSConfig = cfgName
-	}
+	// The number of bytes (of characters for TEXT columns) per chunk.
+	//
+	// Optional: defaults to 1MiB
+	ChunkSize uint64
+}
 
-	return cfg, nil
+func (c *BlobChunkingConfig) Enabled() bool {
+	return len(c.Columns) > 0
 }
 
-func (c *DatabaseConfig) Validate() error {
-	if c.Host == "" {
-		return fmt.Errorf("host is empty")
+func (c *BlobChunkingConfig) Validate() error {
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 1024 * 1024
 	}
 
-	if c.Port == 0 {
-		return fmt.Errorf("port is not specified")
+	return nil
+}
+
+// ColumnsFor returns the columns of the table transferred in chunks
+func (c *BlobChunkingConfig) ColumnsFor(schemaName, tableName string) []string {
+	tableConfig, found := c.Columns[schemaName]
+	if !found {
+		return nil
 	}
 
-	if c.User == "" {
-		return fmt.Errorf("user is empty")
+	return tableConfig[tableName]
+}
+
+type DateTimeConversionConfig struct {
+	// The DATETIME columns whose values are converted from FromTimeZone to
+	// ToTimeZone when they are written to the target, by SchemaName =>
+	// TableName => ColumnNames. Use this when the applications store local
+	// times in DATETIME columns, and the target is used in another time zone.
+	//
+	// The columns cannot be part of the pagination key, and are ignored by
+	// the verifiers as their values differ between the source and the target.
+	//
+	// Optional: defaults to copying all DATETIME values unchanged
+	Columns map[string]map[string][]string
+
+	// The time zones to convert from and to, as offsets such as "+02:00" or
+	// as named time zones such as "Europe/Berlin"
+	FromTimeZone string
+	ToTimeZone   string
+}
+
+func (c *DateTimeConversionConfig) Enabled() bool {
+	return len(c.Columns) > 0
+}
+
+func (c *DateTimeConversionConfig) Validate() error {
+	if c.FromTimeZone == "" || c.ToTimeZone == "" {
+		return fmt.Errorf("FromTimeZone and ToTimeZone must be specified")
 	}
 
-	err := c.assertParamSet("time_zone", "'+00:00'")
-	if err != nil {
-		return err
+	if _, err := loadTimeZone(c.FromTimeZone); err != nil {
+		return fmt.Errorf("invalid FromTimeZone: %v", err)
 	}
 
-	err = c.assertParamSet("sql_mode", "'STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES'")
-	if err != nil {
-		return err
+	if _, err := loadTimeZone(c.ToTimeZone); err != nil {
+		return fmt.Errorf("invalid ToTimeZone: %v", err)
 	}
 
 	return nil
 }
 
-func (c *DatabaseConfig) SqlDB(logger *logrus.Entry) (*sql.DB, error) {
-	dbCfg, err := c.MySQLConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build database config: %s", err)
+// ColumnsFor returns the columns of the table whose values are converted
+func (c *DateTimeConversionConfig) ColumnsFor(schemaName, tableName string) []string {
+	tableConfig, found := c.Columns[schemaName]
+	if !found {
+		return nil
 	}
 
-	if logger != nil {
-		logger.WithField("dsn", MaskedDSN(dbCfg)).Info("connecting to database")
-	}
+	return tableConfig[tableName]
+}
 
-	return sql.Open("mysql", dbCfg.FormatDSN(), c.Marginalia)
+type BinlogEventFilterConfig struct {
+	// The rules by which binlog events of rows are skipped instead of being
+	// written to the target, by SchemaName => TableName => Rules. An event is
+	// skipped if any of the rules of its table matches it. Use this e.g. to
+	// skip updates of counters the target regenerates on its own. Unlike the
+	// CopyFilter, the rows are still copied.
+	//
+	// As the skipped changes are missing on the target, the tables should be
+	// excluded from the verification.
+	//
+	// The tables whose UPDATEs may be skipped must have a pagination key: the
+	// rows on the target then differ from the before images of the later
+	// events, so their UPDATEs and DELETEs match the rows by the pagination
+	// key only. A later UPDATE of a row that is not skipped overwrites the
+	// changes skipped before with the values of the source.
+	//
+	// Optional: defaults to writing all events
+	Rules map[string]map[string][]BinlogEventFilterRule
 }
 
-func (c *DatabaseConfig) assertParamSet(param, value string) error {
-	if c.Params == nil {
-		c.Params = make(map[string]string)
-	}
+type BinlogEventFilterRule struct {
+	// The types of events the rule applies to. Valid choices are:
+	// INSERT
+	// UPDATE
+	// DELETE
+	//
+	// Optional: defaults to all types
+	Events []string
 
-	if c.Params[param] != "" && c.Params[param] != value {
-		return fmt.Errorf("%s must be set to %s", param, value)
-	}
-	c.Params[param] = value
+	// The conditions the row must meet for the rule to match, all of them.
+	// They are evaluated on the row after an INSERT or UPDATE, and on the row
+	// before a DELETE.
+	//
+	// Optional: defaults to no conditions
+	Conditions []BinlogEventFilterCondition
 
-	return nil
+	// If set, the rule only matches an UPDATE if it changed none but these
+	// columns, e.g. only the counters.
+	//
+	// Optional: defaults to matching regardless of the changed columns
+	ChangedColumnsWithin []string
 }
 
-type InlineVerifierConfig struct {
-	// The maximum expected downtime during cutover, in the format of
-	// time.ParseDuration. If nothing is specified, the InlineVerifier will not
-	// try to estimate the downtime and will always allow cutover.
-	MaxExpectedDowntime string
+type BinlogEventFilterCondition struct {
+	Column string
 
-	// The interval at which the periodic binlog reverification occurs, in the
-	// format of time.ParseDuration. Default: 1s.
-	VerifyBinlogEventsInterval string
+	// One of =, !=, <, <=, >, >=, IN, NOT IN, IS NULL, IS NOT NULL
+	Operator string
 
-	verifyBinlogEventsInterval time.Duration
-	maxExpectedDowntime        time.Duration
+	// The value to compare with, or the values for IN and NOT IN. Values are
+	// compared as numbers if both are numeric, and as strings otherwise.
+	Value  string
+	Values []string
 }
 
-func (c *InlineVerifierConfig) Validate() error {
-	var err error
-	if c.MaxExpectedDowntime != "" {
-		c.maxExpectedDowntime, err = time.ParseDuration(c.MaxExpectedDowntime)
-		if err != nil {
-			return err
+func (c *BinlogEventFilterConfig) Enabled() bool {
+	return len(c.Rules) > 0
+}
+
+func (c *BinlogEventFilterConfig) Validate() error {
+	for schemaName, tableRules := range c.Rules {
+		for tableName, rules := range tableRules {
+			for _, rule := range rules {
+				if err := rule.validate(); err != nil {
+					return fmt.Errorf("rule of %s.%s: %v", schemaName, tableName, err)
+				}
+			}
 		}
-	} else {
-		c.maxExpectedDowntime = time.Duration(0)
 	}
+	return nil
+}
 
-	if c.VerifyBinlogEventsInterval == "" {
-		c.VerifyBinlogEventsInterval = "1s"
+func (r *BinlogEventFilterRule) validate() error {
+	for _, event := range r.Events {
+		if !binlogEventFilterEvents[strings.ToUpper(event)] {
+			return fmt.Errorf("invalid event specified (set to %s)", event)
+		}
 	}
 
-	c.verifyBinlogEventsInterval, err = time.ParseDuration(c.VerifyBinlogEventsInterval)
-	if err != nil {
-		return err
+	if len(r.Conditions) == 0 && len(r.ChangedColumnsWithin) == 0 {
+		return fmt.Errorf("Conditions or ChangedColumnsWithin must be specified")
 	}
 
+	for _, condition := range r.Conditions {
+		if condition.Column == "" {
+			return fmt.Errorf("condition without Column specified")
+		}
+
+		switch strings.ToUpper(condition.Operator) {
+		case "=", "!=", "<", "<=", ">", ">=", "IS NULL", "IS NOT NULL":
+		case "IN", "NOT IN":
+			if len(condition.Values) == 0 {
+				return fmt.Errorf("condition on %s requires Values for %s", condition.Column, condition.Operator)
+			}
+		default:
+			return fmt.Errorf("invalid Operator specified (set to %s)", condition.Operator)
+		}
+	}
 	return nil
 }
 
@@ -222,6 +2792,99 @@ type IterativeVerifierConfig struct {
 	// If this is specified, ColumnCompressionConfig should also be filled out in
 	// the main Config.
 	TableColumnCompression TableColumnCompressionConfig
+
+	// Verify the rows of the tables whose copy completed while the binlog
+	// writer is caught up and the throttler allows it, spreading the
+	// verification over the copy instead of verifying all rows before the
+	// cutover.
+	//
+	// Optional: defaults to verifying all rows before the cutover
+	IdleVerification *IdleVerificationConfig
+}
+
+type IdleVerificationConfig struct {
+	// Rows are only verified while the apply lag of the binlog writer is at
+	// most this, in the format of time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	MaxLag string
+
+	// How often the apply lag is checked again while it is above MaxLag, in
+	// the format of time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	CheckInterval string
+
+	maxLag        time.Duration
+	checkInterval time.Duration
+}
+
+func (c *IdleVerificationConfig) Validate() error {
+	if c.MaxLag == "" {
+		c.MaxLag = "1s"
+	}
+	if c.CheckInterval == "" {
+		c.CheckInterval = "1s"
+	}
+
+	var err error
+	c.maxLag, err = time.ParseDuration(c.MaxLag)
+	if err != nil {
+		return fmt.Errorf("invalid MaxLag specified: %v", err)
+	}
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
+}
+
+type SamplingVerifierConfig struct {
+	// The percentage of the ranges of pagination keys of each table that are
+	// verified, greater than 0 and at most 100.
+	//
+	// Optional: defaults to 1
+	SamplePercentage float64
+
+	// The number of pagination keys per range.
+	//
+	// Optional: defaults to 1000
+	RangeSize uint64
+
+	// The confidence level of the intervals of the mismatch rates reported,
+	// greater than 0 and less than 1.
+	//
+	// Optional: defaults to 0.95
+	ConfidenceLevel float64
+
+	// The seed of the random sample, to verify the same ranges again.
+	//
+	// Optional: defaults to a random seed, which is logged
+	Seed int64
+}
+
+func (c *SamplingVerifierConfig) Validate() error {
+	if c.SamplePercentage == 0 {
+		c.SamplePercentage = 1
+	} else if c.SamplePercentage < 0 || c.SamplePercentage > 100 {
+		return fmt.Errorf("invalid SamplePercentage specified (set to %v)", c.SamplePercentage)
+	}
+
+	if c.RangeSize == 0 {
+		c.RangeSize = 1000
+	}
+
+	if c.ConfidenceLevel == 0 {
+		c.ConfidenceLevel = 0.95
+	} else if c.ConfidenceLevel < 0 || c.ConfidenceLevel >= 1 {
+		return fmt.Errorf("invalid ConfidenceLevel specified (set to %v)", c.ConfidenceLevel)
+	}
+
+	return nil
 }
 
 func (c *IterativeVerifierConfig) Validate() error {
@@ -232,6 +2895,12 @@ func (c *IterativeVerifierConfig) Validate() error {
 		}
 	}
 
+	if c.IdleVerification != nil {
+		if err := c.IdleVerification.Validate(); err != nil {
+			return fmt.Errorf("IdleVerification invalid: %v", err)
+		}
+	}
+
 	if c.Concurrency == 0 {
 		c.Concurrency = 4
 	}
@@ -283,12 +2952,33 @@ type CascadingPaginationColumnConfig struct {
 	// PerTable has greatest specificity and takes precedence over the other options
 	FullTableCopies map[string][]string // SchemaName => TableNames
 
-	// PerTable has next greatest specificity and takes precedence over the other options
+	// PerTable has next greatest specificity and takes precedence over the other options.
+	// The column does not need to be part of the Primary Key, but should be the first
+	// column of an index, and either auto-increment or the only column of a unique index:
+	// batches are selected by a full table scan otherwise, and rows sharing a value may
+	// be skipped between batches.
 	PerTable map[string]map[string]string // SchemaName => TableName => ColumnName
 
+	// Only log a warning if a PerTable column is not indexed or not unique, instead of
+	// failing to load the tables. Only to be set if the table is known to be paginated
+	// correctly regardless, e.g. if its rows never share a value of the column.
+	//
+	// Optional: defaults to false
+	AllowUnsafePerTable bool
+
 	// FallbackColumn is a global default to fallback to and is less specific than the
 	// default, which is the Primary Key
 	FallbackColumn string
+
+	// IndexHints forces the index used by the row-copy SELECTs of a table, for tables on
+	// which the optimizer picks a poor index for the range scans of the pagination.
+	IndexHints map[string]map[string]string // SchemaName => TableName => IndexName
+
+	// Force the index of the pagination key in the row-copy SELECTs of all tables without
+	// IndexHints, if the pagination key is a prefix of an index.
+	//
+	// Optional: defaults to false
+	ForcePaginationKeyIndex bool
 }
 
 func (c *CascadingPaginationColumnConfig) IsFullCopyTable(schemaName, tableName string) bool {
@@ -328,6 +3018,16 @@ func (c *CascadingPaginationColumnConfig) PaginationColumnFor(schemaName, tableN
 	return column, true
 }
 
+// IndexHintFor is a helper function to retrieve the index to force for the table
+func (c *CascadingPaginationColumnConfig) IndexHintFor(schemaName, tableName string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	index, found := c.IndexHints[schemaName][tableName]
+	return index, found
+}
+
 // FallbackPaginationColumnName retreives the column name specified as a fallback when the Primary Key isn't suitable for pagination
 func (c *CascadingPaginationColumnConfig) FallbackPaginationColumnName() (string, bool) {
 	if c == nil || c.FallbackColumn == "" {
@@ -368,6 +3068,24 @@ type Config struct {
 	// Optional: defaults to 5.
 	DBWriteRetries int
 
+	// The maximum number of prepared statements cached by each of the batch
+	// writer and the inline verifier (per database). The least recently used
+	// statements are dropped once more are needed, and closed once they are
+	// no longer in use, which keeps the number of prepared statements below
+	// max_prepared_stmt_count of the servers when copying many tables. Set to
+	// -1 to not limit the caches.
+	//
+	// Optional: defaults to 1000
+	StmtCacheSize int
+
+	// Controls how failed writes to the target database are retried,
+	// depending on the type of error encountered. See RetryPolicyConfig.
+	WriteRetryPolicy RetryPolicyConfig
+
+	// How the components react to the errors they cannot recover from, see
+	// ErrorPolicyConfig.
+	ErrorPolicy ErrorPolicyConfig
+
 	// Filter out the databases/tables when detecting the source databases
 	// and tables.
 	//
@@ -386,6 +3104,14 @@ type Config struct {
 	// Optional: defaults to an automatically generated one
 	MyServerId uint32
 
+	// The range (inclusive) from which the server id is chosen at random if
+	// MyServerId is not specified, e.g. to keep the ids of ferries apart
+	// from the ids of real replicas.
+	//
+	// Optional: defaults to 1 and 4294967295
+	MyServerIdMin uint32
+	MyServerIdMax uint32
+
 	// The maximum number of binlog events to write at once. Note this is a
 	// maximum: if there are not a lot of binlog events, they will be written
 	// one at a time such the binlog streamer lag is as low as possible. This
@@ -394,6 +3120,25 @@ type Config struct {
 	// Optional: defaults to 100
 	BinlogEventBatchSize int
 
+	// An identifier of the run, attached to all metrics as the "run_id" tag
+	// along with the "phase" tag of the current state of the run, e.g. to
+	// tell several migrations apart in the dashboards.
+	//
+	// Optional: defaults to no run_id tag
+	RunId string
+
+	// Where to emit the metrics, see MetricsConfig.
+	//
+	// Optional: defaults to the metrics set up by the application, if any
+	Metrics MetricsConfig
+
+	// Additional tags attached to the apply latency and batch size histograms
+	// emitted by the binlog writer, e.g. to distinguish several replicatedb
+	// instances when alerting on replication lag.
+	//
+	// Optional: defaults to no additional tags
+	BinlogWriterMetricTags map[string]string
+
 	// The batch size used to iterate the data during data copy. This batch size
 	// is always used: if this is specified to be 100, 100 rows will be copied
 	// per iteration.
@@ -406,6 +3151,47 @@ type Config struct {
 	// Optional: defaults to 200
 	DataIterationBatchSize uint64
 
+	// The approximate maximum number of bytes of rows held in memory per
+	// batch during data copy. If set, the rows of a batch are read and
+	// written to the target incrementally, in several transactions of about
+	// this many bytes each, while the rows of the batch stay locked on the
+	// source. This allows copying tables with large BLOB or TEXT columns
+	// without lowering DataIterationBatchSize for all tables.
+	//
+	// Only applies to tables with a pagination key.
+	//
+	// Optional: defaults to holding all rows of a batch in memory
+	DataIterationBatchMaxBytes uint64
+
+	// The isolation level of the transactions of the data copy on the source,
+	// as set on the connections of the data iterator, which get a pool of
+	// their own with the settings of Source.ComponentConnectionPools, see
+	// Config.DataIteratorConnectionPool. Valid choices are:
+	// - "REPEATABLE READ": as the default of MySQL, which keeps the gaps
+	//   between the rows read locked as well with LockStrategy
+	//   LockOnSourceDB,
+	// - "READ COMMITTED": lock the rows read only, and do not hold back the
+	//   purge of the source for longer than a statement.
+	//
+	// The transactions of a ConsistentSnapshot are always REPEATABLE READ.
+	// Requires MySQL 5.7.20 or later.
+	//
+	// Optional: defaults to the isolation level of the source
+	DataIterationIsolationLevel string
+
+	// How the rows read are locked with LockStrategy LockOnSourceDB. Valid
+	// choices are:
+	// - "exclusive": SELECT ... FOR UPDATE, blocking the locking reads of
+	//   other transactions as well,
+	// - "shared": SELECT ... LOCK IN SHARE MODE, blocking the writes to the
+	//   rows only.
+	//
+	// Locking reads are avoided altogether with LockStrategy LockInGhostferry
+	// or None.
+	//
+	// Optional: defaults to "exclusive"
+	DataIterationRowLock string
+
 	// The maximum number of retries for reads if the reads fail on the source
 	// database.
 	//
@@ -415,12 +3201,23 @@ type Config struct {
 	// This specify the number of concurrent goroutines, each iterating over
 	// a single table.
 	//
-	// At this point in time, parallelize iteration within a single table. This
-	// may be possible to add to the future.
+	// The iteration within a single table is only parallelized for the tables
+	// split by KeyRangeSplit.
 	//
 	// Optional: defaults to 4
 	DataIterationConcurrency int
 
+	// The number of tables copied concurrently by delta copies, see
+	// Ferry.RunResumableDataCopy.
+	//
+	// Optional: defaults to DataIterationConcurrency
+	DeltaCopyConcurrency int
+
+	// How the size of the copy is projected at startup, see SizingReport.
+	//
+	// Optional: defaults to 100ms per batch
+	Sizing SizingConfig
+
 	// If set to true, copy data by paginating in reverse order of the
 	// pagination key.
 	//
@@ -449,6 +3246,34 @@ type Config struct {
 	// Optional: defaults to false
 	DelayDataIterationUntilBinlogWriterShutdown bool
 
+	// If true, the rows are copied from a consistent snapshot of the source,
+	// like mysqldump --single-transaction: the copy connections start their
+	// transactions WITH CONSISTENT SNAPSHOT while the source is briefly locked
+	// with FLUSH TABLES WITH READ LOCK, which requires the RELOAD privilege.
+	// The rows are not locked while they are copied, and the binlogs are only
+	// streamed once the copy is done, starting at the position of the
+	// snapshot.
+	//
+	// This reduces the load on the source, but the binlogs written during the
+	// copy must still be available once it is done. The snapshot is not used
+	// when resuming.
+	//
+	// Optional: defaults to false
+	ConsistentSnapshot bool
+
+	// How the source is locked while the ConsistentSnapshot is taken:
+	//
+	// - flush_tables: with FLUSH TABLES WITH READ LOCK, which waits for long
+	//   running queries on the source to finish, and meanwhile blocks all
+	//   writes.
+	// - backup: with LOCK INSTANCE FOR BACKUP and read locks of the copied
+	//   tables only, reading the coordinates from
+	//   performance_schema.log_status. This requires MySQL 8.0, and the
+	//   BACKUP_ADMIN and LOCK TABLES privileges instead of RELOAD.
+	//
+	// Optional: defaults to flush_tables
+	ConsistentSnapshotLock string
+
 	// This specifies if the data-iteration should temporarily delay failing on
 	// copy errors until all tables have at least been attempted to be copied.
 	// Errors are still raised, we simply give the copy the opportunity to copy
@@ -469,16 +3294,93 @@ type Config struct {
 	// Optional: defaults to false
 	DisableCutover bool
 
+	// When the binlog streaming is considered caught up with the source,
+	// before the source is set read only for the cutover, see CatchUpConfig.
+	CatchUp CatchUpConfig
+
 	// If true, parse and propagate DB schema changes from the source
 	// to the target. This is currently in alpha and does not support
 	// all the features of ghostferry, such as
 	// - table filters (we don't know if a newly created table should
 	//   be generated), or
-	// - database/table name rewrites
+	// - database/table name rewrites (database rewrites are supported if
+	//   DDLRewrites is set)
 	//
 	// Optional: defaults to false
 	ReplicateSchemaChanges bool
 
+	// Periodically look for applicable tables created on the source since the
+	// run started, e.g. as ReplicateSchemaChanges is disabled, and copy them,
+	// see TableDiscoveryConfig.
+	//
+	// Optional: defaults to disabled
+	TableDiscovery TableDiscoveryConfig
+
+	// Adapt schema changes before applying them to the target, e.g. to
+	// replace storage engines not available on the target. If set, the
+	// DatabaseRewrites are also applied to the database names referenced in
+	// schema changes.
+	//
+	// Optional: defaults to applying schema changes unmodified
+	DDLRewrites *DDLRewriteConfig
+
+	// Schema changes that must never be applied to the target when
+	// replicating schema changes, e.g. to protect the target against an
+	// accidental DROP TABLE on the source.
+	//
+	// Optional: defaults to applying all schema changes
+	DDLDenylist DDLDenylistConfig
+
+	// Record the schema changes, and optionally all binlog transactions,
+	// applied to the target with their source binlog position and outcome.
+	//
+	// Optional: defaults to disabled
+	AuditLog AuditLogConfig
+
+	// Maintain a table on the target mapping the applied source binlog
+	// positions to the binlog coordinates of the target, e.g. to attach
+	// native replication or for point-in-time recovery after the ferry
+	// stops.
+	//
+	// Optional: defaults to disabled
+	PositionMap PositionMapConfig
+
+	// Hand off the replication of the source to native MySQL replication of
+	// the target once the binlog streaming is stopped, see
+	// Ferry.HandoffToNativeReplication.
+	//
+	// Optional: defaults to disabled
+	NativeReplicationHandoff NativeReplicationHandoffConfig
+
+	// Seed the target from existing logical dump files instead of copying
+	// the rows from the source, see Ferry.LoadDump.
+	//
+	// Optional: defaults to copying the rows from the source
+	DumpLoad DumpLoadConfig
+
+	// Stream the binlogs from a given position of the source instead of
+	// copying the rows, see Ferry.StartFromPosition.
+	//
+	// Optional: defaults to copying the rows from the source
+	StartPosition StartPositionConfig
+
+	// Transfer the contents of large BLOB and TEXT columns in chunks during
+	// the data copy.
+	//
+	// Optional: defaults to disabled
+	BlobChunking BlobChunkingConfig
+
+	// Convert the values of DATETIME columns between time zones while they
+	// are copied.
+	//
+	// Optional: defaults to disabled
+	DateTimeConversion DateTimeConversionConfig
+
+	// Skip the binlog events of rows matching per-table rules.
+	//
+	// Optional: defaults to disabled
+	BinlogEventFilter BinlogEventFilterConfig
+
 	// For migrating data, it is crucial that we're either reading from a master
 	// or from a slave that is up-to-date with its master. If we are just
 	// continuously replicating/streaming data, it's OK to work on an outdated
@@ -487,6 +3389,17 @@ type Config struct {
 	// Optional: defaults to false
 	AllowReplicationFromReplica bool
 
+	// Verify at startup that all connections to the source are granted only
+	// the privileges required to copy from it: SELECT, REPLICATION SLAVE and
+	// REPLICATION CLIENT. Ghostferry fails to start with the list of missing
+	// and excessive privileges otherwise, such that it provably cannot write
+	// to the source. Requires a LockStrategy not locking the rows of the
+	// source, and is incompatible with ConsistentSnapshot, which locks the
+	// tables of the source.
+	//
+	// Optional: defaults to false
+	ReadOnlySource bool
+
 	// This specifies how to prevent races between the data copy and binlog
 	// streaming. Possible values are:
 	// - LockOnSourceDB: obtain a table lock on the source table while copying
@@ -514,6 +3427,18 @@ type Config struct {
 	// leave a previously existing state file intact
 	StateFilename string
 
+	// The number of binlog events included in the dumped state: the last
+	// events applied to the target (with their statements) and the first
+	// events received but not applied yet. This makes post-mortems of
+	// replication failures possible without reading the source binlogs.
+	//
+	// Optional: defaults to 0, not including any events
+	StateDumpBinlogEvents int
+
+	// Encrypt the state written to the StateFilename, dumped to stdout or
+	// sent to the ErrorCallback, see StateEncryptionConfig.
+	StateEncryption StateEncryptionConfig
+
 	// Config for the ControlServer
 	ServerBindAddr string
 	WebBasedir     string
@@ -524,6 +3449,11 @@ type Config struct {
 	ProgressCallback        HTTPCallback
 	ProgressReportFrequency int
 
+	// Call HTTP callbacks around the completion of the copy of each table.
+	//
+	// Optional: defaults to no callbacks
+	TableCopyHooks TableCopyHooksConfig
+
 	// The state to resume from as dumped by the PanicErrorHandler.
 	// If this is null, a new Ghostferry run will be started. Otherwise, the
 	// reconciliation process will start and Ghostferry will resume after that.
@@ -537,6 +3467,66 @@ type Config struct {
 	// database
 	ResumeStateFromDB string
 
+	// How to handle resuming a run with a config that differs from the one
+	// the run was started with, in the parts deciding which rows are copied
+	// where: the TableFilter and CopyFilter, the DatabaseRewrites and
+	// TableRewrites and the CascadingPaginationColumnConfig. A fingerprint of
+	// these is kept in the state, see Ferry.ConfigFingerprint:
+	//
+	// - "fail": refuse to resume
+	// - "warn": log a warning
+	//
+	// States without fingerprint, e.g. of earlier versions, are not checked,
+	// nor are filters not implementing ConfigFingerprinter.
+	//
+	// Optional: defaults to "fail"
+	ResumeConfigMismatchPolicy string
+
+	// Copy single tables again from scratch when resuming a run.
+	//
+	// Optional: defaults to none
+	TableRecopy TableRecopyConfig
+
+	// The tables whose rows are not copied, as schema.table on the source,
+	// e.g. large tables backfilled on the target by other means. Their binlog
+	// events and schema changes are applied like those of the copied tables,
+	// and they are reported as stream-only in the state and the progress.
+	// They are neither verified nor validated at the cutover, their
+	// AUTO_INCREMENT is not synced, and their UPDATEs and DELETEs matching no
+	// rows are not handled by the UnmatchedDMLPolicy.
+	//
+	// Optional: defaults to none
+	StreamOnlyTables []string
+
+	// Copy large tables in several ranges of their pagination keys
+	// concurrently, see KeyRangeSplitConfig.
+	//
+	// Optional: defaults to copying each table with a single cursor
+	KeyRangeSplit KeyRangeSplitConfig
+
+	// Share the row copy between several processes, see
+	// DistributedCopyConfig.
+	//
+	// Optional: defaults to copying all tables in this process
+	DistributedCopy DistributedCopyConfig
+
+	// Periodically record the progress into the _progress_history table next
+	// to the state tables in the ResumeStateFromDB, to reconstruct the
+	// throughput of the run after a crash. The history is served by the
+	// ControlServer on /api/progress/history.
+	//
+	// Optional: defaults to disabled
+	ProgressHistory ProgressHistoryConfig
+
+	// Count the binlog events applied to each table, with the time the last
+	// one was written on the source and applied, in the
+	// _binlog_events_applied table next to the state tables in the
+	// ResumeStateFromDB. The counts are updated in the transactions applying
+	// the events.
+	//
+	// Optional: defaults to false
+	RecordAppliedBinlogEvents bool
+
 	// Enforce writing binlog writer position updates into the "resume-state
 	// DB" on every write to the DB (using a transaction). In most cases, this
 	// is not required, as double-applying data updates is safe.
@@ -549,6 +3539,8 @@ type Config struct {
 	// The verifier to use during the run. Valid choices are:
 	// ChecksumTable
 	// Iterative
+	// Inline
+	// Sampling
 	// NoVerification
 	//
 	// If it is left blank, the Verifier member variable on the Ferry will be
@@ -565,10 +3557,235 @@ type Config struct {
 	// This specifies the configurations to the InlineVerifierConfig.
 	InlineVerifierConfig InlineVerifierConfig
 
+	// Only useful if VerifierType == Sampling.
+	// This specifies the configurations to the SamplingVerifier, which
+	// verifies a random sample of the rows of each table. The tables and
+	// columns ignored by the IterativeVerifierConfig are ignored as well.
+	SamplingVerifierConfig SamplingVerifierConfig
+
+	// What to do if the columns (names, types, charsets, nullability) or keys
+	// of a table differ between source and target when the run starts. Valid
+	// choices are:
+	// fail
+	// warn
+	// ignore
+	//
+	// The check is skipped in BenchmarkMode. With "warn", a failure to read
+	// the schemas is logged as well instead of failing the run.
+	//
+	// Optional: defaults to "warn"
+	SchemaDriftAction string
+
+	// After a schema change of a copied table was applied to the target and
+	// its schema reloaded from there, compare the table with the source as
+	// well, and fail the run if they differ. This detects a schema change
+	// that failed or only partially applied on the target before writes to
+	// the table fail.
+	//
+	// The source is read at the time of the reload, so a table changed again
+	// on the source in the meantime is reported as differing as well.
+	//
+	// Optional: defaults to false
+	SchemaDriftCheckOnReload bool
+
+	// Detect writes to the copied tables on the target that do not originate
+	// from Ghostferry while the run is in progress.
+	//
+	// Optional: defaults to disabled
+	ForeignWriteGuard ForeignWriteGuardConfig
+
+	// Validate the state of the source and target before the cutover.
+	//
+	// Optional: defaults to disabled
+	CutoverValidation CutoverValidationConfig
+
+	// Advance the AUTO_INCREMENT values of the target to the ones of the
+	// source before the cutover.
+	//
+	// Optional: defaults to disabled
+	AutoIncrementSync AutoIncrementSyncConfig
+
+	// Prevent concurrent ferries for the same source and target.
+	//
+	// Optional: defaults to disabled
+	RunLock RunLockConfig
+
+	// Pause the writes to the target while it runs low on disk space or
+	// connections, and resume them once it recovered.
+	//
+	// Optional: defaults to disabled
+	TargetGuard TargetGuardConfig
+
+	// Throttle the reads of the data copy from the source on the lag queried
+	// by a LagThrottler, e.g. the replication lag of the replicas of the
+	// source. Ignored if the Ferry is given a MigrationThrottler.
+	//
+	// Optional: defaults to no throttling
+	ReadThrottle *LagThrottlerConfig
+
+	// Throttle the writes to the target, both of the data copy and of the
+	// binlog writer, on the lag queried by a LagThrottler, e.g. the
+	// replication lag of the replicas of the target. Ignored for the write
+	// paths the Ferry is given a throttler for.
+	//
+	// Optional: defaults to no throttling
+	WriteThrottle *LagThrottlerConfig
+
+	// Kill the long-running reads of the data copy on the source while the
+	// copy stays throttled, rather than letting them run to completion.
+	//
+	// Optional: defaults to disabled
+	QueryKiller QueryKillerConfig
+
+	// Notify Slack and/or PagerDuty of the lifecycle events of the run.
+	//
+	// Optional: defaults to no notifications
+	Notifications NotificationsConfig
+
+	// Alert on the lag between a binlog event being written on the source
+	// and it being applied to the target.
+	//
+	// Optional: defaults to disabled
+	LagAlert LagAlertConfig
+
+	// Alert when the binlogs needed to resume the run are about to be purged
+	// from the source.
+	//
+	// Optional: defaults to disabled
+	BinlogRetention BinlogRetentionConfig
+
+	// Do not replicate the writes of a given user on the source, to prevent
+	// replication loops when replicating in both directions.
+	//
+	// Optional: defaults to disabled
+	LoopPrevention LoopPreventionConfig
+
+	// Maintain an analytic replica of the copied tables in ClickHouse,
+	// alongside or instead of the target.
+	//
+	// Optional: defaults to disabled
+	ClickHouseSink ClickHouseSinkConfig
+
+	// Run the full read path (data iteration and binlog streaming) but discard
+	// all writes instead of applying them to the target, and report the
+	// achievable read throughput once the data copy completes. This is useful
+	// to size maintenance windows before touching the target.
+	//
+	// Benchmark mode cannot be combined with verifiers, schema change
+	// replication or resuming state from the target DB, as all of these
+	// require writing to or reading from the target.
+	//
+	// Optional: defaults to false
+	BenchmarkMode bool
+
 	// For old versions mysql<5.6.2, MariaDB<10.1.6 which has no related var
 	// Make sure you have binlog_row_image=FULL when turning on this
 	SkipBinlogRowImageCheck bool
 
+	// Allow replicating from a source with binlog_row_image=MINIMAL or NOBLOB.
+	// Binlog events are then applied using only the columns present in the
+	// row images: rows are identified by their primary key and only the
+	// changed columns are updated. Columns missing from an inserted row get
+	// the default value of the target table, which must therefore match the
+	// source.
+	//
+	// This is not supported together with a CopyFilter that inspects columns
+	// other than the primary key, such as the sharding filter.
+	//
+	// Optional: defaults to false
+	AllowMinimalBinlogRowImage bool
+
+	// How to handle gh-ost or pt-online-schema-change migrating a copied
+	// table on the source, if ReplicateSchemaChanges is enabled:
+	//
+	// - "ignore": handle the statements of the migration like any other
+	//   schema change
+	// - "abort": fail as soon as the migration is detected
+	// - "pause": pause replication at the cut-over of the migration, such
+	//   that the same migration can be applied to the target manually before
+	//   resuming replication (e.g. via the control server)
+	// - "follow": apply the migration to the target at the cut-over
+	//
+	// Optional: defaults to "ignore"
+	OnlineSchemaChangePolicy string
+
+	// How to handle an UPDATE on the source that changes the pagination key
+	// of a row of a table while it is being copied. Such an update can move
+	// the row behind the cursor of the copy before it was copied, leaving it
+	// missing from the target:
+	//
+	// - "ignore": apply the update as any other
+	// - "warn": log a warning and count it in the "PaginationKeyChange" metric
+	// - "abort": fail as soon as such an update is seen
+	// - "recopy": copy the row again from the source at its new pagination
+	//   key after applying the update
+	//
+	// Optional: defaults to "warn"
+	PaginationKeyChangePolicy string
+
+	// How to handle an UPDATE or DELETE from the binlogs that matches no row
+	// on the target, even though the row was copied already. Re-applied
+	// events are idempotent as such statements are no-ops, but so is a
+	// change of a row whose image on the target differs from the source,
+	// which goes unnoticed otherwise:
+	//
+	// - "ignore": apply the events as any other
+	// - "log": log the events with their positions, and count them in the
+	//   "BinlogWriter.UnmatchedDML" metric
+	// - "repair": as "log", and delete the row on the target and copy it
+	//   again from the source, in the transaction of the events
+	// - "fail": as "log", and fail the run
+	//
+	// Only the events written to the source after their table completed its
+	// copy are checked, as the earlier ones may already be reflected by the
+	// copied rows. The events applied again after resuming a run match no row
+	// either, so they are reported as well.
+	//
+	// Optional: defaults to "ignore"
+	UnmatchedDMLPolicy string
+
+	// If set, the rows affected by each statement applying a binlog event are
+	// read back in the transaction of the events. They are compared with the
+	// rows expected to be affected for the events written to the source after
+	// their table completed its copy, as one for each event changing the
+	// values of a row. The totals are counted in the
+	// "BinlogWriter.RowsAffected" metric and logged with the verbose logging,
+	// the differences in "BinlogWriter.RowsAffectedAnomaly" tagged by table,
+	// statement type and whether fewer or more rows were affected.
+	//
+	// Always enabled with an UnmatchedDMLPolicy other than "ignore".
+	//
+	// Optional: defaults to false
+	RowsAffectedAccounting bool
+
+	// How to handle triggers on the copied tables of the target, e.g. as
+	// restored from a dump. These fire again on the rows copied and the
+	// binlog events applied by Ghostferry, on top of the rows their source
+	// counterparts wrote already. MySQL cannot disable triggers for a
+	// session, so they can only be dropped:
+	//
+	// - "warn": log a warning
+	// - "fail": refuse to start
+	// - "drop": drop them on start and create them again before the cutover
+	//   of copydb and sharding. The dropped triggers are kept in the state to
+	//   resume from, and the statements recorded in the AuditLog, if enabled.
+	//   Meanwhile, they do not fire for other writers of the target either.
+	//
+	// Optional: defaults to "warn"
+	TargetTriggerPolicy string
+
+	// If set, the writes of Ghostferry to the target are not written to the
+	// binlogs of the target, by setting sql_log_bin to 0 on all connections
+	// to the target. This keeps a large migration from filling the binlog
+	// storage of the target, and its replicas from replaying it. It requires
+	// the SUPER or the SYSTEM_VARIABLES_ADMIN privilege on the target.
+	//
+	// NOTE: The replicas of the target do not receive the copied rows and the
+	// binlog events applied, so a warning is logged if the target has any.
+	//
+	// Optional: defaults to false
+	SkipTargetBinlog bool
+
 	// This config is necessary for inline verification for a special case of
 	// Ghostferry:
 	//
@@ -605,7 +3822,7 @@ type Config struct {
 
 	// Ghostferry requires a single numeric column to paginate over tables. Inferring that column is done in the following exact order:
 	// 1. Find the table in the FullCopyTables list and perform non-paginated copies (only reasonable for small tables).
-	// 2. Use the PerTable pagination column, if configured for a table. Fail if we cannot find this column in the table.
+	// 2. Use the PerTable pagination column, if configured for a table. Fail if we cannot find this column in the table, or if it is not indexed and unique unless AllowUnsafePerTable is set.
 	// 3. Use the table's primary key column as the pagination column. Fail if the primary key is not numeric or is a composite key without a FallbackColumn specified.
 	// 4. Use the FallbackColumn pagination column, if configured. Fail if we cannot find this column in the table.
 	CascadingPaginationColumnConfig *CascadingPaginationColumnConfig
@@ -616,10 +3833,39 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("source: %s", err)
 	}
 
+	if c.Target != nil && c.Target.SQLMode == "" {
+		c.Target.SQLMode = DefaultTargetSQLMode
+	}
 	if err := c.Target.Validate(); err != nil {
 		return fmt.Errorf("target: %s", err)
 	}
 
+	if c.SkipTargetBinlog {
+		if err := c.Target.assertParamSet("sql_log_bin", "0"); err != nil {
+			return fmt.Errorf("target: SkipTargetBinlog invalid: %v", err)
+		}
+		for _, pool := range c.Target.connectionPools() {
+			if value, found := pool.SessionVariables["sql_log_bin"]; found && value != "0" {
+				return fmt.Errorf("target: SkipTargetBinlog cannot be combined with SessionVariables setting sql_log_bin")
+			}
+		}
+	}
+
+	// TIMESTAMP values are stored in UTC, and converted from and to the time
+	// zone of the session
+	if c.Source.TimeZone != c.Target.TimeZone {
+		return fmt.Errorf("Source and Target must use the same TimeZone, TIMESTAMP values would change otherwise (set to %s and %s)", c.Source.TimeZone, c.Target.TimeZone)
+	}
+
+	if c.Source.ComponentCredentials.writersConfigured() {
+		return fmt.Errorf("source: ComponentCredentials is only supported for the target, except for the BinlogStreamer")
+	}
+
+	// the binlog replication protocol only supports password authentication
+	if c.Source.IAMAuthRegion != "" && c.Source.ComponentCredentials.BinlogStreamer == nil {
+		return fmt.Errorf("source: IAMAuthRegion requires ComponentCredentials.BinlogStreamer, as binlog streaming requires password authentication")
+	}
+
 	if c.TableFilter == nil {
 		return fmt.Errorf("Table filter function must be provided")
 	}
@@ -633,9 +3879,22 @@ func (c *Config) ValidateConfig() error {
 		}
 	}
 
+	if c.MyServerIdMin == 0 {
+		c.MyServerIdMin = 1
+	}
+	if c.MyServerIdMax == 0 {
+		c.MyServerIdMax = math.MaxUint32
+	}
+	if c.MyServerIdMin > c.MyServerIdMax {
+		return fmt.Errorf("MyServerIdMin (%d) must not be greater than MyServerIdMax (%d)", c.MyServerIdMin, c.MyServerIdMax)
+	}
+
 	if c.ReplicateSchemaChanges {
-		if (len(c.TableRewrites) > 0 || len(c.DatabaseRewrites) > 0) {
-			return fmt.Errorf("Replicating schema changes with database or table rewrites is not supported")
+		if len(c.TableRewrites) > 0 {
+			return fmt.Errorf("Replicating schema changes with table rewrites is not supported")
+		}
+		if len(c.DatabaseRewrites) > 0 && c.DDLRewrites == nil {
+			return fmt.Errorf("Replicating schema changes with database rewrites requires DDLRewrites")
 		}
 
 		if c.VerifierType != "" && c.VerifierType != VerifierTypeNoVerification {
@@ -643,14 +3902,76 @@ func (c *Config) ValidateConfig() error {
 		}
 	}
 
+	if c.BenchmarkMode {
+		if c.VerifierType != "" && c.VerifierType != VerifierTypeNoVerification {
+			return fmt.Errorf("BenchmarkMode is incompatible with data verification (set to %s)", c.VerifierType)
+		}
+
+		if c.ReplicateSchemaChanges {
+			return fmt.Errorf("BenchmarkMode is incompatible with ReplicateSchemaChanges")
+		}
+
+		if c.ResumeStateFromDB != "" {
+			return fmt.Errorf("BenchmarkMode is incompatible with ResumeStateFromDB")
+		}
+	}
+
 	if c.VerifierType == VerifierTypeIterative {
 		if err := c.IterativeVerifierConfig.Validate(); err != nil {
 			return fmt.Errorf("IterativeVerifierConfig invalid: %v", err)
 		}
+		if c.IterativeVerifierConfig.IdleVerification != nil && c.IterateInDescendingOrder {
+			return fmt.Errorf("IdleVerification is not supported with IterateInDescendingOrder")
+		}
 	} else if c.VerifierType == VerifierTypeInline {
 		if err := c.InlineVerifierConfig.Validate(); err != nil {
 			return fmt.Errorf("InlineVerifierConfig invalid: %v", err)
 		}
+	} else if c.VerifierType == VerifierTypeSampling {
+		if err := c.IterativeVerifierConfig.Validate(); err != nil {
+			return fmt.Errorf("IterativeVerifierConfig invalid: %v", err)
+		}
+		if err := c.SamplingVerifierConfig.Validate(); err != nil {
+			return fmt.Errorf("SamplingVerifierConfig invalid: %v", err)
+		}
+	}
+
+	if c.SchemaDriftAction == "" {
+		c.SchemaDriftAction = SchemaDriftActionWarn
+	} else if c.SchemaDriftAction != SchemaDriftActionFail && c.SchemaDriftAction != SchemaDriftActionWarn && c.SchemaDriftAction != SchemaDriftActionIgnore {
+		return fmt.Errorf("Invalid SchemaDriftAction specified (set to %s)", c.SchemaDriftAction)
+	}
+
+	if c.OnlineSchemaChangePolicy == "" {
+		c.OnlineSchemaChangePolicy = OnlineSchemaChangePolicyIgnore
+	} else if c.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyIgnore && c.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyAbort && c.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyPause && c.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyFollow {
+		return fmt.Errorf("Invalid OnlineSchemaChangePolicy specified (set to %s)", c.OnlineSchemaChangePolicy)
+	} else if c.OnlineSchemaChangePolicy != OnlineSchemaChangePolicyIgnore && !c.ReplicateSchemaChanges {
+		return fmt.Errorf("OnlineSchemaChangePolicy %s requires ReplicateSchemaChanges", c.OnlineSchemaChangePolicy)
+	}
+
+	if c.PaginationKeyChangePolicy == "" {
+		c.PaginationKeyChangePolicy = PaginationKeyChangePolicyWarn
+	} else if c.PaginationKeyChangePolicy != PaginationKeyChangePolicyIgnore && c.PaginationKeyChangePolicy != PaginationKeyChangePolicyWarn && c.PaginationKeyChangePolicy != PaginationKeyChangePolicyAbort && c.PaginationKeyChangePolicy != PaginationKeyChangePolicyRecopy {
+		return fmt.Errorf("Invalid PaginationKeyChangePolicy specified (set to %s)", c.PaginationKeyChangePolicy)
+	}
+
+	if c.UnmatchedDMLPolicy == "" {
+		c.UnmatchedDMLPolicy = UnmatchedDMLPolicyIgnore
+	} else if c.UnmatchedDMLPolicy != UnmatchedDMLPolicyIgnore && c.UnmatchedDMLPolicy != UnmatchedDMLPolicyLog && c.UnmatchedDMLPolicy != UnmatchedDMLPolicyRepair && c.UnmatchedDMLPolicy != UnmatchedDMLPolicyFail {
+		return fmt.Errorf("Invalid UnmatchedDMLPolicy specified (set to %s)", c.UnmatchedDMLPolicy)
+	}
+
+	if c.ResumeConfigMismatchPolicy == "" {
+		c.ResumeConfigMismatchPolicy = ResumeConfigMismatchPolicyFail
+	} else if c.ResumeConfigMismatchPolicy != ResumeConfigMismatchPolicyFail && c.ResumeConfigMismatchPolicy != ResumeConfigMismatchPolicyWarn {
+		return fmt.Errorf("Invalid ResumeConfigMismatchPolicy specified (set to %s)", c.ResumeConfigMismatchPolicy)
+	}
+
+	if c.TargetTriggerPolicy == "" {
+		c.TargetTriggerPolicy = TargetTriggerPolicyWarn
+	} else if c.TargetTriggerPolicy != TargetTriggerPolicyWarn && c.TargetTriggerPolicy != TargetTriggerPolicyFail && c.TargetTriggerPolicy != TargetTriggerPolicyDrop {
+		return fmt.Errorf("Invalid TargetTriggerPolicy specified (set to %s)", c.TargetTriggerPolicy)
 	}
 
 	if c.LockStrategy == "" {
@@ -659,10 +3980,341 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("Invalid LockStrategy specified (set to %s)", c.LockStrategy)
 	}
 
+	if c.ReadOnlySource && (c.LockStrategy == LockStrategySourceDB || c.ConsistentSnapshot) {
+		return fmt.Errorf("ReadOnlySource requires LockStrategy %s or %s, and is incompatible with ConsistentSnapshot", LockStrategyInGhostferry, LockStrategyNone)
+	}
+
+	if c.DataIterationRowLock == "" {
+		c.DataIterationRowLock = RowLockExclusive
+	} else if c.DataIterationRowLock != RowLockExclusive && c.DataIterationRowLock != RowLockShared {
+		return fmt.Errorf("Invalid DataIterationRowLock specified (set to %s)", c.DataIterationRowLock)
+	}
+
+	if err := c.validateDataIterationIsolationLevel(); err != nil {
+		return err
+	}
+
 	if c.DBWriteRetries == 0 {
 		c.DBWriteRetries = 5
 	}
 
+	if c.StateDumpBinlogEvents < 0 {
+		return fmt.Errorf("StateDumpBinlogEvents must not be negative")
+	}
+
+	if c.StateEncryption.Enabled() {
+		if err := c.StateEncryption.Validate(); err != nil {
+			return fmt.Errorf("StateEncryption invalid: %v", err)
+		}
+	}
+
+	if c.StmtCacheSize == 0 {
+		c.StmtCacheSize = 1000
+	}
+
+	if err := c.WriteRetryPolicy.Validate(); err != nil {
+		return fmt.Errorf("WriteRetryPolicy invalid: %v", err)
+	}
+
+	if err := c.ErrorPolicy.Validate(); err != nil {
+		return fmt.Errorf("ErrorPolicy invalid: %v", err)
+	}
+
+	if err := c.CatchUp.Validate(); err != nil {
+		return fmt.Errorf("CatchUp invalid: %v", err)
+	}
+
+	if err := c.DDLDenylist.Validate(); err != nil {
+		return fmt.Errorf("DDLDenylist invalid: %v", err)
+	}
+
+	if c.AuditLog.Enabled() {
+		if err := c.AuditLog.Validate(); err != nil {
+			return fmt.Errorf("AuditLog invalid: %v", err)
+		}
+	}
+
+	if c.PositionMap.Enabled() {
+		if err := c.PositionMap.Validate(); err != nil {
+			return fmt.Errorf("PositionMap invalid: %v", err)
+		}
+	}
+
+	if c.DumpLoad.Enabled() {
+		if err := c.DumpLoad.Validate(); err != nil {
+			return fmt.Errorf("DumpLoad invalid: %v", err)
+		}
+
+		if len(c.TableRewrites) > 0 {
+			return fmt.Errorf("DumpLoad is incompatible with TableRewrites")
+		}
+
+		if c.BenchmarkMode {
+			return fmt.Errorf("DumpLoad is incompatible with BenchmarkMode")
+		}
+	}
+
+	if c.StartPosition.Enabled() {
+		if err := c.StartPosition.Validate(); err != nil {
+			return fmt.Errorf("StartPosition invalid: %v", err)
+		}
+
+		if c.DumpLoad.Enabled() {
+			return fmt.Errorf("StartPosition is incompatible with DumpLoad")
+		}
+
+		if c.ConsistentSnapshot {
+			return fmt.Errorf("StartPosition is incompatible with ConsistentSnapshot")
+		}
+	}
+
+	if c.ConsistentSnapshot {
+		if c.DelayDataIterationUntilBinlogWriterShutdown {
+			return fmt.Errorf("ConsistentSnapshot is incompatible with DelayDataIterationUntilBinlogWriterShutdown")
+		}
+
+		if c.DumpLoad.Enabled() {
+			return fmt.Errorf("ConsistentSnapshot is incompatible with DumpLoad")
+		}
+
+		// the chunks are read outside of the snapshot
+		if c.BlobChunking.Enabled() {
+			return fmt.Errorf("ConsistentSnapshot is incompatible with BlobChunking")
+		}
+	}
+
+	if c.ConsistentSnapshotLock == "" {
+		c.ConsistentSnapshotLock = SnapshotLockFlushTables
+	} else if c.ConsistentSnapshotLock != SnapshotLockFlushTables && c.ConsistentSnapshotLock != SnapshotLockBackup {
+		return fmt.Errorf("Invalid ConsistentSnapshotLock specified (set to %s)", c.ConsistentSnapshotLock)
+	}
+
+	if c.BlobChunking.Enabled() {
+		if err := c.BlobChunking.Validate(); err != nil {
+			return fmt.Errorf("BlobChunking invalid: %v", err)
+		}
+
+		// the chunks are read while the rows of their batch are locked on the
+		// source
+		if c.LockStrategy != LockStrategySourceDB {
+			return fmt.Errorf("BlobChunking requires LockStrategy %s (set to %s)", LockStrategySourceDB, c.LockStrategy)
+		}
+	}
+
+	if c.BinlogEventFilter.Enabled() {
+		if err := c.BinlogEventFilter.Validate(); err != nil {
+			return fmt.Errorf("BinlogEventFilter invalid: %v", err)
+		}
+	}
+
+	if c.DateTimeConversion.Enabled() {
+		if err := c.DateTimeConversion.Validate(); err != nil {
+			return fmt.Errorf("DateTimeConversion invalid: %v", err)
+		}
+
+		// the checksums of the tables would differ
+		if c.VerifierType == VerifierTypeChecksumTable {
+			return fmt.Errorf("DateTimeConversion is incompatible with the %s verifier", VerifierTypeChecksumTable)
+		}
+	}
+
+	if c.NativeReplicationHandoff.Enabled {
+		if err := c.NativeReplicationHandoff.Validate(c.Source); err != nil {
+			return fmt.Errorf("NativeReplicationHandoff invalid: %v", err)
+		}
+
+		// native replication cannot rename tables, and the writes must be
+		// applied to the target up to the handoff position
+		if len(c.TableRewrites) > 0 {
+			return fmt.Errorf("NativeReplicationHandoff is incompatible with TableRewrites")
+		}
+
+		if c.BenchmarkMode || c.ClickHouseSink.Exclusive {
+			return fmt.Errorf("NativeReplicationHandoff requires the writes to be applied to the target")
+		}
+	}
+
+	if c.TableDiscovery.Enabled() {
+		// the binlogs of the new tables must be applied from the moment
+		// they are copied
+		if c.ConsistentSnapshot {
+			return fmt.Errorf("TableDiscovery is incompatible with ConsistentSnapshot")
+		}
+		if c.DelayDataIterationUntilBinlogWriterShutdown {
+			return fmt.Errorf("TableDiscovery is incompatible with DelayDataIterationUntilBinlogWriterShutdown")
+		}
+		if err := c.TableDiscovery.Validate(); err != nil {
+			return fmt.Errorf("TableDiscovery invalid: %v", err)
+		}
+	}
+
+	if c.KeyRangeSplit.Enabled() {
+		// the ranges are split in the order of the pagination keys, and the
+		// table copy state read by the processes of a distributed copy has
+		// a single position per table
+		if c.IterateInDescendingOrder || c.DistributedCopy.Enabled() {
+			return fmt.Errorf("KeyRangeSplit is incompatible with IterateInDescendingOrder and DistributedCopy")
+		}
+		if err := c.KeyRangeSplit.Validate(); err != nil {
+			return fmt.Errorf("KeyRangeSplit invalid: %v", err)
+		}
+	}
+
+	if c.DistributedCopy.Enabled() {
+		if c.ResumeStateFromDB == "" {
+			return fmt.Errorf("DistributedCopy requires ResumeStateFromDB")
+		}
+		// the rows must be copied while the binlogs are streamed, and
+		// only the tables known when the run started are leased
+		if c.ConsistentSnapshot || c.DelayDataIterationUntilBinlogWriterShutdown || c.TableDiscovery.Enabled() {
+			return fmt.Errorf("DistributedCopy is incompatible with ConsistentSnapshot, DelayDataIterationUntilBinlogWriterShutdown and TableDiscovery")
+		}
+		if c.DumpLoad.Enabled() || c.StartPosition.Enabled() {
+			return fmt.Errorf("DistributedCopy requires the rows to be copied, which DumpLoad and StartPosition do not")
+		}
+		// the locks of the rows, the verification of the copied rows and
+		// the pauses of the copy of tables being truncated or changed are
+		// held in the process writing the binlog events
+		if c.LockStrategy == LockStrategyInGhostferry || c.VerifierType == VerifierTypeInline || c.ReplicateSchemaChanges {
+			return fmt.Errorf("DistributedCopy is incompatible with LockStrategy %s, VerifierType %s and ReplicateSchemaChanges", LockStrategyInGhostferry, VerifierTypeInline)
+		}
+		if err := c.DistributedCopy.Validate(); err != nil {
+			return fmt.Errorf("DistributedCopy invalid: %v", err)
+		}
+		// the run lock is held by the coordinator
+		if c.DistributedCopy.IsWorker() && c.RunLock.Enabled {
+			return fmt.Errorf("RunLock cannot be enabled on the workers of a DistributedCopy")
+		}
+	}
+
+	if c.ProgressHistory.Enabled() {
+		if c.ResumeStateFromDB == "" {
+			return fmt.Errorf("ProgressHistory requires ResumeStateFromDB")
+		}
+		if err := c.ProgressHistory.Validate(); err != nil {
+			return fmt.Errorf("ProgressHistory invalid: %v", err)
+		}
+	}
+
+	if c.RecordAppliedBinlogEvents && c.ResumeStateFromDB == "" {
+		return fmt.Errorf("RecordAppliedBinlogEvents requires ResumeStateFromDB")
+	}
+
+	if err := c.Metrics.Validate(); err != nil {
+		return fmt.Errorf("Metrics invalid: %v", err)
+	}
+
+	if err := c.Sizing.Validate(); err != nil {
+		return fmt.Errorf("Sizing invalid: %v", err)
+	}
+
+	if c.RunLock.Enabled {
+		if err := c.RunLock.Validate(); err != nil {
+			return fmt.Errorf("RunLock invalid: %v", err)
+		}
+	}
+
+	if c.ForeignWriteGuard.Enabled {
+		if err := c.ForeignWriteGuard.Validate(); err != nil {
+			return fmt.Errorf("ForeignWriteGuard invalid: %v", err)
+		}
+
+		// the guard streams the binlogs of the target
+		if c.Target.IAMAuthRegion != "" && c.Target.ComponentCredentials.BinlogStreamer == nil {
+			return fmt.Errorf("ForeignWriteGuard requires Target.ComponentCredentials.BinlogStreamer with IAMAuthRegion, as binlog streaming requires password authentication")
+		}
+	}
+
+	if c.CutoverValidation.Enabled {
+		if err := c.CutoverValidation.Validate(); err != nil {
+			return fmt.Errorf("CutoverValidation invalid: %v", err)
+		}
+	}
+
+	if c.TargetGuard.Enabled() {
+		if err := c.TargetGuard.Validate(); err != nil {
+			return fmt.Errorf("TargetGuard invalid: %v", err)
+		}
+	}
+
+	if c.Notifications.Enabled() {
+		if err := c.Notifications.Validate(); err != nil {
+			return fmt.Errorf("Notifications invalid: %v", err)
+		}
+	}
+
+	if c.LagAlert.Enabled() {
+		if err := c.LagAlert.Validate(); err != nil {
+			return fmt.Errorf("LagAlert invalid: %v", err)
+		}
+	}
+
+	if c.TableCopyHooks.Enabled() {
+		if err := c.TableCopyHooks.Validate(); err != nil {
+			return fmt.Errorf("TableCopyHooks invalid: %v", err)
+		}
+	}
+
+	if c.TableRecopy.Enabled() {
+		if err := c.TableRecopy.Validate(); err != nil {
+			return fmt.Errorf("TableRecopy invalid: %v", err)
+		}
+	}
+
+	for _, table := range c.StreamOnlyTables {
+		parts := strings.Split(table, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid StreamOnlyTables table specified (set to %s), expected schema.table", table)
+		}
+		for _, recopiedTable := range c.TableRecopy.Tables {
+			if recopiedTable == table {
+				return fmt.Errorf("table %s cannot be both stream-only and copied again", table)
+			}
+		}
+	}
+
+	if c.BinlogRetention.Enabled() {
+		if err := c.BinlogRetention.Validate(); err != nil {
+			return fmt.Errorf("BinlogRetention invalid: %v", err)
+		}
+	}
+
+	if c.QueryKiller.Enabled() {
+		if err := c.QueryKiller.Validate(); err != nil {
+			return fmt.Errorf("QueryKiller invalid: %v", err)
+		}
+	}
+
+	if c.ClickHouseSink.Enabled() {
+		if err := c.ClickHouseSink.Validate(); err != nil {
+			return fmt.Errorf("ClickHouseSink invalid: %v", err)
+		}
+
+		if c.ClickHouseSink.Exclusive {
+			if c.VerifierType != "" && c.VerifierType != VerifierTypeNoVerification {
+				return fmt.Errorf("ClickHouseSink.Exclusive is incompatible with data verification (set to %s)", c.VerifierType)
+			}
+
+			if c.ReplicateSchemaChanges {
+				return fmt.Errorf("ClickHouseSink.Exclusive is incompatible with ReplicateSchemaChanges")
+			}
+
+			if c.ResumeStateFromDB != "" {
+				return fmt.Errorf("ClickHouseSink.Exclusive is incompatible with ResumeStateFromDB")
+			}
+		}
+
+		if c.AllowMinimalBinlogRowImage {
+			return fmt.Errorf("ClickHouseSink requires full binlog row images and is incompatible with AllowMinimalBinlogRowImage")
+		}
+	}
+
+	if c.LoopPrevention.Enabled() {
+		if err := c.LoopPrevention.Validate(); err != nil {
+			return fmt.Errorf("LoopPrevention invalid: %v", err)
+		}
+	}
+
 	if c.DataIterationBatchSize == 0 {
 		c.DataIterationBatchSize = 200
 	}
@@ -675,6 +4327,10 @@ func (c *Config) ValidateConfig() error {
 		c.DataIterationConcurrency = 4
 	}
 
+	if c.DeltaCopyConcurrency == 0 {
+		c.DeltaCopyConcurrency = c.DataIterationConcurrency
+	}
+
 	if c.DBReadRetries == 0 {
 		c.DBReadRetries = 5
 	}
@@ -15,30 +15,58 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const defaultProgressStreamInterval = 1 * time.Second
+
 type ControlServer struct {
 	F        *Ferry
 	Verifier Verifier
 	Addr     string
 	Basedir  string
 
-	server    *http.Server
-	logger    *logrus.Entry
-	router    *mux.Router
-	templates *template.Template
+	// Approves the cutover on POST /api/actions/approve-cutover, see
+	// copydb.CutoverApprovalConfig. The action is not implemented if nil.
+	ApproveCutover func() error
+
+	server       *http.Server
+	logger       *logrus.Entry
+	router       *mux.Router
+	templates    *template.Template
+	recentErrors *RecentErrors
 }
 
 func (this *ControlServer) Initialize() (err error) {
-	this.logger = logrus.WithField("tag", "control_server")
+	this.logger = this.F.loggerFor("control_server")
 	this.logger.Info("initializing")
 
+	// the errors of all components are logged through the base logger
+	this.recentErrors = NewRecentErrors(50)
+	if this.F.Logger != nil {
+		this.F.Logger.Logger.AddHook(this.recentErrors)
+	} else {
+		logrus.AddHook(this.recentErrors)
+	}
+
 	this.router = mux.NewRouter()
 	this.router.HandleFunc("/", this.HandleIndex).Methods("GET")
+	this.router.HandleFunc("/dashboard", this.HandleDashboard).Methods("GET")
 	this.router.HandleFunc("/api/actions/pause", this.HandlePause).Queries("type", "{type:migration|replication}").Methods("POST")
 	this.router.HandleFunc("/api/actions/unpause", this.HandleUnpause).Queries("type", "{type:migration|replication}").Methods("POST")
 	this.router.HandleFunc("/api/actions/cutover", this.HandleCutover).Queries("type", "{type:automatic|manual}").Methods("POST")
 	this.router.HandleFunc("/api/actions/stop", this.HandleStop).Methods("POST")
+	this.router.HandleFunc("/api/actions/approve-cutover", this.HandleApproveCutover).Methods("POST")
 	this.router.HandleFunc("/api/actions/verify", this.HandleVerify).Methods("POST")
 	this.router.HandleFunc("/api/health", this.HandleStatusHealthCheck).Methods("GET")
+	this.router.HandleFunc("/api/progress/stream", this.HandleProgressStream).Methods("GET")
+	this.router.HandleFunc("/api/progress/history", this.HandleProgressHistory).Methods("GET")
+	this.router.HandleFunc("/api/errors", this.HandleRecentErrors).Methods("GET")
+	this.router.HandleFunc("/api/catchup", this.HandleCatchUpStatus).Methods("GET")
+	this.router.HandleFunc("/api/tunables", this.HandleGetTunables).Methods("GET")
+	this.router.HandleFunc("/api/tunables", this.HandleUpdateTunables).Methods("POST")
+
+	// served if Config.Metrics uses the prometheus sink
+	if handler, ok := this.F.metricsSink.(http.Handler); ok {
+		this.router.Handle("/metrics", handler).Methods("GET")
+	}
 
 	if WebUiBasedir != "" {
 		this.Basedir = WebUiBasedir
@@ -96,6 +124,45 @@ func (this *ControlServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleDashboard serves the embedded dashboard, which shows the progress
+// streamed from /api/progress/stream
+func (this *ControlServer) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboardHTML))
+}
+
+// HandleRecentErrors responds with the errors and warnings logged recently,
+// oldest first
+func (this *ControlServer) HandleRecentErrors(w http.ResponseWriter, r *http.Request) {
+	errorsAsJson, err := json.Marshal(this.recentErrors.Errors())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(errorsAsJson)
+}
+
+// HandleCatchUpStatus responds with how far the binlog streaming is behind
+// the source, see BinlogStreamer.CatchUpStatus
+func (this *ControlServer) HandleCatchUpStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := this.F.BinlogStreamer.CatchUpStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	statusAsJson, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statusAsJson)
+}
+
 func (this *ControlServer) getThrottlerForRequest(w http.ResponseWriter, r *http.Request) Throttler {
 	vars := mux.Vars(r)
 	throttlerName := vars["type"]
@@ -154,6 +221,21 @@ func (this *ControlServer) HandleCutover(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+func (this *ControlServer) HandleApproveCutover(w http.ResponseWriter, r *http.Request) {
+	if this.ApproveCutover == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	err := this.ApproveCutover()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func (this *ControlServer) HandleStop(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
@@ -209,3 +291,111 @@ func (this *ControlServer) HandleStatusHealthCheck(w http.ResponseWriter, r *htt
 		w.Write(statusAsJson)
 	}
 }
+
+// HandleProgressHistory responds with the progress snapshots recorded on the
+// target, oldest first, see Config.ProgressHistory
+func (this *ControlServer) HandleProgressHistory(w http.ResponseWriter, r *http.Request) {
+	history := this.F.ProgressHistory()
+	if history == nil {
+		http.Error(w, "ProgressHistory is not enabled", http.StatusNotFound)
+		return
+	}
+
+	snapshots, err := history.Snapshots()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	snapshotsAsJson, err := json.Marshal(snapshots)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(snapshotsAsJson)
+}
+
+func (this *ControlServer) HandleGetTunables(w http.ResponseWriter, r *http.Request) {
+	tunablesAsJson, err := json.Marshal(this.F.CurrentTunables())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(tunablesAsJson)
+}
+
+// HandleUpdateTunables applies the Tunables in the JSON body of the request,
+// leaving the settings missing from it unchanged, and responds with the
+// resulting Tunables
+func (this *ControlServer) HandleUpdateTunables(w http.ResponseWriter, r *http.Request) {
+	var tunables Tunables
+	err := json.NewDecoder(r.Body).Decode(&tunables)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid tunables: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = this.F.UpdateTunables(tunables)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid tunables: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	this.HandleGetTunables(w, r)
+}
+
+// HandleProgressStream pushes the progress of the ferry to the client as a
+// stream of server-sent events. The progress is sampled at the interval (in
+// milliseconds) given by the optional "interval" parameter, and an event is
+// only sent if the progress changed since the last event.
+func (this *ControlServer) HandleProgressStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	interval := defaultProgressStreamInterval
+	if intervalParam := r.FormValue("interval"); intervalParam != "" {
+		intervalMs, err := strconv.ParseInt(intervalParam, 10, 64)
+		if err != nil || intervalMs <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid interval: %s", intervalParam), http.StatusBadRequest)
+			return
+		}
+		interval = time.Duration(intervalMs) * time.Millisecond
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastProgress []byte
+	for {
+		progress, err := json.Marshal(this.F.Progress())
+		if err != nil {
+			this.logger.WithError(err).Error("failed to marshal progress for stream")
+			return
+		}
+
+		if !bytes.Equal(progress, lastProgress) {
+			if _, err = fmt.Fprintf(w, "event: progress\ndata: %s\n\n", progress); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastProgress = progress
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/copydb"
@@ -19,12 +21,16 @@ func usage() {
 
 var verbose bool
 var dryrun bool
+var tui bool
 var stateFilePath string
+var recopyTables string
 
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "Show verbose logging output")
-	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just connect and check settings")
+	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just run preflight checks on the database settings")
+	flag.BoolVar(&tui, "tui", false, "Show an interactive progress display on the terminal instead of logging output")
 	flag.StringVar(&stateFilePath, "resumestate", "", "Path to the state dump JSON file to resume Ghostferry with")
+	flag.StringVar(&recopyTables, "recopytables", "", "Comma-separated list of tables (schema.table) to copy again from scratch when resuming")
 }
 
 func errorAndExit(msg string) {
@@ -32,6 +38,23 @@ func errorAndExit(msg string) {
 	os.Exit(1)
 }
 
+// exitOnPanic exits once a goroutine of the ferry panicked and the state was
+// dumped, such that the run can be resumed from the dump
+func exitOnPanic(errorHandler ghostferry.ErrorHandler) {
+	panicErrorHandler, ok := errorHandler.(*ghostferry.PanicErrorHandler)
+	if !ok {
+		return
+	}
+
+	panics := panicErrorHandler.Panics()
+	go func() {
+		err := <-panics
+		fmt.Fprintf(os.Stderr, "error: %s\n", strings.SplitN(err.Error(), "\n", 2)[0])
+		panicErrorHandler.Ferry.CloseTunnels()
+		os.Exit(ghostferry.ExitCodeResumable)
+	}()
+}
+
 func main() {
 	flag.Parse()
 	if flag.NArg() == 0 {
@@ -73,12 +96,15 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to open config file: %v", err))
 	}
 
-	parser := json.NewDecoder(f)
-	err = parser.Decode(&config)
+	err = ghostferry.DecodeConfig(f, &config)
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to parse config file: %v", err))
 	}
 
+	if recopyTables != "" {
+		config.Config.TableRecopy.Tables = append(config.Config.TableRecopy.Tables, strings.Split(recopyTables, ",")...)
+	}
+
 	// if the state file is not provided as command-line argument, check if we
 	// are tracking state in a file according to the config. If so, and the file
 	// exists, read from there
@@ -111,8 +137,8 @@ func main() {
 			errorAndExit(fmt.Sprintf("failed to open state file: %v", err))
 		}
 
-		parser := json.NewDecoder(f)
-		err = parser.Decode(&config.Config.StateToResumeFrom)
+		// encrypted states are decrypted with the key of the config
+		config.Config.StateToResumeFrom, err = ghostferry.DecodeState(f, &config.Config.StateEncryption)
 		if err != nil {
 			errorAndExit(fmt.Sprintf("failed to parse state file: %v", err))
 		}
@@ -125,12 +151,35 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to validate config: %v", err))
 	}
 
+	if dryrun {
+		report := ghostferry.RunPreflightChecks(config.Config)
+		fmt.Print(report)
+		if !report.Passed() {
+			errorAndExit("preflight checks failed")
+		}
+	}
+
 	ferry := copydb.NewFerry(config)
+	ferry.Ferry.ReloadTunables = func() (ghostferry.Tunables, error) {
+		return ghostferry.ReadTunablesFile(configFilePath)
+	}
 
 	err = ferry.Initialize()
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to initialize ferry: %v", err))
 	}
+	exitOnPanic(ferry.Ferry.ErrorHandler)
+
+	// the workers of a distributed copy only copy rows, the databases and
+	// tables are created by the coordinator
+	if config.Config.DistributedCopy.IsWorker() {
+		if dryrun {
+			fmt.Println("exiting due to dryrun")
+			return
+		}
+		ferry.Ferry.RunCopyWorker()
+		return
+	}
 
 	err = ferry.Start()
 	if err != nil {
@@ -138,11 +187,27 @@ func main() {
 	}
 
 	if dryrun {
+		if sizing := ferry.Ferry.SizingReport(); sizing != nil {
+			fmt.Print(sizing)
+		}
 		fmt.Println("exiting due to dryrun")
 		return
 	}
 
-	if ferry.Ferry.StateToResumeFrom == nil {
+	if tui {
+		display := ghostferry.NewProgressDisplay(ferry.Ferry, os.Stdout)
+		logrus.AddHook(display)
+		logrus.SetOutput(ioutil.Discard)
+		go display.Run(context.Background())
+	}
+
+	if config.Config.BenchmarkMode {
+		logger.Info("Skip initializing target database tables: running benchmark")
+	} else if config.Config.DumpLoad.Enabled() {
+		logger.Debugf("Skip initializing target database tables: created by the dump")
+	} else if config.Config.StartPosition.Enabled() {
+		logger.Debugf("Skip initializing target database tables: seeded by other means")
+	} else if ferry.Ferry.StateToResumeFrom == nil {
 		logger.Debugf("Initializing target database tables")
 		err = ferry.CreateDatabasesAndTables()
 		if err != nil {
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
 )
 
 // Whitelisting and blacklisting databases/tables to copy.
@@ -70,6 +71,81 @@ type Config struct {
 
 	// The duration to wait for the replication to catchup before aborting. Only use if RunFerryFromReplica is true.
 	WaitForReplicationTimeout string
+
+	// Wait for an approval of the cutover once the binlog streaming caught
+	// up with the source, before the final drain of the binlogs, such that
+	// the switchover of the applications can be coordinated.
+	//
+	// Optional: defaults to proceeding with the cutover once caught up
+	CutoverApproval *CutoverApprovalConfig
+
+	// Stream a change log of the copied tables into BigQuery, alongside the
+	// target, see bigquery.Sink.
+	//
+	// Optional: defaults to disabled
+	BigQuerySink bigquery.Config
+}
+
+const (
+	// Prompt for the approval on the terminal
+	CutoverApprovalPrompt = "prompt"
+
+	// Wait for a POST to /api/actions/approve-cutover on the control server
+	CutoverApprovalHTTP = "http"
+
+	// Wait for the MarkerFile to exist
+	CutoverApprovalFile = "file"
+)
+
+type CutoverApprovalConfig struct {
+	// How the cutover is approved. Valid choices are:
+	// prompt
+	// http
+	// file
+	Method string
+
+	// The file whose creation approves the cutover, for the file method. The
+	// file must be created or touched after the cutover is waited for, and
+	// is removed once it approved the cutover.
+	MarkerFile string
+
+	// How often the MarkerFile is checked for, in the format of
+	// time.ParseDuration.
+	//
+	// Optional: defaults to 1s
+	CheckInterval string
+
+	checkInterval time.Duration
+}
+
+func (c *CutoverApprovalConfig) Validate() error {
+	switch c.Method {
+	case CutoverApprovalPrompt, CutoverApprovalHTTP:
+		if c.MarkerFile != "" {
+			return fmt.Errorf("MarkerFile is only supported for the %s method", CutoverApprovalFile)
+		}
+	case CutoverApprovalFile:
+		if c.MarkerFile == "" {
+			return fmt.Errorf("MarkerFile must be specified for the %s method", CutoverApprovalFile)
+		}
+	default:
+		return fmt.Errorf("invalid Method specified (set to %s)", c.Method)
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "1s"
+	}
+
+	var err error
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval specified: %v", err)
+	}
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("invalid CheckInterval specified (set to %s)", c.CheckInterval)
+	}
+
+	return nil
 }
 
 func (c *Config) InitializeAndValidateConfig() error {
@@ -96,6 +172,18 @@ func (c *Config) InitializeAndValidateConfig() error {
 		}
 	}
 
+	if c.CutoverApproval != nil {
+		if err := c.CutoverApproval.Validate(); err != nil {
+			return fmt.Errorf("CutoverApproval invalid: %v", err)
+		}
+	}
+
+	if c.BigQuerySink.Enabled() {
+		if err := c.BigQuerySink.Validate(); err != nil {
+			return fmt.Errorf("BigQuerySink invalid: %v", err)
+		}
+	}
+
 	if err := c.Config.ValidateConfig(); err != nil {
 		return err
 	}
@@ -7,13 +7,15 @@ import (
 	"time"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
 	"github.com/sirupsen/logrus"
 )
 
 type CopydbFerry struct {
-	Ferry         *ghostferry.Ferry
-	controlServer *ghostferry.ControlServer
-	config        *Config
+	Ferry           *ghostferry.Ferry
+	CutoverApproval *CutoverApproval
+	controlServer   *ghostferry.ControlServer
+	config          *Config
 }
 
 func NewFerry(config *Config) *CopydbFerry {
@@ -27,10 +29,17 @@ func NewFerry(config *Config) *CopydbFerry {
 		Basedir: config.WebBasedir,
 	}
 
+	var cutoverApproval *CutoverApproval
+	if config.CutoverApproval != nil {
+		cutoverApproval = NewCutoverApproval(config.CutoverApproval)
+		controlServer.ApproveCutover = cutoverApproval.Approve
+	}
+
 	return &CopydbFerry{
-		Ferry:         ferry,
-		controlServer: controlServer,
-		config:        config,
+		Ferry:           ferry,
+		CutoverApproval: cutoverApproval,
+		controlServer:   controlServer,
+		config:          config,
 	}
 }
 
@@ -42,6 +51,14 @@ func (this *CopydbFerry) Initialize() error {
 		}
 	}
 
+	if this.config.BigQuerySink.Enabled() {
+		sink, err := bigquery.NewSink(&this.config.BigQuerySink, this.config.Config, logrus.WithField("tag", "bigquery_sink"))
+		if err != nil {
+			return err
+		}
+		this.Ferry.Sink = sink
+	}
+
 	err := this.Ferry.Initialize()
 	if err != nil {
 		return err
@@ -104,8 +121,10 @@ func (this *CopydbFerry) Run() {
 
 	copyWG := &sync.WaitGroup{}
 	copyWG.Add(1)
+	runDone := make(chan struct{})
 	go func() {
 		defer copyWG.Done()
+		defer close(runDone)
 		this.Ferry.Run()
 	}()
 
@@ -117,8 +136,21 @@ func (this *CopydbFerry) Run() {
 	// binlog streamer catching up.
 	this.Ferry.WaitUntilBinlogStreamerCatchesUp()
 
+	// With CutoverApproval, the cutover is held until it is approved, such
+	// that the switchover of the applications can be coordinated. As the
+	// streaming may fall behind while waiting, it has to catch up again.
+	if this.CutoverApproval != nil {
+		err := this.CutoverApproval.Wait(this.stopped(runDone))
+		if err != nil {
+			this.Ferry.ErrorHandler.Fatal("cutover_approval", err)
+		}
+
+		this.Ferry.WaitUntilBinlogStreamerCatchesUp()
+	}
+
 	// This is when the source database should be set as read only, whether it
-	// is done in application level or the database level.
+	// is done in application level or the database level, unless the
+	// replication is handed off to the target with NativeReplicationHandoff.
 	// Must ensure that all transactions are flushed to the binlog before
 	// proceeding.
 	this.Ferry.FlushBinlogAndStopStreaming()
@@ -127,6 +159,30 @@ func (this *CopydbFerry) Run() {
 	// should be identical.
 	copyWG.Wait()
 
+	if this.Ferry.Config.TargetTriggerPolicy == ghostferry.TargetTriggerPolicyDrop {
+		err := this.Ferry.RestoreTargetTriggers()
+		if err != nil {
+			this.Ferry.ErrorHandler.Fatal("target_triggers", err)
+		}
+	}
+
+	if this.Ferry.Config.AutoIncrementSync.Enabled {
+		err := this.Ferry.SyncAutoIncrements()
+		if err != nil {
+			this.Ferry.ErrorHandler.Fatal("auto_increment_sync", err)
+		}
+	}
+
+	// Fails the run unless the checks of the CutoverValidation config pass.
+	this.Ferry.ValidateCutoverOrFail(nil)
+
+	if this.Ferry.Config.NativeReplicationHandoff.Enabled {
+		err := this.Ferry.HandoffToNativeReplication()
+		if err != nil {
+			this.Ferry.ErrorHandler.Fatal("native_replication", err)
+		}
+	}
+
 	// This is where you cutover from using the source database to
 	// using the target database.
 	logrus.Info("ghostferry main operations has terminated but the control server remains online")
@@ -136,6 +192,25 @@ func (this *CopydbFerry) Run() {
 	serverWG.Wait()
 }
 
+// stopped returns a channel closed once the run of the Ferry returned or
+// failed, not to wait for the cutover approval forever
+func (this *CopydbFerry) stopped(runDone <-chan struct{}) <-chan struct{} {
+	var failed <-chan struct{}
+	if errorHandler, ok := this.Ferry.ErrorHandler.(*ghostferry.PanicErrorHandler); ok {
+		failed = errorHandler.Failed()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-runDone:
+		case <-failed:
+		}
+	}()
+	return stopped
+}
+
 func (this *CopydbFerry) ShutdownControlServer() error {
 	return this.controlServer.Shutdown()
 }
@@ -209,6 +284,11 @@ func (this *CopydbFerry) createTableOnTarget(database, table string) error {
 		return fmt.Errorf("no effect on replacing the create table <table> with create table <db>.<table> query on query: %s", createTableQuery)
 	}
 
+	if this.Ferry.Config.DDLRewrites != nil {
+		// the database name has been rewritten above already
+		createTableQueryReplaced = ghostferry.NewDDLRewriter(*this.Ferry.Config.DDLRewrites, nil).RewriteOptions(createTableQueryReplaced)
+	}
+
 	_, err = this.Ferry.TargetDB.Exec(createTableQueryReplaced)
 	return err
 }
@@ -0,0 +1,149 @@
+package copydb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CutoverApproval holds the cutover until it is approved, see
+// CutoverApprovalConfig.
+type CutoverApproval struct {
+	Config *CutoverApprovalConfig
+
+	// The terminal the approval is prompted on. stdout is reserved for
+	// dumping the state, so the prompt is written to stderr by default.
+	Input  io.Reader
+	Output io.Writer
+
+	approved    chan struct{}
+	approveOnce sync.Once
+	logger      *logrus.Entry
+}
+
+func NewCutoverApproval(config *CutoverApprovalConfig) *CutoverApproval {
+	return &CutoverApproval{
+		Config:   config,
+		Input:    os.Stdin,
+		Output:   os.Stderr,
+		approved: make(chan struct{}),
+		logger:   logrus.WithField("tag", "cutover_approval"),
+	}
+}
+
+// Approve approves the cutover for the http method. An approval before the
+// cutover is waited for lets it proceed right away.
+func (a *CutoverApproval) Approve() error {
+	if a.Config.Method != CutoverApprovalHTTP {
+		return fmt.Errorf("the cutover is approved with the %s method", a.Config.Method)
+	}
+
+	a.approveOnce.Do(func() {
+		a.logger.Info("cutover approved over http")
+		close(a.approved)
+	})
+	return nil
+}
+
+// Wait blocks until the cutover is approved, or until stop is closed as the
+// run stopped, e.g. on a fatal error.
+func (a *CutoverApproval) Wait(stop <-chan struct{}) error {
+	switch a.Config.Method {
+	case CutoverApprovalPrompt:
+		return a.prompt(stop)
+	case CutoverApprovalHTTP:
+		a.logger.Info("waiting for the cutover to be approved with POST /api/actions/approve-cutover")
+		select {
+		case <-a.approved:
+			return nil
+		case <-stop:
+			return errCutoverApprovalStopped
+		}
+	case CutoverApprovalFile:
+		return a.waitForMarkerFile(stop)
+	default:
+		return fmt.Errorf("invalid cutover approval method %s", a.Config.Method)
+	}
+}
+
+var errCutoverApprovalStopped = fmt.Errorf("the run stopped before the cutover was approved")
+
+func (a *CutoverApproval) prompt(stop <-chan struct{}) error {
+	a.logger.Info("waiting for the cutover to be approved on the terminal")
+
+	// the input is read in the background, as reading it cannot be
+	// interrupted when the run stops
+	answers := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(a.Input)
+		for {
+			fmt.Fprint(a.Output, "The binlog streaming caught up with the source. Type \"yes\" to proceed with the cutover: ")
+
+			answer, err := reader.ReadString('\n')
+			if strings.TrimSpace(answer) == "yes" {
+				a.logger.Info("cutover approved on the terminal")
+				answers <- nil
+				return
+			}
+			if err == io.EOF {
+				answers <- fmt.Errorf("the cutover was not approved before the end of the input")
+				return
+			}
+			if err != nil {
+				answers <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-answers:
+		return err
+	case <-stop:
+		return errCutoverApprovalStopped
+	}
+}
+
+// waitForMarkerFile waits for the MarkerFile to be created or touched after
+// the wait started, such that a marker left over from before, e.g. of an
+// earlier run, does not approve the cutover. The marker is removed once it
+// approved the cutover.
+func (a *CutoverApproval) waitForMarkerFile(stop <-chan struct{}) error {
+	a.logger.Infof("waiting for the cutover to be approved by creating %s", a.Config.MarkerFile)
+
+	// the modification times of some filesystems have a second precision
+	started := time.Now().Truncate(time.Second)
+	ticker := time.NewTicker(a.Config.checkInterval)
+	defer ticker.Stop()
+
+	staleLogged := false
+	for {
+		info, err := os.Stat(a.Config.MarkerFile)
+		if err == nil && !info.ModTime().Before(started) {
+			a.logger.Infof("cutover approved by %s", a.Config.MarkerFile)
+			if err = os.Remove(a.Config.MarkerFile); err != nil {
+				return fmt.Errorf("removing the approving %s: %v", a.Config.MarkerFile, err)
+			}
+			return nil
+		}
+		if err == nil && !staleLogged {
+			a.logger.Warnf("ignoring %s, as it was created before the cutover was waited for, touch it to approve the cutover", a.Config.MarkerFile)
+			staleLogged = true
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return errCutoverApprovalStopped
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package copydb
 
-import "github.com/Shopify/ghostferry"
+import (
+	"fmt"
+
+	"github.com/Shopify/ghostferry"
+)
 
 type StaticTableFilter struct {
 	Dbs            []string
@@ -82,3 +86,8 @@ func (s *StaticTableFilter) ApplicableTables(tables []*ghostferry.TableSchema) (
 
 	return applicableTables, nil
 }
+
+// ConfigFingerprint implements ghostferry.ConfigFingerprinter
+func (s *StaticTableFilter) ConfigFingerprint() string {
+	return fmt.Sprintf("dbs=%v blacklist=%t tables=%v blacklist=%t", s.Dbs, s.DbsIsBlacklist, s.Tables, s.TablesIsBlacklist)
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/stretchr/testify/suite"
+)
+
+type CutoverApprovalTestSuite struct {
+	suite.Suite
+}
+
+func (t *CutoverApprovalTestSuite) approval(config *copydb.CutoverApprovalConfig) *copydb.CutoverApproval {
+	t.Require().Nil(config.Validate())
+	return copydb.NewCutoverApproval(config)
+}
+
+func (t *CutoverApprovalTestSuite) TestPromptRequiresYes() {
+	approval := t.approval(&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalPrompt})
+	output := &bytes.Buffer{}
+	approval.Input = strings.NewReader("no\ny\nyes\n")
+	approval.Output = output
+
+	t.Require().Nil(approval.Wait(nil))
+	t.Require().Equal(3, strings.Count(output.String(), "Type \"yes\" to proceed with the cutover"))
+
+	approval.Input = strings.NewReader("no\n")
+	t.Require().EqualError(approval.Wait(nil), "the cutover was not approved before the end of the input")
+}
+
+func (t *CutoverApprovalTestSuite) TestHTTPApproval() {
+	approval := t.approval(&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalHTTP})
+
+	done := make(chan error)
+	go func() {
+		done <- approval.Wait(nil)
+	}()
+
+	select {
+	case <-done:
+		t.Fail("the cutover proceeded without an approval")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	t.Require().Nil(approval.Approve())
+	t.Require().Nil(<-done)
+
+	// approving again is a no-op
+	t.Require().Nil(approval.Approve())
+	t.Require().Nil(approval.Wait(nil))
+}
+
+func (t *CutoverApprovalTestSuite) TestMarkerFileApproval() {
+	dir, err := ioutil.TempDir("", "ghostferry-cutover")
+	t.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	markerFile := filepath.Join(dir, "approved")
+	approval := t.approval(&copydb.CutoverApprovalConfig{
+		Method:        copydb.CutoverApprovalFile,
+		MarkerFile:    markerFile,
+		CheckInterval: "10ms",
+	})
+
+	t.Require().EqualError(approval.Approve(), "the cutover is approved with the file method")
+
+	done := make(chan error)
+	go func() {
+		done <- approval.Wait(nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	t.Require().Nil(ioutil.WriteFile(markerFile, nil, 0644))
+	t.Require().Nil(<-done)
+
+	// the marker is used up by the approval
+	_, err = os.Stat(markerFile)
+	t.Require().True(os.IsNotExist(err))
+}
+
+func (t *CutoverApprovalTestSuite) TestStaleMarkerFileDoesNotApprove() {
+	dir, err := ioutil.TempDir("", "ghostferry-cutover")
+	t.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	markerFile := filepath.Join(dir, "approved")
+	t.Require().Nil(ioutil.WriteFile(markerFile, nil, 0644))
+	stale := time.Now().Add(-time.Hour)
+	t.Require().Nil(os.Chtimes(markerFile, stale, stale))
+
+	approval := t.approval(&copydb.CutoverApprovalConfig{
+		Method:        copydb.CutoverApprovalFile,
+		MarkerFile:    markerFile,
+		CheckInterval: "10ms",
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- approval.Wait(nil)
+	}()
+
+	select {
+	case <-done:
+		t.Fail("the cutover proceeded with a stale marker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	now := time.Now()
+	t.Require().Nil(os.Chtimes(markerFile, now, now))
+	t.Require().Nil(<-done)
+}
+
+func (t *CutoverApprovalTestSuite) TestWaitReturnsWhenTheRunStops() {
+	for _, config := range []*copydb.CutoverApprovalConfig{
+		{Method: copydb.CutoverApprovalHTTP},
+		{Method: copydb.CutoverApprovalFile, MarkerFile: filepath.Join(os.TempDir(), "ghostferry-never-approved"), CheckInterval: "10ms"},
+	} {
+		approval := t.approval(config)
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- approval.Wait(stop)
+		}()
+
+		close(stop)
+		select {
+		case err := <-done:
+			t.Require().EqualError(err, "the run stopped before the cutover was approved")
+		case <-time.After(time.Second):
+			t.Fail("the wait did not return when the run stopped")
+		}
+	}
+
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	approval := t.approval(&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalPrompt})
+	approval.Input = reader
+	approval.Output = ioutil.Discard
+
+	stop := make(chan struct{})
+	close(stop)
+	t.Require().EqualError(approval.Wait(stop), "the run stopped before the cutover was approved")
+}
+
+func (t *CutoverApprovalTestSuite) TestValidatesConfig() {
+	err := (&copydb.CutoverApprovalConfig{Method: "slack"}).Validate()
+	t.Require().EqualError(err, "invalid Method specified (set to slack)")
+
+	err = (&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalFile}).Validate()
+	t.Require().EqualError(err, "MarkerFile must be specified for the file method")
+
+	err = (&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalHTTP, MarkerFile: "/tmp/approved"}).Validate()
+	t.Require().EqualError(err, "MarkerFile is only supported for the file method")
+
+	err = (&copydb.CutoverApprovalConfig{Method: copydb.CutoverApprovalFile, MarkerFile: "/tmp/approved", CheckInterval: "0s"}).Validate()
+	t.Require().EqualError(err, "invalid CheckInterval specified (set to 0s)")
+}
+
+func TestCutoverApproval(t *testing.T) {
+	suite.Run(t, new(CutoverApprovalTestSuite))
+}
@@ -2,11 +2,13 @@ package ghostferry
 
 import (
 	"bytes"
+	"context"
 	sqlorig "database/sql"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/siddontang/go-mysql/schema"
@@ -217,7 +219,38 @@ type CursorConfig struct {
 	BatchSize       uint64
 	ReadRetries     int
 
+	// If non-zero, the rows of a batch are streamed: the PaginatedCursor
+	// passes them to the callback in several smaller batches, each holding
+	// rows of about this many bytes, while the rows of the batch stay locked.
+	BatchMaxBytes uint64
+
 	IterateInDescendingOrder bool
+
+	// If set, the rows read are locked in share mode instead of exclusively,
+	// see Config.DataIterationRowLock
+	SharedRowLock bool
+
+	// If set, the rows are read through the transactions of the snapshot,
+	// without locking them, see Config.ConsistentSnapshot
+	Snapshot *ConsistentSnapshot
+
+	// If set, the reads are registered with it, such that the QueryKiller can
+	// kill them. Killed reads are retried once the
+	// Throttler allows it, without counting against the ReadRetries.
+	QueryRegistry *sql.QueryRegistry
+
+	// Optional: defaults to the standard logrus logger
+	Logger *logrus.Entry
+
+	// Log the full queries too, see Ferry.IncrediblyVerboseLogging
+	IncrediblyVerboseLogging bool
+}
+
+func (c *CursorConfig) baseLogger() *logrus.Entry {
+	if c.Logger == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return c.Logger
 }
 
 // returns a new PaginatedCursor with an embedded copy of itself
@@ -248,6 +281,11 @@ type PaginatedCursor struct {
 	MaxPaginationKey *PaginationKeyData
 	RowLock          bool
 
+	// If set, the rows after the MaxPaginationKey are not read, as they are
+	// copied by the cursor of another range of the table, see
+	// KeyRangeSplitConfig. Only supported for single-column pagination keys.
+	StopAtMaxPaginationKey bool
+
 	paginationKeyColumn         *PaginationKey
 	lastSuccessfulPaginationKey *PaginationKeyData
 	tableLock                   *sync.RWMutex
@@ -255,7 +293,7 @@ type PaginatedCursor struct {
 }
 
 func (c *PaginatedCursor) Each(f func(RowBatch) error) error {
-	c.logger = logrus.WithFields(logrus.Fields{
+	c.logger = c.baseLogger().WithFields(logrus.Fields{
 		"table": c.Table.String(),
 		"tag":   "cursor",
 	})
@@ -273,34 +311,45 @@ func (c *PaginatedCursor) Each(f func(RowBatch) error) error {
 			}
 		}
 
+		if c.BatchMaxBytes > 0 {
+			complete, err := c.streamBatch(f)
+			if err != nil {
+				return err
+			}
+			if complete {
+				c.logger.Debug("did not reach max primary key, but the table is complete as there are no more rows")
+				break
+			}
+			continue
+		}
+
 		var tx SqlPreparerAndRollbacker
 		var batch InsertRowBatch
 		var paginationKeypos *PaginationKeyData
 
 		err := WithRetries(c.ReadRetries, 0, c.logger, "fetch rows", func() (err error) {
-			if c.Throttler != nil {
-				WaitForThrottle(c.Throttler)
-			}
+			for {
+				if c.Throttler != nil {
+					WaitForThrottle(c.Throttler)
+				}
 
-			// Only need to use a transaction if RowLock == true. Otherwise
-			// we'd be wasting two extra round trips per batch, doing
-			// essentially a no-op.
-			if c.RowLock {
-				tx, err = c.DB.Begin()
+				tx, err = c.begin()
 				if err != nil {
 					return err
 				}
-			} else {
-				tx = NewSqlDBWithFakeRollback(c.DB, c.tableLock)
-			}
 
-			batch, paginationKeypos, err = c.Fetch(tx)
-			if err == nil {
-				return nil
-			}
+				batch, paginationKeypos, err = c.Fetch(tx)
+				if err == nil {
+					return nil
+				}
 
-			tx.Rollback()
-			return err
+				tx.Rollback()
+				if !IsQueryInterrupted(err) {
+					return err
+				}
+
+				c.logger.Info("read was killed while throttled, reading the batch again")
+			}
 		})
 
 		if err != nil {
@@ -313,18 +362,10 @@ func (c *PaginatedCursor) Each(f func(RowBatch) error) error {
 			break
 		}
 
-		if c.lastSuccessfulPaginationKey != nil {
-			progress := paginationKeypos.Compare(c.lastSuccessfulPaginationKey)
-			if c.IterateInDescendingOrder && progress >= 0 || !c.IterateInDescendingOrder && progress <= 0 {
-				tx.Rollback()
-				failedOperator := "<="
-				if c.IterateInDescendingOrder {
-					failedOperator = ">="
-				}
-				err = fmt.Errorf("new %s paginationKeypos %s %s lastSuccessfulPaginationKey %s (%d)", c.Table, paginationKeypos, failedOperator, c.lastSuccessfulPaginationKey, progress)
-				c.logger.WithError(err).Errorf("last successful paginationKey position did not advance")
-				return err
-			}
+		err = c.checkProgress(paginationKeypos)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
 
 		err = f(batch)
@@ -353,7 +394,124 @@ func (c *PaginatedCursor) Each(f func(RowBatch) error) error {
 	return nil
 }
 
+// begin returns the transaction to read the next batch of rows in, which must
+// be rolled back once the rows have been handled
+func (c *PaginatedCursor) begin() (SqlPreparerAndRollbacker, error) {
+	if c.Snapshot != nil {
+		return c.Snapshot.Acquire(), nil
+	}
+
+	// Only need to use a transaction if RowLock == true. Otherwise
+	// we'd be wasting two extra round trips per batch, doing
+	// essentially a no-op.
+	if c.RowLock {
+		return c.DB.Begin()
+	}
+
+	return NewSqlDBWithFakeRollback(c.DB, c.tableLock), nil
+}
+
+// streamBatch reads the next batch of rows and passes them to the callback
+// in batches of about BatchMaxBytes, keeping the rows locked until the last
+// one has been handled. Only the rows of a single batch are held in memory,
+// unless a row is larger than BatchMaxBytes itself.
+//
+// Failing reads are retried from the last batch handled, errors of the
+// callback are returned without retrying.
+func (c *PaginatedCursor) streamBatch(f func(RowBatch) error) (complete bool, err error) {
+	var callbackErr error
+
+	err = WithRetries(c.ReadRetries, 0, c.logger, "fetch rows", func() (err error) {
+		for {
+			complete, err = c.streamRows(f, &callbackErr)
+			if callbackErr != nil {
+				return nil
+			}
+			if !IsQueryInterrupted(err) {
+				return err
+			}
+
+			// the rows passed to the callback before the read was killed
+			// have been handled, only the rest of the batch is read again
+			c.logger.Info("read was killed while throttled, reading the batch again")
+		}
+	})
+	if callbackErr != nil {
+		return false, callbackErr
+	}
+
+	return complete, err
+}
+
+// streamRows reads the next batch of rows in a single transaction for
+// streamBatch. Errors of the callback are returned through callbackErr.
+func (c *PaginatedCursor) streamRows(f func(RowBatch) error, callbackErr *error) (complete bool, err error) {
+	if c.Throttler != nil {
+		WaitForThrottle(c.Throttler)
+	}
+
+	tx, err := c.begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	rowCount := 0
+	err = c.fetch(tx, c.BatchMaxBytes, func(batch InsertRowBatch, paginationKeypos *PaginationKeyData) error {
+		if batch.Size() == 0 {
+			return nil
+		}
+		rowCount += batch.Size()
+
+		if *callbackErr = c.checkProgress(paginationKeypos); *callbackErr != nil {
+			return *callbackErr
+		}
+
+		if *callbackErr = f(batch); *callbackErr != nil {
+			c.logger.WithError(*callbackErr).Error("failed to call each callback")
+			return *callbackErr
+		}
+
+		c.lastSuccessfulPaginationKey = paginationKeypos
+		return nil
+	})
+
+	return err == nil && rowCount == 0, err
+}
+
+func (c *PaginatedCursor) checkProgress(paginationKeypos *PaginationKeyData) error {
+	if c.lastSuccessfulPaginationKey == nil {
+		return nil
+	}
+
+	progress := paginationKeypos.Compare(c.lastSuccessfulPaginationKey)
+	if c.IterateInDescendingOrder && progress >= 0 || !c.IterateInDescendingOrder && progress <= 0 {
+		failedOperator := "<="
+		if c.IterateInDescendingOrder {
+			failedOperator = ">="
+		}
+		err := fmt.Errorf("new %s paginationKeypos %s %s lastSuccessfulPaginationKey %s (%d)", c.Table, paginationKeypos, failedOperator, c.lastSuccessfulPaginationKey, progress)
+		c.logger.WithError(err).Errorf("last successful paginationKey position did not advance")
+		return err
+	}
+
+	return nil
+}
+
 func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginationKeyData *PaginationKeyData, err error) {
+	err = c.fetch(db, 0, func(fetchedBatch InsertRowBatch, fetchedPaginationKeyData *PaginationKeyData) error {
+		batch = fetchedBatch
+		paginationKeyData = fetchedPaginationKeyData
+		return nil
+	})
+	return
+}
+
+// fetch reads the next batch of rows and passes them to the callback. If
+// maxBytes is non-zero, the rows are passed in several batches of about
+// maxBytes each, as they are read. The callback is called at least once,
+// with an empty batch if there are no more rows.
+func (c *PaginatedCursor) fetch(db SqlPreparer, maxBytes uint64, f func(InsertRowBatch, *PaginationKeyData) error) (err error) {
 	var selectBuilder squirrel.SelectBuilder
 
 	if c.BuildSelect != nil {
@@ -366,8 +524,22 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 		return
 	}
 
-	if c.RowLock {
-		selectBuilder = selectBuilder.Suffix("FOR UPDATE")
+	if c.StopAtMaxPaginationKey {
+		if len(c.paginationKeyColumn.Columns) != 1 {
+			err = fmt.Errorf("cannot stop at the max pagination key of %s on table %s", c.paginationKeyColumn, c.Table)
+			return
+		}
+		selectBuilder = selectBuilder.Where(squirrel.LtOrEq{quoteField(c.paginationKeyColumn.Columns[0].Name): c.MaxPaginationKey.Values[0]})
+	}
+
+	// the rows of a snapshot cannot change, and locking them would block the
+	// writes to the source for the whole copy
+	if c.RowLock && c.Snapshot == nil {
+		if c.SharedRowLock {
+			selectBuilder = selectBuilder.Suffix("LOCK IN SHARE MODE")
+		} else {
+			selectBuilder = selectBuilder.Suffix("FOR UPDATE")
+		}
 	}
 
 	query, args, err := selectBuilder.ToSql()
@@ -387,10 +559,32 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 		"sql":  loggedQuery,
 		"args": args,
 	})
-	if IncrediblyVerboseLogging {
+	if c.IncrediblyVerboseLogging {
 		logger.Debugf("full query: %s [%v]", query, args)
 	}
 
+	if c.QueryRegistry != nil {
+		var conn trackableConnection
+		var release func()
+		conn, release, err = c.singleConnection(db)
+		if err != nil {
+			logger.WithError(err).Error("failed to reserve connection")
+			return
+		}
+		// deferred first, such that the connection is only released once the
+		// query is untracked
+		defer release()
+		db = conn
+
+		var untrack func()
+		untrack, err = c.QueryRegistry.Track(conn, loggedQuery)
+		if err != nil {
+			logger.WithError(err).Error("failed to register query")
+			return
+		}
+		defer untrack()
+	}
+
 	// This query must be a prepared query. If it is not, querying will use
 	// MySQL's plain text interface, which will scan all values into []uint8
 	// if we give it []interface{}.
@@ -402,7 +596,14 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 
 	defer stmt.Close()
 
-	rows, err := stmt.Query(args...)
+	ctx, cancel := c.DB.QueryTimeoutContext(context.Background())
+	defer cancel()
+	defer c.DB.LogIfSlow(time.Now(), loggedQuery, logrus.Fields{
+		"table":         c.Table.String(),
+		"paginationKey": c.lastSuccessfulPaginationKey,
+	})
+
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		logger.WithError(err).Error("failed to query database")
 		return
@@ -418,6 +619,27 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 
 	var rowData RowData
 	var batchData []RowData
+	var batchBytes uint64
+	var rowCount int
+	var batchCount int
+
+	flush := func() error {
+		var paginationKeyData *PaginationKeyData
+		if len(batchData) > 0 {
+			paginationKeyData, err = NewPaginationKeyDataFromRow(batchData[len(batchData)-1], c.paginationKeyColumn)
+			if err != nil {
+				logger.WithError(err).Error("failed to get paginationKey data")
+				return err
+			}
+		}
+
+		batch := NewDataRowBatch(c.Table, batchData)
+		rowCount += batch.Size()
+		batchCount++
+		batchData = nil
+		batchBytes = 0
+		return f(batch, paginationKeyData)
+	}
 
 	for rows.Next() {
 		rowData, err = ScanGenericRow(rows, len(columns))
@@ -427,6 +649,16 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 		}
 
 		batchData = append(batchData, rowData)
+
+		if maxBytes > 0 {
+			batchBytes += rowData.ByteSize()
+			if batchBytes >= maxBytes {
+				err = flush()
+				if err != nil {
+					return
+				}
+			}
+		}
 	}
 
 	err = rows.Err()
@@ -434,20 +666,43 @@ func (c *PaginatedCursor) Fetch(db SqlPreparer) (batch InsertRowBatch, paginatio
 		return
 	}
 
-	if len(batchData) > 0 {
-		paginationKeyData, err = NewPaginationKeyDataFromRow(batchData[len(batchData)-1], c.paginationKeyColumn)
+	if len(batchData) > 0 || batchCount == 0 {
+		err = flush()
 		if err != nil {
-			logger.WithError(err).Error("failed to get paginationKey data")
 			return
 		}
 	}
 
-	batch = NewDataRowBatch(c.Table, batchData)
-	logger.Debugf("found %d/%d rows", batch.Size(), c.BatchSize)
+	logger.Debugf("found %d/%d rows in %d batches", rowCount, c.BatchSize, batchCount)
 
 	return
 }
 
+// trackableConnection runs all its statements on the same connection, such
+// that they can be registered with a QueryRegistry
+type trackableConnection interface {
+	SqlPreparer
+	sql.Connection
+}
+
+// singleConnection returns db if it runs all its statements on the same
+// connection, as the transactions do, or otherwise a connection reserved from
+// the pool of the cursor, which is released by the returned function
+func (c *PaginatedCursor) singleConnection(db SqlPreparer) (trackableConnection, func(), error) {
+	switch tx := db.(type) {
+	case *sql.Tx:
+		return tx, func() {}, nil
+	case *snapshotTx:
+		return tx, func() {}, nil
+	}
+
+	conn, err := c.DB.ReserveConn(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
 // returns a new PaginatedCursor with an embedded copy of itself
 func (c *CursorConfig) NewFullTableCursor(table *TableSchema, lockOnDB bool, tableLock *sync.RWMutex) *FullTableCursor {
 	// NOTE: We only allow internal table locking, if row-locking is disabled
@@ -461,6 +716,8 @@ func (c *CursorConfig) NewFullTableCursor(table *TableSchema, lockOnDB bool, tab
 		Table:       table,
 		BatchSize:   c.BatchSize,
 		ReadRetries: c.ReadRetries,
+		Snapshot:    c.Snapshot,
+		Logger:      c.Logger,
 		lockOnDB:    lockOnDB,
 		tableLock:   tableLock,
 	}
@@ -472,13 +729,24 @@ type FullTableCursor struct {
 	BatchSize   uint64
 	ReadRetries int
 
+	// If set, the table is read through a transaction of the snapshot,
+	// without locking it
+	Snapshot *ConsistentSnapshot
+
+	// Optional: defaults to the standard logrus logger
+	Logger *logrus.Entry
+
 	lockOnDB  bool
 	tableLock *sync.RWMutex
 	logger    *logrus.Entry
 }
 
 func (c *FullTableCursor) Each(f func(RowBatch) error) error {
-	c.logger = logrus.WithFields(logrus.Fields{
+	base := c.Logger
+	if base == nil {
+		base = logrus.NewEntry(logrus.StandardLogger())
+	}
+	c.logger = base.WithFields(logrus.Fields{
 		"table": c.Table.String(),
 		"tag":   "fullTableCursor",
 	})
@@ -495,7 +763,10 @@ func (c *FullTableCursor) Each(f func(RowBatch) error) error {
 
 	err = WithRetries(c.ReadRetries, 0, c.logger, "fetch rows", func() (err error) {
 		var tx SqlPreparerAndRollbacker
-		if c.lockOnDB {
+		if c.Snapshot != nil {
+			tx = c.Snapshot.Acquire()
+			defer tx.Rollback()
+		} else if c.lockOnDB {
 			tx, err = c.DB.Begin()
 			if err != nil {
 				return err
@@ -571,7 +842,7 @@ func (c *FullTableCursor) Each(f func(RowBatch) error) error {
 
 func (c *FullTableCursor) Fetch(db SqlPreparer, rowOffset int) (batch InsertRowBatch, err error) {
 	// NOTE: The caller already locked the table for us
-	selectBuilder := squirrel.Select("*").
+	selectBuilder := squirrel.Select(c.Table.QuotedColumnNames()...).
 		From(QuotedTableName(c.Table)).
 		Limit(c.BatchSize).
 		Offset(uint64(rowOffset))
@@ -600,7 +871,14 @@ func (c *FullTableCursor) Fetch(db SqlPreparer, rowOffset int) (batch InsertRowB
 
 	defer stmt.Close()
 
-	rows, err := stmt.Query(args...)
+	ctx, cancel := c.DB.QueryTimeoutContext(context.Background())
+	defer cancel()
+	defer c.DB.LogIfSlow(time.Now(), loggedQuery, logrus.Fields{
+		"table":     c.Table.String(),
+		"rowOffset": rowOffset,
+	})
+
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		logger.WithError(err).Error("failed to query database")
 		return
@@ -663,7 +941,11 @@ func ScanByteRow(rows *sqlorig.Rows, columnCount int) ([][]byte, error) {
 }
 
 func DefaultBuildSelect(columns []string, table *TableSchema, lastPaginationKey *PaginationKeyData, batchSize uint64, sortDescending bool) (squirrel.SelectBuilder, error) {
-	stmt := squirrel.Select(columns...).From(QuotedTableName(table))
+	from := QuotedTableName(table)
+	if table.ForcedIndex != "" {
+		from += " FORCE INDEX (" + quoteField(table.ForcedIndex) + ")"
+	}
+	stmt := squirrel.Select(columns...).From(from)
 
 	// selecting a resume position in the context of composite primary keys is
 	// not entirely trivial: consider a composite key of A+B and the following
@@ -0,0 +1,316 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+)
+
+const (
+	CutoverCheckBinlogDrained = "binlog_drained"
+	CutoverCheckVerification  = "verification"
+	CutoverCheckForeignWrites = "foreign_writes"
+	CutoverCheckAutoIncrement = "auto_increment"
+	CutoverCheckTriggers      = "triggers"
+	CutoverCheckForeignKeys   = "foreign_keys"
+)
+
+var cutoverChecks = map[string]bool{
+	CutoverCheckBinlogDrained: true,
+	CutoverCheckVerification:  true,
+	CutoverCheckForeignWrites: true,
+	CutoverCheckAutoIncrement: true,
+	CutoverCheckTriggers:      true,
+	CutoverCheckForeignKeys:   true,
+}
+
+// ValidateCutover runs the checks of the CutoverValidationConfig, to be
+// called once the binlog streaming stopped and Run returned. The given
+// verification is the result of the verification during cutover, or nil to
+// have the Verifier (if any) verify now.
+func (f *Ferry) ValidateCutover(verification *VerificationResult) *PreflightReport {
+	report := &PreflightReport{Name: "cutover"}
+	config := &f.Config.CutoverValidation
+
+	if !config.skipped(CutoverCheckBinlogDrained) {
+		f.checkBinlogDrained(report)
+	}
+	if !config.skipped(CutoverCheckVerification) {
+		f.checkVerification(report, verification)
+	}
+	if !config.skipped(CutoverCheckForeignWrites) {
+		f.checkForeignWrites(report)
+	}
+
+	// the rows of the stream-only tables are written by other means, which
+	// the cutover cannot vouch for
+	tables := f.copiedTables()
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].String() < tables[j].String()
+	})
+
+	if !config.skipped(CutoverCheckAutoIncrement) {
+		f.checkAutoIncrements(report, tables)
+	}
+	if !config.skipped(CutoverCheckTriggers) {
+		f.checkTableObjectsPresent(report, CutoverCheckTriggers, tables, "SELECT EVENT_OBJECT_TABLE, TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA = ?")
+	}
+	if !config.skipped(CutoverCheckForeignKeys) {
+		f.checkTableObjectsPresent(report, CutoverCheckForeignKeys, tables, "SELECT TABLE_NAME, CONSTRAINT_NAME FROM information_schema.REFERENTIAL_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = ?")
+	}
+
+	return report
+}
+
+// ValidateCutoverOrFail runs ValidateCutover if enabled, and fails the run
+// with the report unless all checks passed.
+func (f *Ferry) ValidateCutoverOrFail(verification *VerificationResult) {
+	if !f.Config.CutoverValidation.Enabled {
+		return
+	}
+
+	report := f.ValidateCutover(verification)
+	if !report.Passed() {
+		f.logger.Errorf("cutover validation failed:\n%s", report)
+		f.ErrorHandler.Fatal("cutover_validation", fmt.Errorf("cutover validation failed:\n%s", report))
+		return
+	}
+	f.logger.Infof("cutover validation passed:\n%s", report)
+}
+
+func (f *Ferry) checkBinlogDrained(report *PreflightReport) {
+	streamer := f.BinlogStreamer
+	if !streamer.stopRequested {
+		report.fail(CutoverCheckBinlogDrained, "the binlog streaming was not stopped", "stop writing to the source and call FlushBinlogAndStopStreaming first")
+		return
+	}
+
+	streamed := streamer.GetLastStreamedBinlogPosition()
+	if streamed.Compare(streamer.targetBinlogPosition) < 0 {
+		report.fail(CutoverCheckBinlogDrained, fmt.Sprintf("streamed up to %s, short of the stop position %s", streamed, streamer.targetBinlogPosition), "")
+		return
+	}
+
+	if pending := len(f.BinlogWriter.binlogEventBuffer); pending > 0 {
+		report.fail(CutoverCheckBinlogDrained, fmt.Sprintf("%d streamed binlog events were not applied to the target", pending), "")
+		return
+	}
+
+	report.pass(CutoverCheckBinlogDrained, fmt.Sprintf("streamed and applied up to %s", streamed))
+}
+
+func (f *Ferry) checkVerification(report *PreflightReport, verification *VerificationResult) {
+	if verification == nil {
+		if f.Verifier == nil {
+			report.warn(CutoverCheckVerification, "no verifier configured", "configure a VerifierType to verify the copied data")
+			return
+		}
+
+		result, err := f.Verifier.VerifyDuringCutover()
+		if err != nil {
+			report.fail(CutoverCheckVerification, fmt.Sprintf("verification failed: %v", err), "")
+			return
+		}
+		verification = &result
+	}
+
+	if !verification.DataCorrect {
+		report.fail(CutoverCheckVerification, verification.Message, "compare the incorrect tables and copy them again")
+		return
+	}
+	report.pass(CutoverCheckVerification, "no differences found")
+}
+
+func (f *Ferry) checkForeignWrites(report *PreflightReport) {
+	if f.foreignWriteGuard == nil {
+		report.warn(CutoverCheckForeignWrites, "the ForeignWriteGuard is disabled", "enable the ForeignWriteGuard to detect writes to the target")
+		return
+	}
+
+	foreignWrites := f.foreignWriteGuard.ForeignWrites()
+	if len(foreignWrites) > 0 {
+		descriptions := make([]string, len(foreignWrites))
+		for i, foreignWrite := range foreignWrites {
+			descriptions[i] = fmt.Sprintf("%s by session %d", foreignWrite.Table, foreignWrite.ThreadId)
+		}
+		report.fail(CutoverCheckForeignWrites, fmt.Sprintf("writes detected to %s", strings.Join(descriptions, ", ")), "find out which application writes to the target and compare the written rows")
+		return
+	}
+	report.pass(CutoverCheckForeignWrites, "no writes detected")
+}
+
+func (f *Ferry) checkAutoIncrements(report *PreflightReport, tables []*TableSchema) {
+	sourceValues, err := autoIncrementValues(f.SourceDB, tableSchemaNames(tables, nil))
+	if err != nil {
+		report.fail(CutoverCheckAutoIncrement, err.Error(), "")
+		return
+	}
+	targetValues, err := autoIncrementValues(f.TargetDB, tableSchemaNames(tables, f.Config.DatabaseRewrites))
+	if err != nil {
+		report.fail(CutoverCheckAutoIncrement, err.Error(), "")
+		return
+	}
+
+	behind := make([]string, 0)
+	for _, table := range tables {
+		sourceValue, found := sourceValues[table.String()]
+		if !found {
+			continue
+		}
+
+		targetName := f.targetTableName(table)
+		if targetValue := targetValues[targetName]; targetValue < sourceValue {
+			behind = append(behind, fmt.Sprintf("%s (%d < %d)", targetName, targetValue, sourceValue))
+		}
+	}
+
+	if len(behind) > 0 {
+		report.fail(CutoverCheckAutoIncrement, fmt.Sprintf("the AUTO_INCREMENT of the target is behind the source for %s", strings.Join(behind, ", ")), "enable AutoIncrementSync, or run ALTER TABLE ... AUTO_INCREMENT = <source value> on the target tables")
+		return
+	}
+	report.pass(CutoverCheckAutoIncrement, fmt.Sprintf("%d tables with AUTO_INCREMENT are not behind", len(sourceValues)))
+}
+
+// checkTableObjectsPresent checks that the objects of the source tables
+// listed by the query, such as triggers, exist on the target tables as well.
+// The query is given a schema and lists the tables and names of its objects.
+func (f *Ferry) checkTableObjectsPresent(report *PreflightReport, check string, tables []*TableSchema, query string) {
+	sourceObjects, err := tableObjects(f.SourceDB, tableSchemaNames(tables, nil), query)
+	if err != nil {
+		report.fail(check, err.Error(), "")
+		return
+	}
+	targetObjects, err := tableObjects(f.TargetDB, tableSchemaNames(tables, f.Config.DatabaseRewrites), query)
+	if err != nil {
+		report.fail(check, err.Error(), "")
+		return
+	}
+
+	count := 0
+	missing := make([]string, 0)
+	for _, table := range tables {
+		targetName := f.targetTableName(table)
+		present := make(map[string]bool)
+		for _, name := range targetObjects[targetName] {
+			present[name] = true
+		}
+
+		for _, name := range sourceObjects[table.String()] {
+			count++
+			if !present[name] {
+				missing = append(missing, fmt.Sprintf("%s on %s", name, targetName))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		report.fail(check, fmt.Sprintf("missing on the target: %s", strings.Join(missing, ", ")), fmt.Sprintf("create the %s of the source on the target", strings.Replace(check, "_", " ", -1)))
+		return
+	}
+	report.pass(check, fmt.Sprintf("all %d present on the target", count))
+}
+
+// targetTableName returns the fully qualified name of the table on the
+// target, after applying the rewrites
+func (f *Ferry) targetTableName(table *TableSchema) string {
+	schemaName, tableName := f.targetSchemaAndTableName(table)
+	return fmt.Sprintf("%s.%s", schemaName, tableName)
+}
+
+func (f *Ferry) targetSchemaAndTableName(table *TableSchema) (string, string) {
+	schemaName := table.Schema
+	if rewrite, exists := f.Config.DatabaseRewrites[schemaName]; exists {
+		schemaName = rewrite
+	}
+	tableName := table.Name
+	if rewrite, exists := f.Config.TableRewrites[tableName]; exists {
+		tableName = rewrite
+	}
+	return schemaName, tableName
+}
+
+func tableSchemaNames(tables []*TableSchema, rewrites map[string]string) []string {
+	seen := make(map[string]bool)
+	schemaNames := make([]string, 0)
+	for _, table := range tables {
+		schemaName := table.Schema
+		if rewrite, exists := rewrites[schemaName]; exists {
+			schemaName = rewrite
+		}
+		if !seen[schemaName] {
+			seen[schemaName] = true
+			schemaNames = append(schemaNames, schemaName)
+		}
+	}
+	return schemaNames
+}
+
+// autoIncrementValues returns the AUTO_INCREMENT values of the tables of the
+// schemas, by fully qualified table name
+func autoIncrementValues(db *sql.DB, schemaNames []string) (map[string]uint64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// MySQL 8.0 caches the AUTO_INCREMENT values in information_schema for a
+	// day by default, the variable does not exist before
+	tx.Exec("SET SESSION information_schema_stats_expiry = 0")
+
+	values := make(map[string]uint64)
+	for _, schemaName := range schemaNames {
+		rows, err := tx.Query("SELECT TABLE_NAME, AUTO_INCREMENT FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND AUTO_INCREMENT IS NOT NULL", schemaName)
+		if err != nil {
+			return nil, fmt.Errorf("reading AUTO_INCREMENT values of %s: %v", schemaName, err)
+		}
+
+		for rows.Next() {
+			var tableName string
+			var value uint64
+			if err = rows.Scan(&tableName, &value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("reading AUTO_INCREMENT values of %s: %v", schemaName, err)
+			}
+			values[fmt.Sprintf("%s.%s", schemaName, tableName)] = value
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading AUTO_INCREMENT values of %s: %v", schemaName, err)
+		}
+	}
+	return values, nil
+}
+
+// tableObjects returns the names listed by the query for the schemas, by
+// fully qualified table name
+func tableObjects(db *sql.DB, schemaNames []string, query string) (map[string][]string, error) {
+	objects := make(map[string][]string)
+	for _, schemaName := range schemaNames {
+		rows, err := db.Query(query, schemaName)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var tableName, name string
+			if err = rows.Scan(&tableName, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			qualifiedName := fmt.Sprintf("%s.%s", schemaName, tableName)
+			objects[qualifiedName] = append(objects[qualifiedName], name)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
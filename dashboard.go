@@ -0,0 +1,231 @@
+package ghostferry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RecentError is an error or warning logged by the ferry
+type RecentError struct {
+	Time    time.Time
+	Level   string
+	Tag     string
+	Message string
+	Error   string `json:",omitempty"`
+}
+
+// RecentErrors is a logrus hook keeping the most recent errors and warnings
+// logged, which are shown on the dashboard of the ControlServer.
+type RecentErrors struct {
+	size int
+
+	mutex  sync.Mutex
+	errors []RecentError
+}
+
+func NewRecentErrors(size int) *RecentErrors {
+	return &RecentErrors{size: size}
+}
+
+func (r *RecentErrors) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (r *RecentErrors) Fire(entry *logrus.Entry) error {
+	recentError := RecentError{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	if tag, ok := entry.Data["tag"].(string); ok {
+		recentError.Tag = tag
+	}
+	if err, ok := entry.Data[logrus.ErrorKey].(error); ok {
+		recentError.Error = err.Error()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.errors = append(r.errors, recentError)
+	if len(r.errors) > r.size {
+		r.errors = r.errors[len(r.errors)-r.size:]
+	}
+	return nil
+}
+
+// Errors returns the recent errors, oldest first
+func (r *RecentErrors) Errors() []RecentError {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	errors := make([]RecentError, len(r.errors))
+	copy(errors, r.errors)
+	return errors
+}
+
+// dashboardHTML is the dashboard served on /dashboard by the ControlServer.
+// It is embedded so that it is available without the webui directory, and
+// only uses the JSON API of the ControlServer.
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Ghostferry Dashboard</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <style>
+    body { font-family: sans-serif; margin: 1rem 2rem; color: #222; }
+    h1 { font-size: 1.4rem; }
+    h2 { font-size: 1.1rem; margin-top: 1.5rem; }
+    table { border-collapse: collapse; width: 100%; }
+    th, td { text-align: left; padding: 0.3rem 0.6rem; border-bottom: 1px solid #ddd; }
+    .summary td:first-child { font-weight: bold; width: 14rem; }
+    .bar { background: #eee; width: 12rem; height: 0.8rem; }
+    .bar div { background: #4a90d9; height: 100%; }
+    .warn { color: #c77c00; }
+    .error { color: #d0021b; }
+    button { margin-right: 0.5rem; }
+    form { display: inline; }
+  </style>
+</head>
+<body>
+  <h1>Ghostferry: <span id="state">connecting...</span></h1>
+
+  <table class="summary">
+    <tr><td>Binlog streamer lag</td><td id="lag"></td></tr>
+    <tr><td>Throttled</td><td id="throttled"></td></tr>
+    <tr><td>Keys per second</td><td id="speed"></td></tr>
+    <tr><td>ETA</td><td id="eta"></td></tr>
+    <tr><td>Time taken</td><td id="time-taken"></td></tr>
+  </table>
+
+  <h2>Controls</h2>
+  <button id="migration" onclick="togglePause('migration')">Pause migration</button>
+  <button id="replication" onclick="togglePause('replication')">Pause replication</button>
+  <form onsubmit="setMaxLag(event)">
+    <label>Max lag (s) <input id="max-lag" type="number" min="1" style="width: 5rem"></label>
+    <button type="submit">Throttle</button>
+  </form>
+
+  <h2>Tables</h2>
+  <table>
+    <thead><tr><th>Table</th><th>Action</th><th>Completion</th><th>Last key</th><th>Target key</th></tr></thead>
+    <tbody id="tables"></tbody>
+  </table>
+
+  <h2>Recent errors</h2>
+  <table>
+    <thead><tr><th>Time</th><th>Level</th><th>Component</th><th>Message</th></tr></thead>
+    <tbody id="errors"></tbody>
+  </table>
+
+  <script>
+    var paused = {migration: false, replication: false};
+
+    function text(id, value) {
+      document.getElementById(id).textContent = value;
+    }
+
+    function cell(row, value) {
+      var td = document.createElement("td");
+      td.textContent = value;
+      row.appendChild(td);
+      return td;
+    }
+
+    function duration(seconds) {
+      if (!(seconds > 0)) return "-";
+      var h = Math.floor(seconds / 3600), m = Math.floor(seconds % 3600 / 60), s = Math.floor(seconds % 60);
+      return (h ? h + "h" : "") + (h || m ? m + "m" : "") + s + "s";
+    }
+
+    function renderProgress(progress) {
+      text("state", progress.CurrentState);
+      text("lag", duration(progress.BinlogStreamerLag));
+      text("throttled", progress.TargetGuardReason ? "yes, " + progress.TargetGuardReason : (progress.Throttled ? "yes" : "no"));
+      text("speed", progress.PaginationKeysPerSecond);
+      text("eta", duration(progress.ETA));
+      text("time-taken", duration(progress.TimeTaken));
+
+      var tbody = document.getElementById("tables");
+      tbody.innerHTML = "";
+      Object.keys(progress.Tables || {}).sort().forEach(function(name) {
+        var table = progress.Tables[name];
+        var row = document.createElement("tr");
+        cell(row, name);
+        var action = cell(row, table.CurrentAction);
+        if (progress.QuarantinedTables && progress.QuarantinedTables[name]) {
+          action.className = "error";
+          action.title = progress.QuarantinedTables[name];
+        }
+        var completion = cell(row, "");
+        if (table.Completion >= 0) {
+          var bar = document.createElement("div");
+          bar.className = "bar";
+          bar.title = Math.round(table.Completion * 100) + "%";
+          var fill = document.createElement("div");
+          fill.style.width = (table.Completion * 100) + "%";
+          bar.appendChild(fill);
+          completion.appendChild(bar);
+        } else {
+          completion.textContent = "unknown";
+        }
+        cell(row, table.LastSuccessfulPaginationKey);
+        cell(row, table.TargetPaginationKey);
+        tbody.appendChild(row);
+      });
+    }
+
+    function refresh() {
+      fetch("/api/health").then(function(r) { return r.json(); }).then(function(status) {
+        paused.migration = status.MigrationThrottled;
+        paused.replication = status.ReplicationThrottled;
+        text("migration", (paused.migration ? "Resume" : "Pause") + " migration");
+        text("replication", (paused.replication ? "Resume" : "Pause") + " replication");
+      });
+
+      fetch("/api/tunables").then(function(r) { return r.json(); }).then(function(tunables) {
+        var input = document.getElementById("max-lag");
+        if (document.activeElement !== input) input.value = tunables.MaxLag || "";
+      });
+
+      fetch("/api/errors").then(function(r) { return r.json(); }).then(function(errors) {
+        var tbody = document.getElementById("errors");
+        tbody.innerHTML = "";
+        errors.reverse().forEach(function(error) {
+          var row = document.createElement("tr");
+          row.className = error.Level === "warning" ? "warn" : "error";
+          cell(row, new Date(error.Time).toLocaleTimeString());
+          cell(row, error.Level);
+          cell(row, error.Tag);
+          cell(row, error.Message + (error.Error ? ": " + error.Error : ""));
+          tbody.appendChild(row);
+        });
+      });
+    }
+
+    function togglePause(type) {
+      var action = paused[type] ? "unpause" : "pause";
+      fetch("/api/actions/" + action + "?type=" + type, {method: "POST"}).then(refresh);
+    }
+
+    function setMaxLag(event) {
+      event.preventDefault();
+      var maxLag = parseInt(document.getElementById("max-lag").value, 10);
+      fetch("/api/tunables", {method: "POST", body: JSON.stringify({MaxLag: maxLag})}).then(function(r) {
+        if (!r.ok) r.text().then(alert);
+        refresh();
+      });
+    }
+
+    new EventSource("/api/progress/stream").addEventListener("progress", function(event) {
+      renderProgress(JSON.parse(event.data));
+    });
+    refresh();
+    window.setInterval(refresh, 5000);
+  </script>
+</body>
+</html>
+`
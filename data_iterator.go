@@ -4,6 +4,7 @@ import (
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -17,34 +18,70 @@ type DataIterator struct {
 	CursorConfig *CursorConfig
 	StateTracker *StateTracker
 
+	// If set, the chunked columns of the tables are selected as empty
+	// values, see BlobChunker
+	BlobChunker *BlobChunker
+
+	// If set, decides whether failed table copies are retried or skipped,
+	// see ErrorPolicyConfig
+	ErrorPolicy *ErrorPolicyConfig
+	// The tables whose copy is given up on are added to the quarantine
+	Quarantine *TableQuarantine
+
+	// If set, large tables are copied in several ranges concurrently, see
+	// KeyRangeSplitConfig
+	KeyRangeSplit *KeyRangeSplitConfig
+
+	// keyed by the TableSchema, whose name changes when the table is renamed
 	targetPaginationKeys *sync.Map
+	// guards the CursorConfig whose BatchSize is changed while the tables
+	// are copied, see SetBatchSize
+	cursorConfigMutex    sync.RWMutex
 	failOnFirstCopyError bool
 	lockStrategy         string
 	batchListeners       []func(RowBatch) error
 	doneListeners        []func() error
 	logger               *logrus.Entry
+	metrics              *Metrics
 }
 
 func NewDataIterator(f *Ferry) *DataIterator {
+	db := f.componentDB(f.dataIteratorDB, f.SourceDB)
 	d := &DataIterator{
-		DB:                f.SourceDB,
+		DB:                db,
 		Concurrency:       f.Config.DataIterationConcurrency,
 		SelectFingerprint: f.Config.VerifierType == VerifierTypeInline,
 
 		ErrorHandler: f.ErrorHandler,
 		CursorConfig: &CursorConfig{
-			DB:        f.SourceDB,
-			Throttler: f.MigrationThrottler,
+			DB:        db,
+			Throttler: f.guardedThrottler(f.copyThrottler()),
 
-			BatchSize:   f.Config.DataIterationBatchSize,
-			ReadRetries: f.Config.DBReadRetries,
+			BatchSize:     f.Config.DataIterationBatchSize,
+			BatchMaxBytes: f.Config.DataIterationBatchMaxBytes,
+			ReadRetries:   f.Config.DBReadRetries,
 
 			IterateInDescendingOrder: f.Config.IterateInDescendingOrder,
+			SharedRowLock:            f.Config.DataIterationRowLock == RowLockShared,
+
+			Logger:                   f.Logger,
+			IncrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 		},
 		StateTracker: f.StateTracker,
+		BlobChunker:  f.blobChunker,
+		ErrorPolicy:  &f.Config.ErrorPolicy,
+		Quarantine:   f.quarantine,
 
 		failOnFirstCopyError: f.Config.FailOnFirstTableCopyError,
 		lockStrategy:         f.Config.LockStrategy,
+		logger:               f.loggerFor("data_iterator"),
+		metrics:              f.Metrics,
+	}
+	if f.queryKiller != nil {
+		d.CursorConfig.QueryRegistry = f.queryKiller.Registry
+	}
+	if f.Config.KeyRangeSplit.Enabled() {
+		d.KeyRangeSplit = &f.Config.KeyRangeSplit
 	}
 	d.ensureInitialized()
 	return d
@@ -57,6 +94,9 @@ func (d *DataIterator) ensureInitialized() {
 	if d.targetPaginationKeys == nil {
 		d.targetPaginationKeys = &sync.Map{}
 	}
+	if d.Quarantine == nil {
+		d.Quarantine = &TableQuarantine{}
+	}
 	if d.logger == nil {
 		d.logger = logrus.WithField("tag", "data_iterator")
 	}
@@ -84,6 +124,8 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 			// In a previous run, the table may have been completed.
 			// We don't need to reiterate those tables as it has already been done.
 			d.logger.WithField("table", tableName).Debug("table already copied completely, removing from unpaginagted table copy list")
+		} else if d.Quarantine.Contains(tableName) {
+			d.logger.WithField("table", tableName).Warn("table was quarantined in a previous run, not copying it")
 		} else {
 			tmp = append(tmp, table)
 		}
@@ -97,8 +139,11 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 			// We don't need to reiterate those tables as it has already been done.
 			d.logger.WithField("table", tableName).Debug("table already copied completely, removing from paginagted table copy list")
 			delete(paginatedTables, table)
+		} else if d.Quarantine.Contains(tableName) {
+			d.logger.WithField("table", tableName).Warn("table was quarantined in a previous run, not copying it")
+			delete(paginatedTables, table)
 		} else {
-			d.targetPaginationKeys.Store(table.String(), targetPaginationKey)
+			d.targetPaginationKeys.Store(table, targetPaginationKey)
 		}
 	}
 
@@ -110,16 +155,76 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 	// such as schemas changing on the source, but the copy races with the
 	// schema being altered on the target as well.
 	//
-	// XXX: We should detect changes in schemas of copy-in-progress tables and
-	// retry resuming the copy. For this we would simply have to re-queue a
-	// table to copy and, once it is re-read from the channel, wait until the
-	// schema has been updates. We could track a "schema version" for each
-	// table to track any incoming schema changes and wait for this version to
-	// change before re-attempting the copy. Of course there could be mulitple
-	// schema versions that we have to skip, but that should be simple to
-	// handle by trying and waiting multiple times.
+	// Changes in schemas of copy-in-progress tables are not errors: the copy
+	// resumes with the new schema once the BinlogWriter applied the change,
+	// see TableCopyVersion.
 	var lastError error
 
+	copyTable := func(table *TableSchema, process func(*TableSchema) error, tableLogger *logrus.Entry) {
+		for {
+			version := d.StateTracker.TableCopyVersion(table.String())
+			err := process(table)
+			if err == nil {
+				tableLogger.Info("done processing table")
+				return
+			}
+
+			if err == ErrTableTruncated {
+				tableLogger.Warn("table was truncated on the source, copying it again from scratch")
+				process, err = d.restartTableCopy(table)
+				if err == nil {
+					continue
+				}
+			}
+
+			// the schema of the table changed on the source, but the
+			// BinlogWriter did not apply the change yet
+			if IsSchemaAheadOfCache(err) {
+				tableLogger.WithError(err).Warn("schema of table changed on the source, waiting for the change to be applied")
+				if d.waitForTableCopyVersionChange(table, version) {
+					err = ErrTableSchemaChanged
+				}
+			}
+
+			if err == ErrTableSchemaChanged {
+				if d.StateTracker.IsTableComplete(table.String()) {
+					tableLogger.Info("table was dropped or moved out of the copied databases on the source, done processing table")
+					return
+				}
+				tableLogger.WithField("renamed_to", table.String()).Info("schema of table changed on the source, copying its remaining rows with the new schema")
+				continue
+			}
+
+			if e, ok := err.(BatchWriterVerificationFailed); ok {
+				tableLogger.WithField("incorrect_tables", e.table).Error(e.Error())
+				d.ErrorHandler.Fatal("inline_verifier", err)
+				return
+			}
+
+			tableLogger.WithError(err).Error("failed to iterate table")
+			switch d.ErrorPolicy.ActionFor("data_iterator", err) {
+			case ErrorActionRetry:
+				tableLogger.Warnf("retrying table copy in %s", d.ErrorPolicy.retryInterval)
+				time.Sleep(d.ErrorPolicy.retryInterval)
+				continue
+			case ErrorActionSkipTable:
+				tableLogger.Warn("quarantining table, its copy is given up on")
+				d.Quarantine.Add(table.String(), err)
+				if handler, ok := d.ErrorHandler.(TableErrorHandler); ok {
+					handler.SkipTable("data_iterator", table, err)
+				}
+				return
+			}
+
+			if d.failOnFirstCopyError {
+				d.ErrorHandler.Fatal("data_iterator", err)
+			}
+			tableLogger.Warn("suspending error until all table copies have been attempted")
+			lastError = err
+			return
+		}
+	}
+
 	paginatedTablesQueue := make(chan *TableSchema)
 	unpaginatedTablesQueue := make(chan *TableSchema)
 	wg := &sync.WaitGroup{}
@@ -128,6 +233,7 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 	for i := 0; i < d.Concurrency; i++ {
 		go func(i int) {
 			defer wg.Done()
+			defer RecoverPanic("data_iterator", d.ErrorHandler)
 
 			logger := d.logger.WithField("copy-instance", fmt.Sprintf("paginated-%d", i))
 			for {
@@ -139,23 +245,7 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 				tableLogger := logger.WithField("table", table.String())
 				tableLogger.Info("starting to process table")
 
-				err = d.processPaginatedTable(table)
-				if err != nil {
-					switch e := err.(type) {
-					case BatchWriterVerificationFailed:
-						tableLogger.WithField("incorrect_tables", e.table).Error(e.Error())
-						d.ErrorHandler.Fatal("inline_verifier", err)
-					default:
-						tableLogger.WithError(err).Error("failed to iterate table")
-						if d.failOnFirstCopyError {
-							d.ErrorHandler.Fatal("data_iterator", err)
-						}
-						tableLogger.Warn("suspending error until all table copies have been attempted")
-						lastError = err
-					}
-				} else {
-					tableLogger.Info("done processing table")
-				}
+				copyTable(table, d.processPaginatedTable, tableLogger)
 			}
 
 			logger.Info("copier shutting down")
@@ -169,6 +259,7 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 	// goroutine completes fast whereas the above one could take a long time.
 	go func() {
 		defer wg.Done()
+		defer RecoverPanic("data_iterator", d.ErrorHandler)
 
 		logger := d.logger.WithField("copy-instance", "unpaginated")
 		for {
@@ -180,15 +271,7 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 			tableLogger := logger.WithField("table", table.String())
 			tableLogger.Info("starting to process table")
 
-			err := d.processUnpaginatedTable(table)
-			if err == nil {
-				tableLogger.Info("done processing table")
-			} else if d.failOnFirstCopyError {
-				d.ErrorHandler.Fatal("data_iterator", err)
-			} else {
-				tableLogger.Warn("suspending error until all table copies have been attempted")
-				lastError = err
-			}
+			copyTable(table, d.processUnpaginatedTable, tableLogger)
 		}
 
 		logger.Info("copier shutting down")
@@ -240,7 +323,7 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 func (d *DataIterator) processPaginatedTable(table *TableSchema) error {
 	logger := d.logger.WithField("table", table.String())
 
-	targetPaginationKeyDataInterface, found := d.targetPaginationKeys.Load(table.String())
+	targetPaginationKeyDataInterface, found := d.targetPaginationKeys.Load(table)
 	if !found {
 		err := fmt.Errorf("%s not found in targetPaginationKeys, this is likely a programmer error", table.String())
 		logger.WithError(err).Error("this is definitely a bug")
@@ -248,6 +331,9 @@ func (d *DataIterator) processPaginatedTable(table *TableSchema) error {
 	}
 	targetPaginationKeyData := targetPaginationKeyDataInterface.(*PaginationKeyData)
 
+	// the batches read before the table is truncated or its schema changed
+	// are not written, see StateTracker.TruncateTable and ChangeTableSchema
+	version := d.StateTracker.TableCopyVersion(table.String())
 	startPaginationKeyData, completed := d.StateTracker.LastSuccessfulPaginationKey(table.String())
 	if completed {
 		err := fmt.Errorf("%v has been marked as completed but a table iterator has been spawned, this is likely a programmer error which resulted in the inconsistent starting state", table.String())
@@ -255,6 +341,31 @@ func (d *DataIterator) processPaginatedTable(table *TableSchema) error {
 		return err
 	}
 
+	keyRanges, err := d.keyRanges(table, startPaginationKeyData, targetPaginationKeyData)
+	if err != nil {
+		logger.WithError(err).Error("failed to split table into key ranges")
+		return err
+	}
+	if keyRanges != nil {
+		return d.copyKeyRanges(table, keyRanges, version, logger)
+	}
+
+	err = d.copyPaginationKeyRange(table, startPaginationKeyData, targetPaginationKeyData, false, logger, func(batch RowBatch) error {
+		return d.writeBatch(batch, version)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("table iteration completed")
+	return nil
+}
+
+// copyPaginationKeyRange copies the rows of the table after the start up to
+// the end, passing the batches to handle. If stopAtEnd is set, the rows after
+// the end are not read, otherwise they are read until the batch reaching the
+// end.
+func (d *DataIterator) copyPaginationKeyRange(table *TableSchema, startPaginationKeyData, endPaginationKeyData *PaginationKeyData, stopAtEnd bool, logger *logrus.Entry, handle func(RowBatch) error) error {
 	// NOTE: Using a lock to synchronize data iteration and binlog writing is
 	// necessary. It is possible that we read data on the source while the
 	// binlog receives an update to the same data.
@@ -276,25 +387,33 @@ func (d *DataIterator) processPaginatedTable(table *TableSchema) error {
 	// source data is not modified between reading from the source and writing
 	// the batch to the target.
 	var cursor *PaginatedCursor
+	d.cursorConfigMutex.RLock()
 	if d.lockStrategy == LockStrategySourceDB {
-		cursor = d.CursorConfig.NewPaginatedCursor(table, startPaginationKeyData, targetPaginationKeyData)
+		cursor = d.CursorConfig.NewPaginatedCursor(table, startPaginationKeyData, endPaginationKeyData)
 	} else {
 		var tableLock *sync.RWMutex
 		if d.lockStrategy == LockStrategyInGhostferry {
 			tableLock = d.StateTracker.GetTableLock(table.String())
 		}
-		cursor = d.CursorConfig.NewPaginatedCursorWithoutRowLock(table, startPaginationKeyData, targetPaginationKeyData, tableLock)
+		cursor = d.CursorConfig.NewPaginatedCursorWithoutRowLock(table, startPaginationKeyData, endPaginationKeyData, tableLock)
 	}
-	if d.SelectFingerprint {
-		if len(cursor.ColumnsToSelect) == 0 {
-			cursor.ColumnsToSelect = []string{"*"}
+	d.cursorConfigMutex.RUnlock()
+	cursor.StopAtMaxPaginationKey = stopAtEnd
+	// the rows are selected with the columns of the cached schema, as the
+	// schema on the source may be ahead of the one they are written with.
+	// Such batches are not written, see checkSourceColumns.
+	cursor.ColumnsToSelect = table.QuotedColumnNames()
+	if d.BlobChunker != nil {
+		if columns := d.BlobChunker.ColumnsToSelect(table); columns != nil {
+			cursor.ColumnsToSelect = columns
 		}
-
+	}
+	if d.SelectFingerprint {
 		cursor.ColumnsToSelect = append(cursor.ColumnsToSelect, table.RowMd5Query())
 	}
 
-	err := cursor.Each(func(batch RowBatch) error {
-		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
+	return cursor.Each(func(batch RowBatch) error {
+		d.metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
 			MetricTag{"table", table.Name},
 			MetricTag{"source", "table"},
 		}, 1.0)
@@ -323,22 +442,12 @@ func (d *DataIterator) processPaginatedTable(table *TableSchema) error {
 			}
 		}
 
-		for _, listener := range d.batchListeners {
-			err := listener(batch)
-			if err != nil {
-				logger.WithError(err).Error("failed to process row batch with listeners")
-				return err
-			}
+		err := handle(batch)
+		if err != nil && err != ErrTableTruncated && err != ErrTableSchemaChanged && err != ErrSourceSchemaAheadOfCache && err != errKeyRangeCopyAborted {
+			logger.WithError(err).Error("failed to process row batch with listeners")
 		}
-
-		return nil
-	})
-	if err != nil {
 		return err
-	}
-
-	logger.Debug("table iteration completed")
-	return nil
+	})
 }
 
 func (d *DataIterator) processUnpaginatedTable(table *TableSchema) error {
@@ -349,34 +458,139 @@ func (d *DataIterator) processUnpaginatedTable(table *TableSchema) error {
 	if d.lockStrategy == LockStrategyInGhostferry {
 		tableLock = d.StateTracker.GetTableLock(table.String())
 	}
+	version := d.StateTracker.TableCopyVersion(table.String())
+	d.cursorConfigMutex.RLock()
 	cursor := d.CursorConfig.NewFullTableCursor(table, d.lockStrategy == LockStrategySourceDB, tableLock)
+	d.cursorConfigMutex.RUnlock()
 
 	err := cursor.Each(func(batch RowBatch) error {
-		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
+		d.metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
 			MetricTag{"table", table.Name},
 			MetricTag{"source", "table"},
 		}, 1.0)
 
-		for _, listener := range d.batchListeners {
-			err := listener(batch)
-			if err != nil {
-				logger.WithError(err).Error("failed to process full-table row batch with listeners")
+		err := d.writeBatch(batch, version)
+		if err != nil && err != ErrTableTruncated && err != ErrTableSchemaChanged && err != ErrSourceSchemaAheadOfCache {
+			logger.WithError(err).Error("failed to process full-table row batch with listeners")
+		}
+		return err
+	})
+
+	if err != nil {
+		logger.WithError(err).Error("failed to scan full table")
+		return err
+	}
+
+	logger.Debug("full table scan completed")
+	return nil
+}
+
+// writeBatch passes the batch to the listeners, unless the table was
+// truncated or its schema changed since its copy started, or the schema of
+// the table on the source is ahead of the cached one
+func (d *DataIterator) writeBatch(batch RowBatch, version TableCopyVersion) error {
+	return d.StateTracker.WriteCopyBatch(batch.TableSchema().String(), version, func() error {
+		if batch.Size() > 0 {
+			if err := d.checkSourceColumns(batch.TableSchema()); err != nil {
 				return err
 			}
 		}
 
+		for _, listener := range d.batchListeners {
+			if err := listener(batch); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
+}
 
+// checkSourceColumns returns ErrSourceSchemaAheadOfCache if the columns of
+// the table on the source differ from the cached ones. The rows are read with
+// the cached columns, so rows read after a column was added on the source
+// lack its values, and their binlog events may have been skipped as they were
+// not copied yet. They are read again once the BinlogWriter applied the
+// change, see waitForTableCopyVersionChange. As the batch was read before,
+// the rows read before the change on the source are not affected.
+func (d *DataIterator) checkSourceColumns(table *TableSchema) error {
+	rows, err := d.DB.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", QuotedTableName(table)))
 	if err != nil {
-		logger.WithError(err).Error("failed to scan full table")
 		return err
 	}
+	defer rows.Close()
 
-	logger.Debug("full table scan completed")
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if len(columns) != len(table.Columns) {
+		return ErrSourceSchemaAheadOfCache
+	}
+	for i, column := range columns {
+		if column != table.Columns[i].Name {
+			return ErrSourceSchemaAheadOfCache
+		}
+	}
 	return nil
 }
 
+// waitForTableCopyVersionChange waits until the BinlogWriter truncated the
+// table or changed its schema since the version, and returns whether it did
+// before the timeout. The writer may be far behind the source, or never reach
+// the change if the copy failed for another reason, in which case the error
+// is handled by the ErrorPolicy.
+func (d *DataIterator) waitForTableCopyVersionChange(table *TableSchema, version TableCopyVersion) bool {
+	deadline := time.Now().Add(tableCopyVersionChangeTimeout)
+	for time.Now().Before(deadline) {
+		if d.StateTracker.TableCopyVersion(table.String()) != version {
+			return true
+		}
+		time.Sleep(tableCopyVersionPollInterval)
+	}
+	return false
+}
+
+// restartTableCopy returns how to copy a table again after it was truncated,
+// as it may have become empty, or its rows now have other pagination keys
+func (d *DataIterator) restartTableCopy(table *TableSchema) (func(*TableSchema) error, error) {
+	paginatedTables, _, err := GetTargetPaginationKeys(d.DB, []*TableSchema{table}, d.CursorConfig.IterateInDescendingOrder, d.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	targetPaginationKey, paginated := paginatedTables[table]
+	if !paginated {
+		d.targetPaginationKeys.Delete(table)
+		return d.processUnpaginatedTable, nil
+	}
+	d.targetPaginationKeys.Store(table, targetPaginationKey)
+	return d.processPaginatedTable, nil
+}
+
+// TargetPaginationKeys returns the pagination keys up to which the tables
+// are copied, by table name. Only contains the paginated tables being copied
+// by Run.
+func (d *DataIterator) TargetPaginationKeys() map[string]*PaginationKeyData {
+	d.ensureInitialized()
+
+	targetPaginationKeys := make(map[string]*PaginationKeyData)
+	d.targetPaginationKeys.Range(func(k, v interface{}) bool {
+		targetPaginationKeys[k.(*TableSchema).String()] = v.(*PaginationKeyData)
+		return true
+	})
+	return targetPaginationKeys
+}
+
+// SetBatchSize changes the BatchSize of the cursors of the tables whose copy
+// starts from now on, see Ferry.UpdateTunables
+func (d *DataIterator) SetBatchSize(batchSize uint64) {
+	d.cursorConfigMutex.Lock()
+	defer d.cursorConfigMutex.Unlock()
+
+	d.CursorConfig.BatchSize = batchSize
+}
+
 func (d *DataIterator) AddBatchListener(listener func(RowBatch) error) {
 	d.batchListeners = append(d.batchListeners, listener)
 }
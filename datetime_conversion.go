@@ -0,0 +1,176 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+// DateTimeConverter converts the values of DATETIME columns between time
+// zones, as they are written to the target, see Config.DateTimeConversion.
+//
+// The values are converted in place, in the formats they are read in from the
+// source, both by the copy and from the binlogs: strings or []byte such as
+// "2006-01-02 15:04:05.999999". Zero dates are left unchanged.
+type DateTimeConverter struct {
+	Config *DateTimeConversionConfig
+
+	from *time.Location
+	to   *time.Location
+}
+
+// NewDateTimeConverter validates the configured columns against the tables,
+// and excludes them from the verification of the tables.
+func NewDateTimeConverter(config *DateTimeConversionConfig, tables TableSchemaCache) (*DateTimeConverter, error) {
+	from, err := loadTimeZone(config.FromTimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := loadTimeZone(config.ToTimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	for schemaName, tableConfig := range config.Columns {
+		for tableName, columns := range tableConfig {
+			table := tables.Get(schemaName, tableName)
+			if table == nil {
+				// the table may have been filtered
+				continue
+			}
+
+			for _, name := range columns {
+				index := table.FindColumn(name)
+				if index < 0 {
+					return nil, fmt.Errorf("column %s of table %s does not exist", name, table)
+				}
+
+				if table.Columns[index].Type != schema.TYPE_DATETIME {
+					return nil, fmt.Errorf("column %s of table %s is not a DATETIME column", name, table)
+				}
+
+				if table.PaginationKey != nil {
+					for _, paginationKeyColumn := range table.PaginationKey.Columns {
+						if paginationKeyColumn.Name == name {
+							return nil, fmt.Errorf("column %s of table %s is part of the pagination key", name, table)
+						}
+					}
+				}
+
+				if table.IgnoredColumnsForVerification == nil {
+					table.IgnoredColumnsForVerification = make(map[string]struct{})
+				}
+				table.IgnoredColumnsForVerification[name] = struct{}{}
+			}
+		}
+	}
+
+	return &DateTimeConverter{
+		Config: config,
+		from:   from,
+		to:     to,
+	}, nil
+}
+
+// ConvertRowBatch converts the values of the rows of the batch
+func (c *DateTimeConverter) ConvertRowBatch(batch RowBatch) error {
+	insertBatch, ok := batch.(InsertRowBatch)
+	if !ok {
+		return nil
+	}
+
+	table := batch.TableSchema()
+	if dataBatch, ok := batch.(*DataRowBatch); ok {
+		table = dataBatch.ReadTableSchema()
+	}
+
+	indices := c.columnIndices(table)
+	if len(indices) == 0 {
+		return nil
+	}
+
+	for _, row := range insertBatch.Values() {
+		if err := c.convertRow(row, indices); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertDMLEvent converts the old and new values of the event
+func (c *DateTimeConverter) ConvertDMLEvent(event DMLEvent) error {
+	indices := c.columnIndices(event.TableSchema())
+	if len(indices) == 0 {
+		return nil
+	}
+
+	if err := c.convertRow(event.OldValues(), indices); err != nil {
+		return err
+	}
+
+	return c.convertRow(event.NewValues(), indices)
+}
+
+func (c *DateTimeConverter) columnIndices(table *TableSchema) []int {
+	var indices []int
+	for _, name := range c.Config.ColumnsFor(table.Schema, table.Name) {
+		if index := table.FindColumn(name); index >= 0 {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+func (c *DateTimeConverter) convertRow(row RowData, indices []int) error {
+	if row == nil {
+		return nil
+	}
+
+	for _, index := range indices {
+		if index >= len(row) {
+			continue
+		}
+
+		var err error
+		switch v := row[index].(type) {
+		case string:
+			row[index], err = c.convert(v)
+		case []byte:
+			if v != nil {
+				var converted string
+				converted, err = c.convert(string(v))
+				row[index] = []byte(converted)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DateTimeConverter) convert(value string) (string, error) {
+	if strings.HasPrefix(value, "0000-00-00") {
+		return value, nil
+	}
+
+	// keep the fractional seconds digits of the column
+	layout := dateTimeLayout
+	if dot := strings.IndexByte(value, '.'); dot >= 0 {
+		layout += "." + strings.Repeat("0", len(value)-dot-1)
+	}
+
+	t, err := time.ParseInLocation(layout, value, c.from)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert DATETIME value %q: %v", value, err)
+	}
+
+	return t.In(c.to).Format(layout), nil
+}
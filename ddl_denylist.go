@@ -0,0 +1,108 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DDLClassDropTable   = "DROP TABLE"
+	DDLClassTruncate    = "TRUNCATE"
+	DDLClassRenameTable = "RENAME TABLE"
+	DDLClassAlterTable  = "ALTER TABLE"
+	DDLClassCreateTable = "CREATE TABLE"
+
+	DDLDenylistActionSkip = "skip"
+	DDLDenylistActionHalt = "halt"
+)
+
+var ddlClasses = []string{
+	DDLClassDropTable,
+	DDLClassTruncate,
+	DDLClassRenameTable,
+	DDLClassAlterTable,
+	DDLClassCreateTable,
+}
+
+type DeniedDDLError struct {
+	Class     string
+	Table     *QualifiedTableName
+	Statement string
+}
+
+func (e DeniedDDLError) Error() string {
+	return fmt.Sprintf("refusing to apply %s statement on %s to the target, as it is denied by the DDLDenylist", e.Class, e.Table)
+}
+
+// DDLStatementClass returns the class of a DDL statement (one of the
+// DDLClass* constants), or an empty string for other statements. The
+// statements on databases have no class, as the binlog writer never applies
+// them.
+func DDLStatementClass(sqlStatement string) string {
+	tokens := strings.Fields(strings.ToUpper(sqlStatement))
+	if len(tokens) < 2 {
+		if len(tokens) == 1 && tokens[0] == "TRUNCATE" {
+			return DDLClassTruncate
+		}
+		return ""
+	}
+
+	switch tokens[0] {
+	case "TRUNCATE":
+		return DDLClassTruncate
+	case "RENAME":
+		if tokens[1] == "TABLE" || tokens[1] == "TABLES" {
+			return DDLClassRenameTable
+		}
+	case "DROP":
+		if tokens[1] == "TABLE" || tokens[1] == "TABLES" {
+			return DDLClassDropTable
+		}
+	case "ALTER":
+		for _, token := range tokens[1:] {
+			if token == "TABLE" {
+				return DDLClassAlterTable
+			}
+			if token != "ONLINE" && token != "IGNORE" {
+				break
+			}
+		}
+	case "CREATE":
+		for _, token := range tokens[1:] {
+			if token == "TABLE" {
+				return DDLClassCreateTable
+			}
+			if token != "TEMPORARY" {
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
+// checkDDLDenylist returns whether the schema change of the statement on the
+// table is denied by the DDLDenylist, such that it must not be applied. The
+// DeniedDDLError is returned if the run must halt.
+func (b *BinlogWriter) checkDDLDenylist(ev *ReplicationEvent, statement string, table *QualifiedTableName) (bool, error) {
+	class := DDLStatementClass(statement)
+	if !b.DDLDenylist.Denies(class) {
+		return false, nil
+	}
+
+	deniedErr := DeniedDDLError{
+		Class:     class,
+		Table:     table,
+		Statement: statement,
+	}
+	b.metrics.Count("DeniedSchemaEvent", 1, []MetricTag{
+		MetricTag{"table", table.String()},
+		MetricTag{"class", class},
+	}, 1.0)
+
+	if b.DDLDenylist.Action == DDLDenylistActionSkip {
+		b.logger.WithError(deniedErr).Errorf("skipping denied schema change at %v", ev.BinlogPosition)
+		return true, nil
+	}
+	return true, deniedErr
+}
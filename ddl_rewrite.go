@@ -0,0 +1,170 @@
+package ghostferry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DDLRewriteConfig configures how schema changes are adapted before they are
+// applied to the target. The rewrites are textual, so they also apply to
+// matching text in string literals and comments of a statement.
+type DDLRewriteConfig struct {
+	// Replace the storage engine of tables, by engine name (case-insensitive).
+	// Mapping an engine to the empty string strips the ENGINE option, such
+	// that the default engine of the target is used.
+	//
+	// Optional: defaults to keeping all engines
+	Engines map[string]string
+
+	// Replace the ROW_FORMAT of tables, by row format (case-insensitive).
+	// Mapping a row format to the empty string strips the option.
+	//
+	// Optional: defaults to keeping all row formats
+	RowFormats map[string]string
+
+	// Replace the TABLESPACE of tables, by tablespace name. Mapping a
+	// tablespace to the empty string strips the option.
+	//
+	// Optional: defaults to keeping all tablespaces
+	Tablespaces map[string]string
+
+	// Remove DEFINER clauses, such that objects are created by the target
+	// user, who may not have the privileges to create objects for others.
+	//
+	// Optional: defaults to false
+	StripDefiners bool
+
+	// Remove PARTITION BY clauses, such that tables are not partitioned on
+	// the target.
+	//
+	// Optional: defaults to false
+	StripPartitioning bool
+}
+
+var (
+	ddlEngineRegexp              = regexp.MustCompile("(?i)\\s*\\bENGINE\\b\\s*=?\\s*([\\w]+)")
+	ddlRowFormatRegexp           = regexp.MustCompile("(?i)\\s*\\bROW_FORMAT\\b\\s*=?\\s*([\\w]+)")
+	ddlTablespaceRegexp          = regexp.MustCompile("(?i)\\s*\\bTABLESPACE\\b\\s*=?\\s*(`[^`]+`|[\\w$]+)")
+	ddlTablespaceStatementRegexp = regexp.MustCompile("(?i)^\\s*(?:CREATE|ALTER|DROP)(?:\\s+UNDO)?\\s+TABLESPACE\\b")
+	ddlDefinerRegexp             = regexp.MustCompile("(?i)\\s*\\bDEFINER\\s*=\\s*(?:CURRENT_USER(?:\\(\\))?|(?:'[^']*'|`[^`]*`|[\\w.$]+)(?:\\s*@\\s*(?:'[^']*'|`[^`]*`|[\\w.%$-]+))?)")
+	ddlPartitioningRegexp        = regexp.MustCompile("(?is)\\s*(?:/\\*!\\d+\\s*PARTITION\\s+BY\\b.*\\*/|\\bPARTITION\\s+BY\\b.*)$")
+)
+
+// DDLRewriter applies a DDLRewriteConfig and the database rewrites of the
+// ferry to DDL statements.
+type DDLRewriter struct {
+	Config           DDLRewriteConfig
+	DatabaseRewrites map[string]string
+
+	databaseNameRegexp *regexp.Regexp
+}
+
+func NewDDLRewriter(config DDLRewriteConfig, databaseRewrites map[string]string) *DDLRewriter {
+	r := &DDLRewriter{
+		Config:           config,
+		DatabaseRewrites: databaseRewrites,
+	}
+	if len(databaseRewrites) == 0 {
+		return r
+	}
+
+	// the longest names first, as the leftmost alternative matching wins
+	sourceNames := make([]string, 0, len(databaseRewrites))
+	for sourceName := range databaseRewrites {
+		sourceNames = append(sourceNames, sourceName)
+	}
+	sort.Slice(sourceNames, func(i, j int) bool {
+		return len(sourceNames[i]) > len(sourceNames[j])
+	})
+
+	// a database name qualifying an object, e.g. `db`.`table` or db.table
+	alternatives := make([]string, 0, 2*len(sourceNames))
+	for _, sourceName := range sourceNames {
+		quotedName := regexp.QuoteMeta(sourceName)
+		alternatives = append(alternatives, "`"+strings.Replace(quotedName, "`", "``", -1)+"`", "\\b"+quotedName)
+	}
+	r.databaseNameRegexp = regexp.MustCompile("(?:" + strings.Join(alternatives, "|") + ")\\s*\\.")
+
+	return r
+}
+
+// RewriteOptions applies the configured rewrites of table options and
+// clauses to the statement.
+func (r *DDLRewriter) RewriteOptions(statement string) string {
+	statement = replaceMappedOption(statement, ddlEngineRegexp, "ENGINE", r.Config.Engines, true)
+	statement = replaceMappedOption(statement, ddlRowFormatRegexp, "ROW_FORMAT", r.Config.RowFormats, true)
+	// the option of tables, not CREATE/ALTER/DROP TABLESPACE statements
+	if !ddlTablespaceStatementRegexp.MatchString(statement) {
+		statement = replaceMappedOption(statement, ddlTablespaceRegexp, "TABLESPACE", r.Config.Tablespaces, false)
+	}
+
+	if r.Config.StripDefiners {
+		statement = ddlDefinerRegexp.ReplaceAllString(statement, "")
+	}
+	if r.Config.StripPartitioning {
+		statement = ddlPartitioningRegexp.ReplaceAllString(statement, "")
+	}
+
+	return statement
+}
+
+// RewriteDatabaseNames renames the databases qualifying objects in the
+// statement according to the database rewrites. All names are replaced in a
+// single pass, such that a renamed database is not renamed again, e.g. when
+// the rewrites swap two databases.
+func (r *DDLRewriter) RewriteDatabaseNames(statement string) string {
+	if r.databaseNameRegexp == nil {
+		return statement
+	}
+
+	return r.databaseNameRegexp.ReplaceAllStringFunc(statement, func(match string) string {
+		name := strings.TrimRightFunc(strings.TrimSuffix(match, "."), unicode.IsSpace)
+		separator := match[len(name):]
+		if strings.HasPrefix(name, "`") {
+			name = strings.Replace(name[1:len(name)-1], "``", "`", -1)
+		}
+		return QuotedDatabaseNameFromString(r.DatabaseRewrites[name]) + separator
+	})
+}
+
+// AsSQLString builds the statement applying a schema change on the target,
+// unlike DDLEvent.AsSQLString allowing the database to be renamed.
+func (r *DDLRewriter) AsSQLString(event DDLEvent, schemaName, tableName string) (string, error) {
+	// renaming tables would require rewriting every reference to them in the
+	// statement, which cannot be done reliably without parsing it
+	if tableName != event.Table() {
+		return "", fmt.Errorf(
+			"cannot use remapped tableName %s for migration of %s.%s",
+			tableName,
+			event.Database(),
+			event.Table(),
+		)
+	}
+
+	statement := r.RewriteDatabaseNames(r.RewriteOptions(event.SqlCommand()))
+	return "USE " + QuotedDatabaseNameFromString(schemaName) + ";\n" + statement, nil
+}
+
+func replaceMappedOption(statement string, optionRegexp *regexp.Regexp, option string, mapping map[string]string, caseInsensitive bool) string {
+	if len(mapping) == 0 {
+		return statement
+	}
+
+	return optionRegexp.ReplaceAllStringFunc(statement, func(match string) string {
+		value := optionRegexp.FindStringSubmatch(match)[1]
+		unquotedValue := strings.Trim(value, "`")
+
+		for from, to := range mapping {
+			if from == unquotedValue || (caseInsensitive && strings.EqualFold(from, unquotedValue)) {
+				if to == "" {
+					return ""
+				}
+				return " " + option + "=" + to
+			}
+		}
+		return match
+	})
+}
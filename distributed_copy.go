@@ -0,0 +1,484 @@
+package ghostferry
+
+import (
+	"context"
+	sqlorig "database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DistributedCopyRoleCoordinator = "coordinator"
+	DistributedCopyRoleWorker      = "worker"
+)
+
+// TableLeases are the leases of the tables copied by the processes of a
+// distributed copy, stored in a table next to the state tables. The leases
+// expire according to the clock of the target, so the clocks of the
+// processes do not need to be in sync.
+type TableLeases struct {
+	DB            *sql.DB
+	Table         string
+	WorkerId      string
+	LeaseDuration time.Duration
+
+	held   map[string]bool
+	mutex  sync.Mutex
+	logger *logrus.Entry
+}
+
+func NewTableLeases(db *sql.DB, table, workerId string, leaseDuration time.Duration, logger *logrus.Entry) *TableLeases {
+	return &TableLeases{
+		DB:            db,
+		Table:         table,
+		WorkerId:      workerId,
+		LeaseDuration: leaseDuration,
+		held:          make(map[string]bool),
+		logger:        logger,
+	}
+}
+
+// Initialize creates the table of the leases. The workers wait for it to
+// exist, as the coordinator creates it once the tables to copy exist on the
+// target, see Exists.
+func (l *TableLeases) Initialize() error {
+	_, err := l.DB.Exec(`
+CREATE TABLE IF NOT EXISTS ` + l.Table + ` (
+    table_name varchar(255) CHARACTER SET ascii NOT NULL,
+    worker_id varchar(255) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (table_name)
+)`)
+	if err != nil {
+		return fmt.Errorf("creating table lease table %s: %v", l.Table, err)
+	}
+	return nil
+}
+
+func (l *TableLeases) Exists() (bool, error) {
+	parts := strings.SplitN(l.Table, ".", 2)
+
+	var count int
+	err := l.DB.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", parts[0], parts[1]).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("looking up table lease table %s: %v", l.Table, err)
+	}
+	return count > 0, nil
+}
+
+// Acquire leases the table to this worker, unless it is leased to another
+// worker whose lease did not expire
+func (l *TableLeases) Acquire(table string) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// the worker_id is assigned first, so the expiry is only extended if
+	// the lease was acquired
+	_, err := l.DB.Exec(`
+INSERT INTO `+l.Table+` (table_name, worker_id, expires_at)
+    VALUES (?, ?, NOW(6) + INTERVAL ? MICROSECOND)
+ON DUPLICATE KEY UPDATE
+    worker_id = IF(expires_at < NOW(6) OR worker_id = VALUES(worker_id), VALUES(worker_id), worker_id),
+    expires_at = IF(worker_id = VALUES(worker_id), VALUES(expires_at), expires_at)`,
+		table, l.WorkerId, int64(l.LeaseDuration/time.Microsecond))
+	if err != nil {
+		return false, fmt.Errorf("leasing %s: %v", table, err)
+	}
+
+	var workerId string
+	err = l.DB.QueryRow("SELECT worker_id FROM "+l.Table+" WHERE table_name = ?", table).Scan(&workerId)
+	if err != nil {
+		return false, fmt.Errorf("leasing %s: %v", table, err)
+	}
+
+	if workerId != l.WorkerId {
+		return false, nil
+	}
+	l.held[table] = true
+	l.logger.WithField("table", table).Debug("leased table")
+	return true, nil
+}
+
+// Release gives up the lease of the table
+func (l *TableLeases) Release(table string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err := l.DB.Exec("DELETE FROM "+l.Table+" WHERE table_name = ? AND worker_id = ?", table, l.WorkerId)
+	if err != nil {
+		return fmt.Errorf("releasing the lease of %s: %v", table, err)
+	}
+
+	delete(l.held, table)
+	return nil
+}
+
+// IsHeld returns whether this worker holds the lease of the table
+func (l *TableLeases) IsHeld(table string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.held[table]
+}
+
+// Heartbeat extends the leases held by this worker. It fails if a lease
+// expired in the meantime and was acquired by another worker, which may be
+// copying the table as well.
+func (l *TableLeases) Heartbeat() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.held) == 0 {
+		return nil
+	}
+
+	tables := make([]string, 0, len(l.held))
+	for table := range l.held {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	query, args, err := squirrel.
+		Update(l.Table).
+		Set("expires_at", squirrel.Expr("NOW(6) + INTERVAL ? MICROSECOND", int64(l.LeaseDuration/time.Microsecond))).
+		Where(squirrel.Eq{"worker_id": l.WorkerId, "table_name": tables}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = l.DB.Exec(query, args...); err != nil {
+		return fmt.Errorf("extending table leases: %v", err)
+	}
+
+	query, args, err = squirrel.
+		Select("COUNT(*)").
+		From(l.Table).
+		Where(squirrel.Eq{"worker_id": l.WorkerId, "table_name": tables}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err = l.DB.QueryRow(query, args...).Scan(&count); err != nil {
+		return fmt.Errorf("extending table leases: %v", err)
+	}
+	if count != len(tables) {
+		return fmt.Errorf("lost the lease of %d of the tables %s, another worker may be copying them", len(tables)-count, strings.Join(tables, ", "))
+	}
+	return nil
+}
+
+// DistributedCopy copies the tables this process leases until all tables
+// are copied, see DistributedCopyConfig
+type DistributedCopy struct {
+	Ferry  *Ferry
+	Leases *TableLeases
+
+	// the copy state of tables is read from the state tables when they are
+	// leased, and the tables completed by other workers are looked up
+	// periodically. Both mark tables as completed, so they must not run
+	// concurrently.
+	stateMutex sync.Mutex
+	logger     *logrus.Entry
+}
+
+func (f *Ferry) NewDistributedCopy() *DistributedCopy {
+	config := f.Config.DistributedCopy
+	logger := f.loggerFor("distributed_copy").WithField("worker_id", config.WorkerId)
+
+	return &DistributedCopy{
+		Ferry:  f,
+		Leases: NewTableLeases(f.stateTablesDB(), f.StateTracker.stateTablesPrefix+"_table_leases", config.WorkerId, config.leaseDuration, logger),
+		logger: logger,
+	}
+}
+
+// Run copies the tables leased by this process, and waits for the tables
+// copied by the other processes once no table is left to lease
+func (d *DistributedCopy) Run(ctx context.Context) {
+	ctx, stop := context.WithCancel(ctx)
+	heartbeatWg := &sync.WaitGroup{}
+	heartbeatWg.Add(1)
+	go func() {
+		defer heartbeatWg.Done()
+		defer RecoverPanic("distributed_copy", d.Ferry.ErrorHandler)
+		d.runHeartbeats(ctx)
+	}()
+
+	defer func() {
+		stop()
+		heartbeatWg.Wait()
+	}()
+
+	for ctx.Err() == nil {
+		pending := d.pendingTables()
+		if len(pending) == 0 {
+			d.logger.Info("all tables are copied")
+			return
+		}
+
+		leased, err := d.leaseTables(pending)
+		if err != nil {
+			d.Ferry.ErrorHandler.Fatal("distributed_copy", err)
+			return
+		}
+
+		if len(leased) == 0 {
+			d.logger.WithField("tables", len(pending)).Info("waiting for the tables copied by other workers")
+			select {
+			case <-ctx.Done():
+			case <-time.After(d.Ferry.Config.DistributedCopy.heartbeatInterval):
+			}
+			continue
+		}
+
+		d.logger.WithField("tables", tableNames(leased)).Info("copying leased tables")
+		d.Ferry.Metrics.Count("DistributedCopy.LeasedTables", int64(len(leased)), nil, 1.0)
+		d.leasedTablesIterator().Run(leased)
+
+		for _, table := range leased {
+			if err = d.Leases.Release(table.String()); err != nil {
+				d.Ferry.ErrorHandler.Fatal("distributed_copy", err)
+				return
+			}
+		}
+	}
+}
+
+// pendingTables returns the tables that were not copied by any process, and
+// were not given up on by this one
+func (d *DistributedCopy) pendingTables() []*TableSchema {
+	pending := make([]*TableSchema, 0)
+	for _, table := range d.Ferry.tables() {
+		name := table.String()
+		if !d.Ferry.StateTracker.IsTableComplete(name) && !d.Ferry.quarantine.Contains(name) {
+			pending = append(pending, table)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].String() < pending[j].String()
+	})
+	return pending
+}
+
+// leaseTables leases up to DataIterationConcurrency of the tables, and reads
+// their copy state stored by the processes that copied them before
+func (d *DistributedCopy) leaseTables(tables []*TableSchema) ([]*TableSchema, error) {
+	d.stateMutex.Lock()
+	defer d.stateMutex.Unlock()
+
+	leased := make([]*TableSchema, 0)
+	for _, table := range tables {
+		if len(leased) == d.Ferry.Config.DataIterationConcurrency {
+			break
+		}
+
+		acquired, err := d.Leases.Acquire(table.String())
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			continue
+		}
+
+		completed, err := d.Ferry.StateTracker.readTableCopyStateFromDB(d.Ferry.stateTablesDB(), table)
+		if err != nil {
+			return nil, err
+		}
+		if completed {
+			if err = d.Leases.Release(table.String()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		leased = append(leased, table)
+	}
+
+	return leased, nil
+}
+
+// leasedTablesIterator returns an iterator of the leased tables, sharing the
+// batch listeners and the copy progress of the DataIterator. Its done
+// listeners are not called, as the copy is only done once all tables are
+// copied.
+func (d *DistributedCopy) leasedTablesIterator() *DataIterator {
+	iterator := d.Ferry.NewDataIterator()
+	iterator.batchListeners = d.Ferry.DataIterator.batchListeners
+	iterator.targetPaginationKeys = d.Ferry.DataIterator.targetPaginationKeys
+	return iterator
+}
+
+func (d *DistributedCopy) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(d.Ferry.Config.DistributedCopy.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := d.Leases.Heartbeat(); err != nil {
+			d.Ferry.ErrorHandler.Fatal("distributed_copy", err)
+			return
+		}
+
+		if err := d.refreshCopiedTables(); err != nil {
+			d.logger.WithError(err).Warn("failed to look up the tables copied by other workers, retrying later")
+		}
+	}
+}
+
+// refreshCopiedTables marks the tables completed by other processes as
+// completed, e.g. so their schema changes are no longer coordinated with a
+// copy of this process
+func (d *DistributedCopy) refreshCopiedTables() error {
+	d.stateMutex.Lock()
+	defer d.stateMutex.Unlock()
+
+	rows, err := d.Ferry.stateTablesDB().Query("SELECT table_name FROM " + d.Ferry.StateTracker.getRowCopyStateTable() + " WHERE copy_complete = 1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	completed := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return err
+		}
+		completed = append(completed, table)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range completed {
+		// the tables copied by this process are marked when their last
+		// batch is written
+		if d.Ferry.table(table) == nil || d.Leases.IsHeld(table) || d.Ferry.StateTracker.IsTableComplete(table) {
+			continue
+		}
+		d.logger.WithField("table", table).Info("table was copied by another worker")
+		d.Ferry.StateTracker.MarkTableAsCompleted(table)
+	}
+	return nil
+}
+
+// readTableCopyStateFromDB updates the copy state of the table from the
+// state tables, as stored by the processes that copied it before. It
+// returns whether the table is completed.
+func (s *StateTracker) readTableCopyStateFromDB(db *sql.DB, table *TableSchema) (bool, error) {
+	var lastPaginationKey string
+	var copyComplete bool
+	err := db.QueryRow("SELECT last_pagination_key, copy_complete FROM "+s.getRowCopyStateTable()+" WHERE table_name = ?", table.String()).Scan(&lastPaginationKey, &copyComplete)
+	if err == sqlorig.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading the copy state of %s: %v", table.String(), err)
+	}
+
+	if copyComplete {
+		if !s.IsTableComplete(table.String()) {
+			s.MarkTableAsCompleted(table.String())
+		}
+		return true, nil
+	}
+
+	// non-paginated tables don't have resume key data
+	if lastPaginationKey == "" {
+		return false, nil
+	}
+
+	var lastPaginationKeyData PaginationKeyData
+	if err = json.Unmarshal([]byte(lastPaginationKey), &lastPaginationKeyData); err != nil {
+		return false, fmt.Errorf("parsing the copy state of %s: %v", table.String(), err)
+	}
+	keyData, err := UnmarshalPaginationKeyData(&lastPaginationKeyData, table)
+	if err != nil {
+		return false, fmt.Errorf("parsing the copy state of %s: %v", table.String(), err)
+	}
+	s.UpdateLastSuccessfulPaginationKey(table.String(), keyData)
+	return false, nil
+}
+
+// runDistributedCopy copies the rows as the coordinator of a distributed
+// copy. The workers start to lease tables once the leases exist, i.e. once
+// the tables exist on the target and the binlogs are streamed.
+func (f *Ferry) runDistributedCopy(ctx context.Context) {
+	if err := f.distributedCopy.Leases.Initialize(); err != nil {
+		f.ErrorHandler.Fatal("distributed_copy", err)
+		return
+	}
+
+	f.distributedCopy.Run(ctx)
+
+	for _, listener := range f.DataIterator.doneListeners {
+		listener()
+	}
+}
+
+// RunCopyWorker copies the tables leased from the state tables as a worker
+// of a distributed copy, until all tables are copied. It replaces Start and
+// Run, as the binlogs are streamed by the coordinator.
+func (f *Ferry) RunCopyWorker() {
+	f.logger.Info("starting distributed copy worker")
+	f.setOverallState(StateCopying)
+	f.DataIterator.AddBatchListener(f.BatchWriter.WriteRowBatch)
+
+	if err := f.markStreamOnlyTables(); err != nil {
+		f.ErrorHandler.Fatal("distributed_copy", err)
+	}
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+
+	throttlerNames, throttlers := f.throttlers()
+	for i, throttler := range throttlers {
+		name, throttler := throttlerNames[i], throttler
+		go func() {
+			defer RecoverPanic(name, f.ErrorHandler)
+			if err := throttler.Run(ctx); err != nil && err != context.Canceled {
+				f.ErrorHandler.Fatal(name, err)
+			}
+		}()
+	}
+
+	// the coordinator creates the leases once the tables exist on the
+	// target and the binlogs are streamed
+	for {
+		exists, err := f.distributedCopy.Leases.Exists()
+		if err != nil {
+			f.ErrorHandler.Fatal("distributed_copy", err)
+		}
+		if exists {
+			break
+		}
+		f.logger.Info("waiting for the coordinator to start copying")
+		time.Sleep(f.Config.DistributedCopy.heartbeatInterval)
+	}
+
+	f.distributedCopy.Run(ctx)
+	f.logger.Info("distributed copy worker done")
+}
+
+func tableNames(tables []*TableSchema) []string {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.String()
+	}
+	return names
+}
@@ -0,0 +1,653 @@
+package ghostferry
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	sqlorig "database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+const dumpIdentifier = "(`(?:[^`]|``)+`|[A-Za-z0-9_$]+)"
+
+var (
+	dumpInsertRegexp      = regexp.MustCompile(`(?is)^(?:INSERT|REPLACE)\s+(?:(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY|IGNORE)\s+)*INTO\s+` + dumpIdentifier + `(?:\.` + dumpIdentifier + `)?`)
+	dumpCreateTableRegexp = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + dumpIdentifier + `(?:\.` + dumpIdentifier + `)?`)
+	dumpUseRegexp         = regexp.MustCompile(`(?is)^USE\s+` + dumpIdentifier + `$`)
+	dumpSetRegexp         = regexp.MustCompile(`(?is)^(?:/\*!\d*\s*)?SET\s`)
+
+	// the coordinates written by mysqldump with --master-data/--source-data
+	mysqldumpCoordinatesRegexp = regexp.MustCompile(`CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+)
+
+// DumpStatementReader splits a SQL dump into its statements. It handles
+// quoted strings and identifiers, comments and the DELIMITER command of the
+// mysql client. Executable comments (/*! ... */) are kept in the statements,
+// all other comments are dropped.
+type DumpStatementReader struct {
+	reader    *bufio.Reader
+	delimiter string
+}
+
+func NewDumpStatementReader(r io.Reader) *DumpStatementReader {
+	return &DumpStatementReader{
+		reader:    bufio.NewReaderSize(r, 1024*1024),
+		delimiter: ";",
+	}
+}
+
+// Next returns the next statement without its delimiter, or io.EOF after
+// the last statement
+func (r *DumpStatementReader) Next() (string, error) {
+	var statement []byte
+	var quote byte
+
+	for {
+		c, err := r.reader.ReadByte()
+		if err == io.EOF {
+			if quote != 0 {
+				return "", fmt.Errorf("unterminated quoted string in statement: %.100s", statement)
+			}
+			trimmed := strings.TrimSpace(string(statement))
+			if trimmed == "" {
+				return "", io.EOF
+			}
+			return trimmed, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		if quote != 0 {
+			statement = append(statement, c)
+			if c == '\\' && quote != '`' {
+				escaped, err := r.reader.ReadByte()
+				if err != nil {
+					return "", fmt.Errorf("unterminated quoted string in statement: %.100s", statement)
+				}
+				statement = append(statement, escaped)
+			} else if c == quote {
+				// a doubled quote closes and reopens the string
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			statement = append(statement, c)
+			continue
+		case '#':
+			if err := r.skipLine(); err != nil {
+				return "", err
+			}
+			statement = append(statement, '\n')
+			continue
+		case '-':
+			next, _ := r.reader.Peek(2)
+			if len(next) > 0 && next[0] == '-' && (len(next) == 1 || isDumpSpace(next[1])) {
+				if err := r.skipLine(); err != nil {
+					return "", err
+				}
+				statement = append(statement, '\n')
+				continue
+			}
+		case '/':
+			next, _ := r.reader.Peek(1)
+			if len(next) == 1 && next[0] == '*' {
+				r.reader.ReadByte()
+				comment, err := r.readComment()
+				if err != nil {
+					return "", err
+				}
+				if strings.HasPrefix(comment, "!") {
+					statement = append(statement, "/*"+comment+"*/"...)
+				} else {
+					statement = append(statement, ' ')
+				}
+				continue
+			}
+		case '\n':
+			// DELIMITER is a command of the mysql client, terminated by the
+			// end of the line. Only the statements starting with it are split,
+			// not every line of the long statements.
+			if isDelimiterCommand(statement) {
+				fields := strings.Fields(string(statement))
+				if len(fields) == 2 {
+					r.delimiter = fields[1]
+					statement = statement[:0]
+					continue
+				}
+			}
+		}
+
+		statement = append(statement, c)
+		if bytes.HasSuffix(statement, []byte(r.delimiter)) && !isDelimiterCommand(statement) {
+			trimmed := strings.TrimSpace(string(statement[:len(statement)-len(r.delimiter)]))
+			if trimmed != "" {
+				return trimmed, nil
+			}
+			statement = statement[:0]
+		}
+	}
+}
+
+func (r *DumpStatementReader) skipLine() error {
+	_, err := r.reader.ReadString('\n')
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// readComment reads the rest of a block comment, returning its text
+// without the comment markers
+func (r *DumpStatementReader) readComment() (string, error) {
+	var comment []byte
+	for {
+		c, err := r.reader.ReadByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("unterminated comment: /*%.100s", comment)
+		} else if err != nil {
+			return "", err
+		}
+
+		if c == '/' && len(comment) > 0 && comment[len(comment)-1] == '*' {
+			return string(comment[:len(comment)-1]), nil
+		}
+		comment = append(comment, c)
+	}
+}
+
+func isDelimiterCommand(statement []byte) bool {
+	statement = bytes.TrimLeft(statement, " \t\r\n")
+	return len(statement) > len("DELIMITER") && bytes.EqualFold(statement[:len("DELIMITER")], []byte("DELIMITER")) && isDumpSpace(statement[len("DELIMITER")])
+}
+
+func isDumpSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// ParseMydumperMetadata reads the binlog coordinates of the dumped server
+// from the metadata file of a mydumper dump. Both the legacy format and the
+// ini format of newer mydumper versions are supported.
+func ParseMydumperMetadata(r io.Reader) (mysql.Position, error) {
+	var pos mysql.Position
+	var section string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "SHOW MASTER STATUS:" || line == "[master]" || line == "[source]":
+			section = "master"
+			continue
+		case strings.HasPrefix(line, "SHOW "), strings.HasPrefix(line, "["):
+			section = ""
+			continue
+		case section != "master":
+			continue
+		}
+
+		var key, value string
+		if i := strings.IndexAny(line, ":="); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			value = strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+		}
+
+		switch key {
+		case "Log", "File":
+			pos.Name = value
+		case "Pos", "Position":
+			position, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return pos, fmt.Errorf("invalid binlog position in mydumper metadata: %s", value)
+			}
+			pos.Pos = uint32(position)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pos, err
+	}
+
+	if pos.Name == "" || pos.Pos == 0 {
+		return pos, fmt.Errorf("no binlog coordinates of the dumped server found in mydumper metadata")
+	}
+	return pos, nil
+}
+
+// ParseMysqldumpCoordinates reads the binlog coordinates written by
+// mysqldump with --master-data (or --source-data) from the header of a dump.
+// Dumps of a replica created with --dump-slave record the coordinates of its
+// source instead, and are rejected.
+func ParseMysqldumpCoordinates(r io.Reader) (mysql.Position, error) {
+	var replicaSource bool
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := mysqldumpCoordinatesRegexp.FindStringSubmatch(line); match != nil {
+			if replicaSource {
+				return mysql.Position{}, fmt.Errorf("the dump records the binlog coordinates of the source of the dumped replica (--dump-slave), not of the dumped server")
+			}
+
+			position, err := strconv.ParseUint(match[2], 10, 32)
+			if err != nil {
+				return mysql.Position{}, fmt.Errorf("invalid binlog position in dump: %s", match[2])
+			}
+			return mysql.Position{Name: match[1], Pos: uint32(position)}, nil
+		}
+
+		// the coordinates are written before any table
+		upper := strings.ToUpper(line)
+		if strings.HasPrefix(upper, "USE ") || strings.HasPrefix(upper, "CREATE ") || strings.HasPrefix(upper, "INSERT ") || strings.HasPrefix(upper, "DROP ") {
+			break
+		}
+
+		// the comment preceding the coordinates of --dump-slave
+		if strings.Contains(line, "the master of this slave") || strings.Contains(line, "the source of this replica") {
+			replicaSource = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return mysql.Position{}, err
+	}
+
+	return mysql.Position{}, fmt.Errorf("no binlog coordinates found in dump, it must be created with --master-data or --source-data")
+}
+
+// DumpLoader seeds the target from logical dump files, see DumpLoadConfig.
+//
+// Only the tables of the ferry are created and loaded: the CREATE TABLE,
+// INSERT and REPLACE statements of other tables, and all other statements
+// except for session variables, are skipped. Databases are created as needed
+// and renamed according to the DatabaseRewrites.
+type DumpLoader struct {
+	Config           *DumpLoadConfig
+	DB               *sql.DB
+	Tables           TableSchemaCache
+	DatabaseRewrites map[string]string
+	DDLRewriter      *DDLRewriter
+
+	conn      *sqlorig.Conn
+	database  string
+	databases map[string]bool
+	// the tables of the ferry found in the dump
+	dumpedTables map[string]bool
+
+	logger *logrus.Entry
+}
+
+func (f *Ferry) NewDumpLoader() *DumpLoader {
+	f.ensureInitialized()
+
+	return &DumpLoader{
+		Config:           &f.Config.DumpLoad,
+		DB:               f.TargetDB,
+		Tables:           f.Tables,
+		DatabaseRewrites: f.Config.DatabaseRewrites,
+		DDLRewriter:      f.newDDLRewriter(),
+		logger:           f.loggerFor("dump_load"),
+	}
+}
+
+// LoadDump seeds the target from the dump files of the DumpLoad config, and
+// sets the state to resume from to the binlog coordinates of the dump, with
+// all tables copied. It is called by Start, unless resuming.
+func (f *Ferry) LoadDump() error {
+	pos, err := f.NewDumpLoader().Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, table := range f.Tables.AsSlice() {
+		f.StateTracker.MarkTableAsCompleted(table.String())
+	}
+
+	binlogPosition := NewResumableBinlogPosition(pos)
+	f.StateTracker.UpdateLastWrittenBinlogPosition(binlogPosition)
+	f.StateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(binlogPosition)
+	if err = f.StateTracker.SerializeToDB(f.stateTablesDB()); err != nil {
+		return err
+	}
+
+	f.StateToResumeFrom = f.StateTracker.Serialize(f.Tables, nil)
+	return nil
+}
+
+// Load creates and loads the tables from the dump, and returns the binlog
+// coordinates of the source at the time of the dump
+func (l *DumpLoader) Load(ctx context.Context) (mysql.Position, error) {
+	if l.logger == nil {
+		l.logger = logrus.WithField("tag", "dump_load")
+	}
+
+	var err error
+	l.conn, err = l.DB.Conn(ctx)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	defer l.conn.Close()
+
+	l.databases = make(map[string]bool)
+	l.dumpedTables = make(map[string]bool)
+
+	// dumps escape strings with backslashes, and rely on the sql_mode to not
+	// treat zero values of auto-increment columns as a request for a value
+	_, err = l.conn.ExecContext(ctx, "SET SESSION sql_mode = 'STRICT_ALL_TABLES,NO_AUTO_VALUE_ON_ZERO', SESSION foreign_key_checks = 0")
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	var pos mysql.Position
+	if l.Config.Directory != "" {
+		pos, err = l.loadMydumperDirectory(ctx)
+	} else {
+		pos, err = l.loadMysqldumpFile(ctx)
+	}
+	if err != nil {
+		return pos, err
+	}
+
+	// the rows of tables missing from the dump would never be copied
+	var missingTables []string
+	for name := range l.Tables {
+		if !l.dumpedTables[name] {
+			missingTables = append(missingTables, name)
+		}
+	}
+	if len(missingTables) > 0 {
+		sort.Strings(missingTables)
+		return pos, fmt.Errorf("tables missing from the dump: %s", strings.Join(missingTables, ", "))
+	}
+
+	return pos, nil
+}
+
+func (l *DumpLoader) loadMysqldumpFile(ctx context.Context) (mysql.Position, error) {
+	file, err := openDumpFile(l.Config.File)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	pos, err := ParseMysqldumpCoordinates(file)
+	file.Close()
+	if err != nil {
+		return pos, fmt.Errorf("reading binlog coordinates from %s: %v", l.Config.File, err)
+	}
+
+	if l.Config.Database != "" {
+		if err = l.useDatabase(ctx, l.Config.Database); err != nil {
+			return pos, err
+		}
+	}
+
+	if err = l.loadFile(ctx, l.Config.File); err != nil {
+		return pos, err
+	}
+
+	l.logger.WithField("position", pos).Info("loaded mysqldump file")
+	return pos, nil
+}
+
+func (l *DumpLoader) loadMydumperDirectory(ctx context.Context) (mysql.Position, error) {
+	metadataFile, err := os.Open(filepath.Join(l.Config.Directory, "metadata"))
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	pos, err := ParseMydumperMetadata(metadataFile)
+	metadataFile.Close()
+	if err != nil {
+		return pos, err
+	}
+
+	entries, err := ioutil.ReadDir(l.Config.Directory)
+	if err != nil {
+		return pos, err
+	}
+
+	var schemaFiles, dataFiles []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if strings.HasSuffix(name, ".zst") || strings.HasSuffix(name, ".dat") {
+			return pos, fmt.Errorf("unsupported dump file %s: only (gzip compressed) SQL files are supported", entry.Name())
+		}
+
+		kind, database, table := classifyMydumperFile(entry.Name())
+		if kind == "" || l.Tables.Get(database, table) == nil {
+			continue
+		}
+
+		if kind == "schema" {
+			schemaFiles = append(schemaFiles, entry.Name())
+		} else {
+			dataFiles = append(dataFiles, entry.Name())
+		}
+	}
+	sort.Strings(schemaFiles)
+	sort.Strings(dataFiles)
+
+	for _, name := range append(schemaFiles, dataFiles...) {
+		_, database, _ := classifyMydumperFile(name)
+		if err = l.useDatabase(ctx, database); err != nil {
+			return pos, err
+		}
+
+		if err = l.loadFile(ctx, filepath.Join(l.Config.Directory, name)); err != nil {
+			return pos, err
+		}
+	}
+
+	l.logger.WithFields(logrus.Fields{
+		"position": pos,
+		"files":    len(schemaFiles) + len(dataFiles),
+	}).Info("loaded mydumper directory")
+	return pos, nil
+}
+
+// classifyMydumperFile returns whether a file of a mydumper dump contains the
+// schema or the data of a table, and of which table. Files of other objects
+// (databases, views, triggers, ...) are not classified.
+func classifyMydumperFile(name string) (kind, database, table string) {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ".sql") {
+		return
+	}
+	name = strings.TrimSuffix(name, ".sql")
+
+	kind = "data"
+	if strings.HasSuffix(name, "-schema") {
+		kind = "schema"
+		name = strings.TrimSuffix(name, "-schema")
+	} else if strings.Contains(name, "-schema") {
+		return "", "", ""
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 && kind == "data" {
+		// the data of a table may be split into numbered chunks
+		for _, chunk := range parts[2:] {
+			if _, err := strconv.Atoi(chunk); err != nil {
+				return "", "", ""
+			}
+		}
+		parts = parts[:2]
+	}
+	if len(parts) != 2 {
+		return "", "", ""
+	}
+
+	return kind, parts[0], parts[1]
+}
+
+func (l *DumpLoader) loadFile(ctx context.Context, path string) error {
+	file, err := openDumpFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	l.logger.WithField("file", path).Info("loading dump file")
+
+	reader := NewDumpStatementReader(file)
+	var executed, skipped int
+	for {
+		statement, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+
+		execute, err := l.handleStatement(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("loading %s: %v", path, err)
+		}
+		if !execute {
+			skipped++
+			continue
+		}
+
+		if l.DDLRewriter != nil && dumpCreateTableRegexp.MatchString(statement) {
+			statement = l.DDLRewriter.RewriteOptions(statement)
+		}
+
+		if _, err = l.conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("loading %s: executing %.100s: %v", path, statement, err)
+		}
+		executed++
+	}
+
+	l.logger.WithFields(logrus.Fields{
+		"file":     path,
+		"executed": executed,
+		"skipped":  skipped,
+	}).Debug("loaded dump file")
+	return nil
+}
+
+// handleStatement returns whether the statement must be executed, after
+// handling the statements that change the current database
+func (l *DumpLoader) handleStatement(ctx context.Context, statement string) (bool, error) {
+	if match := dumpUseRegexp.FindStringSubmatch(statement); match != nil {
+		return false, l.useDatabase(ctx, unquoteDumpIdentifier(match[1]))
+	}
+
+	if dumpSetRegexp.MatchString(statement) {
+		// the load must not change the server, nor the binlogging of the
+		// target
+		upper := strings.ToUpper(statement)
+		if strings.Contains(upper, "@@GLOBAL.") || strings.Contains(upper, "GTID_PURGED") || strings.Contains(upper, "SQL_LOG_BIN") {
+			return false, nil
+		}
+		return true, nil
+	}
+
+	match := dumpInsertRegexp.FindStringSubmatch(statement)
+	if match == nil {
+		match = dumpCreateTableRegexp.FindStringSubmatch(statement)
+	}
+	if match == nil {
+		return false, nil
+	}
+
+	database, table := l.database, unquoteDumpIdentifier(match[1])
+	if match[2] != "" {
+		database, table = table, unquoteDumpIdentifier(match[2])
+		if _, exists := l.DatabaseRewrites[database]; exists {
+			return false, fmt.Errorf("statements with qualified names of rewritten databases are not supported: %.100s", statement)
+		}
+	} else if database == "" {
+		return false, fmt.Errorf("no database selected for table %s, set DumpLoad.Database", table)
+	}
+
+	if l.Tables.Get(database, table) == nil {
+		return false, nil
+	}
+
+	l.dumpedTables[fullTableName(database, table)] = true
+	return true, nil
+}
+
+// useDatabase makes the database of the source the current database, and
+// selects it on the target if any of its tables are loaded
+func (l *DumpLoader) useDatabase(ctx context.Context, database string) error {
+	l.database = database
+
+	var loaded bool
+	for _, table := range l.Tables {
+		if table.Schema == database {
+			loaded = true
+			break
+		}
+	}
+	if !loaded {
+		return nil
+	}
+
+	targetDatabase := database
+	if rewrite, exists := l.DatabaseRewrites[database]; exists {
+		targetDatabase = rewrite
+	}
+
+	if !l.databases[targetDatabase] {
+		_, err := l.conn.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+QuotedDatabaseNameFromString(targetDatabase))
+		if err != nil {
+			return fmt.Errorf("creating database %s: %v", targetDatabase, err)
+		}
+		l.databases[targetDatabase] = true
+	}
+
+	_, err := l.conn.ExecContext(ctx, "USE "+QuotedDatabaseNameFromString(targetDatabase))
+	return err
+}
+
+func unquoteDumpIdentifier(identifier string) string {
+	if strings.HasPrefix(identifier, "`") {
+		identifier = strings.Replace(identifier[1:len(identifier)-1], "``", "`", -1)
+	}
+	return identifier
+}
+
+type dumpFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *dumpFile) Close() error {
+	return f.file.Close()
+}
+
+// openDumpFile opens a dump file, decompressing it if it is gzip compressed
+func openDumpFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	return &dumpFile{Reader: reader, file: file}, nil
+}
@@ -67,6 +67,24 @@ func (r RowData) GetString(colIdx int) string {
 	}
 }
 
+// ByteSize returns an estimate of the memory used by the values of the row.
+// Strings and byte slices are counted by their length, all other values as
+// 8 bytes.
+func (r RowData) ByteSize() uint64 {
+	var size uint64
+	for _, value := range r {
+		switch v := value.(type) {
+		case []byte:
+			size += uint64(len(v))
+		case string:
+			size += uint64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
 // a DXLEvent is the base for DDL or DML
 type DXLEvent interface {
 	Database() string
@@ -108,6 +126,42 @@ type DMLEventBase struct {
 	*DXLEventBase
 }
 
+// RowImage is the set of columns logged in a row image of a binlog event, as
+// a bitmap indexed by column. With binlog_row_image=FULL every column is
+// logged. With MINIMAL, the before image only contains the columns needed to
+// identify the row (usually the primary key) and the after image only the
+// columns set by the statement. NOBLOB omits unchanged BLOB/TEXT columns.
+//
+// A nil RowImage contains all columns.
+type RowImage []byte
+
+func (i RowImage) HasColumn(idx int) bool {
+	if i == nil {
+		return true
+	}
+	if idx/8 >= len(i) {
+		return false
+	}
+	return i[idx/8]&(1<<uint(idx%8)) != 0
+}
+
+// filter returns the columns and values logged in the image
+func (i RowImage) filter(columns []schema.TableColumn, values RowData) ([]schema.TableColumn, RowData) {
+	if i == nil {
+		return columns, values
+	}
+
+	filteredColumns := make([]schema.TableColumn, 0, len(columns))
+	filteredValues := make(RowData, 0, len(values))
+	for idx, column := range columns {
+		if i.HasColumn(idx) {
+			filteredColumns = append(filteredColumns, column)
+			filteredValues = append(filteredValues, values[idx])
+		}
+	}
+	return filteredColumns, filteredValues
+}
+
 func (e *DMLEventBase) Database() string {
 	return e.table.Schema
 }
@@ -122,6 +176,7 @@ func (e *DMLEventBase) TableSchema() *TableSchema {
 
 type BinlogInsertEvent struct {
 	newValues RowData
+	newImage  RowImage
 	*DMLEventBase
 }
 
@@ -131,6 +186,7 @@ func NewBinlogInsertEvents(table *TableSchema, rowsEvent *replication.RowsEvent,
 	for i, row := range rowsEvent.Rows {
 		insertEvents[i] = &BinlogInsertEvent{
 			newValues:    row,
+			newImage:     RowImage(rowsEvent.ColumnBitmap1),
 			DMLEventBase: &DMLEventBase{
 				table:        table,
 				DXLEventBase: &DXLEventBase{
@@ -157,10 +213,18 @@ func (e *BinlogInsertEvent) AsSQLString(schemaName, tableName string) (string, e
 		return "", err
 	}
 
+	// columns missing from a minimal image get their default value, as they
+	// did on the source
+	columns, values := e.newImage.filter(e.table.Columns, e.newValues)
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = quoteField(column.Name)
+	}
+
 	query := "INSERT IGNORE INTO " +
 		QuotedTableNameFromString(schemaName, tableName) +
-		" (" + strings.Join(quotedColumnNames(e.table), ",") + ")" +
-		" VALUES (" + buildStringListForValues(e.table.Columns, e.newValues) + ")"
+		" (" + strings.Join(quotedColumns, ",") + ")" +
+		" VALUES (" + buildStringListForValues(columns, values) + ")"
 
 	return query, nil
 }
@@ -172,6 +236,8 @@ func (e *BinlogInsertEvent) VerifierPaginationKey() (uint64, error) {
 type BinlogUpdateEvent struct {
 	oldValues RowData
 	newValues RowData
+	oldImage  RowImage
+	newImage  RowImage
 	*DMLEventBase
 }
 
@@ -191,6 +257,8 @@ func NewBinlogUpdateEvents(table *TableSchema, rowsEvent *replication.RowsEvent,
 		updateEvents[i/2] = &BinlogUpdateEvent{
 			oldValues:    row,
 			newValues:    rowsEvent.Rows[i+1],
+			oldImage:     RowImage(rowsEvent.ColumnBitmap1),
+			newImage:     RowImage(rowsEvent.ColumnBitmap2),
 			DMLEventBase: &DMLEventBase{
 				table:        table,
 				DXLEventBase: &DXLEventBase{
@@ -217,19 +285,46 @@ func (e *BinlogUpdateEvent) AsSQLString(schemaName, tableName string) (string, e
 		return "", err
 	}
 
+	setColumns, setValues := e.newImage.filter(e.table.Columns, e.newValues)
+	whereColumns, whereValues := e.oldImage.filter(e.table.Columns, e.oldValues)
+
 	query := "UPDATE " + QuotedTableNameFromString(schemaName, tableName) +
-		" SET " + buildStringMapForSet(e.table.Columns, e.newValues) +
-		" WHERE " + buildStringMapForWhere(e.table.Columns, e.oldValues)
+		" SET " + buildStringMapForSet(setColumns, setValues) +
+		" WHERE " + buildStringMapForWhere(whereColumns, whereValues)
 
 	return query, nil
 }
 
+// PaginationKeyChanged returns whether the update moved the row to another
+// pagination key. A minimal after image only contains the pagination key if
+// it changed.
+func (e *BinlogUpdateEvent) PaginationKeyChanged() (bool, error) {
+	if e.table.PaginationKey == nil {
+		return false, nil
+	}
+	if err := verifyValuesHasTheSameLengthAsColumns(e.table, e.oldValues, e.newValues); err != nil {
+		return false, err
+	}
+
+	for _, idx := range e.table.PaginationKey.ColumnIndices {
+		if e.newImage.HasColumn(idx) && !reflect.DeepEqual(e.oldValues[idx], e.newValues[idx]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (e *BinlogUpdateEvent) VerifierPaginationKey() (uint64, error) {
+	// a minimal after image only contains the pagination key if it changed
+	if e.table.PaginationKey != nil && len(e.table.PaginationKey.ColumnIndices) > 0 && !e.newImage.HasColumn(e.table.PaginationKey.ColumnIndices[0]) {
+		return verifierPaginationKeyFromEventData(e.table, e.oldValues)
+	}
 	return verifierPaginationKeyFromEventData(e.table, e.newValues)
 }
 
 type BinlogDeleteEvent struct {
 	oldValues RowData
+	oldImage  RowImage
 	*DMLEventBase
 }
 
@@ -246,6 +341,7 @@ func NewBinlogDeleteEvents(table *TableSchema, rowsEvent *replication.RowsEvent,
 	for i, row := range rowsEvent.Rows {
 		deleteEvents[i] = &BinlogDeleteEvent{
 			oldValues:    row,
+			oldImage:     RowImage(rowsEvent.ColumnBitmap1),
 			DMLEventBase: &DMLEventBase{
 				table:        table,
 				DXLEventBase: &DXLEventBase{
@@ -264,8 +360,10 @@ func (e *BinlogDeleteEvent) AsSQLString(schemaName, tableName string) (string, e
 		return "", err
 	}
 
+	whereColumns, whereValues := e.oldImage.filter(e.table.Columns, e.oldValues)
+
 	query := "DELETE FROM " + QuotedTableNameFromString(schemaName, tableName) +
-		" WHERE " + buildStringMapForWhere(e.table.Columns, e.oldValues)
+		" WHERE " + buildStringMapForWhere(whereColumns, whereValues)
 
 	return query, nil
 }
@@ -0,0 +1,72 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// matches $${ (an escaped "${"), ${NAME} and ${NAME:-default}
+var envReferenceRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// InterpolateEnv replaces the references to environment variables in the
+// JSON config, ${NAME} or ${NAME:-default}, with their values, escaped such
+// that they can be used inside JSON strings. The defaults are part of the
+// JSON config, and are escaped as the rest of the string they are in. A
+// literal "${" is written as "$${". Referencing an unset variable without a
+// default is an error, as it usually is a missing secret.
+func InterpolateEnv(config []byte) ([]byte, error) {
+	var missing []string
+
+	interpolated := envReferenceRegexp.ReplaceAllFunc(config, func(reference []byte) []byte {
+		if string(reference) == "$${" {
+			return []byte("${")
+		}
+
+		match := envReferenceRegexp.FindSubmatch(reference)
+		name := string(match[1])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if match[2] == nil {
+				missing = append(missing, name)
+				return reference
+			}
+			return match[3]
+		}
+
+		return jsonEscape(value)
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables referenced by the config are not set: %s", strings.Join(missing, ", "))
+	}
+
+	return interpolated, nil
+}
+
+// DecodeConfig decodes the JSON config from the reader into v, after
+// interpolating the references to environment variables in it, see
+// InterpolateEnv
+func DecodeConfig(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	data, err = InterpolateEnv(data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func jsonEscape(value string) []byte {
+	// cannot fail for strings
+	quoted, _ := json.Marshal(value)
+	return quoted[1 : len(quoted)-1]
+}
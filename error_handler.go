@@ -2,15 +2,23 @@ package ghostferry
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
 
+// ErrorHandler is called by the components of the Ferry with the errors they
+// cannot recover from, see Config.ErrorPolicy for the errors that are handled
+// by the components themselves. Set Ferry.ErrorHandler to customize the
+// reporting; the PanicErrorHandler is used by default.
 type ErrorHandler interface {
 	// Usually called from Fatal. When called from Fatal, if this method returns
 	// true, Fatal should panic, otherwise it should not.
@@ -18,6 +26,60 @@ type ErrorHandler interface {
 	Fatal(from string, err error)
 }
 
+// TableErrorHandler can be implemented by an ErrorHandler to be notified of
+// the tables given up on due to the skip_table action of Config.ErrorPolicy.
+type TableErrorHandler interface {
+	SkipTable(from string, table *TableSchema, err error)
+}
+
+// PanicHandler can be implemented by an ErrorHandler to be handed the panics
+// recovered by RecoverPanic. HandlePanic returns whether the panic was handed
+// on to someone exiting the process, otherwise it is propagated.
+type PanicHandler interface {
+	HandlePanic(from string, r interface{}) bool
+}
+
+// ExitCodeResumable is the exit code suggested for the process after a
+// goroutine of the Ferry panicked and the state was dumped, such that the run
+// can be resumed from the dump (EX_TEMPFAIL of sysexits.h), see
+// PanicErrorHandler.Panics.
+const ExitCodeResumable = 75
+
+const fatalErrorPanic = "fatal error detected, see logs for details"
+
+// RecoverPanic is deferred by the goroutines of the Ferry and its components
+// to hand a panic to the error handler. If the PanicHandler handed the panic
+// on, the goroutine then blocks until the process exits, such that the Ferry
+// does not carry on as if it had completed. Otherwise, the panic is reported
+// and propagated.
+func RecoverPanic(from string, errorHandler ErrorHandler) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if errorHandler == nil {
+		panic(r)
+	}
+
+	panicHandler, ok := errorHandler.(PanicHandler)
+	if !ok {
+		if r != fatalErrorPanic {
+			errorHandler.ReportError(from, panicError(r))
+		}
+		panic(r)
+	}
+
+	if !panicHandler.HandlePanic(from, r) {
+		panic(r)
+	}
+	select {}
+}
+
+func panicError(r interface{}) error {
+	return fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+}
+
 type PanicErrorHandler struct {
 	Ferry             *Ferry
 	ErrorCallback     HTTPCallback
@@ -25,19 +87,35 @@ type PanicErrorHandler struct {
 	DumpStateFilename string
 
 	errorCount int32
+
+	// whether the panics are received from Panics
+	subscribed  int32
+	panicsOnce  sync.Once
+	panics      chan error
+	handledOnce sync.Once
+	failedOnce  sync.Once
+	failed      chan struct{}
+	failOnce    sync.Once
 }
 
 func (this *PanicErrorHandler) ReportError(from string, err error) {
-	logger := logrus.WithField("tag", "error_handler")
+	logger := this.Ferry.loggerFor("error_handler")
 
 	stateFilename := this.DumpStateFilename
-	stateJSON, jsonErr := this.Ferry.SerializeStateToJSON()
-	if jsonErr != nil {
-		logger.WithError(jsonErr).Error("failed to dump state to JSON...")
+	stateJSON, stateErr := this.Ferry.SerializeStateToJSON()
+
+	// the state is dumped and sent to the ErrorCallback encrypted, if
+	// StateEncryption is configured. A state that cannot be encrypted is
+	// left out, as it must not leave Ghostferry unencrypted.
+	var stateDump string
+	if stateErr != nil {
+		logger.WithError(stateErr).Error("failed to dump state to JSON...")
+	} else if stateDump, stateErr = this.Ferry.encryptStateDump(stateJSON); stateErr != nil {
+		logger.WithError(stateErr).Error("failed to encrypt state...")
 	} else if this.DumpState {
 		if stateFilename != "" {
 			logger.Infof("writing state to %s", stateFilename)
-			writeErr := ioutil.WriteFile(stateFilename, []byte(stateJSON), 0640)
+			writeErr := ioutil.WriteFile(stateFilename, []byte(stateDump), 0640)
 			if writeErr != nil {
 				logger.WithError(writeErr).Errorf("failed to write state to %s. Dumping to stdout", stateFilename)
 				// if the write to file failed, write to stdout as last resort
@@ -47,13 +125,13 @@ func (this *PanicErrorHandler) ReportError(from string, err error) {
 		}
 		if stateFilename == "" {
 			logger.Info("writing state to stdout")
-			fmt.Fprintln(os.Stdout, stateJSON)
+			fmt.Fprintln(os.Stdout, stateDump)
 		}
 	}
 
 	if this.Ferry.StateTracker != nil {
 		logger.Debug("storing state to target DB...")
-		dbErr := this.Ferry.StateTracker.SerializeToDB(this.Ferry.TargetDB)
+		dbErr := this.Ferry.StateTracker.SerializeToDB(this.Ferry.stateTablesDB())
 		if dbErr != nil {
 			logger.WithError(dbErr).Error("failed to store state to target DB...")
 		} else {
@@ -68,7 +146,7 @@ func (this *PanicErrorHandler) ReportError(from string, err error) {
 		errorData := make(map[string]string)
 		errorData["ErrFrom"] = from
 		errorData["ErrMessage"] = err.Error()
-		errorData["StateDump"] = stateJSON
+		errorData["StateDump"] = stateDump
 
 		errorDataBytes, jsonErr := json.MarshalIndent(errorData, "", "  ")
 		if jsonErr != nil {
@@ -83,10 +161,15 @@ func (this *PanicErrorHandler) ReportError(from string, err error) {
 		}
 	}
 
+	summary := strings.SplitN(err.Error(), "\n", 2)[0]
+	this.Ferry.notify(NotificationFatalError, fmt.Sprintf("failed in %s: %s", from, summary), map[string]string{
+		"errfrom": from,
+	})
+
 	errmsg := "fatal error detected"
 	if this.DumpState {
 		errmsg += ", state dump "
-		if jsonErr != nil {
+		if stateErr != nil {
 			errmsg += "missing"
 		} else if stateFilename == "" {
 			errmsg += "in <stdout>"
@@ -100,10 +183,79 @@ func (this *PanicErrorHandler) ReportError(from string, err error) {
 
 func (this *PanicErrorHandler) Fatal(from string, err error) {
 	if atomic.AddInt32(&this.errorCount, 1) > 1 {
-		logrus.WithField("tag", "error_handler").WithError(err).WithField("errfrom", from).Error("multiple fatal errors detected, not reporting again")
+		this.Ferry.loggerFor("error_handler").WithError(err).WithField("errfrom", from).Error("multiple fatal errors detected, not reporting again")
 		return
 	}
 
 	this.ReportError(from, err)
-	panic("fatal error detected, see logs for details")
+	this.fail()
+	panic(fatalErrorPanic)
+}
+
+// HandlePanic reports a panic, unless it is the one of Fatal, and sends it to
+// Panics if they are received. Only the first error is reported, like with
+// Fatal.
+func (this *PanicErrorHandler) HandlePanic(from string, r interface{}) bool {
+	err := errors.New(fatalErrorPanic)
+	if r != fatalErrorPanic {
+		err = panicError(r)
+		if atomic.AddInt32(&this.errorCount, 1) == 1 {
+			this.ReportError(from, err)
+		} else {
+			this.Ferry.loggerFor("error_handler").WithError(err).WithField("errfrom", from).Error("multiple fatal errors detected, not reporting again")
+		}
+	}
+
+	this.fail()
+	if atomic.LoadInt32(&this.subscribed) == 0 {
+		return false
+	}
+
+	this.handledOnce.Do(func() {
+		this.initPanics() <- fmt.Errorf("%s: %v", from, err)
+	})
+	return true
+}
+
+// Panics returns the channel receiving the first panic of the goroutines of
+// the Ferry, once it was reported and the state was dumped. The caller
+// decides how to exit, typically with ExitCodeResumable. The panicking
+// goroutines block from then on, waiting for the process to exit, while the
+// panics are propagated if they are not received.
+func (this *PanicErrorHandler) Panics() <-chan error {
+	atomic.StoreInt32(&this.subscribed, 1)
+	return this.initPanics()
+}
+
+// Failed returns a channel closed once a fatal error or a panic was reported,
+// such that waits for the run can be given up on.
+func (this *PanicErrorHandler) Failed() <-chan struct{} {
+	return this.initFailed()
+}
+
+func (this *PanicErrorHandler) initFailed() chan struct{} {
+	this.failedOnce.Do(func() {
+		this.failed = make(chan struct{})
+	})
+	return this.failed
+}
+
+func (this *PanicErrorHandler) fail() {
+	this.failOnce.Do(func() {
+		close(this.initFailed())
+	})
+}
+
+func (this *PanicErrorHandler) initPanics() chan error {
+	this.panicsOnce.Do(func() {
+		this.panics = make(chan error, 1)
+	})
+	return this.panics
+}
+
+func (this *PanicErrorHandler) SkipTable(from string, table *TableSchema, err error) {
+	this.Ferry.loggerFor("error_handler").WithError(err).WithFields(logrus.Fields{
+		"errfrom": from,
+		"table":   table.String(),
+	}).Error("skipping table, it will be incomplete on the target")
 }
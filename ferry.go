@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -33,11 +35,6 @@ const (
 	StateVerifyBeforeCutover = "verify-before-cutover"
 	StateCutover             = "cutover"
 	StateDone                = "done"
-
-	// useful only for debugging during development - way too verbose for debug
-	// logging in production
-	// NOTE: This may log confidential data - don't ever use for production data
-	IncrediblyVerboseLogging = false
 )
 
 func quoteField(field string) string {
@@ -66,12 +63,29 @@ type Ferry struct {
 	DataIterator *DataIterator
 	BatchWriter  *BatchWriter
 
-	StateTracker                       *StateTracker
-	ErrorHandler                       ErrorHandler
-	MigrationThrottler                 Throttler
-	ReplicationThrottler               Throttler
+	StateTracker *StateTracker
+	ErrorHandler ErrorHandler
+
+	// Throttle the reads of the data copy from the source, the writes of the
+	// binlog writer to the target, and the writes of the data copy to the
+	// target, respectively. The same throttler can be used for several of
+	// them. The data copy waits for both of its throttlers before reading a
+	// batch, so that the rows are not kept locked on the source while the
+	// writes are throttled.
+	//
+	// Optional: defaults to the LagThrottlers of Config.ReadThrottle and
+	// Config.WriteThrottle, or to throttlers that can only be paused
+	MigrationThrottler   Throttler
+	ReplicationThrottler Throttler
+	CopyWriteThrottler   Throttler
+
 	WaitUntilReplicaIsCaughtUpToMaster *WaitUntilReplicaIsCaughtUpToMaster
 
+	// Receives the data written to the target, see Sink. This can be
+	// specified by the caller, e.g. to write to BigQuery, see the bigquery
+	// package. If the ClickHouseSink is configured, Initialize adds it.
+	Sink Sink
+
 	// This can be specified by the caller. If specified, do not specify
 	// VerifierType in Config (or as an empty string) or an error will be
 	// returned in Initialize.
@@ -79,15 +93,103 @@ type Ferry struct {
 	// If VerifierType is specified and this is nil on Ferry initialization, a
 	// Verifier will be created by Initialize. If an IterativeVerifier is to be
 	// created, IterativeVerifierConfig will be used to create the verifier.
-	Verifier       Verifier
-	inlineVerifier *InlineVerifier
+	Verifier Verifier
+
+	// Reads the Tunables to apply when the process receives SIGHUP, e.g. by
+	// re-reading them from the config file.
+	//
+	// Optional: defaults to ignoring SIGHUP
+	ReloadTunables func() (Tunables, error)
+
+	inlineVerifier    *InlineVerifier
+	foreignWriteGuard *ForeignWriteGuard
+	lagMonitor        *LagMonitor
+	retentionMonitor  *BinlogRetentionMonitor
+	queryKiller       *QueryKiller
+	targetGuard       *TargetGuard
+	loopPrevention    *LoopPreventionFilter
+	auditLog          *AuditLog
+	positionMap       *PositionMap
+	blobChunker       *BlobChunker
+	dateTimeConverter *DateTimeConverter
+	binlogEventFilter *BinlogEventFilter
+
+	// the dedicated connection pools of the components, or nil if they use
+	// SourceDB or TargetDB, see DatabaseConfig.ComponentConnectionPools and
+	// DatabaseConfig.ComponentCredentials
+	dataIteratorDB   *sql.DB
+	blobChunkerDB    *sql.DB
+	batchWriterDB    *sql.DB
+	binlogWriterDB   *sql.DB
+	stateTrackerDB   *sql.DB
+	sourceVerifierDB *sql.DB
+	targetVerifierDB *sql.DB
+
+	// the delta copies run so far, by name
+	deltaCopies sync.Map
+
+	// the snapshot the rows are copied from, see Config.ConsistentSnapshot
+	snapshot *ConsistentSnapshot
+
+	// the tables given up on, see Config.ErrorPolicy
+	quarantine *TableQuarantine
+
+	// the events included in the state dumps, see Config.StateDumpBinlogEvents
+	binlogEventHistory *BinlogEventHistory
+
+	// held for the duration of the run, see Config.RunLock
+	runLock *RunLock
+
+	// records the progress on the target, see Config.ProgressHistory
+	progressHistory *ProgressHistory
+
+	// copies the tables leased by this process, see Config.DistributedCopy
+	distributedCopy *DistributedCopy
+
+	// counts the applied binlog events on the target, see
+	// Config.RecordAppliedBinlogEvents
+	appliedBinlogEvents *AppliedBinlogEvents
+
+	// the fingerprint of the config the run was started with, see
+	// Config.ResumeConfigMismatchPolicy
+	configFingerprint map[string]string
+
+	// the estimated size of the copy, see Config.Sizing
+	sizingReport *SizingReport
+
+	// sends the lifecycle events of the run, see Config.Notifications
+	notifications *Notifications
+
+	// the sink of the metrics set up from Config.Metrics
+	metricsSink MetricsSink
 
 	Tables TableSchemaCache
+	// guards Tables once the binlog writer runs, as it adds the tables created
+	// on the source and reloads the schemas of the changed ones
+	tablesMutex sync.RWMutex
+
+	// serializes the changes of the Tunables, see UpdateTunables
+	tunablesMutex sync.Mutex
 
 	StartTime    time.Time
 	DoneTime     time.Time
 	OverallState string
 
+	// The base logger and the metrics used by all components of the ferry.
+	// Set these to run multiple ferries in the same process without mixing
+	// up their logs and metrics.
+	//
+	// Optional: defaults to the standard logrus logger, and to the metrics of
+	// Config.Metrics or the global metrics
+	Logger  *logrus.Entry
+	Metrics *Metrics
+
+	// Log the statements and row data at the debug level, useful only for
+	// debugging during development - way too verbose for debug logging in
+	// production.
+	// NOTE: This may log confidential data - don't ever use for production data
+	IncrediblyVerboseLogging bool
+
 	logger *logrus.Entry
 
 	rowCopyCompleteCh chan struct{}
@@ -119,6 +221,17 @@ func (f *Ferry) NewBinlogStreamer() *BinlogStreamer {
 		MyServerId:   f.Config.MyServerId,
 		ErrorHandler: f.ErrorHandler,
 		ReadRetries:  f.DBReadRetries,
+		ErrorPolicy:  &f.Config.ErrorPolicy,
+
+		CatchUpConfig: &f.Config.CatchUp,
+
+		MyServerIdMin: f.Config.MyServerIdMin,
+		MyServerIdMax: f.Config.MyServerIdMax,
+
+		logger:  f.loggerFor("binlog_streamer"),
+		metrics: f.Metrics,
+
+		incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 	}
 }
 
@@ -137,13 +250,25 @@ func (f *Ferry) NewBatchWriter() *BatchWriter {
 	f.ensureInitialized()
 
 	batchWriter := &BatchWriter{
-		DB:           f.TargetDB,
+		DB:           f.componentDB(f.batchWriterDB, f.TargetDB),
 		StateTracker: f.StateTracker,
 
 		DatabaseRewrites: f.Config.DatabaseRewrites,
 		TableRewrites:    f.Config.TableRewrites,
 
 		WriteRetries: f.Config.DBWriteRetries,
+		RetryPolicy:  &f.Config.WriteRetryPolicy,
+
+		DiscardWrites:     f.Config.BenchmarkMode || f.Config.ClickHouseSink.Exclusive,
+		Sink:              f.Sink,
+		BlobChunker:       f.blobChunker,
+		DateTimeConverter: f.dateTimeConverter,
+		StmtCacheSize:     f.Config.StmtCacheSize,
+
+		logger:  f.loggerFor("batch_writer"),
+		metrics: f.Metrics,
+
+		incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 	}
 
 	batchWriter.Initialize()
@@ -160,11 +285,14 @@ func (f *Ferry) NewChecksumTableVerifier() *ChecksumTableVerifier {
 	f.ensureInitialized()
 
 	return &ChecksumTableVerifier{
-		SourceDB:         f.SourceDB,
-		TargetDB:         f.TargetDB,
+		SourceDB:         f.componentDB(f.sourceVerifierDB, f.SourceDB),
+		TargetDB:         f.componentDB(f.targetVerifierDB, f.TargetDB),
 		DatabaseRewrites: f.Config.DatabaseRewrites,
 		TableRewrites:    f.Config.TableRewrites,
-		Tables:           f.Tables.AsSlice(),
+		Tables:           f.copiedTables(),
+		ErrorHandler:     f.ErrorHandler,
+
+		logger: f.loggerFor("checksum_verifier"),
 	}
 }
 
@@ -179,8 +307,8 @@ func (f *Ferry) NewInlineVerifier() *InlineVerifier {
 	}
 
 	return &InlineVerifier{
-		SourceDB:                   f.SourceDB,
-		TargetDB:                   f.TargetDB,
+		SourceDB:                   f.componentDB(f.sourceVerifierDB, f.SourceDB),
+		TargetDB:                   f.componentDB(f.targetVerifierDB, f.TargetDB),
 		DatabaseRewrites:           f.Config.DatabaseRewrites,
 		TableRewrites:              f.Config.TableRewrites,
 		TableSchemaCache:           f.Tables,
@@ -189,13 +317,18 @@ func (f *Ferry) NewInlineVerifier() *InlineVerifier {
 		VerifyBinlogEventsInterval: f.Config.InlineVerifierConfig.verifyBinlogEventsInterval,
 		MaxExpectedDowntime:        f.Config.InlineVerifierConfig.maxExpectedDowntime,
 
-		StateTracker: f.StateTracker,
-		ErrorHandler: f.ErrorHandler,
+		StateTracker:     f.StateTracker,
+		ErrorHandler:     f.ErrorHandler,
+		Quarantine:       f.quarantine,
+		StreamOnlyTables: f.streamOnlyTables(),
 
 		reverifyStore:   binlogVerifyStore,
-		sourceStmtCache: NewStmtCache(),
-		targetStmtCache: NewStmtCache(),
-		logger:          logrus.WithField("tag", "inline-verifier"),
+		sourceStmtCache: NewBoundedStmtCache(f.Config.StmtCacheSize, "inline_verifier_source", f.Metrics),
+		targetStmtCache: NewBoundedStmtCache(f.Config.StmtCacheSize, "inline_verifier_target", f.Metrics),
+		logger:          f.loggerFor("inline-verifier"),
+
+		tableSchemaMutex:         &f.tablesMutex,
+		incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 	}
 }
 
@@ -237,19 +370,22 @@ func (f *Ferry) NewIterativeVerifier() (*IterativeVerifier, error) {
 
 	v := &IterativeVerifier{
 		CursorConfig: &CursorConfig{
-			DB:          f.SourceDB,
+			DB:          f.componentDB(f.sourceVerifierDB, f.SourceDB),
 			BatchSize:   f.Config.DataIterationBatchSize,
 			ReadRetries: f.Config.DBReadRetries,
 
 			IterateInDescendingOrder: f.Config.IterateInDescendingOrder,
+
+			Logger:                   f.Logger,
+			IncrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 		},
 
 		BinlogStreamer:      f.BinlogStreamer,
-		SourceDB:            f.SourceDB,
-		TargetDB:            f.TargetDB,
+		SourceDB:            f.componentDB(f.sourceVerifierDB, f.SourceDB),
+		TargetDB:            f.componentDB(f.targetVerifierDB, f.TargetDB),
 		CompressionVerifier: compressionVerifier,
 
-		Tables:              f.Tables.AsSlice(),
+		Tables:              f.copiedTables(),
 		TableSchemaCache:    f.Tables,
 		IgnoredTables:       config.IgnoredTables,
 		IgnoredColumns:      ignoredColumns,
@@ -258,21 +394,171 @@ func (f *Ferry) NewIterativeVerifier() (*IterativeVerifier, error) {
 		CopyFilter:          f.CopyFilter,
 		Concurrency:         config.Concurrency,
 		MaxExpectedDowntime: maxExpectedDowntime,
+		Quarantine:          f.quarantine,
+		StreamOnlyTables:    f.streamOnlyTables(),
+		ErrorHandler:        f.ErrorHandler,
+
+		IdleVerification: config.IdleVerification,
+		StateTracker:     f.StateTracker,
+		Throttler:        f.MigrationThrottler,
+
+		logger:  f.loggerFor("iterative_verifier"),
+		metrics: f.Metrics,
+
+		tableSchemaMutex:         &f.tablesMutex,
+		incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
 	}
 
 	if f.CopyFilter != nil {
 		v.CursorConfig.BuildSelect = f.CopyFilter.BuildSelect
 	}
+	if f.BinlogWriter != nil {
+		v.ApplyLag = f.BinlogWriter.ApplyLag
+	}
 
 	return v, v.Initialize()
 }
 
+// ProgressHistory returns the progress recorded on the target, see
+// Config.ProgressHistory, or nil if it is disabled
+func (f *Ferry) ProgressHistory() *ProgressHistory {
+	return f.progressHistory
+}
+
+// AppliedBinlogEvents returns the binlog events applied by table, see
+// Config.RecordAppliedBinlogEvents, or nil if they are not recorded
+func (f *Ferry) AppliedBinlogEvents() *AppliedBinlogEvents {
+	return f.appliedBinlogEvents
+}
+
+// initializeMetrics sets up the sink of Config.Metrics as the metrics of the
+// ferry. Unless another ferry of the process has done so already, they also
+// become the global metrics, so that the metrics of the components not
+// holding the ferry's Metrics are emitted to the same sink.
+func (f *Ferry) initializeMetrics() error {
+	var err error
+	switch f.Config.Metrics.Sink {
+	case MetricsSinkStatsD:
+		f.metricsSink, err = NewStatsDMetricsSink(f.Config.Metrics.StatsDAddress)
+		if err != nil {
+			return fmt.Errorf("failed to set up statsd metrics: %v", err)
+		}
+	case MetricsSinkPrometheus:
+		f.metricsSink = NewPrometheusMetricsSink()
+	case MetricsSinkLog:
+		f.metricsSink = &LogMetricsSink{Logger: f.loggerFor("metrics")}
+	default:
+		return fmt.Errorf("unknown metrics sink %s", f.Config.Metrics.Sink)
+	}
+
+	if metrics.Sink == nil {
+		f.Metrics = SetGlobalMetricsSink(f.Config.Metrics.Prefix, f.metricsSink)
+	} else {
+		f.Metrics = NewMetrics(f.Config.Metrics.Prefix, f.metricsSink)
+	}
+	f.Metrics.DefaultTags = metricTagsFromMap(f.Config.Metrics.Tags)
+	return nil
+}
+
+// initializeThrottlers sets up the throttlers not given to the ferry, from
+// Config.ReadThrottle and Config.WriteThrottle if configured
+func (f *Ferry) initializeThrottlers() error {
+	if f.MigrationThrottler == nil && f.Config.ReadThrottle != nil {
+		throttler, err := NewLagThrottler(f.Config.ReadThrottle)
+		if err != nil {
+			return fmt.Errorf("failed to create read throttler: %v", err)
+		}
+		f.MigrationThrottler = throttler
+	}
+
+	if f.Config.WriteThrottle != nil && (f.ReplicationThrottler == nil || f.CopyWriteThrottler == nil) {
+		throttler, err := NewLagThrottler(f.Config.WriteThrottle)
+		if err != nil {
+			return fmt.Errorf("failed to create write throttler: %v", err)
+		}
+		if f.ReplicationThrottler == nil {
+			f.ReplicationThrottler = throttler
+		}
+		if f.CopyWriteThrottler == nil {
+			f.CopyWriteThrottler = throttler
+		}
+	}
+
+	if f.MigrationThrottler == nil {
+		f.MigrationThrottler = &PauserThrottler{}
+	}
+
+	if f.ReplicationThrottler == nil {
+		f.ReplicationThrottler = &PauserThrottler{}
+	}
+
+	if f.CopyWriteThrottler == nil {
+		f.CopyWriteThrottler = &PauserThrottler{}
+	}
+
+	return nil
+}
+
+// throttlers returns the distinct throttlers of the ferry by name
+func (f *Ferry) throttlers() ([]string, []Throttler) {
+	var names []string
+	var throttlers []Throttler
+
+	candidates := []struct {
+		name      string
+		throttler Throttler
+	}{
+		{"migration-throttler", f.MigrationThrottler},
+		{"replication-throttler", f.ReplicationThrottler},
+		{"copy-write-throttler", f.CopyWriteThrottler},
+	}
+
+	for _, candidate := range candidates {
+		if candidate.throttler == nil {
+			continue
+		}
+
+		duplicate := false
+		for _, throttler := range throttlers {
+			duplicate = duplicate || throttler == candidate.throttler
+		}
+		if !duplicate {
+			names = append(names, candidate.name)
+			throttlers = append(throttlers, candidate.throttler)
+		}
+	}
+
+	return names, throttlers
+}
+
+// copyThrottler returns the throttler of the data copy, which waits for the
+// throttling of both the reads and the writes
+func (f *Ferry) copyThrottler() Throttler {
+	if f.CopyWriteThrottler == nil || f.CopyWriteThrottler == f.MigrationThrottler {
+		return f.MigrationThrottler
+	}
+	return &combinedThrottler{Throttler: f.MigrationThrottler, other: f.CopyWriteThrottler}
+}
+
 // Initialize all the components of Ghostferry and connect to the Database
 func (f *Ferry) Initialize() (err error) {
 	f.StartTime = time.Now().Truncate(time.Second)
-	f.OverallState = StateStarting
+	if f.Metrics == nil && f.Config.Metrics.Sink != "" {
+		err = f.initializeMetrics()
+		if err != nil {
+			return err
+		}
+	}
+	// the run id and the phase are tags of the ferry, not of the metrics it
+	// shares with the other ferries of the process, such as the global
+	// metrics or those given to both ferries of a BidirectionalFerry
+	f.Metrics = f.Metrics.WithOwnTags()
+	if f.Config.RunId != "" {
+		f.Metrics.SetDefaultTag("run_id", f.Config.RunId)
+	}
+	f.setOverallState(StateStarting)
 
-	f.logger = logrus.WithField("tag", "ferry")
+	f.logger = f.loggerFor("ferry")
 	f.rowCopyCompleteCh = make(chan struct{})
 
 	f.logger.Infof("hello world from %s", VersionString)
@@ -324,6 +610,33 @@ func (f *Ferry) Initialize() (err error) {
 		return fmt.Errorf("@@read_only must be OFF on target db")
 	}
 
+	err = f.checkSkipTargetBinlog()
+	if err != nil {
+		f.logger.WithError(err).Error("cannot skip the binlogs of the target")
+		return err
+	}
+
+	err = f.openComponentConnectionPools()
+	if err != nil {
+		f.logger.WithError(err).Error("failed to connect component connection pools")
+		return err
+	}
+
+	// acquire the lock before anything is read from or written to the
+	// target, in particular the resume state
+	if f.Config.RunLock.Enabled {
+		name := f.Config.RunLock.Name
+		if name == "" {
+			name = DefaultRunLockName(f.Source, f.Target)
+		}
+
+		f.runLock, err = AcquireRunLock(f.TargetDB, name, f.loggerFor("run_lock"))
+		if err != nil {
+			f.logger.WithError(err).Error("failed to acquire run lock")
+			return err
+		}
+	}
+
 	// Check if we're running from a replica or not and sanity check
 	// the configurations given to Ghostferry as well as the configurations
 	// of the MySQL databases.
@@ -385,12 +698,22 @@ func (f *Ferry) Initialize() (err error) {
 		}
 	}
 
-	if f.MigrationThrottler == nil {
-		f.MigrationThrottler = &PauserThrottler{}
+	if f.Config.Notifications.Enabled() {
+		f.notifications = f.NewNotifications()
 	}
 
-	if f.ReplicationThrottler == nil {
-		f.ReplicationThrottler = &PauserThrottler{}
+	f.quarantine = &TableQuarantine{}
+	if f.StateToResumeFrom != nil {
+		f.quarantine.Restore(f.StateToResumeFrom.QuarantinedTables)
+	}
+
+	if f.Config.StateDumpBinlogEvents > 0 {
+		f.binlogEventHistory = NewBinlogEventHistory(f.Config.StateDumpBinlogEvents)
+	}
+
+	err = f.initializeThrottlers()
+	if err != nil {
+		return err
 	}
 
 	// Loads the schema of the tables that are applicable.
@@ -404,7 +727,7 @@ func (f *Ferry) Initialize() (err error) {
 	// changed.
 	if f.StateToResumeFrom == nil || f.StateToResumeFrom.LastKnownTableSchemaCache == nil {
 		f.logger.Debug("loading table schema from source DB")
-		metrics.Measure("LoadTables", nil, 1.0, func() {
+		f.Metrics.Measure("LoadTables", nil, 1.0, func() {
 			f.Tables, err = LoadTables(f.SourceDB, f.TableFilter, f.CompressedColumnsForVerification, f.IgnoredColumnsForVerification, f.CascadingPaginationColumnConfig)
 		})
 		if err != nil {
@@ -414,6 +737,17 @@ func (f *Ferry) Initialize() (err error) {
 		f.Tables = f.StateToResumeFrom.LastKnownTableSchemaCache
 	}
 
+	// the privileges are checked on the databases of the loaded tables
+	if f.Config.ReadOnlySource {
+		err = f.checkReadOnlySource()
+		if err != nil {
+			f.logger.WithError(err).Error("source connections are not read-only")
+			return err
+		}
+	}
+
+	f.estimateSizing()
+
 	if f.StateToResumeFrom != nil {
 		f.StateTracker, err = NewStateTrackerFromSerializedState(f.DataIterationConcurrency*10, f.StateToResumeFrom, f.Tables)
 		if err != nil {
@@ -427,14 +761,132 @@ func (f *Ferry) Initialize() (err error) {
 	} else {
 		f.StateTracker = NewStateTracker(f.DataIterationConcurrency * 10)
 	}
+	f.StateTracker.logger = f.loggerFor("state_tracker")
+	f.StateTracker.incrediblyVerboseLogging = f.IncrediblyVerboseLogging
+	if err = f.initializeConfigFingerprint(); err != nil {
+		return err
+	}
+	if f.Config.TableCopyHooks.Enabled() {
+		f.StateTracker.AddTableCompletionHook(f.NewTableCopyHooks())
+	}
+
+	if f.Config.DistributedCopy.Enabled() {
+		// the leases and the copy state are shared in the state tables
+		if f.StateTracker.stateTablesPrefix == "" {
+			return fmt.Errorf("DistributedCopy cannot resume from a state dump, as the state is shared in the ResumeStateFromDB")
+		}
+		f.distributedCopy = f.NewDistributedCopy()
+	}
+
+	if f.Config.ProgressHistory.Enabled() {
+		f.progressHistory = f.NewProgressHistory()
+		err = f.progressHistory.Initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.Config.RecordAppliedBinlogEvents {
+		f.appliedBinlogEvents = f.NewAppliedBinlogEvents()
+		err = f.appliedBinlogEvents.Initialize()
+		if err != nil {
+			return err
+		}
+	}
 
 	// The iterative verifier needs the binlog streamer so this has to be first.
 	// Eventually this can be moved below the verifier initialization.
 	f.BinlogStreamer = f.NewBinlogStreamer()
+
+	if f.Config.LoopPrevention.Enabled() {
+		f.loopPrevention = f.NewLoopPreventionFilter()
+		f.BinlogStreamer.SkipEvent = f.loopPrevention.SkipEvent
+	}
+
+	if f.Config.AuditLog.Enabled() {
+		f.auditLog, err = NewAuditLog(&f.Config.AuditLog, f.TargetDB, f.loggerFor("audit_log"))
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize audit log")
+			return err
+		}
+	}
+
+	if f.Config.PositionMap.Enabled() {
+		f.positionMap, err = NewPositionMap(&f.Config.PositionMap, f.TargetDB, f.loggerFor("position_map"))
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize position map")
+			return err
+		}
+	}
+
+	if f.Config.ClickHouseSink.Enabled() {
+		clickHouseSink := NewClickHouseSink(&f.Config.ClickHouseSink, f.Config.DatabaseRewrites, f.Config.TableRewrites, f.loggerFor("clickhouse_sink"))
+		if f.Sink == nil {
+			f.Sink = clickHouseSink
+		} else {
+			f.Sink = MultiSink{f.Sink, clickHouseSink}
+		}
+	}
+
+	if f.Config.BlobChunking.Enabled() {
+		f.blobChunker, err = NewBlobChunker(&f.Config.BlobChunking, f.blobChunkerDB, f.Tables, f.loggerFor("blob_chunker"))
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize blob chunker")
+			return err
+		}
+	}
+
+	if f.Config.DateTimeConversion.Enabled() {
+		f.dateTimeConverter, err = NewDateTimeConverter(&f.Config.DateTimeConversion, f.Tables)
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize DATETIME conversion")
+			return err
+		}
+	}
+
+	if f.Config.BinlogEventFilter.Enabled() {
+		f.binlogEventFilter, err = NewBinlogEventFilter(&f.Config.BinlogEventFilter, f.Tables)
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize binlog event filter")
+			return err
+		}
+	}
+
+	// the guard throttles the writers, so it has to be created first
+	if f.Config.TargetGuard.Enabled() {
+		f.targetGuard = f.NewTargetGuard()
+	}
+
+	if f.Config.QueryKiller.Enabled() {
+		f.queryKiller = f.NewQueryKiller()
+	}
+
 	f.BinlogWriter = f.NewBinlogWriter()
+	f.BinlogWriter.StreamingIdle = f.BinlogStreamer.IsIdle
+	if f.BinlogWriter.accountsRowsAffected() {
+		if err = f.BinlogWriter.TrackTableCompletions(); err != nil {
+			return err
+		}
+	}
 	f.DataIterator = f.NewDataIterator()
 	f.BatchWriter = f.NewBatchWriter()
 
+	if f.Config.LagAlert.Enabled() {
+		f.lagMonitor = f.NewLagMonitor()
+	}
+
+	if f.Config.BinlogRetention.Enabled() {
+		f.retentionMonitor = f.NewBinlogRetentionMonitor()
+	}
+
+	if f.Config.ForeignWriteGuard.Enabled {
+		f.foreignWriteGuard = f.NewForeignWriteGuard()
+
+		// the guard attributes writes to Ghostferry by looking up the sessions
+		// of the target users
+		f.keepTargetSessionsOpen()
+	}
+
 	if f.Config.VerifierType != "" {
 		if f.Verifier != nil {
 			return errors.New("VerifierType specified and Verifier is given. these are mutually exclusive options")
@@ -446,6 +898,11 @@ func (f *Ferry) Initialize() (err error) {
 			if err != nil {
 				return err
 			}
+		case VerifierTypeSampling:
+			f.Verifier, err = f.NewSamplingVerifier()
+			if err != nil {
+				return err
+			}
 		case VerifierTypeChecksumTable:
 			f.Verifier = f.NewChecksumTableVerifier()
 		case VerifierTypeInline:
@@ -499,12 +956,72 @@ func (f *Ferry) Start() error {
 	// use the oldest position in `MinBinlogPosition()`, resume may fail for
 	// the minimum position.
 	// In this case, using the last written position is the better state to use
+	//
+	// With the inline verifier, the rows changed by the events between the
+	// two positions are re-queued for reverification first, see
+	// requeueReverifyOnResume.
 	var pos BinlogPosition
 	var err error
-	if f.StateToResumeFrom == nil {
+	if f.Config.DumpLoad.Enabled() && f.StateToResumeFrom == nil {
+		// the binlog streaming starts from the coordinates of the dump
+		if err = f.LoadDump(); err != nil {
+			return fmt.Errorf("failed to load dump: %v", err)
+		}
+	}
+
+	if f.Config.StartPosition.Enabled() && f.StateToResumeFrom == nil {
+		// the binlog streaming starts from the given position
+		if err = f.StartFromPosition(); err != nil {
+			return fmt.Errorf("failed to start from position: %v", err)
+		}
+	}
+
+	if f.StateToResumeFrom != nil {
+		// fail clearly rather than with the replication error of the source
+		// if the binlogs to resume from were purged while the run was down
+		resumePosition := resumeBinlogPosition(f.StateToResumeFrom, f.inlineVerifier != nil)
+		if resumePosition.Name != "" {
+			if err = CheckBinlogPositionAvailable(f.SourceDB, resumePosition); err != nil {
+				return fmt.Errorf("cannot resume: %v", err)
+			}
+		}
+
+		if err = f.resetRecopiedTables(); err != nil {
+			return fmt.Errorf("failed to reset the tables to copy again: %v", err)
+		}
+	}
+
+	if err = f.markStreamOnlyTables(); err != nil {
+		return err
+	}
+
+	// after loading a dump, which may have created triggers on the target
+	if err = f.handleTargetTriggers(); err != nil {
+		return err
+	}
+
+	if f.StateToResumeFrom == nil && f.Config.ConsistentSnapshot {
+		// the binlog streaming starts from the coordinates of the snapshot,
+		// once the copy is done, see Run
+		if f.Config.ConsistentSnapshotLock == SnapshotLockBackup {
+			f.snapshot, err = TakeConsistentSnapshotWithBackupLock(f.DataIterator.DB, f.DataIterator.Concurrency+1, f.Tables.AsSlice(), f.loggerFor("consistent_snapshot"))
+		} else {
+			f.snapshot, err = TakeConsistentSnapshot(f.DataIterator.DB, f.DataIterator.Concurrency+1, f.loggerFor("consistent_snapshot"))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to take consistent snapshot: %v", err)
+		}
+		f.DataIterator.CursorConfig.Snapshot = f.snapshot
+		pos = NewResumableBinlogPosition(f.snapshot.Position)
+	} else if f.StateToResumeFrom == nil {
 		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysql()
 	} else if f.inlineVerifier != nil {
-		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.StateToResumeFrom.MinBinlogPosition())
+		var resumePosition BinlogPosition
+		resumePosition, err = f.requeueReverifyOnResume()
+		if err != nil {
+			return fmt.Errorf("failed to re-queue the rows to reverify: %v", err)
+		}
+		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(resumePosition)
 	} else {
 		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.StateToResumeFrom.LastWrittenBinlogPosition)
 	}
@@ -512,6 +1029,13 @@ func (f *Ferry) Start() error {
 		return err
 	}
 
+	if f.foreignWriteGuard != nil {
+		err = f.foreignWriteGuard.Connect()
+		if err != nil {
+			return err
+		}
+	}
+
 	// If we don't set this now, there is a race condition where ghostferry
 	// is terminated with some rows copied but no binlog events are written.
 	// This guarantees that we are able to restart from a valid location.
@@ -527,7 +1051,12 @@ func (f *Ferry) Start() error {
 // Wait for the background tasks to finish.
 func (f *Ferry) Run() {
 	f.logger.Info("starting ferry run")
-	f.OverallState = StateCopying
+	f.setOverallState(StateCopying)
+	f.notify(NotificationRunStarted, fmt.Sprintf("started copying %d tables", len(f.tables())), nil)
+
+	if !f.Config.BenchmarkMode && f.Config.SchemaDriftAction != SchemaDriftActionIgnore {
+		f.checkSchemaDrift()
+	}
 
 	ctx, shutdown := context.WithCancel(context.Background())
 
@@ -539,112 +1068,272 @@ func (f *Ferry) Run() {
 
 	supportingServicesWg := &sync.WaitGroup{}
 
-	// it's possible to use just one throttler - if they map to the same
-	// instance, don't "run" them twice
-	if f.MigrationThrottler == f.ReplicationThrottler {
-		supportingServicesWg.Add(1)
-	} else {
-		supportingServicesWg.Add(2)
+	// it's possible to use the same throttler several times - if they map to
+	// the same instance, don't "run" them twice
+	throttlerNames, throttlers := f.throttlers()
+	for i, throttler := range throttlers {
+		name, throttler := throttlerNames[i], throttler
 
+		supportingServicesWg.Add(1)
 		go func() {
 			defer supportingServicesWg.Done()
-			handleError("replication-throttler", f.ReplicationThrottler.Run(ctx))
+			defer RecoverPanic(name, f.ErrorHandler)
+			handleError(name, throttler.Run(ctx))
 		}()
 	}
 
-	go func() {
-		defer supportingServicesWg.Done()
-		handleError("migration-throttler", f.MigrationThrottler.Run(ctx))
-	}()
-
-	if f.Config.ProgressCallback.URI != "" {
+	if f.foreignWriteGuard != nil {
 		supportingServicesWg.Add(1)
 		go func() {
 			defer supportingServicesWg.Done()
-
-			frequency := time.Duration(f.Config.ProgressReportFrequency) * time.Millisecond
-
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(frequency):
-					f.ReportProgress()
-				}
-			}
+			defer RecoverPanic("foreign_write_guard", f.ErrorHandler)
+			f.foreignWriteGuard.Run(ctx)
 		}()
 	}
 
-	if f.DumpStateOnSignal {
-		f.logger.Debug("Setting up DumpStateOnSignal")
+	if f.loopPrevention != nil {
+		supportingServicesWg.Add(1)
 		go func() {
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-
-			f.logger.Debug("Waiting for DumpStateOnSignal")
-			s := <-c
-			f.logger.Info("Received DumpStateOnSignal")
-			if ctx.Err() == nil {
-				// Ghostferry is still running
-				f.ErrorHandler.Fatal("user_interrupt", fmt.Errorf("signal received: %v", s.String()))
-			} else {
-				// shutdown() has been called and Ghostferry is done.
-				os.Exit(0)
-			}
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("loop_prevention", f.ErrorHandler)
+			f.loopPrevention.Run(ctx)
 		}()
 	}
 
-	inlineVerifierWg := &sync.WaitGroup{}
-	inlineVerifierContext, stopInlineVerifier := context.WithCancel(ctx)
-	if f.inlineVerifier != nil {
-		inlineVerifierWg.Add(1)
+	if f.runLock != nil {
+		f.runLock.CheckInterval = f.Config.RunLock.checkInterval
+		f.runLock.ErrorHandler = f.ErrorHandler
+
+		supportingServicesWg.Add(1)
 		go func() {
-			defer inlineVerifierWg.Done()
-			f.inlineVerifier.PeriodicallyVerifyBinlogEvents(inlineVerifierContext)
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("run_lock", f.ErrorHandler)
+			f.runLock.Run(ctx)
+		}()
+	}
+
+	if f.targetGuard != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("target_guard", f.ErrorHandler)
+			f.targetGuard.Run(ctx)
+		}()
+	}
+
+	if f.lagMonitor != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("lag_monitor", f.ErrorHandler)
+			f.lagMonitor.Run(ctx)
+		}()
+	}
+
+	if f.retentionMonitor != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("binlog_retention", f.ErrorHandler)
+			f.retentionMonitor.Run(ctx)
+		}()
+	}
+
+	if f.queryKiller != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("query_killer", f.ErrorHandler)
+			f.queryKiller.Run(ctx)
+		}()
+	}
+
+	if f.ReloadTunables != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("tunables", f.ErrorHandler)
+			f.reloadTunablesOnSignal(ctx.Done())
+		}()
+	}
+
+	if f.Config.ProgressCallback.URI != "" {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("progress_callback", f.ErrorHandler)
+
+			frequency := time.Duration(f.Config.ProgressReportFrequency) * time.Millisecond
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(frequency):
+					f.ReportProgress()
+				}
+			}
+		}()
+	}
+
+	if f.progressHistory != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer RecoverPanic("progress_history", f.ErrorHandler)
+			f.progressHistory.Run(ctx)
+		}()
+	}
+
+	if f.DumpStateOnSignal {
+		f.logger.Debug("Setting up DumpStateOnSignal")
+		go func() {
+			defer RecoverPanic("user_interrupt", f.ErrorHandler)
+
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+			f.logger.Debug("Waiting for DumpStateOnSignal")
+			s := <-c
+			f.logger.Info("Received DumpStateOnSignal")
+			if ctx.Err() == nil {
+				// Ghostferry is still running, the events held for the
+				// apply delay are not waited for
+				f.BinlogWriter.Shutdown()
+				f.ErrorHandler.Fatal("user_interrupt", fmt.Errorf("signal received: %v", s.String()))
+			} else {
+				// shutdown() has been called and Ghostferry is done.
+				f.CloseTunnels()
+				os.Exit(0)
+			}
+		}()
+	}
+
+	inlineVerifierWg := &sync.WaitGroup{}
+	inlineVerifierContext, stopInlineVerifier := context.WithCancel(ctx)
+	if f.inlineVerifier != nil {
+		inlineVerifierWg.Add(1)
+		go func() {
+			defer inlineVerifierWg.Done()
+			defer RecoverPanic("inline_verifier", f.ErrorHandler)
+			f.inlineVerifier.PeriodicallyVerifyBinlogEvents(inlineVerifierContext)
+		}()
+	}
+
+	// the rows copied from a snapshot differ from the source until the
+	// binlogs are applied after the copy
+	idleVerifierWg := &sync.WaitGroup{}
+	idleVerifierContext, stopIdleVerifier := context.WithCancel(ctx)
+	if iterativeVerifier, ok := f.Verifier.(*IterativeVerifier); ok && iterativeVerifier.IdleVerification != nil && f.snapshot == nil {
+		idleVerifierWg.Add(1)
+		go func() {
+			defer idleVerifierWg.Done()
+			defer RecoverPanic("iterative_verifier", f.ErrorHandler)
+			iterativeVerifier.VerifyWhileIdle(idleVerifierContext)
 		}()
 	}
 
 	binlogWg := &sync.WaitGroup{}
 	binlogWg.Add(2)
 
-	go func() {
-		defer binlogWg.Done()
-		f.BinlogWriter.Run()
-	}()
+	startBinlogStreaming := func() {
+		go func() {
+			defer binlogWg.Done()
+			defer RecoverPanic("binlog_writer", f.ErrorHandler)
+			f.BinlogWriter.Run()
+		}()
 
-	go func() {
-		defer binlogWg.Done()
+		go func() {
+			defer binlogWg.Done()
+			defer RecoverPanic("binlog_streamer", f.ErrorHandler)
 
-		f.BinlogStreamer.Run()
-		f.BinlogWriter.Stop()
-	}()
+			f.BinlogStreamer.Run()
+			f.BinlogWriter.Stop()
+		}()
+	}
+
+	// the binlogs cannot be applied while the rows are copied from a
+	// snapshot, as the copy could overwrite the newer rows
+	if f.snapshot == nil {
+		startBinlogStreaming()
+	}
+
+	tableDiscoveryWg := &sync.WaitGroup{}
+	tableDiscoveryContext, stopTableDiscovery := context.WithCancel(ctx)
+	if f.Config.TableDiscovery.Enabled() {
+		tableDiscoveryWg.Add(1)
+		go func() {
+			defer tableDiscoveryWg.Done()
+			defer RecoverPanic("table_discovery", f.ErrorHandler)
+			f.runTableDiscovery(tableDiscoveryContext)
+		}()
+	}
 
 	dataIteratorWg := &sync.WaitGroup{}
 	dataIteratorWg.Add(1)
+	dataIterationStart := time.Now()
 
 	go func() {
 		defer dataIteratorWg.Done()
+		defer RecoverPanic("data_iterator", f.ErrorHandler)
 
 		if f.Config.DelayDataIterationUntilBinlogWriterShutdown {
 			f.logger.Info("Delaying data copy until binlog writer shuts down")
 			binlogWg.Wait()
 			f.logger.Info("Binlog writer has shut down, resuming data copy")
 		}
-		f.DataIterator.Run(f.Tables.AsSlice())
+
+		if f.distributedCopy != nil {
+			f.runDistributedCopy(ctx)
+		} else {
+			f.DataIterator.Run(f.tables())
+		}
 	}()
 
 	dataIteratorWg.Wait()
 
+	stopTableDiscovery()
+	tableDiscoveryWg.Wait()
+	if f.Config.TableDiscovery.Enabled() {
+		// the tables created since the last lookup
+		if err := f.copyDiscoveredTables(ctx); err != nil {
+			f.ErrorHandler.Fatal("table_discovery", err)
+		}
+	}
+
+	if f.snapshot != nil {
+		f.snapshot.Close()
+
+		f.logger.WithField("position", f.snapshot.Position).Info("copied rows from snapshot, streaming binlogs from its position")
+		_, err := f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(NewResumableBinlogPosition(f.snapshot.Position))
+		if err != nil {
+			f.ErrorHandler.Fatal("binlog_streamer", err)
+		}
+		startBinlogStreaming()
+	}
+
+	f.notify(NotificationRowCopyCompleted, fmt.Sprintf("copied the rows of %d tables in %s", len(f.tables()), time.Since(dataIterationStart).Round(time.Second)), map[string]string{
+		"quarantined_tables": fmt.Sprintf("%d", len(f.QuarantinedTables())),
+		"stream_only_tables": fmt.Sprintf("%d", len(f.Config.StreamOnlyTables)),
+	})
+
+	if f.Config.BenchmarkMode {
+		f.logBenchmarkResult(f.BenchmarkResult(time.Since(dataIterationStart)))
+	}
+
 	if f.inlineVerifier != nil {
 		stopInlineVerifier()
 		inlineVerifierWg.Wait()
 	}
 
+	stopIdleVerifier()
+	idleVerifierWg.Wait()
+
 	if f.Verifier != nil {
 		f.logger.Info("calling VerifyBeforeCutover")
-		f.OverallState = StateVerifyBeforeCutover
+		f.setOverallState(StateVerifyBeforeCutover)
 
-		metrics.Measure("VerifyBeforeCutover", nil, 1.0, func() {
+		f.Metrics.Measure("VerifyBeforeCutover", nil, 1.0, func() {
 			err := f.Verifier.VerifyBeforeCutover()
 			if err != nil {
 				f.logger.WithError(err).Error("VerifyBeforeCutover failed")
@@ -654,12 +1343,16 @@ func (f *Ferry) Run() {
 	}
 
 	if !f.DisableCutover {
+		if err := f.checkQuarantinedTablesBeforeCutover(); err != nil {
+			f.ErrorHandler.Fatal("table_quarantine", err)
+		}
+
 		f.logger.Info("data copy is complete, waiting for cutover")
-		f.OverallState = StateWaitingForCutover
+		f.setOverallState(StateWaitingForCutover)
 		f.waitUntilAutomaticCutoverIsTrue()
 
 		f.logger.Info("entering cutover phase, notifying caller that row copy is complete")
-		f.OverallState = StateCutover
+		f.setOverallState(StateCutover)
 		f.notifyRowCopyComplete()
 	}
 
@@ -676,12 +1369,47 @@ func (f *Ferry) Run() {
 	binlogWg.Wait()
 
 	f.logger.Info("ghostferry run is complete, shutting down auxiliary services")
-	f.OverallState = StateDone
+	f.setOverallState(StateDone)
 	f.DoneTime = time.Now()
 
+	if f.foreignWriteGuard != nil {
+		f.foreignWriteGuard.Stop()
+	}
+	if f.auditLog != nil {
+		if err := f.auditLog.Close(); err != nil {
+			f.logger.WithError(err).Error("failed to close audit log")
+		}
+	}
+	if f.Sink != nil {
+		if err := f.Sink.Close(); err != nil {
+			f.logger.WithError(err).Error("failed to close sink")
+		}
+	}
 	shutdown()
 	supportingServicesWg.Wait()
 
+	if f.runLock != nil {
+		if err := f.runLock.Release(); err != nil {
+			f.logger.WithError(err).Error("failed to release run lock")
+		}
+	}
+
+	for table, err := range f.QuarantinedTables() {
+		f.logger.WithError(err).WithField("table", table).Warn("table was quarantined and is incomplete on the target")
+	}
+
+	if f.progressHistory != nil {
+		if err := f.progressHistory.Record(f.Progress()); err != nil {
+			f.logger.WithError(err).Warn("failed to record final progress history")
+		}
+	}
+
+	if !f.DisableCutover {
+		f.notify(NotificationCutoverCompleted, fmt.Sprintf("cutover completed after %s", f.DoneTime.Sub(f.StartTime).Round(time.Second)), map[string]string{
+			"final_binlog_position": f.BinlogStreamer.GetLastStreamedBinlogPosition().String(),
+		})
+	}
+
 	if f.Config.ProgressCallback.URI != "" {
 		f.ReportProgress()
 	}
@@ -711,14 +1439,84 @@ func (f *Ferry) RunStandaloneDataCopy(tables []*TableSchema) error {
 	return nil
 }
 
+type deltaCopy struct {
+	tables       []*TableSchema
+	dataIterator *DataIterator
+}
+
+// RunResumableDataCopy copies the tables like RunStandaloneDataCopy, but
+// tracks the progress of the copy under the given name in the StateTracker.
+// Tables completed by an earlier run of the copy with the same name, e.g.
+// before the ferry was interrupted and resumed, are not copied again, and
+// tables in progress are resumed from their last copied pagination key. The
+// progress of the copy is reported in Progress.DeltaCopies.
+//
+// Skipping completed tables is only safe if they have not been written to on
+// the source since, e.g. because the source is still locked for the cutover.
+// The earlier copy is therefore only resumed if the binlog position of the
+// source did not move since it started, see
+// StateTracker.DeltaCopyStateTracker.
+func (f *Ferry) RunResumableDataCopy(name string, tables []*TableSchema) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	sourcePosition, err := ShowMasterStatusBinlogPosition(f.SourceDB)
+	if err != nil {
+		return err
+	}
+
+	dataIterator := f.NewDataIterator()
+	dataIterator.Concurrency = f.Config.DeltaCopyConcurrency
+	dataIterator.StateTracker = f.StateTracker.DeltaCopyStateTracker(name, sourcePosition)
+	dataIterator.logger = dataIterator.logger.WithField("delta_copy", name)
+
+	// the state of delta copies is not written to the target state tables
+	// (see Config.ResumeStateFromDB), only serialized along with the state of
+	// the ferry
+	batchWriter := f.NewBatchWriter()
+	batchWriter.StateTracker = dataIterator.StateTracker
+
+	// Always use the InlineVerifier to verify the copied data here.
+	dataIterator.SelectFingerprint = true
+	batchWriter.InlineVerifier = f.NewInlineVerifierWithoutStateTracker()
+
+	dataIterator.AddBatchListener(batchWriter.WriteRowBatch)
+	f.deltaCopies.Store(name, &deltaCopy{tables: tables, dataIterator: dataIterator})
+	f.logger.WithFields(logrus.Fields{
+		"name":   name,
+		"tables": tables,
+	}).Info("starting resumable delta table copy")
+
+	dataIterator.Run(tables)
+
+	return nil
+}
+
 // Call this method and perform the cutover after this method returns.
 func (f *Ferry) WaitUntilRowCopyIsComplete() {
 	<-f.rowCopyCompleteCh
 }
 
 func (f *Ferry) WaitUntilBinlogStreamerCatchesUp() {
-	for !f.BinlogStreamer.IsAlmostCaughtUp() {
-		time.Sleep(500 * time.Millisecond)
+	for {
+		status, err := f.BinlogStreamer.CatchUpStatus()
+		if err != nil {
+			// fall back to the lag alone rather than waiting forever
+			f.logger.WithError(err).Warn("failed to compare the binlog streaming to the source position")
+			if f.BinlogStreamer.IsAlmostCaughtUp() {
+				return
+			}
+		} else if status.CaughtUp {
+			f.logger.WithFields(logrus.Fields{
+				"position":     status.StreamedPosition,
+				"lag":          status.Lag,
+				"bytes_behind": status.BytesBehind,
+			}).Info("binlog streaming caught up with the source")
+			return
+		}
+
+		time.Sleep(f.BinlogStreamer.catchUpConfig().checkInterval)
 	}
 }
 
@@ -754,6 +1552,87 @@ func (f *Ferry) FlushBinlogAndStopStreaming() {
 	f.BinlogStreamer.FlushAndStop()
 }
 
+// Pause suspends the data copy and the application of binlog events to the
+// target, waits for writes in progress to complete, and flushes the state to
+// the StateFilename and/or state tables on the target DB (if configured).
+//
+// The binlog streamer keeps receiving events while paused, which are buffered
+// by the binlog writer until its buffer is full.
+//
+// NOTE: Rows that were already being read from the source (or binlog events
+// that were just about to be applied) when Pause was called may still be
+// written afterwards. This is safe, as writing them again on resume is
+// idempotent, but the flushed state may lag behind slightly.
+func (f *Ferry) Pause(ctx context.Context) error {
+	f.logger.Info("pausing ferry")
+	_, throttlers := f.throttlers()
+	for _, throttler := range throttlers {
+		throttler.SetPaused(true)
+	}
+
+	for !f.writesAreIdle() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return f.FlushState()
+}
+
+// Resume continues a ferry suspended by Pause.
+func (f *Ferry) Resume() {
+	f.logger.Info("resuming ferry")
+	_, throttlers := f.throttlers()
+	for _, throttler := range throttlers {
+		throttler.SetPaused(false)
+	}
+}
+
+// setOverallState changes the state of the run, which is also the phase of
+// the metrics emitted from now on
+func (f *Ferry) setOverallState(state string) {
+	f.OverallState = state
+	f.Metrics.orGlobal().SetPhase(state)
+}
+
+// FlushState writes the current state to the StateFilename and to the state
+// tables on the target DB, if either is configured.
+func (f *Ferry) FlushState() error {
+	if f.StateTracker == nil {
+		return nil
+	}
+
+	if f.StateFilename != "" {
+		stateJSON, err := f.SerializeStateToJSON()
+		if err != nil {
+			return err
+		}
+
+		stateJSON, err = f.encryptStateDump(stateJSON)
+		if err != nil {
+			return fmt.Errorf("encrypting state: %v", err)
+		}
+
+		err = ioutil.WriteFile(f.StateFilename, []byte(stateJSON), 0640)
+		if err != nil {
+			return fmt.Errorf("writing state to %s: %v", f.StateFilename, err)
+		}
+	}
+
+	return f.StateTracker.SerializeToDB(f.stateTablesDB())
+}
+
+func (f *Ferry) writesAreIdle() bool {
+	if f.BatchWriter.InFlightBatches() > 0 {
+		return false
+	}
+
+	state, _ := f.BinlogWriter.GetWriterState()
+	return state != WriterStateApplyingEvents
+}
+
 func (f *Ferry) SerializeStateToJSON() (string, error) {
 	if f.StateTracker == nil {
 		err := errors.New("no valid StateTracker")
@@ -764,7 +1643,16 @@ func (f *Ferry) SerializeStateToJSON() (string, error) {
 		binlogVerifyStore = f.inlineVerifier.reverifyStore
 	}
 
+	// the schemas are marshalled with the state
+	f.tablesMutex.RLock()
+	defer f.tablesMutex.RUnlock()
+
 	serializedState := f.StateTracker.Serialize(f.Tables, binlogVerifyStore)
+	serializedState.ConfigFingerprint = f.configFingerprint
+	serializedState.QuarantinedTables = f.quarantine.Serialize()
+	if f.binlogEventHistory != nil {
+		serializedState.RecentBinlogEvents = f.binlogEventHistory.Snapshot()
+	}
 
 	stateBytes, err := json.MarshalIndent(serializedState, "", " ")
 	return string(stateBytes), err
@@ -777,7 +1665,14 @@ func (f *Ferry) Progress() *Progress {
 		VerifierType:  f.VerifierType,
 	}
 
-	s.Throttled = f.MigrationThrottler.Throttled() || f.ReplicationThrottler.Throttled()
+	_, throttlers := f.throttlers()
+	for _, throttler := range throttlers {
+		s.Throttled = s.Throttled || throttler.Throttled()
+	}
+	if f.targetGuard != nil {
+		s.TargetGuardReason = f.targetGuard.Reason()
+		s.Throttled = s.Throttled || s.TargetGuardReason != ""
+	}
 
 	// Binlog Progress
 	s.LastSuccessfulBinlogPos = f.BinlogStreamer.GetLastStreamedBinlogPosition()
@@ -786,22 +1681,109 @@ func (f *Ferry) Progress() *Progress {
 
 	// Table Progress
 	serializedState := f.StateTracker.Serialize(nil, nil)
-	s.Tables = make(map[string]TableProgress)
-	targetPaginationKeys := make(map[string]*PaginationKeyData)
-	f.DataIterator.targetPaginationKeys.Range(func(k, v interface{}) bool {
-		targetPaginationKeys[k.(string)] = v.(*PaginationKeyData)
+	targetPaginationKeys := f.DataIterator.TargetPaginationKeys()
+	s.Tables = f.tablesProgress(f.tables(), serializedState.LastSuccessfulPaginationKeys, serializedState.CompletedTables, targetPaginationKeys)
+	for table := range serializedState.StreamOnlyTables {
+		if progress, found := s.Tables[table]; found {
+			progress.CurrentAction = TableActionStreamOnly
+			s.Tables[table] = progress
+		}
+	}
+
+	for table, err := range f.QuarantinedTables() {
+		if s.QuarantinedTables == nil {
+			s.QuarantinedTables = make(map[string]string)
+		}
+		s.QuarantinedTables[table] = err.Error()
+	}
+
+	f.deltaCopies.Range(func(k, v interface{}) bool {
+		name := k.(string)
+		deltaCopy := v.(*deltaCopy)
+		deltaCopyState, found := serializedState.DeltaCopies[name]
+		if !found {
+			return true
+		}
+
+		if s.DeltaCopies == nil {
+			s.DeltaCopies = make(map[string]map[string]TableProgress)
+		}
+		s.DeltaCopies[name] = f.tablesProgress(
+			deltaCopy.tables,
+			deltaCopyState.LastSuccessfulPaginationKeys,
+			deltaCopyState.CompletedTables,
+			deltaCopy.dataIterator.TargetPaginationKeys(),
+		)
 		return true
 	})
 
-	tables := f.Tables.AsSlice()
+	// ETA
+	var totalPaginationKeysToCopy uint64 = 0
+	var completedPaginationKeys uint64 = 0
+	estimatedPaginationKeysPerSecond := f.StateTracker.EstimatedPaginationKeysPerSecond()
+	for _, targetPaginationKey := range targetPaginationKeys {
+		if progress, ok := targetPaginationKey.ProgressData(); ok {
+			totalPaginationKeysToCopy += progress
+		}
+	}
+
+	for _, completedPaginationKey := range serializedState.LastSuccessfulPaginationKeys {
+		if progress, ok := completedPaginationKey.ProgressData(); ok {
+			completedPaginationKeys += progress
+		}
+	}
+
+	s.ETA = (time.Duration(math.Ceil(float64(totalPaginationKeysToCopy-completedPaginationKeys)/estimatedPaginationKeysPerSecond)) * time.Second).Seconds()
+	s.PaginationKeysPerSecond = uint64(estimatedPaginationKeysPerSecond)
+	s.TimeTaken = time.Now().Sub(f.StartTime).Seconds()
+
+	if f.OverallState == StateStarting || f.OverallState == StateCopying {
+		s.Sizing = f.sizingReport
+	}
+
+	return s
+}
+
+// QuarantinedTables returns the tables given up on due to the skip_table
+// action of Config.ErrorPolicy, with the errors that failed them
+func (f *Ferry) QuarantinedTables() map[string]error {
+	return f.quarantine.Tables()
+}
+
+// checkQuarantinedTablesBeforeCutover fails if tables are quarantined, as
+// they are incomplete on the target, unless
+// ErrorPolicyConfig.AllowCutoverWithQuarantinedTables is set
+func (f *Ferry) checkQuarantinedTablesBeforeCutover() error {
+	quarantined := f.QuarantinedTables()
+	if len(quarantined) == 0 {
+		return nil
+	}
+
+	tables := make([]string, 0, len(quarantined))
+	for table := range quarantined {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	if f.Config.ErrorPolicy.AllowCutoverWithQuarantinedTables {
+		f.logger.WithField("tables", tables).Warn("proceeding to the cutover with quarantined tables, which are incomplete on the target")
+		return nil
+	}
+	return fmt.Errorf("tables %s were quarantined and are incomplete on the target, set ErrorPolicy.AllowCutoverWithQuarantinedTables to cut over regardless", strings.Join(tables, ", "))
+}
+
+func (f *Ferry) tablesProgress(tables []*TableSchema, lastSuccessfulPaginationKeys map[string]*PaginationKeyData, completedTables map[string]bool, targetPaginationKeys map[string]*PaginationKeyData) map[string]TableProgress {
+	progress := make(map[string]TableProgress)
 
 	for _, table := range tables {
 		var currentAction string
 		tableName := table.String()
-		lastSuccessfulPaginationKey, foundInProgress := serializedState.LastSuccessfulPaginationKeys[tableName]
+		lastSuccessfulPaginationKey, foundInProgress := lastSuccessfulPaginationKeys[tableName]
 
-		if serializedState.CompletedTables[tableName] {
+		if completedTables[tableName] {
 			currentAction = TableActionCompleted
+		} else if f.quarantine.Contains(tableName) {
+			currentAction = TableActionQuarantined
 		} else if foundInProgress {
 			currentAction = TableActionCopying
 		} else {
@@ -818,34 +1800,68 @@ func (f *Ferry) Progress() *Progress {
 			targetPaginationValue = targetPaginationKeys[tableName].String()
 		}
 
-		s.Tables[tableName] = TableProgress{
+		progress[tableName] = TableProgress{
 			LastSuccessfulPaginationKey: lastPaginationValue,
 			TargetPaginationKey:         targetPaginationValue,
 			CurrentAction:               currentAction,
+			Completion:                  f.tableCompletion(currentAction, lastSuccessfulPaginationKey, targetPaginationKeys[tableName]),
 		}
 	}
 
-	// ETA
-	var totalPaginationKeysToCopy uint64 = 0
-	var completedPaginationKeys uint64 = 0
-	estimatedPaginationKeysPerSecond := f.StateTracker.EstimatedPaginationKeysPerSecond()
-	for _, targetPaginationKey := range targetPaginationKeys {
-		if progress, ok := targetPaginationKey.ProgressData(); ok {
-			totalPaginationKeysToCopy += progress
-		}
+	return progress
+}
+
+func (f *Ferry) tableCompletion(currentAction string, lastSuccessfulPaginationKey, targetPaginationKey *PaginationKeyData) float64 {
+	switch currentAction {
+	case TableActionCompleted:
+		return 1
+	case TableActionWaiting:
+		return 0
 	}
 
-	for _, completedPaginationKey := range serializedState.LastSuccessfulPaginationKeys {
-		if progress, ok := completedPaginationKey.ProgressData(); ok {
-			completedPaginationKeys += progress
-		}
+	// when iterating in descending order, the pagination keys do not tell us
+	// where the copy started
+	if f.Config.IterateInDescendingOrder || lastSuccessfulPaginationKey == nil || targetPaginationKey == nil {
+		return -1
 	}
 
-	s.ETA = (time.Duration(math.Ceil(float64(totalPaginationKeysToCopy-completedPaginationKeys)/estimatedPaginationKeysPerSecond)) * time.Second).Seconds()
-	s.PaginationKeysPerSecond = uint64(estimatedPaginationKeysPerSecond)
-	s.TimeTaken = time.Now().Sub(f.StartTime).Seconds()
+	last, ok := lastSuccessfulPaginationKey.ProgressData()
+	if !ok {
+		return -1
+	}
+	target, ok := targetPaginationKey.ProgressData()
+	if !ok || target == 0 {
+		return -1
+	}
 
-	return s
+	return math.Min(float64(last)/float64(target), 1)
+}
+
+// BenchmarkResult summarizes the read throughput achieved in BenchmarkMode
+// over the given duration of the data copy.
+func (f *Ferry) BenchmarkResult(copyDuration time.Duration) *BenchmarkResult {
+	result := &BenchmarkResult{
+		RowsRead:         f.BatchWriter.DiscardedRows(),
+		BinlogEventsRead: f.BinlogWriter.DiscardedEvents(),
+		CopyDuration:     copyDuration,
+	}
+
+	if seconds := copyDuration.Seconds(); seconds > 0 {
+		result.RowsPerSecond = float64(result.RowsRead) / seconds
+		result.BinlogEventsPerSecond = float64(result.BinlogEventsRead) / seconds
+	}
+
+	return result
+}
+
+func (f *Ferry) logBenchmarkResult(result *BenchmarkResult) {
+	f.logger.WithFields(logrus.Fields{
+		"rowsRead":              result.RowsRead,
+		"binlogEventsRead":      result.BinlogEventsRead,
+		"copyDuration":          result.CopyDuration,
+		"rowsPerSecond":         result.RowsPerSecond,
+		"binlogEventsPerSecond": result.BinlogEventsPerSecond,
+	}).Infof("benchmark complete: copying the data takes at least %s, as bound by the source read throughput", result.CopyDuration.Round(time.Second))
 }
 
 func (f *Ferry) ReportProgress() {
@@ -871,6 +1887,166 @@ func (f *Ferry) waitUntilAutomaticCutoverIsTrue() {
 	}
 }
 
+func (f *Ferry) newDDLRewriter() *DDLRewriter {
+	if f.Config.DDLRewrites == nil {
+		return nil
+	}
+	return NewDDLRewriter(*f.Config.DDLRewrites, f.Config.DatabaseRewrites)
+}
+
+// openComponentConnectionPools opens the dedicated connection pools of the
+// components with pool settings or credentials of their own.
+func (f *Ferry) openComponentConnectionPools() (err error) {
+	dataIteratorPool := f.Config.DataIteratorConnectionPool()
+	sourcePools := &f.Source.ComponentConnectionPools
+	targetPools := &f.Target.ComponentConnectionPools
+	targetCredentials := &f.Target.ComponentCredentials
+
+	// the chunks are read while the data iterator holds the connections
+	// reading their rows, so a shared pool with MaxOpenConns no larger than
+	// the DataIterationConcurrency would deadlock
+	var blobChunkerPool *ConnectionPoolConfig
+	if f.Config.BlobChunking.Enabled() {
+		blobChunkerPool = &ConnectionPoolConfig{}
+		if dataIteratorPool != nil {
+			*blobChunkerPool = *dataIteratorPool
+		}
+	}
+
+	pools := []struct {
+		db          **sql.DB
+		config      *DatabaseConfig
+		pool        *ConnectionPoolConfig
+		credentials *CredentialsConfig
+		name        string
+	}{
+		{&f.dataIteratorDB, f.Source, dataIteratorPool, nil, "data_iterator"},
+		{&f.blobChunkerDB, f.Source, blobChunkerPool, nil, "blob_chunker"},
+		{&f.batchWriterDB, f.Target, targetPools.BatchWriter, targetCredentials.BatchWriter, "batch_writer"},
+		{&f.binlogWriterDB, f.Target, targetPools.BinlogWriter, targetCredentials.BinlogWriter, "binlog_writer"},
+		{&f.stateTrackerDB, f.Target, nil, targetCredentials.StateTracker, "state_tracker"},
+		{&f.sourceVerifierDB, f.Source, sourcePools.Verifier, nil, "source_verifier"},
+		{&f.targetVerifierDB, f.Target, targetPools.Verifier, nil, "target_verifier"},
+	}
+
+	for _, pool := range pools {
+		if pool.pool == nil && pool.credentials == nil {
+			continue
+		}
+
+		// a component connecting as a user of its own gets a pool of its
+		// own, with the settings of the shared pool
+		if pool.pool == nil {
+			pool.pool = &ConnectionPoolConfig{}
+		}
+
+		config := pool.config.withCredentials(pool.credentials)
+		*pool.db, err = config.ComponentSqlDB(pool.pool, f.logger.WithField("component", pool.name))
+		if err != nil {
+			return fmt.Errorf("%s: %v", pool.name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkReadOnlySource verifies that all connections to the source are granted
+// only the privileges required to copy from it, see Config.ReadOnlySource
+func (f *Ferry) checkReadOnlySource() error {
+	type connection struct {
+		name string
+		db   *sql.DB
+	}
+	connections := []connection{
+		{"source", f.SourceDB},
+		{"data_iterator", f.dataIteratorDB},
+		{"blob_chunker", f.blobChunkerDB},
+		{"source_verifier", f.sourceVerifierDB},
+	}
+	if f.WaitUntilReplicaIsCaughtUpToMaster != nil {
+		connections = append(connections, connection{"source_master", f.WaitUntilReplicaIsCaughtUpToMaster.MasterDB})
+	}
+
+	required := sourceRequiredPrivileges(f.Config)
+	databases := copiedDatabases(f.Tables.AsSlice(), nil)
+	for _, connection := range connections {
+		if connection.db == nil {
+			continue
+		}
+		if err := CheckReadOnlyPrivileges(connection.db, required, databases); err != nil {
+			return fmt.Errorf("ReadOnlySource: the %s connection is not limited to %s: %v", connection.name, strings.Join(required, ", "), err)
+		}
+	}
+
+	f.logger.Infof("verified that the source connections are limited to %s", strings.Join(required, ", "))
+	return nil
+}
+
+// componentDB returns the dedicated connection pool of a component, if it has
+// one, or the shared one.
+func (f *Ferry) componentDB(db, shared *sql.DB) *sql.DB {
+	if db == nil {
+		return shared
+	}
+	return db
+}
+
+// keepTargetSessionsOpen keeps idle connections of the pools to the target
+// open, such that the sessions writing to the target are unlikely to be gone
+// by the time their writes are streamed and attributed to Ghostferry.
+func (f *Ferry) keepTargetSessionsOpen() {
+	for _, db := range []*sql.DB{f.TargetDB, f.batchWriterDB, f.binlogWriterDB, f.stateTrackerDB} {
+		if db != nil {
+			db.SetMaxIdleConns(f.Config.DataIterationConcurrency + 10)
+		}
+	}
+}
+
+// stateTablesDB returns the connection pool to the state tables on the
+// target, see ComponentCredentialsConfig.StateTracker.
+func (f *Ferry) stateTablesDB() *sql.DB {
+	return f.componentDB(f.stateTrackerDB, f.TargetDB)
+}
+
+// tables returns the Tables, to be used instead of reading them directly
+// while the binlog writer runs
+func (f *Ferry) tables() []*TableSchema {
+	f.tablesMutex.RLock()
+	defer f.tablesMutex.RUnlock()
+
+	return f.Tables.AsSlice()
+}
+
+// table returns the table of the Tables with the given qualified name, to be
+// used instead of reading them directly while the binlog writer runs
+func (f *Ferry) table(name string) *TableSchema {
+	f.tablesMutex.RLock()
+	defer f.tablesMutex.RUnlock()
+
+	return f.Tables[name]
+}
+
+// CloseTunnels closes the SSH tunnels and socket relays the connections to
+// the Source and the Target go through, before exiting
+func (f *Ferry) CloseTunnels() {
+	for name, config := range map[string]*DatabaseConfig{"source": f.Source, "target": f.Target} {
+		if config == nil {
+			continue
+		}
+		if err := config.CloseTunnel(); err != nil {
+			f.logger.WithError(err).Warnf("failed to close the tunnel to the %s", name)
+		}
+	}
+}
+
+// loggerFor returns the logger for the component with the given tag.
+func (f *Ferry) loggerFor(tag string) *logrus.Entry {
+	if f.Logger == nil {
+		return logrus.WithField("tag", tag)
+	}
+	return f.Logger.WithField("tag", tag)
+}
+
 func (f *Ferry) ensureInitialized() {
 	// TODO: refactor Ferry.Initialize to a constructor.
 	// Note: the constructor shouldn't have a large amount of positional argument
@@ -885,6 +2061,28 @@ func (f *Ferry) notifyRowCopyComplete() {
 	f.rowCopyCompleteCh <- struct{}{}
 }
 
+func (f *Ferry) checkSchemaDrift() {
+	drifts, err := DetectSchemaDrift(f.SourceDB, f.TargetDB, f.Tables.AsSlice(), f.Config.DatabaseRewrites, f.Config.TableRewrites)
+	if err != nil && f.Config.SchemaDriftAction == SchemaDriftActionFail {
+		f.ErrorHandler.Fatal("schema_drift", err)
+		return
+	} else if err != nil {
+		f.logger.WithError(err).Warn("failed to compare the schemas of source and target")
+		return
+	}
+
+	for _, drift := range drifts {
+		f.logger.WithFields(logrus.Fields{
+			"sourceTable": drift.SourceTable,
+			"targetTable": drift.TargetTable,
+		}).Warnf("schema differs between source and target: %s", strings.Join(drift.Differences, "; "))
+	}
+
+	if len(drifts) > 0 && f.Config.SchemaDriftAction == SchemaDriftActionFail {
+		f.ErrorHandler.Fatal("schema_drift", SchemaDriftError{Drifts: drifts})
+	}
+}
+
 func (f *Ferry) checkConnection(dbname string, db *sql.DB) error {
 	row := db.QueryRow("SHOW STATUS LIKE 'Ssl_cipher'")
 	var name, cipher string
@@ -923,8 +2121,8 @@ func (f *Ferry) checkConnectionForBinlogFormat(db *sql.DB) error {
 		if err != nil {
 			return err
 		}
-		if strings.ToUpper(value) != "FULL" {
-			return fmt.Errorf("binlog_row_image must be FULL, not %s", value)
+		if err = checkBinlogRowImage(value, f.Config.AllowMinimalBinlogRowImage); err != nil {
+			return err
 		}
 	}
 
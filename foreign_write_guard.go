@@ -0,0 +1,247 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ForeignWriteActionFail = "fail"
+	ForeignWriteActionWarn = "warn"
+)
+
+type ForeignWriteError struct {
+	Table    string
+	ThreadId uint32
+	Position BinlogPosition
+}
+
+func (e ForeignWriteError) Error() string {
+	return fmt.Sprintf("detected write to %s by session %d at target binlog position %s, which is not a Ghostferry session", e.Table, e.ThreadId, e.Position)
+}
+
+// ForeignWriteGuard streams the binlog of the target database and reports
+// writes to the copied tables that are performed by sessions other than
+// those of the Ghostferry target users.
+//
+// Each transaction in the binlog starts with a query event that carries the
+// ID of the session that performed it. The sessions of the Ghostferry user
+// are looked up periodically (and whenever an unknown session is found), as
+// sessions may be closed by the time their writes are streamed.
+type ForeignWriteGuard struct {
+	TargetDB       *sql.DB
+	TargetUsers    []string
+	BinlogStreamer *BinlogStreamer
+	ErrorHandler   ErrorHandler
+
+	// fully qualified names of the tables on the target
+	Tables map[string]bool
+
+	Action                 string
+	SessionRefreshInterval time.Duration
+
+	sessionsMutex      sync.Mutex
+	ghostferrySessions map[uint32]bool
+	currentThreadId    uint32
+	reportedMutex      sync.Mutex
+	reported           map[ForeignWriteError]bool
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+func (f *Ferry) NewForeignWriteGuard() *ForeignWriteGuard {
+	f.ensureInitialized()
+
+	tables := make(map[string]bool)
+	for _, table := range f.Tables.AsSlice() {
+		schemaName := table.Schema
+		if rewrite, exists := f.Config.DatabaseRewrites[schemaName]; exists {
+			schemaName = rewrite
+		}
+		tableName := table.Name
+		if rewrite, exists := f.Config.TableRewrites[tableName]; exists {
+			tableName = rewrite
+		}
+		tables[fmt.Sprintf("%s.%s", schemaName, tableName)] = true
+	}
+
+	guard := &ForeignWriteGuard{
+		TargetDB:    f.TargetDB,
+		TargetUsers: f.Config.Target.users(),
+		BinlogStreamer: &BinlogStreamer{
+			DB:           f.TargetDB,
+			DBConfig:     f.Target,
+			ErrorHandler: f.ErrorHandler,
+			ReadRetries:  f.DBReadRetries,
+			logger:       f.loggerFor("foreign_write_guard_binlog_streamer"),
+			metrics:      f.Metrics,
+
+			incrediblyVerboseLogging: f.IncrediblyVerboseLogging,
+		},
+		ErrorHandler:           f.ErrorHandler,
+		Tables:                 tables,
+		Action:                 f.Config.ForeignWriteGuard.Action,
+		SessionRefreshInterval: f.Config.ForeignWriteGuard.sessionRefreshInterval,
+
+		ghostferrySessions: make(map[uint32]bool),
+		reported:           make(map[ForeignWriteError]bool),
+		logger:             f.loggerFor("foreign_write_guard"),
+		metrics:            f.Metrics,
+	}
+	guard.BinlogStreamer.AddEventListener(guard.binlogEventListener)
+
+	return guard
+}
+
+// Connect starts streaming the target binlog from its current position. Any
+// write that happened before is not considered.
+func (g *ForeignWriteGuard) Connect() error {
+	if err := g.refreshGhostferrySessions(); err != nil {
+		return err
+	}
+
+	_, err := g.BinlogStreamer.ConnectBinlogStreamerToMysql()
+	return err
+}
+
+// Run streams the target binlog until Stop is called, and looks up the
+// sessions of the Ghostferry user until the context is cancelled.
+func (g *ForeignWriteGuard) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer RecoverPanic("foreign_write_guard", g.ErrorHandler)
+		g.BinlogStreamer.Run()
+	}()
+
+	ticker := time.NewTicker(g.SessionRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if err := g.refreshGhostferrySessions(); err != nil {
+				g.logger.WithError(err).Warn("failed to look up ghostferry sessions")
+			}
+		}
+	}
+}
+
+func (g *ForeignWriteGuard) Stop() {
+	g.BinlogStreamer.FlushAndStop()
+}
+
+// ForeignWrites returns the tables and sessions of the foreign writes
+// detected so far, once each. Foreign writes are only collected if the Action
+// is "warn", as they fail the run otherwise.
+func (g *ForeignWriteGuard) ForeignWrites() []ForeignWriteError {
+	g.reportedMutex.Lock()
+	defer g.reportedMutex.Unlock()
+
+	foreignWrites := make([]ForeignWriteError, 0, len(g.reported))
+	for foreignWrite := range g.reported {
+		foreignWrites = append(foreignWrites, foreignWrite)
+	}
+	sort.Slice(foreignWrites, func(i, j int) bool {
+		if foreignWrites[i].Table != foreignWrites[j].Table {
+			return foreignWrites[i].Table < foreignWrites[j].Table
+		}
+		return foreignWrites[i].ThreadId < foreignWrites[j].ThreadId
+	})
+	return foreignWrites
+}
+
+func (g *ForeignWriteGuard) refreshGhostferrySessions() error {
+	query, args, err := squirrel.
+		Select("ID").
+		From("information_schema.PROCESSLIST").
+		Where(squirrel.Eq{"USER": g.TargetUsers}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := g.TargetDB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	g.sessionsMutex.Lock()
+	defer g.sessionsMutex.Unlock()
+
+	for rows.Next() {
+		var id uint32
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		g.ghostferrySessions[id] = true
+	}
+
+	return rows.Err()
+}
+
+func (g *ForeignWriteGuard) isGhostferrySession(threadId uint32) bool {
+	g.sessionsMutex.Lock()
+	known := g.ghostferrySessions[threadId]
+	g.sessionsMutex.Unlock()
+
+	if known {
+		return true
+	}
+
+	if err := g.refreshGhostferrySessions(); err != nil {
+		g.logger.WithError(err).Warn("failed to look up ghostferry sessions")
+	}
+
+	g.sessionsMutex.Lock()
+	defer g.sessionsMutex.Unlock()
+	return g.ghostferrySessions[threadId]
+}
+
+func (g *ForeignWriteGuard) binlogEventListener(ev *ReplicationEvent) error {
+	switch event := ev.BinlogEvent.Event.(type) {
+	case *replication.QueryEvent:
+		g.currentThreadId = event.SlaveProxyID
+	case *replication.RowsEvent:
+		table := fmt.Sprintf("%s.%s", event.Table.Schema, event.Table.Table)
+		if !g.Tables[table] || g.isGhostferrySession(g.currentThreadId) {
+			return nil
+		}
+
+		foreignWrite := ForeignWriteError{
+			Table:    table,
+			ThreadId: g.currentThreadId,
+		}
+		if g.Action == ForeignWriteActionFail {
+			foreignWrite.Position = ev.BinlogPosition
+			return foreignWrite
+		}
+
+		// only warn once per table and session to avoid flooding the logs
+		g.reportedMutex.Lock()
+		reported := g.reported[foreignWrite]
+		g.reported[foreignWrite] = true
+		g.reportedMutex.Unlock()
+		if !reported {
+			foreignWrite.Position = ev.BinlogPosition
+			g.logger.WithError(foreignWrite).Warn("foreign write detected")
+		}
+		g.metrics.Count("ForeignWrite", 1, []MetricTag{{"table", table}}, 1.0)
+	}
+
+	return nil
+}
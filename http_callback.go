@@ -46,7 +46,8 @@ func postCallback(client *http.Client, uri string, body interface{}) error {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == 200 {
+	// e.g. the PagerDuty Events API responds with 202 Accepted
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
 		io.Copy(ioutil.Discard, res.Body)
 		return nil
 	}
@@ -0,0 +1,168 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyWhileIdle verifies the rows of the tables whose copy completed while
+// the binlog writer is caught up and the Throttler allows it, until all
+// tables are verified or the context is done, see
+// IterativeVerifierConfig.IdleVerification.
+//
+// The mismatched rows are reverified before the cutover, as are the rows
+// changed by the binlog events streamed since, so VerifyBeforeCutover skips
+// the tables verified completely.
+func (v *IterativeVerifier) VerifyWhileIdle(ctx context.Context) {
+	v.attachBinlogEventListener()
+	v.logger.Info("verifying the copied tables while the binlog writer is idle")
+
+	for {
+		pending := false
+		for _, table := range v.Tables {
+			if done, _ := v.idleVerificationState(table); done || v.tableIsIgnored(table) {
+				continue
+			}
+			pending = true
+
+			if v.StateTracker == nil || !v.StateTracker.IsTableComplete(table.String()) {
+				continue
+			}
+
+			err := v.verifyTableWhileIdle(ctx, table)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				// the table is verified before the cutover instead
+				v.logger.WithError(err).WithField("table", table.String()).Warn("failed to verify table while idle")
+				v.setIdleVerified(table, false)
+			}
+		}
+
+		if !pending {
+			v.logger.Info("verified all tables while the binlog writer was idle")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(v.IdleVerification.checkInterval):
+		}
+	}
+}
+
+// verifyTableWhileIdle verifies the rows of the table up to its current
+// maximum pagination key in batches, waiting for the binlog writer to be idle
+// before each batch. The rows written later are reverified anyway, as the
+// binlog event listener is attached already.
+func (v *IterativeVerifier) verifyTableWhileIdle(ctx context.Context, table *TableSchema) error {
+	maxPaginationKey, exists, err := targetPaginationKey(v.SourceDB, table, false)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		v.setIdleVerified(table, true)
+		return nil
+	}
+
+	logger := v.logger.WithField("table", table.String())
+	logger.Debug("verifying table while idle")
+
+	cursor := v.CursorConfig.NewPaginatedCursorWithoutRowLock(table, nil, maxPaginationKey, nil)
+	cursor.ColumnsToSelect = []string{fmt.Sprintf("`%s`", table.PaginationKey.Columns[0].Name)}
+	err = cursor.Each(func(rowBatch RowBatch) error {
+		batch, ok := rowBatch.(InsertRowBatch)
+		if !ok {
+			return nil
+		}
+
+		if err := v.waitUntilIdle(ctx); err != nil {
+			return err
+		}
+
+		paginationKeys := make([]uint64, 0, batch.Size())
+		for i := range batch.Values() {
+			paginationKey, err := batch.VerifierPaginationKey(i)
+			if err != nil {
+				return err
+			}
+			paginationKeys = append(paginationKeys, paginationKey)
+		}
+
+		v.metrics.Count("RowEvent", int64(len(paginationKeys)), []MetricTag{
+			{Name: "table", Value: table.Name},
+			{Name: "source", Value: "iterative_verifier_idle"},
+		}, 1.0)
+
+		mismatchedPaginationKeys, err := v.compareFingerprints(paginationKeys, table)
+		if err != nil {
+			return err
+		}
+
+		if len(mismatchedPaginationKeys) > 0 {
+			logger.WithField("mismatched_paginationKeys", mismatchedPaginationKeys).Info("found mismatched rows while idle, reverifying them before the cutover")
+			for _, paginationKey := range mismatchedPaginationKeys {
+				v.reverifyStore.Add(ReverifyEntry{PaginationKey: paginationKey, Table: table})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	v.setIdleVerified(table, true)
+	logger.Info("verified table while idle")
+	return nil
+}
+
+// waitUntilIdle waits until the apply lag of the binlog writer is at most
+// MaxLag and the Throttler does not throttle
+func (v *IterativeVerifier) waitUntilIdle(ctx context.Context) error {
+	for {
+		lagging := v.ApplyLag != nil && v.ApplyLag(time.Now()) > v.IdleVerification.maxLag
+		throttled := v.Throttler != nil && !v.Throttler.Disabled() && v.Throttler.Throttled()
+		if !lagging && !throttled {
+			return nil
+		}
+
+		if v.incrediblyVerboseLogging {
+			v.logger.WithFields(logrus.Fields{
+				"lagging":   lagging,
+				"throttled": throttled,
+			}).Debug("waiting for the binlog writer to be idle")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(v.IdleVerification.checkInterval):
+		}
+	}
+}
+
+// idleVerificationState returns whether VerifyWhileIdle is done with the
+// table, and whether it verified all rows of the table
+func (v *IterativeVerifier) idleVerificationState(table *TableSchema) (done, verified bool) {
+	v.idleVerifiedMutex.Lock()
+	defer v.idleVerifiedMutex.Unlock()
+	verified, done = v.idleVerifiedTables[table.String()]
+	return
+}
+
+// setIdleVerified records whether the table was verified by VerifyWhileIdle.
+// A table that failed to be verified is not tried again.
+func (v *IterativeVerifier) setIdleVerified(table *TableSchema, verified bool) {
+	v.idleVerifiedMutex.Lock()
+	defer v.idleVerifiedMutex.Unlock()
+
+	if v.idleVerifiedTables == nil {
+		v.idleVerifiedTables = make(map[string]bool)
+	}
+	v.idleVerifiedTables[table.String()] = verified
+}
@@ -224,12 +224,25 @@ type InlineVerifier struct {
 	StateTracker *StateTracker
 	ErrorHandler ErrorHandler
 
+	// The quarantined tables are not verified, see TableQuarantine
+	Quarantine *TableQuarantine
+
+	// The tables whose rows are not copied are not verified either, see
+	// Config.StreamOnlyTables
+	StreamOnlyTables map[string]bool
+
 	reverifyStore              *BinlogVerifyStore
 	verifyDuringCutoverStarted AtomicBoolean
 
 	sourceStmtCache *StmtCache
 	targetStmtCache *StmtCache
 	logger          *logrus.Entry
+
+	// guards the TableSchemaCache, which the BinlogWriter changes while it
+	// runs
+	tableSchemaMutex *sync.RWMutex
+
+	incrediblyVerboseLogging bool
 }
 
 func (v *InlineVerifier) StartInBackground() error {
@@ -425,10 +438,11 @@ func (v *InlineVerifier) getFingerprintDataFromDb(db *sql.DB, stmtCache *StmtCac
 		return nil, nil, err
 	}
 
-	fingerprintStmt, err := stmtCache.StmtFor(db, fingerprintQuery)
+	fingerprintStmt, release, err := stmtCache.StmtFor(db, fingerprintQuery)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer release()
 
 	if tx != nil {
 		fingerprintStmt = tx.Stmt(fingerprintStmt)
@@ -440,6 +454,10 @@ func (v *InlineVerifier) getFingerprintDataFromDb(db *sql.DB, stmtCache *StmtCac
 	}
 
 	rows, err := fingerprintStmt.Query(args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
@@ -580,9 +598,9 @@ func (v *InlineVerifier) binlogEventListener(event *ReplicationEvent) error {
 	// verification until the copy phase has completed, or the cached schema no
 	// longer applies
 	if ev, ok := event.BinlogEvent.Event.(*replication.RowsEvent); ok {
-		table := v.TableSchemaCache.Get(string(ev.Table.Schema), string(ev.Table.Table))
-		if table == nil || table.PaginationKey == nil {
-			if IncrediblyVerboseLogging {
+		table := v.TableSchemaCache.GetLocked(v.tableSchemaMutex, string(ev.Table.Schema), string(ev.Table.Table))
+		if table == nil || table.PaginationKey == nil || v.Quarantine.Contains(table.String()) || v.StreamOnlyTables[table.String()] {
+			if v.incrediblyVerboseLogging {
 				v.logger.Debugf("Ignoring binlog event for %s.%s", ev.Table.Schema, ev.Table.Table)
 			}
 			return nil
@@ -624,7 +642,7 @@ func (v *InlineVerifier) binlogEventListener(event *ReplicationEvent) error {
 func (v *InlineVerifier) readdMismatchedPaginationKeysToBeVerifiedAgain(mismatches map[string]map[string][]uint64) error {
 	for schemaName, _ := range mismatches {
 		for tableName, paginationKeys := range mismatches[schemaName] {
-			table := v.TableSchemaCache.Get(schemaName, tableName)
+			table := v.TableSchemaCache.GetLocked(v.tableSchemaMutex, schemaName, tableName)
 			if table == nil {
 				return fmt.Errorf("programming error? %s.%s is not found in TableSchemaCache but is being reverified", schemaName, tableName)
 			}
@@ -649,6 +667,12 @@ func (v *InlineVerifier) verifyAllEventsInStore() (bool, map[string]map[string][
 	v.logger.WithField("batches", len(allBatches)).Debug("verifyAllEventsInStore")
 
 	for _, batch := range allBatches {
+		// the events may have been added before the table was quarantined
+		if v.Quarantine.Contains(fmt.Sprintf("%s.%s", batch.SchemaName, batch.TableName)) {
+			v.reverifyStore.RemoveVerifiedBatch(batch)
+			continue
+		}
+
 		batchMismatches, err := v.verifyBinlogBatch(batch)
 		if err != nil {
 			return false, nil, err
@@ -688,7 +712,7 @@ func (v *InlineVerifier) verifyBinlogBatch(batch BinlogVerifyBatch) ([]uint64, e
 		targetTable = targetTableName
 	}
 
-	sourceTableSchema := v.TableSchemaCache.Get(batch.SchemaName, batch.TableName)
+	sourceTableSchema := v.TableSchemaCache.GetLocked(v.tableSchemaMutex, batch.SchemaName, batch.TableName)
 	if sourceTableSchema == nil {
 		return []uint64{}, fmt.Errorf("programming error? %s.%s is not found in TableSchemaCache but is being reverified", batch.SchemaName, batch.TableName)
 	}
@@ -701,6 +725,7 @@ func (v *InlineVerifier) verifyBinlogBatch(batch BinlogVerifyBatch) ([]uint64, e
 	var sourceErr error
 	go func() {
 		defer wg.Done()
+		defer RecoverPanic("inline_verifier", v.ErrorHandler)
 		sourceErr = WithRetries(5, 0, v.logger, "get fingerprints from source db", func() (err error) {
 			sourceFingerprints, sourceDecompressedData, err = v.getFingerprintDataFromSourceDb(
 				batch.SchemaName, batch.TableName,
@@ -717,6 +742,7 @@ func (v *InlineVerifier) verifyBinlogBatch(batch BinlogVerifyBatch) ([]uint64, e
 	var targetErr error
 	go func() {
 		defer wg.Done()
+		defer RecoverPanic("inline_verifier", v.ErrorHandler)
 		targetErr = WithRetries(5, 0, v.logger, "get fingerprints from target db", func() (err error) {
 			targetFingerprints, targetDecompressedData, err = v.getFingerprintDataFromTargetDb(
 				targetSchema, targetTable,
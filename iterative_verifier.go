@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -131,8 +132,32 @@ type IterativeVerifier struct {
 	Concurrency         int
 	MaxExpectedDowntime time.Duration
 
+	// The quarantined tables are not verified, see TableQuarantine
+	Quarantine *TableQuarantine
+
+	// The tables whose rows are not copied are not verified either, see
+	// Config.StreamOnlyTables
+	StreamOnlyTables map[string]bool
+
+	ErrorHandler ErrorHandler
+
+	// If set, the rows of the copied tables can be verified while the binlog
+	// writer is idle, see VerifyWhileIdle. The copied tables are looked up
+	// in the StateTracker, and the writer is idle while its ApplyLag is low
+	// and the Throttler does not throttle.
+	IdleVerification *IdleVerificationConfig
+	StateTracker     *StateTracker
+	Throttler        Throttler
+	ApplyLag         func(time.Time) time.Duration
+
 	reverifyStore *ReverifyStore
-	logger        *logrus.Entry
+	listenerOnce  sync.Once
+
+	idleVerifiedTables map[string]bool
+	idleVerifiedMutex  sync.Mutex
+
+	logger  *logrus.Entry
+	metrics *Metrics
 
 	beforeCutoverVerifyDone    bool
 	verifyDuringCutoverStarted AtomicBoolean
@@ -143,6 +168,12 @@ type IterativeVerifier struct {
 	backgroundVerificationWg    *sync.WaitGroup
 	backgroundStartTime         time.Time
 	backgroundDoneTime          time.Time
+
+	// guards the TableSchemaCache, which the BinlogWriter changes while it
+	// runs
+	tableSchemaMutex *sync.RWMutex
+
+	incrediblyVerboseLogging bool
 }
 
 func (v *IterativeVerifier) SanityCheckParameters() error {
@@ -170,7 +201,9 @@ func (v *IterativeVerifier) SanityCheckParameters() error {
 }
 
 func (v *IterativeVerifier) Initialize() error {
-	v.logger = logrus.WithField("tag", "iterative_verifier")
+	if v.logger == nil {
+		v.logger = logrus.WithField("tag", "iterative_verifier")
+	}
 
 	if err := v.SanityCheckParameters(); err != nil {
 		v.logger.WithError(err).Error("iterative verifier parameter sanity check failed")
@@ -184,7 +217,7 @@ func (v *IterativeVerifier) Initialize() error {
 func (v *IterativeVerifier) VerifyOnce() (VerificationResult, error) {
 	v.logger.Info("starting one-off verification of all tables")
 
-	err := v.iterateAllTables(func(paginationKey uint64, tableSchema *TableSchema) error {
+	err := v.iterateAllTables(false, func(paginationKey uint64, tableSchema *TableSchema) error {
 		return VerificationResult{
 			DataCorrect:     false,
 			Message:         fmt.Sprintf("verification failed on table: %s for paginationKey: %d", tableSchema.String(), paginationKey),
@@ -202,6 +235,147 @@ func (v *IterativeVerifier) VerifyOnce() (VerificationResult, error) {
 	}
 }
 
+// TableVerificationReport summarizes the verification of a table by
+// VerifyOnceWithReport.
+type TableVerificationReport struct {
+	Table string
+	// The rows of the table on the source and the target, as selected by the
+	// CopyFilter, that were verified
+	SourceRowsVerified uint64
+	TargetRowsVerified uint64
+	// The rows that differ, are missing on the target or only exist on the
+	// target, sorted
+	MismatchedPaginationKeys []uint64
+}
+
+func (r *TableVerificationReport) DataCorrect() bool {
+	return len(r.MismatchedPaginationKeys) == 0
+}
+
+// VerifyOnceWithReport verifies all tables once and reports the mismatches
+// of every table, instead of failing on the first mismatch like VerifyOnce.
+// Unlike VerifyOnce, the rows on the target are iterated as well, such that
+// rows that only exist on the target are found. If a CopyFilter is set,
+// only the rows it selects are compared on both sides.
+func (v *IterativeVerifier) VerifyOnceWithReport() (map[string]*TableVerificationReport, error) {
+	v.logger.Info("starting one-off verification of all tables with report")
+
+	reports := make(map[string]*TableVerificationReport)
+	reportsMutex := &sync.Mutex{}
+
+	pool := &WorkerPool{
+		Concurrency:  v.Concurrency,
+		ErrorHandler: v.ErrorHandler,
+		Process: func(tableIndex int) (interface{}, error) {
+			table := v.Tables[tableIndex]
+			if v.tableIsIgnored(table) {
+				return nil, nil
+			}
+
+			report, err := v.verifyTableWithReport(table)
+			if err != nil {
+				v.logger.WithError(err).WithField("table", table.String()).Error("error occured during table verification")
+				return nil, err
+			}
+
+			reportsMutex.Lock()
+			reports[table.String()] = report
+			reportsMutex.Unlock()
+			return nil, nil
+		},
+	}
+
+	_, err := pool.Run(len(v.Tables))
+	if err != nil {
+		return nil, err
+	}
+
+	v.logger.Info("one-off verification with report complete")
+	return reports, nil
+}
+
+func (v *IterativeVerifier) verifyTableWithReport(table *TableSchema) (*TableVerificationReport, error) {
+	report := &TableVerificationReport{Table: table.String()}
+	mismatches := make(map[uint64]struct{})
+
+	compareBatch := func(rowBatch RowBatch, rowsVerified *uint64) error {
+		batch, ok := rowBatch.(InsertRowBatch)
+		if !ok {
+			return nil
+		}
+
+		paginationKeys := make([]uint64, 0, batch.Size())
+		for i := range batch.Values() {
+			paginationKey, err := batch.VerifierPaginationKey(i)
+			if err != nil {
+				return err
+			}
+			paginationKeys = append(paginationKeys, paginationKey)
+		}
+		*rowsVerified += uint64(len(paginationKeys))
+
+		mismatchedPaginationKeys, err := v.compareFingerprints(paginationKeys, table)
+		if err != nil {
+			return err
+		}
+		for _, paginationKey := range mismatchedPaginationKeys {
+			mismatches[paginationKey] = struct{}{}
+		}
+		return nil
+	}
+
+	sourceCursor := v.CursorConfig.NewPaginatedCursorWithoutRowLock(table, nil, nil, nil)
+	sourceCursor.ColumnsToSelect = []string{fmt.Sprintf("`%s`", table.PaginationKey.Columns[0].Name)}
+	err := sourceCursor.Each(func(batch RowBatch) error {
+		return compareBatch(batch, &report.SourceRowsVerified)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targetCursorConfig := *v.CursorConfig
+	targetCursorConfig.DB = v.TargetDB
+	targetCursor := targetCursorConfig.NewPaginatedCursorWithoutRowLock(v.targetTable(table), nil, nil, nil)
+	targetCursor.ColumnsToSelect = sourceCursor.ColumnsToSelect
+	err = targetCursor.Each(func(batch RowBatch) error {
+		return compareBatch(batch, &report.TargetRowsVerified)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.MismatchedPaginationKeys = make([]uint64, 0, len(mismatches))
+	for paginationKey := range mismatches {
+		report.MismatchedPaginationKeys = append(report.MismatchedPaginationKeys, paginationKey)
+	}
+	sort.Slice(report.MismatchedPaginationKeys, func(i, j int) bool {
+		return report.MismatchedPaginationKeys[i] < report.MismatchedPaginationKeys[j]
+	})
+
+	if !report.DataCorrect() {
+		v.logger.WithFields(logrus.Fields{
+			"table":                     table.String(),
+			"mismatched_paginationKeys": report.MismatchedPaginationKeys,
+		}).Info("found mismatched rows")
+	}
+
+	return report, nil
+}
+
+// targetTable returns the table as it is named on the target
+func (v *IterativeVerifier) targetTable(table *TableSchema) *TableSchema {
+	targetTable := *table
+	targetTableSchema := *table.Table
+	if targetDbName, exists := v.DatabaseRewrites[targetTableSchema.Schema]; exists {
+		targetTableSchema.Schema = targetDbName
+	}
+	if targetTableName, exists := v.TableRewrites[targetTableSchema.Name]; exists {
+		targetTableSchema.Name = targetTableName
+	}
+	targetTable.Table = &targetTableSchema
+	return &targetTable
+}
+
 func (v *IterativeVerifier) VerifyBeforeCutover() error {
 	if v.TableSchemaCache == nil {
 		return fmt.Errorf("iterative verifier must be given the table schema cache before starting verify before cutover")
@@ -209,11 +383,10 @@ func (v *IterativeVerifier) VerifyBeforeCutover() error {
 
 	v.logger.Info("starting pre-cutover verification")
 
-	v.logger.Debug("attaching binlog event listener")
-	v.BinlogStreamer.AddEventListener(v.binlogEventListener)
+	v.attachBinlogEventListener()
 
 	v.logger.Debug("verifying all tables")
-	err := v.iterateAllTables(func(paginationKey uint64, tableSchema *TableSchema) error {
+	err := v.iterateAllTables(true, func(paginationKey uint64, tableSchema *TableSchema) error {
 		v.reverifyStore.Add(ReverifyEntry{PaginationKey: paginationKey, Table: tableSchema})
 		return nil
 	})
@@ -270,6 +443,7 @@ func (v *IterativeVerifier) StartInBackground() error {
 			v.backgroundDoneTime = time.Now()
 			v.backgroundVerificationWg.Done()
 		}()
+		defer RecoverPanic("iterative_verifier", v.ErrorHandler)
 
 		v.verificationResultAndStatus.VerificationResult, v.verificationErr = v.VerifyDuringCutover()
 		v.verificationResultAndStatus.DoneTime = time.Now()
@@ -363,9 +537,12 @@ func (v *IterativeVerifier) reverifyUntilStoreIsSmallEnough(maxIterations int) e
 	return nil
 }
 
-func (v *IterativeVerifier) iterateAllTables(mismatchedPaginationKeyFunc func(uint64, *TableSchema) error) error {
+// iterateAllTables verifies all rows of all tables, except for the tables
+// verified by VerifyWhileIdle if skipIdleVerified is set
+func (v *IterativeVerifier) iterateAllTables(skipIdleVerified bool, mismatchedPaginationKeyFunc func(uint64, *TableSchema) error) error {
 	pool := &WorkerPool{
-		Concurrency: v.Concurrency,
+		Concurrency:  v.Concurrency,
+		ErrorHandler: v.ErrorHandler,
 		Process: func(tableIndex int) (interface{}, error) {
 			table := v.Tables[tableIndex]
 
@@ -373,6 +550,11 @@ func (v *IterativeVerifier) iterateAllTables(mismatchedPaginationKeyFunc func(ui
 				return nil, nil
 			}
 
+			if _, verified := v.idleVerificationState(table); skipIdleVerified && verified {
+				v.logger.WithField("table", table.String()).Debug("table verified while idle already")
+				return nil, nil
+			}
+
 			err := v.iterateTableFingerprints(table, mismatchedPaginationKeyFunc)
 			if err != nil {
 				v.logger.WithError(err).WithField("table", table.String()).Error("error occured during table verification")
@@ -400,7 +582,7 @@ func (v *IterativeVerifier) iterateTableFingerprints(table *TableSchema, mismatc
 			return nil
 		}
 
-		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
+		v.metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
 			MetricTag{"table", table.Name},
 			MetricTag{"source", "iterative_verifier_before_cutover"},
 		}, 1.0)
@@ -451,17 +633,21 @@ func (v *IterativeVerifier) verifyStore(sourceTag string, additionalTags []Metri
 	erroredOrFailed := errors.New("verification of store errored or failed")
 
 	pool := &WorkerPool{
-		Concurrency: v.Concurrency,
+		Concurrency:  v.Concurrency,
+		ErrorHandler: v.ErrorHandler,
 		Process: func(reverifyBatchIndex int) (interface{}, error) {
 			reverifyBatch := allBatches[reverifyBatchIndex]
-			table := v.TableSchemaCache.Get(reverifyBatch.Table.SchemaName, reverifyBatch.Table.TableName)
+			table := v.TableSchemaCache.GetLocked(v.tableSchemaMutex, reverifyBatch.Table.SchemaName, reverifyBatch.Table.TableName)
+			if v.Quarantine.Contains(table.String()) {
+				return nil, nil
+			}
 
 			tags := append([]MetricTag{
 				MetricTag{"table", table.Name},
 				MetricTag{"source", sourceTag},
 			}, additionalTags...)
 
-			metrics.Count("RowEvent", int64(len(reverifyBatch.PaginationKeys)), tags, 1.0)
+			v.metrics.Count("RowEvent", int64(len(reverifyBatch.PaginationKeys)), tags, 1.0)
 
 			v.logger.WithFields(logrus.Fields{
 				"table":               table.String(),
@@ -541,6 +727,15 @@ func (v *IterativeVerifier) reverifyPaginationKeys(table *TableSchema, paginatio
 	}, mismatchedPaginationKeys, nil
 }
 
+// attachBinlogEventListener adds the rows changed by the streamed binlog
+// events to the rows to reverify from now on
+func (v *IterativeVerifier) attachBinlogEventListener() {
+	v.listenerOnce.Do(func() {
+		v.logger.Debug("attaching binlog event listener")
+		v.BinlogStreamer.AddEventListener(v.binlogEventListener)
+	})
+}
+
 func (v *IterativeVerifier) binlogEventListener(event *ReplicationEvent) error {
 	if v.verifyDuringCutoverStarted.Get() {
 		return fmt.Errorf("cutover has started but received binlog event!")
@@ -550,9 +745,9 @@ func (v *IterativeVerifier) binlogEventListener(event *ReplicationEvent) error {
 	// verification until the copy phase has completed, or the cached schema no
 	// longer applies
 	if ev, ok := event.BinlogEvent.Event.(*replication.RowsEvent); ok {
-		table := v.TableSchemaCache.Get(string(ev.Table.Schema), string(ev.Table.Table))
+		table := v.TableSchemaCache.GetLocked(v.tableSchemaMutex, string(ev.Table.Schema), string(ev.Table.Table))
 		if table == nil || v.tableIsIgnored(table) || table.PaginationKey == nil {
-			if IncrediblyVerboseLogging {
+			if v.incrediblyVerboseLogging {
 				v.logger.Debugf("Ignoring binlog event for %s.%s", ev.Table.Schema, ev.Table.Table)
 			}
 			return nil
@@ -592,6 +787,10 @@ func (v *IterativeVerifier) tableIsIgnored(table *TableSchema) bool {
 		return true
 	}
 
+	if v.Quarantine.Contains(table.String()) || v.StreamOnlyTables[table.String()] {
+		return true
+	}
+
 	for _, ignored := range v.IgnoredTables {
 		if table.Name == ignored {
 			return true
@@ -635,6 +834,7 @@ func (v *IterativeVerifier) compareFingerprints(paginationKeys []uint64, table *
 	var sourceErr error
 	go func() {
 		defer wg.Done()
+		defer RecoverPanic("iterative_verifier", v.ErrorHandler)
 		sourceErr = WithRetries(5, 0, v.logger, "get fingerprints from source db", func() (err error) {
 			sourceHashes, err = v.GetHashes(v.SourceDB, table.Schema, table.Name, table.PaginationKey.Columns[0].Name, v.columnsToVerify(table), paginationKeys)
 			return
@@ -645,6 +845,7 @@ func (v *IterativeVerifier) compareFingerprints(paginationKeys []uint64, table *
 	var targetErr error
 	go func() {
 		defer wg.Done()
+		defer RecoverPanic("iterative_verifier", v.ErrorHandler)
 		targetErr = WithRetries(5, 0, v.logger, "get fingerprints from target db", func() (err error) {
 			targetHashes, err = v.GetHashes(v.TargetDB, targetDb, targetTable, table.PaginationKey.Columns[0].Name, v.columnsToVerify(table), paginationKeys)
 			return
@@ -734,7 +935,10 @@ func rowMd5Selector(columns []schema.TableColumn, paginationKeyColumn string) sq
 func normalizeAndQuoteColumn(column schema.TableColumn) (quoted string) {
 	quoted = quoteField(column.Name)
 	if column.Type == schema.TYPE_FLOAT {
-		quoted = fmt.Sprintf("(if (%s = '-0', 0, %s))", quoted, quoted)
+		// MySQL formats FLOAT values with only 6 significant digits, which
+		// would hide differences in the less significant ones. Adding a
+		// DOUBLE converts the value exactly, and formats it with all digits.
+		quoted = fmt.Sprintf("(if (%s = '-0', 0, %s) + 0e0)", quoted, quoted)
 	}
 	return
 }
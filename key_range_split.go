@@ -0,0 +1,261 @@
+package ghostferry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyRange is a contiguous range of the pagination keys of a table, copied
+// by its own cursor, see KeyRangeSplitConfig. The ranges of a table are
+// ordered by their pagination keys, and each range starts after the End of
+// the previous one.
+type KeyRange struct {
+	// The last pagination key of the range
+	End *PaginationKeyData
+
+	// The pagination key up to which the rows of the range are copied. Starts
+	// at the pagination key after which the range starts, and is the End of
+	// the range once it is copied.
+	LastSuccessfulPaginationKey *PaginationKeyData
+}
+
+func (r *KeyRange) IsComplete() bool {
+	return r.LastSuccessfulPaginationKey.Compare(r.End) >= 0
+}
+
+// storedKeyRanges is stored as the last pagination key of a table split by
+// key range in the row copy state table
+type storedKeyRanges struct {
+	KeyRanges []*KeyRange
+}
+
+var errKeyRangeCopyAborted = errors.New("copy of the key range aborted, as the copy of another range of the table failed")
+
+// SplitKeyRange splits the pagination keys of the table after the pagination
+// key after up to and including last into the given number of contiguous
+// ranges of equal size. Only supports single-column numeric pagination keys.
+func SplitKeyRange(table *TableSchema, after, last int64, ranges int) []*KeyRange {
+	step := uint64(last-after) / uint64(ranges)
+
+	keyRanges := make([]*KeyRange, ranges)
+	start := after
+	for i := range keyRanges {
+		end := last
+		if i < ranges-1 {
+			end = start + int64(step)
+		}
+		keyRanges[i] = &KeyRange{
+			End:                         numericPaginationKeyData(table, end),
+			LastSuccessfulPaginationKey: numericPaginationKeyData(table, start),
+		}
+		start = end
+	}
+	return keyRanges
+}
+
+// splittableByKeyRange returns whether the table is paginated by a single
+// numeric column, which can be split into ranges
+func splittableByKeyRange(table *TableSchema) bool {
+	paginationKey := table.PaginationKey
+	return paginationKey != nil && len(paginationKey.Columns) == 1 && paginationKey.Columns[0].Type == schema.TYPE_NUMBER
+}
+
+func numericPaginationKeyData(table *TableSchema, value int64) *PaginationKeyData {
+	return &PaginationKeyData{
+		Values:        RowData{value},
+		paginationKey: table.PaginationKey,
+	}
+}
+
+func copyKeyRanges(keyRanges []*KeyRange) []*KeyRange {
+	copied := make([]*KeyRange, len(keyRanges))
+	for i, keyRange := range keyRanges {
+		keyRangeCopy := *keyRange
+		copied[i] = &keyRangeCopy
+	}
+	return copied
+}
+
+func unmarshalKeyRanges(keyRanges []*KeyRange, table *TableSchema) ([]*KeyRange, error) {
+	unmarshalled := make([]*KeyRange, len(keyRanges))
+	for i, keyRange := range keyRanges {
+		if keyRange.End == nil || keyRange.LastSuccessfulPaginationKey == nil {
+			return nil, fmt.Errorf("incomplete key range %d of table %s", i, table)
+		}
+
+		end, err := UnmarshalPaginationKeyData(keyRange.End, table)
+		if err != nil {
+			return nil, err
+		}
+		lastSuccessfulPaginationKey, err := UnmarshalPaginationKeyData(keyRange.LastSuccessfulPaginationKey, table)
+		if err != nil {
+			return nil, err
+		}
+		unmarshalled[i] = &KeyRange{End: end, LastSuccessfulPaginationKey: lastSuccessfulPaginationKey}
+	}
+	return unmarshalled, nil
+}
+
+// keyRangeContaining returns the range the pagination key is in. Keys after
+// the last range are attributed to the last range.
+func keyRangeContaining(keyRanges []*KeyRange, paginationKey *PaginationKeyData) *KeyRange {
+	for _, keyRange := range keyRanges {
+		if paginationKey.Compare(keyRange.End) <= 0 {
+			return keyRange
+		}
+	}
+	return keyRanges[len(keyRanges)-1]
+}
+
+// copiedUpTo returns the pagination key up to which all ranges are copied
+func copiedUpTo(keyRanges []*KeyRange) *PaginationKeyData {
+	for _, keyRange := range keyRanges {
+		if !keyRange.IsComplete() {
+			return keyRange.LastSuccessfulPaginationKey
+		}
+	}
+	return keyRanges[len(keyRanges)-1].End
+}
+
+// SetKeyRanges splits the copy of the table into the ranges, whose positions
+// are updated by UpdateLastSuccessfulPaginationKey from now on. The
+// LastSuccessfulPaginationKey of the table is the position up to which all
+// ranges are copied.
+func (s *StateTracker) SetKeyRanges(table string, keyRanges []*KeyRange) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithFields(logrus.Fields{"table": table, "ranges": len(keyRanges)}).Debug("splitting table copy into key ranges")
+	s.keyRanges[table] = copyKeyRanges(keyRanges)
+	s.lastSuccessfulPaginationKeys[table] = copiedUpTo(keyRanges)
+}
+
+// KeyRanges returns a copy of the ranges of the table, or nil if the copy of
+// the table is not split
+func (s *StateTracker) KeyRanges(table string) []*KeyRange {
+	s.CopyRWMutex.RLock()
+	defer s.CopyRWMutex.RUnlock()
+
+	keyRanges, split := s.keyRanges[table]
+	if !split {
+		return nil
+	}
+	return copyKeyRanges(keyRanges)
+}
+
+// MarkKeyRangeAsCompleted marks the range of the table as copied, which may
+// end before its End if there are no rows with higher pagination keys in the
+// range. The completion is stored along with the next position stored for
+// the table, a range whose completion was not stored yet is read again from
+// its position when resuming.
+func (s *StateTracker) MarkKeyRangeAsCompleted(table string, index int) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	keyRanges, split := s.keyRanges[table]
+	if !split || index >= len(keyRanges) {
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{"table": table, "key_range": index}).Debug("marking key range as completed")
+	keyRanges[index].LastSuccessfulPaginationKey = keyRanges[index].End
+	s.lastSuccessfulPaginationKeys[table] = copiedUpTo(keyRanges)
+}
+
+// keyRanges returns the ranges the copy of the table is split into, splitting
+// the pagination keys after the start up to the target if the table was not
+// split yet. Returns nil if the table is copied by a single cursor.
+func (d *DataIterator) keyRanges(table *TableSchema, start, target *PaginationKeyData) ([]*KeyRange, error) {
+	if keyRanges := d.StateTracker.KeyRanges(table.String()); keyRanges != nil {
+		return keyRanges, nil
+	}
+	if d.KeyRangeSplit == nil || !splittableByKeyRange(table) {
+		return nil, nil
+	}
+
+	var after int64
+	if start != nil {
+		after = start.Values[0].(int64)
+	} else {
+		// the first pagination key is the target of a copy in descending
+		// order
+		first, exists, err := targetPaginationKey(d.DB, table, true)
+		if err != nil || !exists {
+			return nil, err
+		}
+		if first.Values[0].(int64) == math.MinInt64 {
+			return nil, nil
+		}
+		after = first.Values[0].(int64) - 1
+	}
+
+	last := target.Values[0].(int64)
+	if last <= after || uint64(last-after) < d.KeyRangeSplit.MinKeySpan {
+		return nil, nil
+	}
+
+	keyRanges := SplitKeyRange(table, after, last, d.KeyRangeSplit.Ranges)
+	d.StateTracker.SetKeyRanges(table.String(), keyRanges)
+	return keyRanges, nil
+}
+
+// copyKeyRanges copies the ranges of the table that are not complete yet
+// concurrently, and marks the table as completed once all of them are. The
+// copy of all ranges is aborted if one of them fails.
+func (d *DataIterator) copyKeyRanges(table *TableSchema, keyRanges []*KeyRange, version TableCopyVersion, logger *logrus.Entry) error {
+	tableName := table.String()
+	logger.WithField("ranges", len(keyRanges)).Info("copying table in key ranges")
+
+	var aborted int32
+	errs := make(chan error, len(keyRanges))
+	wg := &sync.WaitGroup{}
+
+	for i, keyRange := range keyRanges {
+		if keyRange.IsComplete() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, keyRange *KeyRange) {
+			defer wg.Done()
+			defer RecoverPanic("data_iterator", d.ErrorHandler)
+
+			rangeLogger := logger.WithField("key_range", i)
+			rangeLogger.Debugf("starting to copy key range after %s up to %s", keyRange.LastSuccessfulPaginationKey, keyRange.End)
+
+			err := d.copyPaginationKeyRange(table, keyRange.LastSuccessfulPaginationKey, keyRange.End, true, rangeLogger, func(batch RowBatch) error {
+				if atomic.LoadInt32(&aborted) != 0 {
+					return errKeyRangeCopyAborted
+				}
+				// the table is complete once all ranges are
+				if _, ok := batch.(*FinalizeTableCopyBatch); ok {
+					d.StateTracker.MarkKeyRangeAsCompleted(tableName, i)
+					return nil
+				}
+				return d.writeBatch(batch, version)
+			})
+			if err != nil {
+				atomic.StoreInt32(&aborted, 1)
+				errs <- err
+			}
+		}(i, keyRange)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != errKeyRangeCopyAborted {
+			return err
+		}
+	}
+
+	logger.Debug("all key ranges copied")
+	return d.writeBatch(NewFinalizeTableCopyBatch(table), version)
+}
@@ -0,0 +1,148 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type LagLevel string
+
+const (
+	LagLevelOK       LagLevel = "ok"
+	LagLevelWarning  LagLevel = "warning"
+	LagLevelCritical LagLevel = "critical"
+)
+
+// LagMonitor periodically reports the apply lag of the binlog writer, and
+// alerts when it exceeds the thresholds of the LagAlertConfig.
+//
+// The lag is critical once it has been above the CriticalLag for the
+// CriticalLagDuration. Warnings and critical alerts are only reported when
+// the level changes, not on every check.
+type LagMonitor struct {
+	Config       *LagAlertConfig
+	Lag          func(now time.Time) time.Duration
+	ErrorHandler ErrorHandler
+
+	// Optional: notified when the lag becomes critical
+	Notify func(event, summary string, details map[string]string)
+
+	level          LagLevel
+	criticalSince  time.Time
+	callbackClient *http.Client
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+func (f *Ferry) NewLagMonitor() *LagMonitor {
+	f.ensureInitialized()
+
+	return &LagMonitor{
+		Config:       &f.Config.LagAlert,
+		Lag:          f.BinlogWriter.ApplyLag,
+		ErrorHandler: f.ErrorHandler,
+		Notify:       f.notify,
+		logger:       f.loggerFor("lag_monitor"),
+		metrics:      f.Metrics,
+	}
+}
+
+func (m *LagMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Config.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if m.Check(now) == LagLevelCritical && m.Config.ExitOnCritical {
+				m.ErrorHandler.Fatal("lag_monitor", fmt.Errorf("apply lag exceeded %v for %v", m.Config.criticalLag, m.Config.criticalLagDuration))
+				return
+			}
+		}
+	}
+}
+
+// Check reports the apply lag at the given time and returns its level
+func (m *LagMonitor) Check(now time.Time) LagLevel {
+	if m.logger == nil {
+		m.logger = logrus.WithField("tag", "lag_monitor")
+	}
+
+	lag := m.Lag(now)
+	m.metrics.Gauge("BinlogWriter.ApplyLag", lag.Seconds(), nil, 1.0)
+
+	level := LagLevelOK
+	if m.Config.criticalLag > 0 && lag > m.Config.criticalLag {
+		if m.criticalSince.IsZero() {
+			m.criticalSince = now
+		}
+		if now.Sub(m.criticalSince) >= m.Config.criticalLagDuration {
+			level = LagLevelCritical
+		} else if m.Config.warningLag > 0 && lag > m.Config.warningLag {
+			level = LagLevelWarning
+		}
+	} else {
+		m.criticalSince = time.Time{}
+		if m.Config.warningLag > 0 && lag > m.Config.warningLag {
+			level = LagLevelWarning
+		}
+	}
+
+	previous := m.level
+	if previous == "" {
+		previous = LagLevelOK
+	}
+	if level != previous {
+		m.levelChanged(level, lag)
+	}
+	m.level = level
+
+	return level
+}
+
+func (m *LagMonitor) levelChanged(level LagLevel, lag time.Duration) {
+	logger := m.logger.WithFields(logrus.Fields{
+		"lag":   lag,
+		"level": level,
+	})
+
+	switch level {
+	case LagLevelOK:
+		logger.Info("apply lag recovered")
+		return
+	case LagLevelWarning:
+		logger.Warn("apply lag exceeds warning threshold")
+	case LagLevelCritical:
+		logger.Error("apply lag exceeds critical threshold")
+	}
+
+	m.metrics.Count("LagAlert", 1, []MetricTag{{Name: "level", Value: string(level)}}, 1.0)
+
+	if level == LagLevelCritical && m.Notify != nil {
+		m.Notify(NotificationLagCritical, fmt.Sprintf("apply lag of %s exceeds the critical threshold of %s", lag.Round(time.Second), m.Config.criticalLag), map[string]string{
+			"lag_seconds": fmt.Sprintf("%.0f", lag.Seconds()),
+		})
+	}
+
+	if level == LagLevelCritical && m.Config.CriticalCallback.URI != "" {
+		if m.callbackClient == nil {
+			m.callbackClient = &http.Client{}
+		}
+
+		payload := map[string]interface{}{
+			"Payload":    m.Config.CriticalCallback.Payload,
+			"LagSeconds": lag.Seconds(),
+		}
+		err := postCallback(m.callbackClient, m.Config.CriticalCallback.URI, payload)
+		if err != nil {
+			logger.WithError(err).Error("failed to call critical lag callback")
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LoopPreventionUnknownSessionFail = "fail"
+	LoopPreventionUnknownSessionWarn = "warn"
+)
+
+// How long the sessions that ended are remembered, as their transactions may
+// be streamed well after they ended
+const endedSessionRetention = 10 * time.Minute
+
+// LoopPreventionFilter skips the binlog transactions of the source that
+// were performed by sessions of the IgnoredUsers, such that the writes of a
+// ferry replicating in the opposite direction are not replicated back.
+//
+// As for the ForeignWriteGuard, each transaction is attributed to a session
+// by the ID carried in the query event that starts it. The sessions of a
+// ferry running in the same process are recorded as it opens them, see
+// IgnoredSessions. The sessions of the IgnoredUsers are looked up
+// periodically (and whenever an unknown session is found), as sessions may
+// be closed by the time their writes are streamed. Unless the sessions are
+// recorded, a transaction of a session that ended before it was ever looked
+// up cannot be attributed, see LoopPreventionConfig.UnknownSessionAction.
+type LoopPreventionFilter struct {
+	DB                     *sql.DB
+	IgnoredUsers           []string
+	SessionRefreshInterval time.Duration
+	UnknownSessionAction   string
+	ErrorHandler           ErrorHandler
+
+	// The IDs of the sessions whose transactions are skipped regardless of
+	// their user, as recorded when they were opened by the ferry replicating
+	// in the opposite direction, see BidirectionalFerry
+	IgnoredSessions *sync.Map
+
+	sessionsMutex   sync.Mutex
+	sessions        map[uint32]*loopPreventionSession
+	currentThreadId uint32
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+type loopPreventionSession struct {
+	ignored bool
+	// whether the session ended before it was looked up
+	unknown bool
+	// when the session was first found to have ended, zero while it is
+	// running
+	endedAt time.Time
+}
+
+func (f *Ferry) NewLoopPreventionFilter() *LoopPreventionFilter {
+	f.ensureInitialized()
+
+	return &LoopPreventionFilter{
+		DB:                     f.SourceDB,
+		IgnoredUsers:           append([]string{f.Config.LoopPrevention.IgnoredUser}, f.Config.LoopPrevention.componentUsers...),
+		SessionRefreshInterval: f.Config.LoopPrevention.sessionRefreshInterval,
+		UnknownSessionAction:   f.Config.LoopPrevention.UnknownSessionAction,
+		ErrorHandler:           f.ErrorHandler,
+		IgnoredSessions:        f.Config.LoopPrevention.ignoredSessions,
+		sessions:               make(map[uint32]*loopPreventionSession),
+		logger:                 f.loggerFor("loop_prevention"),
+		metrics:                f.Metrics,
+	}
+}
+
+// Run looks up the sessions of the IgnoredUsers until the context is
+// cancelled
+func (l *LoopPreventionFilter) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.SessionRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.refreshSessions(); err != nil {
+				l.logger.WithError(err).Warn("failed to look up ignored sessions")
+			}
+		}
+	}
+}
+
+// SkipEvent returns whether the event belongs to a transaction of the
+// IgnoredUsers. It is meant to be used as the SkipEvent of a BinlogStreamer,
+// and must be called for every event in order.
+func (l *LoopPreventionFilter) SkipEvent(ev *ReplicationEvent) bool {
+	switch event := ev.BinlogEvent.Event.(type) {
+	case *replication.QueryEvent:
+		l.currentThreadId = event.SlaveProxyID
+		ignored, known := l.isIgnoredSession(l.currentThreadId)
+		if !known {
+			l.handleUnknownSession(ev)
+		}
+		return ignored
+	case *replication.RowsEvent:
+		if ignored, _ := l.isIgnoredSession(l.currentThreadId); !ignored {
+			return false
+		}
+
+		l.metrics.Count("LoopPrevention.SkippedRowsEvent", 1, []MetricTag{{"table", string(event.Table.Table)}}, 1.0)
+		return true
+	}
+
+	return false
+}
+
+func (l *LoopPreventionFilter) handleUnknownSession(ev *ReplicationEvent) {
+	l.metrics.Count("LoopPrevention.UnknownSession", 1, nil, 1.0)
+	err := fmt.Errorf("cannot tell whether the transaction at %v was performed by %s, as its session %d ended before it was looked up", ev.BinlogPosition, strings.Join(l.IgnoredUsers, " or "), l.currentThreadId)
+
+	if l.UnknownSessionAction == LoopPreventionUnknownSessionWarn {
+		l.logger.WithError(err).Warn("replicating transaction of unknown session")
+		return
+	}
+	l.ErrorHandler.Fatal("loop_prevention", err)
+}
+
+func (l *LoopPreventionFilter) refreshSessions() error {
+	rows, err := l.DB.Query("SELECT ID, USER FROM information_schema.PROCESSLIST")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	running := make(map[uint32]bool)
+	ignored := make(map[uint32]bool)
+	for rows.Next() {
+		var id uint32
+		var user string
+		if err = rows.Scan(&id, &user); err != nil {
+			return err
+		}
+		running[id] = true
+		for _, ignoredUser := range l.IgnoredUsers {
+			ignored[id] = ignored[id] || user == ignoredUser
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	l.sessionsMutex.Lock()
+	defer l.sessionsMutex.Unlock()
+
+	now := time.Now()
+	for id := range running {
+		l.sessions[id] = &loopPreventionSession{ignored: ignored[id]}
+	}
+	for id, session := range l.sessions {
+		if running[id] {
+			continue
+		}
+		if session.endedAt.IsZero() {
+			session.endedAt = now
+		} else if now.Sub(session.endedAt) > endedSessionRetention {
+			delete(l.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// isIgnoredSession returns whether the session is one of the IgnoredUsers,
+// and whether the session is known at all
+func (l *LoopPreventionFilter) isIgnoredSession(threadId uint32) (bool, bool) {
+	if l.IgnoredSessions != nil {
+		if _, ignored := l.IgnoredSessions.Load(threadId); ignored {
+			return true, true
+		}
+	}
+
+	l.sessionsMutex.Lock()
+	session, known := l.sessions[threadId]
+	l.sessionsMutex.Unlock()
+
+	if known {
+		return session.ignored, !session.unknown
+	}
+
+	if err := l.refreshSessions(); err != nil {
+		l.logger.WithError(err).Warn("failed to look up ignored sessions")
+	}
+
+	l.sessionsMutex.Lock()
+	defer l.sessionsMutex.Unlock()
+
+	if session, known = l.sessions[threadId]; known {
+		return session.ignored, !session.unknown
+	}
+
+	// remember sessions that have already disappeared, to not look them up
+	// again for every event of their transactions. If the sessions of the
+	// opposite ferry are recorded, the session was not one of them.
+	recorded := l.IgnoredSessions != nil
+	l.sessions[threadId] = &loopPreventionSession{unknown: !recorded, endedAt: time.Now()}
+	return false, recorded
+}
@@ -2,7 +2,9 @@ package ghostferry
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -31,7 +33,12 @@ type Metrics struct {
 	DefaultTags []MetricTag
 	Sink        chan interface{}
 
-	wg sync.WaitGroup
+	wg    sync.WaitGroup
+	phase atomic.Value
+
+	// the metrics emitting to the same Sink these were derived from, see
+	// WithOwnTags
+	parent *Metrics
 }
 
 func SetGlobalMetrics(prefix string, sink chan interface{}) *Metrics {
@@ -48,6 +55,7 @@ type CountMetric struct {
 }
 
 func (m *Metrics) Count(key string, value int64, tags []MetricTag, sampleRate float64) {
+	m = m.orGlobal()
 	m.sendMetric(CountMetric{
 		MetricBase: MetricBase{
 			Key:        m.applyPrefix(key),
@@ -64,6 +72,7 @@ type GaugeMetric struct {
 }
 
 func (m *Metrics) Gauge(key string, value float64, tags []MetricTag, sampleRate float64) {
+	m = m.orGlobal()
 	m.sendMetric(GaugeMetric{
 		MetricBase: MetricBase{
 			Key:        m.applyPrefix(key),
@@ -80,6 +89,7 @@ type TimerMetric struct {
 }
 
 func (m *Metrics) Timer(key string, duration time.Duration, tags []MetricTag, sampleRate float64) {
+	m = m.orGlobal()
 	m.sendMetric(TimerMetric{
 		MetricBase: MetricBase{
 			Key:        m.applyPrefix(key),
@@ -90,12 +100,39 @@ func (m *Metrics) Timer(key string, duration time.Duration, tags []MetricTag, sa
 	})
 }
 
+type HistogramMetric struct {
+	MetricBase
+	Value float64
+}
+
+func (m *Metrics) Histogram(key string, value float64, tags []MetricTag, sampleRate float64) {
+	m = m.orGlobal()
+	m.sendMetric(HistogramMetric{
+		MetricBase: MetricBase{
+			Key:        m.applyPrefix(key),
+			Tags:       m.mergeWithDefaultTags(tags),
+			SampleRate: sampleRate,
+		},
+		Value: value,
+	})
+}
+
 func (m *Metrics) Measure(key string, tags []MetricTag, sampleRate float64, f func()) {
+	m = m.orGlobal()
 	start := time.Now()
 	f()
 	m.Timer(key, time.Since(start), m.mergeWithDefaultTags(tags), sampleRate)
 }
 
+// orGlobal allows components to hold a nil *Metrics, in which case the
+// global metrics (see SetGlobalMetrics) are used.
+func (m *Metrics) orGlobal() *Metrics {
+	if m == nil {
+		return metrics
+	}
+	return m
+}
+
 func (m *Metrics) AddConsumer() {
 	m.wg.Add(1)
 }
@@ -105,10 +142,32 @@ func (m *Metrics) DoneConsumer() {
 }
 
 func (m *Metrics) StopAndFlush() {
+	if m.parent != nil {
+		m.parent.StopAndFlush()
+		return
+	}
+
 	close(m.Sink)
 	m.wg.Wait()
 }
 
+// WithOwnTags returns metrics emitting to the same Sink, whose DefaultTags
+// and phase are changed independently of these, such that the ferries of a
+// process sharing the metrics tag them with their own run id and phase
+func (m *Metrics) WithOwnTags() *Metrics {
+	m = m.orGlobal()
+	derived := &Metrics{
+		Prefix:      m.Prefix,
+		DefaultTags: append([]MetricTag(nil), m.DefaultTags...),
+		Sink:        m.Sink,
+		parent:      m,
+	}
+	if phase, ok := m.phase.Load().(string); ok {
+		derived.phase.Store(phase)
+	}
+	return derived
+}
+
 func (m *Metrics) sendMetric(metric interface{}) {
 	if m.Sink == nil {
 		return
@@ -123,6 +182,40 @@ func (m *Metrics) sendMetric(metric interface{}) {
 	}
 }
 
+// metricTagsFromMap converts tags as specified in the config into metric
+// tags, sorted by name so that they are emitted in a stable order.
+func metricTagsFromMap(tagMap map[string]string) []MetricTag {
+	tags := make([]MetricTag, 0, len(tagMap))
+	for name, value := range tagMap {
+		tags = append(tags, MetricTag{Name: name, Value: value})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags
+}
+
+// SetDefaultTag adds a tag to the DefaultTags, replacing the value of an
+// existing tag with the same name. It must not be called concurrently with
+// emitting metrics.
+func (m *Metrics) SetDefaultTag(name, value string) {
+	for i, tag := range m.DefaultTags {
+		if tag.Name == name {
+			m.DefaultTags[i].Value = value
+			return
+		}
+	}
+	m.DefaultTags = append(m.DefaultTags, MetricTag{Name: name, Value: value})
+}
+
+// SetPhase tags the metrics emitted from now on with the phase of the run,
+// i.e. the current state of the Ferry
+func (m *Metrics) SetPhase(phase string) {
+	m.phase.Store(phase)
+}
+
 func (m *Metrics) applyPrefix(key string) string {
 	return fmt.Sprintf("%s.%s", m.Prefix, key)
 }
@@ -148,5 +241,19 @@ func (m *Metrics) mergeWithDefaultTags(tags []MetricTag) []MetricTag {
 		}
 	}
 
+	if phase, ok := m.phase.Load().(string); ok && phase != "" {
+		exists := false
+		for _, existingTag := range mergedTags {
+			if existingTag.Name == "phase" {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			mergedTags = append(mergedTags, MetricTag{Name: "phase", Value: phase})
+		}
+	}
+
 	return mergedTags
 }
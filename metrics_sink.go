@@ -0,0 +1,358 @@
+package ghostferry
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/go-dogstatsd"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	MetricsSinkStatsD     = "statsd"
+	MetricsSinkPrometheus = "prometheus"
+	MetricsSinkLog        = "log"
+)
+
+// MetricsSink receives the metrics emitted through a Metrics created with
+// NewMetrics. Emit is only called from a single goroutine, with one of
+// CountMetric, GaugeMetric, TimerMetric or HistogramMetric. Close is called
+// once all metrics are emitted, after StopAndFlush.
+type MetricsSink interface {
+	Emit(metric interface{}) error
+	Close() error
+}
+
+// NewMetrics returns Metrics that emit to the given sink on a background
+// goroutine, which stops on StopAndFlush.
+func NewMetrics(prefix string, sink MetricsSink) *Metrics {
+	metricsChan := make(chan interface{}, 1024)
+	m := &Metrics{
+		Prefix: prefix,
+		Sink:   metricsChan,
+	}
+
+	m.AddConsumer()
+	go m.consume(sink, metricsChan)
+
+	return m
+}
+
+// SetGlobalMetricsSink replaces the global metrics, used by all components
+// that are not given Metrics, with ones emitting to the given sink. The
+// replaced global metrics are flushed if they had a sink, and must no longer
+// be used.
+func SetGlobalMetricsSink(prefix string, sink MetricsSink) *Metrics {
+	replaced := metrics
+	metrics = NewMetrics(prefix, sink)
+	if replaced.Sink != nil {
+		replaced.StopAndFlush()
+	}
+	return metrics
+}
+
+func (m *Metrics) consume(sink MetricsSink, metricsChan chan interface{}) {
+	defer m.DoneConsumer()
+
+	logger := logrus.WithField("tag", "metrics")
+	for metric := range metricsChan {
+		if err := sink.Emit(metric); err != nil {
+			logger.WithError(err).WithField("metric", metric).Warn("failed to emit metric")
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		logger.WithError(err).Warn("failed to close metrics sink")
+	}
+}
+
+// StatsDMetricsSink sends the metrics to a StatsD agent, using the DogStatsD
+// extension for the tags.
+type StatsDMetricsSink struct {
+	client *dogstatsd.Client
+}
+
+func NewStatsDMetricsSink(address string) (*StatsDMetricsSink, error) {
+	client, err := dogstatsd.New(address, &dogstatsd.Context{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsDMetricsSink{client: client}, nil
+}
+
+func (s *StatsDMetricsSink) Emit(metric interface{}) error {
+	switch metric := metric.(type) {
+	case CountMetric:
+		return s.client.Count(metric.Key, metric.Value, metricTagsToStrings(metric.Tags), metric.SampleRate)
+	case GaugeMetric:
+		return s.client.Gauge(metric.Key, metric.Value, metricTagsToStrings(metric.Tags), metric.SampleRate)
+	case TimerMetric:
+		return s.client.Timer(metric.Key, metric.Value, metricTagsToStrings(metric.Tags), metric.SampleRate)
+	case HistogramMetric:
+		return s.client.Histogram(metric.Key, metric.Value, metricTagsToStrings(metric.Tags), metric.SampleRate)
+	default:
+		return fmt.Errorf("unknown metric type %T", metric)
+	}
+}
+
+func (s *StatsDMetricsSink) Close() error {
+	return s.client.Close()
+}
+
+func metricTagsToStrings(tags []MetricTag) []string {
+	strs := make([]string, len(tags))
+	for i, tag := range tags {
+		if tag.Value != "" {
+			strs[i] = fmt.Sprintf("%s:%s", tag.Name, tag.Value)
+		} else {
+			strs[i] = tag.Name
+		}
+	}
+	return strs
+}
+
+// LogMetricsSink logs every metric as a structured log entry, e.g. to ship
+// them with the logs where no metrics backend is available.
+type LogMetricsSink struct {
+	Logger *logrus.Entry
+}
+
+func (s *LogMetricsSink) Emit(metric interface{}) error {
+	var base MetricBase
+	var value interface{}
+	var kind string
+
+	switch metric := metric.(type) {
+	case CountMetric:
+		base, value, kind = metric.MetricBase, metric.Value, "count"
+	case GaugeMetric:
+		base, value, kind = metric.MetricBase, metric.Value, "gauge"
+	case TimerMetric:
+		base, value, kind = metric.MetricBase, metric.Value.Seconds(), "timer"
+	case HistogramMetric:
+		base, value, kind = metric.MetricBase, metric.Value, "histogram"
+	default:
+		return fmt.Errorf("unknown metric type %T", metric)
+	}
+
+	logger := s.Logger
+	if logger == nil {
+		logger = logrus.WithField("tag", "metrics")
+	}
+
+	fields := logrus.Fields{
+		"metric": base.Key,
+		"type":   kind,
+		"value":  value,
+	}
+	for _, tag := range base.Tags {
+		fields["tag_"+tag.Name] = tag.Value
+	}
+
+	logger.WithFields(fields).Info("metric")
+	return nil
+}
+
+func (s *LogMetricsSink) Close() error {
+	return nil
+}
+
+var (
+	prometheusInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	prometheusHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// PrometheusMetricsSink aggregates the metrics in memory and serves them in
+// the Prometheus text exposition format (version 0.0.4), see ControlServer
+// for the /metrics endpoint. Counts are exposed as counters with the _total
+// suffix, gauges as gauges, and timers (in seconds) and histograms as
+// summaries without quantiles. The HELP of every metric is its original key.
+//
+// Metrics with a SampleRate below 1 are sampled at that rate as the StatsD
+// clients do, and the sampled ones are scaled by the inverse of the rate, such
+// that the totals are estimated as a StatsD server would.
+type PrometheusMetricsSink struct {
+	mutex    sync.Mutex
+	families map[string]*prometheusFamily
+}
+
+type prometheusFamily struct {
+	kind   string
+	help   string
+	series map[string]*prometheusSeries
+}
+
+type prometheusSeries struct {
+	value float64
+	count float64
+}
+
+func NewPrometheusMetricsSink() *PrometheusMetricsSink {
+	return &PrometheusMetricsSink{
+		families: make(map[string]*prometheusFamily),
+	}
+}
+
+func (s *PrometheusMetricsSink) Emit(metric interface{}) error {
+	switch metric := metric.(type) {
+	case CountMetric:
+		weight, sampled := sampleWeight(metric.SampleRate)
+		if !sampled {
+			return nil
+		}
+		return s.record(metric.Key, "_total", "counter", metric.Tags, func(series *prometheusSeries) {
+			series.value += float64(metric.Value) * weight
+		})
+	case GaugeMetric:
+		// the latest value of a gauge is not scaled
+		if _, sampled := sampleWeight(metric.SampleRate); !sampled {
+			return nil
+		}
+		return s.record(metric.Key, "", "gauge", metric.Tags, func(series *prometheusSeries) {
+			series.value = metric.Value
+		})
+	case TimerMetric:
+		weight, sampled := sampleWeight(metric.SampleRate)
+		if !sampled {
+			return nil
+		}
+		return s.record(metric.Key, "_seconds", "summary", metric.Tags, func(series *prometheusSeries) {
+			series.value += metric.Value.Seconds() * weight
+			series.count += weight
+		})
+	case HistogramMetric:
+		weight, sampled := sampleWeight(metric.SampleRate)
+		if !sampled {
+			return nil
+		}
+		return s.record(metric.Key, "", "summary", metric.Tags, func(series *prometheusSeries) {
+			series.value += metric.Value * weight
+			series.count += weight
+		})
+	default:
+		return fmt.Errorf("unknown metric type %T", metric)
+	}
+}
+
+func (s *PrometheusMetricsSink) record(key, suffix, kind string, tags []MetricTag, update func(*prometheusSeries)) error {
+	name := prometheusName(key, suffix)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	family, found := s.families[name]
+	if !found {
+		family = &prometheusFamily{kind: kind, help: key, series: make(map[string]*prometheusSeries)}
+		s.families[name] = family
+	} else if family.kind != kind {
+		return fmt.Errorf("metric %s is a %s, not a %s", name, family.kind, kind)
+	}
+
+	labels := prometheusLabels(tags)
+	series, found := family.series[labels]
+	if !found {
+		series = &prometheusSeries{}
+		family.series[labels] = series
+	}
+
+	update(series)
+	return nil
+}
+
+// sampleWeight samples a metric at its rate, returning whether it is sampled
+// and by how much to scale it. Rates of zero are unset, and are not sampled.
+func sampleWeight(sampleRate float64) (float64, bool) {
+	if sampleRate <= 0 || sampleRate >= 1 {
+		return 1, true
+	}
+	if rand.Float64() >= sampleRate {
+		return 0, false
+	}
+	return 1 / sampleRate, true
+}
+
+// prometheusName returns a valid metric or label name for the key, with the
+// given suffix unless the key already ends with it
+func prometheusName(key, suffix string) string {
+	name := prometheusInvalidChars.ReplaceAllString(key, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	if !strings.HasSuffix(name, suffix) {
+		name += suffix
+	}
+	return name
+}
+
+func prometheusLabels(tags []MetricTag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	labels := make([]string, len(tags))
+	for i, tag := range tags {
+		name := prometheusName(tag.Name, "")
+		// the names starting with __ are reserved for Prometheus
+		if strings.HasPrefix(name, "__") {
+			name = "tag" + name
+		}
+		labels[i] = fmt.Sprintf(`%s="%s"`, name, prometheusLabelEscaper.Replace(tag.Value))
+	}
+	sort.Strings(labels)
+
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// ServeHTTP writes all metrics recorded so far in the Prometheus text format
+func (s *PrometheusMetricsSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	names := make([]string, 0, len(s.families))
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := s.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, prometheusHelpEscaper.Replace(family.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, family.kind)
+
+		labels := make([]string, 0, len(family.series))
+		for label := range family.series {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		for _, label := range labels {
+			series := family.series[label]
+			if family.kind == "summary" {
+				fmt.Fprintf(w, "%s_sum%s %s\n", name, label, prometheusValue(series.value))
+				fmt.Fprintf(w, "%s_count%s %s\n", name, label, prometheusValue(series.count))
+			} else {
+				fmt.Fprintf(w, "%s%s %s\n", name, label, prometheusValue(series.value))
+			}
+		}
+	}
+}
+
+// prometheusValue formats the value as Prometheus parses it, which includes
+// the special values +Inf, -Inf and NaN
+func prometheusValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (s *PrometheusMetricsSink) Close() error {
+	return nil
+}
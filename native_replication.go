@@ -0,0 +1,162 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// NativeReplicationHandoff configures the target as a replica of the source
+// using native MySQL replication, continuing from the last source position
+// applied by Ghostferry. Ghostferry is used for the bulk copy, while the
+// long tail of replication gets the semantics of native replication.
+//
+// The replication uses binlog coordinates rather than GTID auto-positioning,
+// as the target has executed the copied data under its own GTIDs. To only
+// replicate what Ghostferry copied, the replication is restricted to the
+// copied tables, and the DatabaseRewrites are applied, with replication
+// filters. Setting filters for a channel requires MySQL 8.0.22 or later.
+type NativeReplicationHandoff struct {
+	Config   *NativeReplicationHandoffConfig
+	SourceDB *sql.DB
+	TargetDB *sql.DB
+
+	// whether the target must connect to the source with TLS
+	SourceSSL bool
+
+	DatabaseRewrites map[string]string
+	Tables           TableSchemaCache
+
+	logger *logrus.Entry
+}
+
+func (f *Ferry) NewNativeReplicationHandoff() *NativeReplicationHandoff {
+	f.ensureInitialized()
+
+	return &NativeReplicationHandoff{
+		Config:           &f.Config.NativeReplicationHandoff,
+		SourceDB:         f.SourceDB,
+		TargetDB:         f.TargetDB,
+		SourceSSL:        f.Config.Source.TLS != nil || f.Config.Source.IsRDS(),
+		DatabaseRewrites: f.Config.DatabaseRewrites,
+		Tables:           f.Tables,
+		logger:           f.loggerFor("native_replication"),
+	}
+}
+
+// HandoffToNativeReplication starts the native replication of the target
+// from the last source position streamed by Ghostferry. It must only be
+// called after FlushBinlogAndStopStreaming, once Run has returned, such that
+// all streamed events have been applied to the target.
+func (f *Ferry) HandoffToNativeReplication() error {
+	pos := f.BinlogStreamer.GetLastStreamedBinlogPosition()
+	return f.NewNativeReplicationHandoff().Run(pos)
+}
+
+// Run configures and (unless SkipStart is set) starts the replication of
+// the target from the given source position.
+func (h *NativeReplicationHandoff) Run(pos mysql.Position) error {
+	if h.logger == nil {
+		h.logger = logrus.WithField("tag", "native_replication")
+	}
+
+	var sourceServerId, targetServerId uint32
+	if err := h.SourceDB.QueryRow("SELECT @@server_id").Scan(&sourceServerId); err != nil {
+		return fmt.Errorf("reading source server_id: %v", err)
+	}
+	if err := h.TargetDB.QueryRow("SELECT @@server_id").Scan(&targetServerId); err != nil {
+		return fmt.Errorf("reading target server_id: %v", err)
+	}
+	if sourceServerId == targetServerId {
+		return fmt.Errorf("the source and the target have the same server_id (%d), which prevents the target from replicating the source", sourceServerId)
+	}
+
+	h.logger.WithField("position", pos).Info("handing off replication to the target")
+
+	for _, statement := range h.Statements(pos) {
+		if _, err := h.TargetDB.Exec(statement); err != nil {
+			// the statements contain the replication password
+			return fmt.Errorf("configuring replication of the target failed: %v", err)
+		}
+	}
+
+	if h.Config.SkipStart {
+		h.logger.Info("replication of the target configured but not started")
+	} else {
+		h.logger.Info("replication of the target started")
+	}
+	return nil
+}
+
+// Statements returns the statements configuring the replication of the
+// target from the given source position
+func (h *NativeReplicationHandoff) Statements(pos mysql.Position) []string {
+	forChannel := ""
+	if h.Config.Channel != "" {
+		forChannel = " FOR CHANNEL " + quoteString(h.Config.Channel)
+	}
+
+	options := []string{
+		"MASTER_HOST = " + quoteString(h.Config.SourceHost),
+		fmt.Sprintf("MASTER_PORT = %d", h.Config.SourcePort),
+		"MASTER_USER = " + quoteString(h.Config.User),
+		"MASTER_PASSWORD = " + quoteString(h.Config.Password),
+		"MASTER_LOG_FILE = " + quoteString(pos.Name),
+		fmt.Sprintf("MASTER_LOG_POS = %d", pos.Pos),
+		"MASTER_AUTO_POSITION = 0",
+	}
+	if h.SourceSSL {
+		options = append(options, "MASTER_SSL = 1")
+	}
+
+	statements := []string{
+		"CHANGE MASTER TO " + strings.Join(options, ", ") + forChannel,
+	}
+
+	filters := make([]string, 0, 2)
+	if len(h.DatabaseRewrites) > 0 {
+		databases := make([]string, 0, len(h.DatabaseRewrites))
+		for database := range h.DatabaseRewrites {
+			databases = append(databases, database)
+		}
+		sort.Strings(databases)
+
+		rewrites := make([]string, 0, len(databases))
+		for _, database := range databases {
+			rewrites = append(rewrites, fmt.Sprintf("(%s, %s)", quoteField(database), quoteField(h.DatabaseRewrites[database])))
+		}
+		filters = append(filters, "REPLICATE_REWRITE_DB = ("+strings.Join(rewrites, ", ")+")")
+	}
+
+	if len(h.Tables) > 0 {
+		// the table filters apply to the database names after rewriting
+		tables := make([]string, 0, len(h.Tables))
+		for _, table := range h.Tables {
+			database := table.Schema
+			if rewrite, exists := h.DatabaseRewrites[database]; exists {
+				database = rewrite
+			}
+			tables = append(tables, QuotedTableNameFromString(database, table.Name))
+		}
+		sort.Strings(tables)
+		filters = append(filters, "REPLICATE_DO_TABLE = ("+strings.Join(tables, ", ")+")")
+	}
+
+	if len(filters) > 0 {
+		statements = append(statements, "CHANGE REPLICATION FILTER "+strings.Join(filters, ", ")+forChannel)
+	}
+
+	if !h.Config.SkipStart {
+		statements = append(statements, "START SLAVE"+forChannel)
+	}
+
+	return statements
+}
+
+func quoteString(value string) string {
+	return string(appendEscapedString(nil, value, 0))
+}
@@ -0,0 +1,207 @@
+package ghostferry
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The lifecycle events of a run that are notified, see Config.Notifications
+const (
+	NotificationRunStarted            = "run_started"
+	NotificationRowCopyCompleted      = "row_copy_completed"
+	NotificationLagCritical           = "lag_critical"
+	NotificationBinlogRetentionAtRisk = "binlog_retention_at_risk"
+	NotificationFatalError            = "fatal_error"
+	NotificationCutoverCompleted      = "cutover_completed"
+)
+
+var notificationEvents = []string{
+	NotificationRunStarted,
+	NotificationRowCopyCompleted,
+	NotificationLagCritical,
+	NotificationBinlogRetentionAtRisk,
+	NotificationFatalError,
+	NotificationCutoverCompleted,
+}
+
+// the maximum length of the summary accepted by PagerDuty, also keeping the
+// Slack messages short
+const maxNotificationSummaryLength = 1024
+
+type Notification struct {
+	Event   string
+	Summary string
+	Time    time.Time
+
+	// A few facts about the run, such as the run id and the databases
+	Details map[string]string
+}
+
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// SlackNotifier posts the notifications to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (n *SlackNotifier) Notify(notification Notification) error {
+	lines := []string{fmt.Sprintf("*ghostferry %s*: %s", notification.Event, notification.Summary)}
+
+	keys := make([]string, 0, len(notification.Details))
+	for key := range notification.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s: `%s`", key, notification.Details[key]))
+	}
+
+	return postCallback(n.Client, n.WebhookURL, map[string]interface{}{
+		"text": strings.Join(lines, "\n"),
+	})
+}
+
+// PagerDutyNotifier triggers PagerDuty alerts through the Events API v2. The
+// alerts of the same event of a run are deduplicated.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	EventsURL  string
+	Client     *http.Client
+}
+
+func (n *PagerDutyNotifier) Notify(notification Notification) error {
+	severity := "info"
+	if notification.Event == NotificationFatalError || notification.Event == NotificationLagCritical || notification.Event == NotificationBinlogRetentionAtRisk {
+		severity = "critical"
+	}
+
+	source := notification.Details["target"]
+	if source == "" {
+		source = "ghostferry"
+	}
+
+	return postCallback(n.Client, n.EventsURL, map[string]interface{}{
+		"routing_key":  n.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    fmt.Sprintf("ghostferry/%s/%s/%s", notification.Details["run_id"], source, notification.Event),
+		"payload": map[string]interface{}{
+			"summary":        notification.Summary,
+			"source":         source,
+			"severity":       severity,
+			"timestamp":      notification.Time.Format(time.RFC3339),
+			"component":      "ghostferry",
+			"class":          notification.Event,
+			"custom_details": notification.Details,
+		},
+	})
+}
+
+type eventNotifier struct {
+	Notifier
+	name   string
+	events map[string]bool
+}
+
+// Notifications sends the lifecycle events of a run to the notifiers
+// subscribed to them. Failing to notify must not stop the run, so errors are
+// only logged.
+type Notifications struct {
+	notifiers []eventNotifier
+	logger    *logrus.Entry
+}
+
+func (f *Ferry) NewNotifications() *Notifications {
+	config := f.Config.Notifications
+	client := &http.Client{Timeout: config.timeout}
+
+	n := &Notifications{logger: f.loggerFor("notifications")}
+	if config.Slack.WebhookURL != "" {
+		n.Add("slack", &SlackNotifier{WebhookURL: config.Slack.WebhookURL, Client: client}, config.Slack.Events)
+	}
+	if config.PagerDuty.RoutingKey != "" {
+		n.Add("pagerduty", &PagerDutyNotifier{RoutingKey: config.PagerDuty.RoutingKey, EventsURL: config.PagerDuty.EventsURL, Client: client}, config.PagerDuty.Events)
+	}
+
+	return n
+}
+
+// Add subscribes the notifier to the given events
+func (n *Notifications) Add(name string, notifier Notifier, events []string) {
+	subscribed := make(map[string]bool)
+	for _, event := range events {
+		subscribed[event] = true
+	}
+
+	n.notifiers = append(n.notifiers, eventNotifier{Notifier: notifier, name: name, events: subscribed})
+}
+
+// Send notifies the subscribed notifiers of the event, in order and waiting
+// for each of them such that a fatal error is notified before the process
+// exits
+func (n *Notifications) Send(notification Notification) {
+	if n == nil {
+		return
+	}
+	if n.logger == nil {
+		n.logger = logrus.WithField("tag", "notifications")
+	}
+
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	if len(notification.Summary) > maxNotificationSummaryLength {
+		notification.Summary = notification.Summary[:maxNotificationSummaryLength-3] + "..."
+	}
+
+	for _, notifier := range n.notifiers {
+		if !notifier.events[notification.Event] {
+			continue
+		}
+
+		err := notifier.Notify(notification)
+		if err != nil {
+			n.logger.WithError(err).WithFields(logrus.Fields{
+				"notifier": notifier.name,
+				"event":    notification.Event,
+			}).Error("failed to send notification")
+		}
+	}
+}
+
+// notify sends the event with the summary and the details common to all
+// notifications of the run
+func (f *Ferry) notify(event, summary string, details map[string]string) {
+	if f.notifications == nil {
+		return
+	}
+
+	merged := map[string]string{
+		"source": f.Source.Address(),
+		"target": f.Target.Address(),
+		"state":  f.OverallState,
+	}
+	if f.Config.RunId != "" {
+		merged["run_id"] = f.Config.RunId
+	}
+	if !f.StartTime.IsZero() {
+		merged["elapsed"] = time.Since(f.StartTime).Round(time.Second).String()
+	}
+	for key, value := range details {
+		merged[key] = value
+	}
+
+	f.notifications.Send(Notification{
+		Event:   event,
+		Summary: summary,
+		Details: merged,
+	})
+}
@@ -0,0 +1,214 @@
+package ghostferry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	OnlineSchemaChangeToolGhost = "gh-ost"
+	OnlineSchemaChangeToolPtOsc = "pt-online-schema-change"
+
+	// A helper table was created for a table - the tool started copying it
+	OnlineSchemaChangeStarted = "started"
+	// The helper table was altered - this is the migration run by the tool
+	OnlineSchemaChangeAltered = "altered"
+	// The helper table atomically replaced the original table
+	OnlineSchemaChangeCutOver = "cut-over"
+
+	// Handle the statements of an online schema change like any other schema
+	// change, without detecting the migration
+	OnlineSchemaChangePolicyIgnore = "ignore"
+	// Fail as soon as an online schema change of a copied table is detected
+	OnlineSchemaChangePolicyAbort = "abort"
+	// Pause replication at the cut-over, until the migration was applied on
+	// the target manually and replication is resumed (e.g. via the control
+	// server)
+	OnlineSchemaChangePolicyPause = "pause"
+	// Apply the migrations run on the helper table to the original table on
+	// the target at the cut-over, and reload its schema
+	OnlineSchemaChangePolicyFollow = "follow"
+)
+
+var (
+	// the tables gh-ost creates next to the migrated table <t>: the ghost
+	// table _<t>_gho, the changelog table _<t>_ghc and the old table
+	// _<t>_del, or _<t>_<YYYYMMDDhhmmss>_del with --timestamp-old-table
+	ghostHelperTableRegexp = regexp.MustCompile(`^_(.+?)_(gho|ghc|(?:\d{14}_)?del)$`)
+
+	// the tables pt-online-schema-change creates next to the migrated table
+	// <t>: the new table _<t>_new and the old table _<t>_old, prefixed with
+	// more underscores if the name is taken
+	ptOscHelperTableRegexp = regexp.MustCompile(`^_(.+)_(new|old)$`)
+
+	// matches the table of an ALTER TABLE statement, including the comments
+	// gh-ost adds to its statements, e.g.
+	//
+	//    alter /* gh-ost */ table `db`.`_t_gho` add column ...
+	identifierPattern      = "(?:`(?:[^`]|``)+`|[\\w$]+)"
+	alterTableClauseRegexp = regexp.MustCompile(`(?is)^\s*ALTER\s+(?:/\*.*?\*/\s*)*(?:IGNORE\s+)?TABLE\s+(?:/\*.*?\*/\s*)*` + identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?\s+(.+)$`)
+)
+
+// OnlineSchemaChange is a step of a schema migration performed by an online
+// schema change tool (gh-ost or pt-online-schema-change) on the source. These
+// tools copy a table into a helper table with the new schema and replace the
+// original table by atomically renaming the tables.
+type OnlineSchemaChange struct {
+	Tool        string
+	Phase       string
+	Table       QualifiedTableName
+	HelperTable QualifiedTableName
+	// the part of an ALTER TABLE statement of the helper table following the
+	// table name, only set for OnlineSchemaChangeAltered
+	AlterClause string
+}
+
+// onlineSchemaChangeOf returns the tool and the original table of an online
+// schema change helper table, or an empty tool if the table is no such helper
+func onlineSchemaChangeOf(helperTable QualifiedTableName) (string, QualifiedTableName) {
+	if match := ghostHelperTableRegexp.FindStringSubmatch(helperTable.TableName); match != nil && match[2] == "gho" {
+		return OnlineSchemaChangeToolGhost, NewQualifiedTableName(helperTable.SchemaName, match[1])
+	}
+	if match := ptOscHelperTableRegexp.FindStringSubmatch(helperTable.TableName); match != nil && match[2] == "new" {
+		return OnlineSchemaChangeToolPtOsc, NewQualifiedTableName(helperTable.SchemaName, match[1])
+	}
+	return "", QualifiedTableName{}
+}
+
+// ParseOnlineSchemaChange detects statements of online schema change tools.
+// Returns nil for any other statement.
+func (q *QueryAnalyzer) ParseOnlineSchemaChange(sqlStatement string, schemaOfStatement string) (*OnlineSchemaChange, error) {
+	// avoid parsing statements twice if they cannot refer to a helper table
+	lowerStatement := strings.ToLower(sqlStatement)
+	if !strings.Contains(lowerStatement, "_gho") && !strings.Contains(lowerStatement, "_new") {
+		return nil, nil
+	}
+
+	schemaEvents, err := q.parseSchemaEvents(sqlStatement, schemaOfStatement)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schemaEvent := range schemaEvents {
+		switch {
+		case schemaEvent.DeletedTable != nil && schemaEvent.CreatedTable != nil:
+			// the cut-over renames the helper table to the original table
+			tool, table := onlineSchemaChangeOf(*schemaEvent.DeletedTable)
+			if tool != "" && table == *schemaEvent.CreatedTable {
+				return &OnlineSchemaChange{
+					Tool:        tool,
+					Phase:       OnlineSchemaChangeCutOver,
+					Table:       table,
+					HelperTable: *schemaEvent.DeletedTable,
+				}, nil
+			}
+		case schemaEvent.CreatedTable != nil:
+			if tool, table := onlineSchemaChangeOf(*schemaEvent.CreatedTable); tool != "" {
+				return &OnlineSchemaChange{
+					Tool:        tool,
+					Phase:       OnlineSchemaChangeStarted,
+					Table:       table,
+					HelperTable: *schemaEvent.CreatedTable,
+				}, nil
+			}
+		case schemaEvent.IsSchemaChange && schemaEvent.DeletedTable == nil:
+			tool, table := onlineSchemaChangeOf(*schemaEvent.AffectedTable)
+			if tool == "" {
+				continue
+			}
+
+			match := alterTableClauseRegexp.FindStringSubmatch(sqlStatement)
+			if match == nil {
+				return nil, fmt.Errorf("cannot extract the migration of %s from %s statement", table, tool)
+			}
+			return &OnlineSchemaChange{
+				Tool:        tool,
+				Phase:       OnlineSchemaChangeAltered,
+				Table:       table,
+				HelperTable: *schemaEvent.AffectedTable,
+				AlterClause: strings.TrimSpace(match[1]),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// OnlineSchemaChangeEvent replaces the cut-over of an online schema change of
+// a table on the target, by applying the migrations of the helper table to
+// the table itself.
+type OnlineSchemaChangeEvent struct {
+	table        QualifiedTableName
+	alterClauses []string
+	*DXLEventBase
+}
+
+func NewOnlineSchemaChangeEvent(table QualifiedTableName, alterClauses []string, pos BinlogPosition, time time.Time) *OnlineSchemaChangeEvent {
+	return &OnlineSchemaChangeEvent{
+		table:        table,
+		alterClauses: alterClauses,
+		DXLEventBase: &DXLEventBase{
+			pos:  pos,
+			time: time,
+		},
+	}
+}
+
+func (e *OnlineSchemaChangeEvent) IsAutoTransaction() bool {
+	return true
+}
+
+func (e *OnlineSchemaChangeEvent) Database() string {
+	return e.table.SchemaName
+}
+
+func (e *OnlineSchemaChangeEvent) Table() string {
+	return e.table.TableName
+}
+
+// AsSQLString returns an empty string if there is no migration to apply
+func (e *OnlineSchemaChangeEvent) AsSQLString(schemaName, tableName string) (string, error) {
+	statements := make([]string, len(e.alterClauses))
+	for i, clause := range e.alterClauses {
+		statements[i] = "ALTER TABLE " + QuotedTableNameFromString(schemaName, tableName) + " " + clause
+	}
+	return strings.Join(statements, ";\n"), nil
+}
+
+// PauseForOnlineSchemaChangeCallback pauses replication after the events
+// preceding the cut-over of an online schema change have been applied, and
+// waits until it is resumed before reloading the schema of the table.
+type PauseForOnlineSchemaChangeCallback struct {
+	*BinlogWriter
+	OnlineSchemaChange *OnlineSchemaChange
+}
+
+func (c *PauseForOnlineSchemaChangeCallback) Notify() error {
+	if c.Throttler == nil {
+		return fmt.Errorf("cannot pause for %s cut-over of %s without a throttler", c.OnlineSchemaChange.Tool, c.OnlineSchemaChange.Table)
+	}
+
+	c.Throttler.SetPaused(true)
+	c.setWriterState(WriterStateThrottled)
+	c.logger.Errorf(
+		"%s replaced %s on the source: replication is paused until the same migration is applied to the target table and replication is resumed",
+		c.OnlineSchemaChange.Tool,
+		c.OnlineSchemaChange.Table,
+	)
+	WaitForThrottle(c.Throttler)
+
+	return c.ReloadTableSchema(&c.OnlineSchemaChange.Table)
+}
+
+// ReloadTableSchemaCallback reloads the schema of an existing table after it
+// was changed on the target.
+type ReloadTableSchemaCallback struct {
+	*BinlogWriter
+	Table QualifiedTableName
+}
+
+func (c *ReloadTableSchemaCallback) Notify() error {
+	return c.ReloadTableSchema(&c.Table)
+}
@@ -0,0 +1,122 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How the binlog writer handles an UPDATE that changes the pagination key of
+// a row of a table that is still being copied, see
+// Config.PaginationKeyChangePolicy.
+//
+// Such an update can move a row from ahead of the cursor of the copy to
+// behind it. The update is not applied to the target as the row was not
+// copied yet, and the copy never reaches the row at its new key, so the row
+// goes missing.
+const (
+	// Apply the update without further checks
+	PaginationKeyChangePolicyIgnore = "ignore"
+	// Log a warning and count the update in the "PaginationKeyChange" metric
+	PaginationKeyChangePolicyWarn = "warn"
+	// Fail as soon as such an update is seen
+	PaginationKeyChangePolicyAbort = "abort"
+	// Copy the row again from the source at its new pagination key, after
+	// applying the update
+	PaginationKeyChangePolicyRecopy = "recopy"
+)
+
+// handlePaginationKeyChange applies the PaginationKeyChangePolicy to the
+// update, and returns the events to write after it.
+func (b *BinlogWriter) handlePaginationKeyChange(ev *BinlogUpdateEvent) ([]DMLEvent, error) {
+	if b.PaginationKeyChangePolicy == "" || b.PaginationKeyChangePolicy == PaginationKeyChangePolicyIgnore {
+		return nil, nil
+	}
+
+	table := ev.TableSchema()
+	if b.StateTracker == nil || b.StateTracker.IsTableComplete(table.String()) {
+		return nil, nil
+	}
+
+	changed, err := ev.PaginationKeyChanged()
+	if err != nil || !changed {
+		return nil, err
+	}
+
+	oldKey, err := NewPaginationKeyDataFromRow(ev.OldValues(), table.PaginationKey)
+	if err != nil {
+		return nil, err
+	}
+	newKey, err := NewPaginationKeyDataFromRow(ev.NewValues(), table.PaginationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b.metrics.Count("PaginationKeyChange", 1, []MetricTag{
+		{Name: "table", Value: table.String()},
+		{Name: "policy", Value: b.PaginationKeyChangePolicy},
+	}, 1.0)
+
+	logger := b.logger.WithFields(logrus.Fields{
+		"table":    table.String(),
+		"old_key":  oldKey.String(),
+		"new_key":  newKey.String(),
+		"position": ev.BinlogPosition(),
+	})
+
+	switch b.PaginationKeyChangePolicy {
+	case PaginationKeyChangePolicyAbort:
+		return nil, fmt.Errorf("the pagination key of a row of %s changed from %s to %s while the table is being copied", table, oldKey, newKey)
+	case PaginationKeyChangePolicyRecopy:
+		logger.Info("pagination key of a row changed while the table is being copied, copying the row again")
+		return b.recopyRow(table, newKey, ev)
+	default:
+		logger.Warn("pagination key of a row changed while the table is being copied, the row may be missing from the target")
+		return nil, nil
+	}
+}
+
+// recopyRow reads the row at the pagination key from the source and returns
+// it as an insert. The row is read as of now rather than as of the update,
+// which is safe as all later changes of the row follow in the binlogs and are
+// applied on top of it.
+func (b *BinlogWriter) recopyRow(table *TableSchema, key *PaginationKeyData, ev *BinlogUpdateEvent) ([]DMLEvent, error) {
+	conditions := make([]string, len(table.PaginationKey.Columns))
+	for i, column := range table.PaginationKey.Columns {
+		conditions[i] = quoteField(column.Name) + " = ?"
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", QuotedTableNameFromString(table.Schema, table.Name), strings.Join(conditions, " AND "))
+	rows, err := b.SourceDB.Query(query, key.Values...)
+	if err != nil {
+		return nil, fmt.Errorf("reading row %s of %s again: %v", key, table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]DMLEvent, 0, 1)
+	for rows.Next() {
+		values, err := ScanGenericRow(rows, len(columns))
+		if err != nil {
+			return nil, fmt.Errorf("reading row %s of %s again: %v", key, table, err)
+		}
+
+		events = append(events, &BinlogInsertEvent{
+			newValues: values,
+			DMLEventBase: &DMLEventBase{
+				table: table,
+				DXLEventBase: &DXLEventBase{
+					pos:  ev.BinlogPosition(),
+					time: ev.EventTime(),
+				},
+			},
+		})
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,192 @@
+package ghostferry
+
+import (
+	sqlorig "database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// PositionMapping maps a source binlog position applied to the target to the
+// binlog coordinates of the target after it was applied.
+type PositionMapping struct {
+	Time           time.Time
+	SourcePosition BinlogPosition
+	EventTime      time.Time
+	TargetPosition mysql.Position
+	TargetGTIDSet  string
+}
+
+// PositionMap records the source binlog positions applied by the binlog
+// writer, along with the binlog coordinates of the target, to a table on the
+// target, see PositionMapConfig. This allows aligning the target with the
+// source after the ferry stops, e.g. to attach native replication.
+//
+// The target coordinates are read right after the transaction applying the
+// source position is committed. Other writers of the target (such as the
+// data iterator) may commit in between, so the target coordinates are an
+// upper bound: the target binlog up to them contains all source changes up to
+// the source position, and may contain some later ones.
+type PositionMap struct {
+	Config *PositionMapConfig
+	DB     *sql.DB
+
+	mutex        sync.Mutex
+	lastRecorded time.Time
+	pending      *BinlogPosition
+	pendingTime  time.Time
+	logger       *logrus.Entry
+}
+
+func NewPositionMap(config *PositionMapConfig, db *sql.DB, logger *logrus.Entry) (*PositionMap, error) {
+	p := &PositionMap{
+		Config: config,
+		DB:     db,
+		logger: logger,
+	}
+
+	if err := p.initializeTable(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Record records the source position applied to the target, unless a
+// position was recorded within the RecordInterval, in which case it is kept
+// to be recorded later. A mapping that cannot be recorded is logged and
+// skipped, as the next one still bounds the target coordinates of the
+// positions before it, see MappingFor.
+func (p *PositionMap) Record(pos BinlogPosition, eventTime time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastRecorded) < p.Config.recordInterval {
+		p.pending, p.pendingTime = &pos, eventTime
+		return
+	}
+
+	p.record(pos, eventTime, now)
+}
+
+// Flush records the last applied source position, if it was not recorded
+// yet
+func (p *PositionMap) Flush() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.pending != nil {
+		p.record(*p.pending, p.pendingTime, time.Now())
+	}
+}
+
+// the format of TIMESTAMP values, which are returned in UTC as the sessions
+// use the +00:00 time zone
+const positionMapTimeFormat = "2006-01-02 15:04:05.999999"
+
+// MappingFor returns the first recorded mapping at or after the source
+// position
+func (p *PositionMap) MappingFor(pos mysql.Position) (PositionMapping, error) {
+	var mapping PositionMapping
+	var recordedAt string
+	var eventTime sqlorig.NullString
+
+	err := p.DB.QueryRow(
+		"SELECT recorded_at, source_filename, source_pos, source_resume_filename, source_resume_pos, source_event_timestamp, target_filename, target_pos, target_gtid_set FROM "+p.tableName()+" WHERE source_filename > ? OR (source_filename = ? AND source_pos >= ?) ORDER BY id LIMIT 1",
+		pos.Name, pos.Name, pos.Pos,
+	).Scan(
+		&recordedAt,
+		&mapping.SourcePosition.EventPosition.Name,
+		&mapping.SourcePosition.EventPosition.Pos,
+		&mapping.SourcePosition.ResumePosition.Name,
+		&mapping.SourcePosition.ResumePosition.Pos,
+		&eventTime,
+		&mapping.TargetPosition.Name,
+		&mapping.TargetPosition.Pos,
+		&mapping.TargetGTIDSet,
+	)
+	if err == sqlorig.ErrNoRows {
+		return mapping, fmt.Errorf("no position recorded at or after %v", pos)
+	} else if err != nil {
+		return mapping, err
+	}
+
+	mapping.Time, err = time.Parse(positionMapTimeFormat, recordedAt)
+	if err != nil {
+		return mapping, err
+	}
+
+	if eventTime.Valid {
+		mapping.EventTime, err = time.Parse(positionMapTimeFormat, eventTime.String)
+	}
+	return mapping, err
+}
+
+func (p *PositionMap) record(pos BinlogPosition, eventTime time.Time, now time.Time) {
+	p.pending = nil
+	p.lastRecorded = now
+
+	targetPosition, targetGTIDSet, err := ShowMasterStatus(p.DB)
+	if err != nil {
+		p.logger.WithError(err).Error("failed to read target binlog position")
+		return
+	}
+
+	var eventTimestamp interface{}
+	if !eventTime.IsZero() {
+		eventTimestamp = eventTime
+	}
+
+	result, err := p.DB.Exec(
+		"INSERT INTO "+p.tableName()+" (recorded_at, source_filename, source_pos, source_resume_filename, source_resume_pos, source_event_timestamp, target_filename, target_pos, target_gtid_set) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		now,
+		pos.EventPosition.Name,
+		pos.EventPosition.Pos,
+		pos.ResumePosition.Name,
+		pos.ResumePosition.Pos,
+		eventTimestamp,
+		targetPosition.Name,
+		targetPosition.Pos,
+		targetGTIDSet,
+	)
+	if err != nil {
+		p.logger.WithError(err).Error("failed to record position mapping")
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil || id <= int64(p.Config.MaxRows) {
+		return
+	}
+
+	_, err = p.DB.Exec("DELETE FROM "+p.tableName()+" WHERE id <= ?", id-int64(p.Config.MaxRows))
+	if err != nil {
+		p.logger.WithError(err).Warn("failed to prune position mappings")
+	}
+}
+
+func (p *PositionMap) tableName() string {
+	return QuotedTableNameFromString(p.Config.Database, p.Config.Table)
+}
+
+func (p *PositionMap) initializeTable() error {
+	return createStateTable(p.DB, p.Config.Database, p.Config.Table, `
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    recorded_at TIMESTAMP(6) NOT NULL,
+    source_filename varchar(255) CHARACTER SET ascii NOT NULL,
+    source_pos int(11) UNSIGNED NOT NULL,
+    source_resume_filename varchar(255) CHARACTER SET ascii NOT NULL,
+    source_resume_pos int(11) UNSIGNED NOT NULL,
+    source_event_timestamp TIMESTAMP(6) NULL,
+    target_filename varchar(255) CHARACTER SET ascii NOT NULL,
+    target_pos int(11) UNSIGNED NOT NULL,
+    target_gtid_set TEXT NOT NULL,
+    PRIMARY KEY (id),
+    KEY source_position (source_filename, source_pos)
+`, "position map")
+}
@@ -0,0 +1,805 @@
+package ghostferry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+type PreflightStatus string
+
+const (
+	PreflightPass PreflightStatus = "PASS"
+	PreflightWarn PreflightStatus = "WARN"
+	PreflightFail PreflightStatus = "FAIL"
+)
+
+type PreflightCheckResult struct {
+	Name        string
+	Status      PreflightStatus
+	Message     string
+	Remediation string
+}
+
+type PreflightReport struct {
+	// What the checks are for, e.g. "cutover"
+	//
+	// Optional: defaults to "preflight"
+	Name string
+
+	Results []PreflightCheckResult
+}
+
+// Passed returns false if any of the checks failed. Warnings do not fail
+// the preflight.
+func (r *PreflightReport) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status == PreflightFail {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *PreflightReport) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", result.Status, result.Name, result.Message)
+		if result.Status != PreflightPass && result.Remediation != "" {
+			fmt.Fprintf(&b, "       hint: %s\n", result.Remediation)
+		}
+	}
+
+	name := r.Name
+	if name == "" {
+		name = "preflight"
+	}
+	if r.Passed() {
+		fmt.Fprintf(&b, "%s checks passed\n", name)
+	} else {
+		fmt.Fprintf(&b, "%s checks failed\n", name)
+	}
+	return b.String()
+}
+
+func (r *PreflightReport) pass(name, message string) {
+	r.Results = append(r.Results, PreflightCheckResult{Name: name, Status: PreflightPass, Message: message})
+}
+
+func (r *PreflightReport) warn(name, message, remediation string) {
+	r.Results = append(r.Results, PreflightCheckResult{Name: name, Status: PreflightWarn, Message: message, Remediation: remediation})
+}
+
+func (r *PreflightReport) fail(name, message, remediation string) {
+	r.Results = append(r.Results, PreflightCheckResult{Name: name, Status: PreflightFail, Message: message, Remediation: remediation})
+}
+
+// RunPreflightChecks validates the settings and privileges of the source and
+// target databases against the given config, without modifying either of
+// them. Unlike Ferry.Initialize, it does not stop at the first problem but
+// collects the outcome of all checks into a report.
+func RunPreflightChecks(config *Config) *PreflightReport {
+	report := &PreflightReport{}
+	logger := logrus.WithField("tag", "preflight")
+
+	sourceDB, err := config.Source.SqlDB(logger.WithField("dbname", "source"))
+	if err == nil {
+		err = sourceDB.Ping()
+	}
+	if err != nil {
+		report.fail("source connection", err.Error(), "check the Source connection settings and that the server is reachable")
+		return report
+	}
+	defer sourceDB.Close()
+	report.pass("source connection", "connected")
+
+	targetDB, err := config.Target.SqlDB(logger.WithField("dbname", "target"))
+	if err == nil {
+		err = targetDB.Ping()
+	}
+	if err != nil {
+		report.fail("target connection", err.Error(), "check the Target connection settings and that the server is reachable")
+		return report
+	}
+	defer targetDB.Close()
+	report.pass("target connection", "connected")
+
+	checkTLS(report, "source tls", config.Source, sourceDB)
+	checkTLS(report, "target tls", config.Target, targetDB)
+	checkBinlogSettings(report, config, sourceDB)
+	if config.StateToResumeFrom != nil {
+		checkResumePosition(report, config, sourceDB)
+	}
+	if config.Source.IsRDS() {
+		checkRDSSource(report, config, sourceDB)
+	}
+
+	// the privileges are required on the copied databases, or globally if
+	// the tables cannot be loaded
+	tables, tablesErr := LoadTables(sourceDB, config.TableFilter, config.CompressedColumnsForVerification, config.IgnoredColumnsForVerification, config.CascadingPaginationColumnConfig)
+	sourceDatabases := copiedDatabases(tables.AsSlice(), nil)
+	targetDatabases := copiedDatabases(tables.AsSlice(), config.DatabaseRewrites)
+	if config.ReadOnlySource {
+		checkReadOnlyGrants(report, "source grants", sourceDB, sourceRequiredPrivileges(config), sourceDatabases)
+	} else {
+		checkGrants(report, "source grants", sourceDB, sourceRequiredPrivileges(config), sourceDatabases)
+	}
+	checkGrants(report, "target grants", targetDB, targetRequiredPrivileges, targetDatabases)
+	checkServerIds(report, config, sourceDB, targetDB)
+	checkMaxAllowedPacket(report, config, sourceDB, targetDB)
+	checkTimeZones(report, config, sourceDB, targetDB)
+	checkSQLMode(report, config.Target, targetDB)
+	if config.SkipTargetBinlog {
+		checkTargetBinlog(report, targetDB)
+	}
+
+	if tablesErr != nil {
+		report.fail("source tables", tablesErr.Error(), "check the table filter and that all applicable tables can be paginated")
+		return report
+	}
+	report.pass("source tables", fmt.Sprintf("%d applicable tables", len(tables)))
+
+	checkTargetTables(report, config, tables, targetDB)
+	checkUpgradeCompatibility(report, config, tables, sourceDB, targetDB)
+	checkDataSize(report, tables, sourceDB)
+
+	return report
+}
+
+// the remaining validity of a client certificate below which a run risks
+// failing to reconnect before it is complete
+const clientCertificateExpiryWarning = 7 * 24 * time.Hour
+
+func checkTLS(report *PreflightReport, name string, c *DatabaseConfig, db *sql.DB) {
+	if c.TLS == nil && !c.IsRDS() {
+		report.pass(name, "not configured")
+		return
+	}
+
+	var variable, version string
+	err := db.QueryRow("SHOW SESSION STATUS LIKE 'Ssl_version'").Scan(&variable, &version)
+	if err != nil {
+		report.fail(name, err.Error(), "")
+		return
+	} else if version == "" {
+		report.fail(name, "the connection is not encrypted", "enable TLS on the server")
+		return
+	}
+
+	if c.TLS != nil {
+		certificate, err := c.TLS.ClientCertificate()
+		if err != nil {
+			report.fail(name, err.Error(), "check ClientCertPath and ClientKeyPath")
+			return
+		}
+		if certificate != nil && time.Until(certificate.NotAfter) < clientCertificateExpiryWarning {
+			report.warn(name, fmt.Sprintf("%s, but the client certificate expires at %s", version, certificate.NotAfter.UTC().Format(time.RFC3339)), "renew the client certificate before starting a long run")
+			return
+		}
+	}
+
+	report.pass(name, version)
+}
+
+func queryVariable(db *sql.DB, variable string) (string, error) {
+	var value string
+	err := db.QueryRow(fmt.Sprintf("SELECT @@%s", variable)).Scan(&value)
+	return value, err
+}
+
+func checkBinlogSettings(report *PreflightReport, config *Config, db *sql.DB) {
+	binlogFormat, err := queryVariable(db, "global.binlog_format")
+	if err != nil {
+		report.fail("binlog_format", err.Error(), "")
+	} else if strings.ToUpper(binlogFormat) != "ROW" {
+		report.fail("binlog_format", fmt.Sprintf("binlog_format must be ROW, not %s", binlogFormat), setGlobalRemediation(config.Source, "binlog_format", "'ROW'", "source"))
+	} else {
+		report.pass("binlog_format", binlogFormat)
+	}
+
+	if config.SkipBinlogRowImageCheck {
+		report.warn("binlog_row_image", "check skipped", "make sure binlog_row_image is FULL on the source")
+		return
+	}
+
+	binlogRowImage, err := queryVariable(db, "global.binlog_row_image")
+	if err != nil {
+		report.fail("binlog_row_image", err.Error(), "set SkipBinlogRowImageCheck for servers not supporting binlog_row_image")
+	} else if err = checkBinlogRowImage(binlogRowImage, config.AllowMinimalBinlogRowImage); err != nil {
+		report.fail("binlog_row_image", err.Error(), setGlobalRemediation(config.Source, "binlog_row_image", "'FULL'", "source")+", or set AllowMinimalBinlogRowImage if all copied tables have a primary key")
+	} else if strings.ToUpper(binlogRowImage) != "FULL" {
+		report.warn("binlog_row_image", binlogRowImage, "columns missing from inserted rows get the defaults of the target table")
+	} else {
+		report.pass("binlog_row_image", binlogRowImage)
+	}
+}
+
+func checkResumePosition(report *PreflightReport, config *Config, db *sql.DB) {
+	pos := resumeBinlogPosition(config.StateToResumeFrom, config.VerifierType == VerifierTypeInline)
+	if pos.Name == "" {
+		report.pass("resume position", "no binlog position to resume from")
+		return
+	}
+
+	if err := CheckBinlogPositionAvailable(db, pos); err != nil {
+		report.fail("resume position", err.Error(), "the run cannot be resumed, start it again from scratch")
+		return
+	}
+
+	retention, err := BinlogRetention(db, config.Source.IsRDS())
+	if err != nil {
+		report.warn("resume position", fmt.Sprintf("%s is available, but the binlog retention is unknown: %v", pos, err), "")
+	} else if retention == 0 {
+		report.pass("resume position", fmt.Sprintf("%s is available", pos))
+	} else {
+		report.pass("resume position", fmt.Sprintf("%s is available, binlogs are purged after %s", pos, retention))
+	}
+}
+
+func checkBinlogRowImage(binlogRowImage string, allowMinimal bool) error {
+	switch strings.ToUpper(binlogRowImage) {
+	case "FULL":
+		return nil
+	case "MINIMAL", "NOBLOB":
+		if allowMinimal {
+			return nil
+		}
+		return fmt.Errorf("binlog_row_image must be FULL, not %s (set AllowMinimalBinlogRowImage to replicate from partial row images)", binlogRowImage)
+	default:
+		return fmt.Errorf("binlog_row_image must be FULL, not %s", binlogRowImage)
+	}
+}
+
+var (
+	targetRequiredPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE"}
+
+	// the privileges that can be granted on a database, unlike the
+	// administrative ones that are only granted globally
+	databasePrivileges = map[string]bool{
+		"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+		"CREATE": true, "DROP": true, "REFERENCES": true, "INDEX": true,
+		"ALTER": true, "CREATE TEMPORARY TABLES": true, "LOCK TABLES": true,
+		"EXECUTE": true, "CREATE VIEW": true, "SHOW VIEW": true,
+		"CREATE ROUTINE": true, "ALTER ROUTINE": true, "EVENT": true,
+		"TRIGGER": true, "GRANT OPTION": true,
+	}
+
+	grantPrivilegesRegexp = regexp.MustCompile(`^GRANT (.+?) ON (.+?) TO `)
+	grantColumnListRegexp = regexp.MustCompile(`\([^)]*\)`)
+)
+
+func sourceRequiredPrivileges(config *Config) []string {
+	privileges := []string{"SELECT", "REPLICATION SLAVE", "REPLICATION CLIENT"}
+	backupLock := config.ConsistentSnapshot && config.ConsistentSnapshotLock == SnapshotLockBackup
+	if config.LockStrategy == "" || config.LockStrategy == LockStrategySourceDB || backupLock {
+		privileges = append(privileges, "LOCK TABLES")
+	}
+	if config.ConsistentSnapshot {
+		if backupLock {
+			// for LOCK INSTANCE FOR BACKUP and performance_schema.log_status
+			privileges = append(privileges, "BACKUP_ADMIN")
+		} else {
+			// for FLUSH TABLES WITH READ LOCK
+			privileges = append(privileges, "RELOAD")
+		}
+	}
+	return privileges
+}
+
+// privilegeGrant is a line of SHOW GRANTS granting privileges
+type privilegeGrant struct {
+	privileges []string
+
+	// The database pattern the privileges are granted on, "*" if they are
+	// granted globally
+	database string
+
+	// Whether the privileges are granted on all tables of the database, not
+	// only on some tables, columns or routines
+	allTables bool
+}
+
+// grantsOnDatabase returns whether the grant covers all tables of the
+// database, either globally or on the database
+func (g privilegeGrant) grantsOnDatabase(database string) bool {
+	if !g.allTables {
+		return false
+	}
+	return g.database == "*" || databasePatternRegexp(g.database).MatchString(database)
+}
+
+// databasePatternRegexp returns the regexp matching the database names of a
+// database level grant, in which _ and % are wildcards unless escaped
+func databasePatternRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '_':
+			b.WriteString(".")
+		case c == '%':
+			b.WriteString(".*")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// parseGrants parses the output of SHOW GRANTS into the grants of privileges,
+// skipping the grants of roles
+func parseGrants(grants []string) []privilegeGrant {
+	parsed := make([]privilegeGrant, 0, len(grants))
+	for _, grant := range grants {
+		match := grantPrivilegesRegexp.FindStringSubmatch(grant)
+		if match == nil {
+			continue
+		}
+
+		// strip column lists such as SELECT (`id`, `data`), which are only
+		// granted on tables
+		list := grantColumnListRegexp.ReplaceAllString(match[1], "")
+		database, table := parseGrantScope(match[2])
+		g := privilegeGrant{database: database, allTables: table == "*"}
+		for _, privilege := range strings.Split(list, ",") {
+			g.privileges = append(g.privileges, strings.ToUpper(strings.TrimSpace(privilege)))
+		}
+		parsed = append(parsed, g)
+	}
+	return parsed
+}
+
+// parseGrantScope splits the scope of a grant such as `gftest`.* into the
+// database and the table. Grants on routines have an empty table.
+func parseGrantScope(scope string) (database, table string) {
+	if strings.HasPrefix(scope, "PROCEDURE ") || strings.HasPrefix(scope, "FUNCTION ") {
+		return "", ""
+	}
+	scope = strings.TrimPrefix(scope, "TABLE ")
+
+	database, rest := parseGrantIdentifier(scope)
+	if !strings.HasPrefix(rest, ".") {
+		return "", ""
+	}
+	table, _ = parseGrantIdentifier(rest[1:])
+	return database, table
+}
+
+// parseGrantIdentifier returns the leading identifier of s, unquoted, and
+// the rest of s
+func parseGrantIdentifier(s string) (identifier, rest string) {
+	for _, quote := range []string{"`", "'", "\""} {
+		if !strings.HasPrefix(s, quote) {
+			continue
+		}
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i:i+1] != quote {
+				b.WriteByte(s[i])
+			} else if strings.HasPrefix(s[i+1:], quote) {
+				// doubled quotes escape the quote
+				b.WriteString(quote)
+				i++
+			} else {
+				return b.String(), s[i+1:]
+			}
+		}
+		return b.String(), ""
+	}
+
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// grantedPrivileges returns the set of privileges granted by the output of
+// SHOW GRANTS on any scope
+func grantedPrivileges(grants []string) map[string]bool {
+	privileges := make(map[string]bool)
+	for _, grant := range parseGrants(grants) {
+		for _, privilege := range grant.privileges {
+			privileges[privilege] = true
+		}
+	}
+	return privileges
+}
+
+// privilegeGrantedOn returns whether the privilege is granted on all tables
+// of the database by one of the grants
+func privilegeGrantedOn(grants []privilegeGrant, privilege, database string) bool {
+	for _, grant := range grants {
+		if !grant.grantsOnDatabase(database) {
+			continue
+		}
+		for _, granted := range grant.privileges {
+			if granted == privilege {
+				return true
+			}
+			// ALL grants only the privileges of its scope
+			all := granted == "ALL" || granted == "ALL PRIVILEGES"
+			if all && (grant.database == "*" || databasePrivileges[privilege]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MissingPrivileges returns those of the required privileges that are not
+// granted by the given SHOW GRANTS output on all tables of each of the given
+// databases. Privileges granted on some tables or columns only do not count.
+// Without databases, the privileges must be granted globally, as for
+// REPLICATION CLIENT and other administrative privileges.
+func MissingPrivileges(grants []string, required []string, databases []string) []string {
+	parsed := parseGrants(grants)
+	if len(databases) == 0 {
+		databases = []string{"*"}
+	}
+
+	missing := make([]string, 0)
+	for _, privilege := range required {
+		for _, database := range databases {
+			if !privilegeGrantedOn(parsed, privilege, database) {
+				missing = append(missing, privilege)
+				break
+			}
+		}
+	}
+	return missing
+}
+
+// ExcessivePrivileges returns the privileges granted by the given SHOW
+// GRANTS output besides the allowed ones, sorted. USAGE, which grants no
+// privilege, is always allowed.
+func ExcessivePrivileges(grants []string, allowed []string) []string {
+	isAllowed := map[string]bool{"USAGE": true}
+	for _, privilege := range allowed {
+		isAllowed[privilege] = true
+	}
+
+	excessive := make([]string, 0)
+	for privilege := range grantedPrivileges(grants) {
+		if !isAllowed[privilege] {
+			excessive = append(excessive, privilege)
+		}
+	}
+	sort.Strings(excessive)
+	return excessive
+}
+
+// showGrants returns the grants of the connection, including the privileges
+// of its active roles, as SHOW GRANTS only lists the roles granted to the
+// user otherwise (GRANT `role`@`%` TO ...)
+func showGrants(db *sql.DB) ([]string, error) {
+	grants, err := queryGrants(db, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil || !hasRoleGrants(grants) {
+		return grants, err
+	}
+
+	// the privileges of roles granted but not active do not apply
+	var roles string
+	if err = db.QueryRow("SELECT CURRENT_ROLE()").Scan(&roles); err != nil {
+		return nil, fmt.Errorf("querying the active roles: %v", err)
+	}
+	if roles == "NONE" {
+		return grants, nil
+	}
+
+	return queryGrants(db, "SHOW GRANTS FOR CURRENT_USER() USING "+roles)
+}
+
+// hasRoleGrants returns whether the SHOW GRANTS output grants roles, which
+// are granted without an ON clause, unlike privileges
+func hasRoleGrants(grants []string) bool {
+	for _, grant := range grants {
+		if strings.HasPrefix(grant, "GRANT ") && !grantPrivilegesRegexp.MatchString(grant) {
+			return true
+		}
+	}
+	return false
+}
+
+func queryGrants(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make([]string, 0)
+	for rows.Next() {
+		var grant string
+		if err = rows.Scan(&grant); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// CheckReadOnlyPrivileges returns an error listing the missing and excessive
+// privileges, unless the connection is granted exactly the required
+// privileges, see Config.ReadOnlySource
+func CheckReadOnlyPrivileges(db *sql.DB, required []string, databases []string) error {
+	grants, err := showGrants(db)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	if missing := MissingPrivileges(grants, required, databases); len(missing) > 0 {
+		problems = append(problems, "missing privileges: "+strings.Join(missing, ", "))
+	}
+	if excessive := ExcessivePrivileges(grants, required); len(excessive) > 0 {
+		problems = append(problems, "excessive privileges: "+strings.Join(excessive, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func checkReadOnlyGrants(report *PreflightReport, name string, db *sql.DB, required []string, databases []string) {
+	if err := CheckReadOnlyPrivileges(db, required, databases); err != nil {
+		report.fail(name, err.Error(), fmt.Sprintf("grant the ghostferry user only %s on the source", strings.Join(required, ", ")))
+	} else {
+		report.pass(name, "only "+strings.Join(required, ", "))
+	}
+}
+
+func checkGrants(report *PreflightReport, name string, db *sql.DB, required []string, databases []string) {
+	grants, err := showGrants(db)
+	if err != nil {
+		report.fail(name, err.Error(), "")
+		return
+	}
+
+	missing := MissingPrivileges(grants, required, databases)
+	if len(missing) > 0 {
+		scope := "*.*"
+		if len(databases) > 0 {
+			scope = strings.Join(databases, ", ")
+		}
+		report.fail(name, fmt.Sprintf("missing privileges on %s: %s", scope, strings.Join(missing, ", ")), fmt.Sprintf("GRANT %s ON *.* TO the ghostferry user", strings.Join(missing, ", ")))
+	} else {
+		report.pass(name, strings.Join(required, ", "))
+	}
+}
+
+// copiedDatabases returns the sorted databases of the tables, rewritten with
+// the rewrites if given
+func copiedDatabases(tables []*TableSchema, rewrites map[string]string) []string {
+	seen := make(map[string]bool)
+	databases := make([]string, 0)
+	for _, table := range tables {
+		database := table.Schema
+		if rewrite, exists := rewrites[database]; exists {
+			database = rewrite
+		}
+		if !seen[database] {
+			seen[database] = true
+			databases = append(databases, database)
+		}
+	}
+	sort.Strings(databases)
+	return databases
+}
+
+func checkTargetBinlog(report *PreflightReport, db *sql.DB) {
+	if err := checkSessionBinlogDisabled(db); err != nil {
+		report.fail("target binlog", err.Error(), "GRANT SYSTEM_VARIABLES_ADMIN ON *.* TO the ghostferry user, or unset SkipTargetBinlog")
+		return
+	}
+
+	replicas, err := TargetReplicas(db)
+	if err != nil {
+		report.warn("target binlog", fmt.Sprintf("cannot list the replicas of the target: %v", err), "make sure the target has no replicas needing the data")
+		return
+	}
+	if len(replicas) > 0 {
+		report.warn("target binlog", fmt.Sprintf("the replicas of the target do not receive the writes of Ghostferry: %s", strings.Join(replicas, ", ")), "unset SkipTargetBinlog if the replicas need the data")
+		return
+	}
+	report.pass("target binlog", "writes of Ghostferry are not binlogged")
+}
+
+func checkServerIds(report *PreflightReport, config *Config, sourceDB, targetDB *sql.DB) {
+	if config.MyServerId == 0 {
+		report.pass("server_id", fmt.Sprintf("an unused server_id between %d and %d is generated automatically", config.MyServerIdMin, config.MyServerIdMax))
+		return
+	}
+
+	serverId, err := queryVariable(targetDB, "server_id")
+	if err != nil {
+		report.fail("server_id", err.Error(), "")
+		return
+	}
+	if serverId == fmt.Sprintf("%d", config.MyServerId) {
+		report.fail("server_id", fmt.Sprintf("MyServerId %d is the server_id of the target", config.MyServerId), "choose a different MyServerId")
+		return
+	}
+
+	collision, err := serverIdCollision(config.MyServerId, sourceDB)
+	if err != nil {
+		report.warn("server_id", fmt.Sprintf("cannot check the replicas of the source: %s", err), "make sure no replica of the source uses MyServerId")
+		return
+	}
+	if collision != "" {
+		report.fail("server_id", fmt.Sprintf("MyServerId %d is already used by %s", config.MyServerId, collision), "choose a different MyServerId")
+		return
+	}
+
+	report.pass("server_id", fmt.Sprintf("%d is unused", config.MyServerId))
+}
+
+func checkMaxAllowedPacket(report *PreflightReport, config *Config, sourceDB, targetDB *sql.DB) {
+	var sourcePacket, targetPacket uint64
+	if err := sourceDB.QueryRow("SELECT @@global.max_allowed_packet").Scan(&sourcePacket); err != nil {
+		report.fail("max_allowed_packet", err.Error(), "")
+		return
+	}
+	if err := targetDB.QueryRow("SELECT @@global.max_allowed_packet").Scan(&targetPacket); err != nil {
+		report.fail("max_allowed_packet", err.Error(), "")
+		return
+	}
+
+	if targetPacket < sourcePacket {
+		report.fail("max_allowed_packet", fmt.Sprintf("target (%d) is smaller than source (%d)", targetPacket, sourcePacket), setGlobalRemediation(config.Target, "max_allowed_packet", fmt.Sprintf("%d", sourcePacket), "target"))
+	} else {
+		report.pass("max_allowed_packet", fmt.Sprintf("source %d, target %d", sourcePacket, targetPacket))
+	}
+}
+
+func checkTimeZones(report *PreflightReport, config *Config, sourceDB, targetDB *sql.DB) {
+	// the session time zones are set through the DSN, which proxies might
+	// not pass on
+	for _, check := range []struct {
+		name string
+		c    *DatabaseConfig
+		db   *sql.DB
+	}{{"source", config.Source, sourceDB}, {"target", config.Target, targetDB}} {
+		sessionTimeZone, err := queryVariable(check.db, "session.time_zone")
+		if err != nil {
+			report.fail("session time zone", err.Error(), "")
+			return
+		}
+		if sessionTimeZone != check.c.TimeZone {
+			report.fail("session time zone", fmt.Sprintf("%s sessions use %s instead of %s", check.name, sessionTimeZone, check.c.TimeZone), "make sure the connections can set time_zone, e.g. connect directly instead of through a proxy")
+			return
+		}
+	}
+	report.pass("session time zone", config.Source.TimeZone)
+
+	timeZone := func(db *sql.DB) (string, error) {
+		var globalTimeZone, systemTimeZone string
+		err := db.QueryRow("SELECT @@global.time_zone, @@system_time_zone").Scan(&globalTimeZone, &systemTimeZone)
+		if globalTimeZone == "SYSTEM" {
+			return systemTimeZone, err
+		}
+		return globalTimeZone, err
+	}
+
+	sourceTimeZone, err := timeZone(sourceDB)
+	if err != nil {
+		report.fail("time zone", err.Error(), "")
+		return
+	}
+	targetTimeZone, err := timeZone(targetDB)
+	if err != nil {
+		report.fail("time zone", err.Error(), "")
+		return
+	}
+
+	if sourceTimeZone != targetTimeZone {
+		report.warn("time zone", fmt.Sprintf("source uses %s, target uses %s", sourceTimeZone, targetTimeZone), "use the same time_zone on both servers to avoid surprises with time functions in default values and triggers")
+	} else {
+		report.pass("time zone", sourceTimeZone)
+	}
+}
+
+// checkSQLMode checks that the sessions on the target use the configured
+// sql_mode, which the server expands and may extend
+func checkSQLMode(report *PreflightReport, c *DatabaseConfig, db *sql.DB) {
+	sessionSQLMode, err := queryVariable(db, "session.sql_mode")
+	if err != nil {
+		report.fail("target sql_mode", err.Error(), "")
+		return
+	}
+
+	sessionModes := make(map[string]bool)
+	for _, mode := range strings.Split(sessionSQLMode, ",") {
+		sessionModes[mode] = true
+	}
+
+	for _, mode := range c.SQLModes() {
+		if !sessionModes[mode] {
+			report.fail("target sql_mode", fmt.Sprintf("sessions use %s, which lacks %s", sessionSQLMode, mode), "make sure the connections can set sql_mode, e.g. connect directly instead of through a proxy")
+			return
+		}
+	}
+
+	report.pass("target sql_mode", sessionSQLMode)
+}
+
+func checkTargetTables(report *PreflightReport, config *Config, tables TableSchemaCache, targetDB *sql.DB) {
+	missing := make([]string, 0)
+	incompatible := make([]string, 0)
+
+	for _, table := range tables.AsSlice() {
+		schemaName := table.Schema
+		if rewrite, exists := config.DatabaseRewrites[schemaName]; exists {
+			schemaName = rewrite
+		}
+		tableName := table.Name
+		if rewrite, exists := config.TableRewrites[tableName]; exists {
+			tableName = rewrite
+		}
+
+		rows, err := targetDB.Query("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schemaName, tableName)
+		if err != nil {
+			report.fail("target tables", err.Error(), "")
+			return
+		}
+
+		targetColumns := make(map[string]bool)
+		for rows.Next() {
+			var column string
+			if err = rows.Scan(&column); err != nil {
+				rows.Close()
+				report.fail("target tables", err.Error(), "")
+				return
+			}
+			targetColumns[column] = true
+		}
+		rows.Close()
+
+		targetName := fmt.Sprintf("%s.%s", schemaName, tableName)
+		if len(targetColumns) == 0 {
+			missing = append(missing, targetName)
+			continue
+		}
+
+		for _, column := range table.Columns {
+			if !targetColumns[column.Name] {
+				incompatible = append(incompatible, fmt.Sprintf("%s (missing column %s)", targetName, column.Name))
+				break
+			}
+		}
+	}
+
+	switch {
+	case len(incompatible) > 0:
+		report.fail("target tables", fmt.Sprintf("incompatible: %s", strings.Join(incompatible, ", ")), "align the target table definitions with the source")
+	case len(missing) > 0:
+		report.warn("target tables", fmt.Sprintf("missing: %s", strings.Join(missing, ", ")), "create the tables on the target unless the tool creates them (e.g., copydb)")
+	default:
+		report.pass("target tables", "all tables exist with compatible columns")
+	}
+}
+
+func checkDataSize(report *PreflightReport, tables TableSchemaCache, sourceDB *sql.DB) {
+	var totalBytes uint64
+	for _, table := range tables.AsSlice() {
+		var tableBytes uint64
+		err := sourceDB.QueryRow("SELECT COALESCE(DATA_LENGTH + INDEX_LENGTH, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", table.Schema, table.Name).Scan(&tableBytes)
+		if err != nil {
+			report.warn("disk space", fmt.Sprintf("cannot determine size of %s: %s", table.String(), err), "make sure the target has enough free disk space")
+			return
+		}
+		totalBytes += tableBytes
+	}
+
+	// MySQL does not expose the free disk space, so the best we can do is to
+	// tell how much will be needed
+	report.warn("disk space", fmt.Sprintf("the copied tables use about %d MiB on the source", totalBytes/(1024*1024)), "make sure the target has at least this much free disk space")
+}
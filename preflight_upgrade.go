@@ -0,0 +1,206 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+)
+
+// The keywords that are reserved in MySQL 8.0 but not in 5.7. Ghostferry
+// quotes all identifiers, but the queries of the applications may not.
+//
+// ref: https://dev.mysql.com/doc/refman/8.0/en/keywords.html
+var mysql80ReservedWords = map[string]bool{
+	"ARRAY":        true,
+	"CUME_DIST":    true,
+	"DENSE_RANK":   true,
+	"EMPTY":        true,
+	"EXCEPT":       true,
+	"FIRST_VALUE":  true,
+	"FUNCTION":     true,
+	"GROUPING":     true,
+	"GROUPS":       true,
+	"JSON_TABLE":   true,
+	"LAG":          true,
+	"LAST_VALUE":   true,
+	"LATERAL":      true,
+	"LEAD":         true,
+	"MEMBER":       true,
+	"NTH_VALUE":    true,
+	"NTILE":        true,
+	"OF":           true,
+	"OVER":         true,
+	"PERCENT_RANK": true,
+	"RANK":         true,
+	"RECURSIVE":    true,
+	"ROW":          true,
+	"ROWS":         true,
+	"ROW_NUMBER":   true,
+	"SYSTEM":       true,
+	"WINDOW":       true,
+}
+
+// The modes of sql_mode that were removed in MySQL 8.0. Setting them fails.
+var mysql80RemovedSQLModes = map[string]bool{
+	"DB2":                 true,
+	"MAXDB":               true,
+	"MSSQL":               true,
+	"MYSQL323":            true,
+	"MYSQL40":             true,
+	"ORACLE":              true,
+	"POSTGRESQL":          true,
+	"NO_AUTO_CREATE_USER": true,
+	"NO_FIELD_OPTIONS":    true,
+	"NO_KEY_OPTIONS":      true,
+	"NO_TABLE_OPTIONS":    true,
+}
+
+// MySQL80ReservedIdentifiers returns those of the identifiers that are
+// reserved words in MySQL 8.0 but not in 5.7.
+func MySQL80ReservedIdentifiers(identifiers []string) []string {
+	reserved := make([]string, 0)
+	for _, identifier := range identifiers {
+		if mysql80ReservedWords[strings.ToUpper(identifier)] {
+			reserved = append(reserved, identifier)
+		}
+	}
+	return reserved
+}
+
+// MySQL80RemovedSQLModes returns the modes of the sql_mode that were removed
+// in MySQL 8.0.
+func MySQL80RemovedSQLModes(sqlMode string) []string {
+	removed := make([]string, 0)
+	for _, mode := range strings.Split(sqlMode, ",") {
+		mode = strings.ToUpper(strings.TrimSpace(mode))
+		if mysql80RemovedSQLModes[mode] {
+			removed = append(removed, mode)
+		}
+	}
+	return removed
+}
+
+// checkUpgradeCompatibility reports the definitions of the copied tables and
+// the settings of the source that are incompatible with MySQL 8.0, if the
+// target runs MySQL 8.0 and the source an older version.
+func checkUpgradeCompatibility(report *PreflightReport, config *Config, tables TableSchemaCache, sourceDB, targetDB *sql.DB) {
+	sourceVersion, err := queryVariable(sourceDB, "version")
+	if err != nil {
+		report.fail("8.0 upgrade", err.Error(), "")
+		return
+	}
+	targetVersion, err := queryVariable(targetDB, "version")
+	if err != nil {
+		report.fail("8.0 upgrade", err.Error(), "")
+		return
+	}
+
+	if !strings.HasPrefix(targetVersion, "8.") || strings.HasPrefix(sourceVersion, "8.") {
+		return
+	}
+
+	checkUpgradeIdentifiers(report, tables)
+	checkUpgradeColumns(report, tables, sourceDB)
+	checkUpgradeSQLModes(report, config, sourceDB)
+}
+
+func checkUpgradeIdentifiers(report *PreflightReport, tables TableSchemaCache) {
+	reserved := make([]string, 0)
+	for _, table := range tables.AsSlice() {
+		if mysql80ReservedWords[strings.ToUpper(table.Name)] {
+			reserved = append(reserved, table.String())
+		}
+
+		for _, column := range table.Columns {
+			if mysql80ReservedWords[strings.ToUpper(column.Name)] {
+				reserved = append(reserved, fmt.Sprintf("%s.%s", table.String(), column.Name))
+			}
+		}
+	}
+	sort.Strings(reserved)
+
+	if len(reserved) > 0 {
+		report.warn("8.0 reserved words", fmt.Sprintf("identifiers that are reserved in 8.0: %s", strings.Join(reserved, ", ")), "quote these identifiers in all queries of the applications, or rename them")
+	} else {
+		report.pass("8.0 reserved words", "no identifiers are reserved in 8.0")
+	}
+}
+
+func checkUpgradeColumns(report *PreflightReport, tables TableSchemaCache, sourceDB *sql.DB) {
+	removedTypes := make([]string, 0)
+	deprecatedCharsets := make([]string, 0)
+	zeroDates := make([]string, 0)
+
+	for _, table := range tables.AsSlice() {
+		rows, err := sourceDB.Query(
+			"SELECT COLUMN_NAME, COLUMN_TYPE, COALESCE(CHARACTER_SET_NAME, ''), COALESCE(COLUMN_DEFAULT, '') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+			table.Schema, table.Name,
+		)
+		if err != nil {
+			report.fail("8.0 column definitions", err.Error(), "")
+			return
+		}
+
+		for rows.Next() {
+			var name, columnType, charset, columnDefault string
+			if err = rows.Scan(&name, &columnType, &charset, &columnDefault); err != nil {
+				rows.Close()
+				report.fail("8.0 column definitions", err.Error(), "")
+				return
+			}
+
+			column := fmt.Sprintf("%s.%s", table.String(), name)
+			if strings.EqualFold(columnType, "year(2)") {
+				removedTypes = append(removedTypes, fmt.Sprintf("%s (%s)", column, columnType))
+			}
+			if charset == "utf8" || charset == "utf8mb3" || charset == "ucs2" {
+				deprecatedCharsets = append(deprecatedCharsets, fmt.Sprintf("%s (%s)", column, charset))
+			}
+			if strings.HasPrefix(columnDefault, "0000-00-00") {
+				zeroDates = append(zeroDates, column)
+			}
+		}
+		rows.Close()
+	}
+
+	if len(removedTypes) > 0 {
+		report.fail("8.0 data types", fmt.Sprintf("columns with types removed in 8.0: %s", strings.Join(removedTypes, ", ")), "convert the columns to supported types, e.g. YEAR(2) to YEAR")
+	} else {
+		report.pass("8.0 data types", "no columns use types removed in 8.0")
+	}
+
+	if len(deprecatedCharsets) > 0 {
+		report.warn("8.0 character sets", fmt.Sprintf("columns with character sets deprecated in 8.0: %s", strings.Join(deprecatedCharsets, ", ")), "convert the columns to utf8mb4")
+	} else {
+		report.pass("8.0 character sets", "no columns use character sets deprecated in 8.0")
+	}
+
+	// the default sql_mode of 8.0 includes NO_ZERO_DATE and strict mode
+	if len(zeroDates) > 0 {
+		report.warn("8.0 zero dates", fmt.Sprintf("columns with zero date defaults: %s", strings.Join(zeroDates, ", ")), "change the defaults, or remove NO_ZERO_DATE from the sql_mode of the target server")
+	} else {
+		report.pass("8.0 zero dates", "no columns have zero date defaults")
+	}
+}
+
+func checkUpgradeSQLModes(report *PreflightReport, config *Config, sourceDB *sql.DB) {
+	// the pinned sql_mode would fail all connections to the target
+	if removed := MySQL80RemovedSQLModes(config.Target.SQLMode); len(removed) > 0 {
+		report.fail("8.0 sql_mode", fmt.Sprintf("the Target SQLMode uses modes removed in 8.0: %s", strings.Join(removed, ", ")), "remove these modes from the Target SQLMode")
+		return
+	}
+
+	sourceSQLMode, err := queryVariable(sourceDB, "global.sql_mode")
+	if err != nil {
+		report.fail("8.0 sql_mode", err.Error(), "")
+		return
+	}
+
+	if removed := MySQL80RemovedSQLModes(sourceSQLMode); len(removed) > 0 {
+		report.warn("8.0 sql_mode", fmt.Sprintf("the source uses modes removed in 8.0: %s", strings.Join(removed, ", ")), "remove these modes from the sql_mode of the applications")
+	} else {
+		report.pass("8.0 sql_mode", "the source uses no modes removed in 8.0")
+	}
+}
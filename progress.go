@@ -1,6 +1,8 @@
 package ghostferry
 
 import (
+	"time"
+
 	"github.com/siddontang/go-mysql/mysql"
 )
 
@@ -8,12 +10,21 @@ const (
 	TableActionWaiting   = "waiting"
 	TableActionCopying   = "copying"
 	TableActionCompleted = "completed"
+	// the copy was given up on, see Config.ErrorPolicy
+	TableActionQuarantined = "quarantined"
+	// the rows are not copied, only the binlog events are applied, see
+	// Config.StreamOnlyTables
+	TableActionStreamOnly = "stream-only"
 )
 
 type TableProgress struct {
 	LastSuccessfulPaginationKey string
 	TargetPaginationKey         string
 	CurrentAction               string // Possible values are defined via the constants TableAction*
+
+	// Fraction (between 0 and 1) of the table that has been copied, or -1 if
+	// it cannot be estimated (e.g., for non-numeric pagination keys).
+	Completion float64
 }
 
 type Progress struct {
@@ -27,10 +38,18 @@ type Progress struct {
 	// server and you want some sort of custom identification with this field.
 	CustomPayload string
 
-	Tables                  map[string]TableProgress
+	Tables map[string]TableProgress
+	// The progress of the tables of delta copies, by the name of the copy,
+	// see Ferry.RunResumableDataCopy
+	DeltaCopies map[string]map[string]TableProgress `json:",omitempty"`
+	// The errors that failed the quarantined tables, by table, see
+	// Config.ErrorPolicy
+	QuarantinedTables       map[string]string `json:",omitempty"`
 	LastSuccessfulBinlogPos mysql.Position
 	BinlogStreamerLag       float64 // seconds
 	Throttled               bool
+	// Why the writes to the target are paused, see Config.TargetGuard
+	TargetGuardReason string `json:",omitempty"`
 
 	// The behaviour of Ghostferry varies with respect to the VerifierType.
 	// For example: a long cutover is OK if
@@ -44,4 +63,20 @@ type Progress struct {
 	PaginationKeysPerSecond uint64
 	ETA                     float64 // seconds
 	TimeTaken               float64 // seconds
+
+	// The estimated size of the copy, only reported until the rows have
+	// been copied
+	Sizing *SizingReport `json:",omitempty"`
+}
+
+type BenchmarkResult struct {
+	RowsRead         uint64
+	BinlogEventsRead uint64
+
+	// Time taken to read all rows from the source. As writes are discarded in
+	// benchmark mode, this is the lower bound for the duration of the copy.
+	CopyDuration time.Duration
+
+	RowsPerSecond         float64
+	BinlogEventsPerSecond float64
 }
@@ -0,0 +1,141 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	progressDisplayBarWidth        = 30
+	progressDisplayMaxRecentErrors = 5
+
+	// clears the terminal and moves the cursor to the top-left corner
+	ansiClearScreen = "\033[H\033[2J"
+)
+
+// ProgressDisplay renders the progress of a ferry as an interactive dashboard
+// on a terminal, showing per-table progress, copy speed, binlog lag, throttle
+// state and the most recent errors.
+//
+// To capture errors, the display must be registered as a logrus hook, e.g.
+// via logrus.AddHook(display).
+type ProgressDisplay struct {
+	F               *Ferry
+	Output          io.Writer
+	RefreshInterval time.Duration
+
+	recentErrorsMutex sync.Mutex
+	recentErrors      []string
+}
+
+func NewProgressDisplay(f *Ferry, output io.Writer) *ProgressDisplay {
+	return &ProgressDisplay{
+		F:               f,
+		Output:          output,
+		RefreshInterval: 1 * time.Second,
+	}
+}
+
+func (d *ProgressDisplay) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		fmt.Fprint(d.Output, ansiClearScreen+d.Render(d.F.Progress()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ProgressDisplay) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (d *ProgressDisplay) Fire(entry *logrus.Entry) error {
+	message := entry.Message
+	if err, ok := entry.Data[logrus.ErrorKey]; ok {
+		message = fmt.Sprintf("%s: %v", message, err)
+	}
+
+	d.recentErrorsMutex.Lock()
+	defer d.recentErrorsMutex.Unlock()
+
+	d.recentErrors = append(d.recentErrors, fmt.Sprintf("%s %s", entry.Time.Format("15:04:05"), message))
+	if len(d.recentErrors) > progressDisplayMaxRecentErrors {
+		d.recentErrors = d.recentErrors[len(d.recentErrors)-progressDisplayMaxRecentErrors:]
+	}
+
+	return nil
+}
+
+// Render formats the given progress as it is shown on the terminal.
+func (d *ProgressDisplay) Render(progress *Progress) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Ghostferry %s - %s\n\n", VersionString, progress.CurrentState)
+
+	throttleState := "running"
+	if progress.Throttled {
+		throttleState = "throttled"
+	}
+	fmt.Fprintf(&b, "Rows/sec:    %d\n", progress.PaginationKeysPerSecond)
+	fmt.Fprintf(&b, "Binlog lag:  %s\n", formatSeconds(progress.BinlogStreamerLag))
+	fmt.Fprintf(&b, "Throttle:    %s\n", throttleState)
+	fmt.Fprintf(&b, "Time taken:  %s\n", formatSeconds(progress.TimeTaken))
+	fmt.Fprintf(&b, "ETA:         %s\n\n", formatSeconds(progress.ETA))
+
+	tableNames := make([]string, 0, len(progress.Tables))
+	nameWidth := 0
+	for tableName := range progress.Tables {
+		tableNames = append(tableNames, tableName)
+		if len(tableName) > nameWidth {
+			nameWidth = len(tableName)
+		}
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		table := progress.Tables[tableName]
+		fmt.Fprintf(&b, "%-*s %s %s\n", nameWidth, tableName, renderProgressBar(table.Completion), table.CurrentAction)
+	}
+
+	d.recentErrorsMutex.Lock()
+	defer d.recentErrorsMutex.Unlock()
+
+	if len(d.recentErrors) > 0 {
+		b.WriteString("\nRecent errors:\n")
+		for _, message := range d.recentErrors {
+			fmt.Fprintf(&b, "  %s\n", message)
+		}
+	}
+
+	return b.String()
+}
+
+func renderProgressBar(completion float64) string {
+	if completion < 0 {
+		return "[" + strings.Repeat("?", progressDisplayBarWidth) + "]    ?%"
+	}
+
+	filled := int(completion * progressDisplayBarWidth)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat(" ", progressDisplayBarWidth-filled), completion*100)
+}
+
+func formatSeconds(seconds float64) string {
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return "n/a"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
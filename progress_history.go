@@ -0,0 +1,137 @@
+package ghostferry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// ProgressSnapshot is a Progress recorded at some point of the run
+type ProgressSnapshot struct {
+	RecordedAt time.Time
+	Progress   *Progress
+}
+
+// ProgressHistory periodically records the Progress of the ferry into a table
+// next to the resume state on the target, see Config.ProgressHistory. As the
+// table survives crashes, the throughput of the run can be reconstructed
+// without an external metrics system.
+type ProgressHistory struct {
+	Config   *ProgressHistoryConfig
+	DB       *sql.DB
+	Database string
+	Table    string
+
+	Progress func() *Progress
+
+	logger *logrus.Entry
+}
+
+func (f *Ferry) NewProgressHistory() *ProgressHistory {
+	return &ProgressHistory{
+		Config:   &f.Config.ProgressHistory,
+		DB:       f.stateTablesDB(),
+		Database: f.Config.ResumeStateFromDB,
+		Table:    fmt.Sprintf("_ghostferry_%d__progress_history", f.MyServerId),
+		Progress: f.Progress,
+		logger:   f.loggerFor("progress_history"),
+	}
+}
+
+// Initialize creates the table of the history, unless it was created by a
+// previous run that is resumed
+func (h *ProgressHistory) Initialize() error {
+	if h.logger == nil {
+		h.logger = logrus.WithField("tag", "progress_history")
+	}
+
+	return createStateTable(h.DB, h.Database, h.Table, `
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    current_state varchar(64) CHARACTER SET ascii NOT NULL,
+    pagination_keys_per_second bigint(20) UNSIGNED NOT NULL,
+    binlog_streamer_lag DOUBLE NOT NULL,
+    progress MEDIUMTEXT NOT NULL,
+    PRIMARY KEY (id)
+`, "progress history")
+}
+
+func (h *ProgressHistory) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.Config.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.Record(h.Progress()); err != nil {
+				h.logger.WithError(err).Warn("failed to record progress history")
+			}
+		}
+	}
+}
+
+// Record stores a snapshot of the progress and deletes the snapshots beyond
+// the MaxRows most recent ones
+func (h *ProgressHistory) Record(progress *Progress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.DB.Exec(
+		"INSERT INTO "+h.tableName()+" (current_state, pagination_keys_per_second, binlog_streamer_lag, progress) VALUES (?, ?, ?, ?)",
+		progress.CurrentState,
+		progress.PaginationKeysPerSecond,
+		progress.BinlogStreamerLag,
+		string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if id > int64(h.Config.MaxRows) {
+		_, err = h.DB.Exec("DELETE FROM "+h.tableName()+" WHERE id <= ?", id-int64(h.Config.MaxRows))
+	}
+	return err
+}
+
+// Snapshots returns the recorded snapshots, oldest first
+func (h *ProgressHistory) Snapshots() ([]ProgressSnapshot, error) {
+	rows, err := h.DB.Query("SELECT UNIX_TIMESTAMP(recorded_at), progress FROM " + h.tableName() + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []ProgressSnapshot{}
+	for rows.Next() {
+		var recordedAt int64
+		var data string
+		if err := rows.Scan(&recordedAt, &data); err != nil {
+			return nil, err
+		}
+
+		snapshot := ProgressSnapshot{RecordedAt: time.Unix(recordedAt, 0)}
+		if err := json.Unmarshal([]byte(data), &snapshot.Progress); err != nil {
+			return nil, fmt.Errorf("parsing progress recorded at %s failed: %v", snapshot.RecordedAt, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+func (h *ProgressHistory) tableName() string {
+	return QuotedTableNameFromString(h.Database, h.Table)
+}
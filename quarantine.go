@@ -0,0 +1,63 @@
+package ghostferry
+
+import (
+	"errors"
+	"sync"
+)
+
+// TableQuarantine holds the tables given up on due to the skip_table action
+// of Config.ErrorPolicy. The copy of a quarantined table is stopped, its
+// binlog events are dropped and it is not verified, so it is left incomplete
+// on the target while the run continues with the other tables.
+type TableQuarantine struct {
+	tables sync.Map
+}
+
+// Add quarantines the table with the error that failed it
+func (q *TableQuarantine) Add(table string, err error) {
+	q.tables.Store(table, err)
+}
+
+func (q *TableQuarantine) Contains(table string) bool {
+	if q == nil {
+		return false
+	}
+
+	_, found := q.tables.Load(table)
+	return found
+}
+
+// Tables returns the quarantined tables with the errors that failed them
+func (q *TableQuarantine) Tables() map[string]error {
+	tables := make(map[string]error)
+	if q == nil {
+		return tables
+	}
+
+	q.tables.Range(func(table, err interface{}) bool {
+		tables[table.(string)] = err.(error)
+		return true
+	})
+	return tables
+}
+
+// Serialize returns the quarantined tables with the messages of the errors
+// that failed them, to be stored in the SerializableState
+func (q *TableQuarantine) Serialize() map[string]string {
+	var tables map[string]string
+	for table, err := range q.Tables() {
+		if tables == nil {
+			tables = make(map[string]string)
+		}
+		tables[table] = err.Error()
+	}
+	return tables
+}
+
+// Restore quarantines the tables of a resumed run again. Their binlog events
+// were dropped, so they cannot be copied or verified any further.
+func (q *TableQuarantine) Restore(tables map[string]string) {
+	for table, message := range tables {
+		q.Add(table, errors.New(message))
+	}
+}
@@ -27,9 +27,70 @@ type SchemaEvent struct {
 	DeletedTable  *QualifiedTableName
 }
 
+const (
+	TransactionControlXAStart             = "XA START"
+	TransactionControlXAEnd               = "XA END"
+	TransactionControlXAPrepare           = "XA PREPARE"
+	TransactionControlXACommit            = "XA COMMIT"
+	TransactionControlXARollback          = "XA ROLLBACK"
+	TransactionControlSavepoint           = "SAVEPOINT"
+	TransactionControlRollbackToSavepoint = "ROLLBACK TO SAVEPOINT"
+	TransactionControlReleaseSavepoint    = "RELEASE SAVEPOINT"
+)
+
+// ParseTransactionControlStatement identifies XA and SAVEPOINT statements,
+// which MySQL logs as query events around the row events of a transaction.
+// Returns the kind of statement (one of the TransactionControl* constants) or
+// an empty string for any other statement.
+func ParseTransactionControlStatement(sqlStatement string) string {
+	tokens := strings.Fields(strings.ToUpper(sqlStatement))
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	switch tokens[0] {
+	case "XA":
+		if len(tokens) < 2 {
+			return ""
+		}
+		switch tokens[1] {
+		case "START", "BEGIN":
+			return TransactionControlXAStart
+		case "END":
+			return TransactionControlXAEnd
+		case "PREPARE":
+			return TransactionControlXAPrepare
+		case "COMMIT":
+			return TransactionControlXACommit
+		case "ROLLBACK":
+			return TransactionControlXARollback
+		}
+	case "SAVEPOINT":
+		return TransactionControlSavepoint
+	case "RELEASE":
+		if len(tokens) >= 2 && tokens[1] == "SAVEPOINT" {
+			return TransactionControlReleaseSavepoint
+		}
+	case "ROLLBACK":
+		// ROLLBACK [WORK] TO [SAVEPOINT] name
+		for _, token := range tokens[1:] {
+			if token == "TO" {
+				return TransactionControlRollbackToSavepoint
+			}
+			if token != "WORK" {
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
 type QueryAnalyzer struct {
 	sqlParser *parser.Parser
 	logger    *logrus.Entry
+
+	incrediblyVerboseLogging bool
 }
 
 func NewQueryAnalyzer() *QueryAnalyzer {
@@ -41,6 +102,14 @@ func NewQueryAnalyzer() *QueryAnalyzer {
 }
 
 func (q *QueryAnalyzer) ParseSchemaChanges(sqlStatement string, schemaOfStatement string) ([]*SchemaEvent, error) {
+	schemaEvents, err := q.parseSchemaEvents(sqlStatement, schemaOfStatement)
+	if err != nil {
+		return nil, err
+	}
+	return q.withoutIgnoredSchemaEvents(schemaEvents), nil
+}
+
+func (q *QueryAnalyzer) parseSchemaEvents(sqlStatement string, schemaOfStatement string) ([]*SchemaEvent, error) {
 	// NOTE: SQL is tricky! You can create a table in a database using a prefix
 	// and dot - but you can also create tables with dots in the name.
 	//
@@ -54,14 +123,30 @@ func (q *QueryAnalyzer) ParseSchemaChanges(sqlStatement string, schemaOfStatemen
 	//
 	// will create a table called "mytable" in a DB called "mydb". Thus, we need
 	// to parse the statement fully to understand what is happening
-	stmts, _, err := q.sqlParser.Parse(sqlStatement, "", "")
-
 	schemaEvents := make([]*SchemaEvent, 0)
+
+	// XA and SAVEPOINT statements never change the schema, but are not
+	// understood by the parser
+	if ParseTransactionControlStatement(sqlStatement) != "" {
+		return schemaEvents, nil
+	}
+
+	// temporary tables are private to the session that created them and are
+	// never part of the copied schema
+	if table := temporaryTableOfStatement(sqlStatement); table != "" {
+		q.logger.WithField("table", table).Info("ignoring temporary table statement")
+		if q.incrediblyVerboseLogging {
+			q.logger.Debugf("Ignored SQL statement: %s", sqlStatement)
+		}
+		return schemaEvents, nil
+	}
+
+	stmts, _, err := q.sqlParser.Parse(sqlStatement, "", "")
 	if err != nil {
 		// NOTE: We do not log the statement (or even the error itself) by
 		// default, as it may contain confidential data
 		q.logger.Warnf("Parsing SQL statement failed")
-		if IncrediblyVerboseLogging {
+		if q.incrediblyVerboseLogging {
 			q.logger.Debugf("Failing SQL statement: %s", sqlStatement)
 		}
 
@@ -170,3 +255,75 @@ func (q *QueryAnalyzer) ParseSchemaChanges(sqlStatement string, schemaOfStatemen
 
 	return schemaEvents, nil
 }
+
+// withoutIgnoredSchemaEvents drops the events that only touch system schemas
+// or the helper tables of online schema change tools, as these are never
+// copied and their schema must not be loaded
+func (q *QueryAnalyzer) withoutIgnoredSchemaEvents(schemaEvents []*SchemaEvent) []*SchemaEvent {
+	filteredEvents := make([]*SchemaEvent, 0, len(schemaEvents))
+	for _, schemaEvent := range schemaEvents {
+		ignored := logrus.Fields{}
+		for _, table := range []*QualifiedTableName{schemaEvent.AffectedTable, schemaEvent.CreatedTable, schemaEvent.DeletedTable} {
+			if table == nil {
+				continue
+			}
+			reason := ignoredSchemaChangeReason(*table)
+			if reason == "" {
+				ignored = nil
+				break
+			}
+			ignored[table.String()] = reason
+		}
+
+		if ignored != nil {
+			q.logger.WithFields(ignored).Info("ignoring schema change of tables that are never copied")
+			continue
+		}
+		filteredEvents = append(filteredEvents, schemaEvent)
+	}
+	return filteredEvents
+}
+
+var systemSchemas = map[string]bool{
+	"mysql":              true,
+	"information_schema": true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+// IsIgnoredSchemaChangeTable returns whether schema changes of the table are
+// noise that should not be replicated: tables in the system schemas and the
+// helper tables of online schema change tools.
+func IsIgnoredSchemaChangeTable(table QualifiedTableName) bool {
+	return ignoredSchemaChangeReason(table) != ""
+}
+
+// ignoredSchemaChangeReason returns why schema changes of the table are not
+// replicated, or an empty string if they are, see IsIgnoredSchemaChangeTable
+func ignoredSchemaChangeReason(table QualifiedTableName) string {
+	switch {
+	case systemSchemas[strings.ToLower(table.SchemaName)]:
+		return "system schema"
+	case ghostHelperTableRegexp.MatchString(table.TableName):
+		return OnlineSchemaChangeToolGhost + " helper table"
+	case ptOscHelperTableRegexp.MatchString(table.TableName):
+		return OnlineSchemaChangeToolPtOsc + " helper table"
+	}
+	return ""
+}
+
+// temporaryTableOfStatement returns the (first) table of a CREATE or DROP
+// TEMPORARY TABLE statement, or an empty string for any other statement
+func temporaryTableOfStatement(sqlStatement string) string {
+	tokens := strings.Fields(sqlStatement)
+	if len(tokens) < 4 || !(strings.EqualFold(tokens[0], "CREATE") || strings.EqualFold(tokens[0], "DROP")) || !strings.EqualFold(tokens[1], "TEMPORARY") || !strings.EqualFold(tokens[2], "TABLE") {
+		return ""
+	}
+
+	tokens = tokens[3:]
+	for len(tokens) > 1 && (strings.EqualFold(tokens[0], "IF") || strings.EqualFold(tokens[0], "NOT") || strings.EqualFold(tokens[0], "EXISTS")) {
+		tokens = tokens[1:]
+	}
+	return strings.TrimRight(strings.SplitN(tokens[0], "(", 2)[0], ",;")
+}
+
@@ -0,0 +1,116 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// QueryKiller kills the reads of the data copy in flight on the source once
+// the copy has been throttled for longer than the ThrottledFor of the
+// QueryKillerConfig, such that large SELECTs do not keep loading the source
+// while it is lagging. The cursors read the killed batches again once the
+// throttling ends.
+type QueryKiller struct {
+	Config    *QueryKillerConfig
+	Throttler Throttler
+	Registry  *sql.QueryRegistry
+
+	// Optional: defaults to running KILL QUERY on the DB
+	Kill func(connectionId uint64) error
+	DB   *sql.DB
+
+	throttledSince time.Time
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+func (f *Ferry) NewQueryKiller() *QueryKiller {
+	f.ensureInitialized()
+
+	return &QueryKiller{
+		Config:    &f.Config.QueryKiller,
+		Throttler: f.copyThrottler(),
+		Registry:  sql.NewQueryRegistry(),
+		DB:        f.componentDB(f.dataIteratorDB, f.SourceDB),
+		logger:    f.loggerFor("query_killer"),
+		metrics:   f.Metrics,
+	}
+}
+
+func (k *QueryKiller) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.Config.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			k.Check(now)
+		}
+	}
+}
+
+// Check kills the reads in flight if the copy has been throttled for long
+// enough at the given time, and returns the number of reads killed
+func (k *QueryKiller) Check(now time.Time) int {
+	if k.logger == nil {
+		k.logger = logrus.WithField("tag", "query_killer")
+	}
+
+	if k.Throttler.Disabled() || !k.Throttler.Throttled() {
+		k.throttledSince = time.Time{}
+		return 0
+	}
+
+	if k.throttledSince.IsZero() {
+		k.throttledSince = now
+	}
+	if now.Sub(k.throttledSince) < k.Config.throttledFor {
+		return 0
+	}
+
+	killed := 0
+	// the connections of the statements are only released once the kills
+	// are done, such that no statement reusing them is killed
+	k.Registry.WithRunning(func(queries []sql.RunningQuery) {
+		for _, query := range queries {
+			logger := k.logger.WithFields(logrus.Fields{
+				"connection_id": query.ConnectionId,
+				"query":         query.Description,
+				"running_for":   now.Sub(query.StartedAt).Round(time.Millisecond),
+			})
+
+			// the statement may complete in the meantime, in which case the
+			// connection is idle and nothing is killed
+			err := k.kill(query.ConnectionId)
+			if err != nil {
+				logger.WithError(err).Warn("failed to kill query")
+				continue
+			}
+
+			logger.Infof("killed query as the copy has been throttled since %v", k.throttledSince)
+			killed++
+		}
+	})
+
+	if killed > 0 {
+		k.metrics.Count("QueryKiller.Killed", int64(killed), nil, 1.0)
+	}
+
+	return killed
+}
+
+func (k *QueryKiller) kill(connectionId uint64) error {
+	if k.Kill != nil {
+		return k.Kill(connectionId)
+	}
+
+	_, err := k.DB.Exec(fmt.Sprintf("KILL QUERY %d", connectionId))
+	return err
+}
@@ -0,0 +1,326 @@
+package ghostferry
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	sqlorig "database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+// The platforms hosting a database. Amazon RDS and Aurora restrict what a
+// user can do on the server, which affects how Ghostferry connects and which
+// preflight checks apply:
+//
+//   - connections must use TLS, as the servers commonly enforce it
+//     (require_secure_transport), using the RDS CA bundle as TLS.CertPath or
+//     the system root certificates if it is installed there;
+//   - global variables can only be changed through the DB parameter group, as
+//     there is no SUPER privilege;
+//   - binlogs are purged as soon as possible unless a binlog retention is
+//     configured with mysql.rds_set_configuration;
+//   - Aurora only writes binlogs on the writer instance of a cluster, and only
+//     if binlog_format is set in the cluster parameter group, so readers
+//     cannot be used as the source.
+const (
+	PlatformMySQL  = "mysql"
+	PlatformRDS    = "rds"
+	PlatformAurora = "aurora"
+)
+
+// the lifetime of an IAM authentication token, as enforced by RDS
+const rdsAuthTokenExpiry = 15 * time.Minute
+
+type AWSCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// NewAWSCredentialsProvider returns the default credential chain of the AWS
+// SDK for the region: the environment variables, the shared credentials and
+// config files (AWS_PROFILE, including SSO and assumed roles), web identity
+// tokens (e.g. of an EKS service account), and the role of the ECS task or of
+// the EC2 instance. Temporary credentials are cached until they expire.
+func NewAWSCredentialsProvider(ctx context.Context, region string) (aws.CredentialsProvider, error) {
+	config, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %v", err)
+	}
+	return config.Credentials, nil
+}
+
+// RetrieveAWSCredentials returns the current credentials of the provider
+func RetrieveAWSCredentials(ctx context.Context, provider aws.CredentialsProvider) (AWSCredentials, error) {
+	credentials, err := provider.Retrieve(ctx)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to retrieve AWS credentials: %v", err)
+	}
+
+	return AWSCredentials{
+		AccessKeyId:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+	}, nil
+}
+
+// BuildRDSAuthToken generates an IAM authentication token for the user on
+// the database at endpoint (host:port), to be used as the password. The
+// token is a presigned URL, signed with AWS Signature Version 4 for the
+// rds-db service, and is valid for 15 minutes.
+func BuildRDSAuthToken(endpoint, region, user string, credentials AWSCredentials, now time.Time) string {
+	query := map[string]string{
+		"Action": "connect",
+		"DBUser": user,
+	}
+
+	emptyPayloadHash := sha256.Sum256(nil)
+	return PresignAWSURL(endpoint, "/", query, hex.EncodeToString(emptyPayloadHash[:]), region, "rds-db", credentials, now, rdsAuthTokenExpiry)
+}
+
+// PresignAWSURL returns the URL, without the scheme, of a GET request to the
+// path on the host, whose query is signed with AWS Signature Version 4 for
+// the service in the region and is valid for the expiry. The payload is
+// signed as the given hash, e.g. UNSIGNED-PAYLOAD. See SignAWSRequest for
+// signing requests with headers.
+func PresignAWSURL(host, path string, query map[string]string, payloadHash, region, service string, credentials AWSCredentials, now time.Time, expiry time.Duration) string {
+	now = now.UTC()
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+
+	signedQuery := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    credentials.AccessKeyId + "/" + scope,
+		"X-Amz-Date":          timestamp,
+		"X-Amz-Expires":       fmt.Sprintf("%d", int(expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if credentials.SessionToken != "" {
+		signedQuery["X-Amz-Security-Token"] = credentials.SessionToken
+	}
+	for key, value := range query {
+		signedQuery[key] = value
+	}
+
+	keys := make([]string, 0, len(signedQuery))
+	for key := range signedQuery {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, awsURIEncode(key)+"="+awsURIEncode(signedQuery[key]))
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		path,
+		canonicalQuery,
+		"host:" + host,
+		"",
+		"host",
+		payloadHash,
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		timestamp,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := AWSSigningKey(credentials, date, region, service)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("%s%s?%s&X-Amz-Signature=%s", host, path, canonicalQuery, signature)
+}
+
+// AWSSigningKey derives the key signing the requests to the service in the
+// region on the date, as required by AWS Signature Version 4
+func AWSSigningKey(credentials AWSCredentials, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode encodes a query string component as required by AWS
+// Signature Version 4, leaving only the unreserved characters of RFC 3986
+func awsURIEncode(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// rdsIAMAuthDriver opens MySQL connections with a new IAM authentication
+// token for every connection, as tokens expire after 15 minutes while the
+// connection pools of Ghostferry open connections throughout the run
+type rdsIAMAuthDriver struct {
+	region string
+
+	// loaded by the first connection, such that the credentials are cached
+	// across the connections
+	credentialsMutex sync.Mutex
+	credentials      aws.CredentialsProvider
+}
+
+func (d *rdsIAMAuthDriver) Open(dsn string) (driver.Conn, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := d.credentialsProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := RetrieveAWSCredentials(context.Background(), provider)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Passwd = BuildRDSAuthToken(cfg.Addr, d.region, cfg.User, credentials, time.Now())
+	return mysql.MySQLDriver{}.Open(cfg.FormatDSN())
+}
+
+func (d *rdsIAMAuthDriver) credentialsProvider() (aws.CredentialsProvider, error) {
+	d.credentialsMutex.Lock()
+	defer d.credentialsMutex.Unlock()
+
+	if d.credentials == nil {
+		provider, err := NewAWSCredentialsProvider(context.Background(), d.region)
+		if err != nil {
+			return nil, err
+		}
+		d.credentials = provider
+	}
+	return d.credentials, nil
+}
+
+var rdsIAMAuthDrivers sync.Map
+
+// rdsIAMAuthDriverFor returns the database/sql driver authenticating with IAM
+// tokens for the region, and its registered name. The driver is shared by
+// all connections to the region, registering it if needed.
+func rdsIAMAuthDriverFor(region string) (*rdsIAMAuthDriver, string) {
+	name := "mysql-rds-iam-" + region
+	d, loaded := rdsIAMAuthDrivers.LoadOrStore(name, &rdsIAMAuthDriver{region: region})
+	if !loaded {
+		sqlorig.Register(name, d.(*rdsIAMAuthDriver))
+	}
+	return d.(*rdsIAMAuthDriver), name
+}
+
+// setGlobalRemediation describes how to change a global variable on the
+// platform of the database
+func setGlobalRemediation(c *DatabaseConfig, variable, value, on string) string {
+	if c.IsRDS() {
+		return fmt.Sprintf("set %s to %s in the DB parameter group of the %s", variable, value, on)
+	}
+	return fmt.Sprintf("SET GLOBAL %s = %s on the %s", variable, value, on)
+}
+
+func checkRDSSource(report *PreflightReport, config *Config, db *sql.DB) {
+	if config.Source.Platform == PlatformAurora {
+		readOnly, err := queryVariable(db, "global.innodb_read_only")
+		if err != nil {
+			report.fail("aurora writer", err.Error(), "")
+		} else if readOnly == "1" || strings.ToUpper(readOnly) == "ON" {
+			report.fail("aurora writer", "the source is an Aurora reader instance, which does not write binlogs", "connect to the cluster (writer) endpoint of the Aurora cluster")
+		} else {
+			report.pass("aurora writer", "the source is the writer instance")
+		}
+	}
+
+	logBin, err := queryVariable(db, "global.log_bin")
+	if err != nil {
+		report.fail("log_bin", err.Error(), "")
+	} else if logBin != "1" && strings.ToUpper(logBin) != "ON" {
+		report.fail("log_bin", "binary logging is disabled on the source", "set binlog_format to ROW in the (cluster) parameter group and reboot the instance; on RDS, enable automated backups")
+	} else {
+		report.pass("log_bin", "enabled")
+	}
+
+	retention, err := rdsBinlogRetentionHours(db)
+	if err != nil {
+		report.warn("binlog retention", fmt.Sprintf("cannot read the RDS configuration: %s", err), "make sure binlog retention hours are configured with mysql.rds_set_configuration")
+	} else if retention == "" {
+		report.fail("binlog retention", "binlog retention hours are not set, so binlogs may be purged before they are streamed", "CALL mysql.rds_set_configuration('binlog retention hours', 24) on the source")
+	} else {
+		report.pass("binlog retention", fmt.Sprintf("%s hours", retention))
+	}
+}
+
+// rdsBinlogRetention returns the binlog retention hours of an RDS or Aurora
+// instance as a duration. Without them, the binlogs are purged as soon as
+// possible, which fails as no retention can be relied on.
+func rdsBinlogRetention(db *sql.DB) (time.Duration, error) {
+	value, err := rdsBinlogRetentionHours(db)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return 0, fmt.Errorf("binlog retention hours are not set, binlogs are purged as soon as possible")
+	}
+
+	hours, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing binlog retention hours %q: %v", value, err)
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
+
+// rdsBinlogRetentionHours returns the configured binlog retention of an RDS
+// or Aurora instance, or an empty string if it is not set
+func rdsBinlogRetentionHours(db *sql.DB) (string, error) {
+	rows, err := db.Query("CALL mysql.rds_show_configuration")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	for rows.Next() {
+		values := make([]sqlorig.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+
+		// the name, value and description of each setting
+		if len(values) >= 2 && values[0].String == "binlog retention hours" {
+			return values[1].String, nil
+		}
+	}
+
+	return "", rows.Err()
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"unsafe"
 
 	"github.com/Shopify/ghostferry"
@@ -20,10 +22,12 @@ func usage() {
 
 var verbose bool
 var dryrun bool
+var tui bool
 
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "Show verbose logging output")
-	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just connect and check settings")
+	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just run preflight checks on the database settings")
+	flag.BoolVar(&tui, "tui", false, "Show an interactive progress display on the terminal instead of logging output")
 }
 
 func errorAndExit(msg string) {
@@ -31,6 +35,23 @@ func errorAndExit(msg string) {
 	os.Exit(1)
 }
 
+// exitOnPanic exits once a goroutine of the ferry panicked and the state was
+// dumped, such that the run can be resumed from the dump
+func exitOnPanic(errorHandler ghostferry.ErrorHandler) {
+	panicErrorHandler, ok := errorHandler.(*ghostferry.PanicErrorHandler)
+	if !ok {
+		return
+	}
+
+	panics := panicErrorHandler.Panics()
+	go func() {
+		err := <-panics
+		fmt.Fprintf(os.Stderr, "error: %s\n", strings.SplitN(err.Error(), "\n", 2)[0])
+		panicErrorHandler.Ferry.CloseTunnels()
+		os.Exit(ghostferry.ExitCodeResumable)
+	}()
+}
+
 func hackString(b []byte) (s string) {
 	if len(b) == 0 {
 		return ""
@@ -80,8 +101,7 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to open config file: %v", err))
 	}
 
-	parser := json.NewDecoder(f)
-	err = parser.Decode(&config)
+	err = ghostferry.DecodeConfig(f, &config)
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to parse config file: %v", err))
 	}
@@ -91,12 +111,24 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to validate config: %v", err))
 	}
 
+	if dryrun {
+		report := ghostferry.RunPreflightChecks(config.Config)
+		fmt.Print(report)
+		if !report.Passed() {
+			errorAndExit("preflight checks failed")
+		}
+	}
+
 	ferry := replicatedb.NewFerry(config)
+	ferry.Ferry.ReloadTunables = func() (ghostferry.Tunables, error) {
+		return ghostferry.ReadTunablesFile(configFilePath)
+	}
 
 	err = ferry.Initialize()
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to initialize ferry: %v", err))
 	}
+	exitOnPanic(ferry.Ferry.ErrorHandler)
 
 	err = ferry.Start()
 	if err != nil {
@@ -104,9 +136,19 @@ func main() {
 	}
 
 	if dryrun {
+		if sizing := ferry.Ferry.SizingReport(); sizing != nil {
+			fmt.Print(sizing)
+		}
 		fmt.Println("exiting due to dryrun")
 		return
 	}
 
+	if tui {
+		display := ghostferry.NewProgressDisplay(ferry.Ferry, os.Stdout)
+		logrus.AddHook(display)
+		logrus.SetOutput(ioutil.Discard)
+		go display.Run(context.Background())
+	}
+
 	ferry.Run()
 }
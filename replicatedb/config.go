@@ -2,7 +2,11 @@ package replicatedb
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
+	"github.com/siddontang/go-mysql/mysql"
 )
 
 type Config struct {
@@ -10,6 +14,56 @@ type Config struct {
 
 	// Whitelisted databases that are considered fro replication
 	DatabaseWhitelist []string
+
+	// Pause the application of binlog events to the target on SIGUSR1, and
+	// resume it on SIGUSR2. While paused, the state (including the last
+	// written binlog position) is flushed to the StateFilename and/or the
+	// state tables on the target, and binlog events are buffered until the
+	// binlog writer buffer is full, after which streaming blocks.
+	//
+	// Optional: defaults to false
+	PauseOnSignal bool
+
+	// Apply the binlog events to the target only once they were written on
+	// the source at least this long ago, in the format of
+	// time.ParseDuration. This keeps a standby behind on purpose, like
+	// MySQL's MASTER_DELAY, such that accidental writes to the source can be
+	// recovered from the target. The state still tracks the position of the
+	// last event applied.
+	//
+	// The binlogs of the source must be retained for longer than the delay,
+	// and the LagAlert thresholds must account for it.
+	//
+	// Optional: defaults to applying the events immediately
+	ApplyDelay string
+
+	// Stop replicating right before the first transaction starting at or
+	// after this position of the source, and exit once all prior events were
+	// applied, leaving the target at this point in time of the source. The
+	// state is flushed to the StateFilename and/or the state tables on the
+	// target, such that replication can be resumed from there later.
+	//
+	// As replication stops at the start of the next transaction, it only
+	// stops once there is one.
+	//
+	// Optional: defaults to replicating until interrupted
+	StopAtBinlogPosition *mysql.Position
+
+	// Like StopAtBinlogPosition, but stop right before the first transaction
+	// written on the source after this time, in the format of RFC 3339 (e.g.
+	// 2006-01-02T15:04:05Z).
+	//
+	// Optional: defaults to replicating until interrupted
+	StopAtTimestamp string
+
+	// Stream a change log of the copied tables into BigQuery, alongside the
+	// target, see bigquery.Sink.
+	//
+	// Optional: defaults to disabled
+	BigQuerySink bigquery.Config
+
+	applyDelay time.Duration
+	stopAtTime time.Time
 }
 
 func (c *Config) InitializeAndValidateConfig() error {
@@ -22,12 +76,47 @@ func (c *Config) InitializeAndValidateConfig() error {
 	)
 
 	// due to limitations in our re-writing of schema alterations, we currently
-	// cannot support re-mapping of databases or tables! Just in case someone
+	// cannot support re-mapping of tables, and re-mapping of databases only
+	// with DDL rewrites! Just in case someone
 	// thinks the configs between different ghostferry tools (e.g., copydb
 	// versus replicatedb), we alert the user the that the config is not fully
 	//supported instead of just ignoring it
-	if len(c.DatabaseRewrites) + len(c.TableRewrites) > 0 {
-		return fmt.Errorf("Replicatedb does not allow database or table rewrites")
+	if len(c.TableRewrites) > 0 || (len(c.DatabaseRewrites) > 0 && c.DDLRewrites == nil) {
+		return fmt.Errorf("Replicatedb does not allow table rewrites, or database rewrites without DDLRewrites")
+	}
+
+	if c.ApplyDelay != "" {
+		var err error
+		c.applyDelay, err = time.ParseDuration(c.ApplyDelay)
+		if err != nil {
+			return fmt.Errorf("invalid ApplyDelay specified: %v", err)
+		}
+		if c.applyDelay < 0 {
+			return fmt.Errorf("invalid ApplyDelay specified (set to %s)", c.ApplyDelay)
+		}
+	}
+
+	if c.StopAtTimestamp != "" {
+		var err error
+		c.stopAtTime, err = time.Parse(time.RFC3339, c.StopAtTimestamp)
+		if err != nil {
+			return fmt.Errorf("invalid StopAtTimestamp specified: %v", err)
+		}
+	}
+
+	if c.StopAtBinlogPosition != nil || c.StopAtTimestamp != "" {
+		if c.DisableCutover {
+			return fmt.Errorf("StopAtBinlogPosition and StopAtTimestamp are incompatible with DisableCutover")
+		}
+
+		// the run ends once replication stopped
+		c.AutomaticCutover = true
+	}
+
+	if c.BigQuerySink.Enabled() {
+		if err := c.BigQuerySink.Validate(); err != nil {
+			return fmt.Errorf("BigQuerySink invalid: %v", err)
+		}
 	}
 
 	if err := c.Config.ValidateConfig(); err != nil {
@@ -1,7 +1,15 @@
 package replicatedb
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,7 +30,27 @@ func NewFerry(config *Config) *ReplicatedbFerry {
 }
 
 func (this *ReplicatedbFerry) Initialize() error {
-	return this.Ferry.Initialize()
+	if this.config.BigQuerySink.Enabled() {
+		sink, err := bigquery.NewSink(&this.config.BigQuerySink, this.config.Config, logrus.WithField("tag", "bigquery_sink"))
+		if err != nil {
+			return err
+		}
+		this.Ferry.Sink = sink
+	}
+
+	err := this.Ferry.Initialize()
+	if err != nil {
+		return err
+	}
+
+	this.Ferry.BinlogWriter.ApplyDelay = this.config.applyDelay
+	this.Ferry.BinlogStreamer.StopAtPosition = this.config.StopAtBinlogPosition
+	this.Ferry.BinlogStreamer.StopAtTime = this.config.stopAtTime
+	return nil
+}
+
+func (this *ReplicatedbFerry) stopsAtPointInTime() bool {
+	return this.config.StopAtBinlogPosition != nil || !this.config.stopAtTime.IsZero()
 }
 
 func (this *ReplicatedbFerry) Start() error {
@@ -32,5 +60,78 @@ func (this *ReplicatedbFerry) Start() error {
 func (this *ReplicatedbFerry) Run() {
 	logrus.Info("Running ghostferry replication")
 	logrus.Info("press CTRL+C or send an interrupt to end this process")
+
+	if this.config.applyDelay > 0 {
+		logrus.Infof("applying binlog events %v after they were written on the source", this.config.applyDelay)
+	}
+
+	if this.config.PauseOnSignal {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		logrus.Info("send SIGUSR1 to pause and SIGUSR2 to resume replication")
+		go this.handlePauseSignals(ctx)
+	}
+
+	if !this.stopsAtPointInTime() {
+		this.Ferry.Run()
+		return
+	}
+
+	var rowCopyCompletedAt time.Time
+	rowCopyCompleted := make(chan struct{})
+	go func() {
+		this.Ferry.WaitUntilRowCopyIsComplete()
+		rowCopyCompletedAt = time.Now()
+		close(rowCopyCompleted)
+	}()
+
 	this.Ferry.Run()
+	<-rowCopyCompleted
+
+	// the rows copied after replication stopped may be newer than the stop
+	// point, so the target would not be consistent
+	stoppedAt := this.Ferry.BinlogStreamer.StopPointReachedAt()
+	if !stoppedAt.IsZero() && stoppedAt.Before(rowCopyCompletedAt) {
+		this.Ferry.ErrorHandler.Fatal("replicatedb", fmt.Errorf("reached the stop point before the rows were copied"))
+	}
+
+	err := this.Ferry.FlushState()
+	if err != nil {
+		this.Ferry.ErrorHandler.Fatal("replicatedb", fmt.Errorf("failed to flush state: %v", err))
+	}
+
+	logrus.WithField("position", this.Ferry.StateTracker.LastWrittenBinlogPosition()).Info("stopped replication at the stop point")
+}
+
+func (this *ReplicatedbFerry) handlePauseSignals(ctx context.Context) {
+	logger := logrus.WithField("tag", "replicatedb")
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-c:
+			if s == syscall.SIGUSR2 {
+				this.Ferry.Resume()
+				continue
+			}
+
+			err := this.Ferry.Pause(ctx)
+			if err != nil {
+				logger.WithError(err).Error("failed to pause replication")
+				continue
+			}
+
+			fields := logrus.Fields{}
+			if this.Ferry.StateTracker != nil {
+				fields["position"] = this.Ferry.StateTracker.LastWrittenBinlogPosition()
+			}
+			logger.WithFields(fields).Info("paused replication, send SIGUSR2 to resume")
+		}
+	}
 }
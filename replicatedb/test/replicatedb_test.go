@@ -3,10 +3,12 @@ package test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/replicatedb"
 	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -47,6 +49,54 @@ func (t *ReplicatedbTestSuite) TearDownTest() {
 	t.Require().Nil(err)
 }
 
+func (t *ReplicatedbTestSuite) TestDelaysAppliedEvents() {
+	config := &replicatedb.Config{
+		Config:            testhelpers.NewTestConfig(),
+		DatabaseWhitelist: []string{testSchemaName},
+		ApplyDelay:        "1h",
+	}
+	t.Require().Nil(config.InitializeAndValidateConfig())
+
+	ferry := replicatedb.NewFerry(config)
+	t.Require().Nil(ferry.Initialize())
+	t.Require().Equal(time.Hour, ferry.Ferry.BinlogWriter.ApplyDelay)
+}
+
+func (t *ReplicatedbTestSuite) TestRejectsNegativeApplyDelay() {
+	config := &replicatedb.Config{
+		Config:            testhelpers.NewTestConfig(),
+		DatabaseWhitelist: []string{testSchemaName},
+		ApplyDelay:        "-1h",
+	}
+	t.Require().NotNil(config.InitializeAndValidateConfig())
+}
+
+func (t *ReplicatedbTestSuite) TestStopsAtPointInTime() {
+	position := &mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	config := &replicatedb.Config{
+		Config:               testhelpers.NewTestConfig(),
+		DatabaseWhitelist:    []string{testSchemaName},
+		StopAtBinlogPosition: position,
+		StopAtTimestamp:      "2020-01-02T03:04:05Z",
+	}
+	t.Require().Nil(config.InitializeAndValidateConfig())
+	t.Require().True(config.AutomaticCutover)
+
+	ferry := replicatedb.NewFerry(config)
+	t.Require().Nil(ferry.Initialize())
+	t.Require().Equal(position, ferry.Ferry.BinlogStreamer.StopAtPosition)
+	t.Require().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), ferry.Ferry.BinlogStreamer.StopAtTime.UTC())
+}
+
+func (t *ReplicatedbTestSuite) TestRejectsInvalidStopAtTimestamp() {
+	config := &replicatedb.Config{
+		Config:            testhelpers.NewTestConfig(),
+		DatabaseWhitelist: []string{testSchemaName},
+		StopAtTimestamp:   "yesterday",
+	}
+	t.Require().NotNil(config.InitializeAndValidateConfig())
+}
+
 func TestReplicatedb(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, &ReplicatedbTestSuite{})
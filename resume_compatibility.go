@@ -0,0 +1,210 @@
+package ghostferry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	ResumeConfigMismatchPolicyFail = "fail"
+	ResumeConfigMismatchPolicyWarn = "warn"
+)
+
+// ConfigFingerprinter is implemented by the TableFilter and CopyFilter whose
+// configuration is checked when resuming, see
+// Config.ResumeConfigMismatchPolicy
+type ConfigFingerprinter interface {
+	// ConfigFingerprint returns the configuration deciding what the filter
+	// selects, in a stable form
+	ConfigFingerprint() string
+}
+
+// ConfigFingerprint returns the hashes of the parts of the config deciding
+// which rows are copied where, by the name of the part
+func (f *Ferry) ConfigFingerprint() (map[string]string, error) {
+	parts := map[string]interface{}{
+		"DatabaseRewrites":                nonEmptyMap(f.Config.DatabaseRewrites),
+		"TableRewrites":                   nonEmptyMap(f.Config.TableRewrites),
+		"CascadingPaginationColumnConfig": f.Config.CascadingPaginationColumnConfig,
+	}
+	if filter, ok := f.TableFilter.(ConfigFingerprinter); ok {
+		parts["TableFilter"] = filter.ConfigFingerprint()
+	}
+	if filter, ok := f.CopyFilter.(ConfigFingerprinter); ok {
+		parts["CopyFilter"] = filter.ConfigFingerprint()
+	}
+
+	fingerprint := make(map[string]string)
+	for name, part := range parts {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprinting %s: %v", name, err)
+		}
+		hash := sha256.Sum256(data)
+		fingerprint[name] = hex.EncodeToString(hash[:])
+	}
+	return fingerprint, nil
+}
+
+// CheckConfigFingerprint compares the fingerprint of the config a resumed run
+// was started with to the current one, failing or warning on differences
+// according to Config.ResumeConfigMismatchPolicy
+func (f *Ferry) CheckConfigFingerprint(startedWith, current map[string]string) error {
+	logger := f.loggerFor("resume_compatibility")
+	if startedWith == nil {
+		logger.Info("resumed state has no config fingerprint, not checking the config for changes")
+		return nil
+	}
+
+	changedParts := make([]string, 0)
+	for name, hash := range current {
+		if startedWith[name] != hash {
+			changedParts = append(changedParts, name)
+		}
+	}
+	for name := range startedWith {
+		if _, found := current[name]; !found {
+			changedParts = append(changedParts, name)
+		}
+	}
+	if len(changedParts) == 0 {
+		return nil
+	}
+
+	sort.Strings(changedParts)
+	err := fmt.Errorf("config differs from the config the resumed run was started with: %s", strings.Join(changedParts, ", "))
+	if f.Config.ResumeConfigMismatchPolicy == ResumeConfigMismatchPolicyWarn {
+		logger.WithError(err).Warn("resuming despite the changed config, the copied data may be inconsistent")
+		return nil
+	}
+	return err
+}
+
+// initializeConfigFingerprint checks the config of a resumed run, and keeps
+// the fingerprint of the config the run was started with in the state. A run
+// that is not resumed replaces the fingerprint left in the target by an
+// earlier run.
+func (f *Ferry) initializeConfigFingerprint() error {
+	current, err := f.ConfigFingerprint()
+	if err != nil {
+		return err
+	}
+
+	storedInTargetDB := f.StateTracker.stateTablesPrefix != ""
+	if f.StateToResumeFrom != nil {
+		startedWith := f.StateToResumeFrom.ConfigFingerprint
+		if storedInTargetDB {
+			startedWith, err = f.readConfigFingerprint()
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = f.CheckConfigFingerprint(startedWith, current); err != nil {
+			return err
+		}
+
+		if startedWith != nil {
+			f.configFingerprint = startedWith
+			return nil
+		}
+	}
+
+	f.configFingerprint = current
+	if storedInTargetDB {
+		return f.storeConfigFingerprint(current)
+	}
+	return nil
+}
+
+func (f *Ferry) configFingerprintTable() string {
+	return f.StateTracker.stateTablesPrefix + "_config_fingerprint"
+}
+
+func (f *Ferry) createConfigFingerprintTable() error {
+	_, err := f.stateTablesDB().Exec(`
+CREATE TABLE IF NOT EXISTS ` + f.configFingerprintTable() + ` (
+    part varchar(255) CHARACTER SET ascii NOT NULL,
+    fingerprint char(64) CHARACTER SET ascii NOT NULL,
+    PRIMARY KEY (part)
+)`)
+	if err != nil {
+		return fmt.Errorf("creating config fingerprint table: %v", err)
+	}
+	return nil
+}
+
+// readConfigFingerprint returns the fingerprint stored next to the state
+// tables, or nil if there is none
+func (f *Ferry) readConfigFingerprint() (map[string]string, error) {
+	if err := f.createConfigFingerprintTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := f.stateTablesDB().Query("SELECT part, fingerprint FROM " + f.configFingerprintTable())
+	if err != nil {
+		return nil, fmt.Errorf("reading config fingerprint: %v", err)
+	}
+	defer rows.Close()
+
+	var fingerprint map[string]string
+	for rows.Next() {
+		var part, hash string
+		if err = rows.Scan(&part, &hash); err != nil {
+			return nil, fmt.Errorf("reading config fingerprint: %v", err)
+		}
+		if fingerprint == nil {
+			fingerprint = make(map[string]string)
+		}
+		fingerprint[part] = hash
+	}
+	return fingerprint, rows.Err()
+}
+
+// storeConfigFingerprint replaces the fingerprint stored next to the state
+// tables
+func (f *Ferry) storeConfigFingerprint(fingerprint map[string]string) error {
+	if err := f.createConfigFingerprintTable(); err != nil {
+		return err
+	}
+
+	query := squirrel.Insert(f.configFingerprintTable()).Columns("part", "fingerprint")
+	for part, hash := range fingerprint {
+		query = query.Values(part, hash)
+	}
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := f.stateTablesDB().Begin()
+	if err != nil {
+		return fmt.Errorf("storing config fingerprint: %v", err)
+	}
+	if _, err = tx.Exec("DELETE FROM " + f.configFingerprintTable()); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("storing config fingerprint: %v", err)
+	}
+	if _, err = tx.Exec(sqlStr, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("storing config fingerprint: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("storing config fingerprint: %v", err)
+	}
+	return nil
+}
+
+func nonEmptyMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,48 @@
+package ghostferry
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// requeueReverifyOnResume adds the pagination keys of the rows changed by the
+// binlog events between the resume position of the inline verifier and the
+// one of the binlog writer to the reverify store, if the inline verifier is
+// behind. These events were applied to the target already, but their rows
+// may be missing from the resumed reverify store, e.g. as the state was
+// dumped before the verifier stored them. It returns the position the binlog
+// streaming resumes from, after the events re-queued.
+func (f *Ferry) requeueReverifyOnResume() (BinlogPosition, error) {
+	nilPosition := BinlogPosition{}
+	writerPosition := f.StateToResumeFrom.LastWrittenBinlogPosition
+	verifierPosition := f.StateToResumeFrom.LastStoredBinlogPositionForInlineVerifier
+	if writerPosition == nilPosition || verifierPosition == nilPosition || verifierPosition.Compare(writerPosition) >= 0 {
+		return f.StateToResumeFrom.MinBinlogPosition(), nil
+	}
+
+	logger := f.loggerFor("resume_reverify").WithFields(logrus.Fields{
+		"from": verifierPosition.EventPosition,
+		"to":   writerPosition.EventPosition,
+	})
+	logger.Info("re-queueing the rows changed after the resume position of the inline verifier")
+
+	// a separate streamer, such that only the inline verifier receives the
+	// events, and it is done before the BinlogStreamer connects
+	streamer := f.NewBinlogStreamer()
+	streamer.AddEventListener(f.inlineVerifier.binlogEventListener)
+
+	_, err := streamer.ConnectBinlogStreamerToMysqlFrom(verifierPosition)
+	if err != nil {
+		return nilPosition, err
+	}
+
+	rowsBefore := f.inlineVerifier.reverifyStore.currentRowCount
+	streamer.targetBinlogPosition = writerPosition.EventPosition
+	streamer.stopRequested = true
+	streamer.Run()
+
+	requeued := f.inlineVerifier.reverifyStore.currentRowCount - rowsBefore
+	logger.WithField("rows", requeued).Info("re-queued the rows changed after the resume position of the inline verifier")
+	f.Metrics.Count("ResumeReverify.Requeued", int64(requeued), nil, 1.0)
+
+	return writerPosition, nil
+}
@@ -3,6 +3,8 @@ package ghostferry
 import (
 	"fmt"
 	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
 )
 
 type RowBatch interface {
@@ -23,15 +25,41 @@ type DataRowBatch struct {
 	values        []RowData
 	table         *TableSchema
 	fingerprints  map[uint64][]byte
+
+	// the schema of the table the values were read under, which differs
+	// from the one of the table once a schema change of the table was
+	// applied while the batch was in flight
+	readTable *schema.Table
 }
 
 func NewDataRowBatch(table *TableSchema, values []RowData) *DataRowBatch {
 	return &DataRowBatch{
-		values: values,
-		table:  table,
+		values:    values,
+		table:     table,
+		readTable: table.Table,
 	}
 }
 
+// ReadTableSchema returns the table with the schema the values of the batch
+// were read under, which the values are to be interpreted with
+func (e *DataRowBatch) ReadTableSchema() *TableSchema {
+	if e.readTable == e.table.Table {
+		return e.table
+	}
+
+	table := *e.table
+	table.Table = e.readTable
+	return &table
+}
+
+// withValues returns a batch of the same table with a subset of the values
+// of the batch, e.g. to write them in several statements
+func (e *DataRowBatch) withValues(values []RowData) *DataRowBatch {
+	batch := *e
+	batch.values = values
+	return &batch
+}
+
 func (e *DataRowBatch) Values() []RowData {
 	return e.values
 }
@@ -76,27 +104,59 @@ func (e *DataRowBatch) Fingerprints() map[uint64][]byte {
 }
 
 func (e *DataRowBatch) AsSQLQuery(schemaName, tableName string) (string, []interface{}, error) {
-	if err := verifyValuesHasTheSameLengthAsColumns(e.table, e.values...); err != nil {
+	readTable := e.ReadTableSchema()
+	if err := verifyValuesHasTheSameLengthAsColumns(readTable, e.values...); err != nil {
 		return "", nil, err
 	}
 
-	columns := quotedColumnNames(e.table)
+	columns := quotedColumnNames(readTable)
+	values := e.values
+	if readTable != e.table {
+		columns, values = e.projectToCurrentSchema()
+		if len(columns) == 0 {
+			return "", nil, fmt.Errorf("table %s no longer has any of the columns the batch was read with", e.table)
+		}
+	}
 
 	valuesStr := "(" + strings.Repeat("?,", len(columns)-1) + "?)"
-	valuesStr = strings.Repeat(valuesStr+",", len(e.values)-1) + valuesStr
+	valuesStr = strings.Repeat(valuesStr+",", len(values)-1) + valuesStr
 
 	query := "INSERT IGNORE INTO " +
 		QuotedTableNameFromString(schemaName, tableName) +
 		" (" + strings.Join(columns, ",") + ") VALUES " + valuesStr
 
-	return query, e.flattenRowData(), nil
+	return query, flattenRowData(values), nil
 }
 
-func (e *DataRowBatch) flattenRowData() []interface{} {
-	rowSize := len(e.values[0])
-	flattened := make([]interface{}, rowSize*len(e.values))
+// projectToCurrentSchema returns the columns the batch was read with that
+// the table still has, and the values of the rows for these columns. The
+// columns added since are left to their defaults.
+func (e *DataRowBatch) projectToCurrentSchema() ([]string, []RowData) {
+	indices := make([]int, 0, len(e.readTable.Columns))
+	columns := make([]string, 0, len(e.readTable.Columns))
+	for i, column := range e.readTable.Columns {
+		if e.table.FindColumn(column.Name) >= 0 {
+			indices = append(indices, i)
+			columns = append(columns, quoteField(column.Name))
+		}
+	}
 
+	values := make([]RowData, len(e.values))
 	for rowIdx, row := range e.values {
+		values[rowIdx] = make(RowData, len(indices))
+		for colIdx, index := range indices {
+			values[rowIdx][colIdx] = row[index]
+		}
+	}
+
+	return columns, values
+}
+
+func flattenRowData(values []RowData) []interface{} {
+	rowSize := len(values[0])
+	flattened := make([]interface{}, rowSize*len(values))
+
+	for rowIdx, row := range values {
 		for colIdx, col := range row {
 			flattened[rowIdx*rowSize+colIdx] = col
 		}
@@ -0,0 +1,239 @@
+package ghostferry
+
+import (
+	sqlorig "database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// the session variable collecting the rows affected by the statements of the
+// events of a batch, as index:rows pairs
+const rowsAffectedVariable = "@ghostferry_rows_affected"
+
+func (b *BinlogWriter) accountsRowsAffected() bool {
+	return b.RowsAffectedAccounting || b.checksUnmatchedDML()
+}
+
+// rowsAffectedRecord returns the statement recording the rows affected by the
+// statement right before it, for the event at the index in the batch
+func rowsAffectedRecord(index int) string {
+	return fmt.Sprintf("SET %s = CONCAT_WS(',', %s, CONCAT(%d, ':', ROW_COUNT()))", rowsAffectedVariable, rowsAffectedVariable, index)
+}
+
+// tableCompletions records the position of the source at which the tables
+// completed their copy, see expectedRowsAffected
+type tableCompletions struct {
+	mutex sync.Mutex
+	// nil if the position could not be looked up
+	positions map[string]*mysql.Position
+	// the position of the source when the run started, which the tables
+	// completed in a previous run completed before
+	runStart mysql.Position
+}
+
+// TrackTableCompletions records the position of the source at which each
+// table completes its copy from now on, which the rows affected are
+// accounted from
+func (b *BinlogWriter) TrackTableCompletions() error {
+	runStart, err := ShowMasterStatusBinlogPosition(b.SourceDB)
+	if err != nil {
+		return fmt.Errorf("looking up the position of the source: %v", err)
+	}
+
+	b.tableCompletions = &tableCompletions{
+		positions: make(map[string]*mysql.Position),
+		runStart:  runStart,
+	}
+	b.StateTracker.AddTableCompletionHook(b)
+	return nil
+}
+
+func (b *BinlogWriter) BeforeTableCompleted(table string) {}
+
+// AfterTableCompleted records the position of the source once the table
+// completed. The events written to the source after it are written after the
+// rows were read by the copy, while the events before may have been written
+// before, even if they are applied after.
+func (b *BinlogWriter) AfterTableCompleted(table string) {
+	var completedAt *mysql.Position
+	pos, err := ShowMasterStatusBinlogPosition(b.SourceDB)
+	if err != nil {
+		b.logger.WithError(err).WithField("table", table).Warn("failed to look up the position of the source the table completed at, not accounting its rows affected")
+	} else {
+		completedAt = &pos
+	}
+
+	b.tableCompletions.mutex.Lock()
+	defer b.tableCompletions.mutex.Unlock()
+	b.tableCompletions.positions[table] = completedAt
+}
+
+// tableCompletedBefore returns whether the table completed its copy before
+// the event was written to the source. The stream-only tables never did, as
+// their rows are written by other means at any time.
+func (b *BinlogWriter) tableCompletedBefore(table string, pos BinlogPosition) bool {
+	if b.StateTracker == nil || b.tableCompletions == nil || !b.StateTracker.IsTableComplete(table) {
+		return false
+	}
+	if b.StateTracker.IsTableStreamOnly(table) {
+		return false
+	}
+
+	b.tableCompletions.mutex.Lock()
+	completedAt, completedInRun := b.tableCompletions.positions[table]
+	b.tableCompletions.mutex.Unlock()
+
+	if !completedInRun {
+		return pos.EventPosition.Compare(b.tableCompletions.runStart) > 0
+	}
+	return completedAt != nil && pos.EventPosition.Compare(*completedAt) > 0
+}
+
+// renameTableCompletion moves the completion of a renamed table to its new
+// name, see RenameTable
+func (b *BinlogWriter) renameTableCompletion(from, to string) {
+	if b.tableCompletions == nil {
+		return
+	}
+
+	b.tableCompletions.mutex.Lock()
+	defer b.tableCompletions.mutex.Unlock()
+
+	delete(b.tableCompletions.positions, to)
+	if completedAt, found := b.tableCompletions.positions[from]; found {
+		b.tableCompletions.positions[to] = completedAt
+		delete(b.tableCompletions.positions, from)
+	}
+}
+
+// expectedRowsAffected returns the number of rows applying the event must
+// affect on the target. It is only known for the events written to the
+// source after the table completed its copy, as the events of rows not
+// copied yet affect no rows by design, and the events written before may
+// already be reflected by the rows the copy read, e.g. a DELETE of a row the
+// copy never saw, or an INSERT of a row the copy inserted.
+func (b *BinlogWriter) expectedRowsAffected(ev DMLEvent) (int64, bool) {
+	if !b.tableCompletedBefore(ev.TableSchema().String(), ev.BinlogPosition()) {
+		return 0, false
+	}
+
+	switch e := ev.(type) {
+	case *BinlogUpdateEvent:
+		// an update setting the values the row has already changes no rows
+		if !e.changesRow() {
+			return 0, true
+		}
+		return 1, true
+	case *BinlogInsertEvent, *BinlogDeleteEvent:
+		return 1, true
+	default:
+		return 0, false
+	}
+}
+
+// execAccountingRowsAffected applies the statements of the batch of events in
+// a transaction, and compares the rows affected recorded by their
+// rowsAffectedRecord with the expected ones before committing. The UPDATEs
+// and DELETEs that changed no rows though expected to are handled according
+// to the UnmatchedDMLPolicy.
+func (b *BinlogWriter) execAccountingRowsAffected(statements string, args []interface{}, events []DXLEventWrapper) error {
+	tx, err := b.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(fmt.Sprintf("SET %s = NULL", rowsAffectedVariable)); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(statements, args...); err != nil {
+		return err
+	}
+
+	var recorded sqlorig.NullString
+	if err = tx.QueryRow(fmt.Sprintf("SELECT %s", rowsAffectedVariable)).Scan(&recorded); err != nil {
+		return fmt.Errorf("reading the rows affected: %v", err)
+	}
+
+	var total, anomalies int64
+	for _, pair := range strings.Split(recorded.String, ",") {
+		if pair == "" {
+			continue
+		}
+
+		index, rowsAffected, err := parseRowsAffected(pair)
+		if err != nil || index >= len(events) {
+			return fmt.Errorf("invalid rows affected recorded %q", pair)
+		}
+		ev := events[index].DXLEvent.(DMLEvent)
+		total += rowsAffected
+
+		expected, known := b.expectedRowsAffected(ev)
+		if !known || rowsAffected == expected {
+			continue
+		}
+		anomalies++
+
+		kind := "fewer"
+		if rowsAffected > expected {
+			kind = "more"
+		}
+		b.metrics.Count("BinlogWriter.RowsAffectedAnomaly", 1, []MetricTag{
+			{Name: "table", Value: ev.TableSchema().String()},
+			{Name: "type", Value: dmlStatementType(ev)},
+			{Name: "kind", Value: kind},
+		}, 1.0)
+
+		if _, isInsert := ev.(*BinlogInsertEvent); rowsAffected == 0 && !isInsert && b.checksUnmatchedDML() {
+			if err = b.handleUnmatchedDML(tx, ev); err != nil {
+				return err
+			}
+			continue
+		}
+
+		b.logger.WithField("table", ev.TableSchema().String()).Warnf("%s at %v affected %d rows on the target instead of %d", dmlStatementType(ev), ev.BinlogPosition(), rowsAffected, expected)
+	}
+
+	b.metrics.Count("BinlogWriter.RowsAffected", total, b.MetricTags, 1.0)
+	b.logger.Debugf("Applied %d binlog events affecting %d rows on the target, %d differing from the expected", len(events), total, anomalies)
+
+	err = tx.Commit()
+	tx = nil
+	return err
+}
+
+func parseRowsAffected(pair string) (int, int64, error) {
+	parts := strings.SplitN(pair, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("missing separator")
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	rowsAffected, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return index, rowsAffected, nil
+}
+
+func dmlStatementType(ev DMLEvent) string {
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		return "INSERT"
+	case *BinlogUpdateEvent:
+		return "UPDATE"
+	default:
+		return "DELETE"
+	}
+}
@@ -0,0 +1,135 @@
+package ghostferry
+
+import (
+	"context"
+	"crypto/sha1"
+	sqlorig "database/sql"
+	"fmt"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// RunLock is an advisory lock on the target held for the duration of a run,
+// see Config.RunLock. MySQL releases the lock when the connection holding it
+// is closed, so a crashed ferry does not leave the lock behind.
+type RunLock struct {
+	Name string
+
+	// How often Run checks that the lock is still held
+	CheckInterval time.Duration
+
+	// Notified by Run once the lock is lost
+	ErrorHandler ErrorHandler
+
+	conn   *sqlorig.Conn
+	logger *logrus.Entry
+}
+
+// DefaultRunLockName derives the name of the lock from the addresses of the
+// source and the target, hashed to fit the 64 characters allowed by MySQL.
+func DefaultRunLockName(source, target *DatabaseConfig) string {
+	hash := sha1.Sum([]byte(source.Address() + "/" + target.Address()))
+	return fmt.Sprintf("ghostferry_%x", hash)
+}
+
+// AcquireRunLock acquires the lock with the given name on a dedicated
+// connection of the db, without waiting for it. It fails if the lock is held
+// by another session, i.e. another ferry is running.
+func AcquireRunLock(db *sql.DB, name string, logger *logrus.Entry) (*RunLock, error) {
+	if logger == nil {
+		logger = logrus.WithField("tag", "run_lock")
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connection is idle for the whole run and must not time out, as
+	// this would silently release the lock
+	_, err = conn.ExecContext(ctx, "SET SESSION wait_timeout = 31536000")
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set wait_timeout of the run lock session: %v", err)
+	}
+
+	var acquired sqlorig.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire run lock %s: %v", name, err)
+	}
+
+	if !acquired.Valid || acquired.Int64 != 1 {
+		var holder sqlorig.NullInt64
+		conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?)", name).Scan(&holder)
+		conn.Close()
+		return nil, fmt.Errorf("run lock %s is held by connection %d on the target, another ghostferry is running", name, holder.Int64)
+	}
+
+	logger.WithField("name", name).Info("acquired run lock")
+	return &RunLock{
+		Name:   name,
+		conn:   conn,
+		logger: logger,
+	}, nil
+}
+
+// Run periodically checks the lock until the context is done, and aborts the
+// run with a fatal error once the lock is lost. MySQL releases the lock when
+// its connection drops, after which another ferry could start, and
+// reconnecting does not reacquire it.
+func (l *RunLock) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Check(ctx); err != nil && ctx.Err() == nil {
+				l.ErrorHandler.Fatal("run_lock", err)
+				return
+			}
+		}
+	}
+}
+
+// Check returns an error if the lock is no longer held by its connection
+func (l *RunLock) Check(ctx context.Context) error {
+	if l.conn == nil {
+		return fmt.Errorf("run lock %s was released", l.Name)
+	}
+
+	var held sqlorig.NullInt64
+	err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.Name).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("lost the connection holding run lock %s: %v", l.Name, err)
+	}
+	if !held.Valid || held.Int64 != 1 {
+		return fmt.Errorf("run lock %s is no longer held", l.Name)
+	}
+
+	return nil
+}
+
+// Release releases the lock and closes its connection
+func (l *RunLock) Release() error {
+	if l.conn == nil {
+		return nil
+	}
+
+	_, err := l.conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", l.Name)
+	l.conn.Close()
+	l.conn = nil
+	if err != nil {
+		return fmt.Errorf("failed to release run lock %s: %v", l.Name, err)
+	}
+
+	l.logger.WithField("name", l.Name).Info("released run lock")
+	return nil
+}
@@ -0,0 +1,478 @@
+package ghostferry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TableSamplingReport summarizes the verification of the sampled ranges of a
+// table by the SamplingVerifier.
+type TableSamplingReport struct {
+	Table string
+
+	// The ranges of pagination keys of the table, and how many of them were
+	// sampled
+	Ranges        uint64
+	SampledRanges uint64
+
+	// The rows in the sampled ranges on the source or the target, and those
+	// of them still differing during the cutover
+	SampledRows    uint64
+	MismatchedRows uint64
+
+	// The rate of mismatched rows observed, and its confidence interval at
+	// the ConfidenceLevel
+	MismatchRate      float64
+	MismatchRateLower float64
+	MismatchRateUpper float64
+}
+
+// samplingRange is a range of pagination keys, from start up to but
+// excluding end
+type samplingRange struct {
+	start uint64
+	end   uint64
+}
+
+// SamplingVerifier verifies the rows of a random sample of ranges of
+// pagination keys of each table, for tables too large to be verified
+// completely. The sampled rows found to differ before the cutover, and the
+// rows changed by binlog events since, are verified again during the
+// cutover, like by the IterativeVerifier it builds on.
+//
+// The mismatch rates are estimated with Wilson score intervals, treating the
+// sampled rows as independent, which they are not within a range: the
+// intervals are too narrow if mismatches cluster.
+type SamplingVerifier struct {
+	*SamplingVerifierConfig
+
+	// The tables, columns and databases to verify, and how rows are
+	// compared, see Ferry.NewIterativeVerifier
+	Iterative *IterativeVerifier
+
+	sampledRanges map[string][]samplingRange
+	reports       map[string]*TableSamplingReport
+	reportsMutex  sync.Mutex
+
+	logger *logrus.Entry
+
+	verificationResultAndStatus VerificationResultAndStatus
+	verificationErr             error
+	backgroundVerificationWg    *sync.WaitGroup
+}
+
+func (f *Ferry) NewSamplingVerifier() (*SamplingVerifier, error) {
+	iterative, err := f.NewIterativeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SamplingVerifier{
+		SamplingVerifierConfig: &f.Config.SamplingVerifierConfig,
+		Iterative:              iterative,
+		logger:                 f.loggerFor("sampling_verifier"),
+	}, nil
+}
+
+// VerifyBeforeCutover verifies the sampled ranges of all tables, the rows
+// differing are verified again during the cutover
+func (v *SamplingVerifier) VerifyBeforeCutover() error {
+	if v.logger == nil {
+		v.logger = logrus.WithField("tag", "sampling_verifier")
+	}
+
+	seed := v.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	v.logger.WithFields(logrus.Fields{
+		"seed":       seed,
+		"percentage": v.SamplePercentage,
+		"range_size": v.RangeSize,
+	}).Info("starting sampled verification")
+
+	v.Iterative.attachBinlogEventListener()
+
+	// sampled upfront, such that the sample only depends on the seed
+	rng := rand.New(rand.NewSource(seed))
+	tables := make([]*TableSchema, 0, len(v.Iterative.Tables))
+	v.sampledRanges = make(map[string][]samplingRange)
+	v.reports = make(map[string]*TableSamplingReport)
+	for _, table := range v.Iterative.Tables {
+		if v.Iterative.tableIsIgnored(table) {
+			continue
+		}
+
+		report, ranges, err := v.sampleTable(table, rng)
+		if err != nil {
+			return fmt.Errorf("sampling ranges of %s: %v", table, err)
+		}
+		v.reports[table.String()] = report
+		v.sampledRanges[table.String()] = ranges
+		tables = append(tables, table)
+	}
+
+	pool := &WorkerPool{
+		Concurrency:  v.Iterative.Concurrency,
+		ErrorHandler: v.Iterative.ErrorHandler,
+		Process: func(tableIndex int) (interface{}, error) {
+			table := tables[tableIndex]
+			err := v.verifySampledRanges(table)
+			if err != nil {
+				v.logger.WithError(err).WithField("table", table.String()).Error("error occured during sampled verification")
+			}
+			return nil, err
+		},
+	}
+
+	_, err := pool.Run(len(tables))
+	if err == nil {
+		// the rows differing because of ongoing writes are re-added to the
+		// store, as by the IterativeVerifier
+		err = v.Iterative.reverifyUntilStoreIsSmallEnough(30)
+	}
+
+	v.logger.Info("sampled verification before cutover complete")
+	v.Iterative.beforeCutoverVerifyDone = true
+
+	return err
+}
+
+// VerifyDuringCutover verifies the rows differing before the cutover and the
+// rows changed since again, and reports the mismatch rates of the samples
+func (v *SamplingVerifier) VerifyDuringCutover() (VerificationResult, error) {
+	v.logger.Info("starting sampled verification during cutover")
+	v.Iterative.verifyDuringCutoverStarted.Set(true)
+
+	mismatches, err := v.reverifyStore()
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	incorrectTables := make([]string, 0)
+	for tableName, paginationKeys := range mismatches {
+		if len(paginationKeys) > 0 {
+			incorrectTables = append(incorrectTables, tableName)
+		}
+	}
+	sort.Strings(incorrectTables)
+
+	for tableName, report := range v.Reports() {
+		report.MismatchedRows = 0
+		for _, paginationKey := range mismatches[tableName] {
+			if v.inSampledRange(tableName, paginationKey) {
+				report.MismatchedRows++
+			}
+		}
+		report.MismatchRate, report.MismatchRateLower, report.MismatchRateUpper = MismatchRateInterval(report.MismatchedRows, report.SampledRows, v.ConfidenceLevel)
+
+		tags := []MetricTag{{Name: "table", Value: tableName}}
+		v.Iterative.metrics.Gauge("SamplingVerifier.MismatchRate", report.MismatchRate, tags, 1.0)
+		v.Iterative.metrics.Gauge("SamplingVerifier.MismatchRateUpper", report.MismatchRateUpper, tags, 1.0)
+
+		v.logger.WithFields(logrus.Fields{
+			"table":           tableName,
+			"sampled_ranges":  fmt.Sprintf("%d/%d", report.SampledRanges, report.Ranges),
+			"sampled_rows":    report.SampledRows,
+			"mismatched_rows": report.MismatchedRows,
+			"mismatch_rate":   report.MismatchRate,
+			"confidence":      fmt.Sprintf("[%g, %g] at %g", report.MismatchRateLower, report.MismatchRateUpper, v.ConfidenceLevel),
+		}).Info("sampled verification of table complete")
+	}
+
+	v.logger.Info("sampled verification during cutover complete")
+
+	if len(incorrectTables) > 0 {
+		return VerificationResult{
+			DataCorrect:     false,
+			Message:         fmt.Sprintf("sampled verification failed on tables: %s", strings.Join(incorrectTables, ", ")),
+			IncorrectTables: incorrectTables,
+		}, nil
+	}
+	return NewCorrectVerificationResult(), nil
+}
+
+// Reports returns the reports of the sampled tables, with the mismatches
+// once the verification during the cutover is done
+func (v *SamplingVerifier) Reports() map[string]*TableSamplingReport {
+	v.reportsMutex.Lock()
+	defer v.reportsMutex.Unlock()
+
+	reports := make(map[string]*TableSamplingReport, len(v.reports))
+	for table, report := range v.reports {
+		reports[table] = report
+	}
+	return reports
+}
+
+func (v *SamplingVerifier) StartInBackground() error {
+	if !v.Iterative.beforeCutoverVerifyDone {
+		return errors.New("VerifyBeforeCutover() must be called before this")
+	}
+
+	if v.Iterative.verifyDuringCutoverStarted.Get() {
+		return errors.New("verification during cutover has already been started")
+	}
+
+	v.verificationResultAndStatus = VerificationResultAndStatus{
+		StartTime: time.Now(),
+		DoneTime:  time.Time{},
+	}
+	v.verificationErr = nil
+	v.backgroundVerificationWg = &sync.WaitGroup{}
+
+	v.logger.Info("starting sampled verification in the background")
+
+	v.backgroundVerificationWg.Add(1)
+	go func() {
+		defer v.backgroundVerificationWg.Done()
+		defer RecoverPanic("sampling_verifier", v.Iterative.ErrorHandler)
+
+		v.verificationResultAndStatus.VerificationResult, v.verificationErr = v.VerifyDuringCutover()
+		v.verificationResultAndStatus.DoneTime = time.Now()
+	}()
+
+	return nil
+}
+
+func (v *SamplingVerifier) Wait() {
+	v.backgroundVerificationWg.Wait()
+}
+
+func (v *SamplingVerifier) Result() (VerificationResultAndStatus, error) {
+	return v.verificationResultAndStatus, v.verificationErr
+}
+
+// sampleTable picks the ranges of the table to verify, between its minimum
+// and maximum pagination keys on the source
+func (v *SamplingVerifier) sampleTable(table *TableSchema, rng *rand.Rand) (*TableSamplingReport, []samplingRange, error) {
+	report := &TableSamplingReport{Table: table.String()}
+
+	column := quoteField(table.PaginationKey.Columns[0].Name)
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", column, column, QuotedTableName(table))
+	var minKey, maxKey *uint64
+	if err := v.Iterative.SourceDB.QueryRow(query).Scan(&minKey, &maxKey); err != nil {
+		return nil, nil, err
+	}
+	if minKey == nil || maxKey == nil {
+		return report, nil, nil
+	}
+
+	report.Ranges = (*maxKey-*minKey)/v.RangeSize + 1
+	report.SampledRanges = uint64(math.Ceil(float64(report.Ranges) * v.SamplePercentage / 100))
+	if report.SampledRanges > report.Ranges {
+		report.SampledRanges = report.Ranges
+	}
+
+	indices := SampleRangeIndices(rng, report.Ranges, report.SampledRanges)
+	ranges := make([]samplingRange, len(indices))
+	for i, index := range indices {
+		start := *minKey + index*v.RangeSize
+		ranges[i] = samplingRange{start: start, end: start + v.RangeSize}
+	}
+	return report, ranges, nil
+}
+
+// SampleRangeIndices picks the given number of distinct indices out of
+// count, sorted
+func SampleRangeIndices(rng *rand.Rand, count, sampled uint64) []uint64 {
+	indices := make([]uint64, 0, sampled)
+	switch {
+	case sampled >= count:
+		for i := uint64(0); i < count; i++ {
+			indices = append(indices, i)
+		}
+		return indices
+	case count <= 1<<20:
+		for _, i := range rng.Perm(int(count))[:sampled] {
+			indices = append(indices, uint64(i))
+		}
+	default:
+		picked := make(map[uint64]bool, sampled)
+		for uint64(len(indices)) < sampled {
+			i := uint64(rng.Int63n(int64(count)))
+			if !picked[i] {
+				picked[i] = true
+				indices = append(indices, i)
+			}
+		}
+	}
+
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
+}
+
+// verifySampledRanges compares the rows in the sampled ranges of the table
+// on the source and the target, adding the differing ones to the rows
+// verified again
+func (v *SamplingVerifier) verifySampledRanges(table *TableSchema) error {
+	report := v.Reports()[table.String()]
+
+	for _, r := range v.sampledRanges[table.String()] {
+		sourceKeys, err := v.rangePaginationKeys(v.Iterative.CursorConfig, table, r)
+		if err != nil {
+			return err
+		}
+
+		targetCursorConfig := *v.Iterative.CursorConfig
+		targetCursorConfig.DB = v.Iterative.TargetDB
+		targetKeys, err := v.rangePaginationKeys(&targetCursorConfig, v.Iterative.targetTable(table), r)
+		if err != nil {
+			return err
+		}
+
+		keySet := make(map[uint64]struct{}, len(sourceKeys))
+		for _, paginationKey := range append(sourceKeys, targetKeys...) {
+			keySet[paginationKey] = struct{}{}
+		}
+		paginationKeys := make([]uint64, 0, len(keySet))
+		for paginationKey := range keySet {
+			paginationKeys = append(paginationKeys, paginationKey)
+		}
+
+		v.reportsMutex.Lock()
+		report.SampledRows += uint64(len(paginationKeys))
+		v.reportsMutex.Unlock()
+
+		if len(paginationKeys) == 0 {
+			continue
+		}
+
+		v.Iterative.metrics.Count("RowEvent", int64(len(paginationKeys)), []MetricTag{
+			{Name: "table", Value: table.Name},
+			{Name: "source", Value: "sampling_verifier_before_cutover"},
+		}, 1.0)
+
+		mismatchedPaginationKeys, err := v.Iterative.compareFingerprints(paginationKeys, table)
+		if err != nil {
+			return err
+		}
+
+		if len(mismatchedPaginationKeys) > 0 {
+			v.logger.WithFields(logrus.Fields{
+				"table":                     table.String(),
+				"mismatched_paginationKeys": mismatchedPaginationKeys,
+			}).Info("found mismatched rows")
+
+			for _, paginationKey := range mismatchedPaginationKeys {
+				v.Iterative.reverifyStore.Add(ReverifyEntry{PaginationKey: paginationKey, Table: table})
+			}
+		}
+	}
+
+	return nil
+}
+
+// rangePaginationKeys returns the pagination keys of the rows of the table in
+// the range, as selected by the cursors of the config
+func (v *SamplingVerifier) rangePaginationKeys(cursorConfig *CursorConfig, table *TableSchema, r samplingRange) ([]uint64, error) {
+	// the cursor starts after the start key, up to and including the max key
+	startPaginationKey, err := UnmarshalPaginationKeyData(&PaginationKeyData{Values: RowData{int64(r.start) - 1}}, table)
+	if err != nil {
+		return nil, err
+	}
+	maxPaginationKey, err := UnmarshalPaginationKeyData(&PaginationKeyData{Values: RowData{int64(r.end) - 1}}, table)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := cursorConfig.NewPaginatedCursorWithoutRowLock(table, startPaginationKey, maxPaginationKey, nil)
+	cursor.ColumnsToSelect = []string{quoteField(table.PaginationKey.Columns[0].Name)}
+
+	paginationKeys := make([]uint64, 0)
+	err = cursor.Each(func(rowBatch RowBatch) error {
+		batch, ok := rowBatch.(InsertRowBatch)
+		if !ok {
+			return nil
+		}
+
+		for i := range batch.Values() {
+			paginationKey, err := batch.VerifierPaginationKey(i)
+			if err != nil {
+				return err
+			}
+			// the last batch may reach beyond the range
+			if paginationKey < r.end {
+				paginationKeys = append(paginationKeys, paginationKey)
+			}
+		}
+		return nil
+	})
+	return paginationKeys, err
+}
+
+// reverifyStore verifies the rows of the reverify store, returning the
+// pagination keys still differing by table
+func (v *SamplingVerifier) reverifyStore() (map[string][]uint64, error) {
+	batches := v.Iterative.reverifyStore.FlushAndBatchByTable(int(v.Iterative.CursorConfig.BatchSize))
+	mismatches := make(map[string][]uint64)
+	mismatchesMutex := &sync.Mutex{}
+
+	pool := &WorkerPool{
+		Concurrency:  v.Iterative.Concurrency,
+		ErrorHandler: v.Iterative.ErrorHandler,
+		Process: func(batchIndex int) (interface{}, error) {
+			batch := batches[batchIndex]
+			table := v.Iterative.TableSchemaCache.Get(batch.Table.SchemaName, batch.Table.TableName)
+			if table == nil || v.Iterative.Quarantine.Contains(table.String()) {
+				return nil, nil
+			}
+
+			v.Iterative.metrics.Count("RowEvent", int64(len(batch.PaginationKeys)), []MetricTag{
+				{Name: "table", Value: table.Name},
+				{Name: "source", Value: "sampling_verifier_during_cutover"},
+			}, 1.0)
+
+			mismatchedPaginationKeys, err := v.Iterative.compareFingerprints(batch.PaginationKeys, table)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(mismatchedPaginationKeys) > 0 {
+				v.logger.WithFields(logrus.Fields{
+					"table":                     table.String(),
+					"mismatched_paginationKeys": mismatchedPaginationKeys,
+				}).Error("rows differ during cutover")
+
+				mismatchesMutex.Lock()
+				mismatches[table.String()] = append(mismatches[table.String()], mismatchedPaginationKeys...)
+				mismatchesMutex.Unlock()
+			}
+			return nil, nil
+		},
+	}
+
+	_, err := pool.Run(len(batches))
+	return mismatches, err
+}
+
+func (v *SamplingVerifier) inSampledRange(table string, paginationKey uint64) bool {
+	ranges := v.sampledRanges[table]
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].end > paginationKey })
+	return i < len(ranges) && ranges[i].start <= paginationKey
+}
+
+// MismatchRateInterval returns the observed rate of mismatches out of the
+// rows verified, and its Wilson score interval at the confidence level
+func MismatchRateInterval(mismatches, rows uint64, confidenceLevel float64) (rate, lower, upper float64) {
+	if rows == 0 {
+		return 0, 0, 1
+	}
+
+	n := float64(rows)
+	rate = float64(mismatches) / n
+	z := math.Sqrt2 * math.Erfinv(confidenceLevel)
+
+	denominator := 1 + z*z/n
+	center := (rate + z*z/(2*n)) / denominator
+	margin := z * math.Sqrt(rate*(1-rate)/n+z*z/(4*n*n)) / denominator
+	return rate, math.Max(0, center-margin), math.Min(1, center+margin)
+}
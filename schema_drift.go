@@ -0,0 +1,224 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+)
+
+const (
+	SchemaDriftActionFail   = "fail"
+	SchemaDriftActionWarn   = "warn"
+	SchemaDriftActionIgnore = "ignore"
+)
+
+type ColumnDefinition struct {
+	Type     string
+	Charset  string
+	Nullable bool
+}
+
+type IndexDefinition struct {
+	Unique  bool
+	Columns []string
+}
+
+// TableDefinition is the subset of a table's schema that must match between
+// source and target for rows to be copied faithfully.
+type TableDefinition struct {
+	ColumnOrder []string
+	Columns     map[string]ColumnDefinition
+	Indexes     map[string]IndexDefinition
+}
+
+type SchemaDrift struct {
+	SourceTable string
+	TargetTable string
+	Differences []string
+}
+
+func (d SchemaDrift) String() string {
+	return fmt.Sprintf("%s -> %s: %s", d.SourceTable, d.TargetTable, strings.Join(d.Differences, "; "))
+}
+
+type SchemaDriftError struct {
+	Drifts []SchemaDrift
+}
+
+func (e SchemaDriftError) Error() string {
+	descriptions := make([]string, len(e.Drifts))
+	for i, drift := range e.Drifts {
+		descriptions[i] = drift.String()
+	}
+	return fmt.Sprintf("schema of %d tables differs between source and target: %s", len(e.Drifts), strings.Join(descriptions, ", "))
+}
+
+// DetectSchemaDrift compares the definition of the given source tables with
+// the corresponding (possibly renamed) tables on the target.
+func DetectSchemaDrift(sourceDB, targetDB *sql.DB, tables []*TableSchema, databaseRewrites, tableRewrites map[string]string) ([]SchemaDrift, error) {
+	drifts := make([]SchemaDrift, 0)
+
+	for _, table := range tables {
+		targetSchemaName := table.Schema
+		if rewrite, exists := databaseRewrites[targetSchemaName]; exists {
+			targetSchemaName = rewrite
+		}
+		targetTableName := table.Name
+		if rewrite, exists := tableRewrites[targetTableName]; exists {
+			targetTableName = rewrite
+		}
+
+		sourceDefinition, err := LoadTableDefinition(sourceDB, table.Schema, table.Name)
+		if err != nil {
+			return nil, fmt.Errorf("loading definition of %s from source: %v", table.String(), err)
+		}
+
+		targetDefinition, err := LoadTableDefinition(targetDB, targetSchemaName, targetTableName)
+		if err != nil {
+			return nil, fmt.Errorf("loading definition of %s.%s from target: %v", targetSchemaName, targetTableName, err)
+		}
+
+		var differences []string
+		if len(targetDefinition.Columns) == 0 {
+			differences = []string{"table does not exist on target"}
+		} else {
+			differences = DiffTableDefinitions(sourceDefinition, targetDefinition)
+		}
+
+		if len(differences) > 0 {
+			drifts = append(drifts, SchemaDrift{
+				SourceTable: table.String(),
+				TargetTable: fmt.Sprintf("%s.%s", targetSchemaName, targetTableName),
+				Differences: differences,
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+func LoadTableDefinition(db *sql.DB, schemaName, tableName string) (*TableDefinition, error) {
+	definition := &TableDefinition{
+		ColumnOrder: make([]string, 0),
+		Columns:     make(map[string]ColumnDefinition),
+		Indexes:     make(map[string]IndexDefinition),
+	}
+
+	rows, err := db.Query(
+		"SELECT COLUMN_NAME, COLUMN_TYPE, COALESCE(CHARACTER_SET_NAME, ''), IS_NULLABLE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		schemaName, tableName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, columnType, charset, nullable string
+		if err = rows.Scan(&name, &columnType, &charset, &nullable); err != nil {
+			return nil, err
+		}
+
+		definition.ColumnOrder = append(definition.ColumnOrder, name)
+		definition.Columns[name] = ColumnDefinition{
+			Type:     columnType,
+			Charset:  charset,
+			Nullable: nullable == "YES",
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexRows, err := db.Query(
+		"SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX",
+		schemaName, tableName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer indexRows.Close()
+
+	for indexRows.Next() {
+		var name, column string
+		var nonUnique bool
+		if err = indexRows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+
+		index := definition.Indexes[name]
+		index.Unique = !nonUnique
+		index.Columns = append(index.Columns, column)
+		definition.Indexes[name] = index
+	}
+
+	return definition, indexRows.Err()
+}
+
+// DiffTableDefinitions returns a human-readable description of every
+// difference between the source and target definition of a table.
+func DiffTableDefinitions(source, target *TableDefinition) []string {
+	differences := make([]string, 0)
+
+	for _, name := range source.ColumnOrder {
+		sourceColumn := source.Columns[name]
+		targetColumn, exists := target.Columns[name]
+		if !exists {
+			differences = append(differences, fmt.Sprintf("column %s missing on target", name))
+			continue
+		}
+
+		if sourceColumn.Type != targetColumn.Type {
+			differences = append(differences, fmt.Sprintf("column %s has type %s on source but %s on target", name, sourceColumn.Type, targetColumn.Type))
+		}
+		if sourceColumn.Charset != targetColumn.Charset {
+			differences = append(differences, fmt.Sprintf("column %s has charset %s on source but %s on target", name, sourceColumn.Charset, targetColumn.Charset))
+		}
+		if sourceColumn.Nullable != targetColumn.Nullable {
+			differences = append(differences, fmt.Sprintf("column %s is nullable=%t on source but nullable=%t on target", name, sourceColumn.Nullable, targetColumn.Nullable))
+		}
+	}
+
+	for _, name := range target.ColumnOrder {
+		if _, exists := source.Columns[name]; !exists {
+			differences = append(differences, fmt.Sprintf("column %s missing on source", name))
+		}
+	}
+
+	indexNames := make([]string, 0, len(source.Indexes)+len(target.Indexes))
+	for name := range source.Indexes {
+		indexNames = append(indexNames, name)
+	}
+	for name := range target.Indexes {
+		if _, exists := source.Indexes[name]; !exists {
+			indexNames = append(indexNames, name)
+		}
+	}
+	sort.Strings(indexNames)
+
+	for _, name := range indexNames {
+		sourceIndex, existsOnSource := source.Indexes[name]
+		targetIndex, existsOnTarget := target.Indexes[name]
+
+		switch {
+		case !existsOnTarget:
+			differences = append(differences, fmt.Sprintf("key %s missing on target", name))
+		case !existsOnSource:
+			differences = append(differences, fmt.Sprintf("key %s missing on source", name))
+		case sourceIndex.Unique != targetIndex.Unique || strings.Join(sourceIndex.Columns, ",") != strings.Join(targetIndex.Columns, ","):
+			differences = append(differences, fmt.Sprintf("key %s is %s on source but %s on target", name, sourceIndex, targetIndex))
+		}
+	}
+
+	return differences
+}
+
+func (i IndexDefinition) String() string {
+	kind := "KEY"
+	if i.Unique {
+		kind = "UNIQUE KEY"
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(i.Columns, ", "))
+}
@@ -0,0 +1,77 @@
+package ghostferry
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// sessionRecordingConnector opens connections with the driver, and records
+// the ID of the session of each connection as it is opened, before it is
+// used. Attributing the binlog events of a session to the pool that opened
+// it this way does not depend on the session still running when its events
+// are streamed.
+type sessionRecordingConnector struct {
+	driver driver.Driver
+	dsn    string
+	record func(id uint32)
+}
+
+func (c *sessionRecordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := sessionID(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to look up the ID of the session: %v", err)
+	}
+
+	c.record(id)
+	return conn, nil
+}
+
+func (c *sessionRecordingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func sessionID(ctx context.Context, conn driver.Conn) (uint32, error) {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return 0, fmt.Errorf("%T cannot run queries", conn)
+	}
+
+	rows, err := queryer.QueryContext(ctx, "SELECT CONNECTION_ID()", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values := make([]driver.Value, 1)
+	if err = rows.Next(values); err != nil {
+		return 0, err
+	}
+
+	switch value := values[0].(type) {
+	case int64:
+		return uint32(value), nil
+	case []byte:
+		id, err := strconv.ParseUint(string(value), 10, 32)
+		return uint32(id), err
+	}
+	return 0, fmt.Errorf("unexpected session ID %v", values[0])
+}
+
+// sqlDriver returns the database/sql driver connecting to the database
+func (c *DatabaseConfig) sqlDriver() driver.Driver {
+	if c.IAMAuthRegion != "" {
+		d, _ := rdsIAMAuthDriverFor(c.IAMAuthRegion)
+		return d
+	}
+	return mysql.MySQLDriver{}
+}
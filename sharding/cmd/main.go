@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/sharding"
@@ -13,6 +14,7 @@ import (
 
 var configPath string
 var printVersion bool
+var dryrun bool
 
 func usage() {
 	fmt.Printf("ghostferry-sharding built with ghostferry %s\n", ghostferry.VersionString)
@@ -26,6 +28,7 @@ func usage() {
 func init() {
 	flag.StringVar(&configPath, "config-path", "", "Specify path to config (or provide it on stdin)")
 	flag.BoolVar(&printVersion, "version", false, "Print version and exit")
+	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just print the effective join graph")
 }
 
 func main() {
@@ -39,7 +42,7 @@ func main() {
 	config := parseConfig()
 
 	fmt.Printf("ghostferry-sharding built with ghostferry %s\n", ghostferry.VersionString)
-	fmt.Printf("will move tenant %s=%d\n", config.ShardingKey, config.ShardingValue)
+	fmt.Printf("will move tenant %s\n", config.ShardingKeyString())
 
 	err := sharding.InitializeMetrics("sharding", config)
 	if err != nil {
@@ -51,10 +54,25 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to create ferry: %v", err))
 	}
 
+	// a config read from stdin cannot be read again
+	if configPath != "" {
+		ferry.Ferry.ReloadTunables = func() (ghostferry.Tunables, error) {
+			return ghostferry.ReadTunablesFile(configPath)
+		}
+	}
+
 	err = ferry.Initialize()
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to initialize ferry: %v", err))
 	}
+	exitOnPanic(ferry.Ferry.ErrorHandler)
+
+	if dryrun {
+		fmt.Println("joined tables:")
+		fmt.Print(sharding.FormatJoinGraph(ferry.JoinedTables()))
+		fmt.Println("exiting due to dryrun")
+		return
+	}
 
 	err = ferry.Start()
 	if err != nil {
@@ -71,6 +89,23 @@ func errorAndExit(msg string) {
 	os.Exit(1)
 }
 
+// exitOnPanic exits once a goroutine of the ferry panicked and the state was
+// dumped, such that the run can be resumed from the dump
+func exitOnPanic(errorHandler ghostferry.ErrorHandler) {
+	panicErrorHandler, ok := errorHandler.(*ghostferry.PanicErrorHandler)
+	if !ok {
+		return
+	}
+
+	panics := panicErrorHandler.Panics()
+	go func() {
+		err := <-panics
+		fmt.Fprintf(os.Stderr, "error: %s\n", strings.SplitN(err.Error(), "\n", 2)[0])
+		panicErrorHandler.Ferry.CloseTunnels()
+		os.Exit(ghostferry.ExitCodeResumable)
+	}()
+}
+
 func parseConfig() *sharding.Config {
 	config := &sharding.Config{
 		Config:        &ghostferry.Config{AutomaticCutover: true},
@@ -100,7 +135,7 @@ func parseConfig() *sharding.Config {
 		}
 	}
 
-	err = json.Unmarshal(data, config)
+	err = ghostferry.DecodeConfig(bytes.NewReader(data), config)
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to parse config: %v", err))
 	}
@@ -109,11 +144,11 @@ func parseConfig() *sharding.Config {
 		errorAndExit("specifying MyServerId option manually is dangerous and disallowed")
 	}
 
-	if config.ShardingKey == "" {
+	if config.ShardingKey == "" && len(config.ShardingKeys) == 0 {
 		errorAndExit("missing ShardingKey config")
 	}
 
-	if config.ShardingValue == -1 {
+	if len(config.ShardingKeys) == 0 && config.ShardingValue == -1 {
 		errorAndExit("missing ShardingValue config")
 	}
 
@@ -1,7 +1,12 @@
 package sharding
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
 )
 
 type Config struct {
@@ -12,6 +17,11 @@ type Config struct {
 	SourceDB      string
 	TargetDB      string
 
+	// A composite sharding key, such as (region_id, tenant_id), and the
+	// values of its columns. Replaces ShardingKey and ShardingValue.
+	ShardingKeys   []string
+	ShardingValues []int64
+
 	SourceReplicationMaster       *ghostferry.DatabaseConfig
 	ReplicatedMasterPositionQuery string
 	RunFerryFromReplica           bool
@@ -25,8 +35,42 @@ type Config struct {
 	IgnoredTables    []string
 	PrimaryKeyTables []string
 
+	// Derive the JoinedTables from the foreign keys of the source shard: a
+	// table without the sharding key is joined through every table with the
+	// sharding key referencing its single-column primary key. Entries of
+	// JoinedTablesOverrideFile and of JoinedTables replace the discovered
+	// entries of the same table.
+	//
+	// Optional: defaults to false
+	DiscoverJoinedTables bool
+
+	// Path to a JSON file in the format of JoinedTables, overriding the
+	// discovered join graph. A table mapped to an empty list is not joined.
+	//
+	// Optional: defaults to empty, no overrides
+	JoinedTablesOverrideFile string
+
+	// Throttle both the reads from the source and the writes to the target,
+	// unless the ReadThrottle or WriteThrottle are configured for them.
+	//
+	// Optional: defaults to no throttling
 	Throttle *ghostferry.LagThrottlerConfig
 
+	// Compare the rows of the tenant on the source and the target during the
+	// cutover, after the inline verification, and abort the run if any of the
+	// copied tables differs. Unlike the inline verification, this also finds
+	// rows of the tenant that only exist on the target. The
+	// IterativeVerifierConfig configures the verification.
+	//
+	// Optional: defaults to false
+	VerifyShardedSubset bool
+
+	// Stream a change log of the copied tables into BigQuery, alongside the
+	// target, see bigquery.Sink.
+	//
+	// Optional: defaults to disabled
+	BigQuerySink bigquery.Config
+
 	// These two values configure the amount of times Ferry should attempt to
 	// retry acquiring the cutover lock, and for how long the Ferry should wait
 	// before attempting another lock acquisition
@@ -43,5 +87,59 @@ func (c *Config) ValidateConfig() error {
 		c.CutoverRetryWaitSeconds = 1
 	}
 
+	if len(c.ShardingKeys) > 0 {
+		if c.ShardingKey != "" {
+			return fmt.Errorf("ShardingKey and ShardingKeys cannot both be specified")
+		}
+		if len(c.ShardingKeys) != len(c.ShardingValues) {
+			return fmt.Errorf("ShardingKeys has %d columns, but ShardingValues has %d values", len(c.ShardingKeys), len(c.ShardingValues))
+		}
+		if len(c.PrimaryKeyTables) > 0 {
+			return fmt.Errorf("PrimaryKeyTables are not supported with a composite sharding key")
+		}
+	}
+
+	if c.JoinedTablesOverrideFile != "" && !c.DiscoverJoinedTables {
+		return fmt.Errorf("JoinedTablesOverrideFile requires DiscoverJoinedTables")
+	}
+
+	if c.VerifyShardedSubset {
+		if err := c.IterativeVerifierConfig.Validate(); err != nil {
+			return fmt.Errorf("IterativeVerifierConfig invalid: %v", err)
+		}
+	}
+
+	if c.BigQuerySink.Enabled() {
+		if err := c.BigQuerySink.Validate(); err != nil {
+			return fmt.Errorf("BigQuerySink invalid: %v", err)
+		}
+	}
+
+	if c.AllowMinimalBinlogRowImage {
+		return fmt.Errorf("AllowMinimalBinlogRowImage is not supported when sharding, as row images may not contain the sharding key")
+	}
+
 	return c.Config.ValidateConfig()
 }
+
+// ShardingKeyString describes the sharding key and its value, e.g.
+// "tenant_id=1" or "(region_id, tenant_id)=(2, 1)"
+func (c *Config) ShardingKeyString() string {
+	if len(c.ShardingKeys) == 0 {
+		return fmt.Sprintf("%s=%d", c.ShardingKey, c.ShardingValue)
+	}
+
+	values := make([]string, len(c.ShardingValues))
+	for i, value := range c.ShardingValues {
+		values[i] = strconv.FormatInt(value, 10)
+	}
+	return fmt.Sprintf("(%s)=(%s)", strings.Join(c.ShardingKeys, ", "), strings.Join(values, ", "))
+}
+
+func (c *Config) shardingValues() []interface{} {
+	values := make([]interface{}, len(c.ShardingValues))
+	for i, value := range c.ShardingValues {
+		values[i] = value
+	}
+	return values
+}
@@ -17,8 +17,13 @@ type JoinTable struct {
 }
 
 type ShardedCopyFilter struct {
-	ShardingKey      string
-	ShardingValue    interface{}
+	ShardingKey   string
+	ShardingValue interface{}
+	// A composite sharding key, replacing ShardingKey and ShardingValue if
+	// set: rows are copied if all columns match their value
+	ShardingKeys   []string
+	ShardingValues []interface{}
+
 	JoinedTables     map[string][]JoinTable
 	PrimaryKeyTables map[string]struct{}
 
@@ -46,8 +51,8 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *ghostferry.Tabl
 	}
 
 	quotedPaginationKey := "`" + table.PaginationKey.Columns[0].Name + "`"
-	quotedShardingKey := "`" + f.ShardingKey + "`"
 	quotedTable := ghostferry.QuotedTableName(table)
+	shardingKeyCondition, shardingValues := f.shardingKeyCondition()
 
 	if _, exists := f.PrimaryKeyTables[table.Name]; exists {
 		// This table uses the sharding key as its primary key, and thus contains
@@ -81,12 +86,12 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *ghostferry.Tabl
 		// i.e. load the primary keys first, then load the rest of the columns.
 
 		selectPaginationKeys := "SELECT " + quotedPaginationKey + " FROM " + quotedTable + " " + f.shardingKeyIndexHint(table) +
-			" WHERE " + quotedShardingKey + " = ? AND " + quotedPaginationKey + " > ?" +
+			" WHERE " + shardingKeyCondition + " AND " + quotedPaginationKey + " > ?" +
 			" ORDER BY " + quotedPaginationKey + " LIMIT " + strconv.Itoa(int(batchSize))
 
 		return sq.Select(columns...).
 			From(quotedTable).
-			Join("("+selectPaginationKeys+") AS `batch` USING("+quotedPaginationKey+")", f.ShardingValue, lastPaginationKeyValue), nil
+			Join("("+selectPaginationKeys+") AS `batch` USING("+quotedPaginationKey+")", append(shardingValues, lastPaginationKeyValue)...), nil
 	}
 
 	// This is a "joined table". It is the only supported type of table that
@@ -119,10 +124,11 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *ghostferry.Tabl
 	var args []interface{}
 
 	for _, joinTable := range joinTables {
-		pattern := "SELECT `%s` AS sharding_join_alias FROM `%s`.`%s` WHERE `%s` = ? AND `%s` > ?"
-		sql := fmt.Sprintf(pattern, joinTable.JoinColumn, table.Schema, joinTable.TableName, f.ShardingKey, joinTable.JoinColumn)
+		pattern := "SELECT `%s` AS sharding_join_alias FROM `%s`.`%s` WHERE %s AND `%s` > ?"
+		sql := fmt.Sprintf(pattern, joinTable.JoinColumn, table.Schema, joinTable.TableName, shardingKeyCondition, joinTable.JoinColumn)
 		clauses = append(clauses, sql)
-		args = append(args, f.ShardingValue, lastPaginationKeyValue)
+		args = append(args, shardingValues...)
+		args = append(args, lastPaginationKeyValue)
 	}
 
 	subquery := strings.Join(clauses, " UNION DISTINCT ")
@@ -136,6 +142,35 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *ghostferry.Tabl
 		OrderBy(quotedPaginationKey), nil // LIMIT comes from the subquery.
 }
 
+// shardingKeys returns the columns of the sharding key and their values
+func (f *ShardedCopyFilter) shardingKeys() ([]string, []interface{}) {
+	if len(f.ShardingKeys) > 0 {
+		return f.ShardingKeys, f.ShardingValues
+	}
+	return []string{f.ShardingKey}, []interface{}{f.ShardingValue}
+}
+
+// ConfigFingerprint implements ghostferry.ConfigFingerprinter
+func (f *ShardedCopyFilter) ConfigFingerprint() string {
+	keys, values := f.shardingKeys()
+	return fmt.Sprintf("keys=%v values=%v joined=%v pk=%v", keys, values, f.JoinedTables, f.PrimaryKeyTables)
+}
+
+// shardingKeyCondition returns the condition selecting the rows of the
+// sharding key, e.g. "`region_id` = ? AND `tenant_id` = ?", and its arguments
+func (f *ShardedCopyFilter) shardingKeyCondition() (string, []interface{}) {
+	keys, values := f.shardingKeys()
+
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		conditions[i] = "`" + key + "` = ?"
+	}
+
+	args := make([]interface{}, len(values))
+	copy(args, values)
+	return strings.Join(conditions, " AND "), args
+}
+
 func (f *ShardedCopyFilter) shardingKeyIndexHint(table *ghostferry.TableSchema) string {
 	if indexName := f.shardingKeyIndexName(table); indexName != "" {
 		return "USE INDEX (`" + indexName + "`)"
@@ -152,20 +187,45 @@ func (f *ShardedCopyFilter) shardingKeyIndexHint(table *ghostferry.TableSchema)
 func (f *ShardedCopyFilter) shardingKeyIndexName(table *ghostferry.TableSchema) string {
 	indexName := ""
 	paginationKeyName := table.PaginationKey.Columns[0].Name
+	keys, _ := f.shardingKeys()
 
 	for _, x := range table.Indexes {
-		if x.Columns[0] == f.ShardingKey {
-			if len(x.Columns) == 1 {
-				// This index will work in InnoDB, but there may be a more specific one to prefer.
-				indexName = x.Name
-			} else if x.Columns[1] == paginationKeyName {
-				// This index satisfies (sharding key, primary key).
-				indexName = x.Name
+		// the columns of the sharding key are compared for equality, so the
+		// order of the leading columns of the index does not matter
+		if len(x.Columns) < len(keys) || !sameColumns(x.Columns[:len(keys)], keys) {
+			continue
+		}
+
+		if len(x.Columns) == len(keys) {
+			// This index will work in InnoDB, but there may be a more specific one to prefer.
+			indexName = x.Name
+		} else if x.Columns[len(keys)] == paginationKeyName {
+			// This index satisfies (sharding key, primary key).
+			indexName = x.Name
+			break
+		}
+	}
+	return indexName
+}
+
+func sameColumns(columns, otherColumns []string) bool {
+	if len(columns) != len(otherColumns) {
+		return false
+	}
+
+	for _, column := range columns {
+		found := false
+		for _, otherColumn := range otherColumns {
+			if column == otherColumn {
+				found = true
 				break
 			}
 		}
+		if !found {
+			return false
+		}
 	}
-	return indexName
+	return true
 }
 
 func (f *ShardedCopyFilter) ApplicableDMLEvent(event ghostferry.DMLEvent) (bool, error) {
@@ -174,44 +234,85 @@ func (f *ShardedCopyFilter) ApplicableDMLEvent(event ghostferry.DMLEvent) (bool,
 		return false, ghostferry.UnsupportedPaginationKeyError(table.Schema, table.Name, table.PaginationKey.String())
 	}
 
-	shardingKey := f.ShardingKey
+	keys, values := f.shardingKeys()
 	if _, exists := f.PrimaryKeyTables[event.Table()]; exists {
-		shardingKey = table.PaginationKey.Columns[0].Name
+		keys = []string{table.PaginationKey.Columns[0].Name}
 	}
 
-	columns := event.TableSchema().Columns
-	for idx, column := range columns {
-		if column.Name == shardingKey {
-			oldValues, newValues := event.OldValues(), event.NewValues()
-
-			oldShardingValue, oldExists, err := parseShardingValue(oldValues, idx)
-			if err != nil {
-				return false, fmt.Errorf("parsing old sharding key: %s", err)
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = -1
+		for idx, column := range table.Columns {
+			if column.Name == key {
+				indexes[i] = idx
+				break
 			}
+		}
+		if indexes[i] == -1 {
+			return false, nil
+		}
+	}
 
-			newShardingValue, newExists, err := parseShardingValue(newValues, idx)
-			if err != nil {
-				return false, fmt.Errorf("parsing new sharding key: %s", err)
-			}
+	oldValues, newValues := event.OldValues(), event.NewValues()
 
-			oldEqual := oldExists && oldShardingValue == f.ShardingValue
-			newEqual := newExists && newShardingValue == f.ShardingValue
+	oldEqual, oldExists, err := matchesShardingValues(oldValues, indexes, values)
+	if err != nil {
+		return false, fmt.Errorf("parsing old sharding key: %s", err)
+	}
 
-			if oldEqual != newEqual && oldExists && newExists {
-				// The value of the sharding key for a row was changed - this is unsafe.
-				err := fmt.Errorf("sharding key changed from %v to %v", oldValues[idx], newValues[idx])
-				return false, err
-			}
+	newEqual, newExists, err := matchesShardingValues(newValues, indexes, values)
+	if err != nil {
+		return false, fmt.Errorf("parsing new sharding key: %s", err)
+	}
+
+	if oldEqual != newEqual && oldExists && newExists {
+		// The value of the sharding key for a row was changed - this is unsafe.
+		err := fmt.Errorf("sharding key changed from %v to %v", shardingKeyValues(oldValues, indexes), shardingKeyValues(newValues, indexes))
+		return false, err
+	}
+
+	return oldEqual || newEqual, nil
+}
+
+// matchesShardingValues returns whether the values of the sharding key
+// columns in the row, at the given indexes, are the sharding values
+func matchesShardingValues(row []interface{}, indexes []int, shardingValues []interface{}) (equal bool, exists bool, err error) {
+	if row == nil {
+		return false, false, nil
+	}
 
-			return oldEqual || newEqual, nil
+	equal = true
+	for i, idx := range indexes {
+		var value int64
+		value, _, err = parseShardingValue(row, idx)
+		if err != nil {
+			return false, true, err
+		}
+		if value != shardingValues[i] {
+			equal = false
 		}
 	}
-	return false, nil
+	return equal, true, nil
+}
+
+func shardingKeyValues(row []interface{}, indexes []int) interface{} {
+	if len(indexes) == 1 {
+		return row[indexes[0]]
+	}
+
+	values := make([]interface{}, len(indexes))
+	for i, idx := range indexes {
+		values[i] = row[idx]
+	}
+	return values
 }
 
 type ShardedTableFilter struct {
-	SourceShard      string
-	ShardingKey      string
+	SourceShard string
+	ShardingKey string
+	// A composite sharding key, replacing ShardingKey if set: tables are
+	// copied if they contain all of the columns
+	ShardingKeys     []string
 	JoinedTables     map[string][]JoinTable
 	IgnoredTables    []*regexp.Regexp
 	PrimaryKeyTables map[string]struct{}
@@ -227,12 +328,8 @@ func (s *ShardedTableFilter) ApplicableTables(tables []*ghostferry.TableSchema)
 			continue
 		}
 
-		columns := table.Columns
-		for _, column := range columns {
-			if column.Name == s.ShardingKey {
-				applicable = append(applicable, table)
-				break
-			}
+		if s.hasShardingKey(table) {
+			applicable = append(applicable, table)
 		}
 
 		if _, exists := s.JoinedTables[table.Name]; exists {
@@ -249,6 +346,40 @@ func (s *ShardedTableFilter) ApplicableTables(tables []*ghostferry.TableSchema)
 	return
 }
 
+// ConfigFingerprint implements ghostferry.ConfigFingerprinter
+func (s *ShardedTableFilter) ConfigFingerprint() string {
+	keys := s.ShardingKeys
+	if len(keys) == 0 {
+		keys = []string{s.ShardingKey}
+	}
+	ignoredTables := make([]string, len(s.IgnoredTables))
+	for i, re := range s.IgnoredTables {
+		ignoredTables[i] = re.String()
+	}
+	return fmt.Sprintf("shard=%s keys=%v joined=%v ignored=%v pk=%v", s.SourceShard, keys, s.JoinedTables, ignoredTables, s.PrimaryKeyTables)
+}
+
+func (s *ShardedTableFilter) hasShardingKey(table *ghostferry.TableSchema) bool {
+	keys := s.ShardingKeys
+	if len(keys) == 0 {
+		keys = []string{s.ShardingKey}
+	}
+
+	for _, key := range keys {
+		found := false
+		for _, column := range table.Columns {
+			if column.Name == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *ShardedTableFilter) isIgnored(table *ghostferry.TableSchema) bool {
 	for _, re := range s.IgnoredTables {
 		if re.Match([]byte(table.Name)) {
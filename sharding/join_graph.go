@@ -0,0 +1,256 @@
+package sharding
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// ForeignKey is a single-column foreign key constraint of the source shard,
+// from Table.Column to ReferencedTable.ReferencedColumn
+type ForeignKey struct {
+	Table            string
+	Column           string
+	ReferencedTable  string
+	ReferencedColumn string
+}
+
+// DiscoverJoinedTables derives the JoinedTables of the source shard from its
+// foreign keys: a table without the sharding key is joined through every
+// table with the sharding key that references its primary key. The rows of
+// a joined table are selected by their pagination key, so the foreign keys
+// referencing other columns, or tables without a single-column primary key,
+// are not followed.
+//
+// Entries of the override file and of the explicitly configured JoinedTables
+// replace the discovered entries of the same table, in that order. An entry
+// with no join tables removes the table from the join graph.
+func DiscoverJoinedTables(db *sql.DB, config *Config) (map[string][]JoinTable, error) {
+	foreignKeys, err := loadForeignKeys(db, config.SourceDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load foreign keys: %v", err)
+	}
+
+	sharded, err := loadTablesWithColumns(db, config.SourceDB, shardingKeyColumns(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tables with the sharding key: %v", err)
+	}
+
+	primaryKeys, err := loadPrimaryKeys(db, config.SourceDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load primary keys: %v", err)
+	}
+
+	var overrides map[string][]JoinTable
+	if config.JoinedTablesOverrideFile != "" {
+		overrides, err = readJoinedTablesOverrides(config.JoinedTablesOverrideFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return BuildJoinGraph(foreignKeys, sharded, primaryKeys, overrides, config.JoinedTables), nil
+}
+
+// BuildJoinGraph builds the JoinedTables from the given foreign keys, the
+// set of tables containing the sharding key and the single-column primary
+// keys of the tables, then applies the overrides in order
+func BuildJoinGraph(foreignKeys []ForeignKey, sharded map[string]bool, primaryKeys map[string]string, overrides ...map[string][]JoinTable) map[string][]JoinTable {
+	graph := make(map[string][]JoinTable)
+
+	for _, fk := range foreignKeys {
+		if sharded[fk.ReferencedTable] || !sharded[fk.Table] {
+			continue
+		}
+
+		// the join column is compared with the pagination key of the joined
+		// table
+		if primaryKey, found := primaryKeys[fk.ReferencedTable]; !found || primaryKey != fk.ReferencedColumn {
+			continue
+		}
+
+		joinTable := JoinTable{TableName: fk.Table, JoinColumn: fk.Column}
+		if !containsJoinTable(graph[fk.ReferencedTable], joinTable) {
+			graph[fk.ReferencedTable] = append(graph[fk.ReferencedTable], joinTable)
+		}
+	}
+
+	for _, override := range overrides {
+		for table, joinTables := range override {
+			if len(joinTables) == 0 {
+				delete(graph, table)
+			} else {
+				graph[table] = joinTables
+			}
+		}
+	}
+
+	for _, joinTables := range graph {
+		sort.Slice(joinTables, func(i, j int) bool {
+			if joinTables[i].TableName != joinTables[j].TableName {
+				return joinTables[i].TableName < joinTables[j].TableName
+			}
+			return joinTables[i].JoinColumn < joinTables[j].JoinColumn
+		})
+	}
+
+	return graph
+}
+
+// FormatJoinGraph renders the join graph for review, one joined table per
+// line, sorted by table name
+func FormatJoinGraph(graph map[string][]JoinTable) string {
+	tables := make([]string, 0, len(graph))
+	for table := range graph {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var b strings.Builder
+	for _, table := range tables {
+		joins := make([]string, 0, len(graph[table]))
+		for _, joinTable := range graph[table] {
+			joins = append(joins, fmt.Sprintf("%s.%s", joinTable.TableName, joinTable.JoinColumn))
+		}
+		fmt.Fprintf(&b, "%s <- %s\n", table, strings.Join(joins, ", "))
+	}
+
+	return b.String()
+}
+
+func containsJoinTable(joinTables []JoinTable, joinTable JoinTable) bool {
+	for _, t := range joinTables {
+		if t == joinTable {
+			return true
+		}
+	}
+	return false
+}
+
+func shardingKeyColumns(config *Config) []string {
+	if len(config.ShardingKeys) > 0 {
+		return config.ShardingKeys
+	}
+	return []string{config.ShardingKey}
+}
+
+func readJoinedTablesOverrides(path string) (map[string][]JoinTable, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read joined tables override file: %v", err)
+	}
+
+	var overrides map[string][]JoinTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse joined tables override file %s: %v", path, err)
+	}
+
+	return overrides, nil
+}
+
+// loadForeignKeys returns the single-column foreign keys within the schema.
+// Composite foreign keys cannot be expressed as a JoinTable and are skipped.
+func loadForeignKeys(db *sql.DB, schemaName string) ([]ForeignKey, error) {
+	rows, err := db.Query(
+		"SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME "+
+			"FROM information_schema.KEY_COLUMN_USAGE "+
+			"WHERE TABLE_SCHEMA = ? AND REFERENCED_TABLE_SCHEMA = ? AND REFERENCED_TABLE_NAME IS NOT NULL "+
+			"ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION",
+		schemaName, schemaName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	constraints := make(map[string][]ForeignKey)
+	var order []string
+	for rows.Next() {
+		var name string
+		var fk ForeignKey
+		if err := rows.Scan(&name, &fk.Table, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn); err != nil {
+			return nil, err
+		}
+
+		key := fk.Table + "." + name
+		if _, exists := constraints[key]; !exists {
+			order = append(order, key)
+		}
+		constraints[key] = append(constraints[key], fk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var foreignKeys []ForeignKey
+	for _, key := range order {
+		if len(constraints[key]) == 1 {
+			foreignKeys = append(foreignKeys, constraints[key][0])
+		}
+	}
+
+	return foreignKeys, nil
+}
+
+// loadPrimaryKeys returns the column of the primary key of the tables of the
+// schema, by table name. The tables with a composite primary key or without
+// one are omitted.
+func loadPrimaryKeys(db *sql.DB, schemaName string) (map[string]string, error) {
+	rows, err := db.Query(
+		"SELECT TABLE_NAME, MIN(COLUMN_NAME) FROM information_schema.KEY_COLUMN_USAGE "+
+			"WHERE TABLE_SCHEMA = ? AND CONSTRAINT_NAME = 'PRIMARY' "+
+			"GROUP BY TABLE_NAME HAVING COUNT(*) = 1",
+		schemaName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	primaryKeys := make(map[string]string)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		primaryKeys[table] = column
+	}
+
+	return primaryKeys, rows.Err()
+}
+
+// loadTablesWithColumns returns the tables of the schema containing all of
+// the given columns
+func loadTablesWithColumns(db *sql.DB, schemaName string, columns []string) (map[string]bool, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	args := []interface{}{schemaName}
+	for _, column := range columns {
+		args = append(args, column)
+	}
+	args = append(args, len(columns))
+
+	rows, err := db.Query(
+		"SELECT TABLE_NAME FROM information_schema.COLUMNS "+
+			"WHERE TABLE_SCHEMA = ? AND COLUMN_NAME IN ("+placeholders+") "+
+			"GROUP BY TABLE_NAME HAVING COUNT(*) = ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables[table] = true
+	}
+
+	return tables, rows.Err()
+}
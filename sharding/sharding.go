@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bigquery"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,9 +26,11 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 	config.DatabaseRewrites = map[string]string{config.SourceDB: config.TargetDB}
 
 	config.CopyFilter = &ShardedCopyFilter{
-		ShardingKey:   config.ShardingKey,
-		ShardingValue: config.ShardingValue,
-		JoinedTables:  config.JoinedTables,
+		ShardingKey:    config.ShardingKey,
+		ShardingValue:  config.ShardingValue,
+		ShardingKeys:   config.ShardingKeys,
+		ShardingValues: config.shardingValues(),
+		JoinedTables:   config.JoinedTables,
 	}
 
 	config.VerifierType = ghostferry.VerifierTypeInline
@@ -37,6 +42,7 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 
 	config.TableFilter = &ShardedTableFilter{
 		ShardingKey:   config.ShardingKey,
+		ShardingKeys:  config.ShardingKeys,
 		SourceShard:   config.SourceDB,
 		JoinedTables:  config.JoinedTables,
 		IgnoredTables: ignored,
@@ -46,19 +52,25 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 		return nil, fmt.Errorf("failed to validate config: %v", err)
 	}
 
-	var throttler ghostferry.Throttler
+	ferry := &ghostferry.Ferry{
+		Config: config.Config,
+	}
 
+	// the ReadThrottle and WriteThrottle take precedence for their paths and
+	// are set up by the Ferry
 	if config.Throttle != nil {
-		throttler, err = ghostferry.NewLagThrottler(config.Throttle)
+		throttler, err := ghostferry.NewLagThrottler(config.Throttle)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create throttler: %v", err)
 		}
-	}
 
-	ferry := &ghostferry.Ferry{
-		Config:               config.Config,
-		MigrationThrottler:   throttler,
-		ReplicationThrottler: throttler,
+		if config.ReadThrottle == nil {
+			ferry.MigrationThrottler = throttler
+		}
+		if config.WriteThrottle == nil {
+			ferry.ReplicationThrottler = throttler
+			ferry.CopyWriteThrottler = throttler
+		}
 	}
 
 	logger := logrus.WithField("tag", "sharding")
@@ -85,6 +97,23 @@ func (r *ShardingFerry) Initialize() error {
 		}
 	}
 
+	if r.config.DiscoverJoinedTables {
+		err := r.discoverJoinedTables()
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("could not discover joined tables")
+			return err
+		}
+	}
+
+	if r.config.BigQuerySink.Enabled() {
+		sink, err := bigquery.NewSink(&r.config.BigQuerySink, r.config.Config, logrus.WithField("tag", "bigquery_sink"))
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("could not create BigQuery sink")
+			return err
+		}
+		r.Ferry.Sink = sink
+	}
+
 	err := r.Ferry.Initialize()
 	if err != nil {
 		r.Ferry.ErrorHandler.ReportError("ferry.initialize", err)
@@ -94,6 +123,32 @@ func (r *ShardingFerry) Initialize() error {
 	return nil
 }
 
+// JoinedTables returns the effective join graph, including the discovered
+// joined tables after Initialize
+func (r *ShardingFerry) JoinedTables() map[string][]JoinTable {
+	return r.config.JoinedTables
+}
+
+func (r *ShardingFerry) discoverJoinedTables() error {
+	db, err := r.config.Source.SqlDB(r.logger.WithField("dbname", "source"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	joinedTables, err := DiscoverJoinedTables(db.DB, r.config)
+	if err != nil {
+		return err
+	}
+
+	r.logger.Infof("discovered %d joined tables", len(joinedTables))
+
+	r.config.JoinedTables = joinedTables
+	r.config.TableFilter.(*ShardedTableFilter).JoinedTables = joinedTables
+	r.config.CopyFilter.(*ShardedCopyFilter).JoinedTables = joinedTables
+	return nil
+}
+
 func (r *ShardingFerry) Start() error {
 	return r.Ferry.Start()
 }
@@ -137,6 +192,7 @@ func (r *ShardingFerry) Run() {
 
 	r.Ferry.MigrationThrottler.SetDisabled(true)
 	r.Ferry.ReplicationThrottler.SetDisabled(true)
+	r.Ferry.CopyWriteThrottler.SetDisabled(true)
 
 	r.Ferry.FlushBinlogAndStopStreaming()
 	copyWG.Wait()
@@ -165,6 +221,16 @@ func (r *ShardingFerry) Run() {
 		r.Ferry.ErrorHandler.Fatal("inline_verifier", err)
 	}
 
+	if r.config.VerifyShardedSubset {
+		metrics.Measure("VerifyShardedSubset", nil, 1.0, func() {
+			err = r.verifyShardedSubset()
+		})
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("verification of the sharded subset failed, aborting run")
+			r.Ferry.ErrorHandler.Fatal("sharding.verify_subset", err)
+		}
+	}
+
 	metrics.Measure("CopyPrimaryKeyTables", nil, 1.0, func() {
 		err = r.copyPrimaryKeyTables()
 	})
@@ -173,8 +239,33 @@ func (r *ShardingFerry) Run() {
 		r.Ferry.ErrorHandler.Fatal("sharding", err)
 	}
 
+	if r.Ferry.Config.TargetTriggerPolicy == ghostferry.TargetTriggerPolicyDrop {
+		metrics.Measure("RestoreTargetTriggers", nil, 1.0, func() {
+			err = r.Ferry.RestoreTargetTriggers()
+		})
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("creating the dropped triggers failed, aborting run")
+			r.Ferry.ErrorHandler.Fatal("sharding.target_triggers", err)
+		}
+	}
+
+	if r.Ferry.Config.AutoIncrementSync.Enabled {
+		metrics.Measure("SyncAutoIncrements", nil, 1.0, func() {
+			err = r.Ferry.SyncAutoIncrements()
+		})
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("advancing the AUTO_INCREMENT values failed, aborting run")
+			r.Ferry.ErrorHandler.Fatal("sharding.auto_increment_sync", err)
+		}
+	}
+
+	metrics.Measure("ValidateCutover", nil, 1.0, func() {
+		r.Ferry.ValidateCutoverOrFail(&verificationResult)
+	})
+
 	r.Ferry.MigrationThrottler.SetDisabled(false)
 	r.Ferry.ReplicationThrottler.SetDisabled(false)
+	r.Ferry.CopyWriteThrottler.SetDisabled(false)
 
 	metrics.Measure("CutoverUnlock", nil, 1.0, func() {
 		err = r.config.CutoverUnlock.Post(&client)
@@ -196,7 +287,7 @@ func (r *ShardingFerry) deltaCopyJoinedTables() error {
 		}
 	}
 
-	err := r.Ferry.RunStandaloneDataCopy(tables)
+	err := r.Ferry.RunResumableDataCopy("joined_tables", tables)
 	if err != nil {
 		return err
 	}
@@ -204,6 +295,46 @@ func (r *ShardingFerry) deltaCopyJoinedTables() error {
 	return nil
 }
 
+// verifyShardedSubset compares the rows of the tenant in all copied tables,
+// including the joined tables, and reports the result of every table
+func (r *ShardingFerry) verifyShardedSubset() error {
+	verifier, err := r.Ferry.NewIterativeVerifier()
+	if err != nil {
+		return err
+	}
+
+	reports, err := verifier.VerifyOnceWithReport()
+	if err != nil {
+		return err
+	}
+
+	incorrectTables := []string{}
+	for table, report := range reports {
+		tags := []ghostferry.MetricTag{{Name: "table", Value: table}}
+		metrics.Gauge("ShardedSubsetMismatches", float64(len(report.MismatchedPaginationKeys)), tags, 1.0)
+
+		logger := r.logger.WithFields(logrus.Fields{
+			"table":       table,
+			"source_rows": report.SourceRowsVerified,
+			"target_rows": report.TargetRowsVerified,
+			"mismatches":  len(report.MismatchedPaginationKeys),
+		})
+		if report.DataCorrect() {
+			logger.Info("sharded subset of table verified")
+		} else {
+			logger.WithField("mismatched_paginationKeys", report.MismatchedPaginationKeys).Error("sharded subset of table differs")
+			incorrectTables = append(incorrectTables, table)
+		}
+	}
+
+	if len(incorrectTables) > 0 {
+		sort.Strings(incorrectTables)
+		return fmt.Errorf("sharded subset differs in tables: %s", strings.Join(incorrectTables, ", "))
+	}
+
+	return nil
+}
+
 func (r *ShardingFerry) copyPrimaryKeyTables() error {
 	if len(r.config.PrimaryKeyTables) == 0 {
 		return nil
@@ -236,7 +367,7 @@ func (r *ShardingFerry) copyPrimaryKeyTables() error {
 		return fmt.Errorf("expected primary key tables could not be found")
 	}
 
-	err = r.Ferry.RunStandaloneDataCopy(tables)
+	err = r.Ferry.RunResumableDataCopy("primary_key_tables", tables)
 	if err != nil {
 		return err
 	}
@@ -157,6 +157,71 @@ func (t *CopyFilterTestSuite) TestInvalidShardingValueTypesErrors() {
 	t.Require().Equal("parsing new sharding key: invalid type %!t(string=1)", err.Error())
 }
 
+func (t *CopyFilterTestSuite) useCompositeShardingKey() {
+	columns := []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}, {Name: "tenant_id"}, {Name: "region_id"}, {Name: "data"}}
+	t.normalTable.Columns = columns
+	t.normalTable.PaginationKey = &ghostferry.PaginationKey{[]*schema.TableColumn{&columns[0]}, []int{0}, 0}
+	t.normalTable.Indexes = []*schema.Index{
+		{Name: "tenant_index", Columns: []string{"tenant_id", "id"}},
+		{Name: "sharding_index", Columns: []string{"tenant_id", "region_id", "id"}},
+	}
+
+	t.filter.ShardingKey = ""
+	t.filter.ShardingValue = nil
+	t.filter.ShardingKeys = []string{"region_id", "tenant_id"}
+	t.filter.ShardingValues = []interface{}{int64(2), t.shardingValue}
+}
+
+func (t *CopyFilterTestSuite) TestSelectsRegularTablesWithCompositeShardingKey() {
+	t.useCompositeShardingKey()
+
+	selectBuilder, err := t.filter.BuildSelect([]string{"*"}, t.normalTable, t.paginationKeyCursor, 1024, false)
+	t.Require().Nil(err)
+
+	sql, args, err := selectBuilder.ToSql()
+	t.Require().Nil(err)
+	t.Require().Equal("SELECT * FROM `shard_1`.`normaltable` JOIN (SELECT `id` FROM `shard_1`.`normaltable` USE INDEX (`sharding_index`) WHERE `region_id` = ? AND `tenant_id` = ? AND `id` > ? ORDER BY `id` LIMIT 1024) AS `batch` USING(`id`)", sql)
+	t.Require().Equal([]interface{}{int64(2), t.shardingValue, t.paginationKeyCursorValue}, args)
+}
+
+func (t *CopyFilterTestSuite) TestSelectsJoinedTablesWithCompositeShardingKey() {
+	t.useCompositeShardingKey()
+
+	selectBuilder, err := t.filter.BuildSelect([]string{"*"}, t.joinedTable, t.paginationKeyCursor, 1024, false)
+	t.Require().Nil(err)
+
+	sql, args, err := selectBuilder.ToSql()
+	t.Require().Nil(err)
+	t.Require().Equal("SELECT * FROM `shard_1`.`joinedtable` WHERE `joined_paginationKey` IN (SELECT * FROM (SELECT `joined_paginationKey1` AS sharding_join_alias FROM `shard_1`.`join1` WHERE `region_id` = ? AND `tenant_id` = ? AND `joined_paginationKey1` > ? UNION DISTINCT SELECT `joined_paginationKey2` AS sharding_join_alias FROM `shard_1`.`join2` WHERE `region_id` = ? AND `tenant_id` = ? AND `joined_paginationKey2` > ? ORDER BY sharding_join_alias LIMIT 1024) AS sharding_join_table) ORDER BY `joined_paginationKey`", sql)
+	t.Require().Equal([]interface{}{int64(2), t.shardingValue, t.paginationKeyCursorValue, int64(2), t.shardingValue, t.paginationKeyCursorValue}, args)
+}
+
+func (t *CopyFilterTestSuite) TestApplicableDMLEventWithCompositeShardingKey() {
+	t.useCompositeShardingKey()
+
+	dmlEvents, _ := ghostferry.NewBinlogInsertEvents(t.normalTable, t.newRowsEvent([]interface{}{1001, 1, 2, "data"}), ghostferry.BinlogPosition{}, time.Now())
+	applicable, err := t.filter.ApplicableDMLEvent(dmlEvents[0])
+	t.Require().Nil(err)
+	t.Require().True(applicable)
+
+	dmlEvents, _ = ghostferry.NewBinlogInsertEvents(t.normalTable, t.newRowsEvent([]interface{}{1001, 1, 3, "data"}), ghostferry.BinlogPosition{}, time.Now())
+	applicable, err = t.filter.ApplicableDMLEvent(dmlEvents[0])
+	t.Require().Nil(err)
+	t.Require().False(applicable)
+}
+
+func (t *CopyFilterTestSuite) TestShardingKeyChangeWithCompositeShardingKeyErrors() {
+	t.useCompositeShardingKey()
+
+	rowsEvent := t.newRowsEvent([]interface{}{1001, 1, 2, "data"})
+	rowsEvent.Rows = append(rowsEvent.Rows, []interface{}{1001, 1, 3, "data"})
+	dmlEvents, err := ghostferry.NewBinlogUpdateEvents(t.normalTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	t.Require().Nil(err)
+
+	_, err = t.filter.ApplicableDMLEvent(dmlEvents[0])
+	t.Require().EqualError(err, "sharding key changed from [2 1] to [3 1]")
+}
+
 func (t *CopyFilterTestSuite) newRowsEvent(rowData []interface{}) *replication.RowsEvent {
 	normalTableMapEvent := &replication.TableMapEvent{
 		Schema: []byte(t.normalTable.Schema),
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry/sharding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildJoinGraphFromForeignKeys(t *testing.T) {
+	foreignKeys := []sharding.ForeignKey{
+		{Table: "orders", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+		{Table: "carts", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+		{Table: "orders", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+		{Table: "orders", Column: "customer_id", ReferencedTable: "customers", ReferencedColumn: "id"},
+		{Table: "variants", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+	}
+	sharded := map[string]bool{"orders": true, "carts": true, "customers": true}
+	primaryKeys := map[string]string{"orders": "id", "carts": "id", "customers": "id", "products": "id", "variants": "id"}
+
+	graph := sharding.BuildJoinGraph(foreignKeys, sharded, primaryKeys)
+	assert.Equal(t, map[string][]sharding.JoinTable{
+		"products": {
+			{TableName: "carts", JoinColumn: "product_id"},
+			{TableName: "orders", JoinColumn: "product_id"},
+		},
+	}, graph)
+}
+
+func TestBuildJoinGraphOnlyFollowsForeignKeysToPrimaryKeys(t *testing.T) {
+	foreignKeys := []sharding.ForeignKey{
+		{Table: "orders", Column: "product_sku", ReferencedTable: "products", ReferencedColumn: "sku"},
+		{Table: "orders", Column: "image_id", ReferencedTable: "images", ReferencedColumn: "id"},
+		{Table: "orders", Column: "coupon_id", ReferencedTable: "coupons", ReferencedColumn: "id"},
+	}
+	sharded := map[string]bool{"orders": true}
+
+	// images have a composite primary key
+	primaryKeys := map[string]string{"orders": "id", "products": "id", "coupons": "id"}
+
+	graph := sharding.BuildJoinGraph(foreignKeys, sharded, primaryKeys)
+	assert.Equal(t, map[string][]sharding.JoinTable{
+		"coupons": {{TableName: "orders", JoinColumn: "coupon_id"}},
+	}, graph)
+}
+
+func TestBuildJoinGraphAppliesOverridesInOrder(t *testing.T) {
+	foreignKeys := []sharding.ForeignKey{
+		{Table: "orders", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+		{Table: "orders", Column: "coupon_id", ReferencedTable: "coupons", ReferencedColumn: "id"},
+	}
+	sharded := map[string]bool{"orders": true}
+	primaryKeys := map[string]string{"orders": "id", "products": "id", "coupons": "id"}
+
+	fromFile := map[string][]sharding.JoinTable{
+		"coupons":  {},
+		"products": {{TableName: "carts", JoinColumn: "product_id"}},
+		"images":   {{TableName: "orders", JoinColumn: "image_id"}},
+	}
+	fromConfig := map[string][]sharding.JoinTable{
+		"images": {{TableName: "carts", JoinColumn: "image_id"}},
+	}
+
+	graph := sharding.BuildJoinGraph(foreignKeys, sharded, primaryKeys, fromFile, fromConfig)
+	assert.Equal(t, map[string][]sharding.JoinTable{
+		"products": {{TableName: "carts", JoinColumn: "product_id"}},
+		"images":   {{TableName: "carts", JoinColumn: "image_id"}},
+	}, graph)
+
+	assert.Equal(t, "images <- carts.image_id\nproducts <- carts.product_id\n", sharding.FormatJoinGraph(graph))
+}
@@ -68,6 +68,20 @@ func TestShardedTableFilterSelectsTablesWithShardingKey(t *testing.T) {
 	assert.Equal(t, tables[1:3], applicable)
 }
 
+func TestShardedTableFilterSelectsTablesWithCompositeShardingKey(t *testing.T) {
+	filter := &sharding.ShardedTableFilter{SourceShard: "shard_42", ShardingKeys: []string{"region_id", "tenant_id"}}
+
+	tables := []*ghostferry.TableSchema{
+		{Table: &schema.Table{Schema: "shard_42", Name: "table1", Columns: []schema.TableColumn{{Name: "id"}, {Name: "tenant_id"}}}},
+		{Table: &schema.Table{Schema: "shard_42", Name: "table2", Columns: []schema.TableColumn{{Name: "id"}, {Name: "tenant_id"}, {Name: "region_id"}}}},
+		{Table: &schema.Table{Schema: "shard_42", Name: "table3", Columns: []schema.TableColumn{{Name: "region_id"}}}},
+	}
+
+	applicable, err := filter.ApplicableTables(tables)
+	assert.Nil(t, err)
+	assert.Equal(t, tables[1:2], applicable)
+}
+
 func TestShardedTableFilterSelectsJoinedTables(t *testing.T) {
 	filter := &sharding.ShardedTableFilter{
 		SourceShard:  "shard_42",
@@ -0,0 +1,99 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Sink receives the rows copied to the target and the binlog events applied
+// to it, to maintain a replica in a system other than MySQL alongside (or,
+// if the writes to the target are discarded, instead of) the target.
+//
+// Writes are retried along with the writes to the target, and may be
+// repeated on resume, so they must be idempotent.
+type Sink interface {
+	WriteRowBatch(batch RowBatch) error
+	WriteBinlogEvents(events []DXLEventWrapper) error
+	Close() error
+}
+
+// MultiSink writes to all of its sinks in order
+type MultiSink []Sink
+
+func (m MultiSink) WriteRowBatch(batch RowBatch) error {
+	for _, sink := range m {
+		if err := sink.WriteRowBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) WriteBinlogEvents(events []DXLEventWrapper) error {
+	for _, sink := range m {
+		if err := sink.WriteBinlogEvents(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) Close() error {
+	var firstErr error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// PrimaryKeyChanged returns whether an update changed the primary key of
+// the row, which sinks write as a delete of the old row and an insert of the
+// new one
+func PrimaryKeyChanged(table *TableSchema, oldValues, newValues RowData) bool {
+	for _, i := range table.PKColumns {
+		if fmt.Sprintf("%v", oldValues[i]) != fmt.Sprintf("%v", newValues[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// SinkVersions generates the versions of the rows written to a sink: the
+// current time in nanoseconds, but always increasing, such that later writes
+// of a row replace earlier ones, also across restarts
+type SinkVersions struct {
+	mutex sync.Mutex
+	last  uint64
+}
+
+func (v *SinkVersions) Next() uint64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	version := uint64(time.Now().UnixNano())
+	if version <= v.last {
+		version = v.last + 1
+	}
+	v.last = version
+
+	return version
+}
+
+// SinkValue converts a column value of a row batch or binlog event into a
+// value that encodes to JSON as expected by sinks
+func SinkValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case decimal.Decimal:
+		return v.String()
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	}
+	return value
+}
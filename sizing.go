@@ -0,0 +1,168 @@
+package ghostferry
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// TableSizing is the size of a table as estimated by information_schema
+type TableSizing struct {
+	Table         string
+	EstimatedRows uint64
+	DataBytes     uint64
+}
+
+// SizingReport summarizes the estimated size of the data to copy, gathered
+// from information_schema before the copy starts. The row counts of InnoDB
+// tables are estimates and may be off by a large factor.
+type SizingReport struct {
+	Tables     int
+	TotalRows  uint64
+	TotalBytes uint64
+
+	// The tables with the most data, largest first
+	LargestTables []TableSizing
+
+	// The number of batches needed to copy all rows at the configured
+	// DataIterationBatchSize, and how long they are expected to take with
+	// DataIterationConcurrency batches copied at the same time, assuming a
+	// batch takes Sizing.BatchDuration.
+	Batches           uint64
+	ProjectedCopyTime float64 // seconds
+}
+
+// NewSizingReport projects the copy of the tables of the given sizes
+func NewSizingReport(tables []TableSizing, batchSize uint64, concurrency int, config *SizingConfig) *SizingReport {
+	report := &SizingReport{Tables: len(tables)}
+
+	var maxTableBatches uint64
+	for _, table := range tables {
+		report.TotalRows += table.EstimatedRows
+		report.TotalBytes += table.DataBytes
+
+		// an empty table still needs a batch to find out it is empty
+		tableBatches := (table.EstimatedRows + batchSize - 1) / batchSize
+		if tableBatches == 0 {
+			tableBatches = 1
+		}
+		report.Batches += tableBatches
+		if tableBatches > maxTableBatches {
+			maxTableBatches = tableBatches
+		}
+	}
+
+	// the batches of a table are copied one after the other, so the largest
+	// table bounds the copy time no matter the concurrency
+	rounds := uint64(math.Ceil(float64(report.Batches) / float64(concurrency)))
+	if rounds < maxTableBatches {
+		rounds = maxTableBatches
+	}
+	report.ProjectedCopyTime = (time.Duration(rounds) * config.batchDuration).Seconds()
+
+	largest := make([]TableSizing, len(tables))
+	copy(largest, tables)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].DataBytes > largest[j].DataBytes
+	})
+	if len(largest) > config.LargestTables {
+		largest = largest[:config.LargestTables]
+	}
+	report.LargestTables = largest
+
+	return report
+}
+
+// EstimateSizing reads the estimated row counts and data lengths of the
+// tables from information_schema and projects their copy.
+func EstimateSizing(db *sql.DB, tables []*TableSchema, batchSize uint64, concurrency int, config *SizingConfig) (*SizingReport, error) {
+	tablesBySchema := make(map[string]map[string]bool)
+	for _, table := range tables {
+		if tablesBySchema[table.Schema] == nil {
+			tablesBySchema[table.Schema] = make(map[string]bool)
+		}
+		tablesBySchema[table.Schema][table.Name] = true
+	}
+
+	sizes := make([]TableSizing, 0, len(tables))
+	for schemaName, tableNames := range tablesBySchema {
+		rows, err := db.Query("SELECT TABLE_NAME, COALESCE(TABLE_ROWS, 0), COALESCE(DATA_LENGTH, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", schemaName)
+		if err != nil {
+			return nil, fmt.Errorf("querying table sizes of %s: %v", schemaName, err)
+		}
+
+		for rows.Next() {
+			var size TableSizing
+			var tableName string
+			err = rows.Scan(&tableName, &size.EstimatedRows, &size.DataBytes)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("reading table sizes of %s: %v", schemaName, err)
+			}
+
+			if tableNames[tableName] {
+				size.Table = fmt.Sprintf("%s.%s", schemaName, tableName)
+				sizes = append(sizes, size)
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading table sizes of %s: %v", schemaName, err)
+		}
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].Table < sizes[j].Table
+	})
+
+	return NewSizingReport(sizes, batchSize, concurrency, config), nil
+}
+
+func (r *SizingReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "estimated %d rows, %d MiB in %d tables\n", r.TotalRows, r.TotalBytes/(1024*1024), r.Tables)
+	fmt.Fprintf(&b, "projected copy time: %v for %d batches\n", time.Duration(r.ProjectedCopyTime*float64(time.Second)).Round(time.Second), r.Batches)
+	for _, table := range r.LargestTables {
+		fmt.Fprintf(&b, "  %s: %d rows, %d MiB\n", table.Table, table.EstimatedRows, table.DataBytes/(1024*1024))
+	}
+	return b.String()
+}
+
+// estimateSizing logs the estimated size of the copy. The estimate is only
+// informational, so failing to gather it does not fail the run.
+func (f *Ferry) estimateSizing() {
+	report, err := EstimateSizing(f.SourceDB, f.Tables.AsSlice(), f.Config.DataIterationBatchSize, f.Config.DataIterationConcurrency, &f.Config.Sizing)
+	if err != nil {
+		f.logger.WithError(err).Warn("failed to estimate the size of the copy")
+		return
+	}
+
+	largestTables := make([]string, len(report.LargestTables))
+	for i, table := range report.LargestTables {
+		largestTables[i] = fmt.Sprintf("%s (%d rows, %d MiB)", table.Table, table.EstimatedRows, table.DataBytes/(1024*1024))
+	}
+
+	f.logger.WithFields(logrus.Fields{
+		"tables":              report.Tables,
+		"estimated_rows":      report.TotalRows,
+		"data_bytes":          report.TotalBytes,
+		"batches":             report.Batches,
+		"projected_copy_time": time.Duration(report.ProjectedCopyTime * float64(time.Second)).Round(time.Second),
+		"largest_tables":      strings.Join(largestTables, ", "),
+	}).Info("estimated size of the copy")
+
+	f.sizingReport = report
+}
+
+// SizingReport returns the estimated size of the copy gathered at
+// initialization, or nil if it could not be estimated
+func (f *Ferry) SizingReport() *SizingReport {
+	return f.sizingReport
+}
@@ -0,0 +1,240 @@
+package ghostferry
+
+import (
+	"context"
+	sqlorig "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// How the source is locked while a ConsistentSnapshot is taken, see
+// Config.ConsistentSnapshotLock
+const (
+	SnapshotLockFlushTables = "flush_tables"
+	SnapshotLockBackup      = "backup"
+)
+
+// ConsistentSnapshot is a set of transactions on the source that all read
+// from the same snapshot of the data, taken at the binlog Position, see
+// Config.ConsistentSnapshot.
+//
+// Like mysqldump --single-transaction --master-data, the transactions are
+// started WITH CONSISTENT SNAPSHOT while FLUSH TABLES WITH READ LOCK, or a
+// backup lock and read locks of the copied tables, are held, which are
+// released as soon as the binlog coordinates have been read.
+//
+// The cursors use the transactions batch by batch: Acquire hands out one of
+// the idle transactions, and rolling back the returned SqlPreparerAndRollbacker
+// hands it back, keeping the transaction open.
+type ConsistentSnapshot struct {
+	Position mysql.Position
+
+	// The executed GTID set at the Position, if the source reports one
+	GTIDSet string
+
+	conns  []*sqlorig.Conn
+	idle   chan *sqlorig.Conn
+	logger *logrus.Entry
+}
+
+// TakeConsistentSnapshot opens count transactions reading from a consistent
+// snapshot of the database. This requires the RELOAD privilege, and blocks
+// all writes to the database for the (short) time it takes.
+func TakeConsistentSnapshot(db *sql.DB, count int, logger *logrus.Entry) (*ConsistentSnapshot, error) {
+	lock := func(ctx context.Context, conn *sqlorig.Conn) error {
+		if _, err := conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+			return fmt.Errorf("failed to lock tables: %v", err)
+		}
+		return nil
+	}
+	unlock := func(ctx context.Context, conn *sqlorig.Conn) error {
+		if _, err := conn.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+			return fmt.Errorf("failed to unlock tables: %v", err)
+		}
+		return nil
+	}
+
+	return takeConsistentSnapshot(db, count, "locking all tables to take a consistent snapshot", lock, unlock, ShowMasterStatus, logger)
+}
+
+// TakeConsistentSnapshotWithBackupLock opens count transactions reading from a
+// consistent snapshot of the given tables, without FLUSH TABLES WITH READ
+// LOCK, see SnapshotLockBackup. The coordinates are read from
+// performance_schema.log_status, which requires MySQL 8.0 and the
+// BACKUP_ADMIN privilege. Locking the tables requires the LOCK TABLES
+// privilege.
+//
+// Only the writes to the tables are blocked while the snapshot is taken, and
+// the source does not wait for long running queries to flush the tables.
+func TakeConsistentSnapshotWithBackupLock(db *sql.DB, count int, tables []*TableSchema, logger *logrus.Entry) (*ConsistentSnapshot, error) {
+	lock := func(ctx context.Context, conn *sqlorig.Conn) error {
+		if _, err := conn.ExecContext(ctx, "LOCK INSTANCE FOR BACKUP"); err != nil {
+			return fmt.Errorf("failed to take backup lock: %v", err)
+		}
+		if len(tables) == 0 {
+			return nil
+		}
+
+		tableLocks := make([]string, len(tables))
+		for i, table := range tables {
+			tableLocks[i] = QuotedTableName(table) + " READ"
+		}
+		if _, err := conn.ExecContext(ctx, "LOCK TABLES "+strings.Join(tableLocks, ", ")); err != nil {
+			return fmt.Errorf("failed to lock tables: %v", err)
+		}
+		return nil
+	}
+	unlock := func(ctx context.Context, conn *sqlorig.Conn) error {
+		if _, err := conn.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+			return fmt.Errorf("failed to unlock tables: %v", err)
+		}
+		if _, err := conn.ExecContext(ctx, "UNLOCK INSTANCE"); err != nil {
+			return fmt.Errorf("failed to release backup lock: %v", err)
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("locking %d tables with a backup lock to take a consistent snapshot", len(tables))
+	return takeConsistentSnapshot(db, count, message, lock, unlock, ShowLogStatus, logger)
+}
+
+func takeConsistentSnapshot(db *sql.DB, count int, message string, lock, unlock func(context.Context, *sqlorig.Conn) error, readPosition func(*sql.DB) (mysql.Position, string, error), logger *logrus.Entry) (*ConsistentSnapshot, error) {
+	if logger == nil {
+		logger = logrus.WithField("tag", "consistent_snapshot")
+	}
+
+	s := &ConsistentSnapshot{
+		idle:   make(chan *sqlorig.Conn, count),
+		logger: logger,
+	}
+
+	ctx := context.Background()
+	lockConn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lockConn.Close()
+
+	logger.Info(message)
+	if err = lock(ctx, lockConn); err != nil {
+		// a partially taken lock is released with the connection
+		return nil, err
+	}
+
+	err = s.startTransactions(db, count)
+	if err == nil {
+		s.Position, s.GTIDSet, err = readPosition(db)
+	}
+
+	if unlockErr := unlock(ctx, lockConn); unlockErr != nil && err == nil {
+		err = unlockErr
+	}
+
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"position": s.Position,
+		"gtid_set": s.GTIDSet,
+	}).Infof("took consistent snapshot with %d transactions", count)
+	return s, nil
+}
+
+func (s *ConsistentSnapshot) startTransactions(db *sql.DB, count int) error {
+	ctx := context.Background()
+
+	for i := 0; i < count; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		s.conns = append(s.conns, conn)
+
+		_, err = conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err == nil {
+			_, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start snapshot transaction: %v", err)
+		}
+
+		s.idle <- conn
+	}
+
+	return nil
+}
+
+// Acquire waits for an idle transaction of the snapshot and returns it. It
+// must be handed back by calling Rollback on it.
+func (s *ConsistentSnapshot) Acquire() SqlPreparerAndRollbacker {
+	return &snapshotTx{conn: <-s.idle, snapshot: s}
+}
+
+// Close ends the transactions of the snapshot, which must no longer be used
+func (s *ConsistentSnapshot) Close() {
+	ctx := context.Background()
+	for _, conn := range s.conns {
+		if _, err := conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+			s.logger.WithError(err).Warn("failed to end snapshot transaction")
+		}
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+type snapshotTx struct {
+	conn     *sqlorig.Conn
+	snapshot *ConsistentSnapshot
+}
+
+func (t *snapshotTx) Prepare(query string) (*sqlorig.Stmt, error) {
+	return t.conn.PrepareContext(context.Background(), query)
+}
+
+func (t *snapshotTx) Query(query string, args ...interface{}) (*sqlorig.Rows, error) {
+	return t.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (t *snapshotTx) QueryRow(query string, args ...interface{}) *sqlorig.Row {
+	return t.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// Rollback hands the transaction back to the snapshot, without ending it
+func (t *snapshotTx) Rollback() error {
+	if t.conn != nil {
+		t.snapshot.idle <- t.conn
+		t.conn = nil
+	}
+	return nil
+}
+
+// ShowLogStatus returns the current binlog position and executed GTID set of
+// the database from performance_schema.log_status, which reports both
+// consistently while blocking the logging for the time it takes
+func ShowLogStatus(db *sql.DB) (mysql.Position, string, error) {
+	var local string
+	if err := db.QueryRow("SELECT LOCAL FROM performance_schema.log_status").Scan(&local); err != nil {
+		return mysql.Position{}, "", fmt.Errorf("failed to read log status: %v", err)
+	}
+
+	var status struct {
+		GTIDExecuted      string `json:"gtid_executed"`
+		BinaryLogFile     string `json:"binary_log_file"`
+		BinaryLogPosition uint32 `json:"binary_log_position"`
+	}
+	if err := json.Unmarshal([]byte(local), &status); err != nil {
+		return mysql.Position{}, "", fmt.Errorf("failed to parse log status %s: %v", local, err)
+	}
+
+	if status.BinaryLogFile == "" {
+		return mysql.Position{}, "", fmt.Errorf("log status does not show a binary log file")
+	}
+	return mysql.Position{Name: status.BinaryLogFile, Pos: status.BinaryLogPosition}, status.GTIDExecuted, nil
+}
@@ -0,0 +1,105 @@
+package ghostferry
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// the binlog replication client connects to the "host:port" of its config,
+// over a Unix socket if that contains a slash, so the relay's socket is
+// named after this port
+const socketRelayPort = 0
+
+// SocketRelay forwards the connections to a private Unix socket to the Unix
+// socket of a database, for the binlog replication client, which only
+// connects to a host and port. Only the user running ghostferry can connect
+// to the private socket, unlike to a local TCP port, through which any local
+// user could log in as that user, e.g. with auth_socket.
+type SocketRelay struct {
+	socket   string
+	dir      string
+	listener net.Listener
+	logger   *logrus.Entry
+}
+
+// OpenSocketRelay starts forwarding the connections to a private socket to
+// the socket
+func OpenSocketRelay(socket string, logger *logrus.Entry) (*SocketRelay, error) {
+	if logger == nil {
+		logger = logrus.WithField("tag", "socket_relay")
+	}
+
+	// the directory is only accessible by the current user
+	dir, err := ioutil.TempDir("", "ghostferry-relay")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "mysqld.sock:"+strconv.Itoa(socketRelayPort))
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if err = os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	r := &SocketRelay{
+		socket:   socket,
+		dir:      dir,
+		listener: listener,
+		logger:   logger,
+	}
+
+	r.logger.WithField("local", path).Infof("forwarding connections to %s", socket)
+	go r.acceptConnections()
+	return r, nil
+}
+
+// LocalAddr returns the host and port to give the binlog replication client
+// instead of the socket, which together form the path of the private socket
+func (r *SocketRelay) LocalAddr() (string, uint16) {
+	return filepath.Join(r.dir, "mysqld.sock"), socketRelayPort
+}
+
+func (r *SocketRelay) Close() error {
+	err := r.listener.Close()
+	if removeErr := os.RemoveAll(r.dir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (r *SocketRelay) acceptConnections() {
+	for {
+		local, err := r.listener.Accept()
+		if err != nil {
+			// the listener was closed
+			return
+		}
+
+		go r.forward(local)
+	}
+}
+
+func (r *SocketRelay) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := net.Dial("unix", r.socket)
+	if err != nil {
+		r.logger.WithError(err).Errorf("failed to connect to %s", r.socket)
+		return
+	}
+	defer remote.Close()
+
+	pipeConnections(local, remote)
+}
@@ -3,21 +3,83 @@ package sqlwrapper
 import (
 	"context"
 	sqlorig "database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 type DB struct {
 	*sqlorig.DB
 	marginalia string
+
+	// if non-zero, statements executed through the wrapper are cancelled
+	// once they run for longer than this
+	queryTimeout time.Duration
+
+	// if non-zero, LogIfSlow reports statements running longer than this
+	slowQueryThreshold time.Duration
+	slowQueryLogger    *logrus.Entry
 }
 
 type Tx struct {
 	*sqlorig.Tx
+	marginalia   string
+	queryTimeout time.Duration
+}
+
+type Conn struct {
+	*sqlorig.Conn
 	marginalia string
 }
 
 func Open(driverName, dataSourceName, marginalia string) (*DB, error) {
 	sqlDB, err := sqlorig.Open(driverName, dataSourceName)
-	return &DB{sqlDB, marginalia}, err
+	return &DB{DB: sqlDB, marginalia: marginalia}, err
+}
+
+func OpenDB(connector driver.Connector, marginalia string) *DB {
+	return &DB{DB: sqlorig.OpenDB(connector), marginalia: marginalia}
+}
+
+func (db *DB) SetQueryTimeout(timeout time.Duration) {
+	db.queryTimeout = timeout
+}
+
+func (db *DB) SetSlowQueryLog(threshold time.Duration, logger *logrus.Entry) {
+	db.slowQueryThreshold = threshold
+	db.slowQueryLogger = logger
+}
+
+// QueryTimeoutContext derives a context from the given one that expires
+// after the configured query timeout. The returned cancel function must
+// always be called once the statement (including reading its rows) is done.
+func (db *DB) QueryTimeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db == nil || db.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
+
+// LogIfSlow logs a warning if more than the configured slow-query threshold
+// has passed since start. It is meant to be deferred right before running a
+// statement:
+//
+//	defer db.LogIfSlow(time.Now(), "row batch write", logrus.Fields{...})
+//
+// NOTE: The description and fields should not contain row data, as it may be
+// confidential.
+func (db *DB) LogIfSlow(start time.Time, description string, fields logrus.Fields) {
+	if db == nil || db.slowQueryThreshold <= 0 || db.slowQueryLogger == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < db.slowQueryThreshold {
+		return
+	}
+
+	db.slowQueryLogger.WithFields(fields).WithField("duration", elapsed).Warnf("slow query: %s", description)
 }
 
 func (db DB) PrepareContext(ctx context.Context, query string) (*sqlorig.Stmt, error) {
@@ -25,6 +87,8 @@ func (db DB) PrepareContext(ctx context.Context, query string) (*sqlorig.Stmt, e
 }
 
 func (db DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sqlorig.Result, error) {
+	ctx, cancel := db.QueryTimeoutContext(ctx)
+	defer cancel()
 	return db.DB.ExecContext(ctx, Annotate(query, db.marginalia), args...)
 }
 
@@ -33,7 +97,7 @@ func (db DB) QueryContext(ctx context.Context, query string, args ...interface{}
 }
 
 func (db DB) Exec(query string, args ...interface{}) (sqlorig.Result, error) {
-	return db.DB.Exec(Annotate(query, db.marginalia), args...)
+	return db.ExecContext(context.Background(), query, args...)
 }
 
 func (db DB) Prepare(query string) (*sqlorig.Stmt, error) {
@@ -54,15 +118,27 @@ func (db DB) QueryRowContext(ctx context.Context, query string, args ...interfac
 
 func (db DB) Begin() (*Tx, error) {
 	tx, err := db.DB.Begin()
-	return &Tx{tx, db.marginalia}, err
+	return &Tx{Tx: tx, marginalia: db.marginalia, queryTimeout: db.queryTimeout}, err
+}
+
+// ReserveConn reserves a connection of the pool, which is only released once
+// it is closed. Unlike the Conn of the pool, its statements are annotated.
+func (db DB) ReserveConn(ctx context.Context) (*Conn, error) {
+	conn, err := db.DB.Conn(ctx)
+	return &Conn{Conn: conn, marginalia: db.marginalia}, err
 }
 
 func (tx Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sqlorig.Result, error) {
+	if tx.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tx.queryTimeout)
+		defer cancel()
+	}
 	return tx.Tx.ExecContext(ctx, Annotate(query, tx.marginalia), args...)
 }
 
 func (tx Tx) Exec(query string, args ...interface{}) (sqlorig.Result, error) {
-	return tx.Tx.Exec(Annotate(query, tx.marginalia), args...)
+	return tx.ExecContext(context.Background(), query, args...)
 }
 
 func (tx Tx) Prepare(query string) (*sqlorig.Stmt, error) {
@@ -89,6 +165,18 @@ func (tx Tx) QueryRow(query string, args ...interface{}) *sqlorig.Row {
 	return tx.Tx.QueryRow(query, args...)
 }
 
+func (c Conn) Prepare(query string) (*sqlorig.Stmt, error) {
+	return c.Conn.PrepareContext(context.Background(), Annotate(query, c.marginalia))
+}
+
+func (c Conn) PrepareContext(ctx context.Context, query string) (*sqlorig.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, Annotate(query, c.marginalia))
+}
+
+func (c Conn) QueryRow(query string, args ...interface{}) *sqlorig.Row {
+	return c.Conn.QueryRowContext(context.Background(), query, args...)
+}
+
 func Annotate(query, marginalia string) string {
 	return marginalia + query
 }
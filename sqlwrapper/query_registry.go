@@ -0,0 +1,100 @@
+package sqlwrapper
+
+import (
+	sqlorig "database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunningQuery is a statement in flight on the MySQL connection with the
+// given id
+type RunningQuery struct {
+	ConnectionId uint64
+	Description  string
+	StartedAt    time.Time
+}
+
+// Connection runs all its statements on the same MySQL connection, as a Tx
+// or a Conn do
+type Connection interface {
+	QueryRow(query string, args ...interface{}) *sqlorig.Row
+}
+
+// QueryRegistry keeps track of the MySQL connections running the statements
+// registered with it, such that they can be killed with KILL QUERY.
+type QueryRegistry struct {
+	mutex   sync.Mutex
+	nextId  uint64
+	queries map[uint64]RunningQuery
+}
+
+func NewQueryRegistry() *QueryRegistry {
+	return &QueryRegistry{queries: make(map[uint64]RunningQuery)}
+}
+
+// Track registers the statement about to be executed on the connection,
+// looking up its id. The returned function must be called once the statement
+// (including reading its rows) is done, and before the connection is
+// released to be reused by other statements.
+func (r *QueryRegistry) Track(conn Connection, description string) (untrack func(), err error) {
+	var connectionId uint64
+	err = conn.QueryRow("SELECT CONNECTION_ID()").Scan(&connectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Add(RunningQuery{
+		ConnectionId: connectionId,
+		Description:  description,
+		StartedAt:    time.Now(),
+	}), nil
+}
+
+// Add registers a statement running on a connection with a known id. The
+// returned function must be called once the statement is done.
+func (r *QueryRegistry) Add(query RunningQuery) (remove func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.nextId++
+	id := r.nextId
+	r.queries[id] = query
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.queries, id)
+	}
+}
+
+// Running returns the statements in flight, the longest running first
+func (r *QueryRegistry) Running() []RunningQuery {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.running()
+}
+
+// WithRunning calls f with the statements in flight, the longest running
+// first. The statements cannot be removed until f returns, such that their
+// connections are not reused by other statements in the meantime, e.g. to
+// kill them safely.
+func (r *QueryRegistry) WithRunning(f func([]RunningQuery)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	f(r.running())
+}
+
+func (r *QueryRegistry) running() []RunningQuery {
+	queries := make([]RunningQuery, 0, len(r.queries))
+	for _, query := range r.queries {
+		queries = append(queries, query)
+	}
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].StartedAt.Before(queries[j].StartedAt)
+	})
+	return queries
+}
@@ -0,0 +1,283 @@
+package ghostferry
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type SSHTunnelConfig struct {
+	// The bastion host to tunnel the connections through
+	Host string
+
+	// Optional: defaults to 22
+	Port uint16
+
+	// The user to log into the bastion host as
+	User string
+
+	// The path of the private key to authenticate with. The key must not be
+	// protected by a passphrase.
+	KeyPath string
+
+	// The path of the known_hosts file used to verify the host key of the
+	// bastion host.
+	//
+	// Optional: defaults to ~/.ssh/known_hosts
+	KnownHostsPath string
+}
+
+func (c *SSHTunnelConfig) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("host is empty")
+	}
+
+	if c.Port == 0 {
+		c.Port = 22
+	}
+
+	if c.User == "" {
+		return fmt.Errorf("user is empty")
+	}
+
+	if c.KeyPath == "" {
+		return fmt.Errorf("KeyPath is empty")
+	}
+
+	if c.KnownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("KnownHostsPath is empty and the home directory is unknown: %v", err)
+		}
+		c.KnownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	return nil
+}
+
+func (c *SSHTunnelConfig) clientConfig() (*ssh.ClientConfig, error) {
+	key, err := ioutil.ReadFile(c.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %v", c.KeyPath, err)
+	}
+
+	hostKeyCallback, err := knownhosts.New(c.KnownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid known_hosts %s: %v", c.KnownHostsPath, err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// SSHTunnel forwards the connections to a local port to a database through a
+// bastion host, like ssh -L, such that the MySQL driver and the binlog
+// replication client can both connect to the database through it.
+type SSHTunnel struct {
+	config     *SSHTunnelConfig
+	remoteAddr string
+	logger     *logrus.Entry
+
+	clientMutex sync.Mutex
+	client      *ssh.Client
+	listener    net.Listener
+}
+
+// OpenSSHTunnel connects to the bastion host and starts forwarding the
+// connections to a random local port to remoteAddr (host:port)
+func OpenSSHTunnel(config *SSHTunnelConfig, remoteAddr string, logger *logrus.Entry) (*SSHTunnel, error) {
+	if logger == nil {
+		logger = logrus.WithField("tag", "ssh_tunnel")
+	}
+
+	t := &SSHTunnel{
+		config:     config,
+		remoteAddr: remoteAddr,
+		logger:     logger.WithField("bastion", net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))),
+	}
+
+	if _, err := t.sshClient(); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.client.Close()
+		return nil, err
+	}
+	t.listener = listener
+
+	t.logger.WithField("local", listener.Addr().String()).Infof("forwarding connections to %s", remoteAddr)
+	go t.acceptConnections()
+	return t, nil
+}
+
+// LocalAddr returns the local address of the tunnel to connect to instead of
+// the database
+func (t *SSHTunnel) LocalAddr() (string, uint16) {
+	addr := t.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), uint16(addr.Port)
+}
+
+func (t *SSHTunnel) Close() error {
+	err := t.listener.Close()
+
+	t.clientMutex.Lock()
+	defer t.clientMutex.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+	return err
+}
+
+func (t *SSHTunnel) acceptConnections() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			// the listener was closed
+			return
+		}
+
+		go t.forward(local)
+	}
+}
+
+func (t *SSHTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.dialRemote()
+	if err != nil {
+		t.logger.WithError(err).Errorf("failed to connect to %s through the bastion host", t.remoteAddr)
+		return
+	}
+	defer remote.Close()
+
+	pipeConnections(local, remote)
+}
+
+// pipeConnections copies the data between the connections until either of
+// them is closed
+func pipeConnections(local, remote net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// dialRemote connects to the database through the bastion host, reconnecting
+// to the bastion host once if the SSH connection was lost
+func (t *SSHTunnel) dialRemote() (net.Conn, error) {
+	client, err := t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := client.Dial("tcp", t.remoteAddr)
+	if err == nil {
+		return remote, nil
+	}
+
+	t.logger.WithError(err).Warn("reconnecting to the bastion host")
+	t.resetClient(client)
+
+	client, err = t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", t.remoteAddr)
+}
+
+func (t *SSHTunnel) sshClient() (*ssh.Client, error) {
+	t.clientMutex.Lock()
+	defer t.clientMutex.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	clientConfig, err := t.config.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", net.JoinHostPort(t.config.Host, strconv.Itoa(int(t.config.Port))), clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bastion host: %v", err)
+	}
+
+	t.client = client
+	return client, nil
+}
+
+func (t *SSHTunnel) resetClient(client *ssh.Client) {
+	t.clientMutex.Lock()
+	defer t.clientMutex.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// databaseTunnels holds the SSHTunnel or SocketRelay of a DatabaseConfig,
+// which are opened on first use, see DatabaseConfig.DialAddress
+type databaseTunnels struct {
+	mutex       sync.Mutex
+	sshTunnel   *SSHTunnel
+	socketRelay *SocketRelay
+}
+
+// guards the creation of the databaseTunnels of the DatabaseConfigs
+var databaseTunnelsMutex sync.Mutex
+
+func (c *DatabaseConfig) sharedTunnels() *databaseTunnels {
+	databaseTunnelsMutex.Lock()
+	defer databaseTunnelsMutex.Unlock()
+
+	if c.tunnels == nil {
+		c.tunnels = &databaseTunnels{}
+	}
+	return c.tunnels
+}
+
+func (t *databaseTunnels) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var err error
+	if t.sshTunnel != nil {
+		err = t.sshTunnel.Close()
+		t.sshTunnel = nil
+	}
+	if t.socketRelay != nil {
+		if relayErr := t.socketRelay.Close(); err == nil {
+			err = relayErr
+		}
+		t.socketRelay = nil
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/sirupsen/logrus"
+)
+
+// how long the source is given to stream the first transaction not in a GTID
+// set, before the set is considered to hold all transactions of the source if
+// the source did not write any in the meantime
+const gtidSetPositionTimeout = 5 * time.Second
+
+// StartFromPosition sets the state to resume from to the start position of
+// the StartPosition config, with all tables copied, such that only the
+// binlogs are streamed from there. It fails if the binlogs of the source no
+// longer reach back to the position. It is called by Start, unless resuming.
+func (f *Ferry) StartFromPosition() error {
+	config := f.Config.StartPosition
+
+	var pos mysql.Position
+	var err error
+	if config.GTIDSet != "" {
+		pos, err = f.BinlogStreamer.FindGTIDSetPosition(config.GTIDSet)
+		if err != nil {
+			return fmt.Errorf("finding the position of GTID set %s: %v", config.GTIDSet, err)
+		}
+	} else {
+		pos = *config.BinlogPosition
+	}
+
+	err = CheckBinlogPositionAvailable(f.SourceDB, pos)
+	if err != nil {
+		return err
+	}
+
+	f.logger.WithFields(logrus.Fields{
+		"position": pos,
+		"gtid_set": config.GTIDSet,
+	}).Warn("starting from the given position without copying rows, the target must already hold them")
+
+	for _, table := range f.Tables.AsSlice() {
+		f.StateTracker.MarkTableAsCompleted(table.String())
+	}
+
+	binlogPosition := NewResumableBinlogPosition(pos)
+	f.StateTracker.UpdateLastWrittenBinlogPosition(binlogPosition)
+	f.StateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(binlogPosition)
+	if err = f.StateTracker.SerializeToDB(f.stateTablesDB()); err != nil {
+		return err
+	}
+
+	f.StateToResumeFrom = f.StateTracker.Serialize(f.Tables, nil)
+	return nil
+}
+
+// CheckBinlogPositionAvailable returns an error if the binlogs of the
+// database do not contain the position, e.g. as they were purged already.
+func CheckBinlogPositionAvailable(db *sql.DB, pos mysql.Position) error {
+	binaryLogs, err := ShowBinaryLogs(db)
+	if err != nil {
+		return err
+	}
+
+	for _, binaryLog := range binaryLogs {
+		if binaryLog.Name == pos.Name {
+			if uint64(pos.Pos) > binaryLog.Size {
+				return fmt.Errorf("binlog position %s is beyond the end of %s (%d bytes)", pos, binaryLog.Name, binaryLog.Size)
+			}
+			return nil
+		}
+	}
+
+	if len(binaryLogs) > 0 && (mysql.Position{Name: pos.Name}).Compare(mysql.Position{Name: binaryLogs[0].Name}) < 0 {
+		return fmt.Errorf("binlog position %s is no longer available, the oldest binlog of the source is %s", pos, binaryLogs[0].Name)
+	}
+	return fmt.Errorf("binlog position %s does not exist on the source", pos)
+}
+
+// BinaryLog is a binlog file kept by a database
+type BinaryLog struct {
+	Name string
+	Size uint64
+}
+
+// ShowBinaryLogs returns the binlog files of the database, oldest first
+func ShowBinaryLogs(db *sql.DB) ([]BinaryLog, error) {
+	rows, err := db.Query("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, fmt.Errorf("listing binary logs: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	binaryLogs := make([]BinaryLog, 0)
+	for rows.Next() {
+		// MySQL 8.0 also lists whether the file is encrypted
+		var binaryLog BinaryLog
+		values := make([]interface{}, len(columns))
+		values[0] = &binaryLog.Name
+		values[1] = &binaryLog.Size
+		for i := 2; i < len(values); i++ {
+			values[i] = new(interface{})
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		binaryLogs = append(binaryLogs, binaryLog)
+	}
+	return binaryLogs, rows.Err()
+}
+
+// FindGTIDSetPosition returns the binlog coordinates of the first transaction
+// of the source that is not in the GTID set, by having the source stream the
+// binlogs from the GTID set. The source fails to do so if it purged binlogs
+// with transactions missing from the set.
+func (s *BinlogStreamer) FindGTIDSetPosition(gtidSet string) (mysql.Position, error) {
+	s.ensureLogger()
+
+	gset, err := mysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	// if the source does not stream any transaction, the set holds all of
+	// them, and streaming starts from the current position
+	currentPosition, err := ShowMasterStatusBinlogPosition(s.DB)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	err = s.createBinlogSyncer()
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	defer s.binlogSyncer.Close()
+
+	streamer, err := s.binlogSyncer.StartSyncGTID(gset)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gtidSetPositionTimeout)
+	defer cancel()
+
+	var fileName string
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err == context.DeadlineExceeded {
+			// the set holds all transactions of the source only if the
+			// source did not write any since
+			position, err := ShowMasterStatusBinlogPosition(s.DB)
+			if err != nil {
+				return mysql.Position{}, err
+			}
+			if position.Compare(currentPosition) != 0 {
+				return mysql.Position{}, fmt.Errorf("no transaction missing from the GTID set was streamed within %s, although the source moved from %s to %s", gtidSetPositionTimeout, currentPosition, position)
+			}
+			return currentPosition, nil
+		}
+		if err != nil {
+			return mysql.Position{}, err
+		}
+
+		switch e := ev.Event.(type) {
+		case *replication.RotateEvent:
+			fileName = string(e.NextLogName)
+		case *replication.GTIDEvent:
+			return mysql.Position{Name: fileName, Pos: ev.Header.LogPos - ev.Header.EventSize}, nil
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package ghostferry
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateEncryptionAlgorithm marks a state encrypted with the
+// StateEncryptionConfig
+const StateEncryptionAlgorithm = "AES-GCM"
+
+const kmsRequestTimeout = 30 * time.Second
+
+// EncryptedState is the JSON written instead of the state when the state is
+// encrypted. It is distinguished from a plain state by its Encryption field.
+type EncryptedState struct {
+	Encryption string
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// LoadKey reads the key from the environment, or decrypts it with KMS. The
+// key is only loaded once.
+func (c *StateEncryptionConfig) LoadKey() error {
+	if c.key != nil {
+		return nil
+	}
+
+	var key []byte
+	var err error
+	if c.KeyEnv != "" {
+		encodedKey := os.Getenv(c.KeyEnv)
+		if encodedKey == "" {
+			return fmt.Errorf("%s is not set", c.KeyEnv)
+		}
+		key, err = base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return fmt.Errorf("invalid key in %s: %v", c.KeyEnv, err)
+		}
+	} else {
+		key, err = c.decryptKMSKey()
+		if err != nil {
+			return fmt.Errorf("decrypting KMSEncryptedKey: %v", err)
+		}
+	}
+
+	// rejects keys of invalid lengths
+	if _, err = aes.NewCipher(key); err != nil {
+		return err
+	}
+	c.key = key
+	return nil
+}
+
+// Encrypt encrypts the state JSON into the JSON of an EncryptedState
+func (c *StateEncryptionConfig) Encrypt(stateJSON string) (string, error) {
+	aead, err := c.aead()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	encrypted, err := json.Marshal(EncryptedState{
+		Encryption: StateEncryptionAlgorithm,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, []byte(stateJSON), nil),
+	})
+	return string(encrypted), err
+}
+
+// Decrypt decrypts the JSON of an EncryptedState into the state JSON
+func (c *StateEncryptionConfig) Decrypt(encrypted *EncryptedState) ([]byte, error) {
+	if encrypted.Encryption != StateEncryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported state encryption %s", encrypted.Encryption)
+	}
+
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce of the encrypted state")
+	}
+
+	stateJSON, err := aead.Open(nil, encrypted.Nonce, encrypted.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the state failed, check the key: %v", err)
+	}
+	return stateJSON, nil
+}
+
+func (c *StateEncryptionConfig) aead() (cipher.AEAD, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("no StateEncryption configured")
+	}
+	if err := c.LoadKey(); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// DecodeState reads a state dump to resume from, decrypting it if it was
+// encrypted. States that are not encrypted are read even if StateEncryption
+// is configured, e.g. when starting to encrypt the state of a run.
+func DecodeState(r io.Reader, encryption *StateEncryptionConfig) (*SerializableState, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := &EncryptedState{}
+	if err = json.Unmarshal(data, encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Encryption != "" {
+		if !encryption.Enabled() {
+			return nil, fmt.Errorf("the state is encrypted, but no StateEncryption is configured")
+		}
+		data, err = encryption.Decrypt(encrypted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := &SerializableState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// encryptStateDump encrypts the state JSON to be written to a file or stdout
+// if StateEncryption is configured
+func (f *Ferry) encryptStateDump(stateJSON string) (string, error) {
+	if !f.Config.StateEncryption.Enabled() {
+		return stateJSON, nil
+	}
+	return f.Config.StateEncryption.Encrypt(stateJSON)
+}
+
+// decryptKMSKey decrypts the KMSEncryptedKey with the Decrypt action of the
+// KMS API, signed with AWS Signature Version 4
+func (c *StateEncryptionConfig) decryptKMSKey() ([]byte, error) {
+	provider, err := NewAWSCredentialsProvider(context.Background(), c.KMSRegion)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := RetrieveAWSCredentials(context.Background(), provider)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := c.KMSEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", c.KMSRegion)
+	}
+	uri, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMSEndpoint specified: %v", err)
+	}
+
+	// the key is sent as is, as it is already base64-encoded
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": c.KMSEncryptedKey})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", uri.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	SignAWSRequest(req, body, c.KMSRegion, "kms", credentials, time.Now())
+
+	client := &http.Client{Timeout: kmsRequestTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	responseBody, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KMS returned status %d: %s", res.StatusCode, bytes.TrimSpace(responseBody))
+	}
+
+	var response struct {
+		Plaintext []byte
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("parsing KMS response: %v", err)
+	}
+	return response.Plaintext, nil
+}
+
+// SignAWSRequest adds the headers authenticating the request to the service
+// with AWS Signature Version 4, see BuildRDSAuthToken for presigned URLs
+func SignAWSRequest(req *http.Request, body []byte, region, service string, credentials AWSCredentials, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+
+	req.Header.Set("X-Amz-Date", timestamp)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	// only the headers set so far are signed, which are all single-valued
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	sort.Strings(headers)
+
+	canonicalHeaders := make([]string, len(headers))
+	for i, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders[i] = name + ":" + strings.TrimSpace(value) + "\n"
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		strings.Join(canonicalHeaders, ""),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		timestamp,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := AWSSigningKey(credentials, date, region, service)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.AccessKeyId, scope, signedHeaders, signature))
+}
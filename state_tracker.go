@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,6 +45,49 @@ type SerializableState struct {
 	LastWrittenBinlogPosition                 BinlogPosition
 	LastStoredBinlogPositionForInlineVerifier BinlogPosition
 	BinlogVerifyStore                         BinlogVerifySerializedStore
+
+	// The completed tables whose rows were not copied, see
+	// Config.StreamOnlyTables
+	StreamOnlyTables map[string]bool `json:",omitempty"`
+
+	// The tables reset to be copied again, see Config.TableRecopy
+	RecopiedTables map[string]bool `json:",omitempty"`
+
+	// The tables given up on with the errors that failed them, which stay
+	// quarantined when resuming, see TableQuarantine
+	QuarantinedTables map[string]string `json:",omitempty"`
+
+	// The fingerprint of the config the run was started with, see
+	// Config.ResumeConfigMismatchPolicy
+	ConfigFingerprint map[string]string `json:",omitempty"`
+
+	// The ranges of the tables whose copy is split into several ranges of
+	// their pagination keys, see Config.KeyRangeSplit. The
+	// LastSuccessfulPaginationKeys of these tables are the positions up to
+	// which all of their ranges are copied.
+	KeyRanges map[string][]*KeyRange `json:",omitempty"`
+
+	// The state of data copies run in addition to the main copy, by name,
+	// see Ferry.RunResumableDataCopy
+	DeltaCopies map[string]*DeltaCopyState `json:",omitempty"`
+
+	// The triggers dropped from the target to be created again before the
+	// cutover, see Config.TargetTriggerPolicy
+	DroppedTargetTriggers []TargetTrigger `json:",omitempty"`
+
+	// The binlog events around the time the state was dumped, for
+	// post-mortems only and ignored when resuming, see
+	// Config.StateDumpBinlogEvents
+	RecentBinlogEvents *BinlogEventHistorySnapshot `json:",omitempty"`
+}
+
+type DeltaCopyState struct {
+	LastSuccessfulPaginationKeys map[string]*PaginationKeyData
+	CompletedTables              map[string]bool
+
+	// The position of the source when the copy started, see
+	// StateTracker.DeltaCopyStateTracker
+	SourcePosition mysql.Position
 }
 
 func (s *SerializableState) MinBinlogPosition() BinlogPosition {
@@ -92,13 +136,42 @@ type StateTracker struct {
 
 	lastSuccessfulPaginationKeys map[string]*PaginationKeyData
 	completedTables              map[string]bool
+	streamOnlyTables             map[string]bool
+	recopiedTables               map[string]bool
 	tableLocks                   map[string]*sync.RWMutex
+	deltaCopies                  map[string]*StateTracker
+	droppedTargetTriggers        []TargetTrigger
+
+	// the position of the source when the delta copy tracked by this
+	// tracker started, see DeltaCopyStateTracker
+	deltaCopySourcePosition mysql.Position
+
+	// the ranges of the tables split by key range, see SetKeyRanges
+	keyRanges map[string][]*KeyRange
+
+	// how often the tables were truncated and which schema change they had
+	// last during their copy, and the locks keeping them from being
+	// truncated or changed while batches are written, see TruncateTable and
+	// ChangeTableSchema
+	tableCopyVersions map[string]TableCopyVersion
+	lastSchemaChange  uint64
+	truncationLocks   map[string]*sync.RWMutex
+
+	// called around a table being marked as completed, see
+	// AddTableCompletionHook
+	tableCompletionHooks []TableCompletionHook
 
 	// optional database+table prefix to which we write the current status
 	stateTablesPrefix string
+	// the state tables are written by the coordinator of a distributed
+	// copy, and the copy state of this worker with the batches it writes,
+	// see DistributedCopyConfig
+	sharedState bool
 
 	logger            *logrus.Entry
 	iterationSpeedLog *ring.Ring
+
+	incrediblyVerboseLogging bool
 }
 
 func NewStateTracker(speedLogCount int) *StateTracker {
@@ -108,7 +181,13 @@ func NewStateTracker(speedLogCount int) *StateTracker {
 
 		lastSuccessfulPaginationKeys: make(map[string]*PaginationKeyData),
 		completedTables:              make(map[string]bool),
+		streamOnlyTables:             make(map[string]bool),
+		recopiedTables:               make(map[string]bool),
 		tableLocks:                   make(map[string]*sync.RWMutex),
+		deltaCopies:                  make(map[string]*StateTracker),
+		keyRanges:                    make(map[string][]*KeyRange),
+		tableCopyVersions:            make(map[string]TableCopyVersion),
+		truncationLocks:              make(map[string]*sync.RWMutex),
 		logger:                       logrus.WithField("tag", "state_tracker"),
 		iterationSpeedLog:            newSpeedLogRing(speedLogCount),
 	}
@@ -122,6 +201,13 @@ func NewStateTrackerFromSerializedState(speedLogCount int, serializedState *Seri
 	s.completedTables = serializedState.CompletedTables
 	s.lastWrittenBinlogPosition = serializedState.LastWrittenBinlogPosition
 	s.lastStoredBinlogPositionForInlineVerifier = serializedState.LastStoredBinlogPositionForInlineVerifier
+	s.droppedTargetTriggers = serializedState.DroppedTargetTriggers
+	if serializedState.StreamOnlyTables != nil {
+		s.streamOnlyTables = serializedState.StreamOnlyTables
+	}
+	if serializedState.RecopiedTables != nil {
+		s.recopiedTables = serializedState.RecopiedTables
+	}
 
 	for tableName, paginationKeyData := range s.lastSuccessfulPaginationKeys {
 		table := tables[tableName]
@@ -136,6 +222,38 @@ func NewStateTrackerFromSerializedState(speedLogCount int, serializedState *Seri
 		s.lastSuccessfulPaginationKeys[tableName] = unmarshalledPaginationKeyData
 	}
 
+	for tableName, keyRanges := range serializedState.KeyRanges {
+		table := tables[tableName]
+		if table == nil {
+			return nil, fmt.Errorf("resume state contains key ranges for unknown table %s", tableName)
+		}
+
+		unmarshalledKeyRanges, err := unmarshalKeyRanges(keyRanges, table)
+		if err != nil {
+			return nil, err
+		}
+		s.keyRanges[tableName] = unmarshalledKeyRanges
+	}
+
+	for name, deltaCopyState := range serializedState.DeltaCopies {
+		deltaCopy, err := NewStateTrackerFromSerializedState(speedLogCount, &SerializableState{
+			LastSuccessfulPaginationKeys: deltaCopyState.LastSuccessfulPaginationKeys,
+			CompletedTables:              deltaCopyState.CompletedTables,
+		}, tables)
+		if err != nil {
+			return nil, fmt.Errorf("delta copy %s: %v", name, err)
+		}
+		if deltaCopy.lastSuccessfulPaginationKeys == nil {
+			deltaCopy.lastSuccessfulPaginationKeys = make(map[string]*PaginationKeyData)
+		}
+		if deltaCopy.completedTables == nil {
+			deltaCopy.completedTables = make(map[string]bool)
+		}
+		deltaCopy.logger = s.logger.WithField("delta_copy", name)
+		deltaCopy.deltaCopySourcePosition = deltaCopyState.SourcePosition
+		s.deltaCopies[name] = deltaCopy
+	}
+
 	return s, nil
 }
 
@@ -143,9 +261,13 @@ func NewStateTrackerFromTargetDB(f *Ferry) (s *StateTracker, state *Serializable
 	s = NewStateTracker(f.DataIterationConcurrency*10)
 	s.stateTablesPrefix = fmt.Sprintf("%s._ghostferry_%d_", f.Config.ResumeStateFromDB, f.MyServerId)
 
+	s.sharedState = f.Config.DistributedCopy.IsWorker()
+
 	state, err = s.readStateFromDB(f)
-	if err == nil && state == nil {
-		err = s.initializeDBStateSchema(f.TargetDB, f.Config.ResumeStateFromDB)
+	if err == nil && state == nil && s.sharedState {
+		err = fmt.Errorf("the state tables %s* do not exist, the coordinator of the distributed copy must be started before the workers", s.stateTablesPrefix)
+	} else if err == nil && state == nil {
+		err = s.initializeDBStateSchema(f.stateTablesDB(), f.Config.ResumeStateFromDB)
 
 		s.logger.Debug("initializing resume state from binlog position on source DB")
 		masterPos, posErr := ShowMasterStatusBinlogPosition(f.SourceDB)
@@ -163,7 +285,7 @@ func NewStateTrackerFromTargetDB(f *Ferry) (s *StateTracker, state *Serializable
 		// DB here, or we may end up never writing the state to the target DB state
 		// tables, meaning that we resume at an invalid position although we already
 		// started copying table rows
-		s.SerializeToDB(f.TargetDB)
+		s.SerializeToDB(f.stateTablesDB())
 	}
 
 	return
@@ -177,6 +299,13 @@ func (s *StateTracker) UpdateLastWrittenBinlogPosition(pos BinlogPosition) {
 	s.lastWrittenBinlogPosition = pos
 }
 
+func (s *StateTracker) LastWrittenBinlogPosition() BinlogPosition {
+	s.BinlogRWMutex.RLock()
+	defer s.BinlogRWMutex.RUnlock()
+
+	return s.lastWrittenBinlogPosition
+}
+
 func (s *StateTracker) UpdateLastStoredBinlogPositionForInlineVerifier(pos BinlogPosition) {
 	s.BinlogRWMutex.Lock()
 	defer s.BinlogRWMutex.Unlock()
@@ -190,19 +319,28 @@ func (s *StateTracker) UpdateLastSuccessfulPaginationKey(table string, paginatio
 	defer s.CopyRWMutex.Unlock()
 
 	s.logger.WithField("table", table).Debugf("updating table last successful pagination key")
-	if IncrediblyVerboseLogging {
+	if s.incrediblyVerboseLogging {
 		s.logger.WithField("table", table).Debugf("updating table last successful pagination key: %s", paginationKey)
 	}
 
+	previousPaginationKey := s.lastSuccessfulPaginationKeys[table]
+	if keyRanges, split := s.keyRanges[table]; split {
+		keyRange := keyRangeContaining(keyRanges, paginationKey)
+		previousPaginationKey = keyRange.LastSuccessfulPaginationKey
+		keyRange.LastSuccessfulPaginationKey = paginationKey
+		s.lastSuccessfulPaginationKeys[table] = copiedUpTo(keyRanges)
+	} else {
+		s.lastSuccessfulPaginationKeys[table] = paginationKey
+	}
+
 	var deltaPaginationKey uint64
-	if s.lastSuccessfulPaginationKeys[table] != nil {
+	if previousPaginationKey != nil {
 		if progress, ok := paginationKey.ProgressData(); ok {
-			if base, ok := s.lastSuccessfulPaginationKeys[table].ProgressData(); ok {
+			if base, ok := previousPaginationKey.ProgressData(); ok {
 				deltaPaginationKey = progress - base
 			}
 		}
 	}
-	s.lastSuccessfulPaginationKeys[table] = paginationKey
 
 	s.updateSpeedLog(deltaPaginationKey)
 }
@@ -220,12 +358,165 @@ func (s *StateTracker) LastSuccessfulPaginationKey(table string) (paginationKeyD
 	return paginationKey, false
 }
 
-func (s *StateTracker) MarkTableAsCompleted(table string) {
+// TableCompletionHook is called around the transition of a table to
+// completed, once per table. The hooks are called without holding the locks
+// of the StateTracker.
+type TableCompletionHook interface {
+	BeforeTableCompleted(table string)
+	AfterTableCompleted(table string)
+}
+
+// AddTableCompletionHook adds a hook called whenever a table is marked as
+// completed from now on. Not safe to call concurrently with
+// MarkTableAsCompleted.
+func (s *StateTracker) AddTableCompletionHook(hook TableCompletionHook) {
+	s.tableCompletionHooks = append(s.tableCompletionHooks, hook)
+}
+
+// AddDroppedTargetTrigger records a trigger dropped from the target, to be
+// created again before the cutover
+func (s *StateTracker) AddDroppedTargetTrigger(trigger TargetTrigger) {
 	s.CopyRWMutex.Lock()
 	defer s.CopyRWMutex.Unlock()
 
+	s.droppedTargetTriggers = append(s.droppedTargetTriggers, trigger)
+}
+
+// RemoveDroppedTargetTrigger forgets a trigger created again on the target
+func (s *StateTracker) RemoveDroppedTargetTrigger(trigger TargetTrigger) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	for i, dropped := range s.droppedTargetTriggers {
+		if dropped.Schema == trigger.Schema && dropped.Name == trigger.Name {
+			s.droppedTargetTriggers = append(s.droppedTargetTriggers[:i], s.droppedTargetTriggers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *StateTracker) DroppedTargetTriggers() []TargetTrigger {
+	s.CopyRWMutex.RLock()
+	defer s.CopyRWMutex.RUnlock()
+
+	return append([]TargetTrigger(nil), s.droppedTargetTriggers...)
+}
+
+func (s *StateTracker) MarkTableAsCompleted(table string) {
+	transition := len(s.tableCompletionHooks) > 0 && !s.IsTableComplete(table)
+	if transition {
+		for _, hook := range s.tableCompletionHooks {
+			hook.BeforeTableCompleted(table)
+		}
+	}
+
+	s.CopyRWMutex.Lock()
 	s.logger.WithField("table", table).Debug("marking table as completed")
 	s.completedTables[table] = true
+	// the copy of a recopied table is done, so asking for it again in a
+	// later resume copies it again
+	delete(s.recopiedTables, table)
+	s.CopyRWMutex.Unlock()
+
+	if transition {
+		for _, hook := range s.tableCompletionHooks {
+			hook.AfterTableCompleted(table)
+		}
+	}
+}
+
+// MarkTableAsStreamOnly marks the table as completed without copying its
+// rows, see Config.StreamOnlyTables. Unlike MarkTableAsCompleted, the
+// completion hooks are not called, as the table is not copied.
+func (s *StateTracker) MarkTableAsStreamOnly(table string) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithField("table", table).Debug("marking table as stream-only")
+	s.completedTables[table] = true
+	s.streamOnlyTables[table] = true
+}
+
+func (s *StateTracker) IsTableStreamOnly(table string) bool {
+	s.CopyRWMutex.RLock()
+	defer s.CopyRWMutex.RUnlock()
+
+	return s.streamOnlyTables[table]
+}
+
+// MarkTableAsRecopied records that the copy of the table was reset to copy
+// it again, see Config.TableRecopy
+func (s *StateTracker) MarkTableAsRecopied(table string) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.recopiedTables[table] = true
+}
+
+func (s *StateTracker) IsTableRecopied(table string) bool {
+	s.CopyRWMutex.RLock()
+	defer s.CopyRWMutex.RUnlock()
+
+	return s.recopiedTables[table]
+}
+
+// ResetTableCopy forgets the copy progress of the table, so it is copied
+// again from scratch. The batches read before are not written anymore, see
+// WriteCopyBatch.
+func (s *StateTracker) ResetTableCopy(table string) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithField("table", table).Debug("resetting table copy state")
+	delete(s.completedTables, table)
+	delete(s.streamOnlyTables, table)
+	delete(s.lastSuccessfulPaginationKeys, table)
+	delete(s.keyRanges, table)
+	s.changeTableCopyVersion(table)
+}
+
+// RenameTable moves the copy progress of the table to its new name,
+// replacing any progress of the new name
+func (s *StateTracker) RenameTable(from, to string) {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithFields(logrus.Fields{"table": from, "renamed_to": to}).Debug("renaming table copy state")
+	delete(s.completedTables, to)
+	if s.completedTables[from] {
+		s.completedTables[to] = true
+		delete(s.completedTables, from)
+	}
+
+	delete(s.streamOnlyTables, to)
+	if s.streamOnlyTables[from] {
+		s.streamOnlyTables[to] = true
+		delete(s.streamOnlyTables, from)
+	}
+
+	delete(s.lastSuccessfulPaginationKeys, to)
+	if paginationKey, found := s.lastSuccessfulPaginationKeys[from]; found {
+		s.lastSuccessfulPaginationKeys[to] = paginationKey
+		delete(s.lastSuccessfulPaginationKeys, from)
+	}
+
+	delete(s.keyRanges, to)
+	if keyRanges, found := s.keyRanges[from]; found {
+		s.keyRanges[to] = keyRanges
+		delete(s.keyRanges, from)
+	}
+
+	// the batches read under either name before are not written anymore,
+	// see WriteCopyBatch
+	s.tableCopyVersions[to] = s.tableCopyVersions[from]
+	s.changeTableCopyVersion(to)
+	s.changeTableCopyVersion(from)
+
+	// the locks are created again when needed
+	delete(s.tableLocks, from)
+	delete(s.tableLocks, to)
+	delete(s.truncationLocks, from)
+	delete(s.truncationLocks, to)
 }
 
 func (s *StateTracker) IsTableComplete(table string) bool {
@@ -235,6 +526,41 @@ func (s *StateTracker) IsTableComplete(table string) bool {
 	return s.completedTables[table]
 }
 
+// DeltaCopyStateTracker returns the state tracker of the data copy with the
+// given name, which tracks the copied tables separately from the main copy
+// but is serialized along with it.
+//
+// The copy of a table is only complete as long as the table is not written
+// to on the source, e.g. while the source is locked for the cutover. The
+// state of an earlier copy with the same name is therefore only continued
+// if the source is still at the position the copy started at, otherwise
+// the copy starts over.
+func (s *StateTracker) DeltaCopyStateTracker(name string, sourcePosition mysql.Position) *StateTracker {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	if deltaCopy, found := s.deltaCopies[name]; found {
+		if deltaCopy.deltaCopySourcePosition == sourcePosition {
+			return deltaCopy
+		}
+		s.logger.WithFields(logrus.Fields{
+			"delta_copy":      name,
+			"started_at":      deltaCopy.deltaCopySourcePosition,
+			"source_position": sourcePosition,
+		}).Warn("source was written to since the delta copy started, copying its tables again")
+	}
+
+	speedLogCount := 0
+	if s.iterationSpeedLog != nil {
+		speedLogCount = s.iterationSpeedLog.Len()
+	}
+	deltaCopy := NewStateTracker(speedLogCount)
+	deltaCopy.logger = s.logger.WithField("delta_copy", name)
+	deltaCopy.deltaCopySourcePosition = sourcePosition
+	s.deltaCopies[name] = deltaCopy
+	return deltaCopy
+}
+
 func (s *StateTracker) GetTableLock(table string) *sync.RWMutex {
 	s.CopyRWMutex.Lock()
 	defer s.CopyRWMutex.Unlock()
@@ -327,11 +653,48 @@ func (s *StateTracker) Serialize(lastKnownTableSchemaCache TableSchemaCache, bin
 		state.CompletedTables[k] = v
 	}
 
+	if len(s.streamOnlyTables) > 0 {
+		state.StreamOnlyTables = make(map[string]bool)
+		for k, v := range s.streamOnlyTables {
+			state.StreamOnlyTables[k] = v
+		}
+	}
+
+	if len(s.recopiedTables) > 0 {
+		state.RecopiedTables = make(map[string]bool)
+		for k, v := range s.recopiedTables {
+			state.RecopiedTables[k] = v
+		}
+	}
+
+	if len(s.keyRanges) > 0 {
+		state.KeyRanges = make(map[string][]*KeyRange)
+		for k, v := range s.keyRanges {
+			state.KeyRanges[k] = copyKeyRanges(v)
+		}
+	}
+
+	if len(s.droppedTargetTriggers) > 0 {
+		state.DroppedTargetTriggers = append([]TargetTrigger(nil), s.droppedTargetTriggers...)
+	}
+
+	if len(s.deltaCopies) > 0 {
+		state.DeltaCopies = make(map[string]*DeltaCopyState)
+		for name, deltaCopy := range s.deltaCopies {
+			deltaCopyState := deltaCopy.Serialize(nil, nil)
+			state.DeltaCopies[name] = &DeltaCopyState{
+				LastSuccessfulPaginationKeys: deltaCopyState.LastSuccessfulPaginationKeys,
+				CompletedTables:              deltaCopyState.CompletedTables,
+				SourcePosition:               deltaCopy.deltaCopySourcePosition,
+			}
+		}
+	}
+
 	return state
 }
 
 func (s *StateTracker) SerializeToDB(db *sql.DB) error {
-	if s.stateTablesPrefix == "" {
+	if s.stateTablesPrefix == "" || s.sharedState {
 		return nil
 	}
 
@@ -370,7 +733,20 @@ func (s *StateTracker) SerializeToDB(db *sql.DB) error {
 	for tableName, lastPaginationKey := range s.lastSuccessfulPaginationKeys {
 		s.logger.Debugf("storing copy state for %s: %s", tableName, lastPaginationKey)
 
-		paginationSql, paginationArgs, err := s.GetStoreRowCopyPositionSql(tableName, lastPaginationKey)
+		// the ranges of a table split by key range are stored with their
+		// own positions
+		position := lastPaginationKey
+		if _, split := s.keyRanges[tableName]; split {
+			position = nil
+		}
+
+		paginationKeyData, err := s.rowCopyPositionData(tableName, position)
+		if err != nil {
+			s.logger.WithField("err", err).Errorf("generating copy-state sql for %s failed", tableName)
+			return err
+		}
+
+		paginationSql, paginationArgs, err := s.storeRowCopyPositionSql(tableName, paginationKeyData)
 		if err != nil {
 			s.logger.WithField("err", err).Errorf("generating copy-state sql for %s failed", tableName)
 			return err
@@ -503,7 +879,7 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 	}
 
 	var dummy uint64
-	err = f.TargetDB.QueryRow(query, args...).Scan(&dummy)
+	err = f.stateTablesDB().QueryRow(query, args...).Scan(&dummy)
 	if err == sqlorig.ErrNoRows {
 		return nil, nil
 	}
@@ -522,7 +898,7 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 	rowCopyRows, err := squirrel.
 		Select("table_name", "last_pagination_key", "copy_complete").
 		From(rowCopyTableName).
-		RunWith(f.TargetDB.DB).
+		RunWith(f.stateTablesDB().DB).
 		Query()
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
@@ -551,7 +927,7 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 		// for debugging, but the data should be considered
 		// confidential, so we cannot emit it to logs by default, even
 		// in debug-mode
-		if IncrediblyVerboseLogging {
+		if f.IncrediblyVerboseLogging {
 			logger = logger.WithField("data", lastPaginationKey)
 		}
 
@@ -562,8 +938,30 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 			continue
 		}
 
-		// non-paginated tables don't have resume key data
+		var keyRanges storedKeyRanges
 		if lastPaginationKey != "" {
+			err = json.NewDecoder(strings.NewReader(lastPaginationKey)).Decode(&keyRanges)
+			if err != nil {
+				logger.WithField("err", err).Errorf("parsing row-copy resume key from target DB failed")
+				return nil, err
+			}
+		}
+
+		// non-paginated tables don't have resume key data
+		if len(keyRanges.KeyRanges) > 0 {
+			unmarshalledKeyRanges, err := unmarshalKeyRanges(keyRanges.KeyRanges, table)
+			if err != nil {
+				logger.WithField("err", err).Errorf("unmarshalling row-copy key ranges from target DB failed")
+				return nil, err
+			}
+
+			if state.KeyRanges == nil {
+				state.KeyRanges = make(map[string][]*KeyRange)
+			}
+			state.KeyRanges[tableName] = unmarshalledKeyRanges
+			s.SetKeyRanges(tableName, unmarshalledKeyRanges)
+			state.LastSuccessfulPaginationKeys[tableName], _ = s.LastSuccessfulPaginationKey(tableName)
+		} else if lastPaginationKey != "" {
 			var lastPaginationKeyData PaginationKeyData
 			err = json.NewDecoder(strings.NewReader(lastPaginationKey)).Decode(&lastPaginationKeyData)
 			if err != nil {
@@ -592,7 +990,7 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 		Select("event_filename", "event_pos", "resume_filename", "resume_pos").
 		From(binlogWriterTableName).
 		Limit(1).
-		RunWith(f.TargetDB.DB).
+		RunWith(f.stateTablesDB().DB).
 		Query()
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
@@ -621,7 +1019,7 @@ func (s *StateTracker) readStateFromDB(f *Ferry) (*SerializableState, error) {
 	inlineVerifierRows, err := squirrel.
 		Select("event_filename", "event_pos", "resume_filename", "resume_pos").
 		From(inlineVerifierTableName).
-		RunWith(f.TargetDB.DB).
+		RunWith(f.stateTablesDB().DB).
 		Limit(1).
 		Query()
 	if err != nil {
@@ -709,20 +1107,77 @@ func (s *StateTracker) GetStoreRowCopyDoneSql(tableName string) (sqlStr string,
 	return
 }
 
+func (s *StateTracker) GetResetRowCopySql(tableName string) (sqlStr string, args []interface{}, err error) {
+	if s.stateTablesPrefix == "" {
+		return
+	}
+
+	sqlStr, args, err = squirrel.
+		Delete(s.getRowCopyStateTable()).
+		Where(squirrel.Eq{"table_name": tableName}).
+		ToSql()
+
+	return
+}
+
+// GetRenameRowCopySql moves the stored copy state of a table to its new
+// name. Any state stored for the new name needs to be reset before, see
+// GetResetRowCopySql.
+func (s *StateTracker) GetRenameRowCopySql(from, to string) (sqlStr string, args []interface{}, err error) {
+	if s.stateTablesPrefix == "" {
+		return
+	}
+
+	sqlStr, args, err = squirrel.
+		Update(s.getRowCopyStateTable()).
+		Set("table_name", to).
+		Where(squirrel.Eq{"table_name": from}).
+		ToSql()
+
+	return
+}
+
 func (s *StateTracker) GetStoreRowCopyPositionSql(tableName string, endPaginationKey *PaginationKeyData) (sqlStr string, args []interface{}, err error) {
 	if s.stateTablesPrefix == "" {
 		return
 	}
 
-	paginationKeyData := ""
-	if endPaginationKey != nil {
-		stateBytes, err := json.Marshal(endPaginationKey)
-		if err != nil {
-			return "", nil, err
+	s.CopyRWMutex.RLock()
+	paginationKeyData, err := s.rowCopyPositionData(tableName, endPaginationKey)
+	s.CopyRWMutex.RUnlock()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.storeRowCopyPositionSql(tableName, paginationKeyData)
+}
+
+// rowCopyPositionData returns the position stored for the table: the
+// pagination key, or the ranges of a table split by key range, including the
+// position of the range the pagination key is in. Expects the CopyRWMutex to
+// be held.
+func (s *StateTracker) rowCopyPositionData(tableName string, endPaginationKey *PaginationKeyData) (string, error) {
+	var position interface{}
+	if keyRanges, split := s.keyRanges[tableName]; split {
+		keyRanges = copyKeyRanges(keyRanges)
+		if endPaginationKey != nil {
+			keyRangeContaining(keyRanges, endPaginationKey).LastSuccessfulPaginationKey = endPaginationKey
 		}
+		position = &storedKeyRanges{KeyRanges: keyRanges}
+	} else if endPaginationKey != nil {
+		position = endPaginationKey
+	} else {
+		return "", nil
+	}
 
-		paginationKeyData = string(stateBytes)
+	stateBytes, err := json.Marshal(position)
+	if err != nil {
+		return "", err
 	}
+	return string(stateBytes), nil
+}
+
+func (s *StateTracker) storeRowCopyPositionSql(tableName, paginationKeyData string) (sqlStr string, args []interface{}, err error) {
 	sqlStr, args, err = squirrel.
 		Insert(s.getRowCopyStateTable()).
 		Columns("table_name", "last_pagination_key").
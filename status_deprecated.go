@@ -1,7 +1,6 @@
 package ghostferry
 
 import (
-	"fmt"
 	"math"
 	"sort"
 	"time"
@@ -84,8 +83,8 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 
 	status.GhostferryVersion = VersionString
 
-	status.SourceHostPort = fmt.Sprintf("%s:%d", f.Source.Host, f.Source.Port)
-	status.TargetHostPort = fmt.Sprintf("%s:%d", f.Target.Host, f.Target.Port)
+	status.SourceHostPort = f.Source.Address()
+	status.TargetHostPort = f.Target.Address()
 
 	status.OverallState = f.OverallState
 	status.StartTime = f.StartTime
@@ -112,8 +111,14 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 	status.ReplicationThrottled = f.ReplicationThrottler.Throttled()
 	status.Throttled = status.MigrationThrottled || status.ReplicationThrottled
 
+	// the binlog writer adds tables while it runs
+	tables := make(TableSchemaCache)
+	for _, table := range f.tables() {
+		tables[table.String()] = table
+	}
+
 	// Getting all table statuses
-	status.TableStatuses = make([]*TableStatusDeprecated, 0, len(f.Tables))
+	status.TableStatuses = make([]*TableStatusDeprecated, 0, len(tables))
 
 	serializedState := f.StateTracker.Serialize(nil, nil)
 
@@ -123,7 +128,7 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 	targetPaginationKeysData := make(map[string]string)
 	targetPaginationKeysProgress := make(map[string]uint64)
 	f.DataIterator.targetPaginationKeys.Range(func(k, v interface{}) bool {
-		tableName := k.(string)
+		tableName := k.(*TableSchema).String()
 		if v == nil {
 			targetPaginationKeysData[tableName] = "n/a"
 		} else {
@@ -137,13 +142,13 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 	})
 
 	status.CompletedTableCount = len(completedTables)
-	status.TotalTableCount = len(f.Tables)
+	status.TotalTableCount = len(tables)
 
-	status.AllTableNames = f.Tables.AllTableNames()
+	status.AllTableNames = tables.AllTableNames()
 	sort.Strings(status.AllTableNames)
 
 	dbSet := make(map[string]bool)
-	for _, table := range f.Tables.AsSlice() {
+	for _, table := range tables.AsSlice() {
 		dbSet[table.Schema] = true
 	}
 
@@ -155,8 +160,8 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 
 	// We get the name first because we need to sort them
 	completedTableNames := make([]string, 0, len(completedTables))
-	copyingTableNames := make([]string, 0, len(f.Tables))
-	waitingTableNames := make([]string, 0, len(f.Tables))
+	copyingTableNames := make([]string, 0, len(tables))
+	waitingTableNames := make([]string, 0, len(tables))
 
 	for tableName, _ := range completedTables {
 		completedTableNames = append(completedTableNames, tableName)
@@ -170,7 +175,7 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 		copyingTableNames = append(copyingTableNames, tableName)
 	}
 
-	for tableName, _ := range f.Tables {
+	for tableName, _ := range tables {
 		if lastSuccessfulPaginationKey, ok := lastSuccessfulPaginationKeys[tableName]; ok && lastSuccessfulPaginationKey != nil {
 			continue // already started, therefore not waiting
 		}
@@ -195,7 +200,7 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 		}
 		status.TableStatuses = append(status.TableStatuses, &TableStatusDeprecated{
 			TableName:                   tableName,
-			PaginationKeyName:           getPaginationColumnName(f.Tables[tableName]),
+			PaginationKeyName:           getPaginationColumnName(tables[tableName]),
 			Status:                      "complete",
 			TargetPaginationKey:         targetPaginationKeysData[tableName],
 			LastSuccessfulPaginationKey: lastSuccessfulPaginationKey,
@@ -209,7 +214,7 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 		}
 		status.TableStatuses = append(status.TableStatuses, &TableStatusDeprecated{
 			TableName:                   tableName,
-			PaginationKeyName:           getPaginationColumnName(f.Tables[tableName]),
+			PaginationKeyName:           getPaginationColumnName(tables[tableName]),
 			Status:                      "copying",
 			TargetPaginationKey:         targetPaginationKeysData[tableName],
 			LastSuccessfulPaginationKey: lastSuccessfulPaginationKey,
@@ -219,7 +224,7 @@ func FetchStatusDeprecated(f *Ferry, v Verifier) *StatusDeprecated {
 	for _, tableName := range waitingTableNames {
 		status.TableStatuses = append(status.TableStatuses, &TableStatusDeprecated{
 			TableName:                   tableName,
-			PaginationKeyName:           getPaginationColumnName(f.Tables[tableName]),
+			PaginationKeyName:           getPaginationColumnName(tables[tableName]),
 			Status:                      "waiting",
 			TargetPaginationKey:         targetPaginationKeysData[tableName],
 			LastSuccessfulPaginationKey: "n/a",
@@ -0,0 +1,56 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markStreamOnlyTables marks the tables of Config.StreamOnlyTables as
+// completed without copying their rows, so that only their binlog events are
+// applied, see Start
+func (f *Ferry) markStreamOnlyTables() error {
+	logger := f.loggerFor("stream_only_tables")
+
+	for _, name := range f.Config.StreamOnlyTables {
+		parts := strings.SplitN(name, ".", 2)
+		table := f.Tables.Get(parts[0], parts[1])
+		if table == nil {
+			return fmt.Errorf("stream-only table %s is not copied", name)
+		}
+
+		f.StateTracker.MarkTableAsStreamOnly(table.String())
+		logger.WithField("table", table.String()).Warn("not copying the rows of the table, only applying its binlog events")
+	}
+
+	return nil
+}
+
+// isStreamOnlyTable returns whether the table is one of the
+// Config.StreamOnlyTables
+func (f *Ferry) isStreamOnlyTable(table *TableSchema) bool {
+	return f.streamOnlyTables()[table.String()]
+}
+
+// streamOnlyTables returns the Config.StreamOnlyTables as a set
+func (f *Ferry) streamOnlyTables() map[string]bool {
+	tables := make(map[string]bool, len(f.Config.StreamOnlyTables))
+	for _, name := range f.Config.StreamOnlyTables {
+		tables[name] = true
+	}
+	return tables
+}
+
+// copiedTables returns the tables whose rows are copied, i.e. all but the
+// Config.StreamOnlyTables. Only these can be verified and compared with the
+// source, as the rows of the stream-only tables are written by other means.
+func (f *Ferry) copiedTables() []*TableSchema {
+	streamOnly := f.streamOnlyTables()
+
+	tables := make([]*TableSchema, 0, len(f.Tables))
+	for _, table := range f.Tables.AsSlice() {
+		if !streamOnly[table.String()] {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,73 @@
+package ghostferry
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TableCopyPhaseBeforeComplete = "before_complete"
+	TableCopyPhaseAfterComplete  = "after_complete"
+)
+
+// TableCopyHooks calls the callbacks of the TableCopyHooksConfig around the
+// copy of each table being marked as completed by the StateTracker. A
+// callback that keeps failing fails the run, as the application may depend
+// on it, e.g. to stop writing to the table.
+type TableCopyHooks struct {
+	Config       *TableCopyHooksConfig
+	ErrorHandler ErrorHandler
+
+	client *http.Client
+	logger *logrus.Entry
+}
+
+func (f *Ferry) NewTableCopyHooks() *TableCopyHooks {
+	return &TableCopyHooks{
+		Config:       &f.Config.TableCopyHooks,
+		ErrorHandler: f.ErrorHandler,
+		logger:       f.loggerFor("table_copy_hooks"),
+	}
+}
+
+func (h *TableCopyHooks) BeforeTableCompleted(table string) {
+	h.call(h.Config.BeforeComplete, table, TableCopyPhaseBeforeComplete)
+}
+
+func (h *TableCopyHooks) AfterTableCompleted(table string) {
+	h.call(h.Config.AfterComplete, table, TableCopyPhaseAfterComplete)
+}
+
+func (h *TableCopyHooks) call(callback HTTPCallback, table, phase string) {
+	if callback.URI == "" {
+		return
+	}
+	if h.client == nil {
+		h.client = &http.Client{Timeout: h.Config.timeout}
+	}
+	if h.logger == nil {
+		h.logger = logrus.WithField("tag", "table_copy_hooks")
+	}
+
+	logger := h.logger.WithFields(logrus.Fields{
+		"table": table,
+		"phase": phase,
+	})
+
+	payload := map[string]interface{}{
+		"Payload": callback.Payload,
+		"Table":   table,
+		"Phase":   phase,
+	}
+	err := WithRetries(h.Config.Attempts, h.Config.retryInterval, logger, "call table copy hook", func() error {
+		return postCallback(h.client, callback.URI, payload)
+	})
+	if err != nil {
+		h.ErrorHandler.Fatal("table_copy_hooks", fmt.Errorf("%s hook of %s failed: %v", phase, table, err))
+		return
+	}
+
+	logger.Info("called table copy hook")
+}
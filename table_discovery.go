@@ -0,0 +1,96 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runTableDiscovery periodically copies the applicable tables created on the
+// source since the run started, see Config.TableDiscovery
+func (f *Ferry) runTableDiscovery(ctx context.Context) {
+	logger := f.loggerFor("table_discovery")
+	ticker := time.NewTicker(f.Config.TableDiscovery.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.copyDiscoveredTables(ctx); err != nil && ctx.Err() == nil {
+				logger.WithError(err).Warn("failed to look for new tables, retrying later")
+			}
+		}
+	}
+}
+
+// copyDiscoveredTables registers the new tables with the BinlogWriter, such
+// that their binlog events are applied, and copies their rows afterwards
+func (f *Ferry) copyDiscoveredTables(ctx context.Context) error {
+	tables, err := f.discoverTables()
+	if err != nil || len(tables) == 0 {
+		return err
+	}
+
+	if err = f.BinlogWriter.RegisterTables(ctx, tables); err != nil {
+		return err
+	}
+
+	f.Metrics.Count("TableDiscovery.DiscoveredTables", int64(len(tables)), nil, 1.0)
+
+	tablesToCopy := make([]*TableSchema, 0, len(tables))
+	for _, table := range tables {
+		if f.isStreamOnlyTable(table) {
+			f.StateTracker.MarkTableAsStreamOnly(table.String())
+			continue
+		}
+		tablesToCopy = append(tablesToCopy, table)
+	}
+	f.loggerFor("table_discovery").WithField("tables", tablesToCopy).Info("copying tables created on the source")
+
+	dataIterator := f.NewDataIterator()
+	dataIterator.AddBatchListener(f.BatchWriter.WriteRowBatch)
+	dataIterator.Run(tablesToCopy)
+
+	return nil
+}
+
+// discoverTables returns the applicable tables of the source that are not in
+// the schema cache, and already exist on the target
+func (f *Ferry) discoverTables() ([]*TableSchema, error) {
+	sourceTables, err := LoadTables(f.SourceDB, f.TableFilter, f.CompressedColumnsForVerification, f.IgnoredColumnsForVerification, f.CascadingPaginationColumnConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]*TableSchema, 0)
+	for name, table := range sourceTables {
+		if f.table(name) != nil {
+			continue
+		}
+
+		exists, err := f.targetTableExists(table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			f.loggerFor("table_discovery").WithField("table", name).Warn("new table does not exist on the target yet, not copying it")
+			continue
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+func (f *Ferry) targetTableExists(table *TableSchema) (bool, error) {
+	schemaName, tableName := f.targetSchemaAndTableName(table)
+
+	var count int
+	err := f.TargetDB.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", schemaName, tableName).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("looking up %s.%s on the target: %v", schemaName, tableName, err)
+	}
+	return count > 0, nil
+}
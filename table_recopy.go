@@ -0,0 +1,52 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resetRecopiedTables truncates the tables of the TableRecopyConfig on the
+// target and resets their copy state when resuming, so the DataIterator
+// copies them again from scratch, see Start. The tables reset by a previous
+// resume are skipped until their copy completed.
+func (f *Ferry) resetRecopiedTables() error {
+	logger := f.loggerFor("table_recopy")
+
+	for _, name := range f.Config.TableRecopy.Tables {
+		parts := strings.SplitN(name, ".", 2)
+		table := f.Tables.Get(parts[0], parts[1])
+		if table == nil {
+			return fmt.Errorf("table %s to copy again is not copied", name)
+		}
+
+		if f.StateTracker.IsTableRecopied(table.String()) {
+			logger.WithField("table", table.String()).Info("table was already reset to be copied again, resuming its copy")
+			continue
+		}
+
+		schemaName, tableName := f.targetSchemaAndTableName(table)
+		query, _, err := NewTruncateTableBatch(table).AsSQLQuery(schemaName, tableName)
+		if err != nil {
+			return err
+		}
+		if _, err = f.TargetDB.Exec(query); err != nil {
+			return fmt.Errorf("truncating %s.%s on the target: %v", schemaName, tableName, err)
+		}
+
+		query, args, err := f.StateTracker.GetResetRowCopySql(table.String())
+		if err != nil {
+			return err
+		}
+		if query != "" {
+			if _, err = f.stateTablesDB().Exec(query, args...); err != nil {
+				return fmt.Errorf("resetting the stored copy state of %s: %v", table, err)
+			}
+		}
+
+		f.StateTracker.ResetTableCopy(table.String())
+		f.StateTracker.MarkTableAsRecopied(table.String())
+		logger.WithField("table", table.String()).Warn("truncated table on the target, copying it again from scratch")
+	}
+
+	return nil
+}
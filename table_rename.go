@@ -0,0 +1,268 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TableRename is a table renamed on the source, possibly moving it to
+// another database
+type TableRename struct {
+	From QualifiedTableName
+	To   QualifiedTableName
+}
+
+// RenameTableEvent applies a RENAME TABLE statement to the target. As the
+// statement is built from the renamed tables, unlike other schema changes it
+// supports the database and table rewrites.
+type RenameTableEvent struct {
+	renames          []TableRename
+	databaseRewrites map[string]string
+	tableRewrites    map[string]string
+	*DXLEventBase
+}
+
+func NewRenameTableEvent(renames []TableRename, databaseRewrites, tableRewrites map[string]string, pos BinlogPosition, time time.Time) *RenameTableEvent {
+	return &RenameTableEvent{
+		renames:          renames,
+		databaseRewrites: databaseRewrites,
+		tableRewrites:    tableRewrites,
+		DXLEventBase: &DXLEventBase{
+			pos:  pos,
+			time: time,
+		},
+	}
+}
+
+func (e *RenameTableEvent) IsAutoTransaction() bool {
+	return true
+}
+
+// Database returns the database of the first renamed table
+func (e *RenameTableEvent) Database() string {
+	return e.renames[0].From.SchemaName
+}
+
+// Table returns the first renamed table
+func (e *RenameTableEvent) Table() string {
+	return e.renames[0].From.TableName
+}
+
+func (e *RenameTableEvent) Renames() []TableRename {
+	return e.renames
+}
+
+// AsSQLString ignores the given names, as the statement renames several
+// tables: they are all named according to the rewrites of the event
+func (e *RenameTableEvent) AsSQLString(schemaName, tableName string) (string, error) {
+	renames := make([]string, len(e.renames))
+	for i, rename := range e.renames {
+		renames[i] = e.targetTableName(rename.From) + " TO " + e.targetTableName(rename.To)
+	}
+	return "RENAME TABLE " + strings.Join(renames, ", "), nil
+}
+
+func (e *RenameTableEvent) targetTableName(table QualifiedTableName) string {
+	schemaName := table.SchemaName
+	if rewrite, exists := e.databaseRewrites[schemaName]; exists {
+		schemaName = rewrite
+	}
+	tableName := table.TableName
+	if rewrite, exists := e.tableRewrites[tableName]; exists {
+		tableName = rewrite
+	}
+	return QuotedTableNameFromString(schemaName, tableName)
+}
+
+// RenameTablesCallback moves the renamed tables to their new names in the
+// TableSchema and the copy state once they were renamed on the target, such
+// that their events are applied under the new names from then on.
+type RenameTablesCallback struct {
+	*BinlogWriter
+	Renames []TableRename
+}
+
+func (c *RenameTablesCallback) Notify() error {
+	// the renames of a statement are applied in order, e.g. swapping two
+	// tables via a third one
+	for _, rename := range c.Renames {
+		if err := c.BinlogWriter.RenameTable(rename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleRenameTable builds the event renaming the tables of a RENAME TABLE
+// statement that are copied, or moved into a copied database
+func (b *BinlogWriter) handleRenameTable(ev *ReplicationEvent, statement string, renames []TableRename) (*DXLEventWrapper, error) {
+	appliedRenames := make([]TableRename, 0, len(renames))
+	for _, rename := range renames {
+		fromApplicable, err := b.isApplicableDatabase(rename.From.SchemaName)
+		if err != nil {
+			return nil, err
+		}
+		toApplicable, err := b.isApplicableDatabase(rename.To.SchemaName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fromApplicable {
+			if toApplicable {
+				return nil, fmt.Errorf("cannot rename %s to %s on the target, as %s is not copied", rename.From, rename.To, rename.From)
+			}
+			b.logger.Infof("Ignoring rename of %s: not an applicable DB", rename.From)
+			continue
+		}
+		appliedRenames = append(appliedRenames, rename)
+	}
+	if len(appliedRenames) == 0 {
+		return nil, nil
+	}
+
+	table := appliedRenames[0].From
+	if denied, err := b.checkDDLDenylist(ev, statement, &table); denied {
+		return nil, err
+	}
+
+	for _, rename := range appliedRenames {
+		b.logger.WithFields(logrus.Fields{
+			"table":      rename.From.String(),
+			"renamed_to": rename.To.String(),
+		}).Debugf("received table rename at %v", ev.EventTime)
+
+		b.metrics.Count("SchemaEvent", 1, []MetricTag{
+			MetricTag{"table", rename.From.TableName},
+			MetricTag{"source", "binlog"},
+		}, 1.0)
+	}
+
+	return &DXLEventWrapper{
+		DXLEvent:          NewRenameTableEvent(appliedRenames, b.DatabaseRewrites, b.TableRewrites, ev.BinlogPosition, ev.EventTime),
+		ReplicationEvent:  ev,
+		PostApplyCallback: &RenameTablesCallback{BinlogWriter: b, Renames: appliedRenames},
+	}, nil
+}
+
+// renamedCopiedTables returns the tables renamed by the event whose copy did
+// not complete yet, which needs to be coordinated with their copy, see
+// applyRenameOfCopiedTables
+func (b *BinlogWriter) renamedCopiedTables(ev *RenameTableEvent) []string {
+	if b.StateTracker == nil {
+		return nil
+	}
+
+	tables := make([]string, 0, len(ev.Renames()))
+	for _, rename := range ev.Renames() {
+		table := rename.From.String()
+		if b.TableSchema.Get(rename.From.SchemaName, rename.From.TableName) == nil {
+			continue
+		}
+		if !b.StateTracker.IsTableComplete(table) && !b.Quarantine.Contains(table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// applyRenameOfCopiedTables applies the rename of tables being copied while
+// no batch of these tables is written. The DataIterator reads the remaining
+// rows of the tables under their new names, as the renamed schemas are the
+// ones it copies, see ErrTableSchemaChanged. The copy of a table moved out of
+// the copied databases is given up on.
+func (b *BinlogWriter) applyRenameOfCopiedTables(ev DXLEventWrapper, tables []string) {
+	logger := b.logger.WithFields(logrus.Fields{
+		"tables":   tables,
+		"position": ev.DXLEvent.BinlogPosition(),
+	})
+	logger.Warn("tables being copied were renamed on the source, pausing their copy")
+
+	err := b.StateTracker.RenameCopiedTables(tables, func() error {
+		b.applyBatch([]DXLEventWrapper{ev})
+		return nil
+	})
+	if err != nil {
+		b.ErrorHandler.Fatal("binlog_writer", err)
+		return
+	}
+
+	for _, table := range tables {
+		b.metrics.Count("BinlogWriter.RenamedCopiedTable", 1, []MetricTag{{Name: "table", Value: table}}, 1.0)
+	}
+	logger.Info("applied rename, copying the remaining rows under the new names")
+}
+
+// RenameTable moves a table renamed on the target to its new name, along
+// with its copy state. A table moved out of the copied databases is no
+// longer copied, and a table renamed that was not copied before is handled
+// like a created table.
+func (b *BinlogWriter) RenameTable(rename TableRename) error {
+	from, to := rename.From.String(), rename.To.String()
+	logger := b.logger.WithFields(logrus.Fields{
+		"table":      from,
+		"renamed_to": to,
+	})
+
+	toApplicable, err := b.isApplicableDatabase(rename.To.SchemaName)
+	if err != nil {
+		return err
+	}
+
+	table := b.TableSchema.Get(rename.From.SchemaName, rename.From.TableName)
+	if table == nil {
+		if !toApplicable {
+			return nil
+		}
+		if err := b.ReloadTableSchema(&rename.To); err != nil {
+			return err
+		}
+		return b.MarkTableAsCopied(&rename.To)
+	}
+
+	b.tableSchemaMutex.Lock()
+	delete(b.TableSchema, from)
+	if toApplicable {
+		b.TableSchema[to] = table
+	}
+	b.tableSchemaMutex.Unlock()
+
+	if !toApplicable {
+		logger.Warn("table was moved to a database that is not copied, no longer copying it")
+		// like a dropped table, the table is not copied any further
+		b.StateTracker.ResetTableCopy(from)
+		return b.MarkTableAsCopied(&rename.From)
+	}
+
+	logger.Info("table was renamed, applying its events under the new name")
+	b.StateTracker.RenameTable(from, to)
+	b.renameTableCompletion(from, to)
+	if err := b.execStateSql(b.StateTracker.GetResetRowCopySql(to)); err != nil {
+		return err
+	}
+	if err := b.execStateSql(b.StateTracker.GetRenameRowCopySql(from, to)); err != nil {
+		return err
+	}
+
+	return b.ReloadTableSchema(&rename.To)
+}
+
+func (b *BinlogWriter) isApplicableDatabase(schemaName string) (bool, error) {
+	applicableDatabases, err := b.TableFilter.ApplicableDatabases([]string{schemaName})
+	if err != nil {
+		return false, fmt.Errorf("could not apply database filter on %s: %v", schemaName, err)
+	}
+	return len(applicableDatabases) > 0, nil
+}
+
+func (b *BinlogWriter) execStateSql(query string, args []interface{}, err error) error {
+	if err != nil || query == "" {
+		return err
+	}
+	if _, err = b.DB.Exec(query, args...); err != nil {
+		return fmt.Errorf("updating the stored copy state: %v", err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"strings"
+	"sync"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/siddontang/go-mysql/schema"
@@ -83,6 +84,10 @@ type TableSchema struct {
 	IgnoredColumnsForVerification    map[string]struct{} // Set of column name
 	PaginationKey                    *PaginationKey
 
+	// The index forced in the row-copy SELECTs, see
+	// CascadingPaginationColumnConfig.IndexHints
+	ForcedIndex string
+
 	rowMd5Query string
 }
 
@@ -121,6 +126,16 @@ func (t *TableSchema) FingerprintQuery(schemaName, tableName string, numRows int
 	), nil
 }
 
+// QuotedColumnNames returns the quoted columns of the cached schema, to
+// select the rows with the columns they are written with
+func (t *TableSchema) QuotedColumnNames() []string {
+	columns := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		columns[i] = quoteField(column.Name)
+	}
+	return columns
+}
+
 func (t *TableSchema) RowMd5Query() string {
 	if t.rowMd5Query != "" {
 		return t.rowMd5Query
@@ -273,8 +288,27 @@ func LoadTables(db *sql.DB, tableFilter TableFilter, columnCompressionConfig Col
 					tableLog.WithError(err).Error("invalid table")
 					return tableSchemaCache, err
 				}
+				if _, found := cascadingPaginationColumnConfig.PaginationColumnFor(tableSchema.Schema, tableName); found {
+					err = validatePaginationColumn(db, tableSchema, paginationKey.Columns[0])
+					if err != nil && !cascadingPaginationColumnConfig.AllowUnsafePerTable {
+						tableLog.WithError(err).Error("invalid pagination column")
+						return tableSchemaCache, err
+					} else if err != nil {
+						tableLog.WithError(err).Warn("pagination column may be slow or skip rows")
+					}
+				}
 				tableLog.Debugf("using pagination key %s", paginationKey)
 				tableSchema.PaginationKey = paginationKey
+
+				forcedIndex, err := tableSchema.forcedIndex(cascadingPaginationColumnConfig)
+				if err != nil {
+					tableLog.WithError(err).Error("invalid index hint")
+					return tableSchemaCache, err
+				}
+				if forcedIndex != "" {
+					tableLog.Debugf("forcing index %s", forcedIndex)
+				}
+				tableSchema.ForcedIndex = forcedIndex
 			}
 
 			tableSchemaCache[tableSchema.String()] = tableSchema
@@ -310,6 +344,95 @@ func UnsupportedPaginationKeyError(schema, table, paginationKey string) error {
 	return fmt.Errorf("Pagination Key `%s` for %s is non-numeric/-text", paginationKey, QuotedTableNameFromString(schema, table))
 }
 
+// UnindexedPaginationKeyError exported to facilitate black box testing
+func UnindexedPaginationKeyError(schema, table, paginationKey string) error {
+	return fmt.Errorf("Pagination Key `%s` for %s is not the first column of an index", paginationKey, QuotedTableNameFromString(schema, table))
+}
+
+// NonUniquePaginationKeyError exported to facilitate black box testing
+func NonUniquePaginationKeyError(schema, table, paginationKey string) error {
+	return fmt.Errorf("Pagination Key `%s` for %s is neither unique nor auto-increment", paginationKey, QuotedTableNameFromString(schema, table))
+}
+
+// NonExistingIndexHintError exported to facilitate black box testing
+func NonExistingIndexHintError(schema, table, index string) error {
+	return fmt.Errorf("Index hint `%s` for %s non existent", index, QuotedTableNameFromString(schema, table))
+}
+
+// forcedIndex returns the index to force in the row-copy SELECTs of the
+// table, or an empty string to leave the choice to the optimizer
+func (t *TableSchema) forcedIndex(cascadingPaginationColumnConfig *CascadingPaginationColumnConfig) (string, error) {
+	if index, found := cascadingPaginationColumnConfig.IndexHintFor(t.Schema, t.Name); found {
+		for _, tableIndex := range t.Indexes {
+			if tableIndex.Name == index {
+				return index, nil
+			}
+		}
+		return "", NonExistingIndexHintError(t.Schema, t.Name, index)
+	}
+
+	if cascadingPaginationColumnConfig == nil || !cascadingPaginationColumnConfig.ForcePaginationKeyIndex {
+		return "", nil
+	}
+
+	for _, tableIndex := range t.Indexes {
+		if len(tableIndex.Columns) < len(t.PaginationKey.Columns) {
+			continue
+		}
+
+		matches := true
+		for i, column := range t.PaginationKey.Columns {
+			if tableIndex.Columns[i] != column.Name {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return tableIndex.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// validatePaginationColumn verifies that a pagination column configured for
+// a table can be paginated by: it must be indexed for the batches to be
+// selected efficiently, and unique (or auto-increment) for no rows to be
+// skipped between batches.
+func validatePaginationColumn(db *sql.DB, table *TableSchema, column *schema.TableColumn) error {
+	indexed := false
+	for _, index := range table.Indexes {
+		if len(index.Columns) > 0 && index.Columns[0] == column.Name {
+			indexed = true
+			break
+		}
+	}
+	if !indexed {
+		return UnindexedPaginationKeyError(table.Schema, table.Name, column.Name)
+	}
+
+	if column.IsAuto {
+		return nil
+	}
+
+	// the unique indexes consisting of only the column
+	var uniqueIndexes int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM (SELECT INDEX_NAME FROM information_schema.STATISTICS "+
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0 "+
+			"GROUP BY INDEX_NAME HAVING COUNT(*) = 1 AND MAX(COLUMN_NAME) = ?) AS unique_indexes",
+		table.Schema, table.Name, column.Name,
+	).Scan(&uniqueIndexes)
+	if err != nil {
+		return err
+	}
+	if uniqueIndexes == 0 {
+		return NonUniquePaginationKeyError(table.Schema, table.Name, column.Name)
+	}
+
+	return nil
+}
+
 func (t *TableSchema) paginationKey(cascadingPaginationColumnConfig *CascadingPaginationColumnConfig) (*PaginationKey, error) {
 	var err error
 
@@ -403,6 +526,16 @@ func (c TableSchemaCache) Get(database, table string) *TableSchema {
 	return c[fullTableName(database, table)]
 }
 
+// GetLocked behaves like Get, but holds the mutex guarding the cache while
+// reading it, if any, as the BinlogWriter changes the cache while it runs
+func (c TableSchemaCache) GetLocked(mutex *sync.RWMutex, database, table string) *TableSchema {
+	if mutex != nil {
+		mutex.RLock()
+		defer mutex.RUnlock()
+	}
+	return c.Get(database, table)
+}
+
 // Helper to sort a given map of tables with a second list giving a priority.
 // If an element is present in the input and the priority lists, the item will
 // appear first (in the order of the priority list), all other items appear in
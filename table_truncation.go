@@ -0,0 +1,241 @@
+package ghostferry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrTableTruncated is returned for the batches of a table read before the
+// table was truncated, which must not be written to the target
+var ErrTableTruncated = errors.New("table was truncated on the source during its copy")
+
+// ErrTableSchemaChanged is returned for the batches of a table read before a
+// schema change of the table was applied to the target, which are read again
+// with the changed schema
+var ErrTableSchemaChanged = errors.New("schema of the table changed on the source during its copy")
+
+// ErrSourceSchemaAheadOfCache is returned for the batches of a table read
+// after its schema changed on the source, but before the BinlogWriter applied
+// the change, see DataIterator.checkSourceColumns
+var ErrSourceSchemaAheadOfCache = errors.New("columns of the table on the source differ from the cached schema")
+
+// How long the DataIterator waits for the BinlogWriter to apply a schema
+// change of a table whose rows can no longer be read with the cached schema,
+// see DataIterator.waitForTableCopyVersionChange
+const (
+	tableCopyVersionChangeTimeout = 5 * time.Minute
+	tableCopyVersionPollInterval  = 500 * time.Millisecond
+)
+
+// TableCopyVersion counts the truncations of a table applied while it is
+// copied, and identifies the last schema change or rename applied, see
+// WriteCopyBatch. The schema changes are numbered across all tables, as a
+// table can be renamed to the name of another.
+type TableCopyVersion struct {
+	Truncations  uint64
+	SchemaChange uint64
+}
+
+// TableCopyVersion returns the version of the copy of the table, to be passed
+// to WriteCopyBatch
+func (s *StateTracker) TableCopyVersion(table string) TableCopyVersion {
+	s.CopyRWMutex.RLock()
+	defer s.CopyRWMutex.RUnlock()
+
+	return s.tableCopyVersions[table]
+}
+
+// WriteCopyBatch writes a batch of the copy of the table read at the given
+// TableCopyVersion, unless the table was truncated or its schema changed
+// since, in which case ErrTableTruncated or ErrTableSchemaChanged is
+// returned. The table is neither truncated nor changed while the batch is
+// written.
+func (s *StateTracker) WriteCopyBatch(table string, version TableCopyVersion, write func() error) error {
+	lock := s.truncationLock(table)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	current := s.TableCopyVersion(table)
+	if current.Truncations != version.Truncations {
+		return ErrTableTruncated
+	}
+	if current.SchemaChange != version.SchemaChange {
+		return ErrTableSchemaChanged
+	}
+	return write()
+}
+
+// TruncateTable truncates a table being copied once the batches being
+// written are written, and resets its copy, so it is copied again from
+// scratch. The batches read before are not written anymore, see
+// WriteCopyBatch.
+func (s *StateTracker) TruncateTable(table string, truncate func() error) error {
+	lock := s.truncationLock(table)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := truncate(); err != nil {
+		return err
+	}
+
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithField("table", table).Info("table truncated, resetting its copy")
+	version := s.tableCopyVersions[table]
+	version.Truncations++
+	s.tableCopyVersions[table] = version
+	delete(s.completedTables, table)
+	delete(s.lastSuccessfulPaginationKeys, table)
+	delete(s.keyRanges, table)
+	return nil
+}
+
+// ChangeTableSchema applies a schema change of a table being copied once the
+// batches being written are written. The copy continues from its position,
+// but the batches read before are not written anymore, as they were read
+// with the previous schema, see WriteCopyBatch.
+func (s *StateTracker) ChangeTableSchema(table string, change func() error) error {
+	lock := s.truncationLock(table)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	s.logger.WithField("table", table).Info("table schema changed, reading its remaining rows with the new schema")
+	s.changeTableCopyVersion(table)
+	return nil
+}
+
+// RenameCopiedTables renames tables being copied once the batches being
+// written are written. Their copy continues under the new names from their
+// position, but the batches read before are not written anymore, see
+// RenameTable.
+func (s *StateTracker) RenameCopiedTables(tables []string, rename func() error) error {
+	for _, table := range tables {
+		lock := s.truncationLock(table)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	return rename()
+}
+
+// changeTableCopyVersion must be called with the CopyRWMutex held
+func (s *StateTracker) changeTableCopyVersion(table string) {
+	s.lastSchemaChange++
+	version := s.tableCopyVersions[table]
+	version.SchemaChange = s.lastSchemaChange
+	s.tableCopyVersions[table] = version
+}
+
+func (s *StateTracker) truncationLock(table string) *sync.RWMutex {
+	s.CopyRWMutex.Lock()
+	defer s.CopyRWMutex.Unlock()
+
+	if lock, found := s.truncationLocks[table]; found {
+		return lock
+	}
+
+	lock := &sync.RWMutex{}
+	s.truncationLocks[table] = lock
+	return lock
+}
+
+// truncatesCopiedTable returns whether the event truncates a table whose
+// copy did not complete yet, which needs to be coordinated with the copy,
+// see applyTruncation
+func (b *BinlogWriter) truncatesCopiedTable(ev DDLEvent) bool {
+	if b.StateTracker == nil || b.TableSchema.Get(ev.Database(), ev.Table()) == nil {
+		return false
+	}
+	if DDLStatementClass(ev.SqlCommand()) != DDLClassTruncate {
+		return false
+	}
+
+	table := fmt.Sprintf("%s.%s", ev.Database(), ev.Table())
+	return !b.StateTracker.IsTableComplete(table) && !b.Quarantine.Contains(table)
+}
+
+// applyTruncation applies the truncation of a table being copied while no
+// batch of the table is written, and resets the copy of the table: the
+// DataIterator copies it again, see ErrTableTruncated
+func (b *BinlogWriter) applyTruncation(ev DXLEventWrapper) {
+	table := fmt.Sprintf("%s.%s", ev.DXLEvent.Database(), ev.DXLEvent.Table())
+	logger := b.logger.WithFields(logrus.Fields{
+		"table":    table,
+		"position": ev.DXLEvent.BinlogPosition(),
+	})
+	logger.Warn("table being copied was truncated on the source, pausing its copy")
+
+	err := b.StateTracker.TruncateTable(table, func() error {
+		b.applyBatch([]DXLEventWrapper{ev})
+
+		query, args, err := b.StateTracker.GetResetRowCopySql(table)
+		if err != nil || query == "" {
+			return err
+		}
+		if _, err = b.DB.Exec(query, args...); err != nil {
+			return fmt.Errorf("resetting the stored copy state of %s: %v", table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		b.ErrorHandler.Fatal("binlog_writer", err)
+		return
+	}
+
+	b.metrics.Count("BinlogWriter.TruncatedCopiedTable", 1, []MetricTag{{Name: "table", Value: table}}, 1.0)
+	logger.Info("applied truncation, copying the table again")
+}
+
+// changesCopiedTable returns whether the event changes the schema of a table
+// whose copy did not complete yet, which needs to be coordinated with the
+// copy, see applySchemaChange
+func (b *BinlogWriter) changesCopiedTable(ev DDLEvent) bool {
+	if b.StateTracker == nil || b.TableSchema.Get(ev.Database(), ev.Table()) == nil {
+		return false
+	}
+
+	table := fmt.Sprintf("%s.%s", ev.Database(), ev.Table())
+	return !b.StateTracker.IsTableComplete(table) && !b.Quarantine.Contains(table)
+}
+
+// applySchemaChange applies the schema change of a table being copied while
+// no batch of the table is written. The DataIterator reads the remaining rows
+// with the changed schema, see ErrTableSchemaChanged, and a dropped table is
+// not copied any further.
+func (b *BinlogWriter) applySchemaChange(ev DXLEventWrapper) {
+	table := QualifiedTableName{SchemaName: ev.DXLEvent.Database(), TableName: ev.DXLEvent.Table()}
+	logger := b.logger.WithFields(logrus.Fields{
+		"table":    table.String(),
+		"position": ev.DXLEvent.BinlogPosition(),
+	})
+	logger.Warn("schema of table being copied changed on the source, pausing its copy")
+
+	err := b.StateTracker.ChangeTableSchema(table.String(), func() error {
+		b.applyBatch([]DXLEventWrapper{ev})
+
+		if DDLStatementClass(ev.DXLEvent.(DDLEvent).SqlCommand()) == DDLClassDropTable {
+			logger.Warn("table being copied was dropped on the source, no longer copying it")
+			return b.MarkTableAsCopied(&table)
+		}
+		return nil
+	})
+	if err != nil {
+		b.ErrorHandler.Fatal("binlog_writer", err)
+		return
+	}
+
+	b.metrics.Count("BinlogWriter.ChangedCopiedTableSchema", 1, []MetricTag{{Name: "table", Value: table.String()}}, 1.0)
+	logger.Info("applied schema change, copying the remaining rows with the new schema")
+}
@@ -0,0 +1,81 @@
+package ghostferry
+
+import (
+	sqlorig "database/sql"
+	"fmt"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+)
+
+// checkSkipTargetBinlog makes sure the writes to the target are not
+// binlogged, see Config.SkipTargetBinlog, and warns about the replicas of the
+// target missing them
+func (f *Ferry) checkSkipTargetBinlog() error {
+	if !f.Config.SkipTargetBinlog {
+		return nil
+	}
+
+	if err := checkSessionBinlogDisabled(f.TargetDB); err != nil {
+		return err
+	}
+
+	replicas, err := TargetReplicas(f.TargetDB)
+	if err != nil {
+		f.logger.WithError(err).Warn("cannot list the replicas of the target, they miss the writes of Ghostferry if there are any")
+		return nil
+	}
+	if len(replicas) > 0 {
+		f.logger.WithField("replicas", replicas).Warn("SkipTargetBinlog is set, the replicas of the target do not receive the writes of Ghostferry")
+	}
+	return nil
+}
+
+func checkSessionBinlogDisabled(db *sql.DB) error {
+	var sqlLogBin string
+	if err := db.QueryRow("SELECT @@SESSION.sql_log_bin").Scan(&sqlLogBin); err != nil {
+		return fmt.Errorf("reading sql_log_bin of the target: %v", err)
+	}
+	if sqlLogBin != "0" {
+		return fmt.Errorf("sql_log_bin of the target is %s instead of 0, SkipTargetBinlog requires the SUPER or the SYSTEM_VARIABLES_ADMIN privilege", sqlLogBin)
+	}
+	return nil
+}
+
+// TargetReplicas returns the replicas connected to the database, as
+// host:port with their server_id
+func TargetReplicas(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SHOW REPLICAS")
+	if err != nil {
+		// before MySQL 8.0.22
+		rows, err = db.Query("SHOW SLAVE HOSTS")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]string, 0)
+	for rows.Next() {
+		values := make([]sqlorig.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		fields := make(map[string]string)
+		for i, column := range columns {
+			fields[strings.ToLower(column)] = values[i].String
+		}
+		replicas = append(replicas, fmt.Sprintf("%s:%s (server_id %s)", fields["host"], fields["port"], fields["server_id"]))
+	}
+	return replicas, rows.Err()
+}
@@ -0,0 +1,198 @@
+package ghostferry
+
+import (
+	"context"
+	sqlorig "database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// TargetGuard periodically checks the free disk space and connections of the
+// target, and throttles the writes of the data copy and the binlog writer
+// while they are below the thresholds of the TargetGuardConfig. The writes
+// resume automatically once the target recovered.
+type TargetGuard struct {
+	Config *TargetGuardConfig
+	DB     *sql.DB
+
+	mutex  sync.RWMutex
+	reason string
+
+	logger  *logrus.Entry
+	metrics *Metrics
+}
+
+func (f *Ferry) NewTargetGuard() *TargetGuard {
+	return &TargetGuard{
+		Config:  &f.Config.TargetGuard,
+		DB:      f.TargetDB,
+		logger:  f.loggerFor("target_guard"),
+		metrics: f.Metrics,
+	}
+}
+
+func (g *TargetGuard) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.Config.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Check(ctx); err != nil && ctx.Err() == nil {
+			g.logger.WithError(err).Warn("failed to check the target, keeping the current state")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Throttled returns whether the writes to the target are paused
+func (g *TargetGuard) Throttled() bool {
+	return g.Reason() != ""
+}
+
+// Reason returns why the writes to the target are paused, or an empty string
+// if they are not
+func (g *TargetGuard) Reason() string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.reason
+}
+
+// Check reads the free disk space and connections of the target, reports
+// them as the "TargetGuard.FreeDiskSpaceMB" and
+// "TargetGuard.FreeConnections" gauges, and pauses or resumes the writes.
+func (g *TargetGuard) Check(ctx context.Context) error {
+	if g.logger == nil {
+		g.logger = logrus.WithField("tag", "target_guard")
+	}
+
+	reason := ""
+	if g.Config.MinFreeDiskSpaceMB > 0 {
+		freeBytes, err := g.freeDiskSpace(ctx)
+		if err != nil {
+			return fmt.Errorf("reading free disk space: %v", err)
+		}
+
+		freeMB := freeBytes / (1024 * 1024)
+		g.metrics.Gauge("TargetGuard.FreeDiskSpaceMB", float64(freeMB), nil, 1.0)
+		if freeMB < g.Config.MinFreeDiskSpaceMB {
+			reason = fmt.Sprintf("free disk space of %dMB is below %dMB", freeMB, g.Config.MinFreeDiskSpaceMB)
+		}
+	}
+
+	if g.Config.MinFreeConnections > 0 {
+		freeConnections, err := g.freeConnections(ctx)
+		if err != nil {
+			return fmt.Errorf("reading free connections: %v", err)
+		}
+
+		g.metrics.Gauge("TargetGuard.FreeConnections", float64(freeConnections), nil, 1.0)
+		if reason == "" && freeConnections < g.Config.MinFreeConnections {
+			reason = fmt.Sprintf("%d free connections are below %d", freeConnections, g.Config.MinFreeConnections)
+		}
+	}
+
+	g.mutex.Lock()
+	previous := g.reason
+	g.reason = reason
+	g.mutex.Unlock()
+
+	if reason != "" && previous == "" {
+		g.logger.WithField("reason", reason).Warn("pausing writes to the target")
+		g.metrics.Count("TargetGuard.Paused", 1, nil, 1.0)
+	} else if reason == "" && previous != "" {
+		g.logger.Info("target recovered, resuming writes")
+		g.metrics.Count("TargetGuard.Resumed", 1, nil, 1.0)
+	}
+
+	return nil
+}
+
+func (g *TargetGuard) freeDiskSpace(ctx context.Context) (int64, error) {
+	var free sqlorig.NullInt64
+	if g.Config.FreeDiskSpaceQuery != "" {
+		err := g.DB.QueryRowContext(ctx, g.Config.FreeDiskSpaceQuery).Scan(&free)
+		return free.Int64, err
+	}
+
+	// the session variable set below is reset before the connection is
+	// released, such that it does not apply to other statements of the pool
+	conn, err := g.DB.ReserveConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// MySQL 8.0 caches the table sizes in information_schema for a day by
+	// default, the variable does not exist before
+	_, err = conn.ExecContext(ctx, "SET SESSION information_schema_stats_expiry = 0")
+	if err == nil {
+		defer func() {
+			_, err := conn.ExecContext(context.Background(), "SET SESSION information_schema_stats_expiry = DEFAULT")
+			if err != nil {
+				g.logger.WithError(err).Warn("failed to reset information_schema_stats_expiry")
+			}
+		}()
+	} else if !isUnknownSystemVariable(err) {
+		return 0, err
+	}
+
+	// data_free is reported for every table of a shared tablespace, which
+	// overestimates the used space rather than underestimating it
+	var used sqlorig.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT SUM(data_length + index_length + data_free) FROM information_schema.tables").Scan(&used)
+	if err != nil {
+		return 0, err
+	}
+	return g.Config.DiskCapacityMB*1024*1024 - used.Int64, nil
+}
+
+func (g *TargetGuard) freeConnections(ctx context.Context) (int, error) {
+	var maxConnections int
+	err := g.DB.QueryRowContext(ctx, "SELECT @@GLOBAL.max_connections").Scan(&maxConnections)
+	if err != nil {
+		return 0, err
+	}
+
+	var name string
+	var threadsConnected int
+	err = g.DB.QueryRowContext(ctx, "SHOW GLOBAL STATUS LIKE 'Threads_connected'").Scan(&name, &threadsConnected)
+	if err != nil {
+		return 0, err
+	}
+
+	return maxConnections - threadsConnected, nil
+}
+
+// guardedThrottler throttles while either its Throttler or the TargetGuard
+// does. Pausing applies to the Throttler, and disabling it does not disable
+// the guard.
+type guardedThrottler struct {
+	Throttler
+	guard *TargetGuard
+}
+
+func (t *guardedThrottler) Throttled() bool {
+	return t.Throttler.Throttled() || t.guard.Throttled()
+}
+
+func (t *guardedThrottler) Disabled() bool {
+	return t.Throttler.Disabled() && !t.guard.Throttled()
+}
+
+// guardedThrottler returns the throttler of the components writing to the
+// target, which includes the TargetGuard if it is enabled
+func (f *Ferry) guardedThrottler(throttler Throttler) Throttler {
+	if f.targetGuard == nil {
+		return throttler
+	}
+	return &guardedThrottler{Throttler: throttler, guard: f.targetGuard}
+}
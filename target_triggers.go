@@ -0,0 +1,223 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+)
+
+const (
+	TargetTriggerPolicyWarn = "warn"
+	TargetTriggerPolicyFail = "fail"
+	TargetTriggerPolicyDrop = "drop"
+)
+
+// TargetTrigger is a trigger on a copied table of the target, with what is
+// needed to create it again once dropped
+type TargetTrigger struct {
+	Schema string
+	Table  string
+	Name   string
+
+	Statement           string
+	SQLMode             string
+	CharacterSetClient  string
+	CollationConnection string
+}
+
+func (t TargetTrigger) String() string {
+	return fmt.Sprintf("%s.%s on %s", t.Schema, t.Name, t.Table)
+}
+
+// handleTargetTriggers applies the TargetTriggerPolicy to the triggers on
+// the copied tables of the target, see Start
+func (f *Ferry) handleTargetTriggers() error {
+	triggers, err := f.TargetTriggers()
+	if err != nil {
+		return fmt.Errorf("listing the triggers of the target: %v", err)
+	}
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(triggers))
+	for i, trigger := range triggers {
+		names[i] = trigger.String()
+	}
+
+	switch f.Config.TargetTriggerPolicy {
+	case TargetTriggerPolicyFail:
+		return fmt.Errorf("the copied tables of the target have triggers, which would fire again on the writes of Ghostferry: %s", strings.Join(names, ", "))
+	case TargetTriggerPolicyDrop:
+		return f.dropTargetTriggers(triggers)
+	default:
+		f.logger.WithField("triggers", names).Warn("the copied tables of the target have triggers, which fire again on the writes of Ghostferry")
+		return nil
+	}
+}
+
+// TargetTriggers returns the triggers on the copied tables of the target, in
+// the order they fire
+func (f *Ferry) TargetTriggers() ([]TargetTrigger, error) {
+	targetTables := make(map[string]bool)
+	for _, table := range f.Tables.AsSlice() {
+		targetTables[f.targetTableName(table)] = true
+	}
+
+	triggers := make([]TargetTrigger, 0)
+	for _, schemaName := range tableSchemaNames(f.Tables.AsSlice(), f.Config.DatabaseRewrites) {
+		rows, err := f.TargetDB.Query("SELECT EVENT_OBJECT_TABLE, TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA = ? ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER", schemaName)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			trigger := TargetTrigger{Schema: schemaName}
+			if err = rows.Scan(&trigger.Table, &trigger.Name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if targetTables[fmt.Sprintf("%s.%s", schemaName, trigger.Table)] {
+				triggers = append(triggers, trigger)
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range triggers {
+		if err := showCreateTrigger(f.TargetDB, &triggers[i]); err != nil {
+			return nil, fmt.Errorf("reading the definition of trigger %s: %v", triggers[i], err)
+		}
+	}
+	return triggers, nil
+}
+
+func (f *Ferry) dropTargetTriggers(triggers []TargetTrigger) error {
+	for _, trigger := range triggers {
+		// kept before dropping, so the trigger is never lost when failing
+		// in between
+		f.StateTracker.AddDroppedTargetTrigger(trigger)
+
+		statement := fmt.Sprintf("DROP TRIGGER %s", QuotedTableNameFromString(trigger.Schema, trigger.Name))
+		_, err := f.TargetDB.Exec(statement)
+		f.recordTargetTriggerStatement(statement, err)
+		if err != nil {
+			return fmt.Errorf("dropping trigger %s: %v", trigger, err)
+		}
+
+		f.logger.WithField("trigger", trigger.String()).Warn("dropped trigger from the target, it is created again before the cutover")
+	}
+	return nil
+}
+
+// RestoreTargetTriggers creates the triggers dropped from the target on
+// start again, see Config.TargetTriggerPolicy. It is to be called once the
+// binlog streaming stopped, right before the cutover.
+func (f *Ferry) RestoreTargetTriggers() error {
+	triggers := f.StateTracker.DroppedTargetTriggers()
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	// the session variables are changed to the ones the triggers were
+	// created with, so the connection must not go back to a shared pool
+	db, err := f.Target.SqlDB(f.logger.WithField("dbname", "target"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, trigger := range triggers {
+		statements := []string{
+			fmt.Sprintf("SET SESSION sql_mode = %s", quoteString(trigger.SQLMode)),
+			fmt.Sprintf("SET SESSION character_set_client = %s, collation_connection = %s", quoteString(trigger.CharacterSetClient), quoteString(trigger.CollationConnection)),
+			fmt.Sprintf("USE %s", QuotedDatabaseNameFromString(trigger.Schema)),
+		}
+		for _, statement := range statements {
+			if _, err = db.Exec(statement); err != nil {
+				return fmt.Errorf("preparing to create trigger %s: %v", trigger, err)
+			}
+		}
+
+		_, err = db.Exec(trigger.Statement)
+		f.recordTargetTriggerStatement(trigger.Statement, err)
+		if err != nil {
+			return fmt.Errorf("creating trigger %s: %v", trigger, err)
+		}
+
+		f.StateTracker.RemoveDroppedTargetTrigger(trigger)
+		f.logger.WithField("trigger", trigger.String()).Info("created trigger on the target again")
+	}
+	return nil
+}
+
+func (f *Ferry) recordTargetTriggerStatement(statement string, err error) {
+	if f.auditLog == nil {
+		return
+	}
+
+	entry := AuditLogEntry{
+		Time:      time.Now(),
+		Type:      AuditEntryTypeDDL,
+		Statement: statement,
+		Outcome:   AuditOutcomeApplied,
+	}
+	if err != nil {
+		entry.Outcome = AuditOutcomeFailed
+		entry.Error = err.Error()
+	}
+	f.auditLog.Record(entry)
+}
+
+// showCreateTrigger fills in the definition of the trigger
+func showCreateTrigger(db *sql.DB, trigger *TargetTrigger) error {
+	rows, err := db.Query(fmt.Sprintf("SHOW CREATE TRIGGER %s", QuotedTableNameFromString(trigger.Schema, trigger.Name)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("trigger does not exist")
+	}
+
+	// the columns differ between versions of MySQL
+	fields := map[string]*string{
+		"sql_mode":               &trigger.SQLMode,
+		"SQL Original Statement": &trigger.Statement,
+		"character_set_client":   &trigger.CharacterSetClient,
+		"collation_connection":   &trigger.CollationConnection,
+	}
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if field, found := fields[column]; found {
+			values[i] = field
+		} else {
+			values[i] = new(interface{})
+		}
+	}
+	if err = rows.Scan(values...); err != nil {
+		return err
+	}
+
+	if trigger.Statement == "" {
+		return fmt.Errorf("no statement returned")
+	}
+	return rows.Err()
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+const AppliedBinlogEventsSchemaName = "gftest_applied_binlog_events"
+
+type AppliedBinlogEventsTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	applied *ghostferry.AppliedBinlogEvents
+	table   *ghostferry.TableSchema
+}
+
+func (this *AppliedBinlogEventsTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.resetDbs()
+
+	this.applied = &ghostferry.AppliedBinlogEvents{
+		DB:       this.Ferry.TargetDB,
+		Database: AppliedBinlogEventsSchemaName,
+		Table:    "_ghostferry_1__binlog_events_applied",
+	}
+	this.Require().Nil(this.applied.Initialize())
+
+	columns := []schema.TableColumn{{Name: "id"}, {Name: "data"}}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{Schema: "gftest", Name: "table1", Columns: columns, PKColumns: []int{0}},
+	}
+}
+
+func (this *AppliedBinlogEventsTestSuite) TearDownTest() {
+	this.resetDbs()
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *AppliedBinlogEventsTestSuite) resetDbs() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", AppliedBinlogEventsSchemaName))
+	this.Require().Nil(err)
+}
+
+func (this *AppliedBinlogEventsTestSuite) insertEvents(eventTime time.Time, ids ...int64) []ghostferry.DXLEventWrapper {
+	rows := make([][]interface{}, len(ids))
+	for i, id := range ids {
+		rows[i] = []interface{}{id, []byte("data")}
+	}
+
+	inserts, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{
+		Table: &replication.TableMapEvent{Schema: []byte("gftest"), Table: []byte("table1")},
+		Rows:  rows,
+	}, ghostferry.BinlogPosition{}, eventTime)
+	this.Require().Nil(err)
+
+	events := make([]ghostferry.DXLEventWrapper, len(inserts))
+	for i, ev := range inserts {
+		events[i] = ghostferry.DXLEventWrapper{DXLEvent: ev, ReplicationEvent: &ghostferry.ReplicationEvent{EventTime: eventTime}}
+	}
+	return events
+}
+
+func (this *AppliedBinlogEventsTestSuite) TestCountsEventsByTable() {
+	first := time.Unix(1600000000, 0)
+	_, err := this.Ferry.TargetDB.Exec(this.applied.RecordSql(this.insertEvents(first, 1, 2)))
+	this.Require().Nil(err)
+
+	second := first.Add(time.Minute)
+	_, err = this.Ferry.TargetDB.Exec(this.applied.RecordSql(this.insertEvents(second, 3)))
+	this.Require().Nil(err)
+
+	counts, err := this.applied.Counts()
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(counts))
+	this.Require().Equal("gftest.table1", counts[0].Table)
+	this.Require().Equal(uint64(3), counts[0].EventsApplied)
+	this.Require().Equal(second.Unix(), counts[0].LastEventTime.Unix())
+	this.Require().False(counts[0].LastAppliedAt.IsZero())
+}
+
+func (this *AppliedBinlogEventsTestSuite) TestNoStatementWithoutDMLEvents() {
+	this.Require().Equal("", this.applied.RecordSql(nil))
+}
+
+func TestAppliedBinlogEvents(t *testing.T) {
+	suite.Run(t, &AppliedBinlogEventsTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditLogTestSuite struct {
+	suite.Suite
+
+	dir string
+}
+
+func (this *AuditLogTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-audit-log")
+	this.Require().Nil(err)
+}
+
+func (this *AuditLogTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+}
+
+func (this *AuditLogTestSuite) newAuditLog(maxFiles int) (*ghostferry.AuditLog, string) {
+	config := &ghostferry.AuditLogConfig{
+		Filename:      filepath.Join(this.dir, "audit.log"),
+		MaxFileSizeMB: 1,
+		MaxFiles:      maxFiles,
+	}
+	this.Require().Nil(config.Validate())
+
+	auditLog, err := ghostferry.NewAuditLog(config, nil, logrus.WithField("tag", "test"))
+	this.Require().Nil(err)
+	return auditLog, config.Filename
+}
+
+func (this *AuditLogTestSuite) TestRecordAppendsJSONLines() {
+	auditLog, filename := this.newAuditLog(5)
+
+	auditLog.Record(ghostferry.AuditLogEntry{
+		Time:      time.Now(),
+		Type:      ghostferry.AuditEntryTypeDDL,
+		Statement: "ALTER TABLE `db`.`t` ADD COLUMN `c` int",
+		Outcome:   ghostferry.AuditOutcomeApplied,
+	})
+	auditLog.Record(ghostferry.AuditLogEntry{
+		Time:      time.Now(),
+		Type:      ghostferry.AuditEntryTypeDML,
+		Statement: "DELETE FROM `db`.`t` WHERE `id` = 1",
+		Outcome:   ghostferry.AuditOutcomeFailed,
+		Error:     "lock wait timeout",
+	})
+	this.Require().Nil(auditLog.Close())
+
+	file, err := os.Open(filename)
+	this.Require().Nil(err)
+	defer file.Close()
+
+	entries := make([]ghostferry.AuditLogEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry ghostferry.AuditLogEntry
+		this.Require().Nil(json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	this.Require().Equal(2, len(entries))
+	this.Require().Equal(ghostferry.AuditEntryTypeDDL, entries[0].Type)
+	this.Require().Equal(ghostferry.AuditOutcomeApplied, entries[0].Outcome)
+	this.Require().Equal("", entries[0].Error)
+	this.Require().Equal(ghostferry.AuditOutcomeFailed, entries[1].Outcome)
+	this.Require().Equal("lock wait timeout", entries[1].Error)
+}
+
+func (this *AuditLogTestSuite) TestRotatesFilesBeyondMaxFileSize() {
+	auditLog, filename := this.newAuditLog(2)
+
+	statement := strings.Repeat("x", 600*1024)
+	for i := 0; i < 4; i++ {
+		auditLog.Record(ghostferry.AuditLogEntry{
+			Type:      ghostferry.AuditEntryTypeDML,
+			Statement: statement,
+			Outcome:   ghostferry.AuditOutcomeApplied,
+		})
+	}
+	this.Require().Nil(auditLog.Close())
+
+	for _, name := range []string{filename, filename + ".1", filename + ".2"} {
+		info, err := os.Stat(name)
+		this.Require().Nil(err)
+		this.Require().True(info.Size() < 1024*1024)
+	}
+
+	_, err := os.Stat(filename + ".3")
+	this.Require().True(os.IsNotExist(err))
+}
+
+func TestAuditLog(t *testing.T) {
+	suite.Run(t, new(AuditLogTestSuite))
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type AutoIncrementSyncTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+}
+
+func (t *AutoIncrementSyncTestSuite) SetupTest() {
+	t.GhostferryUnitTestSuite.SetupTest()
+	t.SeedSourceDB(10)
+	t.SeedTargetDB(5)
+
+	tableFilter := &testhelpers.TestTableFilter{
+		DbsFunc:    testhelpers.DbApplicabilityFilter([]string{testhelpers.TestSchemaName}),
+		TablesFunc: nil,
+	}
+
+	tables, err := ghostferry.LoadTables(t.Ferry.SourceDB, tableFilter, nil, nil, nil)
+	t.Require().Nil(err)
+	t.Ferry.Tables = tables
+}
+
+func (t *AutoIncrementSyncTestSuite) TestAdvancesTargetPastSource() {
+	t.Ferry.Config.AutoIncrementSync = ghostferry.AutoIncrementSyncConfig{Enabled: true, Headroom: 100}
+
+	t.Require().Nil(t.Ferry.SyncAutoIncrements())
+	t.Require().Equal(uint64(111), t.targetAutoIncrement())
+}
+
+func (t *AutoIncrementSyncTestSuite) TestDoesNotDecreaseTarget() {
+	_, err := t.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = 1000", ghostferry.QuotedTableNameFromString(testhelpers.TestSchemaName, testhelpers.TestTable1Name)))
+	t.Require().Nil(err)
+
+	t.Ferry.Config.AutoIncrementSync = ghostferry.AutoIncrementSyncConfig{Enabled: true}
+
+	t.Require().Nil(t.Ferry.SyncAutoIncrements())
+	t.Require().Equal(uint64(1000), t.targetAutoIncrement())
+}
+
+func (t *AutoIncrementSyncTestSuite) targetAutoIncrement() uint64 {
+	tx, err := t.Ferry.TargetDB.Begin()
+	t.Require().Nil(err)
+	defer tx.Rollback()
+
+	// not supported before MySQL 8.0
+	tx.Exec("SET SESSION information_schema_stats_expiry = 0")
+
+	var value uint64
+	row := tx.QueryRow("SELECT AUTO_INCREMENT FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	t.Require().Nil(row.Scan(&value))
+	return value
+}
+
+func TestAutoIncrementSync(t *testing.T) {
+	suite.Run(t, &AutoIncrementSyncTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type BatchWriterTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	db     *sql.DB
+	table  *ghostferry.TableSchema
+	writer *ghostferry.BatchWriter
+}
+
+func (this *BatchWriterTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedTargetDB(0)
+
+	tableFilter := &testhelpers.TestTableFilter{
+		DbsFunc:    testhelpers.DbApplicabilityFilter([]string{testhelpers.TestSchemaName}),
+		TablesFunc: nil,
+	}
+	tables, err := ghostferry.LoadTables(this.Ferry.TargetDB, tableFilter, nil, nil, nil)
+	this.Require().Nil(err)
+	this.table = tables.Get(testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+
+	// the driver refuses to send the statements larger than its
+	// maxAllowedPacket, as the server does for its max_allowed_packet
+	cfg, err := this.Ferry.Config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	cfg.MaxAllowedPacket = 4096
+	this.db, err = sql.Open("mysql", cfg.FormatDSN(), "")
+	this.Require().Nil(err)
+
+	this.writer = &ghostferry.BatchWriter{
+		DB:           this.db,
+		StateTracker: ghostferry.NewStateTracker(0),
+		WriteRetries: 5,
+	}
+	this.writer.Initialize()
+}
+
+func (this *BatchWriterTestSuite) TearDownTest() {
+	if this.db != nil {
+		this.db.Close()
+	}
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *BatchWriterTestSuite) TestHalvesTheBatchSizeOfTooLargeBatches() {
+	// 10 rows of 1000 bytes are too large to be written at once, and so are
+	// 5 of them
+	this.Require().Nil(this.writer.WriteRowBatch(this.batch(1, repeatedSize(10, 1000)...)))
+	this.Require().Equal(2, this.writer.BatchSize(this.table.String()))
+	this.requireWrittenRows(10)
+	this.requireLastSuccessfulPaginationKey(10)
+
+	// the reduced batch size is kept for the next batches of the table
+	this.Require().Nil(this.writer.WriteRowBatch(this.batch(11, repeatedSize(3, 100)...)))
+	this.Require().Equal(2, this.writer.BatchSize(this.table.String()))
+	this.requireWrittenRows(13)
+	this.requireLastSuccessfulPaginationKey(13)
+}
+
+func (this *BatchWriterTestSuite) TestDoesNotReduceTheBatchSizeOfBatchesWrittenAtOnce() {
+	this.Require().Nil(this.writer.WriteRowBatch(this.batch(1, repeatedSize(10, 100)...)))
+	this.Require().Equal(0, this.writer.BatchSize(this.table.String()))
+	this.requireWrittenRows(10)
+	this.requireLastSuccessfulPaginationKey(10)
+}
+
+func (this *BatchWriterTestSuite) TestFailsOnRowsTooLargeToBeWritten() {
+	this.Require().Nil(this.writer.WriteRowBatch(this.batch(1, 100, 100)))
+
+	// the first row is written on its own before the second one fails
+	err := this.writer.WriteRowBatch(this.batch(3, 100, 5000))
+	this.Require().True(ghostferry.IsPacketTooLarge(err))
+	this.Require().Equal(1, this.writer.BatchSize(this.table.String()))
+	this.requireWrittenRows(3)
+	this.requireLastSuccessfulPaginationKey(3)
+}
+
+// batch returns a batch of rows with consecutive ids, whose data are of the
+// given sizes
+func (this *BatchWriterTestSuite) batch(firstId int, dataSizes ...int) *ghostferry.DataRowBatch {
+	values := make([]ghostferry.RowData, len(dataSizes))
+	for i, dataSize := range dataSizes {
+		values[i] = ghostferry.RowData{int64(firstId + i), strings.Repeat("a", dataSize)}
+	}
+	return ghostferry.NewDataRowBatch(this.table, values)
+}
+
+func repeatedSize(rows, dataSize int) []int {
+	dataSizes := make([]int, rows)
+	for i := range dataSizes {
+		dataSizes[i] = dataSize
+	}
+	return dataSizes
+}
+
+func (this *BatchWriterTestSuite) requireWrittenRows(expected int) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	this.Require().Nil(this.Ferry.TargetDB.QueryRow(query).Scan(&count))
+	this.Require().Equal(expected, count)
+}
+
+func (this *BatchWriterTestSuite) requireLastSuccessfulPaginationKey(expected int64) {
+	paginationKey, completed := this.writer.StateTracker.LastSuccessfulPaginationKey(this.table.String())
+	this.Require().False(completed)
+	this.Require().NotNil(paginationKey)
+	this.Require().Equal(ghostferry.RowData{expected}, paginationKey.Values)
+}
+
+func TestBatchWriter(t *testing.T) {
+	suite.Run(t, &BatchWriterTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/stretchr/testify/suite"
+)
+
+type BidirectionalFerryTestSuite struct {
+	suite.Suite
+
+	forward *ghostferry.Ferry
+	reverse *ghostferry.Ferry
+}
+
+func (this *BidirectionalFerryTestSuite) SetupTest() {
+	cluster1 := ghostferry.DatabaseConfig{Host: "cluster1", Port: 3306, User: "ghostferry1"}
+	cluster2 := ghostferry.DatabaseConfig{Host: "cluster2", Port: 3306, User: "ghostferry2"}
+
+	forwardSource, forwardTarget := cluster1, cluster2
+	reverseSource, reverseTarget := cluster2, cluster1
+
+	this.forward = &ghostferry.Ferry{Config: &ghostferry.Config{Source: &forwardSource, Target: &forwardTarget, DisableCutover: true}}
+	this.reverse = &ghostferry.Ferry{Config: &ghostferry.Config{Source: &reverseSource, Target: &reverseTarget, DisableCutover: true}}
+}
+
+func (this *BidirectionalFerryTestSuite) TestIgnoresTargetUserOfOppositeFerry() {
+	_, err := ghostferry.NewBidirectionalFerry(this.forward, this.reverse)
+	this.Require().Nil(err)
+
+	this.Require().Equal("ghostferry1", this.forward.Config.LoopPrevention.IgnoredUser)
+	this.Require().Equal("ghostferry2", this.reverse.Config.LoopPrevention.IgnoredUser)
+	this.Require().Equal("1s", this.forward.Config.LoopPrevention.SessionRefreshInterval)
+}
+
+func (this *BidirectionalFerryTestSuite) TestRejectsUnrelatedDatabases() {
+	this.reverse.Config.Source.Host = "cluster3"
+	_, err := ghostferry.NewBidirectionalFerry(this.forward, this.reverse)
+	this.Require().EqualError(err, "the reverse ferry must replicate from the target to the source of the forward ferry")
+}
+
+func (this *BidirectionalFerryTestSuite) TestRequiresDisabledCutover() {
+	this.reverse.Config.DisableCutover = false
+	_, err := ghostferry.NewBidirectionalFerry(this.forward, this.reverse)
+	this.Require().EqualError(err, "bidirectional replication requires DisableCutover on both ferries")
+}
+
+func (this *BidirectionalFerryTestSuite) TestRejectsMismatchingIgnoredUser() {
+	this.forward.Config.LoopPrevention.IgnoredUser = "app"
+	_, err := ghostferry.NewBidirectionalFerry(this.forward, this.reverse)
+	this.Require().EqualError(err, "LoopPrevention.IgnoredUser (app) must be the Target user of the opposite ferry (ghostferry1)")
+}
+
+func (this *BidirectionalFerryTestSuite) TestIgnoresComponentUsersOfOppositeFerry() {
+	this.reverse.Config.Target.ComponentCredentials.BinlogWriter = &ghostferry.CredentialsConfig{User: "ghostferry1_binlog"}
+	this.reverse.Config.Target.ComponentCredentials.StateTracker = &ghostferry.CredentialsConfig{User: "ghostferry1"}
+	_, err := ghostferry.NewBidirectionalFerry(this.forward, this.reverse)
+	this.Require().Nil(err)
+
+	this.forward.OverallState = ghostferry.StateStarting
+	this.reverse.OverallState = ghostferry.StateStarting
+
+	filter := this.forward.NewLoopPreventionFilter()
+	this.Require().Equal([]string{"ghostferry1", "ghostferry1_binlog"}, filter.IgnoredUsers)
+
+	filter = this.reverse.NewLoopPreventionFilter()
+	this.Require().Equal([]string{"ghostferry2"}, filter.IgnoredUsers)
+}
+
+func (this *BidirectionalFerryTestSuite) TestSkipsRecordedSessionsOfOppositeFerry() {
+	ignoredSessions := &sync.Map{}
+	ignoredSessions.Store(uint32(42), true)
+	filter := &ghostferry.LoopPreventionFilter{IgnoredSessions: ignoredSessions}
+
+	this.Require().True(filter.SkipEvent(queryEvent(42)))
+	this.Require().True(filter.SkipEvent(&ghostferry.ReplicationEvent{
+		BinlogEvent: &replication.BinlogEvent{Event: &replication.RowsEvent{Table: &replication.TableMapEvent{Table: []byte("table1")}}},
+	}))
+}
+
+func queryEvent(threadId uint32) *ghostferry.ReplicationEvent {
+	return &ghostferry.ReplicationEvent{
+		BinlogEvent: &replication.BinlogEvent{Event: &replication.QueryEvent{SlaveProxyID: threadId}},
+	}
+}
+
+func TestBidirectionalFerry(t *testing.T) {
+	suite.Run(t, new(BidirectionalFerryTestSuite))
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type BinlogCatchUpTestSuite struct {
+	suite.Suite
+}
+
+func (this *BinlogCatchUpTestSuite) TestBytesBetweenPositionsOfTheSameFile() {
+	from := mysql.Position{Name: "mysql-bin.000002", Pos: 1000}
+	to := mysql.Position{Name: "mysql-bin.000002", Pos: 4000}
+
+	this.Require().Equal(uint64(3000), ghostferry.BinlogBytesBetween(from, to, nil))
+	this.Require().Equal(uint64(0), ghostferry.BinlogBytesBetween(to, from, nil))
+	this.Require().Equal(uint64(0), ghostferry.BinlogBytesBetween(from, from, nil))
+}
+
+func (this *BinlogCatchUpTestSuite) TestBytesBetweenPositionsOfDifferentFiles() {
+	binaryLogs := []ghostferry.BinaryLog{
+		{Name: "mysql-bin.000001", Size: 5000},
+		{Name: "mysql-bin.000002", Size: 6000},
+		{Name: "mysql-bin.000003", Size: 7000},
+		{Name: "mysql-bin.000004", Size: 800},
+	}
+	from := mysql.Position{Name: "mysql-bin.000002", Pos: 1000}
+	to := mysql.Position{Name: "mysql-bin.000004", Pos: 500}
+
+	this.Require().Equal(uint64(5000+7000+500), ghostferry.BinlogBytesBetween(from, to, binaryLogs))
+}
+
+func (this *BinlogCatchUpTestSuite) TestValidatesConfig() {
+	config := &ghostferry.CatchUpConfig{}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("10s", config.MaxLag)
+	this.Require().Equal("500ms", config.CheckInterval)
+
+	config = &ghostferry.CatchUpConfig{CheckInterval: "0s"}
+	this.Require().EqualError(config.Validate(), "invalid CheckInterval specified (set to 0s)")
+}
+
+func TestBinlogCatchUp(t *testing.T) {
+	suite.Run(t, new(BinlogCatchUpTestSuite))
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type BinlogEventFilterTestSuite struct {
+	suite.Suite
+
+	table  *ghostferry.TableSchema
+	tables ghostferry.TableSchemaCache
+	config *ghostferry.BinlogEventFilterConfig
+}
+
+func (this *BinlogEventFilterTestSuite) SetupTest() {
+	columns := []schema.TableColumn{
+		schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER},
+		schema.TableColumn{Name: "kind", Type: schema.TYPE_STRING},
+		schema.TableColumn{Name: "views", Type: schema.TYPE_NUMBER},
+	}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{
+			Schema:  "test_schema",
+			Name:    "counters",
+			Columns: columns,
+		},
+		PaginationKey: &ghostferry.PaginationKey{
+			Columns:       []*schema.TableColumn{&columns[0]},
+			ColumnIndices: []int{0},
+		},
+	}
+	this.tables = ghostferry.TableSchemaCache{"test_schema.counters": this.table}
+	this.config = &ghostferry.BinlogEventFilterConfig{
+		Rules: map[string]map[string][]ghostferry.BinlogEventFilterRule{
+			"test_schema": {
+				"counters": {
+					{Events: []string{"update"}, ChangedColumnsWithin: []string{"views"}},
+					{Conditions: []ghostferry.BinlogEventFilterCondition{
+						{Column: "kind", Operator: "IN", Values: []string{"scratch", "tmp"}},
+						{Column: "id", Operator: ">=", Value: "100"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func (this *BinlogEventFilterTestSuite) rowsEvent(rows ...[]interface{}) *replication.RowsEvent {
+	return &replication.RowsEvent{
+		Table: &replication.TableMapEvent{Schema: []byte("test_schema"), Table: []byte("counters")},
+		Rows:  rows,
+	}
+}
+
+func (this *BinlogEventFilterTestSuite) TestSkipsUpdatesOfChangedColumnsWithin() {
+	filter, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	events, err := ghostferry.NewBinlogUpdateEvents(this.table, this.rowsEvent(
+		[]interface{}{int64(1), []byte("page"), int64(10)},
+		[]interface{}{int64(1), []byte("page"), int64(11)},
+		[]interface{}{int64(2), []byte("page"), int64(10)},
+		[]interface{}{int64(2), []byte("post"), int64(11)},
+	), ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+	this.Require().Equal(2, len(events))
+
+	this.Require().True(filter.Skip(events[0]))
+	this.Require().False(filter.Skip(events[1]))
+}
+
+func (this *BinlogEventFilterTestSuite) TestSkipsEventsMatchingAllConditions() {
+	filter, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	events, err := ghostferry.NewBinlogInsertEvents(this.table, this.rowsEvent(
+		[]interface{}{int64(100), []byte("tmp"), int64(0)},
+		[]interface{}{int64(99), []byte("tmp"), int64(0)},
+		[]interface{}{int64(100), []byte("page"), int64(0)},
+		[]interface{}{int64(100), nil, int64(0)},
+	), ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	this.Require().True(filter.Skip(events[0]))
+	this.Require().False(filter.Skip(events[1]))
+	this.Require().False(filter.Skip(events[2]))
+	this.Require().False(filter.Skip(events[3]))
+}
+
+func (this *BinlogEventFilterTestSuite) TestMatchesRowsByPaginationKeyAfterSkippedUpdates() {
+	filter, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	updates, err := ghostferry.NewBinlogUpdateEvents(this.table, this.rowsEvent(
+		[]interface{}{int64(1), []byte("page"), int64(10)},
+		[]interface{}{int64(1), []byte("post"), int64(11)},
+	), ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+	this.Require().False(filter.Skip(updates[0]))
+	filter.MatchByPaginationKey(updates[0])
+
+	query, err := updates[0].AsSQLString("test_schema", "counters")
+	this.Require().Nil(err)
+	this.Require().Equal("UPDATE `test_schema`.`counters` SET `id`=1,`kind`=_binary'post',`views`=11 WHERE `id`=1", query)
+
+	deletes, err := ghostferry.NewBinlogDeleteEvents(this.table, this.rowsEvent(
+		[]interface{}{int64(1), []byte("post"), int64(12)},
+	), ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+	filter.MatchByPaginationKey(deletes[0])
+
+	query, err = deletes[0].AsSQLString("test_schema", "counters")
+	this.Require().Nil(err)
+	this.Require().Equal("DELETE FROM `test_schema`.`counters` WHERE `id`=1", query)
+}
+
+func (this *BinlogEventFilterTestSuite) TestMatchesRowsByAllColumnsWithoutSkippedUpdates() {
+	this.config.Rules["test_schema"]["counters"] = []ghostferry.BinlogEventFilterRule{
+		{Events: []string{"INSERT", "DELETE"}, Conditions: []ghostferry.BinlogEventFilterCondition{
+			{Column: "kind", Operator: "=", Value: "tmp"},
+		}},
+	}
+	filter, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	deletes, err := ghostferry.NewBinlogDeleteEvents(this.table, this.rowsEvent(
+		[]interface{}{int64(1), []byte("post"), int64(12)},
+	), ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+	filter.MatchByPaginationKey(deletes[0])
+
+	query, err := deletes[0].AsSQLString("test_schema", "counters")
+	this.Require().Nil(err)
+	this.Require().Equal("DELETE FROM `test_schema`.`counters` WHERE `id`=1 AND `kind`=_binary'post' AND `views`=12", query)
+}
+
+func (this *BinlogEventFilterTestSuite) TestRejectsSkippedUpdatesWithoutPaginationKey() {
+	this.table.PaginationKey = nil
+	_, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().EqualError(err, "table test_schema.counters has no pagination key to match the rows of its events by, which is required to skip its UPDATEs")
+}
+
+func (this *BinlogEventFilterTestSuite) TestRejectsUnknownColumns() {
+	this.config.Rules["test_schema"]["counters"][0].ChangedColumnsWithin = []string{"clicks"}
+	_, err := ghostferry.NewBinlogEventFilter(this.config, this.tables)
+	this.Require().EqualError(err, "column clicks of table test_schema.counters does not exist")
+}
+
+func (this *BinlogEventFilterTestSuite) TestValidatesRules() {
+	this.Require().Nil(this.config.Validate())
+
+	this.config.Rules["test_schema"]["counters"][1].Conditions[0].Operator = "LIKE"
+	this.Require().EqualError(this.config.Validate(), "rule of test_schema.counters: invalid Operator specified (set to LIKE)")
+
+	this.config.Rules["test_schema"]["counters"][1] = ghostferry.BinlogEventFilterRule{Events: []string{"DELETE"}}
+	this.Require().EqualError(this.config.Validate(), "rule of test_schema.counters: Conditions or ChangedColumnsWithin must be specified")
+}
+
+func TestBinlogEventFilter(t *testing.T) {
+	suite.Run(t, new(BinlogEventFilterTestSuite))
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type BinlogEventHistoryTestSuite struct {
+	suite.Suite
+
+	history *ghostferry.BinlogEventHistory
+}
+
+func (this *BinlogEventHistoryTestSuite) SetupTest() {
+	this.history = ghostferry.NewBinlogEventHistory(2)
+}
+
+func (this *BinlogEventHistoryTestSuite) record(pos uint32) ghostferry.BinlogEventRecord {
+	return ghostferry.BinlogEventRecord{
+		Position: ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: pos}),
+		Table:    "gftest.table1",
+	}
+}
+
+func (this *BinlogEventHistoryTestSuite) TestKeepsLastAppliedEvents() {
+	this.history.Applied([]ghostferry.BinlogEventRecord{this.record(10), this.record(20)}, this.record(20).Position)
+	this.history.Applied([]ghostferry.BinlogEventRecord{this.record(30)}, this.record(30).Position)
+
+	snapshot := this.history.Snapshot()
+	this.Require().Equal([]ghostferry.BinlogEventRecord{this.record(20), this.record(30)}, snapshot.Applied)
+	this.Require().Equal(0, len(snapshot.Pending))
+}
+
+func (this *BinlogEventHistoryTestSuite) TestKeepsFirstPendingEvents() {
+	this.history.Received(this.record(10))
+	this.history.Received(this.record(20))
+	this.history.Received(this.record(30))
+
+	snapshot := this.history.Snapshot()
+	this.Require().Equal(0, len(snapshot.Applied))
+	this.Require().Equal([]ghostferry.BinlogEventRecord{this.record(10), this.record(20)}, snapshot.Pending)
+
+	// filtered events are no longer pending once a later event is applied
+	this.history.Applied(nil, this.record(10).Position)
+	this.history.Received(this.record(40))
+
+	snapshot = this.history.Snapshot()
+	this.Require().Equal(0, len(snapshot.Applied))
+	this.Require().Equal([]ghostferry.BinlogEventRecord{this.record(20), this.record(40)}, snapshot.Pending)
+}
+
+func (this *BinlogEventHistoryTestSuite) TestIgnoresEventsWithoutHistory() {
+	var history *ghostferry.BinlogEventHistory
+	history.Received(this.record(10))
+	history.Applied([]ghostferry.BinlogEventRecord{this.record(10)}, this.record(10).Position)
+}
+
+func TestBinlogEventHistory(t *testing.T) {
+	suite.Run(t, new(BinlogEventHistoryTestSuite))
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type BinlogRetentionMonitorTestSuite struct {
+	suite.Suite
+
+	age      time.Duration
+	notified []string
+	monitor  *ghostferry.BinlogRetentionMonitor
+}
+
+func (this *BinlogRetentionMonitorTestSuite) SetupTest() {
+	config := &ghostferry.BinlogRetentionConfig{WarningMargin: "1h", Retention: "24h"}
+	this.Require().Nil(config.Validate())
+
+	this.age = 0
+	this.notified = nil
+	this.monitor = &ghostferry.BinlogRetentionMonitor{
+		Config: config,
+		Position: func() mysql.Position {
+			return mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+		},
+		Age: func(now time.Time) time.Duration {
+			return this.age
+		},
+		Notify: func(event, summary string, details map[string]string) {
+			this.notified = append(this.notified, event)
+		},
+	}
+}
+
+func (this *BinlogRetentionMonitorTestSuite) TestAlertsOnceWhenPositionIsAboutToBePurged() {
+	now := time.Now()
+	this.Require().False(this.monitor.Check(now))
+
+	this.age = 22 * time.Hour
+	this.Require().False(this.monitor.Check(now))
+
+	this.age = 23*time.Hour + time.Minute
+	this.Require().True(this.monitor.Check(now))
+	this.Require().True(this.monitor.Check(now))
+	this.Require().Equal([]string{ghostferry.NotificationBinlogRetentionAtRisk}, this.notified)
+
+	this.age = 0
+	this.Require().False(this.monitor.Check(now))
+
+	this.age = 24 * time.Hour
+	this.Require().True(this.monitor.Check(now))
+	this.Require().Equal(2, len(this.notified))
+}
+
+func (this *BinlogRetentionMonitorTestSuite) TestIgnoresStateWithoutPosition() {
+	this.monitor.Position = func() mysql.Position {
+		return mysql.Position{}
+	}
+	this.age = 48 * time.Hour
+
+	this.Require().False(this.monitor.Check(time.Now()))
+	this.Require().Nil(this.notified)
+}
+
+func (this *BinlogRetentionMonitorTestSuite) TestValidatesConfig() {
+	config := &ghostferry.BinlogRetentionConfig{}
+	this.Require().False(config.Enabled())
+
+	config.WarningMargin = "6h"
+	this.Require().True(config.Enabled())
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("1m", config.CheckInterval)
+
+	config.Retention = "0s"
+	this.Require().NotNil(config.Validate())
+
+	config.Retention = ""
+	config.WarningMargin = "-1h"
+	this.Require().NotNil(config.Validate())
+}
+
+func TestBinlogRetentionMonitor(t *testing.T) {
+	suite.Run(t, new(BinlogRetentionMonitorTestSuite))
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"strings"
 	"sync"
@@ -75,6 +76,47 @@ func (this *BinlogStreamerTestSuite) TestConnectWithZeroIdGetsRandomServerId() {
 	this.Require().NotZero(this.binlogStreamer.MyServerId)
 }
 
+func (this *BinlogStreamerTestSuite) TestConnectWithZeroIdGetsServerIdInRange() {
+	this.binlogStreamer.MyServerId = 0
+	this.binlogStreamer.MyServerIdMin = 5000
+	this.binlogStreamer.MyServerIdMax = 5009
+
+	_, err := this.binlogStreamer.ConnectBinlogStreamerToMysql()
+
+	this.Require().Nil(err)
+	this.Require().True(this.binlogStreamer.MyServerId >= 5000)
+	this.Require().True(this.binlogStreamer.MyServerId <= 5009)
+}
+
+func (this *BinlogStreamerTestSuite) TestConnectErrorsOutIfIdIsServerIdOfSource() {
+	var sourceId uint32
+	err := this.binlogStreamer.DB.QueryRow("SELECT @@server_id").Scan(&sourceId)
+	this.Require().Nil(err)
+
+	this.binlogStreamer.MyServerId = sourceId
+
+	_, err = this.binlogStreamer.ConnectBinlogStreamerToMysql()
+
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "is already used by the source")
+}
+
+func (this *BinlogStreamerTestSuite) TestConnectErrorsOutIfAllServerIdsInRangeAreTaken() {
+	var sourceId uint32
+	err := this.binlogStreamer.DB.QueryRow("SELECT @@server_id").Scan(&sourceId)
+	this.Require().Nil(err)
+
+	this.binlogStreamer.MyServerId = 0
+	this.binlogStreamer.MyServerIdMin = sourceId
+	this.binlogStreamer.MyServerIdMax = sourceId
+
+	_, err = this.binlogStreamer.ConnectBinlogStreamerToMysql()
+
+	this.Require().NotNil(err)
+	this.Require().Equal(fmt.Sprintf("no unused server_id found between %d and %d after 100 attempts", sourceId, sourceId), err.Error())
+	this.Require().Zero(this.binlogStreamer.MyServerId)
+}
+
 func (this *BinlogStreamerTestSuite) TestConnectErrorsOutIfErrorInServerIdGeneration() {
 	this.binlogStreamer.MyServerId = 0
 
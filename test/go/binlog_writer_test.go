@@ -0,0 +1,236 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type BinlogWriterApplyDelayTestSuite struct {
+	suite.Suite
+
+	ferry  *ghostferry.Ferry
+	writer *ghostferry.BinlogWriter
+	done   chan struct{}
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config:       &ghostferry.Config{BinlogEventBatchSize: 10},
+		Tables:       ghostferry.TableSchemaCache{},
+		OverallState: ghostferry.StateStarting,
+	}
+	this.writer = this.ferry.NewBinlogWriter()
+	this.writer.ApplyDelay = 200 * time.Millisecond
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) run() {
+	this.done = make(chan struct{})
+	go func() {
+		defer close(this.done)
+		this.writer.Run()
+	}()
+
+	this.waitForState(ghostferry.WriterStateWaitingForEvents)
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestHoldsEventsForTheDelay() {
+	this.run()
+	start := time.Now()
+	this.bufferEvent(start)
+	this.writer.Stop()
+
+	this.waitForState(ghostferry.WriterStateDelayed)
+	<-this.done
+	this.Require().True(time.Since(start) >= this.writer.ApplyDelay)
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestDoesNotHoldOldEvents() {
+	this.run()
+	start := time.Now()
+	this.bufferEvent(start.Add(-time.Hour))
+	this.writer.Stop()
+
+	<-this.done
+	this.Require().True(time.Since(start) < this.writer.ApplyDelay)
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestShutdownInterruptsTheDelay() {
+	this.writer.ApplyDelay = time.Hour
+	this.run()
+	this.bufferEvent(time.Now())
+	this.waitForState(ghostferry.WriterStateDelayed)
+
+	this.writer.Shutdown()
+	select {
+	case <-this.done:
+	case <-time.After(time.Second):
+		this.Fail("the writer did not return on shutdown")
+	}
+
+	// the streamer is not blocked by the writer that returned
+	this.Require().Nil(this.writer.BufferBinlogEvents(this.event(time.Now())))
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestRegistersTablesWhileDelayed() {
+	this.writer.ApplyDelay = time.Hour
+	this.run()
+	this.bufferEvent(time.Now())
+	this.waitForState(ghostferry.WriterStateDelayed)
+
+	table := &ghostferry.TableSchema{Table: &schema.Table{Schema: "gftest", Name: "delayed"}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	this.Require().Nil(this.writer.RegisterTables(ctx, []*ghostferry.TableSchema{table}))
+	this.Require().Equal(table, this.writer.TableSchema.Get("gftest", "delayed"))
+
+	this.writer.Shutdown()
+	<-this.done
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestRegistersTablesWhileTheStateIsSerialized() {
+	this.writer.ApplyDelay = 0
+	this.ferry.StateTracker = ghostferry.NewStateTracker(0)
+	this.run()
+
+	serialized := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			_, err = this.ferry.SerializeStateToJSON()
+		}
+		serialized <- err
+	}()
+
+	for i := 0; i < 100; i++ {
+		table := &ghostferry.TableSchema{Table: &schema.Table{Schema: "gftest", Name: fmt.Sprintf("created%d", i)}}
+		this.Require().Nil(this.writer.RegisterTables(context.Background(), []*ghostferry.TableSchema{table}))
+	}
+	this.Require().Nil(<-serialized)
+
+	state, err := this.ferry.SerializeStateToJSON()
+	this.Require().Nil(err)
+	this.Require().Contains(state, "created99")
+	this.Require().Equal(100, len(this.ferry.Tables))
+
+	this.writer.Stop()
+	<-this.done
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestApplyLagIsMeasuredUntilTheStreamingIsIdle() {
+	this.writer.ApplyDelay = 0
+	this.writer.DiscardWrites = true
+	this.writer.Throttler = &ghostferry.PauserThrottler{}
+	this.addCopiedTable()
+	idle := int32(0)
+	this.writer.StreamingIdle = func() bool { return atomic.LoadInt32(&idle) == 1 }
+	this.run()
+
+	now := time.Now()
+	this.Require().Equal(time.Duration(0), this.writer.ApplyLag(now))
+
+	eventTime := now.Add(-time.Hour)
+	this.bufferRowsEvent(eventTime)
+	this.waitForApplyLag()
+	this.waitForState(ghostferry.WriterStateWaitingForEvents)
+
+	// the buffer is empty, but the streamer is still behind the source
+	this.Require().Equal(now.Sub(eventTime), this.writer.ApplyLag(now))
+
+	atomic.StoreInt32(&idle, 1)
+	this.Require().Equal(time.Duration(0), this.writer.ApplyLag(now))
+
+	this.writer.Stop()
+	<-this.done
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) TestApplyLagWithoutStreamingIdle() {
+	this.writer.ApplyDelay = 0
+	this.writer.DiscardWrites = true
+	this.writer.Throttler = &ghostferry.PauserThrottler{}
+	this.addCopiedTable()
+	this.run()
+
+	now := time.Now()
+	eventTime := now.Add(-time.Minute)
+	this.bufferRowsEvent(eventTime)
+	this.waitForApplyLag()
+	this.waitForState(ghostferry.WriterStateWaitingForEvents)
+	this.Require().Equal(now.Sub(eventTime), this.writer.ApplyLag(now))
+
+	this.writer.Stop()
+	<-this.done
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) waitForApplyLag() {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if this.writer.ApplyLag(time.Now()) > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	this.FailNow("the writer did not apply the event")
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) bufferEvent(eventTime time.Time) {
+	this.Require().Nil(this.writer.BufferBinlogEvents(this.event(eventTime)))
+}
+
+// addCopiedTable adds the table of bufferRowsEvent before the writer runs, as
+// only the events of copied tables are applied
+func (this *BinlogWriterApplyDelayTestSuite) addCopiedTable() {
+	table := &ghostferry.TableSchema{Table: &schema.Table{
+		Schema:    "gftest",
+		Name:      "table1",
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}},
+		PKColumns: []int{0},
+	}}
+	this.writer.TableSchema[table.String()] = table
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) bufferRowsEvent(eventTime time.Time) {
+	this.Require().Nil(this.writer.BufferBinlogEvents(&ghostferry.ReplicationEvent{
+		BinlogEvent: &replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+			Event: &replication.RowsEvent{
+				Table: &replication.TableMapEvent{Schema: []byte("gftest"), Table: []byte("table1")},
+				Rows:  [][]interface{}{{int64(1)}},
+			},
+		},
+		EventTime: eventTime,
+	}))
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) event(eventTime time.Time) *ghostferry.ReplicationEvent {
+	return &ghostferry.ReplicationEvent{
+		BinlogEvent: &replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: replication.QUERY_EVENT},
+			Event:  &replication.QueryEvent{Query: []byte("BEGIN")},
+		},
+		EventTime: eventTime,
+	}
+}
+
+func (this *BinlogWriterApplyDelayTestSuite) waitForState(state ghostferry.BinlogWriterState) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if current, _ := this.writer.GetWriterState(); current == state {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	this.FailNow("the writer did not reach the state " + string(state))
+}
+
+func TestBinlogWriterApplyDelay(t *testing.T) {
+	suite.Run(t, new(BinlogWriterApplyDelayTestSuite))
+}
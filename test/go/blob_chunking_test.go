@@ -0,0 +1,105 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type BlobChunkingTestSuite struct {
+	suite.Suite
+
+	table  *ghostferry.TableSchema
+	tables ghostferry.TableSchemaCache
+	config *ghostferry.BlobChunkingConfig
+}
+
+func (this *BlobChunkingTestSuite) SetupTest() {
+	columns := []schema.TableColumn{
+		schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER, RawType: "bigint(20)"},
+		schema.TableColumn{Name: "name", Type: schema.TYPE_STRING, RawType: "varchar(255)"},
+		schema.TableColumn{Name: "data", Type: schema.TYPE_STRING, RawType: "longblob"},
+	}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{
+			Schema:    "test_schema",
+			Name:      "test_table",
+			Columns:   columns,
+			PKColumns: []int{0},
+		},
+		PaginationKey: &ghostferry.PaginationKey{
+			Columns:       []*schema.TableColumn{&columns[0]},
+			ColumnIndices: []int{0},
+		},
+	}
+	this.tables = ghostferry.TableSchemaCache{"test_schema.test_table": this.table}
+	this.config = &ghostferry.BlobChunkingConfig{
+		Columns:   map[string]map[string][]string{"test_schema": {"test_table": {"data"}}},
+		ChunkSize: 1024,
+	}
+}
+
+func (this *BlobChunkingTestSuite) TestSelectsEmptyValuesForChunkedColumns() {
+	chunker, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().Nil(err)
+
+	this.Require().Equal([]string{
+		"`id`",
+		"`name`",
+		"IF(`data` IS NULL, NULL, '') AS `data`",
+	}, chunker.ColumnsToSelect(this.table))
+}
+
+func (this *BlobChunkingTestSuite) TestSelectsAllColumnsOfOtherTables() {
+	this.config.Columns = map[string]map[string][]string{"test_schema": {"other_table": {"data"}}}
+	chunker, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().Nil(err)
+
+	this.Require().Nil(chunker.ColumnsToSelect(this.table))
+}
+
+func (this *BlobChunkingTestSuite) TestSinksReceiveNullValuesAsTheyAre() {
+	chunker, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().Nil(err)
+
+	// NULL values are not read from the source
+	batch := ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a"), nil},
+	})
+	sinkBatch, err := chunker.WithWholeValues(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(batch.Values(), sinkBatch.(*ghostferry.DataRowBatch).Values())
+
+	this.config.Columns = map[string]map[string][]string{"test_schema": {"other_table": {"data"}}}
+	batch = ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a"), []byte("")},
+	})
+	sinkBatch, err = chunker.WithWholeValues(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(batch, sinkBatch)
+}
+
+func (this *BlobChunkingTestSuite) TestRejectsMissingColumns() {
+	this.config.Columns["test_schema"]["test_table"] = []string{"missing"}
+	_, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().EqualError(err, "column missing of table test_schema.test_table does not exist")
+}
+
+func (this *BlobChunkingTestSuite) TestRejectsOtherColumnTypes() {
+	this.config.Columns["test_schema"]["test_table"] = []string{"name"}
+	_, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().EqualError(err, "column name of table test_schema.test_table is not a BLOB or TEXT column")
+}
+
+func (this *BlobChunkingTestSuite) TestRejectsTablesWithoutPaginationKey() {
+	this.table.PaginationKey = nil
+	_, err := ghostferry.NewBlobChunker(this.config, nil, this.tables, nil)
+	this.Require().EqualError(err, "table test_schema.test_table has no pagination key, its columns cannot be transferred in chunks")
+}
+
+func TestBlobChunking(t *testing.T) {
+	suite.Run(t, new(BlobChunkingTestSuite))
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type clickHouseRequest struct {
+	query string
+	rows  []map[string]interface{}
+}
+
+type ClickHouseSinkTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	requests []clickHouseRequest
+	table    *ghostferry.TableSchema
+	sink     *ghostferry.ClickHouseSink
+}
+
+func (this *ClickHouseSinkTestSuite) SetupTest() {
+	this.requests = nil
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		this.Require().Nil(err)
+
+		request := clickHouseRequest{query: r.URL.Query().Get("query")}
+		scanner := bufio.NewScanner(strings.NewReader(string(body)))
+		for scanner.Scan() {
+			var row map[string]interface{}
+			this.Require().Nil(json.Unmarshal(scanner.Bytes(), &row))
+			request.rows = append(request.rows, row)
+		}
+		this.requests = append(this.requests, request)
+	}))
+
+	columns := []schema.TableColumn{{Name: "id"}, {Name: "data"}}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{Schema: "gftest", Name: "table1", Columns: columns, PKColumns: []int{0}},
+	}
+
+	config := &ghostferry.ClickHouseSinkConfig{Address: this.server.URL}
+	this.Require().Nil(config.Validate())
+	this.sink = ghostferry.NewClickHouseSink(config, map[string]string{"gftest": "analytics"}, nil, logrus.WithField("tag", "test"))
+}
+
+func (this *ClickHouseSinkTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *ClickHouseSinkTestSuite) TestWriteRowBatch() {
+	batch := ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a")},
+		{int64(2), []byte("b")},
+	})
+	this.Require().Nil(this.sink.WriteRowBatch(batch))
+
+	this.Require().Equal(1, len(this.requests))
+	this.Require().Equal("INSERT INTO `analytics`.`table1` FORMAT JSONEachRow", this.requests[0].query)
+
+	rows := this.requests[0].rows
+	this.Require().Equal(2, len(rows))
+	this.Require().Equal("a", rows[0]["data"])
+	this.Require().Equal(0.0, rows[0]["_is_deleted"])
+	this.Require().True(rows[1]["_version"].(float64) > rows[0]["_version"].(float64))
+}
+
+func (this *ClickHouseSinkTestSuite) TestWriteBinlogEvents() {
+	tableMapEvent := &replication.TableMapEvent{Schema: []byte("gftest"), Table: []byte("table1")}
+
+	updates, err := ghostferry.NewBinlogUpdateEvents(this.table, &replication.RowsEvent{
+		Table: tableMapEvent,
+		Rows: [][]interface{}{
+			{int64(1), []byte("a")}, {int64(1), []byte("b")},
+			{int64(2), []byte("c")}, {int64(3), []byte("c")},
+		},
+	}, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	deletes, err := ghostferry.NewBinlogDeleteEvents(this.table, &replication.RowsEvent{
+		Table: tableMapEvent,
+		Rows:  [][]interface{}{{int64(4), []byte("d")}},
+	}, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	var events []ghostferry.DXLEventWrapper
+	for _, ev := range append(updates, deletes...) {
+		events = append(events, ghostferry.DXLEventWrapper{DXLEvent: ev})
+	}
+	this.Require().Nil(this.sink.WriteBinlogEvents(events))
+
+	this.Require().Equal(1, len(this.requests))
+	rows := this.requests[0].rows
+	this.Require().Equal(4, len(rows))
+
+	// the update of row 1 replaces it, the update of the primary key of row
+	// 2 deletes it and inserts row 3
+	this.Require().Equal([]interface{}{1.0, "b", 0.0}, []interface{}{rows[0]["id"], rows[0]["data"], rows[0]["_is_deleted"]})
+	this.Require().Equal([]interface{}{2.0, "c", 1.0}, []interface{}{rows[1]["id"], rows[1]["data"], rows[1]["_is_deleted"]})
+	this.Require().Equal([]interface{}{3.0, "c", 0.0}, []interface{}{rows[2]["id"], rows[2]["data"], rows[2]["_is_deleted"]})
+	this.Require().Equal([]interface{}{4.0, "d", 1.0}, []interface{}{rows[3]["id"], rows[3]["data"], rows[3]["_is_deleted"]})
+}
+
+func (this *ClickHouseSinkTestSuite) TestFailedRequest() {
+	this.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table analytics.table1 doesn't exist", http.StatusNotFound)
+	})
+
+	err := this.sink.WriteRowBatch(ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{{int64(1), []byte("a")}}))
+	this.Require().EqualError(err, "ClickHouse query \"INSERT INTO `analytics`.`table1` FORMAT JSONEachRow\" failed with status 404: Code: 60. DB::Exception: Table analytics.table1 doesn't exist")
+}
+
+func TestClickHouseSink(t *testing.T) {
+	suite.Run(t, new(ClickHouseSinkTestSuite))
+}
@@ -1,8 +1,11 @@
 package test
 
 import (
+	"crypto/tls"
+	"math"
 	"testing"
 
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/Shopify/ghostferry"
@@ -90,7 +93,20 @@ func (this *ConfigTestSuite) TestRequireSQLmode() {
 		"sql_mode": "'NO_BACKSLASH_ESCAPES'",
 	}
 	err := this.config.ValidateConfig()
-	this.Require().EqualError(err, "target: sql_mode must be set to 'STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES'")
+	this.Require().EqualError(err, "target: sql_mode must be set to 'STRICT_ALL_TABLES,NO_AUTO_VALUE_ON_ZERO,NO_BACKSLASH_ESCAPES'")
+}
+
+func (this *ConfigTestSuite) TestPinsSQLMode() {
+	this.config.Target.SQLMode = "strict_all_tables, allow_invalid_dates,NO_BACKSLASH_ESCAPES"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("'STRICT_ALL_TABLES,ALLOW_INVALID_DATES,NO_BACKSLASH_ESCAPES'", mysqlConfig.Params["sql_mode"])
+
+	mysqlConfig, err = this.config.Source.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("'STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES'", mysqlConfig.Params["sql_mode"])
 }
 
 func (this *ConfigTestSuite) TestRequireTargetUser() {
@@ -99,16 +115,39 @@ func (this *ConfigTestSuite) TestRequireTargetUser() {
 	this.Require().EqualError(err, "target: user is empty")
 }
 
+func (this *ConfigTestSuite) TestSocketReplacesHostAndPort() {
+	this.config.Target.Host = ""
+	this.config.Target.Port = 0
+	this.config.Target.Socket = "/var/run/mysqld/mysqld.sock"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("unix", mysqlConfig.Net)
+	this.Require().Equal("/var/run/mysqld/mysqld.sock", mysqlConfig.Addr)
+}
+
+func (this *ConfigTestSuite) TestSocketNotSupportedWithSSHTunnel() {
+	this.config.Source.Socket = "/var/run/mysqld/mysqld.sock"
+	this.config.Source.SSHTunnel = &ghostferry.SSHTunnelConfig{Host: "bastion.example.com"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: Socket cannot be combined with SSHTunnel")
+}
+
 func (this *ConfigTestSuite) TestDefaultValues() {
 	err := this.config.ValidateConfig()
 	this.Require().Nil(err)
 
 	this.Require().Equal(5, this.config.DBWriteRetries)
+	this.Require().Equal(1000, this.config.StmtCacheSize)
 	this.Require().Equal(uint64(200), this.config.DataIterationBatchSize)
 	this.Require().Equal(4, this.config.DataIterationConcurrency)
 	this.Require().Equal(5, this.config.DBReadRetries)
 	this.Require().Equal("0.0.0.0:8000", this.config.ServerBindAddr)
 	this.Require().Equal(".", this.config.WebBasedir)
+	this.Require().Equal(ghostferry.OnlineSchemaChangePolicyIgnore, this.config.OnlineSchemaChangePolicy)
+	this.Require().Equal(ghostferry.PaginationKeyChangePolicyWarn, this.config.PaginationKeyChangePolicy)
+	this.Require().Equal(ghostferry.TargetTriggerPolicyWarn, this.config.TargetTriggerPolicy)
 }
 
 func (this *ConfigTestSuite) TestCorruptCert() {
@@ -133,6 +172,37 @@ func (this *ConfigTestSuite) TestBuildTLSConfiguredAlready() {
 	this.Require().Equal(expectedConfig, actualConfig)
 }
 
+func (this *ConfigTestSuite) TestBuildTLSWithSystemRoots() {
+	this.tls.CertPath = ""
+	this.tls.MinVersion = "1.2"
+	tlsConfig, err := this.tls.BuildConfig()
+	this.Require().Nil(err)
+	this.Require().Nil(tlsConfig.RootCAs)
+	this.Require().Equal("dummy-server", tlsConfig.ServerName)
+	this.Require().Equal(uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+}
+
+func (this *ConfigTestSuite) TestNonExistentClientCertErr() {
+	this.tls.ClientCertPath = "/doesnotexists"
+	this.tls.ClientKeyPath = "/doesnotexists"
+	_, err := this.tls.BuildConfig()
+	this.Require().EqualError(err, "unable to load client certificate: open /doesnotexists: no such file or directory")
+}
+
+func (this *ConfigTestSuite) TestRequireClientCertAndKeyTogether() {
+	this.config.Target.TLS = &this.tls
+	this.config.Target.TLS.ClientCertPath = "/etc/ghostferry/client-cert.pem"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: TLS invalid: ClientCertPath and ClientKeyPath must be specified together")
+}
+
+func (this *ConfigTestSuite) TestInvalidTLSMinVersion() {
+	this.config.Source.TLS = &this.tls
+	this.config.Source.TLS.MinVersion = "TLSv1.2"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: TLS invalid: invalid MinVersion specified (set to TLSv1.2)")
+}
+
 func (this *ConfigTestSuite) TestParamsAndCollationGetsPassedToMysqlConfig() {
 	this.config.Source.Collation = "utf8mb4_general_ci"
 	this.config.Source.Params = map[string]string{
@@ -150,6 +220,676 @@ func (this *ConfigTestSuite) TestParamsAndCollationGetsPassedToMysqlConfig() {
 	this.Require().Equal("'STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES'", mysqlConfig.Params["sql_mode"])
 }
 
+func (this *ConfigTestSuite) TestInvalidQueryTimeout() {
+	this.config.Target.QueryTimeout = "10 parsecs"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "target: invalid QueryTimeout")
+}
+
+func (this *ConfigTestSuite) TestBenchmarkModeIncompatibleWithVerifier() {
+	this.config.BenchmarkMode = true
+	this.config.VerifierType = ghostferry.VerifierTypeInline
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "BenchmarkMode is incompatible with data verification (set to Inline)")
+}
+
+func (this *ConfigTestSuite) TestBenchmarkModeIncompatibleWithResumeStateFromDB() {
+	this.config.BenchmarkMode = true
+	this.config.ResumeStateFromDB = "ghostferry_state"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "BenchmarkMode is incompatible with ResumeStateFromDB")
+}
+
+func (this *ConfigTestSuite) TestForeignWriteGuardDefaults() {
+	this.config.ForeignWriteGuard.Enabled = true
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.ForeignWriteActionWarn, this.config.ForeignWriteGuard.Action)
+	this.Require().Equal("1s", this.config.ForeignWriteGuard.SessionRefreshInterval)
+}
+
+func (this *ConfigTestSuite) TestInvalidForeignWriteGuardAction() {
+	this.config.ForeignWriteGuard.Enabled = true
+	this.config.ForeignWriteGuard.Action = "panic"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ForeignWriteGuard invalid: invalid Action specified (set to panic)")
+}
+
+func (this *ConfigTestSuite) TestLagAlertDefaults() {
+	this.config.LagAlert.WarningLag = "30s"
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("1s", this.config.LagAlert.CheckInterval)
+}
+
+func (this *ConfigTestSuite) TestLagAlertExitRequiresCriticalLag() {
+	this.config.LagAlert.WarningLag = "30s"
+	this.config.LagAlert.ExitOnCritical = true
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "LagAlert invalid: CriticalLagDuration, CriticalCallback and ExitOnCritical require CriticalLag")
+}
+
+func (this *ConfigTestSuite) TestInvalidOnlineSchemaChangePolicy() {
+	this.config.OnlineSchemaChangePolicy = "skip"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid OnlineSchemaChangePolicy specified (set to skip)")
+}
+
+func (this *ConfigTestSuite) TestInvalidLoopPreventionUnknownSessionAction() {
+	this.config.LoopPrevention.IgnoredUser = "ghostferry2"
+	this.config.LoopPrevention.UnknownSessionAction = "ignore"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "LoopPrevention invalid: invalid UnknownSessionAction specified (set to ignore)")
+}
+
+func (this *ConfigTestSuite) TestOnlineSchemaChangePolicyRequiresReplicateSchemaChanges() {
+	this.config.OnlineSchemaChangePolicy = ghostferry.OnlineSchemaChangePolicyFollow
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "OnlineSchemaChangePolicy follow requires ReplicateSchemaChanges")
+
+	this.config.ReplicateSchemaChanges = true
+	this.Require().Nil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestInvalidPaginationKeyChangePolicy() {
+	this.config.PaginationKeyChangePolicy = "follow"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid PaginationKeyChangePolicy specified (set to follow)")
+}
+
+func (this *ConfigTestSuite) TestInvalidTargetTriggerPolicy() {
+	this.config.TargetTriggerPolicy = "disable"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid TargetTriggerPolicy specified (set to disable)")
+}
+
+func (this *ConfigTestSuite) TestDDLDenylistDefaults() {
+	this.config.DDLDenylist.Statements = []string{"drop table", ghostferry.DDLClassTruncate}
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.DDLDenylistActionHalt, this.config.DDLDenylist.Action)
+	this.Require().True(this.config.DDLDenylist.Denies(ghostferry.DDLClassDropTable))
+	this.Require().False(this.config.DDLDenylist.Denies(ghostferry.DDLClassAlterTable))
+}
+
+func (this *ConfigTestSuite) TestInvalidDDLDenylistStatement() {
+	this.config.DDLDenylist.Statements = []string{"DELETE"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DDLDenylist invalid: invalid statement class specified (set to DELETE)")
+}
+
+func (this *ConfigTestSuite) TestAuditLogDefaults() {
+	this.config.AuditLog.Filename = "audit.log"
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(100, this.config.AuditLog.MaxFileSizeMB)
+	this.Require().Equal(5, this.config.AuditLog.MaxFiles)
+	this.Require().Equal("ghostferry_audit_log", this.config.AuditLog.Table)
+}
+
+func (this *ConfigTestSuite) TestInvalidAuditLogMaxFiles() {
+	this.config.AuditLog.Filename = "audit.log"
+	this.config.AuditLog.MaxFiles = -1
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "AuditLog invalid: invalid MaxFiles specified (set to -1)")
+}
+
+func (this *ConfigTestSuite) TestPositionMapDefaults() {
+	this.config.PositionMap.Database = "ghostferry_meta"
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("ghostferry_position_map", this.config.PositionMap.Table)
+	this.Require().Equal("1s", this.config.PositionMap.RecordInterval)
+	this.Require().Equal(10000, this.config.PositionMap.MaxRows)
+}
+
+func (this *ConfigTestSuite) TestInvalidPositionMapMaxRows() {
+	this.config.PositionMap.Database = "ghostferry_meta"
+	this.config.PositionMap.MaxRows = -1
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "PositionMap invalid: invalid MaxRows specified (set to -1)")
+}
+
+func (this *ConfigTestSuite) TestNativeReplicationHandoffDefaultsToSource() {
+	this.config.Source.Pass = "password"
+	this.config.NativeReplicationHandoff.Enabled = true
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("example.com/host", this.config.NativeReplicationHandoff.SourceHost)
+	this.Require().Equal(uint16(3306), this.config.NativeReplicationHandoff.SourcePort)
+	this.Require().Equal("ghostferry", this.config.NativeReplicationHandoff.User)
+	this.Require().Equal("password", this.config.NativeReplicationHandoff.Password)
+}
+
+func (this *ConfigTestSuite) TestNativeReplicationHandoffIncompatibleWithTableRewrites() {
+	this.config.NativeReplicationHandoff.Enabled = true
+	this.config.TableRewrites = map[string]string{"a": "b"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "NativeReplicationHandoff is incompatible with TableRewrites")
+}
+
+func (this *ConfigTestSuite) TestDumpLoadRequiresSingleSource() {
+	this.config.DumpLoad.Directory = "/tmp/dump"
+	this.config.DumpLoad.File = "/tmp/dump.sql"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DumpLoad invalid: Directory and File cannot both be specified")
+}
+
+func (this *ConfigTestSuite) TestDumpLoadIncompatibleWithTableRewrites() {
+	this.config.DumpLoad.File = "/tmp/dump.sql"
+	this.config.TableRewrites = map[string]string{"a": "b"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DumpLoad is incompatible with TableRewrites")
+}
+
+func (this *ConfigTestSuite) TestStartPositionRequiresConfirmation() {
+	this.config.StartPosition.BinlogPosition = &mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "StartPosition invalid: no rows are copied when starting from a position, set ConfirmTargetSeeded to confirm that the target already holds them")
+
+	this.config.StartPosition.ConfirmTargetSeeded = true
+	this.Require().Nil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestStartPositionRejectsInvalidGTIDSet() {
+	this.config.StartPosition.GTIDSet = "not-a-gtid-set"
+	this.config.StartPosition.ConfirmTargetSeeded = true
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "StartPosition invalid: invalid GTIDSet specified")
+}
+
+func (this *ConfigTestSuite) TestStartPositionIncompatibleWithDumpLoad() {
+	this.config.StartPosition.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	this.config.StartPosition.ConfirmTargetSeeded = true
+	this.config.DumpLoad.File = "/tmp/dump.sql"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "StartPosition is incompatible with DumpLoad")
+}
+
+func (this *ConfigTestSuite) TestBlobChunkingDefaultsChunkSize() {
+	this.config.BlobChunking.Columns = map[string]map[string][]string{"db": {"t": {"data"}}}
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(1024*1024), this.config.BlobChunking.ChunkSize)
+}
+
+func (this *ConfigTestSuite) TestBlobChunkingRequiresSourceDBLocking() {
+	this.config.BlobChunking.Columns = map[string]map[string][]string{"db": {"t": {"data"}}}
+	this.config.LockStrategy = ghostferry.LockStrategyInGhostferry
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "BlobChunking requires LockStrategy LockOnSourceDB (set to LockInGhostferry)")
+}
+
+func (this *ConfigTestSuite) TestValidatesConnectionPools() {
+	this.config.Source.ConnectionPool.ConnMaxLifetime = "forever"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: ConnectionPool invalid: invalid ConnMaxLifetime: time: invalid duration \"forever\"")
+}
+
+func (this *ConfigTestSuite) TestValidatesComponentConnectionPools() {
+	this.config.Target.ComponentConnectionPools.BinlogWriter = &ghostferry.ConnectionPoolConfig{MaxOpenConns: -1}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: ComponentConnectionPools invalid: BinlogWriter: MaxOpenConns and MaxIdleConns must not be negative")
+}
+
+func (this *ConfigTestSuite) TestValidatesComponentCredentials() {
+	this.config.Target.ComponentCredentials.BinlogWriter = &ghostferry.CredentialsConfig{User: "ghostferry_ddl", Pass: "secret"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Target.ComponentCredentials.StateTracker = &ghostferry.CredentialsConfig{Pass: "secret"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: ComponentCredentials invalid: StateTracker: user is empty")
+
+	this.config.Target.ComponentCredentials.StateTracker = nil
+	this.config.Target.Platform = ghostferry.PlatformRDS
+	this.config.Target.IAMAuthRegion = "us-east-1"
+	this.config.Target.Pass = ""
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: ComponentCredentials invalid: BinlogWriter: IAMAuthRegion and Pass cannot both be specified")
+
+	this.config.Target.ComponentCredentials.BinlogWriter.Pass = ""
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Target.ComponentCredentials.BinlogStreamer = &ghostferry.CredentialsConfig{User: "ghostferry_repl", Pass: "secret"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Source.ComponentCredentials.BinlogStreamer = &ghostferry.CredentialsConfig{User: "ghostferry_repl", Pass: "secret"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Source.ComponentCredentials.BatchWriter = &ghostferry.CredentialsConfig{User: "ghostferry_copy"}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: ComponentCredentials is only supported for the target, except for the BinlogStreamer")
+}
+
+func (this *ConfigTestSuite) TestSkipTargetBinlogDisablesSqlLogBin() {
+	this.config.SkipTargetBinlog = true
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("0", this.config.Target.Params["sql_log_bin"])
+	this.Require().Empty(this.config.Source.Params["sql_log_bin"])
+
+	this.config.Target.ComponentConnectionPools.BinlogWriter = &ghostferry.ConnectionPoolConfig{
+		SessionVariables: map[string]string{"sql_log_bin": "1"},
+	}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: SkipTargetBinlog cannot be combined with SessionVariables setting sql_log_bin")
+}
+
+func (this *ConfigTestSuite) TestDataIterationIsolationLevelSetsSessionVariable() {
+	this.config.DataIterationIsolationLevel = ghostferry.IsolationLevelReadCommitted
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("'READ-COMMITTED'", this.config.DataIteratorConnectionPool().SessionVariables["transaction_isolation"])
+	this.Require().Equal(ghostferry.RowLockExclusive, this.config.DataIterationRowLock)
+
+	// the validation does not add a pool to the config
+	this.Require().Nil(this.config.Source.ComponentConnectionPools.DataIterator)
+
+	// nor change the session variables of the configured pool
+	pool := &ghostferry.ConnectionPoolConfig{MaxOpenConns: 4, SessionVariables: map[string]string{"innodb_lock_wait_timeout": "5"}}
+	this.config.Source.ComponentConnectionPools.DataIterator = pool
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(map[string]string{"innodb_lock_wait_timeout": "5"}, pool.SessionVariables)
+	this.Require().Equal(4, this.config.DataIteratorConnectionPool().MaxOpenConns)
+	this.Require().Equal(map[string]string{"innodb_lock_wait_timeout": "5", "transaction_isolation": "'READ-COMMITTED'"}, this.config.DataIteratorConnectionPool().SessionVariables)
+
+	pool.SessionVariables["transaction_isolation"] = "'REPEATABLE-READ'"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DataIterationIsolationLevel cannot be combined with SessionVariables setting transaction_isolation")
+	this.config.Source.ComponentConnectionPools.DataIterator = nil
+
+	this.config.DataIterationIsolationLevel = "SERIALIZABLE"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid DataIterationIsolationLevel specified (set to SERIALIZABLE)")
+}
+
+func (this *ConfigTestSuite) TestInvalidDataIterationRowLock() {
+	this.config.DataIterationRowLock = "none"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid DataIterationRowLock specified (set to none)")
+}
+
+func (this *ConfigTestSuite) TestIdleVerificationDefaults() {
+	this.config.VerifierType = ghostferry.VerifierTypeIterative
+	this.config.IterativeVerifierConfig.IdleVerification = &ghostferry.IdleVerificationConfig{}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("1s", this.config.IterativeVerifierConfig.IdleVerification.MaxLag)
+
+	this.config.IterateInDescendingOrder = true
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "IdleVerification is not supported with IterateInDescendingOrder")
+}
+
+func (this *ConfigTestSuite) TestSamplingVerifierDefaults() {
+	this.config.VerifierType = ghostferry.VerifierTypeSampling
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(float64(1), this.config.SamplingVerifierConfig.SamplePercentage)
+	this.Require().Equal(uint64(1000), this.config.SamplingVerifierConfig.RangeSize)
+	this.Require().Equal(0.95, this.config.SamplingVerifierConfig.ConfidenceLevel)
+
+	this.config.SamplingVerifierConfig.SamplePercentage = 150
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "SamplingVerifierConfig invalid: invalid SamplePercentage specified (set to 150)")
+}
+
+func (this *ConfigTestSuite) TestValidatesSessionVariables() {
+	this.config.Target.ComponentConnectionPools.BatchWriter = &ghostferry.ConnectionPoolConfig{
+		SessionVariables: map[string]string{"sql_log_bin": "0"},
+	}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Target.ComponentConnectionPools.BatchWriter.SessionVariables["time_zone"] = "'+01:00'"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: ComponentConnectionPools invalid: BatchWriter: invalid SessionVariables: time_zone cannot be set")
+}
+
+func (this *ConfigTestSuite) TestServerIdRangeDefaults() {
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(uint32(1), this.config.MyServerIdMin)
+	this.Require().Equal(uint32(math.MaxUint32), this.config.MyServerIdMax)
+}
+
+func (this *ConfigTestSuite) TestInvalidServerIdRange() {
+	this.config.MyServerIdMin = 2000
+	this.config.MyServerIdMax = 1000
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "MyServerIdMin (2000) must not be greater than MyServerIdMax (1000)")
+}
+
+func (this *ConfigTestSuite) TestPlatformDefaults() {
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.PlatformMySQL, this.config.Source.Platform)
+	this.Require().False(this.config.Source.IsRDS())
+}
+
+func (this *ConfigTestSuite) TestInvalidPlatform() {
+	this.config.Target.Platform = "azure"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: invalid Platform specified (set to azure)")
+}
+
+func (this *ConfigTestSuite) TestRDSDefaultsToTLS() {
+	this.config.Target.Platform = ghostferry.PlatformAurora
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("true", mysqlConfig.TLSConfig)
+}
+
+func (this *ConfigTestSuite) TestIAMAuthRequiresRDS() {
+	this.config.Target.IAMAuthRegion = "us-east-1"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: IAMAuthRegion is only supported for the rds and aurora platforms")
+}
+
+func (this *ConfigTestSuite) TestIAMAuthForSourceRequiresBinlogStreamer() {
+	this.config.Source.Platform = ghostferry.PlatformRDS
+	this.config.Source.IAMAuthRegion = "us-east-1"
+	this.config.Source.Pass = ""
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: IAMAuthRegion requires ComponentCredentials.BinlogStreamer, as binlog streaming requires password authentication")
+
+	this.config.Source.ComponentCredentials.BinlogStreamer = &ghostferry.CredentialsConfig{User: "ghostferry_repl", Pass: "secret"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.NativeReplicationHandoff = ghostferry.NativeReplicationHandoffConfig{}
+	this.Require().Nil(this.config.NativeReplicationHandoff.Validate(this.config.Source))
+	this.Require().Equal("ghostferry_repl", this.config.NativeReplicationHandoff.User)
+	this.Require().Equal("secret", this.config.NativeReplicationHandoff.Password)
+}
+
+func (this *ConfigTestSuite) TestIAMAuthForTargetWithForeignWriteGuardRequiresBinlogStreamer() {
+	this.config.Target.Platform = ghostferry.PlatformRDS
+	this.config.Target.IAMAuthRegion = "us-east-1"
+	this.config.Target.Pass = ""
+	this.config.ForeignWriteGuard.Enabled = true
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ForeignWriteGuard requires Target.ComponentCredentials.BinlogStreamer with IAMAuthRegion, as binlog streaming requires password authentication")
+
+	this.config.Target.ComponentCredentials.BinlogStreamer = &ghostferry.CredentialsConfig{User: "ghostferry_repl", Pass: "secret"}
+	this.Require().Nil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestIAMAuthAllowsCleartextPasswords() {
+	this.config.Target.Platform = ghostferry.PlatformRDS
+	this.config.Target.IAMAuthRegion = "us-east-1"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().True(mysqlConfig.AllowCleartextPasswords)
+}
+
+func (this *ConfigTestSuite) TestDefaultsConnectionAttributes() {
+	this.config.Target.ConnectionAttributes = map[string]string{"run_id": "42"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("program_name:ghostferry,run_id:42", mysqlConfig.ConnectionAttributes)
+}
+
+func (this *ConfigTestSuite) TestRejectsInvalidConnectionAttributes() {
+	this.config.Source.ConnectionAttributes = map[string]string{"run_id": "a,b"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: invalid ConnectionAttributes: run_id:a,b")
+}
+
+func (this *ConfigTestSuite) TestValidatesSSHTunnel() {
+	this.config.Target.SSHTunnel = &ghostferry.SSHTunnelConfig{
+		Host:           "bastion.example.com",
+		User:           "ghostferry",
+		KnownHostsPath: "/etc/ssh/ssh_known_hosts",
+	}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: SSHTunnel invalid: KeyPath is empty")
+
+	this.config.Target.SSHTunnel.KeyPath = "/etc/ghostferry/id_ed25519"
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(uint16(22), this.config.Target.SSHTunnel.Port)
+}
+
+func (this *ConfigTestSuite) TestSSHTunnelNotSupportedWithIAMAuth() {
+	this.config.Target.Platform = ghostferry.PlatformRDS
+	this.config.Target.IAMAuthRegion = "us-east-1"
+	this.config.Target.SSHTunnel = &ghostferry.SSHTunnelConfig{
+		Host:           "bastion.example.com",
+		User:           "ghostferry",
+		KeyPath:        "/etc/ghostferry/id_ed25519",
+		KnownHostsPath: "/etc/ssh/ssh_known_hosts",
+	}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: IAMAuthRegion cannot be combined with SSHTunnel")
+}
+
+func (this *ConfigTestSuite) TestConsistentSnapshotIncompatibleWithDelayedDataIteration() {
+	this.config.ConsistentSnapshot = true
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.DelayDataIterationUntilBinlogWriterShutdown = true
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ConsistentSnapshot is incompatible with DelayDataIterationUntilBinlogWriterShutdown")
+}
+
+func (this *ConfigTestSuite) TestConsistentSnapshotIncompatibleWithDumpLoad() {
+	this.config.ConsistentSnapshot = true
+	this.config.DumpLoad.File = "/tmp/dump.sql"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ConsistentSnapshot is incompatible with DumpLoad")
+}
+
+func (this *ConfigTestSuite) TestConsistentSnapshotLock() {
+	this.config.ConsistentSnapshot = true
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ghostferry.SnapshotLockFlushTables, this.config.ConsistentSnapshotLock)
+
+	this.config.ConsistentSnapshotLock = ghostferry.SnapshotLockBackup
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.ConsistentSnapshotLock = "global"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid ConsistentSnapshotLock specified (set to global)")
+}
+
+func (this *ConfigTestSuite) TestValidatesTableDiscovery() {
+	this.config.TableDiscovery.Interval = "1m"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.TableDiscovery.Interval = "0s"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "TableDiscovery invalid: invalid Interval specified (set to 0s)")
+
+	this.config.TableDiscovery.Interval = "1m"
+	this.config.ConsistentSnapshot = true
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "TableDiscovery is incompatible with ConsistentSnapshot")
+}
+
+func (this *ConfigTestSuite) TestDefaultsSchemaDriftActionToWarn() {
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ghostferry.SchemaDriftActionWarn, this.config.SchemaDriftAction)
+
+	this.config.SchemaDriftAction = "abort"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid SchemaDriftAction specified (set to abort)")
+}
+
+func (this *ConfigTestSuite) TestValidatesDistributedCopy() {
+	this.config.DistributedCopy.Role = ghostferry.DistributedCopyRoleWorker
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy requires ResumeStateFromDB")
+
+	this.config.ResumeStateFromDB = "gftest_state"
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().NotEqual("", this.config.DistributedCopy.WorkerId)
+	this.Require().Equal("1m", this.config.DistributedCopy.LeaseDuration)
+
+	this.config.DistributedCopy.HeartbeatInterval = "1m"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy invalid: invalid HeartbeatInterval specified (set to 1m), must be shorter than the LeaseDuration")
+
+	this.config.DistributedCopy.HeartbeatInterval = "10s"
+	this.config.RunLock.Enabled = true
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "RunLock cannot be enabled on the workers of a DistributedCopy")
+
+	this.config.DistributedCopy.Role = ghostferry.DistributedCopyRoleCoordinator
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.TableDiscovery.Interval = "1m"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy is incompatible with ConsistentSnapshot, DelayDataIterationUntilBinlogWriterShutdown and TableDiscovery")
+
+	this.config.TableDiscovery.Interval = ""
+	this.config.LockStrategy = ghostferry.LockStrategyInGhostferry
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy is incompatible with LockStrategy LockInGhostferry, VerifierType Inline and ReplicateSchemaChanges")
+
+	this.config.LockStrategy = ghostferry.LockStrategySourceDB
+	this.config.VerifierType = ghostferry.VerifierTypeInline
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy is incompatible with LockStrategy LockInGhostferry, VerifierType Inline and ReplicateSchemaChanges")
+
+	this.config.VerifierType = ""
+	this.config.ReplicateSchemaChanges = true
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy is incompatible with LockStrategy LockInGhostferry, VerifierType Inline and ReplicateSchemaChanges")
+
+	this.config.ReplicateSchemaChanges = false
+	this.config.DistributedCopy.Role = "leader"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DistributedCopy invalid: invalid Role specified (set to leader)")
+}
+
+func (this *ConfigTestSuite) TestValidatesKeyRangeSplit() {
+	this.config.KeyRangeSplit.Ranges = 1
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "KeyRangeSplit invalid: invalid Ranges specified (set to 1), must be at least 2")
+
+	this.config.KeyRangeSplit.Ranges = 8
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(uint64(1000000), this.config.KeyRangeSplit.MinKeySpan)
+
+	this.config.KeyRangeSplit.MinKeySpan = 4
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "KeyRangeSplit invalid: invalid MinKeySpan specified (set to 4), must be at least the number of Ranges")
+
+	this.config.KeyRangeSplit.MinKeySpan = 0
+	this.config.IterateInDescendingOrder = true
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "KeyRangeSplit is incompatible with IterateInDescendingOrder and DistributedCopy")
+}
+
+func (this *ConfigTestSuite) TestValidatesReadOnlySource() {
+	this.config.ReadOnlySource = true
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReadOnlySource requires LockStrategy LockInGhostferry or None, and is incompatible with ConsistentSnapshot")
+
+	this.config.LockStrategy = ghostferry.LockStrategyInGhostferry
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.ConsistentSnapshot = true
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReadOnlySource requires LockStrategy LockInGhostferry or None, and is incompatible with ConsistentSnapshot")
+}
+
+func (this *ConfigTestSuite) TestSetsTimeZoneParam() {
+	this.config.Source.TimeZone = "Europe/Berlin"
+	this.config.Target.TimeZone = "Europe/Berlin"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("'Europe/Berlin'", mysqlConfig.Params["time_zone"])
+}
+
+func (this *ConfigTestSuite) TestRejectsDifferentTimeZones() {
+	this.config.Target.TimeZone = "+02:00"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Source and Target must use the same TimeZone, TIMESTAMP values would change otherwise (set to +00:00 and +02:00)")
+}
+
+func (this *ConfigTestSuite) TestRejectsSystemTimeZone() {
+	this.config.Source.TimeZone = "SYSTEM"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "source: invalid TimeZone: SYSTEM is not supported")
+}
+
+func (this *ConfigTestSuite) TestDateTimeConversionRequiresTimeZones() {
+	this.config.DateTimeConversion.Columns = map[string]map[string][]string{"gftest": {"table1": {"created_at"}}}
+	this.config.DateTimeConversion.FromTimeZone = "+02:00"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DateTimeConversion invalid: FromTimeZone and ToTimeZone must be specified")
+
+	this.config.DateTimeConversion.ToTimeZone = "America/New_York"
+	this.Require().Nil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestErrorPolicyRejectsUnsupportedActions() {
+	this.config.ErrorPolicy.Components = map[string]string{"binlog_streamer": ghostferry.ErrorActionSkipTable}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ErrorPolicy invalid: unsupported action skip_table for component binlog_streamer, must be one of fatal, retry")
+
+	this.config.ErrorPolicy.Components = map[string]string{"verifier": ghostferry.ErrorActionRetry}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "ErrorPolicy invalid: unsupported component verifier")
+
+	this.config.ErrorPolicy.Components = map[string]string{"data_iterator": ghostferry.ErrorActionSkipTable}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("5s", this.config.ErrorPolicy.RetryInterval)
+	this.Require().Equal("10m", this.config.ErrorPolicy.ReconnectTimeout)
+}
+
+func (this *ConfigTestSuite) TestErrorPolicyValidatesReconnectTimeout() {
+	this.config.ErrorPolicy.ReconnectTimeout = "forever"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, `ErrorPolicy invalid: invalid ReconnectTimeout specified: time: invalid duration "forever"`)
+}
+
+func (this *ConfigTestSuite) TestTableRecopyRequiresQualifiedTables() {
+	this.config.TableRecopy.Tables = []string{"gftest.table1"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.TableRecopy.Tables = []string{"gftest.table1", "table2"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "TableRecopy invalid: invalid table specified (set to table2), expected schema.table")
+}
+
+func (this *ConfigTestSuite) TestValidatesStreamOnlyTables() {
+	this.config.StreamOnlyTables = []string{"gftest.table1"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.TableRecopy.Tables = []string{"gftest.table1"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "table gftest.table1 cannot be both stream-only and copied again")
+
+	this.config.TableRecopy.Tables = nil
+	this.config.StreamOnlyTables = []string{"table1"}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "invalid StreamOnlyTables table specified (set to table1), expected schema.table")
+}
+
+func (this *ConfigTestSuite) TestInvalidResumeConfigMismatchPolicy() {
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ghostferry.ResumeConfigMismatchPolicyFail, this.config.ResumeConfigMismatchPolicy)
+
+	this.config.ResumeConfigMismatchPolicy = "ignore"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid ResumeConfigMismatchPolicy specified (set to ignore)")
+}
+
+func (this *ConfigTestSuite) TestInvalidUnmatchedDMLPolicy() {
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ghostferry.UnmatchedDMLPolicyIgnore, this.config.UnmatchedDMLPolicy)
+
+	this.config.UnmatchedDMLPolicy = "replace"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Invalid UnmatchedDMLPolicy specified (set to replace)")
+}
+
 func TestConfig(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(ConfigTestSuite))
@@ -0,0 +1,211 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type ConsistentSnapshotTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	di           *ghostferry.DataIterator
+	tables       []*ghostferry.TableSchema
+	snapshot     *ghostferry.ConsistentSnapshot
+	receivedRows map[string][]ghostferry.RowData
+	rowsMutex    *sync.Mutex
+}
+
+func (this *ConsistentSnapshotTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(5)
+
+	tableFilter := &testhelpers.TestTableFilter{
+		DbsFunc:    testhelpers.DbApplicabilityFilter([]string{testhelpers.TestSchemaName}),
+		TablesFunc: nil,
+	}
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, tableFilter, nil, nil, nil)
+	this.Require().Nil(err)
+	this.tables = tables.AsSlice()
+
+	config := this.Ferry.Config
+	this.di = &ghostferry.DataIterator{
+		DB:          this.Ferry.SourceDB,
+		Concurrency: config.DataIterationConcurrency,
+
+		ErrorHandler: this.Ferry.ErrorHandler,
+		CursorConfig: &ghostferry.CursorConfig{
+			DB:          this.Ferry.SourceDB,
+			Throttler:   this.Ferry.MigrationThrottler,
+			BatchSize:   2,
+			ReadRetries: config.DBReadRetries,
+		},
+		StateTracker: ghostferry.NewStateTracker(config.DataIterationConcurrency * 10),
+	}
+
+	this.receivedRows = make(map[string][]ghostferry.RowData)
+	this.rowsMutex = &sync.Mutex{}
+	this.di.AddBatchListener(func(b ghostferry.RowBatch) error {
+		this.rowsMutex.Lock()
+		defer this.rowsMutex.Unlock()
+
+		if batch, ok := b.(ghostferry.InsertRowBatch); ok {
+			this.receivedRows[batch.TableSchema().Name] = append(this.receivedRows[batch.TableSchema().Name], batch.Values()...)
+		}
+		if b.IsTableComplete() {
+			this.di.StateTracker.MarkTableAsCompleted(b.TableSchema().String())
+		}
+		return nil
+	})
+}
+
+func (this *ConsistentSnapshotTestSuite) TearDownTest() {
+	if this.snapshot != nil {
+		this.snapshot.Close()
+		this.snapshot = nil
+	}
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *ConsistentSnapshotTestSuite) takeSnapshot(count int) {
+	var err error
+	this.snapshot, err = ghostferry.TakeConsistentSnapshot(this.Ferry.SourceDB, count, nil)
+	this.Require().Nil(err)
+	this.di.CursorConfig.Snapshot = this.snapshot
+}
+
+func (this *ConsistentSnapshotTestSuite) TestTakesTheSnapshotAtTheCurrentPosition() {
+	before, err := ghostferry.ShowMasterStatusBinlogPosition(this.Ferry.SourceDB)
+	this.Require().Nil(err)
+
+	this.takeSnapshot(this.di.Concurrency + 1)
+	this.Require().Equal(before, this.snapshot.Position)
+
+	this.writeToSource()
+
+	after, err := ghostferry.ShowMasterStatusBinlogPosition(this.Ferry.SourceDB)
+	this.Require().Nil(err)
+	this.Require().Equal(-1, this.snapshot.Position.Compare(after))
+}
+
+func (this *ConsistentSnapshotTestSuite) TestRowsAreIteratedFromTheSnapshot() {
+	this.takeSnapshot(this.di.Concurrency + 1)
+	this.writeToSource()
+
+	this.di.Run(this.tables)
+
+	for _, table := range []string{testhelpers.TestTable1Name, testhelpers.TestCompressedTable1Name} {
+		rows := this.receivedRows[table]
+		this.Require().Equal(5, len(rows))
+		for idx, row := range rows {
+			this.Require().Equal(int64(idx+1), row[0].(int64))
+			this.Require().NotEqual("updated", string(row[1].([]byte)))
+		}
+	}
+	for _, table := range this.tables {
+		this.Require().True(this.di.StateTracker.IsTableComplete(table.String()))
+	}
+}
+
+func (this *ConsistentSnapshotTestSuite) TestRowsOfTheSnapshotAreNotLocked() {
+	this.takeSnapshot(this.di.Concurrency + 1)
+
+	// the copy would wait for the row lock of the open transaction if it
+	// locked the rows it reads
+	tx, err := this.Ferry.SourceDB.Begin()
+	this.Require().Nil(err)
+	defer tx.Rollback()
+	_, err = tx.Exec(fmt.Sprintf("UPDATE `%s`.`%s` SET data = 'updated' WHERE id = 1", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		this.di.Run(this.tables)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		this.FailNow("the copy waited for the locked row")
+	}
+	this.Require().Equal(5, len(this.receivedRows[testhelpers.TestTable1Name]))
+}
+
+func (this *ConsistentSnapshotTestSuite) TestAcquireWaitsForAnIdleTransaction() {
+	this.takeSnapshot(1)
+
+	tx := this.snapshot.Acquire()
+
+	acquired := make(chan ghostferry.SqlPreparerAndRollbacker)
+	go func() {
+		acquired <- this.snapshot.Acquire()
+	}()
+
+	select {
+	case <-acquired:
+		this.Fail("acquired a transaction of the snapshot in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// rolling back hands the transaction back, and keeps reading from the
+	// snapshot
+	this.Require().Nil(tx.Rollback())
+	tx = <-acquired
+	defer tx.Rollback()
+
+	this.writeToSource()
+
+	var count int
+	rows, err := tx.Query(fmt.Sprintf("SELECT COUNT(*) FROM `%s`.`%s`", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	defer rows.Close()
+	this.Require().True(rows.Next())
+	this.Require().Nil(rows.Scan(&count))
+	this.Require().Equal(5, count)
+}
+
+// writeToSource inserts, updates and deletes rows of the copied tables
+func (this *ConsistentSnapshotTestSuite) writeToSource() {
+	for _, table := range []string{testhelpers.TestTable1Name, testhelpers.TestCompressedTable1Name} {
+		for _, query := range []string{
+			"INSERT INTO `%s`.`%s` (id, data) VALUES (6, 'inserted')",
+			"UPDATE `%s`.`%s` SET data = 'updated' WHERE id = 2",
+			"DELETE FROM `%s`.`%s` WHERE id = 3",
+		} {
+			_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf(query, testhelpers.TestSchemaName, table))
+			this.Require().Nil(err)
+		}
+	}
+}
+
+func TestConsistentSnapshot(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &ConsistentSnapshotTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
+
+func TestCopyDataFromConsistentSnapshotWithMixedLoad(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.ConsistentSnapshot = true
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupSingleTableDatabase,
+		DataWriter: &testhelpers.MixedActionDataWriter{
+			ProbabilityOfInsert: 1.0 / 3.0,
+			ProbabilityOfUpdate: 1.0 / 3.0,
+			ProbabilityOfDelete: 1.0 / 3.0,
+			NumberOfWriters:     2,
+			Tables:              []string{"gftest.table1"},
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
@@ -1 +1,126 @@
 package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type ControlServerTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	controlServer *ghostferry.ControlServer
+	server        *httptest.Server
+	streamDone    chan struct{}
+}
+
+func (this *ControlServerTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+
+	this.controlServer = &ghostferry.ControlServer{F: this.Ferry}
+	this.streamDone = make(chan struct{}, 1)
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		this.controlServer.HandleProgressStream(w, r)
+		select {
+		case this.streamDone <- struct{}{}:
+		default:
+		}
+	}))
+}
+
+func (this *ControlServerTestSuite) TearDownTest() {
+	if this.server != nil {
+		this.server.Close()
+	}
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *ControlServerTestSuite) TestStreamsTheProgress() {
+	resp, events := this.stream("?interval=10")
+	defer resp.Body.Close()
+
+	this.Require().Equal(http.StatusOK, resp.StatusCode)
+	this.Require().Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	this.Require().Equal("no-cache", resp.Header.Get("Cache-Control"))
+
+	progress := this.nextProgress(events)
+	this.Require().Equal(this.Ferry.OverallState, progress.CurrentState)
+	this.Require().False(progress.Throttled)
+}
+
+func (this *ControlServerTestSuite) TestStreamsTheChangedProgress() {
+	resp, events := this.stream("?interval=10")
+	defer resp.Body.Close()
+	this.Require().False(this.nextProgress(events).Throttled)
+
+	this.Ferry.MigrationThrottler.SetPaused(true)
+	defer this.Ferry.MigrationThrottler.SetPaused(false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if this.nextProgress(events).Throttled {
+			return
+		}
+	}
+	this.Fail("the changed progress was not streamed")
+}
+
+func (this *ControlServerTestSuite) TestStopsStreamingOnceTheClientIsGone() {
+	resp, events := this.stream("?interval=10")
+	this.nextProgress(events)
+	resp.Body.Close()
+
+	select {
+	case <-this.streamDone:
+	case <-time.After(5 * time.Second):
+		this.Fail("the stream did not stop once the client was gone")
+	}
+}
+
+func (this *ControlServerTestSuite) TestRejectsInvalidIntervals() {
+	for _, interval := range []string{"0", "-10", "1s"} {
+		resp, err := http.Get(this.server.URL + "?interval=" + interval)
+		this.Require().Nil(err)
+		resp.Body.Close()
+		this.Require().Equal(http.StatusBadRequest, resp.StatusCode, interval)
+	}
+}
+
+func (this *ControlServerTestSuite) stream(query string) (*http.Response, *bufio.Reader) {
+	resp, err := http.Get(this.server.URL + query)
+	this.Require().Nil(err)
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// nextProgress reads the next progress event of the stream
+func (this *ControlServerTestSuite) nextProgress(events *bufio.Reader) *ghostferry.Progress {
+	line, err := events.ReadString('\n')
+	this.Require().Nil(err)
+	this.Require().Equal("event: progress\n", line)
+
+	line, err = events.ReadString('\n')
+	this.Require().Nil(err)
+	this.Require().True(strings.HasPrefix(line, "data: "))
+
+	progress := &ghostferry.Progress{}
+	this.Require().Nil(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), progress))
+
+	// events are terminated by an empty line
+	line, err = events.ReadString('\n')
+	this.Require().Nil(err)
+	this.Require().Equal("\n", line)
+	return progress
+}
+
+func TestControlServer(t *testing.T) {
+	suite.Run(t, &ControlServerTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
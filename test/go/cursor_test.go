@@ -61,6 +61,16 @@ func (this *SimplePaginationKeyTestSuite) TestDefaultBuildSelectDescending() {
 	this.Require().Equal(len(args), 0)
 }
 
+func (this *SimplePaginationKeyTestSuite) TestDefaultBuildSelectWithForcedIndex() {
+	this.table.ForcedIndex = "PRIMARY"
+	builder, err := ghostferry.DefaultBuildSelect(this.columnsToSelect, this.table, nil, 5, false)
+	this.Require().Nil(err)
+	sql, args, err := builder.ToSql()
+	this.Require().Nil(err)
+	this.Require().Equal(sql, "SELECT * FROM `test_schema`.`test_table` FORCE INDEX (`PRIMARY`) ORDER BY `col1` LIMIT 5")
+	this.Require().Equal(len(args), 0)
+}
+
 func (this *SimplePaginationKeyTestSuite) TestDefaultBuildSelectWithResumeData() {
 	lastPaginationKeyData, err := ghostferry.NewPaginationKeyDataFromRow(this.rows[0], this.table.PaginationKey)
 	this.Require().Nil(err)
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type RecentErrorsTestSuite struct {
+	suite.Suite
+
+	recentErrors *ghostferry.RecentErrors
+	logger       *logrus.Entry
+}
+
+func (this *RecentErrorsTestSuite) SetupTest() {
+	this.recentErrors = ghostferry.NewRecentErrors(2)
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(this.recentErrors)
+	this.logger = logger.WithField("tag", "batch_writer")
+}
+
+func (this *RecentErrorsTestSuite) TestKeepsMostRecentErrorsAndWarnings() {
+	this.logger.Info("not kept")
+	this.logger.WithError(errors.New("deadlock")).Error("failed to write batch")
+	this.logger.Warn("retrying")
+	this.logger.Error("gave up")
+
+	recentErrors := this.recentErrors.Errors()
+	this.Require().Equal(2, len(recentErrors))
+
+	this.Require().Equal("warning", recentErrors[0].Level)
+	this.Require().Equal("retrying", recentErrors[0].Message)
+	this.Require().Equal("batch_writer", recentErrors[0].Tag)
+
+	this.Require().Equal("error", recentErrors[1].Level)
+	this.Require().Equal("gave up", recentErrors[1].Message)
+}
+
+func (this *RecentErrorsTestSuite) TestKeepsErrorOfEntry() {
+	this.logger.WithError(errors.New("deadlock")).Error("failed to write batch")
+
+	recentErrors := this.recentErrors.Errors()
+	this.Require().Equal(1, len(recentErrors))
+	this.Require().Equal("deadlock", recentErrors[0].Error)
+}
+
+func TestRecentErrors(t *testing.T) {
+	suite.Run(t, new(RecentErrorsTestSuite))
+}
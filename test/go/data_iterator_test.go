@@ -1,6 +1,7 @@
 package test
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -163,6 +164,40 @@ func (this *DataIteratorTestSuite) TestExistingRowsAreIterated() {
 	)
 }
 
+func (this *DataIteratorTestSuite) TestBatchesAreStreamedWithBatchMaxBytes() {
+	this.di.CursorConfig.BatchMaxBytes = 1
+
+	batchSizes := make([]int, 0)
+	batchSizesMutex := &sync.Mutex{}
+	this.di.AddBatchListener(func(b ghostferry.RowBatch) error {
+		if _, ok := b.(ghostferry.InsertRowBatch); ok && b.Size() > 0 {
+			batchSizesMutex.Lock()
+			defer batchSizesMutex.Unlock()
+			batchSizes = append(batchSizes, b.Size())
+		}
+		return nil
+	})
+
+	this.di.Run(this.tables)
+
+	this.Require().Equal(5, len(this.receivedRows[testhelpers.TestTable1Name]))
+	this.Require().Equal(5, len(this.receivedRows[testhelpers.TestCompressedTable1Name]))
+
+	// every row exceeds the limit, and is passed on in its own batch
+	this.Require().Equal(10, len(batchSizes))
+	for _, size := range batchSizes {
+		this.Require().Equal(1, size)
+	}
+
+	for _, rows := range this.receivedRows {
+		for idx, row := range rows {
+			this.Require().Equal(int64(idx+1), row[0].(int64))
+		}
+	}
+
+	this.Require().Equal(2, len(this.completedTables()))
+}
+
 func (this *DataIteratorTestSuite) TestDoneListenerGetsNotifiedWhenDone() {
 	wasNotified := false
 
@@ -176,6 +211,53 @@ func (this *DataIteratorTestSuite) TestDoneListenerGetsNotifiedWhenDone() {
 	this.Require().True(wasNotified)
 }
 
+func (this *DataIteratorTestSuite) TestFailedTablesAreQuarantinedWithErrorPolicy() {
+	this.di.ErrorPolicy = &ghostferry.ErrorPolicyConfig{
+		Components: map[string]string{"data_iterator": ghostferry.ErrorActionSkipTable},
+	}
+
+	this.di.AddBatchListener(func(b ghostferry.RowBatch) error {
+		if b.TableSchema().Name == testhelpers.TestTable1Name {
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	this.di.Run(this.tables)
+
+	quarantinedTables := this.di.Quarantine.Tables()
+	this.Require().Equal(1, len(quarantinedTables))
+	this.Require().EqualError(quarantinedTables[fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)], "test error")
+
+	this.Require().Equal(
+		this.completedTables(),
+		map[string]bool{
+			fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestCompressedTable1Name): true,
+		},
+	)
+}
+
+func (this *DataIteratorTestSuite) TestFailedTablesAreRetriedWithErrorPolicy() {
+	this.di.ErrorPolicy = &ghostferry.ErrorPolicyConfig{
+		Components: map[string]string{"data_iterator": ghostferry.ErrorActionRetry},
+	}
+
+	failures := 0
+	this.di.AddBatchListener(func(b ghostferry.RowBatch) error {
+		if b.TableSchema().Name == testhelpers.TestTable1Name && failures < 2 {
+			failures++
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	this.di.Run(this.tables)
+
+	this.Require().Equal(2, failures)
+	this.Require().Equal(0, len(this.di.Quarantine.Tables()))
+	this.Require().Equal(2, len(this.completedTables()))
+}
+
 func (this *DataIteratorTestSuite) completedTables() map[string]bool {
 	return this.di.StateTracker.Serialize(nil, nil).CompletedTables
 }
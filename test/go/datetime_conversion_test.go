@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type DateTimeConversionTestSuite struct {
+	suite.Suite
+
+	table  *ghostferry.TableSchema
+	tables ghostferry.TableSchemaCache
+	config *ghostferry.DateTimeConversionConfig
+}
+
+func (this *DateTimeConversionTestSuite) SetupTest() {
+	columns := []schema.TableColumn{
+		schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER, RawType: "bigint(20)"},
+		schema.TableColumn{Name: "name", Type: schema.TYPE_STRING, RawType: "varchar(255)"},
+		schema.TableColumn{Name: "created_at", Type: schema.TYPE_DATETIME, RawType: "datetime(6)"},
+	}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{
+			Schema:    "test_schema",
+			Name:      "test_table",
+			Columns:   columns,
+			PKColumns: []int{0},
+		},
+		PaginationKey: &ghostferry.PaginationKey{
+			Columns:       []*schema.TableColumn{&columns[0]},
+			ColumnIndices: []int{0},
+		},
+	}
+	this.tables = ghostferry.TableSchemaCache{"test_schema.test_table": this.table}
+	this.config = &ghostferry.DateTimeConversionConfig{
+		Columns:      map[string]map[string][]string{"test_schema": {"test_table": {"created_at"}}},
+		FromTimeZone: "+02:00",
+		ToTimeZone:   "-03:30",
+	}
+}
+
+func (this *DateTimeConversionTestSuite) TestConvertsValues() {
+	converter, err := ghostferry.NewDateTimeConverter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	batch := ghostferry.NewDataRowBatch(this.table, []ghostferry.RowData{
+		{1, []byte("2020-01-01 12:00:00.123456"), []byte("2020-01-01 01:00:00.123456")},
+		{2, "2020-01-01 12:00:00", "2020-03-01 00:15:00"},
+		{3, nil, nil},
+		{4, nil, []byte("0000-00-00 00:00:00.000000")},
+	})
+	this.Require().Nil(converter.ConvertRowBatch(batch))
+
+	this.Require().Equal([]ghostferry.RowData{
+		{1, []byte("2020-01-01 12:00:00.123456"), []byte("2019-12-31 19:30:00.123456")},
+		{2, "2020-01-01 12:00:00", "2020-02-29 18:45:00"},
+		{3, nil, nil},
+		{4, nil, []byte("0000-00-00 00:00:00.000000")},
+	}, batch.Values())
+}
+
+func (this *DateTimeConversionTestSuite) TestIgnoresConvertedColumnsForVerification() {
+	_, err := ghostferry.NewDateTimeConverter(this.config, this.tables)
+	this.Require().Nil(err)
+
+	this.Require().Contains(this.table.IgnoredColumnsForVerification, "created_at")
+}
+
+func (this *DateTimeConversionTestSuite) TestRejectsOtherColumnTypes() {
+	this.config.Columns["test_schema"]["test_table"] = []string{"name"}
+	_, err := ghostferry.NewDateTimeConverter(this.config, this.tables)
+	this.Require().EqualError(err, "column name of table test_schema.test_table is not a DATETIME column")
+}
+
+func (this *DateTimeConversionTestSuite) TestRejectsMissingColumns() {
+	this.config.Columns["test_schema"]["test_table"] = []string{"missing"}
+	_, err := ghostferry.NewDateTimeConverter(this.config, this.tables)
+	this.Require().EqualError(err, "column missing of table test_schema.test_table does not exist")
+}
+
+func TestDateTimeConversion(t *testing.T) {
+	suite.Run(t, new(DateTimeConversionTestSuite))
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type DDLRewriteTestSuite struct {
+	suite.Suite
+}
+
+func (this *DDLRewriteTestSuite) TestRewriteEngineAndRowFormat() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{
+		Engines:    map[string]string{"MyISAM": "InnoDB", "TokuDB": ""},
+		RowFormats: map[string]string{"compressed": "DYNAMIC"},
+	}, nil)
+
+	this.Require().Equal(
+		"CREATE TABLE `t` (`id` int) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 ROW_FORMAT=DYNAMIC",
+		rewriter.RewriteOptions("CREATE TABLE `t` (`id` int) ENGINE=myisam DEFAULT CHARSET=utf8mb4 ROW_FORMAT=COMPRESSED"),
+	)
+	this.Require().Equal(
+		"ALTER TABLE `t`",
+		rewriter.RewriteOptions("ALTER TABLE `t` ENGINE = TokuDB"),
+	)
+	this.Require().Equal(
+		"CREATE TABLE `t` (`id` int) ENGINE=MEMORY",
+		rewriter.RewriteOptions("CREATE TABLE `t` (`id` int) ENGINE=MEMORY"),
+	)
+}
+
+func (this *DDLRewriteTestSuite) TestRewriteTablespace() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{
+		Tablespaces: map[string]string{"ts1": "innodb_file_per_table"},
+	}, nil)
+
+	this.Require().Equal(
+		"CREATE TABLE `t` (`id` int) TABLESPACE=innodb_file_per_table",
+		rewriter.RewriteOptions("CREATE TABLE `t` (`id` int) TABLESPACE `ts1`"),
+	)
+	this.Require().Equal(
+		"CREATE TABLESPACE `ts1` ADD DATAFILE 'ts1.ibd'",
+		rewriter.RewriteOptions("CREATE TABLESPACE `ts1` ADD DATAFILE 'ts1.ibd'"),
+	)
+}
+
+func (this *DDLRewriteTestSuite) TestStripDefinerAndPartitioning() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{
+		StripDefiners:     true,
+		StripPartitioning: true,
+	}, nil)
+
+	this.Require().Equal(
+		"CREATE VIEW `v` AS SELECT 1",
+		rewriter.RewriteOptions("CREATE DEFINER=`admin`@`%` VIEW `v` AS SELECT 1"),
+	)
+	this.Require().Equal(
+		"CREATE TABLE `t` (`id` int) ENGINE=InnoDB",
+		rewriter.RewriteOptions("CREATE TABLE `t` (`id` int) ENGINE=InnoDB\n/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 4 */"),
+	)
+}
+
+func (this *DDLRewriteTestSuite) TestRewriteDatabaseNames() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{}, map[string]string{"source_db": "target_db"})
+
+	this.Require().Equal(
+		"RENAME TABLE `target_db`.`t1` TO `target_db`.`t2`, other_source_db.t3 TO `target_db`.t3",
+		rewriter.RewriteDatabaseNames("RENAME TABLE `source_db`.`t1` TO `source_db`.`t2`, other_source_db.t3 TO source_db.t3"),
+	)
+}
+
+func (this *DDLRewriteTestSuite) TestRewriteDatabaseNamesInASinglePass() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{}, map[string]string{"db1": "db2", "db2": "db1", "db3": "db1"})
+
+	this.Require().Equal(
+		"RENAME TABLE `db2`.t1 TO `db1`.t1, `db1` . `t2` TO `db2`.t2",
+		rewriter.RewriteDatabaseNames("RENAME TABLE db1.t1 TO `db2`.t1, db3 . `t2` TO db1.t2"),
+	)
+}
+
+func (this *DDLRewriteTestSuite) TestAsSQLStringUsesTargetDatabase() {
+	rewriter := ghostferry.NewDDLRewriter(ghostferry.DDLRewriteConfig{
+		Engines: map[string]string{"MyISAM": "InnoDB"},
+	}, map[string]string{"source_db": "target_db"})
+
+	affectedTable := ghostferry.NewQualifiedTableName("source_db", "t")
+	event, err := ghostferry.NewBinlogDDLEvent("ALTER TABLE `source_db`.`t` ENGINE=MyISAM", &affectedTable, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	q, err := rewriter.AsSQLString(event, "target_db", "t")
+	this.Require().Nil(err)
+	this.Require().Equal("USE `target_db`;\nALTER TABLE `target_db`.`t` ENGINE=InnoDB", q)
+
+	_, err = rewriter.AsSQLString(event, "target_db", "other_table")
+	this.Require().NotNil(err)
+}
+
+func TestDDLRewrite(t *testing.T) {
+	suite.Run(t, new(DDLRewriteTestSuite))
+}
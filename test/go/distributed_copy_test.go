@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type TableLeasesTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	worker1 *ghostferry.TableLeases
+	worker2 *ghostferry.TableLeases
+}
+
+func (this *TableLeasesTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedTargetDB(0)
+
+	table := "gftest._ghostferry_table_leases"
+	logger := logrus.WithField("tag", "test")
+	this.worker1 = ghostferry.NewTableLeases(this.Ferry.TargetDB, table, "worker1", time.Minute, logger)
+	this.worker2 = ghostferry.NewTableLeases(this.Ferry.TargetDB, table, "worker2", time.Minute, logger)
+
+	exists, err := this.worker1.Exists()
+	this.Require().Nil(err)
+	this.Require().False(exists)
+
+	this.Require().Nil(this.worker1.Initialize())
+	this.Require().Nil(this.worker2.Initialize())
+
+	exists, err = this.worker2.Exists()
+	this.Require().Nil(err)
+	this.Require().True(exists)
+}
+
+func (this *TableLeasesTestSuite) TestTablesAreLeasedToOneWorker() {
+	acquired, err := this.worker1.Acquire("gftest.table1")
+	this.Require().Nil(err)
+	this.Require().True(acquired)
+	this.Require().True(this.worker1.IsHeld("gftest.table1"))
+
+	acquired, err = this.worker2.Acquire("gftest.table1")
+	this.Require().Nil(err)
+	this.Require().False(acquired)
+	this.Require().False(this.worker2.IsHeld("gftest.table1"))
+
+	acquired, err = this.worker2.Acquire("gftest.table2")
+	this.Require().Nil(err)
+	this.Require().True(acquired)
+
+	this.Require().Nil(this.worker1.Heartbeat())
+	this.Require().Nil(this.worker2.Heartbeat())
+
+	this.Require().Nil(this.worker1.Release("gftest.table1"))
+	this.Require().False(this.worker1.IsHeld("gftest.table1"))
+
+	acquired, err = this.worker2.Acquire("gftest.table1")
+	this.Require().Nil(err)
+	this.Require().True(acquired)
+}
+
+func (this *TableLeasesTestSuite) TestExpiredLeasesAreTakenOver() {
+	this.worker1.LeaseDuration = 100 * time.Millisecond
+
+	acquired, err := this.worker1.Acquire("gftest.table1")
+	this.Require().Nil(err)
+	this.Require().True(acquired)
+
+	time.Sleep(200 * time.Millisecond)
+
+	acquired, err = this.worker2.Acquire("gftest.table1")
+	this.Require().Nil(err)
+	this.Require().True(acquired)
+
+	err = this.worker1.Heartbeat()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "lost the lease of 1 of the tables gftest.table1")
+}
+
+func TestTableLeases(t *testing.T) {
+	suite.Run(t, &TableLeasesTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type DumpLoadTestSuite struct {
+	suite.Suite
+}
+
+func (this *DumpLoadTestSuite) readStatements(dump string) []string {
+	reader := ghostferry.NewDumpStatementReader(strings.NewReader(dump))
+
+	statements := make([]string, 0)
+	for {
+		statement, err := reader.Next()
+		if err == io.EOF {
+			return statements
+		}
+		this.Require().Nil(err)
+		statements = append(statements, statement)
+	}
+}
+
+func (this *DumpLoadTestSuite) TestSplitsStatements() {
+	statements := this.readStatements(`-- MySQL dump 10.13
+/*!40101 SET NAMES utf8mb4 */;
+# a comment
+INSERT INTO ` + "`t`" + ` VALUES (1,'a;b'),(2,'it\'s'),(3,'say ''hi'''),(4,"x;y");
+/* a plain comment; */ UNLOCK TABLES;
+SELECT 1--1;
+`)
+
+	this.Require().Equal([]string{
+		"/*!40101 SET NAMES utf8mb4 */",
+		"INSERT INTO `t` VALUES (1,'a;b'),(2,'it\\'s'),(3,'say ''hi'''),(4,\"x;y\")",
+		"UNLOCK TABLES",
+		"SELECT 1--1",
+	}, statements)
+}
+
+func (this *DumpLoadTestSuite) TestHandlesDelimiter() {
+	statements := this.readStatements(`DELIMITER ;;
+CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END ;;
+DELIMITER ;
+INSERT INTO t VALUES (1)`)
+
+	this.Require().Equal([]string{
+		"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END",
+		"INSERT INTO t VALUES (1)",
+	}, statements)
+}
+
+func (this *DumpLoadTestSuite) TestDelimiterOnlyStartsACommand() {
+	statements := this.readStatements(`SELECT
+delimiter $$
+FROM t;
+  delimiter $$
+SELECT 1$$`)
+
+	this.Require().Equal([]string{
+		"SELECT\ndelimiter $$\nFROM t",
+		"SELECT 1",
+	}, statements)
+}
+
+func (this *DumpLoadTestSuite) TestUnterminatedString() {
+	reader := ghostferry.NewDumpStatementReader(strings.NewReader("INSERT INTO t VALUES ('a);"))
+	_, err := reader.Next()
+	this.Require().NotNil(err)
+}
+
+func (this *DumpLoadTestSuite) TestParsesLegacyMydumperMetadata() {
+	pos, err := ghostferry.ParseMydumperMetadata(strings.NewReader(`Started dump at: 2019-05-01 12:30:00
+SHOW MASTER STATUS:
+	Log: mysql-bin.000003
+	Pos: 154
+	GTID:
+
+SHOW SLAVE STATUS:
+	Host: 10.0.0.1
+	Log: mysql-bin.000099
+	Pos: 999
+
+Finished dump at: 2019-05-01 12:35:00
+`))
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000003", Pos: 154}, pos)
+}
+
+func (this *DumpLoadTestSuite) TestParsesIniMydumperMetadata() {
+	pos, err := ghostferry.ParseMydumperMetadata(strings.NewReader(`[config]
+quote_character = BACKTICK
+
+[replication]
+File = mysql-bin.000099
+Position = 999
+
+[master]
+# Channel_Name = '' # It can be use to setup replication FOR CHANNEL
+File = mysql-bin.000004
+Position = 4711
+Executed_Gtid_Set =
+`))
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000004", Pos: 4711}, pos)
+}
+
+func (this *DumpLoadTestSuite) TestRequiresMydumperCoordinates() {
+	_, err := ghostferry.ParseMydumperMetadata(strings.NewReader("Started dump at: 2019-05-01 12:30:00\n"))
+	this.Require().NotNil(err)
+}
+
+func (this *DumpLoadTestSuite) TestParsesMysqldumpCoordinates() {
+	pos, err := ghostferry.ParseMysqldumpCoordinates(strings.NewReader(`-- MySQL dump 10.13
+/*!40101 SET NAMES utf8mb4 */;
+
+--
+-- Position to start replication or point-in-time recovery from
+--
+
+-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000005', MASTER_LOG_POS=1234;
+
+CREATE TABLE t (id int);
+`))
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000005", Pos: 1234}, pos)
+
+	pos, err = ghostferry.ParseMysqldumpCoordinates(strings.NewReader("CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000002', SOURCE_LOG_POS=157;\n"))
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "binlog.000002", Pos: 157}, pos)
+}
+
+func (this *DumpLoadTestSuite) TestRejectsMysqldumpOfReplicaSource() {
+	_, err := ghostferry.ParseMysqldumpCoordinates(strings.NewReader(`--
+-- Position to start replication or point-in-time recovery from (the master of this slave)
+--
+
+CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000005', MASTER_LOG_POS=1234;
+`))
+	this.Require().NotNil(err)
+}
+
+func (this *DumpLoadTestSuite) TestRequiresMysqldumpCoordinates() {
+	_, err := ghostferry.ParseMysqldumpCoordinates(strings.NewReader("CREATE TABLE t (id int);\nCHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000005', MASTER_LOG_POS=1234;\n"))
+	this.Require().NotNil(err)
+}
+
+func TestDumpLoad(t *testing.T) {
+	suite.Run(t, new(DumpLoadTestSuite))
+}
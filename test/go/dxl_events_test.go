@@ -278,6 +278,105 @@ func (this *DMLEventsTestSuite) TestBinlogDeleteEventMetadata() {
 	this.Require().Nil(dmlEvents[0].NewValues())
 }
 
+func (this *DMLEventsTestSuite) TestBinlogInsertEventWithMinimalRowImage() {
+	rowsEvent := &replication.RowsEvent{
+		Table:         this.tableMapEvent,
+		ColumnBitmap1: []byte{0x03},
+		Rows: [][]interface{}{
+			{1000, []byte("val1"), nil},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogInsertEvents(this.sourceTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	q, err := dmlEvents[0].AsSQLString(this.targetTable.Schema, this.targetTable.Name)
+	this.Require().Nil(err)
+	this.Require().Equal("INSERT IGNORE INTO `target_schema`.`target_table` (`col1`,`col2`) VALUES (1000,_binary'val1')", q)
+}
+
+func (this *DMLEventsTestSuite) TestBinlogUpdateEventWithMinimalRowImage() {
+	rowsEvent := &replication.RowsEvent{
+		Table:         this.tableMapEvent,
+		ColumnBitmap1: []byte{0x01},
+		ColumnBitmap2: []byte{0x04},
+		Rows: [][]interface{}{
+			{1000, nil, nil},
+			{nil, nil, false},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogUpdateEvents(this.sourceTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	q, err := dmlEvents[0].AsSQLString(this.targetTable.Schema, this.targetTable.Name)
+	this.Require().Nil(err)
+	this.Require().Equal("UPDATE `target_schema`.`target_table` SET `col3`=0 WHERE `col1`=1000", q)
+
+	paginationKey, err := dmlEvents[0].VerifierPaginationKey()
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(1000), paginationKey)
+}
+
+func (this *DMLEventsTestSuite) TestBinlogUpdateEventPaginationKeyChanged() {
+	rowsEvent := &replication.RowsEvent{
+		Table: this.tableMapEvent,
+		Rows: [][]interface{}{
+			{1000, []byte("val1"), true},
+			{1000, []byte("val2"), true},
+			{1001, []byte("val3"), false},
+			{5, []byte("val3"), false},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogUpdateEvents(this.sourceTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	changed, err := dmlEvents[0].(*ghostferry.BinlogUpdateEvent).PaginationKeyChanged()
+	this.Require().Nil(err)
+	this.Require().False(changed)
+
+	changed, err = dmlEvents[1].(*ghostferry.BinlogUpdateEvent).PaginationKeyChanged()
+	this.Require().Nil(err)
+	this.Require().True(changed)
+}
+
+func (this *DMLEventsTestSuite) TestBinlogUpdateEventPaginationKeyUnchangedWithMinimalRowImage() {
+	rowsEvent := &replication.RowsEvent{
+		Table:         this.tableMapEvent,
+		ColumnBitmap1: []byte{0x01},
+		ColumnBitmap2: []byte{0x04},
+		Rows: [][]interface{}{
+			{1000, nil, nil},
+			{nil, nil, false},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogUpdateEvents(this.sourceTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	changed, err := dmlEvents[0].(*ghostferry.BinlogUpdateEvent).PaginationKeyChanged()
+	this.Require().Nil(err)
+	this.Require().False(changed)
+}
+
+func (this *DMLEventsTestSuite) TestBinlogDeleteEventWithMinimalRowImage() {
+	rowsEvent := &replication.RowsEvent{
+		Table:         this.tableMapEvent,
+		ColumnBitmap1: []byte{0x01},
+		Rows: [][]interface{}{
+			{1000, nil, nil},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDeleteEvents(this.sourceTable, rowsEvent, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().Nil(err)
+
+	q, err := dmlEvents[0].AsSQLString(this.targetTable.Schema, this.targetTable.Name)
+	this.Require().Nil(err)
+	this.Require().Equal("DELETE FROM `target_schema`.`target_table` WHERE `col1`=1000", q)
+}
+
 func (this *DMLEventsTestSuite) testPaginationKey(rows [][]interface{}) uint64 {
 	rowsEvent := &replication.RowsEvent{
 		Table: this.tableMapEvent,
@@ -337,6 +436,11 @@ func (this *DMLEventsTestSuite) TestPaginationKeyForString() {
 	this.Require().Equal(paginationKey, uint64(1000))
 }
 
+func (this *DMLEventsTestSuite) TestRowDataByteSize() {
+	row := ghostferry.RowData{int64(1), "four", []byte("sixteen bytes..."), nil}
+	this.Require().Equal(uint64(8+4+16+8), row.ByteSize())
+}
+
 func TestDMLEventsTestSuite(t *testing.T) {
 	suite.Run(t, new(DMLEventsTestSuite))
 }
@@ -361,6 +465,37 @@ func (this *DDLEventsTestSuite) TestBinlogQueryGeneratesDDLEvent() {
 	this.Require().Equal("USE `testdb`;\n" + ddlStatement, q)
 }
 
+func (this *DDLEventsTestSuite) TestOnlineSchemaChangeEventAppliesMigrationToTable() {
+	table := ghostferry.NewQualifiedTableName("testdb", "testtable")
+	event := ghostferry.NewOnlineSchemaChangeEvent(table, []string{"ADD COLUMN `data` int", "DROP KEY `idx`"}, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().True(event.IsAutoTransaction())
+	this.Require().Equal("testdb", event.Database())
+	this.Require().Equal("testtable", event.Table())
+
+	q, err := event.AsSQLString("targetdb", "targettable")
+	this.Require().Nil(err)
+	this.Require().Equal("ALTER TABLE `targetdb`.`targettable` ADD COLUMN `data` int;\nALTER TABLE `targetdb`.`targettable` DROP KEY `idx`", q)
+
+	q, err = ghostferry.NewOnlineSchemaChangeEvent(table, nil, ghostferry.BinlogPosition{}, time.Now()).AsSQLString("targetdb", "targettable")
+	this.Require().Nil(err)
+	this.Require().Equal("", q)
+}
+
+func (this *DDLEventsTestSuite) TestRenameTableEventRewritesRenamedTables() {
+	renames := []ghostferry.TableRename{
+		{From: ghostferry.NewQualifiedTableName("testdb", "table1"), To: ghostferry.NewQualifiedTableName("testdb", "table2")},
+		{From: ghostferry.NewQualifiedTableName("testdb", "table3"), To: ghostferry.NewQualifiedTableName("otherdb", "table3")},
+	}
+	event := ghostferry.NewRenameTableEvent(renames, map[string]string{"testdb": "targetdb"}, map[string]string{"table2": "targettable"}, ghostferry.BinlogPosition{}, time.Now())
+	this.Require().True(event.IsAutoTransaction())
+	this.Require().Equal("testdb", event.Database())
+	this.Require().Equal("table1", event.Table())
+
+	q, err := event.AsSQLString("targetdb", "table1")
+	this.Require().Nil(err)
+	this.Require().Equal("RENAME TABLE `targetdb`.`table1` TO `targetdb`.`targettable`, `targetdb`.`table3` TO `otherdb`.`table3`", q)
+}
+
 func (this *DDLEventsTestSuite) TestBinlogQueryWithDBOrTableRenameGeneratesDDLEventError() {
 	ddlStatement := "DELETE TABLE testdb.testtable"
 	affectedTable := ghostferry.NewQualifiedTableName("testdb", "testtable")
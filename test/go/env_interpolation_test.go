@@ -0,0 +1,63 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type EnvInterpolationTestSuite struct {
+	suite.Suite
+}
+
+func (this *EnvInterpolationTestSuite) SetupTest() {
+	os.Setenv("GHOSTFERRY_TEST_HOST", "db.example.com")
+	os.Setenv("GHOSTFERRY_TEST_PASS", `p"a\ss`)
+	os.Unsetenv("GHOSTFERRY_TEST_MISSING")
+}
+
+func (this *EnvInterpolationTestSuite) TearDownTest() {
+	os.Unsetenv("GHOSTFERRY_TEST_HOST")
+	os.Unsetenv("GHOSTFERRY_TEST_PASS")
+}
+
+func (this *EnvInterpolationTestSuite) TestInterpolatesVariables() {
+	config := ghostferry.DatabaseConfig{}
+	err := ghostferry.DecodeConfig(strings.NewReader(`{"Host": "${GHOSTFERRY_TEST_HOST}", "Pass": "${GHOSTFERRY_TEST_PASS}"}`), &config)
+	this.Require().Nil(err)
+	this.Require().Equal("db.example.com", config.Host)
+	this.Require().Equal(`p"a\ss`, config.Pass)
+}
+
+func (this *EnvInterpolationTestSuite) TestUsesDefaultsOfUnsetVariables() {
+	interpolated, err := ghostferry.InterpolateEnv([]byte(`{"User": "${GHOSTFERRY_TEST_MISSING:-ghostferry}"}`))
+	this.Require().Nil(err)
+	this.Require().Equal(`{"User": "ghostferry"}`, string(interpolated))
+}
+
+func (this *EnvInterpolationTestSuite) TestEscapesValuesOnce() {
+	config := ghostferry.DatabaseConfig{}
+	err := ghostferry.DecodeConfig(strings.NewReader(`{"User": "${GHOSTFERRY_TEST_MISSING:-gh\"ost\\ferry}", "Pass": "x${GHOSTFERRY_TEST_PASS}\"x"}`), &config)
+	this.Require().Nil(err)
+	this.Require().Equal(`gh"ost\ferry`, config.User)
+	this.Require().Equal(`xp"a\ss"x`, config.Pass)
+}
+
+func (this *EnvInterpolationTestSuite) TestRejectsUnsetVariables() {
+	_, err := ghostferry.InterpolateEnv([]byte(`{"Pass": "${GHOSTFERRY_TEST_MISSING}"}`))
+	this.Require().EqualError(err, "environment variables referenced by the config are not set: GHOSTFERRY_TEST_MISSING")
+}
+
+func (this *EnvInterpolationTestSuite) TestKeepsEscapedAndBareReferences() {
+	interpolated, err := ghostferry.InterpolateEnv([]byte(`{"Pass": "$${GHOSTFERRY_TEST_HOST}", "User": "$GHOSTFERRY_TEST_HOST"}`))
+	this.Require().Nil(err)
+	this.Require().Equal(`{"Pass": "${GHOSTFERRY_TEST_HOST}", "User": "$GHOSTFERRY_TEST_HOST"}`, string(interpolated))
+}
+
+func TestEnvInterpolation(t *testing.T) {
+	suite.Run(t, new(EnvInterpolationTestSuite))
+}
@@ -1 +1,158 @@
 package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type ErrorPolicyTestSuite struct {
+	suite.Suite
+
+	policy *ghostferry.ErrorPolicyConfig
+}
+
+func (this *ErrorPolicyTestSuite) SetupTest() {
+	this.policy = &ghostferry.ErrorPolicyConfig{
+		Components: map[string]string{
+			"data_iterator":   ghostferry.ErrorActionRetry,
+			"binlog_streamer": ghostferry.ErrorActionRetry,
+		},
+	}
+	this.Require().Nil(this.policy.Validate())
+}
+
+func (this *ErrorPolicyTestSuite) TestDefaultsToFatal() {
+	var policy *ghostferry.ErrorPolicyConfig
+	this.Require().Equal(ghostferry.ErrorActionFatal, policy.ActionFor("data_iterator", errors.New("test error")))
+
+	this.Require().Equal(ghostferry.ErrorActionFatal, this.policy.ActionFor("inline_verifier", errors.New("test error")))
+}
+
+func (this *ErrorPolicyTestSuite) TestRetriesErrorsOfComponents() {
+	this.Require().Equal(ghostferry.ErrorActionRetry, this.policy.ActionFor("data_iterator", errors.New("test error")))
+	this.Require().Equal(ghostferry.ErrorActionRetry, this.policy.ActionFor("binlog_streamer", &mysql.MySQLError{Number: 1213}))
+}
+
+func (this *ErrorPolicyTestSuite) TestSemanticErrorsAreNotRetried() {
+	err := &mysql.MySQLError{Number: 1054, Message: "Unknown column 'data' in 'field list'"}
+	this.Require().Equal(ghostferry.ErrorActionFatal, this.policy.ActionFor("data_iterator", err))
+
+	this.policy.Components["data_iterator"] = ghostferry.ErrorActionSkipTable
+	this.Require().Equal(ghostferry.ErrorActionSkipTable, this.policy.ActionFor("data_iterator", err))
+}
+
+func (this *ErrorPolicyTestSuite) TestQuarantinesTables() {
+	quarantine := &ghostferry.TableQuarantine{}
+	this.Require().False(quarantine.Contains("gftest.table1"))
+
+	quarantine.Add("gftest.table1", errors.New("test error"))
+	this.Require().True(quarantine.Contains("gftest.table1"))
+	this.Require().False(quarantine.Contains("gftest.table2"))
+	this.Require().Equal(map[string]error{"gftest.table1": errors.New("test error")}, quarantine.Tables())
+
+	var noQuarantine *ghostferry.TableQuarantine
+	this.Require().False(noQuarantine.Contains("gftest.table1"))
+	this.Require().Equal(0, len(noQuarantine.Tables()))
+}
+
+func (this *ErrorPolicyTestSuite) TestRestoresQuarantinedTables() {
+	quarantine := &ghostferry.TableQuarantine{}
+	this.Require().Nil(quarantine.Serialize())
+
+	quarantine.Add("gftest.table1", errors.New("test error"))
+	serialized := quarantine.Serialize()
+	this.Require().Equal(map[string]string{"gftest.table1": "test error"}, serialized)
+
+	restored := &ghostferry.TableQuarantine{}
+	restored.Restore(serialized)
+	this.Require().Equal(quarantine.Tables(), restored.Tables())
+}
+
+func (this *ErrorPolicyTestSuite) TestRecoverPanicWithoutPanic() {
+	this.Require().NotPanics(func() {
+		defer ghostferry.RecoverPanic("test", &testhelpers.ErrorHandler{})
+	})
+}
+
+func (this *ErrorPolicyTestSuite) TestRecoverPanicWithoutErrorHandlerPanics() {
+	this.Require().PanicsWithValue("test panic", func() {
+		defer ghostferry.RecoverPanic("test", nil)
+		panic("test panic")
+	})
+}
+
+func (this *ErrorPolicyTestSuite) TestRecoverPanicReportsAndPropagates() {
+	errorHandler := &testhelpers.ErrorHandler{}
+	this.Require().PanicsWithValue("test panic", func() {
+		defer ghostferry.RecoverPanic("test", errorHandler)
+		panic("test panic")
+	})
+	this.Require().Contains(errorHandler.LastError.Error(), "panic: test panic")
+}
+
+func (this *ErrorPolicyTestSuite) TestRecoverPanicHandsPanicsToThePanicErrorHandler() {
+	errorHandler := &ghostferry.PanicErrorHandler{Ferry: &ghostferry.Ferry{}}
+	panics := errorHandler.Panics()
+
+	returned := make(chan struct{})
+	for _, from := range []string{"first", "second"} {
+		from := from
+		go func() {
+			defer close(returned)
+			defer ghostferry.RecoverPanic(from, errorHandler)
+			panic("test panic in " + from)
+		}()
+	}
+
+	select {
+	case err := <-panics:
+		this.Require().Contains(err.Error(), "panic: test panic in ")
+	case <-time.After(time.Second):
+		this.Fail("the panic was not handed to the error handler")
+	}
+
+	// the goroutines do not carry on as if they had completed
+	select {
+	case <-returned:
+		this.Fail("a goroutine returned after panicking")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	select {
+	case err := <-panics:
+		this.Failf("only the first panic is sent", "received %v", err)
+	default:
+	}
+
+	select {
+	case <-errorHandler.Failed():
+	default:
+		this.Fail("the error handler did not signal the failure")
+	}
+}
+
+func (this *ErrorPolicyTestSuite) TestRecoverPanicPropagatesUnreceivedPanics() {
+	errorHandler := &ghostferry.PanicErrorHandler{Ferry: &ghostferry.Ferry{}}
+
+	this.Require().PanicsWithValue("test panic", func() {
+		defer ghostferry.RecoverPanic("test", errorHandler)
+		panic("test panic")
+	})
+
+	select {
+	case <-errorHandler.Failed():
+	default:
+		this.Fail("the error handler did not signal the failure")
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	suite.Run(t, new(ErrorPolicyTestSuite))
+}
@@ -1,7 +1,13 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/testhelpers"
@@ -21,6 +27,7 @@ func (t *FerryTestSuite) SetupTest() {
 func (t *FerryTestSuite) TearDownTest() {
 	_, err := t.Ferry.TargetDB.Exec("SET GLOBAL read_only = OFF")
 	t.Require().Nil(err)
+	t.GhostferryUnitTestSuite.TearDownTest()
 }
 
 func (t *FerryTestSuite) TestReadOnlyDatabaseFailsInitialization() {
@@ -39,6 +46,89 @@ func (t *FerryTestSuite) TestReadOnlyDatabaseFailsInitialization() {
 	t.Require().Nil(err)
 }
 
+func (t *FerryTestSuite) TestPauseHoldsTheCopyUntilResumed() {
+	t.SeedSourceDB(5)
+	tableFilter := &testhelpers.TestTableFilter{
+		DbsFunc:    testhelpers.DbApplicabilityFilter([]string{testhelpers.TestSchemaName}),
+		TablesFunc: nil,
+	}
+	tables, err := ghostferry.LoadTables(t.Ferry.SourceDB, tableFilter, nil, nil, nil)
+	t.Require().Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	t.Require().Nil(t.Ferry.Pause(ctx))
+	t.Require().True(t.Ferry.MigrationThrottler.Throttled())
+
+	var batches int64
+	di := t.Ferry.NewDataIterator()
+	di.AddBatchListener(func(b ghostferry.RowBatch) error {
+		atomic.AddInt64(&batches, 1)
+		if b.IsTableComplete() {
+			di.StateTracker.MarkTableAsCompleted(b.TableSchema().String())
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		di.Run(tables.AsSlice())
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	t.Require().Equal(int64(0), atomic.LoadInt64(&batches))
+
+	t.Ferry.Resume()
+	t.Require().False(t.Ferry.MigrationThrottler.Throttled())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.FailNow("the copy did not continue once resumed")
+	}
+	t.Require().True(atomic.LoadInt64(&batches) > 0)
+}
+
+func (t *FerryTestSuite) TestPauseFlushesTheState() {
+	stateFile := t.tempStateFile()
+	defer os.Remove(stateFile)
+
+	t.Require().Nil(t.Ferry.Pause(context.Background()))
+	defer t.Ferry.Resume()
+
+	t.requireStateDump(stateFile)
+}
+
+func (t *FerryTestSuite) TestFlushState() {
+	t.Require().Nil(t.Ferry.FlushState())
+
+	stateFile := t.tempStateFile()
+	defer os.Remove(stateFile)
+	t.Require().Nil(t.Ferry.FlushState())
+	t.requireStateDump(stateFile)
+
+	t.Ferry.StateFilename = "/nonexistent/state.json"
+	t.Require().Contains(t.Ferry.FlushState().Error(), "writing state to /nonexistent/state.json")
+}
+
+// tempStateFile sets the StateFilename to an empty temporary file
+func (t *FerryTestSuite) tempStateFile() string {
+	file, err := ioutil.TempFile("", "ghostferry-state")
+	t.Require().Nil(err)
+	file.Close()
+	t.Ferry.StateFilename = file.Name()
+	return file.Name()
+}
+
+func (t *FerryTestSuite) requireStateDump(stateFile string) {
+	data, err := ioutil.ReadFile(stateFile)
+	t.Require().Nil(err)
+
+	state := &ghostferry.SerializableState{}
+	t.Require().Nil(json.Unmarshal(data, state))
+	t.Require().Equal(ghostferry.VersionString, state.GhostferryVersion)
+}
+
 func TestFerryTestSuite(t *testing.T) {
 	suite.Run(t, &FerryTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
 }
@@ -17,7 +17,7 @@ func TestHashesSql(t *testing.T) {
 	sql, args, err := ghostferry.GetMd5HashesSql("gftest", "test_table", "id", columns, paginationKeys)
 
 	assert.Nil(t, err)
-	assert.Equal(t, "SELECT `id`, MD5(CONCAT(MD5(COALESCE(`id`, 'NULL')),MD5(COALESCE(`data`, 'NULL')),MD5(COALESCE((if (`float_col` = '-0', 0, `float_col`)), 'NULL')))) "+
+	assert.Equal(t, "SELECT `id`, MD5(CONCAT(MD5(COALESCE(`id`, 'NULL')),MD5(COALESCE(`data`, 'NULL')),MD5(COALESCE((if (`float_col` = '-0', 0, `float_col`) + 0e0), 'NULL')))) "+
 		"AS row_fingerprint FROM `gftest`.`test_table` WHERE `id` IN (?,?,?) ORDER BY `id`", sql)
 	for idx, arg := range args {
 		assert.Equal(t, paginationKeys[idx], arg.(uint64))
@@ -110,6 +110,53 @@ func TestVerificationFailsUpdatedRow(t *testing.T) {
 	assert.True(t, ran)
 }
 
+func TestVerificationFailsFloatDifferingInInsignificantDigits(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	iterativeVerifier := &ghostferry.IterativeVerifier{}
+	ran := false
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T: t,
+		SetupAction: func(ferry *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+			setupSingleTableDatabase(ferry, sourceDB, targetDB)
+
+			for _, db := range []*sql.DB{sourceDB, targetDB} {
+				_, err := db.Exec("ALTER TABLE gftest.table1 ADD float_col FLOAT")
+				testhelpers.PanicIfError(err)
+			}
+		},
+		AfterRowCopyIsComplete: func(ferry *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+			setupIterativeVerifierFromFerry(iterativeVerifier, ferry.Ferry)
+
+			err := iterativeVerifier.Initialize()
+			testhelpers.PanicIfError(err)
+
+			err = iterativeVerifier.VerifyBeforeCutover()
+			testhelpers.PanicIfError(err)
+		},
+		BeforeStoppingBinlogStreaming: func(ferry *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+			_, err := sourceDB.Exec("INSERT INTO gftest.table1 (id, data, float_col) VALUES (42, 'OK', 1.0000001) ON DUPLICATE KEY UPDATE float_col = 1.0000001")
+			testhelpers.PanicIfError(err)
+		},
+		AfterStoppedBinlogStreaming: func(ferry *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+			// MySQL displays both values as 1
+			_, err := targetDB.Exec("UPDATE gftest.table1 SET float_col = 1.0000002 WHERE id = 42")
+			testhelpers.PanicIfError(err)
+
+			result, err := iterativeVerifier.VerifyDuringCutover()
+			assert.Nil(t, err)
+			assert.False(t, result.DataCorrect)
+			assert.Regexp(t, "verification failed.*gftest.table1.*paginationKeys: 42", result.Message)
+			ran = true
+		},
+		Ferry:                   ferry,
+		DisableChecksumVerifier: true,
+	}
+
+	testcase.Run()
+	assert.True(t, ran)
+}
+
 func TestIgnoresColumns(t *testing.T) {
 	ferry := testhelpers.NewTestFerry()
 	iterativeVerifier := &ghostferry.IterativeVerifier{}
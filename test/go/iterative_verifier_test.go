@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
 	"sort"
@@ -95,6 +96,25 @@ func (t *IterativeVerifierTestSuite) TestVerifyOnceFails() {
 	t.Require().Equal("verification failed on table: gftest.test_table_1 for paginationKey: 42", result.Message)
 }
 
+func (t *IterativeVerifierTestSuite) TestVerifyOnceWithReportFindsAllMismatches() {
+	t.InsertRowInDb(41, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(41, "foo", t.Ferry.TargetDB)
+	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
+	t.InsertRowInDb(43, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(44, "foo", t.Ferry.TargetDB)
+
+	reports, err := t.verifier.VerifyOnceWithReport()
+	t.Require().Nil(err)
+
+	report := reports["gftest.test_table_1"]
+	t.Require().NotNil(report)
+	t.Require().False(report.DataCorrect())
+	t.Require().Equal(uint64(3), report.SourceRowsVerified)
+	t.Require().Equal(uint64(3), report.TargetRowsVerified)
+	t.Require().Equal([]uint64{42, 43, 44}, report.MismatchedPaginationKeys)
+}
+
 func (t *IterativeVerifierTestSuite) TestVerifyCompressedOnceFails() {
 	t.InsertCompressedRowInDb(42, testhelpers.TestCompressedData1, t.Ferry.SourceDB)
 	t.InsertCompressedRowInDb(42, testhelpers.TestCompressedData2, t.Ferry.TargetDB)
@@ -209,6 +229,31 @@ func (t *IterativeVerifierTestSuite) TestBeforeCutoverFailuresPassDuringCutover(
 	t.Require().Equal("", result.Message)
 }
 
+func (t *IterativeVerifierTestSuite) TestMismatchesFoundWhileIdleFailDuringCutover() {
+	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
+
+	t.verifier.IdleVerification = &ghostferry.IdleVerificationConfig{CheckInterval: "10ms"}
+	t.Require().Nil(t.verifier.IdleVerification.Validate())
+	t.verifier.StateTracker = ghostferry.NewStateTracker(10)
+	for _, table := range t.verifier.Tables {
+		t.verifier.StateTracker.MarkTableAsCompleted(table.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	t.verifier.VerifyWhileIdle(ctx)
+	t.Require().Nil(ctx.Err())
+
+	err := t.verifier.VerifyBeforeCutover()
+	t.Require().Nil(err)
+
+	result, err := t.verifier.VerifyDuringCutover()
+	t.Require().Nil(err)
+	t.Require().False(result.DataCorrect)
+	t.Require().Equal("verification failed on table: gftest.test_table_1 for paginationKeys: 42", result.Message)
+}
+
 func (t *IterativeVerifierTestSuite) TestChangingDataChangesHash() {
 	t.InsertRow(42, "foo")
 	old := t.GetHashes([]uint64{42})[0]
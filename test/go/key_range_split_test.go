@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type KeyRangeSplitTestSuite struct {
+	suite.Suite
+
+	table  *ghostferry.TableSchema
+	tables ghostferry.TableSchemaCache
+}
+
+func (this *KeyRangeSplitTestSuite) SetupTest() {
+	columns := []schema.TableColumn{
+		schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER},
+		schema.TableColumn{Name: "data", Type: schema.TYPE_STRING},
+	}
+	this.table = &ghostferry.TableSchema{
+		Table: &schema.Table{
+			Schema:  "test_schema",
+			Name:    "test_table",
+			Columns: columns,
+		},
+		PaginationKey: &ghostferry.PaginationKey{
+			Columns:       []*schema.TableColumn{&columns[0]},
+			ColumnIndices: []int{0},
+		},
+	}
+	this.tables = ghostferry.TableSchemaCache{"test_schema.test_table": this.table}
+}
+
+func (this *KeyRangeSplitTestSuite) paginationKey(id int64) *ghostferry.PaginationKeyData {
+	paginationKey, err := ghostferry.NewPaginationKeyDataFromRow(ghostferry.RowData{id, "data"}, this.table.PaginationKey)
+	this.Require().Nil(err)
+	return paginationKey
+}
+
+func (this *KeyRangeSplitTestSuite) positions(keyRanges []*ghostferry.KeyRange) (positions [][2]int64) {
+	for _, keyRange := range keyRanges {
+		positions = append(positions, [2]int64{
+			keyRange.LastSuccessfulPaginationKey.Values[0].(int64),
+			keyRange.End.Values[0].(int64),
+		})
+	}
+	return
+}
+
+func (this *KeyRangeSplitTestSuite) TestSplitsKeysIntoContiguousRanges() {
+	keyRanges := ghostferry.SplitKeyRange(this.table, 0, 102, 4)
+	this.Require().Equal([][2]int64{{0, 25}, {25, 50}, {50, 75}, {75, 102}}, this.positions(keyRanges))
+
+	keyRanges = ghostferry.SplitKeyRange(this.table, -11, 9, 2)
+	this.Require().Equal([][2]int64{{-11, -1}, {-1, 9}}, this.positions(keyRanges))
+}
+
+func (this *KeyRangeSplitTestSuite) TestTracksPositionsPerRange() {
+	stateTracker := ghostferry.NewStateTracker(0)
+	stateTracker.SetKeyRanges("test_schema.test_table", ghostferry.SplitKeyRange(this.table, 0, 90, 3))
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test_schema.test_table", this.paginationKey(45))
+	stateTracker.UpdateLastSuccessfulPaginationKey("test_schema.test_table", this.paginationKey(10))
+	keyRanges := stateTracker.KeyRanges("test_schema.test_table")
+	this.Require().Equal([][2]int64{{10, 30}, {45, 60}, {60, 90}}, this.positions(keyRanges))
+
+	// the table is copied up to the position of the first incomplete range
+	lastSuccessfulPaginationKey, completed := stateTracker.LastSuccessfulPaginationKey("test_schema.test_table")
+	this.Require().False(completed)
+	this.Require().Equal(int64(10), lastSuccessfulPaginationKey.Values[0])
+
+	stateTracker.MarkKeyRangeAsCompleted("test_schema.test_table", 0)
+	lastSuccessfulPaginationKey, _ = stateTracker.LastSuccessfulPaginationKey("test_schema.test_table")
+	this.Require().Equal(int64(45), lastSuccessfulPaginationKey.Values[0])
+	this.Require().True(stateTracker.KeyRanges("test_schema.test_table")[0].IsComplete())
+}
+
+func (this *KeyRangeSplitTestSuite) TestKeyRangesAreSerialized() {
+	stateTracker := ghostferry.NewStateTracker(0)
+	stateTracker.SetKeyRanges("test_schema.test_table", ghostferry.SplitKeyRange(this.table, 0, 90, 3))
+	stateTracker.UpdateLastSuccessfulPaginationKey("test_schema.test_table", this.paginationKey(70))
+
+	stateJSON, err := json.Marshal(stateTracker.Serialize(this.tables, nil))
+	this.Require().Nil(err)
+	state := &ghostferry.SerializableState{}
+	this.Require().Nil(json.Unmarshal(stateJSON, state))
+	this.Require().Equal(1, len(state.KeyRanges))
+
+	resumed, err := ghostferry.NewStateTrackerFromSerializedState(0, state, this.tables)
+	this.Require().Nil(err)
+	this.Require().Equal([][2]int64{{0, 30}, {30, 60}, {70, 90}}, this.positions(resumed.KeyRanges("test_schema.test_table")))
+
+	resumed.ResetTableCopy("test_schema.test_table")
+	this.Require().Nil(resumed.KeyRanges("test_schema.test_table"))
+}
+
+func TestKeyRangeSplit(t *testing.T) {
+	suite.Run(t, new(KeyRangeSplitTestSuite))
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type LagMonitorTestSuite struct {
+	suite.Suite
+
+	lag     time.Duration
+	monitor *ghostferry.LagMonitor
+}
+
+func (this *LagMonitorTestSuite) SetupTest() {
+	this.lag = 0
+	this.monitor = &ghostferry.LagMonitor{
+		Config: &ghostferry.LagAlertConfig{
+			WarningLag:          "10s",
+			CriticalLag:         "1m",
+			CriticalLagDuration: "5m",
+		},
+		Lag: func(time.Time) time.Duration { return this.lag },
+	}
+	this.Require().Nil(this.monitor.Config.Validate())
+}
+
+func (this *LagMonitorTestSuite) TestWarningLevel() {
+	now := time.Now()
+	this.Require().Equal(ghostferry.LagLevelOK, this.monitor.Check(now))
+
+	this.lag = 30 * time.Second
+	this.Require().Equal(ghostferry.LagLevelWarning, this.monitor.Check(now))
+
+	this.lag = 0
+	this.Require().Equal(ghostferry.LagLevelOK, this.monitor.Check(now))
+}
+
+func (this *LagMonitorTestSuite) TestCriticalOnlyAfterDuration() {
+	now := time.Now()
+
+	this.lag = 2 * time.Minute
+	this.Require().Equal(ghostferry.LagLevelWarning, this.monitor.Check(now))
+	this.Require().Equal(ghostferry.LagLevelWarning, this.monitor.Check(now.Add(4*time.Minute)))
+	this.Require().Equal(ghostferry.LagLevelCritical, this.monitor.Check(now.Add(5*time.Minute)))
+
+	// dropping below the critical lag restarts the duration
+	this.lag = 30 * time.Second
+	this.Require().Equal(ghostferry.LagLevelWarning, this.monitor.Check(now.Add(6*time.Minute)))
+	this.lag = 2 * time.Minute
+	this.Require().Equal(ghostferry.LagLevelWarning, this.monitor.Check(now.Add(7*time.Minute)))
+}
+
+func (this *LagMonitorTestSuite) TestCriticalCallbackIsCalledOncePerEpisode() {
+	var calls []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		this.Require().Nil(json.NewDecoder(r.Body).Decode(&body))
+		calls = append(calls, body)
+	}))
+	defer server.Close()
+
+	this.monitor.Config = &ghostferry.LagAlertConfig{
+		CriticalLag:      "1m",
+		CriticalCallback: ghostferry.HTTPCallback{URI: server.URL, Payload: "replica-1"},
+	}
+	this.Require().Nil(this.monitor.Config.Validate())
+
+	now := time.Now()
+	this.lag = 2 * time.Minute
+	this.Require().Equal(ghostferry.LagLevelCritical, this.monitor.Check(now))
+	this.Require().Equal(ghostferry.LagLevelCritical, this.monitor.Check(now.Add(time.Second)))
+
+	this.Require().Equal(1, len(calls))
+	this.Require().Equal("replica-1", calls[0]["Payload"])
+	this.Require().Equal(120.0, calls[0]["LagSeconds"])
+}
+
+func TestLagMonitor(t *testing.T) {
+	suite.Run(t, new(LagMonitorTestSuite))
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type recordingMetricsSink struct {
+	metrics []interface{}
+	closed  bool
+}
+
+func (s *recordingMetricsSink) Emit(metric interface{}) error {
+	s.metrics = append(s.metrics, metric)
+	return nil
+}
+
+func (s *recordingMetricsSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+type MetricsSinkTestSuite struct {
+	suite.Suite
+}
+
+func (this *MetricsSinkTestSuite) TestNewMetricsEmitsToSinkUntilFlushed() {
+	sink := &recordingMetricsSink{}
+	metrics := ghostferry.NewMetrics("test", sink)
+
+	metrics.Count("rows", 2, nil, 1.0)
+	metrics.Gauge("lag", 1.5, nil, 1.0)
+	metrics.StopAndFlush()
+
+	this.Require().True(sink.closed)
+	this.Require().Equal(2, len(sink.metrics))
+	this.Require().Equal("test.rows", sink.metrics[0].(ghostferry.CountMetric).Key)
+	this.Require().Equal("test.lag", sink.metrics[1].(ghostferry.GaugeMetric).Key)
+}
+
+func (this *MetricsSinkTestSuite) TestPrometheusSinkAggregatesMetrics() {
+	sink := ghostferry.NewPrometheusMetricsSink()
+	tags := []ghostferry.MetricTag{{Name: "table", Value: "gftest.t\"1"}, {Name: "phase", Value: "copying"}}
+
+	count := ghostferry.CountMetric{MetricBase: ghostferry.MetricBase{Key: "ghostferry.BatchWriter.Rows", Tags: tags}, Value: 3}
+	this.Require().Nil(sink.Emit(count))
+	this.Require().Nil(sink.Emit(count))
+
+	gauge := ghostferry.GaugeMetric{MetricBase: ghostferry.MetricBase{Key: "ghostferry.lag"}, Value: 2}
+	this.Require().Nil(sink.Emit(gauge))
+	gauge.Value = 1
+	this.Require().Nil(sink.Emit(gauge))
+
+	timer := ghostferry.TimerMetric{MetricBase: ghostferry.MetricBase{Key: "ghostferry.WriteLatency"}, Value: 500 * time.Millisecond}
+	this.Require().Nil(sink.Emit(timer))
+	this.Require().Nil(sink.Emit(timer))
+
+	this.Require().NotNil(sink.Emit(ghostferry.HistogramMetric{MetricBase: ghostferry.MetricBase{Key: "ghostferry.lag"}}))
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := "# HELP ghostferry_BatchWriter_Rows_total ghostferry.BatchWriter.Rows\n" +
+		"# TYPE ghostferry_BatchWriter_Rows_total counter\n" +
+		"ghostferry_BatchWriter_Rows_total{phase=\"copying\",table=\"gftest.t\\\"1\"} 6\n" +
+		"# HELP ghostferry_WriteLatency_seconds ghostferry.WriteLatency\n" +
+		"# TYPE ghostferry_WriteLatency_seconds summary\n" +
+		"ghostferry_WriteLatency_seconds_sum 1\n" +
+		"ghostferry_WriteLatency_seconds_count 2\n" +
+		"# HELP ghostferry_lag ghostferry.lag\n" +
+		"# TYPE ghostferry_lag gauge\n" +
+		"ghostferry_lag 1\n"
+	this.Require().Equal(expected, recorder.Body.String())
+}
+
+func (this *MetricsSinkTestSuite) TestPrometheusSinkExposesValidNames() {
+	sink := ghostferry.NewPrometheusMetricsSink()
+	tags := []ghostferry.MetricTag{{Name: "__name__", Value: "line\nbreak"}, {Name: "1st", Value: "a\\b"}}
+
+	this.Require().Nil(sink.Emit(ghostferry.CountMetric{MetricBase: ghostferry.MetricBase{Key: "rows_total"}, Value: 1}))
+	this.Require().Nil(sink.Emit(ghostferry.GaugeMetric{MetricBase: ghostferry.MetricBase{Key: "2pc-lag", Tags: tags}, Value: math.Inf(1)}))
+	this.Require().Nil(sink.Emit(ghostferry.TimerMetric{MetricBase: ghostferry.MetricBase{Key: "wait_seconds"}, Value: 1500 * time.Millisecond}))
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := "# HELP _2pc_lag 2pc-lag\n" +
+		"# TYPE _2pc_lag gauge\n" +
+		"_2pc_lag{_1st=\"a\\\\b\",tag__name__=\"line\\nbreak\"} +Inf\n" +
+		"# HELP rows_total rows_total\n" +
+		"# TYPE rows_total counter\n" +
+		"rows_total 1\n" +
+		"# HELP wait_seconds wait_seconds\n" +
+		"# TYPE wait_seconds summary\n" +
+		"wait_seconds_sum 1.5\n" +
+		"wait_seconds_count 1\n"
+	this.Require().Equal(expected, recorder.Body.String())
+}
+
+func (this *MetricsSinkTestSuite) TestSetGlobalMetricsSinkFlushesTheReplacedSink() {
+	defer ghostferry.SetGlobalMetrics("ghostferry", nil)
+
+	replaced := &recordingMetricsSink{}
+	ghostferry.SetGlobalMetricsSink("test", replaced).Count("rows", 1, nil, 1.0)
+
+	sink := &recordingMetricsSink{}
+	ghostferry.SetGlobalMetricsSink("test", sink)
+
+	this.Require().True(replaced.closed)
+	this.Require().Equal(1, len(replaced.metrics))
+	this.Require().False(sink.closed)
+}
+
+func (this *MetricsSinkTestSuite) TestPrometheusSinkScalesSampledMetrics() {
+	sink := ghostferry.NewPrometheusMetricsSink()
+
+	count := ghostferry.CountMetric{MetricBase: ghostferry.MetricBase{Key: "rows", SampleRate: 0.5}, Value: 1}
+	for i := 0; i < 10000; i++ {
+		this.Require().Nil(sink.Emit(count))
+	}
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	var total float64
+	_, err := fmt.Sscanf(strings.Split(recorder.Body.String(), "\n")[2], "rows_total %g", &total)
+	this.Require().Nil(err)
+	this.Require().InDelta(10000, total, 1000)
+	this.Require().NotEqual(float64(10000), total)
+}
+
+func (this *MetricsSinkTestSuite) TestValidatesConfig() {
+	config := &ghostferry.MetricsConfig{Sink: ghostferry.MetricsSinkStatsD}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("127.0.0.1:8125", config.StatsDAddress)
+	this.Require().Equal("ghostferry", config.Prefix)
+
+	config = &ghostferry.MetricsConfig{Sink: "graphite"}
+	this.Require().NotNil(config.Validate())
+}
+
+func TestMetricsSink(t *testing.T) {
+	suite.Run(t, new(MetricsSinkTestSuite))
+}
@@ -158,6 +158,21 @@ func (this *MetricsTestSuite) TestTimer() {
 	this.Require().Equal(expected, <-this.sink)
 }
 
+func (this *MetricsTestSuite) TestHistogram() {
+	this.metrics.Histogram("test_key", 42.5, this.tags, 1.0)
+
+	expected := ghostferry.HistogramMetric{
+		MetricBase: ghostferry.MetricBase{
+			Key:        "test.test_key",
+			Tags:       this.tags,
+			SampleRate: 1.0,
+		},
+		Value: float64(42.5),
+	}
+
+	this.Require().Equal(expected, <-this.sink)
+}
+
 func (this *MetricsTestSuite) TestDropMetricIfSinkFull() {
 	sink := make(chan interface{}, 1)
 
@@ -184,6 +199,61 @@ func (this *MetricsTestSuite) TestDropMetricIfSinkFull() {
 	}
 }
 
+func (this *MetricsTestSuite) TestNilMetricsUsesGlobalMetrics() {
+	ghostferry.SetGlobalMetrics("global", this.sink)
+	defer ghostferry.SetGlobalMetrics("ghostferry", nil)
+
+	var metrics *ghostferry.Metrics
+	metrics.Count("test_key", 1, nil, 1.0)
+
+	metric := (<-this.sink).(ghostferry.CountMetric)
+	this.Require().Equal("global.test_key", metric.Key)
+}
+
+func (this *MetricsTestSuite) TestSetDefaultTagReplacesExistingTag() {
+	this.metrics.SetDefaultTag("run_id", "1")
+	this.metrics.SetDefaultTag("run_id", "2")
+	this.Require().Equal([]ghostferry.MetricTag{{Name: "run_id", Value: "2"}}, this.metrics.DefaultTags)
+}
+
+func (this *MetricsTestSuite) TestPhaseTag() {
+	this.metrics.SetPhase("copying")
+	this.metrics.Measure("test_run", this.tags, 1.0, func() {})
+
+	actual := (<-this.sink).(ghostferry.TimerMetric)
+	this.Require().Equal(append(this.tags, ghostferry.MetricTag{Name: "phase", Value: "copying"}), actual.Tags)
+}
+
+func (this *MetricsTestSuite) TestWithOwnTags() {
+	this.metrics.SetDefaultTag("run_id", "shared")
+	source := this.metrics.WithOwnTags()
+	target := this.metrics.WithOwnTags()
+
+	source.SetDefaultTag("run_id", "source")
+	source.SetPhase("copying")
+	target.SetDefaultTag("run_id", "target")
+	target.SetPhase("cutover")
+
+	source.Count("test_count", 1, nil, 1.0)
+	target.Count("test_count", 1, nil, 1.0)
+
+	actual := (<-this.sink).(ghostferry.CountMetric)
+	this.Require().Equal("test.test_count", actual.Key)
+	this.Require().Equal([]ghostferry.MetricTag{{Name: "run_id", Value: "source"}, {Name: "phase", Value: "copying"}}, actual.Tags)
+
+	actual = (<-this.sink).(ghostferry.CountMetric)
+	this.Require().Equal([]ghostferry.MetricTag{{Name: "run_id", Value: "target"}, {Name: "phase", Value: "cutover"}}, actual.Tags)
+
+	this.Require().Equal([]ghostferry.MetricTag{{Name: "run_id", Value: "shared"}}, this.metrics.DefaultTags)
+}
+
+func (this *MetricsTestSuite) TestStopAndFlushOfDerivedMetricsClosesTheSink() {
+	this.metrics.WithOwnTags().StopAndFlush()
+
+	_, open := <-this.sink
+	this.Require().False(open)
+}
+
 func TestMetricsTestSuite(t *testing.T) {
 	suite.Run(t, new(MetricsTestSuite))
 }
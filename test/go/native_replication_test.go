@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type NativeReplicationTestSuite struct {
+	suite.Suite
+
+	handoff *ghostferry.NativeReplicationHandoff
+	pos     mysql.Position
+}
+
+func (this *NativeReplicationTestSuite) SetupTest() {
+	config := &ghostferry.NativeReplicationHandoffConfig{Enabled: true}
+	source := &ghostferry.DatabaseConfig{Host: "source.example.com", Port: 3306, User: "ghostferry", Pass: "it's secret"}
+	this.Require().Nil(config.Validate(source))
+
+	this.handoff = &ghostferry.NativeReplicationHandoff{Config: config}
+	this.pos = mysql.Position{Name: "mysql-bin.000042", Pos: 1234}
+}
+
+func (this *NativeReplicationTestSuite) TestChangeMasterToSourcePosition() {
+	statements := this.handoff.Statements(this.pos)
+
+	this.Require().Equal([]string{
+		"CHANGE MASTER TO MASTER_HOST = 'source.example.com', MASTER_PORT = 3306, MASTER_USER = 'ghostferry', MASTER_PASSWORD = 'it''s secret', MASTER_LOG_FILE = 'mysql-bin.000042', MASTER_LOG_POS = 1234, MASTER_AUTO_POSITION = 0",
+		"START SLAVE",
+	}, statements)
+}
+
+func (this *NativeReplicationTestSuite) TestChannelAndSSL() {
+	this.handoff.Config.Channel = "ghostferry"
+	this.handoff.Config.SkipStart = true
+	this.handoff.SourceSSL = true
+
+	statements := this.handoff.Statements(this.pos)
+
+	this.Require().Equal(1, len(statements))
+	this.Require().Contains(statements[0], ", MASTER_SSL = 1 FOR CHANNEL 'ghostferry'")
+}
+
+func (this *NativeReplicationTestSuite) TestFiltersCopiedTablesAfterRewrites() {
+	this.handoff.DatabaseRewrites = map[string]string{"shop": "shop_new"}
+	this.handoff.Tables = ghostferry.TableSchemaCache{
+		"shop.orders":  &ghostferry.TableSchema{Table: &schema.Table{Schema: "shop", Name: "orders"}},
+		"other.events": &ghostferry.TableSchema{Table: &schema.Table{Schema: "other", Name: "events"}},
+	}
+
+	statements := this.handoff.Statements(this.pos)
+
+	this.Require().Equal(3, len(statements))
+	this.Require().Equal("CHANGE REPLICATION FILTER REPLICATE_REWRITE_DB = ((`shop`, `shop_new`)), REPLICATE_DO_TABLE = (`other`.`events`, `shop_new`.`orders`)", statements[1])
+}
+
+func TestNativeReplication(t *testing.T) {
+	suite.Run(t, new(NativeReplicationTestSuite))
+}
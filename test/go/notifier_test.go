@@ -0,0 +1,105 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type NotifierTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	status   int
+	requests []map[string]interface{}
+}
+
+func (this *NotifierTestSuite) SetupTest() {
+	this.status = http.StatusOK
+	this.requests = nil
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		this.Require().Nil(json.NewDecoder(r.Body).Decode(&body))
+		this.requests = append(this.requests, body)
+		w.WriteHeader(this.status)
+	}))
+}
+
+func (this *NotifierTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *NotifierTestSuite) TestSlackNotifierPostsSummary() {
+	notifier := &ghostferry.SlackNotifier{WebhookURL: this.server.URL, Client: this.server.Client()}
+
+	err := notifier.Notify(ghostferry.Notification{
+		Event:   ghostferry.NotificationRunStarted,
+		Summary: "started copying 2 tables",
+		Details: map[string]string{"target": "target:3306", "run_id": "42"},
+	})
+	this.Require().Nil(err)
+
+	this.Require().Equal(1, len(this.requests))
+	this.Require().Equal("*ghostferry run_started*: started copying 2 tables\nrun_id: `42`\ntarget: `target:3306`", this.requests[0]["text"])
+}
+
+func (this *NotifierTestSuite) TestPagerDutyNotifierTriggersCriticalAlert() {
+	this.status = http.StatusAccepted
+	notifier := &ghostferry.PagerDutyNotifier{RoutingKey: "key", EventsURL: this.server.URL, Client: this.server.Client()}
+
+	err := notifier.Notify(ghostferry.Notification{
+		Event:   ghostferry.NotificationFatalError,
+		Summary: "failed in binlog_writer: boom",
+		Details: map[string]string{"target": "target:3306", "run_id": "42"},
+	})
+	this.Require().Nil(err)
+
+	this.Require().Equal(1, len(this.requests))
+	this.Require().Equal("key", this.requests[0]["routing_key"])
+	this.Require().Equal("trigger", this.requests[0]["event_action"])
+	this.Require().Equal("ghostferry/42/target:3306/fatal_error", this.requests[0]["dedup_key"])
+
+	payload := this.requests[0]["payload"].(map[string]interface{})
+	this.Require().Equal("critical", payload["severity"])
+	this.Require().Equal("target:3306", payload["source"])
+	this.Require().Equal("failed in binlog_writer: boom", payload["summary"])
+}
+
+func (this *NotifierTestSuite) TestNotifierErrorsOnFailedRequest() {
+	this.status = http.StatusBadRequest
+	notifier := &ghostferry.SlackNotifier{WebhookURL: this.server.URL, Client: this.server.Client()}
+
+	this.Require().NotNil(notifier.Notify(ghostferry.Notification{Event: ghostferry.NotificationRunStarted}))
+}
+
+func (this *NotifierTestSuite) TestSendsOnlySubscribedEvents() {
+	notifications := &ghostferry.Notifications{}
+	notifications.Add("slack", &ghostferry.SlackNotifier{WebhookURL: this.server.URL, Client: this.server.Client()}, []string{ghostferry.NotificationCutoverCompleted})
+
+	notifications.Send(ghostferry.Notification{Event: ghostferry.NotificationRunStarted})
+	this.Require().Equal(0, len(this.requests))
+
+	notifications.Send(ghostferry.Notification{Event: ghostferry.NotificationCutoverCompleted})
+	this.Require().Equal(1, len(this.requests))
+}
+
+func (this *NotifierTestSuite) TestValidatesConfig() {
+	config := &ghostferry.NotificationsConfig{}
+	this.Require().False(config.Enabled())
+
+	config.PagerDuty.RoutingKey = "key"
+	this.Require().True(config.Enabled())
+	this.Require().Nil(config.Validate())
+	this.Require().Equal([]string{ghostferry.NotificationFatalError, ghostferry.NotificationLagCritical}, config.PagerDuty.Events)
+
+	config.Slack.Events = []string{"run_exploded"}
+	this.Require().NotNil(config.Validate())
+}
+
+func TestNotifier(t *testing.T) {
+	suite.Run(t, new(NotifierTestSuite))
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+const PositionMapSchemaName = "gftest_position_map"
+
+type PositionMapTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	config *ghostferry.PositionMapConfig
+}
+
+func (this *PositionMapTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.resetDbs()
+
+	this.config = &ghostferry.PositionMapConfig{
+		Database:       PositionMapSchemaName,
+		RecordInterval: "1h",
+		MaxRows:        2,
+	}
+	this.Require().Nil(this.config.Validate())
+}
+
+func (this *PositionMapTestSuite) TearDownTest() {
+	this.resetDbs()
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *PositionMapTestSuite) resetDbs() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", PositionMapSchemaName))
+	this.Require().Nil(err)
+}
+
+func (this *PositionMapTestSuite) newPositionMap() *ghostferry.PositionMap {
+	positionMap, err := ghostferry.NewPositionMap(this.config, this.Ferry.TargetDB, logrus.WithField("tag", "test"))
+	this.Require().Nil(err)
+	return positionMap
+}
+
+func (this *PositionMapTestSuite) countRows() int {
+	var count int
+	err := this.Ferry.TargetDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM `%s`.`%s`", PositionMapSchemaName, this.config.Table)).Scan(&count)
+	this.Require().Nil(err)
+	return count
+}
+
+func (this *PositionMapTestSuite) TestRecordsSourceAndTargetPositions() {
+	positionMap := this.newPositionMap()
+
+	eventTime := time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC)
+	positionMap.Record(ghostferry.BinlogPosition{
+		EventPosition:  mysql.Position{Name: "mysql-bin.000002", Pos: 200},
+		ResumePosition: mysql.Position{Name: "mysql-bin.000002", Pos: 150},
+	}, eventTime)
+
+	targetPosition, err := ghostferry.ShowMasterStatusBinlogPosition(this.Ferry.TargetDB)
+	this.Require().Nil(err)
+
+	mapping, err := positionMap.MappingFor(mysql.Position{Name: "mysql-bin.000002", Pos: 100})
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000002", Pos: 200}, mapping.SourcePosition.EventPosition)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000002", Pos: 150}, mapping.SourcePosition.ResumePosition)
+	this.Require().Equal(eventTime, mapping.EventTime)
+	this.Require().Equal(targetPosition.Name, mapping.TargetPosition.Name)
+	this.Require().True(mapping.TargetPosition.Pos > 0)
+
+	_, err = positionMap.MappingFor(mysql.Position{Name: "mysql-bin.000002", Pos: 201})
+	this.Require().NotNil(err)
+}
+
+func (this *PositionMapTestSuite) TestRecordsPendingPositionOnFlush() {
+	positionMap := this.newPositionMap()
+
+	positionMap.Record(ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: 100}), time.Time{})
+	positionMap.Record(ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: 200}), time.Time{})
+	positionMap.Record(ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: 300}), time.Time{})
+	this.Require().Equal(1, this.countRows())
+
+	positionMap.Flush()
+	this.Require().Equal(2, this.countRows())
+
+	mapping, err := positionMap.MappingFor(mysql.Position{Name: "mysql-bin.000002", Pos: 101})
+	this.Require().Nil(err)
+	this.Require().Equal(uint32(300), mapping.SourcePosition.EventPosition.Pos)
+	this.Require().True(mapping.EventTime.IsZero())
+}
+
+func (this *PositionMapTestSuite) TestPrunesBeyondMaxRows() {
+	this.config.RecordInterval = "0s"
+	this.Require().Nil(this.config.Validate())
+	positionMap := this.newPositionMap()
+
+	for i := 1; i <= 5; i++ {
+		positionMap.Record(ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: uint32(i * 100)}), time.Time{})
+	}
+	this.Require().Equal(2, this.countRows())
+
+	mapping, err := positionMap.MappingFor(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	this.Require().Nil(err)
+	this.Require().Equal(uint32(400), mapping.SourcePosition.EventPosition.Pos)
+}
+
+func TestPositionMap(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &PositionMapTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type PreflightTestSuite struct {
+	suite.Suite
+}
+
+func (this *PreflightTestSuite) TestMissingPrivileges() {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `ghostferry`@`%`",
+		"GRANT SELECT, REPLICATION SLAVE ON *.* TO `ghostferry`@`%`",
+		"GRANT INSERT (`id`, `data`) ON `gftest`.`table1` TO `ghostferry`@`%`",
+	}
+
+	// INSERT is granted on some columns of a table only
+	missing := ghostferry.MissingPrivileges(grants, []string{"SELECT", "INSERT", "REPLICATION SLAVE", "REPLICATION CLIENT"}, []string{"gftest"})
+	this.Require().Equal([]string{"INSERT", "REPLICATION CLIENT"}, missing)
+}
+
+func (this *PreflightTestSuite) TestMissingPrivilegesOnTheCopiedDatabases() {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `ghostferry`@`%`",
+		"GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `ghostferry`@`%`",
+		"GRANT SELECT, LOCK TABLES ON `gftest`.* TO `ghostferry`@`%`",
+		"GRANT SELECT ON `other`.`table1` TO `ghostferry`@`%`",
+	}
+	required := []string{"SELECT", "LOCK TABLES", "REPLICATION SLAVE", "REPLICATION CLIENT"}
+
+	this.Require().Empty(ghostferry.MissingPrivileges(grants, required, []string{"gftest"}))
+	this.Require().Equal([]string{"SELECT", "LOCK TABLES"}, ghostferry.MissingPrivileges(grants, required, []string{"gftest", "other"}))
+
+	// without databases, the privileges must be granted globally
+	this.Require().Equal([]string{"SELECT", "LOCK TABLES"}, ghostferry.MissingPrivileges(grants, required, nil))
+}
+
+func (this *PreflightTestSuite) TestMissingPrivilegesOnDatabasePatterns() {
+	grants := []string{
+		"GRANT SELECT ON `gf%`.* TO `ghostferry`@`%`",
+		"GRANT INSERT ON `shop\\_1`.* TO `ghostferry`@`%`",
+		"GRANT UPDATE ON `shop_`.* TO `ghostferry`@`%`",
+	}
+
+	this.Require().Empty(ghostferry.MissingPrivileges(grants, []string{"SELECT"}, []string{"gftest", "gf_state"}))
+	this.Require().Equal([]string{"SELECT"}, ghostferry.MissingPrivileges(grants, []string{"SELECT"}, []string{"shop_1"}))
+
+	// the escaped _ is not a wildcard, unlike the unescaped one
+	this.Require().Empty(ghostferry.MissingPrivileges(grants, []string{"INSERT"}, []string{"shop_1"}))
+	this.Require().Equal([]string{"INSERT"}, ghostferry.MissingPrivileges(grants, []string{"INSERT"}, []string{"shop11"}))
+	this.Require().Empty(ghostferry.MissingPrivileges(grants, []string{"UPDATE"}, []string{"shop1", "shop2"}))
+}
+
+func (this *PreflightTestSuite) TestAllPrivilegesGrantsEverything() {
+	grants := []string{"GRANT ALL PRIVILEGES ON *.* TO 'ghostferry'@'%' WITH GRANT OPTION"}
+
+	missing := ghostferry.MissingPrivileges(grants, []string{"SELECT", "REPLICATION CLIENT"}, []string{"gftest"})
+	this.Require().Empty(missing)
+
+	// on a database, the administrative privileges are not granted
+	grants = []string{"GRANT ALL PRIVILEGES ON `gftest`.* TO 'ghostferry'@'%'"}
+	missing = ghostferry.MissingPrivileges(grants, []string{"SELECT", "REPLICATION CLIENT"}, []string{"gftest"})
+	this.Require().Equal([]string{"REPLICATION CLIENT"}, missing)
+}
+
+func (this *PreflightTestSuite) TestExcessivePrivileges() {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `ghostferry`@`%`",
+		"GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `ghostferry`@`%`",
+		"GRANT UPDATE, INSERT (`id`, `data`) ON `gftest`.`table1` TO `ghostferry`@`%`",
+	}
+
+	excessive := ghostferry.ExcessivePrivileges(grants, []string{"SELECT", "REPLICATION SLAVE", "REPLICATION CLIENT"})
+	this.Require().Equal([]string{"INSERT", "UPDATE"}, excessive)
+
+	excessive = ghostferry.ExcessivePrivileges(grants[:2], []string{"SELECT", "REPLICATION SLAVE", "REPLICATION CLIENT"})
+	this.Require().Empty(excessive)
+
+	grants = []string{"GRANT ALL PRIVILEGES ON *.* TO 'ghostferry'@'%' WITH GRANT OPTION"}
+	excessive = ghostferry.ExcessivePrivileges(grants, []string{"SELECT"})
+	this.Require().Equal([]string{"ALL PRIVILEGES"}, excessive)
+}
+
+func (this *PreflightTestSuite) TestPrivilegesOfRoles() {
+	// SHOW GRANTS ... USING lists the privileges of the roles along with the
+	// roles granted
+	grants := []string{
+		"GRANT USAGE ON *.* TO `ghostferry`@`%`",
+		"GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `ghostferry`@`%`",
+		"GRANT `ghostferry_source`@`%`,`readers`@`%` TO `ghostferry`@`%`",
+	}
+
+	required := []string{"SELECT", "REPLICATION SLAVE", "REPLICATION CLIENT"}
+	this.Require().Empty(ghostferry.MissingPrivileges(grants, required, []string{"gftest"}))
+	this.Require().Empty(ghostferry.ExcessivePrivileges(grants, required))
+}
+
+func (this *PreflightTestSuite) TestReportFailsOnlyOnFailedChecks() {
+	report := &ghostferry.PreflightReport{
+		Results: []ghostferry.PreflightCheckResult{
+			{Name: "binlog_format", Status: ghostferry.PreflightPass, Message: "ROW"},
+			{Name: "time zone", Status: ghostferry.PreflightWarn, Message: "differs", Remediation: "align them"},
+		},
+	}
+	this.Require().True(report.Passed())
+	this.Require().Contains(report.String(), "[WARN] time zone: differs\n       hint: align them\n")
+
+	report.Results = append(report.Results, ghostferry.PreflightCheckResult{Name: "target grants", Status: ghostferry.PreflightFail, Message: "missing privileges: INSERT"})
+	this.Require().False(report.Passed())
+	this.Require().Contains(report.String(), "preflight checks failed")
+}
+
+func (this *PreflightTestSuite) TestMySQL80ReservedIdentifiers() {
+	reserved := ghostferry.MySQL80ReservedIdentifiers([]string{"id", "rank", "Groups", "data", "window_size"})
+	this.Require().Equal([]string{"rank", "Groups"}, reserved)
+}
+
+func (this *PreflightTestSuite) TestMySQL80RemovedSQLModes() {
+	removed := ghostferry.MySQL80RemovedSQLModes("STRICT_TRANS_TABLES,no_auto_create_user, NO_ENGINE_SUBSTITUTION,MYSQL40")
+	this.Require().Equal([]string{"NO_AUTO_CREATE_USER", "MYSQL40"}, removed)
+
+	this.Require().Empty(ghostferry.MySQL80RemovedSQLModes(""))
+}
+
+func (this *PreflightTestSuite) TestNamedReport() {
+	report := &ghostferry.PreflightReport{
+		Name:    "cutover",
+		Results: []ghostferry.PreflightCheckResult{{Name: "foreign_writes", Status: ghostferry.PreflightFail, Message: "writes detected"}},
+	}
+	this.Require().Contains(report.String(), "cutover checks failed")
+}
+
+func (this *PreflightTestSuite) TestCutoverValidationConfig() {
+	config := &ghostferry.CutoverValidationConfig{Enabled: true, SkipChecks: []string{ghostferry.CutoverCheckAutoIncrement, ghostferry.CutoverCheckTriggers}}
+	this.Require().Nil(config.Validate())
+
+	config.SkipChecks = append(config.SkipChecks, "row_count")
+	err := config.Validate()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "unknown check row_count")
+}
+
+func TestPreflight(t *testing.T) {
+	suite.Run(t, new(PreflightTestSuite))
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProgressDisplayTestSuite struct {
+	suite.Suite
+
+	display  *ghostferry.ProgressDisplay
+	progress *ghostferry.Progress
+}
+
+func (this *ProgressDisplayTestSuite) SetupTest() {
+	this.display = ghostferry.NewProgressDisplay(nil, nil)
+	this.progress = &ghostferry.Progress{
+		CurrentState:            "copying",
+		PaginationKeysPerSecond: 1234,
+		BinlogStreamerLag:       2,
+		Throttled:               true,
+		Tables: map[string]ghostferry.TableProgress{
+			"db.b_table": ghostferry.TableProgress{CurrentAction: ghostferry.TableActionCopying, Completion: 0.5},
+			"db.a_table": ghostferry.TableProgress{CurrentAction: ghostferry.TableActionCompleted, Completion: 1},
+			"db.c_table": ghostferry.TableProgress{CurrentAction: ghostferry.TableActionCopying, Completion: -1},
+		},
+	}
+}
+
+func (this *ProgressDisplayTestSuite) TestRenderShowsSummary() {
+	output := this.display.Render(this.progress)
+
+	this.Require().Contains(output, "copying")
+	this.Require().Contains(output, "Rows/sec:    1234")
+	this.Require().Contains(output, "Binlog lag:  2s")
+	this.Require().Contains(output, "Throttle:    throttled")
+	this.Require().NotContains(output, "Recent errors")
+}
+
+func (this *ProgressDisplayTestSuite) TestRenderShowsTablesInOrder() {
+	output := this.display.Render(this.progress)
+
+	this.Require().Contains(output, "db.a_table [##############################] 100% completed")
+	this.Require().Contains(output, "db.b_table [###############               ]  50% copying")
+	this.Require().Contains(output, "db.c_table [??????????????????????????????]    ?% copying")
+	this.Require().True(strings.Index(output, "db.a_table") < strings.Index(output, "db.b_table"))
+	this.Require().True(strings.Index(output, "db.b_table") < strings.Index(output, "db.c_table"))
+}
+
+func (this *ProgressDisplayTestSuite) TestRenderShowsMostRecentErrors() {
+	for i := 0; i < 7; i++ {
+		entry := logrus.WithError(errors.New("boom"))
+		entry.Message = string(rune('a' + i))
+		this.Require().Nil(this.display.Fire(entry))
+	}
+
+	output := this.display.Render(this.progress)
+
+	this.Require().Contains(output, "Recent errors")
+	this.Require().NotContains(output, " b: boom")
+	this.Require().Contains(output, " c: boom")
+	this.Require().Contains(output, " g: boom")
+}
+
+func TestProgressDisplay(t *testing.T) {
+	suite.Run(t, new(ProgressDisplayTestSuite))
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+const ProgressHistorySchemaName = "gftest_progress_history"
+
+type ProgressHistoryTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	history *ghostferry.ProgressHistory
+}
+
+func (this *ProgressHistoryTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.resetDbs()
+
+	config := &ghostferry.ProgressHistoryConfig{Interval: "1h", MaxRows: 2}
+	this.Require().Nil(config.Validate())
+
+	this.history = &ghostferry.ProgressHistory{
+		Config:   config,
+		DB:       this.Ferry.TargetDB,
+		Database: ProgressHistorySchemaName,
+		Table:    "_ghostferry_1__progress_history",
+	}
+	this.Require().Nil(this.history.Initialize())
+}
+
+func (this *ProgressHistoryTestSuite) TearDownTest() {
+	this.resetDbs()
+	this.GhostferryUnitTestSuite.TearDownTest()
+}
+
+func (this *ProgressHistoryTestSuite) resetDbs() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", ProgressHistorySchemaName))
+	this.Require().Nil(err)
+}
+
+func (this *ProgressHistoryTestSuite) TestRecordsAndRotatesSnapshots() {
+	for i := 1; i <= 3; i++ {
+		progress := &ghostferry.Progress{
+			CurrentState:            ghostferry.StateCopying,
+			PaginationKeysPerSecond: uint64(i * 100),
+		}
+		this.Require().Nil(this.history.Record(progress))
+	}
+
+	snapshots, err := this.history.Snapshots()
+	this.Require().Nil(err)
+	this.Require().Equal(2, len(snapshots))
+	this.Require().Equal(uint64(200), snapshots[0].Progress.PaginationKeysPerSecond)
+	this.Require().Equal(uint64(300), snapshots[1].Progress.PaginationKeysPerSecond)
+	this.Require().Equal(ghostferry.StateCopying, snapshots[1].Progress.CurrentState)
+	this.Require().False(snapshots[1].RecordedAt.IsZero())
+}
+
+func (this *ProgressHistoryTestSuite) TestKeepsHistoryOfPreviousRun() {
+	this.Require().Nil(this.history.Record(&ghostferry.Progress{CurrentState: ghostferry.StateCopying}))
+
+	// a resumed run finds the table created by the previous run
+	this.Require().Nil(this.history.Initialize())
+
+	snapshots, err := this.history.Snapshots()
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(snapshots))
+}
+
+func (this *ProgressHistoryTestSuite) TestValidatesConfig() {
+	config := &ghostferry.ProgressHistoryConfig{Interval: "1m"}
+	this.Require().True(config.Enabled())
+	this.Require().Nil(config.Validate())
+	this.Require().Equal(10080, config.MaxRows)
+
+	config = &ghostferry.ProgressHistoryConfig{Interval: "-1m"}
+	this.Require().NotNil(config.Validate())
+}
+
+func TestProgressHistory(t *testing.T) {
+	suite.Run(t, &ProgressHistoryTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -61,6 +61,129 @@ func (this *QueryAnalyzerTestSuite) TestParseRevokeStatementWithGrantOption() {
 	this.Require().Equal(len(events), 0)
 }
 
+func (this *QueryAnalyzerTestSuite) TestParseTransactionControlStatement() {
+	statements := map[string]string{
+		"XA START 'xid1'":                     ghostferry.TransactionControlXAStart,
+		"XA END 'xid1'":                       ghostferry.TransactionControlXAEnd,
+		"xa prepare 'xid1'":                   ghostferry.TransactionControlXAPrepare,
+		"XA COMMIT 'xid1' ONE PHASE":          ghostferry.TransactionControlXACommit,
+		"XA ROLLBACK X'78696431',X'',1":       ghostferry.TransactionControlXARollback,
+		"SAVEPOINT `sp1`":                     ghostferry.TransactionControlSavepoint,
+		"ROLLBACK TO `sp1`":                   ghostferry.TransactionControlRollbackToSavepoint,
+		"ROLLBACK WORK TO SAVEPOINT `sp1`":    ghostferry.TransactionControlRollbackToSavepoint,
+		"RELEASE SAVEPOINT `sp1`":             ghostferry.TransactionControlReleaseSavepoint,
+		"ROLLBACK":                            "",
+		"BEGIN":                               "",
+		"CREATE TABLE `savepoint` (`id` int)": "",
+	}
+
+	for statement, expected := range statements {
+		this.Require().Equal(expected, ghostferry.ParseTransactionControlStatement(statement), statement)
+	}
+}
+
+func (this *QueryAnalyzerTestSuite) TestParseTransactionControlStatementHasNoSchemaChanges() {
+	events, err := this.QueryAnalyzer.ParseSchemaChanges("XA COMMIT 'xid1'", "")
+	this.Require().Nil(err)
+	this.Require().Equal(len(events), 0)
+}
+
+func (this *QueryAnalyzerTestSuite) TestParseTemporaryTableStatement() {
+	events, err := this.QueryAnalyzer.ParseSchemaChanges("CREATE TEMPORARY TABLE `tmp` (`id` int)", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(len(events), 0)
+
+	events, err = this.QueryAnalyzer.ParseSchemaChanges("DROP TEMPORARY TABLE IF EXISTS `tmp`", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(len(events), 0)
+
+	events, err = this.QueryAnalyzer.ParseSchemaChanges("CREATE TABLE `temporary` (`id` int)", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(len(events), 1)
+}
+
+func (this *QueryAnalyzerTestSuite) TestIsIgnoredSchemaChangeTable() {
+	this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("mysql", "user")))
+	this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("performance_schema", "threads")))
+	this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("sys", "version")))
+	this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", "_users_gho")))
+	this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", "_users_new")))
+	this.Require().False(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", "users")))
+	this.Require().False(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", "users_new")))
+}
+
+func (this *QueryAnalyzerTestSuite) TestIsIgnoredSchemaChangeTableMatchesTheHelperTablesOfTheTools() {
+	for _, table := range []string{"_users_gho", "_users_ghc", "_users_del", "_users_20240102030405_del", "_users_new", "_users_old", "__users_new", "_order_items_gho"} {
+		this.Require().True(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", table)), table)
+	}
+
+	for _, table := range []string{"_gho", "__new", "_users_gho2", "_users_ghost", "users_del", "_users_older"} {
+		this.Require().False(ghostferry.IsIgnoredSchemaChangeTable(ghostferry.NewQualifiedTableName("dbname", table)), table)
+	}
+}
+
+func (this *QueryAnalyzerTestSuite) TestParseSchemaChangesOfHelperTables() {
+	events, err := this.QueryAnalyzer.ParseSchemaChanges("CREATE TABLE `_users_ghc` (`id` int)", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(0, len(events))
+
+	// the rename of the cut-over changes a copied table
+	events, err = this.QueryAnalyzer.ParseSchemaChanges("RENAME TABLE `users` TO `_users_del`, `_users_gho` TO `users`", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(2, len(events))
+
+	events, err = this.QueryAnalyzer.ParseSchemaChanges("CREATE TABLE `_gho` (`id` int)", "dbname")
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(events))
+}
+
+func (this *QueryAnalyzerTestSuite) TestParseOnlineSchemaChange() {
+	change, err := this.QueryAnalyzer.ParseOnlineSchemaChange("CREATE TABLE `dbname`.`_users_gho` LIKE `dbname`.`users`", "")
+	this.Require().Nil(err)
+	this.Require().Equal(&ghostferry.OnlineSchemaChange{
+		Tool:        ghostferry.OnlineSchemaChangeToolGhost,
+		Phase:       ghostferry.OnlineSchemaChangeStarted,
+		Table:       ghostferry.NewQualifiedTableName("dbname", "users"),
+		HelperTable: ghostferry.NewQualifiedTableName("dbname", "_users_gho"),
+	}, change)
+
+	change, err = this.QueryAnalyzer.ParseOnlineSchemaChange("alter /* gh-ost */ table `dbname`.`_users_gho` add column `data` int", "")
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.OnlineSchemaChangeAltered, change.Phase)
+	this.Require().Equal("add column `data` int", change.AlterClause)
+
+	change, err = this.QueryAnalyzer.ParseOnlineSchemaChange("RENAME TABLE `dbname`.`users` TO `dbname`.`_users_old`, `dbname`.`_users_new` TO `dbname`.`users`", "")
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.OnlineSchemaChangeToolPtOsc, change.Tool)
+	this.Require().Equal(ghostferry.OnlineSchemaChangeCutOver, change.Phase)
+	this.Require().Equal(ghostferry.NewQualifiedTableName("dbname", "users"), change.Table)
+}
+
+func (this *QueryAnalyzerTestSuite) TestParseOnlineSchemaChangeIgnoresOtherStatements() {
+	change, err := this.QueryAnalyzer.ParseOnlineSchemaChange("ALTER TABLE `dbname`.`users_new` ADD COLUMN `data` int", "")
+	this.Require().Nil(err)
+	this.Require().Nil(change)
+}
+
+func (this *QueryAnalyzerTestSuite) TestDDLStatementClass() {
+	statements := map[string]string{
+		"DROP TABLE IF EXISTS `t`":                  ghostferry.DDLClassDropTable,
+		"drop database `db`":                        "",
+		"DROP SCHEMA db":                            "",
+		"TRUNCATE `t`":                              ghostferry.DDLClassTruncate,
+		"TRUNCATE TABLE `t`":                        ghostferry.DDLClassTruncate,
+		"RENAME TABLE `a` TO `b`":                   ghostferry.DDLClassRenameTable,
+		"ALTER IGNORE TABLE `t` ADD KEY (a)":        ghostferry.DDLClassAlterTable,
+		"CREATE TABLE `t` (`id` int)":               ghostferry.DDLClassCreateTable,
+		"CREATE INDEX `idx` ON `t` (`id`)":          "",
+		"ALTER DATABASE `db` CHARACTER SET utf8mb4": "",
+	}
+
+	for statement, expected := range statements {
+		this.Require().Equal(expected, ghostferry.DDLStatementClass(statement), statement)
+	}
+}
+
 func TestQueryAnalyzer(t *testing.T) {
 	suite.Run(t, new(QueryAnalyzerTestSuite))
 }
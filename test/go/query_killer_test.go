@@ -0,0 +1,111 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/stretchr/testify/suite"
+)
+
+type QueryKillerTestSuite struct {
+	suite.Suite
+
+	throttler *ghostferry.PauserThrottler
+	killer    *ghostferry.QueryKiller
+	killed    []uint64
+}
+
+func (this *QueryKillerTestSuite) SetupTest() {
+	config := &ghostferry.QueryKillerConfig{ThrottledFor: "10s"}
+	this.Require().Nil(config.Validate())
+
+	this.throttler = &ghostferry.PauserThrottler{}
+	this.killed = nil
+	this.killer = &ghostferry.QueryKiller{
+		Config:    config,
+		Throttler: this.throttler,
+		Registry:  sqlwrapper.NewQueryRegistry(),
+		Kill: func(connectionId uint64) error {
+			this.killed = append(this.killed, connectionId)
+			return nil
+		},
+	}
+}
+
+func (this *QueryKillerTestSuite) TestKillsQueriesOnceThrottledForLongEnough() {
+	now := time.Now()
+	untrack := this.killer.Registry.Add(sqlwrapper.RunningQuery{ConnectionId: 42, StartedAt: now})
+	this.killer.Registry.Add(sqlwrapper.RunningQuery{ConnectionId: 43, StartedAt: now.Add(-time.Second)})
+
+	this.Require().Equal(0, this.killer.Check(now))
+
+	this.throttler.SetPaused(true)
+	this.Require().Equal(0, this.killer.Check(now.Add(time.Second)))
+	this.Require().Equal(0, this.killer.Check(now.Add(10*time.Second)))
+	this.Require().Equal(2, this.killer.Check(now.Add(11*time.Second)))
+	this.Require().Equal([]uint64{43, 42}, this.killed)
+
+	untrack()
+	this.Require().Equal(1, this.killer.Check(now.Add(12*time.Second)))
+}
+
+func (this *QueryKillerTestSuite) TestRestartsThresholdWhenThrottlingEnds() {
+	now := time.Now()
+	this.killer.Registry.Add(sqlwrapper.RunningQuery{ConnectionId: 42, StartedAt: now})
+
+	this.throttler.SetPaused(true)
+	this.Require().Equal(0, this.killer.Check(now))
+
+	this.throttler.SetPaused(false)
+	this.Require().Equal(0, this.killer.Check(now.Add(5*time.Second)))
+
+	this.throttler.SetPaused(true)
+	this.Require().Equal(0, this.killer.Check(now.Add(11*time.Second)))
+	this.Require().Equal(1, this.killer.Check(now.Add(21*time.Second)))
+}
+
+func (this *QueryKillerTestSuite) TestKeepsQueriesTrackedWhileKilling() {
+	now := time.Now()
+	untrack := this.killer.Registry.Add(sqlwrapper.RunningQuery{ConnectionId: 42, StartedAt: now})
+
+	untracked := make(chan struct{})
+	this.killer.Kill = func(connectionId uint64) error {
+		go func() {
+			untrack()
+			close(untracked)
+		}()
+
+		select {
+		case <-untracked:
+			this.Fail("query untracked while it was being killed")
+		case <-time.After(50 * time.Millisecond):
+		}
+		return nil
+	}
+
+	this.throttler.SetPaused(true)
+	this.killer.Check(now)
+	this.Require().Equal(1, this.killer.Check(now.Add(11*time.Second)))
+
+	<-untracked
+	this.Require().Empty(this.killer.Registry.Running())
+}
+
+func (this *QueryKillerTestSuite) TestValidatesConfig() {
+	config := &ghostferry.QueryKillerConfig{}
+	this.Require().False(config.Enabled())
+
+	config.ThrottledFor = "1m"
+	this.Require().True(config.Enabled())
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("1s", config.CheckInterval)
+
+	config.ThrottledFor = "soon"
+	this.Require().NotNil(config.Validate())
+}
+
+func TestQueryKiller(t *testing.T) {
+	suite.Run(t, new(QueryKillerTestSuite))
+}
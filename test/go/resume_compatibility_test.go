@@ -0,0 +1,67 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+)
+
+type ResumeCompatibilityTestSuite struct {
+	suite.Suite
+
+	ferry *ghostferry.Ferry
+}
+
+func (this *ResumeCompatibilityTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{
+			DatabaseRewrites: map[string]string{"gftest": "gftest_target"},
+			TableFilter: copydb.NewStaticTableFilter(
+				copydb.FilterAndRewriteConfigs{Whitelist: []string{"gftest"}},
+				copydb.FilterAndRewriteConfigs{},
+			),
+		},
+	}
+}
+
+func (this *ResumeCompatibilityTestSuite) fingerprint() map[string]string {
+	fingerprint, err := this.ferry.ConfigFingerprint()
+	this.Require().Nil(err)
+	return fingerprint
+}
+
+func (this *ResumeCompatibilityTestSuite) TestFingerprintIsStable() {
+	fingerprint := this.fingerprint()
+	this.Require().Contains(fingerprint, "TableFilter")
+	this.Require().NotContains(fingerprint, "CopyFilter")
+	this.Require().Equal(fingerprint, this.fingerprint())
+
+	this.ferry.Config.TableRewrites = map[string]string{}
+	this.Require().Nil(this.ferry.CheckConfigFingerprint(fingerprint, this.fingerprint()))
+}
+
+func (this *ResumeCompatibilityTestSuite) TestFailsOnChangedConfig() {
+	fingerprint := this.fingerprint()
+
+	this.ferry.Config.DatabaseRewrites = map[string]string{"gftest": "other_target"}
+	this.ferry.Config.TableFilter = copydb.NewStaticTableFilter(
+		copydb.FilterAndRewriteConfigs{Whitelist: []string{"gftest", "gftest2"}},
+		copydb.FilterAndRewriteConfigs{},
+	)
+	err := this.ferry.CheckConfigFingerprint(fingerprint, this.fingerprint())
+	this.Require().EqualError(err, "config differs from the config the resumed run was started with: DatabaseRewrites, TableFilter")
+
+	this.ferry.Config.ResumeConfigMismatchPolicy = ghostferry.ResumeConfigMismatchPolicyWarn
+	this.Require().Nil(this.ferry.CheckConfigFingerprint(fingerprint, this.fingerprint()))
+}
+
+func (this *ResumeCompatibilityTestSuite) TestStatesWithoutFingerprintAreNotChecked() {
+	this.Require().Nil(this.ferry.CheckConfigFingerprint(nil, this.fingerprint()))
+}
+
+func TestResumeCompatibility(t *testing.T) {
+	suite.Run(t, new(ResumeCompatibilityTestSuite))
+}
@@ -87,6 +87,29 @@ func (this *RowBatchTestSuite) TestRowBatchWithWrongColumnsReturnsError() {
 	this.Require().Contains(err.Error(), "test_table has 3 columns but event has 1 column")
 }
 
+func (this *RowBatchTestSuite) TestRowBatchReadBeforeSchemaChangeLeavesAddedColumnsToDefaults() {
+	vals := []ghostferry.RowData{
+		ghostferry.RowData{1000, []byte("val0"), true},
+		ghostferry.RowData{1001, []byte("val1"), false},
+	}
+	batch := ghostferry.NewDataRowBatch(this.sourceTable, vals)
+
+	// a schema change adding a column and dropping another is applied
+	// while the batch is in flight
+	this.sourceTable.Table = &schema.Table{
+		Schema:  "test_schema",
+		Name:    "test_table",
+		Columns: []schema.TableColumn{{Name: "col1"}, {Name: "col4"}, {Name: "col3"}},
+	}
+
+	q, v, err := batch.AsSQLQuery(this.targetTable.Schema, this.targetTable.Name)
+	this.Require().Nil(err)
+	this.Require().Equal("INSERT IGNORE INTO `target_schema`.`target_table` (`col1`,`col3`) VALUES (?,?),(?,?)", q)
+	this.Require().Equal([]interface{}{1000, true, 1001, false}, v)
+	this.Require().Equal(3, len(batch.ReadTableSchema().Columns))
+	this.Require().Equal("col2", batch.ReadTableSchema().Columns[1].Name)
+}
+
 func (this *RowBatchTestSuite) TestRowBatchMetadata() {
 	vals := []ghostferry.RowData{
 		ghostferry.RowData{1000},
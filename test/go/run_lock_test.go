@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type RunLockTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	name string
+}
+
+func (this *RunLockTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.name = ghostferry.DefaultRunLockName(this.Ferry.Source, this.Ferry.Target)
+}
+
+func (this *RunLockTestSuite) TestPreventsConcurrentRuns() {
+	lock, err := ghostferry.AcquireRunLock(this.Ferry.TargetDB, this.name, nil)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.AcquireRunLock(this.Ferry.TargetDB, this.name, nil)
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "another ghostferry is running")
+
+	this.Require().Nil(lock.Release())
+
+	lock, err = ghostferry.AcquireRunLock(this.Ferry.TargetDB, this.name, nil)
+	this.Require().Nil(err)
+	this.Require().Nil(lock.Release())
+	this.Require().Nil(lock.Release())
+}
+
+func (this *RunLockTestSuite) TestChecksTheLockIsStillHeld() {
+	lock, err := ghostferry.AcquireRunLock(this.Ferry.TargetDB, this.name, nil)
+	this.Require().Nil(err)
+	this.Require().Nil(lock.Check(context.Background()))
+
+	this.killHolder()
+	err = lock.Check(context.Background())
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "lost the connection holding run lock")
+
+	lock.Release()
+	this.Require().EqualError(lock.Check(context.Background()), fmt.Sprintf("run lock %s was released", this.name))
+}
+
+func (this *RunLockTestSuite) TestRunAbortsOnceTheLockIsLost() {
+	lock, err := ghostferry.AcquireRunLock(this.Ferry.TargetDB, this.name, nil)
+	this.Require().Nil(err)
+	defer lock.Release()
+
+	errorHandler := &testhelpers.ErrorHandler{}
+	lock.CheckInterval = 10 * time.Millisecond
+	lock.ErrorHandler = errorHandler
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lock.Run(context.Background())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	this.Require().Nil(errorHandler.LastError)
+
+	this.killHolder()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		this.FailNow("the run was not aborted once the lock was lost")
+	}
+	this.Require().NotNil(errorHandler.LastError)
+	this.Require().Contains(errorHandler.LastError.Error(), "lost the connection holding run lock")
+}
+
+// killHolder kills the connection holding the lock, which releases it
+func (this *RunLockTestSuite) killHolder() {
+	var holder int64
+	this.Require().Nil(this.Ferry.TargetDB.QueryRow("SELECT IS_USED_LOCK(?)", this.name).Scan(&holder))
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("KILL %d", holder))
+	this.Require().Nil(err)
+}
+
+func (this *RunLockTestSuite) TestDefaultNameFitsMySQLLimit() {
+	this.Require().True(len(this.name) <= 64)
+
+	otherTarget := *this.Ferry.Target
+	otherTarget.Port += 1
+	this.Require().NotEqual(this.name, ghostferry.DefaultRunLockName(this.Ferry.Source, &otherTarget))
+}
+
+func (this *RunLockTestSuite) TestValidatesName() {
+	config := &ghostferry.RunLockConfig{Enabled: true, Name: "ghostferry"}
+	this.Require().Nil(config.Validate())
+
+	config.Name = "ghostferry_0123456789012345678901234567890123456789012345678901234567890123456789"
+	this.Require().NotNil(config.Validate())
+}
+
+func (this *RunLockTestSuite) TestValidatesCheckInterval() {
+	config := &ghostferry.RunLockConfig{Enabled: true}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("10s", config.CheckInterval)
+
+	config.CheckInterval = "0s"
+	this.Require().EqualError(config.Validate(), "invalid CheckInterval specified (set to 0s)")
+}
+
+func TestRunLock(t *testing.T) {
+	suite.Run(t, &RunLockTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type SamplingVerifierTestSuite struct {
+	suite.Suite
+}
+
+func (this *SamplingVerifierTestSuite) TestMismatchRateInterval() {
+	rate, lower, upper := ghostferry.MismatchRateInterval(10, 100, 0.95)
+	this.Require().Equal(0.1, rate)
+	this.Require().InDelta(0.0552, lower, 0.0001)
+	this.Require().InDelta(0.1744, upper, 0.0001)
+
+	// a higher confidence level widens the interval
+	_, lower, upper = ghostferry.MismatchRateInterval(10, 100, 0.99)
+	this.Require().InDelta(0.0460, lower, 0.0001)
+	this.Require().InDelta(0.2038, upper, 0.0001)
+}
+
+func (this *SamplingVerifierTestSuite) TestMismatchRateIntervalWithoutMismatches() {
+	rate, lower, upper := ghostferry.MismatchRateInterval(0, 100, 0.95)
+	this.Require().Equal(0.0, rate)
+	this.Require().Equal(0.0, lower)
+	this.Require().InDelta(0.0370, upper, 0.0001)
+
+	// more verified rows narrow the interval
+	_, _, narrowerUpper := ghostferry.MismatchRateInterval(0, 10000, 0.95)
+	this.Require().True(narrowerUpper < upper)
+}
+
+func (this *SamplingVerifierTestSuite) TestMismatchRateIntervalOnlyMismatches() {
+	rate, lower, upper := ghostferry.MismatchRateInterval(100, 100, 0.95)
+	this.Require().Equal(1.0, rate)
+	this.Require().InDelta(0.9630, lower, 0.0001)
+	this.Require().Equal(1.0, upper)
+}
+
+func (this *SamplingVerifierTestSuite) TestMismatchRateIntervalWithoutRows() {
+	rate, lower, upper := ghostferry.MismatchRateInterval(0, 0, 0.95)
+	this.Require().Equal(0.0, rate)
+	this.Require().Equal(0.0, lower)
+	this.Require().Equal(1.0, upper)
+}
+
+func (this *SamplingVerifierTestSuite) TestSampleRangeIndicesOfAllRanges() {
+	rng := rand.New(rand.NewSource(42))
+	this.Require().Equal([]uint64{0, 1, 2, 3}, ghostferry.SampleRangeIndices(rng, 4, 4))
+	this.Require().Equal([]uint64{0, 1, 2}, ghostferry.SampleRangeIndices(rng, 3, 10))
+	this.Require().Equal([]uint64{}, ghostferry.SampleRangeIndices(rng, 0, 0))
+}
+
+func (this *SamplingVerifierTestSuite) TestSampleRangeIndices() {
+	rng := rand.New(rand.NewSource(42))
+	for _, count := range []uint64{100, 1 << 30} {
+		indices := ghostferry.SampleRangeIndices(rng, count, 10)
+		this.requireDistinctSortedIndices(indices, count, 10)
+	}
+
+	// the indices are picked at random
+	first := ghostferry.SampleRangeIndices(rng, 100, 10)
+	second := ghostferry.SampleRangeIndices(rng, 100, 10)
+	this.Require().NotEqual(first, second)
+
+	// and reproduced with the same seed
+	first = ghostferry.SampleRangeIndices(rand.New(rand.NewSource(7)), 100, 10)
+	second = ghostferry.SampleRangeIndices(rand.New(rand.NewSource(7)), 100, 10)
+	this.Require().Equal(first, second)
+}
+
+func (this *SamplingVerifierTestSuite) requireDistinctSortedIndices(indices []uint64, count, sampled uint64) {
+	this.Require().Equal(int(sampled), len(indices))
+	this.Require().True(sort.SliceIsSorted(indices, func(i, j int) bool { return indices[i] < indices[j] }))
+	for i, index := range indices {
+		this.Require().True(index < count)
+		if i > 0 {
+			this.Require().NotEqual(indices[i-1], index)
+		}
+	}
+}
+
+func TestSamplingVerifier(t *testing.T) {
+	suite.Run(t, new(SamplingVerifierTestSuite))
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchemaDriftTestSuite struct {
+	suite.Suite
+
+	source *ghostferry.TableDefinition
+	target *ghostferry.TableDefinition
+}
+
+func newTableDefinition() *ghostferry.TableDefinition {
+	return &ghostferry.TableDefinition{
+		ColumnOrder: []string{"id", "data"},
+		Columns: map[string]ghostferry.ColumnDefinition{
+			"id":   ghostferry.ColumnDefinition{Type: "bigint(20)"},
+			"data": ghostferry.ColumnDefinition{Type: "varchar(255)", Charset: "utf8mb4", Nullable: true},
+		},
+		Indexes: map[string]ghostferry.IndexDefinition{
+			"PRIMARY": ghostferry.IndexDefinition{Unique: true, Columns: []string{"id"}},
+		},
+	}
+}
+
+func (this *SchemaDriftTestSuite) SetupTest() {
+	this.source = newTableDefinition()
+	this.target = newTableDefinition()
+}
+
+func (this *SchemaDriftTestSuite) TestIdenticalDefinitionsHaveNoDifferences() {
+	this.Require().Empty(ghostferry.DiffTableDefinitions(this.source, this.target))
+}
+
+func (this *SchemaDriftTestSuite) TestColumnDifferences() {
+	this.target.Columns["data"] = ghostferry.ColumnDefinition{Type: "varchar(64)", Charset: "latin1", Nullable: false}
+	this.target.ColumnOrder = append(this.target.ColumnOrder, "extra")
+	this.target.Columns["extra"] = ghostferry.ColumnDefinition{Type: "int(11)"}
+
+	this.Require().Equal([]string{
+		"column data has type varchar(255) on source but varchar(64) on target",
+		"column data has charset utf8mb4 on source but latin1 on target",
+		"column data is nullable=true on source but nullable=false on target",
+		"column extra missing on source",
+	}, ghostferry.DiffTableDefinitions(this.source, this.target))
+}
+
+func (this *SchemaDriftTestSuite) TestMissingColumn() {
+	this.target.ColumnOrder = []string{"id"}
+	delete(this.target.Columns, "data")
+
+	this.Require().Equal([]string{"column data missing on target"}, ghostferry.DiffTableDefinitions(this.source, this.target))
+}
+
+func (this *SchemaDriftTestSuite) TestKeyDifferences() {
+	this.source.Indexes["data_idx"] = ghostferry.IndexDefinition{Columns: []string{"data"}}
+	this.target.Indexes["PRIMARY"] = ghostferry.IndexDefinition{Unique: true, Columns: []string{"id", "data"}}
+	this.target.Indexes["other_idx"] = ghostferry.IndexDefinition{Columns: []string{"data"}}
+
+	this.Require().Equal([]string{
+		"key PRIMARY is UNIQUE KEY (id) on source but UNIQUE KEY (id, data) on target",
+		"key data_idx missing on target",
+		"key other_idx missing on source",
+	}, ghostferry.DiffTableDefinitions(this.source, this.target))
+}
+
+func TestSchemaDrift(t *testing.T) {
+	suite.Run(t, new(SchemaDriftTestSuite))
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type SizingReportTestSuite struct {
+	suite.Suite
+
+	config *ghostferry.SizingConfig
+}
+
+func (this *SizingReportTestSuite) SetupTest() {
+	this.config = &ghostferry.SizingConfig{BatchDuration: "1s", LargestTables: 2}
+	this.Require().Nil(this.config.Validate())
+}
+
+func (this *SizingReportTestSuite) TestSummarizesTables() {
+	report := ghostferry.NewSizingReport([]ghostferry.TableSizing{
+		{Table: "gftest.small", EstimatedRows: 10, DataBytes: 1024},
+		{Table: "gftest.large", EstimatedRows: 1000, DataBytes: 1024 * 1024},
+		{Table: "gftest.empty"},
+		{Table: "gftest.medium", EstimatedRows: 150, DataBytes: 16 * 1024},
+	}, 100, 2, this.config)
+
+	this.Require().Equal(4, report.Tables)
+	this.Require().Equal(uint64(1160), report.TotalRows)
+	this.Require().Equal(uint64(1024+1024*1024+16*1024), report.TotalBytes)
+	this.Require().Equal(uint64(1+10+1+2), report.Batches)
+
+	this.Require().Equal(2, len(report.LargestTables))
+	this.Require().Equal("gftest.large", report.LargestTables[0].Table)
+	this.Require().Equal("gftest.medium", report.LargestTables[1].Table)
+}
+
+func (this *SizingReportTestSuite) TestProjectsCopyTimeBoundByLargestTable() {
+	tables := []ghostferry.TableSizing{
+		{Table: "gftest.a", EstimatedRows: 400},
+		{Table: "gftest.b", EstimatedRows: 400},
+	}
+
+	report := ghostferry.NewSizingReport(tables, 100, 1, this.config)
+	this.Require().Equal(8.0, report.ProjectedCopyTime)
+
+	report = ghostferry.NewSizingReport(tables, 100, 2, this.config)
+	this.Require().Equal(4.0, report.ProjectedCopyTime)
+
+	// a table is not copied concurrently
+	report = ghostferry.NewSizingReport(tables, 100, 8, this.config)
+	this.Require().Equal(4.0, report.ProjectedCopyTime)
+}
+
+func (this *SizingReportTestSuite) TestValidatesConfig() {
+	config := &ghostferry.SizingConfig{}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("100ms", config.BatchDuration)
+	this.Require().Equal(5, config.LargestTables)
+
+	config = &ghostferry.SizingConfig{BatchDuration: "0s"}
+	this.Require().NotNil(config.Validate())
+}
+
+func TestSizingReport(t *testing.T) {
+	suite.Run(t, new(SizingReportTestSuite))
+}
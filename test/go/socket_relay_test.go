@@ -0,0 +1,139 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type SocketRelayTestSuite struct {
+	suite.Suite
+
+	dir      string
+	listener net.Listener
+	config   *ghostferry.DatabaseConfig
+}
+
+func (this *SocketRelayTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-socket")
+	this.Require().Nil(err)
+
+	socket := filepath.Join(this.dir, "mysqld.sock")
+	this.listener, err = net.Listen("unix", socket)
+	this.Require().Nil(err)
+
+	// greets each connection like a server sending its handshake
+	listener := this.listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	this.config = &ghostferry.DatabaseConfig{Socket: socket, User: "ghostferry"}
+}
+
+func (this *SocketRelayTestSuite) TearDownTest() {
+	this.config.CloseTunnel()
+	this.listener.Close()
+	os.RemoveAll(this.dir)
+}
+
+func (this *SocketRelayTestSuite) TestDialAddressRelaysToTheSocket() {
+	host, port, err := this.config.DialAddress()
+	this.Require().Nil(err)
+
+	// the binlog replication client connects to host:port, over a Unix
+	// socket as it contains a slash
+	address := relayAddress(host, port)
+	this.Require().Contains(address, "/")
+	conn, err := net.Dial("unix", address)
+	this.Require().Nil(err)
+	defer conn.Close()
+
+	greeting, err := ioutil.ReadAll(conn)
+	this.Require().Nil(err)
+	this.Require().Equal("hello", string(greeting))
+
+	// the relay is opened once
+	sameHost, _, err := this.config.DialAddress()
+	this.Require().Nil(err)
+	this.Require().Equal(host, sameHost)
+}
+
+func (this *SocketRelayTestSuite) TestRelaySocketIsPrivate() {
+	host, port, err := this.config.DialAddress()
+	this.Require().Nil(err)
+
+	info, err := os.Stat(relayAddress(host, port))
+	this.Require().Nil(err)
+	this.Require().Equal(os.FileMode(0600), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Dir(host))
+	this.Require().Nil(err)
+	this.Require().Equal(os.FileMode(0700), info.Mode().Perm())
+}
+
+func (this *SocketRelayTestSuite) TestRelayIsOpenedOnceConcurrently() {
+	hosts := make(chan string, 10)
+	for i := 0; i < cap(hosts); i++ {
+		go func() {
+			host, _, err := this.config.DialAddress()
+			this.Require().Nil(err)
+			hosts <- host
+		}()
+	}
+
+	host := <-hosts
+	for i := 1; i < cap(hosts); i++ {
+		this.Require().Equal(host, <-hosts)
+	}
+}
+
+func (this *SocketRelayTestSuite) TestCloseTunnelClosesTheRelay() {
+	host, port, err := this.config.DialAddress()
+	this.Require().Nil(err)
+	address := relayAddress(host, port)
+
+	this.Require().Nil(this.config.CloseTunnel())
+	_, err = net.Dial("unix", address)
+	this.Require().NotNil(err)
+	_, err = os.Stat(filepath.Dir(host))
+	this.Require().True(os.IsNotExist(err))
+
+	// the relay is opened again on the next use
+	host, port, err = this.config.DialAddress()
+	this.Require().Nil(err)
+	conn, err := net.Dial("unix", relayAddress(host, port))
+	this.Require().Nil(err)
+	conn.Close()
+}
+
+func (this *SocketRelayTestSuite) TestMySQLConfigConnectsToTheSocketDirectly() {
+	mysqlConfig, err := this.config.MySQLConfig()
+	this.Require().Nil(err)
+	this.Require().Equal("unix", mysqlConfig.Net)
+	this.Require().Equal(filepath.Join(this.dir, "mysqld.sock"), mysqlConfig.Addr)
+}
+
+// relayAddress returns the address the binlog replication client dials
+func relayAddress(host string, port uint16) string {
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+func TestSocketRelay(t *testing.T) {
+	suite.Run(t, new(SocketRelayTestSuite))
+}
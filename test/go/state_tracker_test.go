@@ -87,6 +87,14 @@ func (s *StateTrackerTestSuite) TestMinBinlogPosition() {
 	s.Require().Equal(serializedState.MinBinlogPosition().EventPosition, mysql.Position{"mysql-bin.00002", 10})
 }
 
+func (s *StateTrackerTestSuite) TestLastWrittenBinlogPosition() {
+	stateTracker := ghostferry.NewStateTracker(0)
+
+	pos := ghostferry.NewResumableBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(pos)
+	s.Require().Equal(pos, stateTracker.LastWrittenBinlogPosition())
+}
+
 func (s *StateTrackerTestSuite) TestSerializeStateInTargetDB() {
 	testFerry := s.TestFerry.Ferry
 	testFerry.ResumeStateFromDB = StateSchemaName
@@ -170,6 +178,245 @@ func (s *StateTrackerTestSuite) TestReadStateFromTargetDBContainingCorruptedKeyD
 	s.Require().EqualError(err, fmt.Sprintf("invalid character 'o' in literal null (expecting 'u')"))
 }
 
+func (s *StateTrackerTestSuite) TestDeltaCopyStateIsSerializedSeparately() {
+	position := mysql.Position{Name: "mysql-bin.000001", Pos: 4}
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("gftest.table1")
+
+	deltaCopy := stateTracker.DeltaCopyStateTracker("joined_tables", position)
+	s.Require().Equal(deltaCopy, stateTracker.DeltaCopyStateTracker("joined_tables", position))
+	s.Require().False(deltaCopy.IsTableComplete("gftest.table1"))
+	deltaCopy.MarkTableAsCompleted("gftest.table2")
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]bool{"gftest.table1": true}, state.CompletedTables)
+	s.Require().Equal(map[string]bool{"gftest.table2": true}, state.DeltaCopies["joined_tables"].CompletedTables)
+	s.Require().Equal(position, state.DeltaCopies["joined_tables"].SourcePosition)
+
+	resumedStateTracker, err := ghostferry.NewStateTrackerFromSerializedState(10, state, ghostferry.TableSchemaCache{})
+	s.Require().Nil(err)
+	resumedDeltaCopy := resumedStateTracker.DeltaCopyStateTracker("joined_tables", position)
+	s.Require().True(resumedDeltaCopy.IsTableComplete("gftest.table2"))
+	s.Require().False(resumedDeltaCopy.IsTableComplete("gftest.table1"))
+	s.Require().False(resumedStateTracker.DeltaCopyStateTracker("other", position).IsTableComplete("gftest.table2"))
+}
+
+func (s *StateTrackerTestSuite) TestDeltaCopyStartsOverOnceTheSourceMoved() {
+	position := mysql.Position{Name: "mysql-bin.000001", Pos: 4}
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.DeltaCopyStateTracker("joined_tables", position).MarkTableAsCompleted("gftest.table1")
+
+	resumedStateTracker, err := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil), ghostferry.TableSchemaCache{})
+	s.Require().Nil(err)
+
+	movedPosition := mysql.Position{Name: "mysql-bin.000001", Pos: 120}
+	deltaCopy := resumedStateTracker.DeltaCopyStateTracker("joined_tables", movedPosition)
+	s.Require().False(deltaCopy.IsTableComplete("gftest.table1"))
+	s.Require().Equal(movedPosition, resumedStateTracker.Serialize(nil, nil).DeltaCopies["joined_tables"].SourcePosition)
+}
+
+func (s *StateTrackerTestSuite) TestDroppedTargetTriggersAreSerialized() {
+	trigger1 := ghostferry.TargetTrigger{Schema: "gftest", Table: "table1", Name: "trigger1", Statement: "CREATE TRIGGER trigger1 ..."}
+	trigger2 := ghostferry.TargetTrigger{Schema: "gftest", Table: "table1", Name: "trigger2", Statement: "CREATE TRIGGER trigger2 ..."}
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Nil(stateTracker.Serialize(nil, nil).DroppedTargetTriggers)
+
+	stateTracker.AddDroppedTargetTrigger(trigger1)
+	stateTracker.AddDroppedTargetTrigger(trigger2)
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal([]ghostferry.TargetTrigger{trigger1, trigger2}, state.DroppedTargetTriggers)
+
+	resumedStateTracker, err := ghostferry.NewStateTrackerFromSerializedState(10, state, ghostferry.TableSchemaCache{})
+	s.Require().Nil(err)
+	resumedStateTracker.RemoveDroppedTargetTrigger(trigger1)
+	s.Require().Equal([]ghostferry.TargetTrigger{trigger2}, resumedStateTracker.DroppedTargetTriggers())
+	s.Require().Equal([]ghostferry.TargetTrigger{trigger1, trigger2}, state.DroppedTargetTriggers)
+}
+
+func (s *StateTrackerTestSuite) TestResetTableCopy() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("gftest.table1")
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table2", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(42)}})
+
+	stateTracker.ResetTableCopy("gftest.table1")
+	stateTracker.ResetTableCopy("gftest.table2")
+
+	s.Require().False(stateTracker.IsTableComplete("gftest.table1"))
+	paginationKey, completed := stateTracker.LastSuccessfulPaginationKey("gftest.table2")
+	s.Require().Nil(paginationKey)
+	s.Require().False(completed)
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Empty(state.CompletedTables)
+	s.Require().Empty(state.LastSuccessfulPaginationKeys)
+}
+
+func (s *StateTrackerTestSuite) TestStreamOnlyTablesAreSerialized() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsStreamOnly("gftest.table1")
+	stateTracker.MarkTableAsCompleted("gftest.table2")
+
+	s.Require().True(stateTracker.IsTableComplete("gftest.table1"))
+	s.Require().True(stateTracker.IsTableStreamOnly("gftest.table1"))
+	s.Require().False(stateTracker.IsTableStreamOnly("gftest.table2"))
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]bool{"gftest.table1": true, "gftest.table2": true}, state.CompletedTables)
+	s.Require().Equal(map[string]bool{"gftest.table1": true}, state.StreamOnlyTables)
+
+	resumed, err := ghostferry.NewStateTrackerFromSerializedState(10, state, nil)
+	s.Require().Nil(err)
+	s.Require().True(resumed.IsTableStreamOnly("gftest.table1"))
+
+	resumed.ResetTableCopy("gftest.table1")
+	s.Require().False(resumed.IsTableStreamOnly("gftest.table1"))
+}
+
+func (s *StateTrackerTestSuite) TestRecopiedTablesAreSerialized() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.ResetTableCopy("gftest.table1")
+	stateTracker.MarkTableAsRecopied("gftest.table1")
+
+	s.Require().True(stateTracker.IsTableRecopied("gftest.table1"))
+	s.Require().False(stateTracker.IsTableRecopied("gftest.table2"))
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]bool{"gftest.table1": true}, state.RecopiedTables)
+
+	resumed, err := ghostferry.NewStateTrackerFromSerializedState(10, state, nil)
+	s.Require().Nil(err)
+	s.Require().True(resumed.IsTableRecopied("gftest.table1"))
+}
+
+func (s *StateTrackerTestSuite) TestRecopiedTablesAreForgottenOnceCompleted() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsRecopied("gftest.table1")
+	stateTracker.MarkTableAsCompleted("gftest.table1")
+
+	s.Require().False(stateTracker.IsTableRecopied("gftest.table1"))
+	s.Require().Nil(stateTracker.Serialize(nil, nil).RecopiedTables)
+}
+
+func (s *StateTrackerTestSuite) TestRenameTable() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("gftest.table1")
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table2", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(42)}})
+	stateTracker.MarkTableAsCompleted("gftest.table3")
+
+	// swapping the tables via a third one
+	stateTracker.RenameTable("gftest.table1", "gftest.tmp")
+	stateTracker.RenameTable("gftest.table2", "gftest.table1")
+	stateTracker.RenameTable("gftest.tmp", "gftest.table2")
+	stateTracker.RenameTable("gftest.table3", "otherdb.table3")
+
+	s.Require().True(stateTracker.IsTableComplete("gftest.table2"))
+	s.Require().True(stateTracker.IsTableComplete("otherdb.table3"))
+	paginationKey, completed := stateTracker.LastSuccessfulPaginationKey("gftest.table1")
+	s.Require().Equal(ghostferry.RowData{uint64(42)}, paginationKey.Values)
+	s.Require().False(completed)
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]bool{"gftest.table2": true, "otherdb.table3": true}, state.CompletedTables)
+	s.Require().Equal(1, len(state.LastSuccessfulPaginationKeys))
+}
+
+func (s *StateTrackerTestSuite) TestBatchesReadBeforeRenameAreNotWritten() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table1", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(42)}})
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table2", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(7)}})
+	table1Version := stateTracker.TableCopyVersion("gftest.table1")
+	table2Version := stateTracker.TableCopyVersion("gftest.table2")
+
+	written := 0
+	write := func() error {
+		written++
+		return nil
+	}
+
+	// swapping the tables via a third one
+	s.Require().Nil(stateTracker.RenameCopiedTables([]string{"gftest.table1", "gftest.table2"}, func() error {
+		stateTracker.RenameTable("gftest.table1", "gftest.tmp")
+		stateTracker.RenameTable("gftest.table2", "gftest.table1")
+		stateTracker.RenameTable("gftest.tmp", "gftest.table2")
+		return nil
+	}))
+
+	// neither under the previous nor under the new name
+	s.Require().Equal(ghostferry.ErrTableSchemaChanged, stateTracker.WriteCopyBatch("gftest.table1", table1Version, write))
+	s.Require().Equal(ghostferry.ErrTableSchemaChanged, stateTracker.WriteCopyBatch("gftest.table2", table1Version, write))
+	s.Require().Equal(ghostferry.ErrTableSchemaChanged, stateTracker.WriteCopyBatch("gftest.table1", table2Version, write))
+	s.Require().Equal(ghostferry.ErrTableSchemaChanged, stateTracker.WriteCopyBatch("gftest.table2", table2Version, write))
+	s.Require().Equal(0, written)
+
+	paginationKey, _ := stateTracker.LastSuccessfulPaginationKey("gftest.table2")
+	s.Require().Equal(ghostferry.RowData{uint64(42)}, paginationKey.Values)
+	s.Require().Nil(stateTracker.WriteCopyBatch("gftest.table2", stateTracker.TableCopyVersion("gftest.table2"), write))
+	s.Require().Equal(1, written)
+}
+
+func (s *StateTrackerTestSuite) TestBatchesReadBeforeTruncationAreNotWritten() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table1", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(42)}})
+	version := stateTracker.TableCopyVersion("gftest.table1")
+
+	written := 0
+	write := func() error {
+		written++
+		return nil
+	}
+	s.Require().Nil(stateTracker.WriteCopyBatch("gftest.table1", version, write))
+
+	truncated := false
+	s.Require().Nil(stateTracker.TruncateTable("gftest.table1", func() error {
+		truncated = true
+		return nil
+	}))
+	s.Require().True(truncated)
+
+	err := stateTracker.WriteCopyBatch("gftest.table1", version, write)
+	s.Require().Equal(ghostferry.ErrTableTruncated, err)
+	s.Require().Equal(1, written)
+
+	paginationKey, completed := stateTracker.LastSuccessfulPaginationKey("gftest.table1")
+	s.Require().Nil(paginationKey)
+	s.Require().False(completed)
+
+	s.Require().Nil(stateTracker.WriteCopyBatch("gftest.table1", stateTracker.TableCopyVersion("gftest.table1"), write))
+	s.Require().Equal(2, written)
+}
+
+func (s *StateTrackerTestSuite) TestBatchesReadBeforeSchemaChangeAreNotWritten() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table1", &ghostferry.PaginationKeyData{Values: ghostferry.RowData{uint64(42)}})
+	version := stateTracker.TableCopyVersion("gftest.table1")
+
+	written := 0
+	write := func() error {
+		written++
+		return nil
+	}
+
+	changed := false
+	s.Require().Nil(stateTracker.ChangeTableSchema("gftest.table1", func() error {
+		changed = true
+		return nil
+	}))
+	s.Require().True(changed)
+
+	err := stateTracker.WriteCopyBatch("gftest.table1", version, write)
+	s.Require().Equal(ghostferry.ErrTableSchemaChanged, err)
+	s.Require().Equal(0, written)
+
+	// the copy continues from its position with the new schema
+	paginationKey, completed := stateTracker.LastSuccessfulPaginationKey("gftest.table1")
+	s.Require().Equal(ghostferry.RowData{uint64(42)}, paginationKey.Values)
+	s.Require().False(completed)
+
+	s.Require().Nil(stateTracker.WriteCopyBatch("gftest.table1", stateTracker.TableCopyVersion("gftest.table1"), write))
+	s.Require().Equal(1, written)
+}
+
 func TestStateTrackerTestSuite(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, &StateTrackerTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type StreamOnlyTablesTestSuite struct {
+	suite.Suite
+
+	ferry *ghostferry.Ferry
+}
+
+func (this *StreamOnlyTablesTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{StreamOnlyTables: []string{"gftest.backfilled"}},
+		Tables: ghostferry.TableSchemaCache{
+			"gftest.copied":     &ghostferry.TableSchema{Table: &schema.Table{Schema: "gftest", Name: "copied"}},
+			"gftest.backfilled": &ghostferry.TableSchema{Table: &schema.Table{Schema: "gftest", Name: "backfilled"}},
+		},
+		OverallState: ghostferry.StateStarting,
+	}
+}
+
+func (this *StreamOnlyTablesTestSuite) TestChecksumTableVerifierSkipsStreamOnlyTables() {
+	verifier := this.ferry.NewChecksumTableVerifier()
+
+	this.Require().Equal(1, len(verifier.Tables))
+	this.Require().Equal("gftest.copied", verifier.Tables[0].String())
+}
+
+func (this *StreamOnlyTablesTestSuite) TestInlineVerifierSkipsStreamOnlyTables() {
+	verifier := this.ferry.NewInlineVerifier()
+
+	this.Require().True(verifier.StreamOnlyTables["gftest.backfilled"])
+	this.Require().False(verifier.StreamOnlyTables["gftest.copied"])
+}
+
+func TestStreamOnlyTables(t *testing.T) {
+	suite.Run(t, new(StreamOnlyTablesTestSuite))
+}
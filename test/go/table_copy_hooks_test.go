@@ -0,0 +1,100 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type tableCopyHookRequest struct {
+	Payload string
+	Table   string
+	Phase   string
+}
+
+type TableCopyHooksTestSuite struct {
+	suite.Suite
+
+	server       *httptest.Server
+	status       int
+	requests     []tableCopyHookRequest
+	errorHandler *testhelpers.ErrorHandler
+	stateTracker *ghostferry.StateTracker
+}
+
+func (this *TableCopyHooksTestSuite) SetupTest() {
+	this.requests = nil
+	this.status = http.StatusOK
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request tableCopyHookRequest
+		this.Require().Nil(json.NewDecoder(r.Body).Decode(&request))
+		this.requests = append(this.requests, request)
+		w.WriteHeader(this.status)
+	}))
+
+	config := &ghostferry.TableCopyHooksConfig{
+		BeforeComplete: ghostferry.HTTPCallback{URI: this.server.URL, Payload: "before"},
+		AfterComplete:  ghostferry.HTTPCallback{URI: this.server.URL, Payload: "after"},
+		Attempts:       2,
+		RetryInterval:  "1ms",
+	}
+	this.Require().Nil(config.Validate())
+
+	this.errorHandler = &testhelpers.ErrorHandler{}
+	this.stateTracker = ghostferry.NewStateTracker(0)
+	this.stateTracker.AddTableCompletionHook(&ghostferry.TableCopyHooks{
+		Config:       config,
+		ErrorHandler: this.errorHandler,
+	})
+}
+
+func (this *TableCopyHooksTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *TableCopyHooksTestSuite) TestCallsHooksAroundTableCompletion() {
+	this.stateTracker.MarkTableAsCompleted("gftest.table1")
+
+	this.Require().Nil(this.errorHandler.LastError)
+	this.Require().Equal([]tableCopyHookRequest{
+		{Payload: "before", Table: "gftest.table1", Phase: ghostferry.TableCopyPhaseBeforeComplete},
+		{Payload: "after", Table: "gftest.table1", Phase: ghostferry.TableCopyPhaseAfterComplete},
+	}, this.requests)
+	this.Require().True(this.stateTracker.IsTableComplete("gftest.table1"))
+
+	// a completed table does not transition again
+	this.stateTracker.MarkTableAsCompleted("gftest.table1")
+	this.Require().Equal(2, len(this.requests))
+}
+
+func (this *TableCopyHooksTestSuite) TestFailsOnceAttemptsAreExhausted() {
+	this.status = http.StatusInternalServerError
+	this.stateTracker.MarkTableAsCompleted("gftest.table1")
+
+	this.Require().NotNil(this.errorHandler.LastError)
+	this.Require().Contains(this.errorHandler.LastError.Error(), "hook of gftest.table1 failed")
+	this.Require().Equal(tableCopyHookRequest{Payload: "before", Table: "gftest.table1", Phase: ghostferry.TableCopyPhaseBeforeComplete}, this.requests[0])
+}
+
+func (this *TableCopyHooksTestSuite) TestValidatesConfig() {
+	config := &ghostferry.TableCopyHooksConfig{}
+	this.Require().False(config.Enabled())
+
+	config.AfterComplete.URI = "http://localhost"
+	this.Require().True(config.Enabled())
+	this.Require().Nil(config.Validate())
+	this.Require().Equal(5, config.Attempts)
+	this.Require().Equal("10s", config.Timeout)
+
+	config.Timeout = "0s"
+	this.Require().NotNil(config.Validate())
+}
+
+func TestTableCopyHooks(t *testing.T) {
+	suite.Run(t, new(TableCopyHooksTestSuite))
+}
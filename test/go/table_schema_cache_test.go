@@ -109,6 +109,7 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesCascadingPaginationColumnCo
 				table: paginationColumn,
 			},
 		},
+		AllowUnsafePerTable: true,
 	}
 
 	query := fmt.Sprintf("CREATE TABLE %s.%s (%s bigint(20) not null, data TEXT)", testhelpers.TestSchemaName, table, paginationColumn)
@@ -116,6 +117,105 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesCascadingPaginationColumnCo
 	this.Require().Nil(err)
 	this.assertLoadTablesWithCascadingPaginationColumnConfig(table, []string{paginationColumn}, cascadingPaginationColumnConfig)
 }
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesCascadingPaginationColumnConfigOverridesPK() {
+	table := "pagination_by_column_config_overrides_pk"
+	paginationColumn := "seq"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		PerTable: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: paginationColumn,
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (uuid binary(16) not null, %s bigint(20) not null auto_increment, data TEXT, primary key(uuid), key(%s))", testhelpers.TestSchemaName, table, paginationColumn, paginationColumn)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+	this.assertLoadTablesWithCascadingPaginationColumnConfig(table, []string{paginationColumn}, cascadingPaginationColumnConfig)
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesForcesConfiguredIndex() {
+	table := "index_hint_configured"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		IndexHints: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: "id_data",
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (id bigint(20) not null, data varchar(255), primary key(id), key id_data(id, data))", testhelpers.TestSchemaName, table)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().Nil(err)
+	this.Require().Equal("id_data", tables.Get(testhelpers.TestSchemaName, table).ForcedIndex)
+	this.Require().Equal("", tables.Get(testhelpers.TestSchemaName, "test_table_1").ForcedIndex)
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesForcesPaginationKeyIndex() {
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		ForcePaginationKeyIndex: true,
+	}
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().Nil(err)
+	this.Require().Equal("PRIMARY", tables.Get(testhelpers.TestSchemaName, "test_table_1").ForcedIndex)
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectNonExistingIndexHint() {
+	table := "test_table_1"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		IndexHints: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: "non_existent",
+			},
+		},
+	}
+
+	_, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().EqualError(err, ghostferry.NonExistingIndexHintError(testhelpers.TestSchemaName, table, "non_existent").Error())
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectUnindexedCascadingPaginationColumn() {
+	table := "pagination_by_column_config_unindexed"
+	paginationColumn := "identity"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		PerTable: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: paginationColumn,
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (%s bigint(20) not null, data TEXT)", testhelpers.TestSchemaName, table, paginationColumn)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().EqualError(err, ghostferry.UnindexedPaginationKeyError(testhelpers.TestSchemaName, table, paginationColumn).Error())
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectNonUniqueCascadingPaginationColumn() {
+	table := "pagination_by_column_config_non_unique"
+	paginationColumn := "identity"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		PerTable: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: paginationColumn,
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (%s bigint(20) not null, data TEXT, key(%s))", testhelpers.TestSchemaName, table, paginationColumn, paginationColumn)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().EqualError(err, ghostferry.NonUniquePaginationKeyError(testhelpers.TestSchemaName, table, paginationColumn).Error())
+}
 func (this *TableSchemaCacheTestSuite) TestLoadTablesCascadingPaginationColumnConfigRightScenario2() {
 	dropTestTables(this) // needed because the default tables created at test setup interfere with this test
 
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type TargetGuardTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	guard *ghostferry.TargetGuard
+}
+
+func (this *TargetGuardTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+
+	this.guard = &ghostferry.TargetGuard{
+		Config: &ghostferry.TargetGuardConfig{},
+		DB:     this.Ferry.TargetDB,
+	}
+}
+
+func (this *TargetGuardTestSuite) TestPausesOnLowDiskSpace() {
+	this.guard.Config.MinFreeDiskSpaceMB = 100
+	this.guard.Config.FreeDiskSpaceQuery = "SELECT 10 * 1024 * 1024"
+	this.Require().Nil(this.guard.Config.Validate())
+
+	this.Require().Nil(this.guard.Check(context.Background()))
+	this.Require().True(this.guard.Throttled())
+	this.Require().Equal("free disk space of 10MB is below 100MB", this.guard.Reason())
+
+	this.guard.Config.FreeDiskSpaceQuery = "SELECT 200 * 1024 * 1024"
+	this.Require().Nil(this.guard.Check(context.Background()))
+	this.Require().False(this.guard.Throttled())
+}
+
+func (this *TargetGuardTestSuite) TestEstimatesDiskSpaceFromCapacity() {
+	this.guard.Config.MinFreeDiskSpaceMB = 1
+	this.guard.Config.DiskCapacityMB = 1024 * 1024
+	this.Require().Nil(this.guard.Config.Validate())
+
+	this.Require().Nil(this.guard.Check(context.Background()))
+	this.Require().False(this.guard.Throttled())
+}
+
+func (this *TargetGuardTestSuite) TestPausesOnLowConnectionHeadroom() {
+	this.guard.Config.MinFreeConnections = 1000000
+	this.Require().Nil(this.guard.Config.Validate())
+
+	this.Require().Nil(this.guard.Check(context.Background()))
+	this.Require().True(this.guard.Throttled())
+	this.Require().Contains(this.guard.Reason(), "free connections are below 1000000")
+
+	this.guard.Config.MinFreeConnections = 1
+	this.Require().Nil(this.guard.Check(context.Background()))
+	this.Require().False(this.guard.Throttled())
+}
+
+func (this *TargetGuardTestSuite) TestValidatesConfig() {
+	config := &ghostferry.TargetGuardConfig{MinFreeDiskSpaceMB: 100}
+	this.Require().True(config.Enabled())
+	this.Require().NotNil(config.Validate())
+
+	config = &ghostferry.TargetGuardConfig{MinFreeConnections: 10, CheckInterval: "0s"}
+	this.Require().NotNil(config.Validate())
+
+	config = &ghostferry.TargetGuardConfig{}
+	this.Require().False(config.Enabled())
+}
+
+func TestTargetGuard(t *testing.T) {
+	suite.Run(t, &TargetGuardTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -60,7 +60,43 @@ func (t *ThrottlerTestSuite) TestEnableDisable() {
 	}
 }
 
+type CopyThrottlerTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+}
+
+func (t *CopyThrottlerTestSuite) TestDataCopyWaitsForReadAndWriteThrottlers() {
+	read := &ghostferry.PauserThrottler{}
+	write := &ghostferry.PauserThrottler{}
+	t.Ferry.MigrationThrottler = read
+	t.Ferry.CopyWriteThrottler = write
+
+	throttler := t.Ferry.NewDataIterator().CursorConfig.Throttler
+	t.Require().False(throttler.Throttled())
+
+	write.SetPaused(true)
+	t.Require().True(throttler.Throttled())
+
+	write.SetDisabled(true)
+	t.Require().False(throttler.Throttled())
+
+	read.SetPaused(true)
+	t.Require().True(throttler.Throttled())
+}
+
+func (t *CopyThrottlerTestSuite) TestReplicationIgnoresReadThrottler() {
+	read := &ghostferry.PauserThrottler{}
+	t.Ferry.MigrationThrottler = read
+	t.Ferry.ReplicationThrottler = &ghostferry.PauserThrottler{}
+
+	read.SetPaused(true)
+	t.Require().False(t.Ferry.NewBinlogWriter().Throttler.Throttled())
+}
+
 func TestThrottlerTestSuite(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(ThrottlerTestSuite))
 }
+
+func TestCopyThrottler(t *testing.T) {
+	suite.Run(t, &CopyThrottlerTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type TunablesTestSuite struct {
+	suite.Suite
+
+	ferry *ghostferry.Ferry
+}
+
+func (this *TunablesTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{
+			DataIterationBatchSize: 200,
+			DBWriteRetries:         5,
+		},
+		BatchWriter:  &ghostferry.BatchWriter{WriteRetries: 5},
+		BinlogWriter: &ghostferry.BinlogWriter{WriteRetries: 5},
+		DataIterator: &ghostferry.DataIterator{
+			CursorConfig: &ghostferry.CursorConfig{BatchSize: 200},
+		},
+		Logger: logrus.NewEntry(logrus.New()),
+	}
+}
+
+func (this *TunablesTestSuite) TestUpdatesComponents() {
+	err := this.ferry.UpdateTunables(ghostferry.Tunables{
+		DataIterationBatchSize: 1000,
+		DBWriteRetries:         10,
+		LogLevel:               "warning",
+	})
+	this.Require().Nil(err)
+
+	this.Require().Equal(uint64(1000), this.ferry.Config.DataIterationBatchSize)
+	this.Require().Equal(uint64(1000), this.ferry.DataIterator.CursorConfig.BatchSize)
+	this.Require().Equal(10, this.ferry.Config.DBWriteRetries)
+	this.Require().Equal(10, this.ferry.BatchWriter.WriteRetries)
+	this.Require().Equal(10, this.ferry.BinlogWriter.WriteRetries)
+	this.Require().Equal(logrus.WarnLevel, this.ferry.Logger.Logger.Level)
+	this.Require().Equal("warning", this.ferry.CurrentTunables().LogLevel)
+
+	// the level of the standard logger is left to the other ferries
+	this.Require().NotEqual(logrus.WarnLevel, logrus.GetLevel())
+}
+
+func (this *TunablesTestSuite) TestUpdatesWhileRunning() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			this.ferry.UpdateTunables(ghostferry.Tunables{DataIterationBatchSize: uint64(i), DBWriteRetries: i})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		this.ferry.CurrentTunables()
+	}
+	<-done
+
+	this.Require().Equal(ghostferry.Tunables{DataIterationBatchSize: 100, DBWriteRetries: 100, LogLevel: "info"}, this.ferry.CurrentTunables())
+}
+
+func (this *TunablesTestSuite) TestLeavesZeroValuesUnchanged() {
+	err := this.ferry.UpdateTunables(ghostferry.Tunables{DBWriteRetries: 10})
+	this.Require().Nil(err)
+
+	this.Require().Equal(uint64(200), this.ferry.CurrentTunables().DataIterationBatchSize)
+	this.Require().Equal(10, this.ferry.CurrentTunables().DBWriteRetries)
+}
+
+func (this *TunablesTestSuite) TestRejectsInvalidTunables() {
+	err := this.ferry.UpdateTunables(ghostferry.Tunables{DBWriteRetries: 10, LogLevel: "loud"})
+	this.Require().EqualError(err, "not a valid logrus Level: \"loud\"")
+	this.Require().Equal(5, this.ferry.Config.DBWriteRetries)
+}
+
+func (this *TunablesTestSuite) TestReadsTunablesFromConfigFile() {
+	f, err := ioutil.TempFile("", "ghostferry-config")
+	this.Require().Nil(err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`{"Source": {"Host": "localhost"}, "DBWriteRetries": 7, "LogLevel": "info"}`)
+	this.Require().Nil(err)
+	f.Close()
+
+	tunables, err := ghostferry.ReadTunablesFile(f.Name())
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.Tunables{DBWriteRetries: 7, LogLevel: "info"}, tunables)
+}
+
+func TestTunables(t *testing.T) {
+	suite.Run(t, new(TunablesTestSuite))
+}
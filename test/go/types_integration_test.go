@@ -83,6 +83,61 @@ func setupFixedPointDecimalTypeTable(f *testhelpers.TestFerry, sourceDB, targetD
 	testhelpers.PanicIfError(err)
 }
 
+func addPrecisionSensitiveTypesToTable(db *sql.DB, dbName, tableName string) {
+	query := "ALTER TABLE %s.%s " +
+		"ADD float_col FLOAT," +
+		"ADD double_col DOUBLE," +
+		"ADD decimal_col DECIMAL(65, 30)," +
+		"ADD time_col TIME(6)," +
+		"ADD dt_col DATETIME(6)," +
+		"ADD ts_col TIMESTAMP(6) NULL"
+
+	query = fmt.Sprintf(query, dbName, tableName)
+	_, err := db.Exec(query)
+	testhelpers.PanicIfError(err)
+}
+
+// values that change if they are formatted with less than full precision
+func insertPrecisionSensitiveValues(db *sql.DB) {
+	query := "INSERT INTO gftest.table1 " +
+		"(id, data, float_col, double_col, decimal_col, time_col, dt_col, ts_col) VALUES " +
+		"(NULL, 'a', 1.0000001, 0.1e0 + 0.2e0, 12345678901234567890123456789012345.123456789012345678901234567890, '-838:59:58.999999', '1000-01-01 00:00:00.000001', '2038-01-19 03:14:07.999999')," +
+		"(NULL, 'b', 3.4028234e38, 1.7976931348623157e308, -0.000000000000000000000000000001, '00:00:00.000001', '9999-12-31 23:59:59.999999', '1970-01-01 00:00:01.000001')," +
+		"(NULL, 'c', -1.1754944e-38, 2.2250738585072014e-308, 0.100000000000000000000000000000, '838:59:59.000000', '2000-02-29 12:00:00.500000', NULL)"
+
+	_, err := db.Exec(query)
+	testhelpers.PanicIfError(err)
+}
+
+func setupPrecisionSensitiveTypeTable(f *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+	testhelpers.SeedInitialData(sourceDB, "gftest", "table1", 0)
+	testhelpers.SeedInitialData(targetDB, "gftest", "table1", 0)
+
+	addPrecisionSensitiveTypesToTable(sourceDB, "gftest", "table1")
+	addPrecisionSensitiveTypesToTable(targetDB, "gftest", "table1")
+
+	insertPrecisionSensitiveValues(sourceDB)
+}
+
+func TestCopyDataWithPrecisionSensitiveTypes(t *testing.T) {
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupPrecisionSensitiveTypeTable,
+		AfterRowCopyIsComplete: func(f *testhelpers.TestFerry, sourceDB, targetDB *sql.DB) {
+			// the same values again, applied from the binlogs
+			insertPrecisionSensitiveValues(sourceDB)
+		},
+		Ferry: testhelpers.NewTestFerry(),
+	}
+
+	defer testcase.Teardown()
+	testcase.CopyData()
+	testcase.VerifyData()
+
+	// adding a DOUBLE formats the FLOAT values with all digits
+	testcase.AssertQueriesHaveEqualResult("SELECT id, float_col + 0e0, double_col, CAST(decimal_col AS CHAR), CAST(time_col AS CHAR), CAST(dt_col AS CHAR), CAST(ts_col AS CHAR) FROM gftest.table1 ORDER BY id")
+}
+
 func TestCopyDataWithManyTypes(t *testing.T) {
 	logrus.SetLevel(logrus.DebugLevel)
 	testcase := &testhelpers.IntegrationTestCase{
@@ -1,9 +1,11 @@
 package test
 
 import (
+	sqlorig "database/sql"
 	"fmt"
 	"testing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
 
@@ -65,7 +67,156 @@ func (this *UtilsTestSuite) Test0UnlimitedRetries() {
 	this.Require().Equal(10, called)
 }
 
+func (this *UtilsTestSuite) TestClassifyError() {
+	this.Require().Equal(ghostferry.ErrorClassLockContention, ghostferry.ClassifyError(&mysql.MySQLError{Number: 1213}))
+	this.Require().Equal(ghostferry.ErrorClassLockContention, ghostferry.ClassifyError(fmt.Errorf("during copy statement: %w", &mysql.MySQLError{Number: 1205})))
+	this.Require().Equal(ghostferry.ErrorClassConnection, ghostferry.ClassifyError(fmt.Errorf("during copy statement: %w", mysql.ErrInvalidConn)))
+	this.Require().Equal(ghostferry.ErrorClassSemantic, ghostferry.ClassifyError(&mysql.MySQLError{Number: 1064}))
+	this.Require().Equal(ghostferry.ErrorClassUnknown, ghostferry.ClassifyError(fmt.Errorf("test error")))
+}
+
+func (this *UtilsTestSuite) TestIsPacketTooLarge() {
+	this.Require().True(ghostferry.IsPacketTooLarge(&mysql.MySQLError{Number: 1153}))
+	this.Require().True(ghostferry.IsPacketTooLarge(fmt.Errorf("during copy statement: %w", mysql.ErrPktTooLarge)))
+	this.Require().False(ghostferry.IsPacketTooLarge(&mysql.MySQLError{Number: 1213}))
+	this.Require().False(ghostferry.IsPacketTooLarge(fmt.Errorf("test error")))
+}
+
+func (this *UtilsTestSuite) TestIsSchemaAheadOfCache() {
+	this.Require().True(ghostferry.IsSchemaAheadOfCache(&mysql.MySQLError{Number: 1054}))
+	this.Require().True(ghostferry.IsSchemaAheadOfCache(ghostferry.ErrSourceSchemaAheadOfCache))
+	this.Require().False(ghostferry.IsSchemaAheadOfCache(ghostferry.ErrTableSchemaChanged))
+	this.Require().False(ghostferry.IsSchemaAheadOfCache(&mysql.MySQLError{Number: 1213}))
+}
+
+func (this *UtilsTestSuite) TestRetryPolicyDoesNotRetrySemanticErrors() {
+	policy := &ghostferry.RetryPolicyConfig{}
+	this.Require().Nil(policy.Validate())
+
+	called := 0
+	err := ghostferry.WithRetryPolicy(policy, 5, this.logger, "test", func() error {
+		called++
+		return &mysql.MySQLError{Number: 1062}
+	})
+
+	this.Require().NotNil(err)
+	this.Require().Equal(1, called)
+
+	policy.RetrySemanticErrors = true
+	called = 0
+	err = ghostferry.WithRetryPolicy(policy, 5, this.logger, "test", func() error {
+		called++
+		return &mysql.MySQLError{Number: 1062}
+	})
+
+	this.Require().NotNil(err)
+	this.Require().Equal(5, called)
+}
+
+func (this *UtilsTestSuite) TestRetryPolicyRetriesLockContention() {
+	policy := &ghostferry.RetryPolicyConfig{LockContentionJitter: "1ms"}
+	this.Require().Nil(policy.Validate())
+
+	called := 0
+	err := ghostferry.WithRetryPolicy(policy, 5, this.logger, "test", func() error {
+		called++
+		if called >= 3 {
+			return nil
+		}
+		return &mysql.MySQLError{Number: 1213}
+	})
+
+	this.Require().Nil(err)
+	this.Require().Equal(3, called)
+}
+
 func TestUtils(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(UtilsTestSuite))
 }
+
+type StmtCacheTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+}
+
+func (this *StmtCacheTestSuite) TestReturnsCachedStatements() {
+	cache := ghostferry.NewBoundedStmtCache(2, "test", nil)
+
+	stmt, release, err := cache.StmtFor(this.Ferry.TargetDB, "SELECT 1")
+	this.Require().Nil(err)
+	release()
+
+	cached, release, err := cache.StmtFor(this.Ferry.TargetDB, "SELECT 1")
+	this.Require().Nil(err)
+	release()
+	this.Require().True(stmt == cached)
+	this.Require().Equal(1, cache.Len())
+}
+
+func (this *StmtCacheTestSuite) TestEvictsAndClosesLeastRecentlyUsedStatements() {
+	cache := ghostferry.NewBoundedStmtCache(2, "test", nil)
+
+	stmt1 := this.stmtFor(cache, "SELECT 1")
+	stmt2 := this.stmtFor(cache, "SELECT 2")
+
+	// makes the first statement the most recently used
+	this.stmtFor(cache, "SELECT 1")
+
+	this.stmtFor(cache, "SELECT 3")
+	this.Require().Equal(2, cache.Len())
+
+	_, err := stmt1.Exec()
+	this.Require().Nil(err)
+	_, err = stmt2.Exec()
+	this.Require().NotNil(err)
+
+	stmt := this.stmtFor(cache, "SELECT 2")
+	this.Require().False(stmt == stmt2)
+}
+
+func (this *StmtCacheTestSuite) TestClosesEvictedStatementsOnceReleased() {
+	cache := ghostferry.NewBoundedStmtCache(1, "test", nil)
+
+	stmt1, release1, err := cache.StmtFor(this.Ferry.TargetDB, "SELECT 1")
+	this.Require().Nil(err)
+	_, release2, err := cache.StmtFor(this.Ferry.TargetDB, "SELECT 1")
+	this.Require().Nil(err)
+
+	// the statement evicted while in use can still be executed
+	this.stmtFor(cache, "SELECT 2")
+	this.Require().Equal(1, cache.Len())
+	_, err = stmt1.Exec()
+	this.Require().Nil(err)
+
+	release1()
+	release1()
+	_, err = stmt1.Exec()
+	this.Require().Nil(err)
+
+	// and is closed once released by all of its users
+	release2()
+	_, err = stmt1.Exec()
+	this.Require().NotNil(err)
+}
+
+func (this *StmtCacheTestSuite) TestUnboundedCacheKeepsAllStatements() {
+	cache := ghostferry.NewStmtCache()
+
+	for i := 0; i < 10; i++ {
+		this.stmtFor(cache, fmt.Sprintf("SELECT %d", i))
+	}
+	this.Require().Equal(10, cache.Len())
+}
+
+// stmtFor returns the statement of the query, which is released right away
+func (this *StmtCacheTestSuite) stmtFor(cache *ghostferry.StmtCache, query string) *sqlorig.Stmt {
+	stmt, release, err := cache.StmtFor(this.Ferry.TargetDB, query)
+	this.Require().Nil(err)
+	release()
+	return stmt
+}
+
+func TestStmtCache(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &StmtCacheTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
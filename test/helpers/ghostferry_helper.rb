@@ -264,6 +264,10 @@ module GhostferryHelper
           environment["GHOSTFERRY_LOCK_STRATEGY"] = @config[:lock_strategy]
         end
 
+        if @config[:unmatched_dml_policy]
+          environment["GHOSTFERRY_UNMATCHED_DML_POLICY"] = @config[:unmatched_dml_policy]
+        end
+
         @logger.info("starting ghostferry test binary #{@compiled_binary_path}")
         Open3.popen3(environment, @compiled_binary_path) do |stdin, stdout, stderr, wait_thr|
           stdin.puts(resuming_state) unless resuming_state.nil?
@@ -317,6 +317,56 @@ class InterruptResumeTest < GhostferryTestCase
     assert_equal "cutover verification failed for: gftest.test_table_1 [paginationKeys: #{chosen_id} ] ", error_line["msg"]
   end
 
+  def test_interrupt_resume_inline_verifier_will_requeue_rows_changed_before_the_binlog_writer_position
+    ghostferry = new_ghostferry(MINIMAL_GHOSTFERRY, config: { verifier_type: "Inline" })
+
+    result = source_db.query("SELECT MIN(id) FROM #{DEFAULT_FULL_TABLE_NAME}")
+    chosen_id = result.first["MIN(id)"]
+
+    position_before_update = nil
+    ghostferry.on_status(Ghostferry::Status::AFTER_ROW_COPY) do
+      if position_before_update.nil?
+        master_status = source_db.query("SHOW MASTER STATUS").first
+        position_before_update = { "Name" => master_status["File"], "Pos" => master_status["Position"] }
+        source_db.query("UPDATE #{DEFAULT_FULL_TABLE_NAME} SET data = 'data2' WHERE id = #{chosen_id}")
+      end
+    end
+
+    ghostferry.on_status(Ghostferry::Status::AFTER_BINLOG_APPLY) do
+      ghostferry.term_and_wait_for_exit
+    end
+
+    dumped_state = ghostferry.run_expecting_interrupt
+    assert_basic_fields_exist_in_dumped_state(dumped_state)
+
+    # The binlog writer applied the update, but the inline verifier is made to
+    # have lost track of it, as if the state was dumped in between.
+    dumped_state["BinlogVerifyStore"] = {}
+    dumped_state["LastStoredBinlogPositionForInlineVerifier"] = {
+      "EventPosition" => position_before_update,
+      "ResumePosition" => position_before_update,
+    }
+
+    # The update is not applied again on resume, so the row can only be
+    # found to be incorrect if it was re-queued for verification.
+    target_db.query("UPDATE #{DEFAULT_FULL_TABLE_NAME} SET data = 'corrupted' WHERE id = #{chosen_id}")
+
+    verification_ran = false
+    incorrect_tables = nil
+    ghostferry = new_ghostferry(MINIMAL_GHOSTFERRY, config: { verifier_type: "Inline" })
+    ghostferry.on_status(Ghostferry::Status::VERIFIED) do |*tables|
+      verification_ran = true
+      incorrect_tables = tables
+    end
+
+    ghostferry.run(dumped_state)
+    assert verification_ran
+    assert_equal ["gftest.test_table_1"], incorrect_tables
+
+    error_line = ghostferry.error_lines.last
+    assert_equal "cutover verification failed for: gftest.test_table_1 [paginationKeys: #{chosen_id} ] ", error_line["msg"]
+  end
+
   def test_interrupt_resume_between_consecutive_rows_events
     ghostferry = new_ghostferry(MINIMAL_GHOSTFERRY, config: { verifier_type: "Inline" })
 
@@ -91,6 +91,8 @@ class IterateByColumnTest < GhostferryTestCase
   def cascadingPaginationColumnConfig(per_table: nil, fallback_column: nil)
     {
       PerTable: per_table,
+      # the columns of these tables are not indexed, but their values are unique
+      AllowUnsafePerTable: per_table ? true : nil,
       FallbackColumn: fallback_column
     }.reduce({}) do |a,(k,v)|
       if v
@@ -110,11 +110,41 @@ class SchemaChangeIntegrationTests < GhostferryTestCase
 
     state_table_prefix = "#{DEFAULT_STATE_DB}._ghostferry_#{DEFAULT_SERVER_ID}_"
     res = target_db.query("SELECT table_name, copy_complete FROM #{state_table_prefix}_row_copy_state")
-    assert_equal 2, res.count
-    res.each do |row|
-      assert_includes ["#{DEFAULT_DB}.#{DEFAULT_TABLE}", "#{DEFAULT_DB}.#{table_name_renamed}"], row["table_name"]
-      assert_equal 1, row["copy_complete"]
+    assert_equal 1, res.count
+    assert_equal "#{DEFAULT_DB}.#{table_name_renamed}", res.first["table_name"]
+    assert_equal 1, res.first["copy_complete"]
+  end
+
+  def test_swap_tables_by_renaming_them_during_cutover_phase
+    seed_simple_database_with_single_table
+    other_table = "#{DEFAULT_TABLE}_other"
+    full_other_table_name = full_table_name(DEFAULT_DB, other_table)
+    full_tmp_table_name = full_table_name(DEFAULT_DB, "#{DEFAULT_TABLE}_tmp")
+
+    [source_db, target_db].each do |db|
+      db.query("CREATE TABLE #{full_other_table_name} (id bigint(20) not null auto_increment, data TEXT, primary key(id))")
+    end
+    source_db.query("INSERT INTO #{full_other_table_name} (id, data) VALUES (1, 'other')")
+
+    ghostferry = new_altering_ghostferry
+
+    renamed = false
+    ghostferry.on_status(Ghostferry::Status::ROW_COPY_COMPLETED) do
+      source_db.query("RENAME TABLE #{DEFAULT_FULL_TABLE_NAME} TO #{full_tmp_table_name}, #{full_other_table_name} TO #{DEFAULT_FULL_TABLE_NAME}, #{full_tmp_table_name} TO #{full_other_table_name}")
+      source_db.query("INSERT INTO #{DEFAULT_FULL_TABLE_NAME} (id, data) VALUES (2, 'swapped')")
+      renamed = true
+    end
+
+    ghostferry.run
+
+    assert renamed
+    source, target = source_and_target_table_metrics(tables: [DEFAULT_FULL_TABLE_NAME, full_other_table_name])
+    [DEFAULT_FULL_TABLE_NAME, full_other_table_name].each do |table|
+      assert_equal source[table][:checksum], target[table][:checksum]
     end
+
+    res = target_db.query("SELECT id, data FROM #{DEFAULT_FULL_TABLE_NAME} ORDER BY id")
+    assert_equal [[1, "other"], [2, "swapped"]], res.map { |row| [row["id"], row["data"]] }
   end
 
   def test_truncate_table_during_cutover_phase
@@ -234,6 +264,99 @@ class SchemaChangeIntegrationTests < GhostferryTestCase
     assert_equal 7, res.first["data2"]
   end
 
+  def test_add_column_to_table_being_copied
+    seed_simple_database_with_single_table
+
+    ghostferry = new_altering_ghostferry
+
+    # the table is altered after its first batch was copied, so the remaining
+    # rows are read with the columns of the schema cached before the change
+    # until the binlog writer applied it
+    altered = false
+    ghostferry.on_status(Ghostferry::Status::AFTER_ROW_COPY) do
+      next if altered
+      source_db.query("ALTER TABLE #{DEFAULT_FULL_TABLE_NAME} ADD COLUMN data2 int(11) DEFAULT 7")
+      altered = true
+    end
+
+    ghostferry.run
+
+    assert altered
+    assert_test_table_is_identical
+
+    res = target_db.query("SELECT COUNT(*) AS cnt FROM #{DEFAULT_FULL_TABLE_NAME} WHERE data2 = 7")
+    assert_equal source_db.query("SELECT COUNT(*) AS cnt FROM #{DEFAULT_FULL_TABLE_NAME}").first["cnt"], res.first["cnt"]
+  end
+
+  def test_drop_column_of_table_being_copied
+    seed_simple_database_with_single_table
+
+    ghostferry = new_altering_ghostferry
+
+    # the remaining rows can't be read with the columns of the schema cached
+    # before the change, so the copy waits for the binlog writer to apply it
+    altered = false
+    ghostferry.on_status(Ghostferry::Status::AFTER_ROW_COPY) do
+      next if altered
+      source_db.query("ALTER TABLE #{DEFAULT_FULL_TABLE_NAME} DROP COLUMN data")
+      altered = true
+    end
+
+    ghostferry.run
+
+    assert altered
+    assert_test_table_is_identical
+
+    res = target_db.query("SHOW COLUMNS FROM #{DEFAULT_FULL_TABLE_NAME} LIKE 'data'")
+    assert_equal 0, res.count
+  end
+
+  def test_drop_table_being_copied
+    seed_simple_database_with_single_table
+
+    ghostferry = new_altering_ghostferry
+
+    dropped = false
+    ghostferry.on_status(Ghostferry::Status::AFTER_ROW_COPY) do
+      next if dropped
+      source_db.query("DROP TABLE #{DEFAULT_FULL_TABLE_NAME}")
+      dropped = true
+    end
+
+    ghostferry.run
+
+    assert dropped
+    res = target_db.query("SHOW TABLES IN #{DEFAULT_DB}")
+    assert_equal 0, res.count
+  end
+
+  def test_rename_table_being_copied
+    seed_simple_database_with_single_table
+    table_name_renamed = "#{DEFAULT_TABLE}_renamed"
+    full_quoted_table_name = full_table_name(DEFAULT_DB, table_name_renamed)
+
+    ghostferry = new_altering_ghostferry
+
+    # the remaining rows are read under the new name once the binlog writer
+    # applied the rename
+    renamed = false
+    ghostferry.on_status(Ghostferry::Status::AFTER_ROW_COPY) do
+      next if renamed
+      source_db.query("RENAME TABLE #{DEFAULT_FULL_TABLE_NAME} TO #{full_quoted_table_name}")
+      renamed = true
+    end
+
+    ghostferry.run
+
+    assert renamed
+    source, target = source_and_target_table_metrics(tables: [full_quoted_table_name])
+    assert_equal source[full_quoted_table_name][:row_count], target[full_quoted_table_name][:row_count]
+    assert_equal source[full_quoted_table_name][:checksum], target[full_quoted_table_name][:checksum]
+
+    res = target_db.query("SHOW TABLES IN #{DEFAULT_DB}")
+    assert_equal 1, res.count
+  end
+
   def test_skip_unsupported_statements
     # this is really an anti-test, in that we check if do not properly propagate schema changes. The
     # idea is that we want to _survive_ some unsupported statements that we agree are outside of the
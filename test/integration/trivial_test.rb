@@ -117,4 +117,55 @@ class TrivialIntegrationTests < GhostferryTestCase
 
     assert_test_table_is_identical
   end
+
+  def test_unmatched_dml_policy_repair_copies_drifted_rows_again
+    seed_simple_database_with_single_table
+
+    ghostferry = new_ghostferry(MINIMAL_GHOSTFERRY, config: { unmatched_dml_policy: "repair" })
+
+    ghostferry.on_status(Ghostferry::Status::ROW_COPY_COMPLETED) do
+      id = source_db.query("SELECT id FROM #{DEFAULT_FULL_TABLE_NAME} ORDER BY id LIMIT 1").first["id"]
+
+      # the row on the target no longer matches the before image of the
+      # update, which would leave it unchanged
+      target_db.query("UPDATE #{DEFAULT_FULL_TABLE_NAME} SET data = 'drifted' WHERE id = #{id}")
+      source_db.query("UPDATE #{DEFAULT_FULL_TABLE_NAME} SET data = 'changed' WHERE id = #{id}")
+    end
+
+    ghostferry.run
+
+    assert_test_table_is_identical
+  end
+
+  def test_unmatched_dml_policy_ignores_events_written_before_the_table_completed
+    seed_simple_database_with_single_table
+
+    ghostferry = new_ghostferry(MINIMAL_GHOSTFERRY, config: { unmatched_dml_policy: "fail" })
+
+    # the row is deleted before the copy reads it, so its deletion matches no
+    # row on the target
+    deleted = false
+    ghostferry.on_status(Ghostferry::Status::BEFORE_ROW_COPY) do
+      next if deleted
+      deleted = true
+      source_db.query("DELETE FROM #{DEFAULT_FULL_TABLE_NAME} ORDER BY id DESC LIMIT 1")
+    end
+
+    # the deletion is only applied once the table completed its copy
+    row_copy_completed = Queue.new
+    ghostferry.on_status(Ghostferry::Status::ROW_COPY_COMPLETED) do
+      row_copy_completed << true
+    end
+    held = false
+    ghostferry.on_status(Ghostferry::Status::BEFORE_BINLOG_APPLY) do
+      next if !deleted || held
+      held = true
+      row_copy_completed.pop
+    end
+
+    ghostferry.run
+
+    assert held
+    assert_test_table_is_identical
+  end
 end
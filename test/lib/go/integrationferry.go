@@ -286,6 +286,10 @@ func NewStandardConfig() (*ghostferry.Config, error) {
 		config.LockStrategy = lockStrategy
 	}
 
+	if unmatchedDMLPolicy := os.Getenv("GHOSTFERRY_UNMATCHED_DML_POLICY"); unmatchedDMLPolicy != "" {
+		config.UnmatchedDMLPolicy = unmatchedDMLPolicy
+	}
+
 	return config, config.ValidateConfig()
 }
 
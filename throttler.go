@@ -5,6 +5,7 @@ import (
 	sqlorig "database/sql"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -72,6 +73,21 @@ func (t *PauserThrottler) Run(ctx context.Context) error {
 	return nil
 }
 
+// combinedThrottler throttles while either of its throttlers does. Pausing
+// and disabling apply to the first throttler only.
+type combinedThrottler struct {
+	Throttler
+	other Throttler
+}
+
+func (t *combinedThrottler) Throttled() bool {
+	return (!t.Throttler.Disabled() && t.Throttler.Throttled()) || (!t.other.Disabled() && t.other.Throttled())
+}
+
+func (t *combinedThrottler) Disabled() bool {
+	return t.Throttler.Disabled() && t.other.Disabled()
+}
+
 type LagThrottlerConfig struct {
 	Connection     *DatabaseConfig
 	MaxLag         int
@@ -86,6 +102,7 @@ type LagThrottler struct {
 
 	DB       *sql.DB
 	lag      int
+	mutex    sync.RWMutex
 	logger   *logrus.Entry
 	interval time.Duration
 }
@@ -127,7 +144,28 @@ func NewLagThrottler(config *LagThrottlerConfig) (*LagThrottler, error) {
 }
 
 func (t *LagThrottler) Throttled() bool {
-	return t.PauserThrottler.Throttled() || t.lag > t.config.MaxLag
+	if t.PauserThrottler.Throttled() {
+		return true
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.lag > t.config.MaxLag
+}
+
+// MaxLag returns the lag above which the throttler throttles
+func (t *LagThrottler) MaxLag() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.config.MaxLag
+}
+
+// SetMaxLag changes the lag above which the throttler throttles, taking
+// effect with the next check
+func (t *LagThrottler) SetMaxLag(maxLag int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.config.MaxLag = maxLag
 }
 
 func (t *LagThrottler) Run(ctx context.Context) error {
@@ -161,6 +199,8 @@ func (t *LagThrottler) updateLag(ctx context.Context) error {
 		return nil
 	}
 
+	t.mutex.Lock()
 	t.lag = int(newLag.Int64)
+	t.mutex.Unlock()
 	return nil
 }
@@ -0,0 +1,173 @@
+package ghostferry
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Tunables are the settings of a ferry that can be changed while it is
+// running, through the ControlServer or by sending SIGHUP to the process if
+// Ferry.ReloadTunables is set. Settings with zero values are left unchanged.
+type Tunables struct {
+	// See Config.DataIterationBatchSize. Only applies to the tables whose
+	// copy starts after the change.
+	DataIterationBatchSize uint64
+
+	// See Config.DBWriteRetries
+	DBWriteRetries int
+
+	// The MaxLag of the LagThrottlers of the ferry
+	MaxLag int
+
+	// The level of the logger of the ferry, e.g. "debug" or "info", see
+	// Ferry.Logger
+	LogLevel string
+}
+
+func (t Tunables) Validate() error {
+	if t.DBWriteRetries < 0 {
+		return fmt.Errorf("DBWriteRetries must not be negative")
+	}
+
+	if t.MaxLag < 0 {
+		return fmt.Errorf("MaxLag must not be negative")
+	}
+
+	if t.LogLevel != "" {
+		if _, err := logrus.ParseLevel(t.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadTunablesFile reads the Tunables from a JSON file, such as the config
+// file of the ferry, ignoring all other settings in it
+func ReadTunablesFile(path string) (Tunables, error) {
+	var tunables Tunables
+
+	f, err := os.Open(path)
+	if err != nil {
+		return tunables, err
+	}
+	defer f.Close()
+
+	err = DecodeConfig(f, &tunables)
+	return tunables, err
+}
+
+// CurrentTunables returns the current values of the Tunables. MaxLag is zero
+// if the ferry has no LagThrottler.
+func (f *Ferry) CurrentTunables() Tunables {
+	f.tunablesMutex.Lock()
+	defer f.tunablesMutex.Unlock()
+
+	return f.currentTunables()
+}
+
+func (f *Ferry) currentTunables() Tunables {
+	tunables := Tunables{
+		DataIterationBatchSize: f.Config.DataIterationBatchSize,
+		DBWriteRetries:         f.Config.DBWriteRetries,
+		LogLevel:               loggerLevel(f.loggerFor("tunables").Logger).String(),
+	}
+
+	for _, throttler := range f.lagThrottlers() {
+		tunables.MaxLag = throttler.MaxLag()
+	}
+
+	return tunables
+}
+
+// UpdateTunables applies the non-zero settings of the Tunables to the ferry
+// and its components. Safe to call while the ferry runs.
+func (f *Ferry) UpdateTunables(tunables Tunables) error {
+	if err := tunables.Validate(); err != nil {
+		return err
+	}
+
+	f.tunablesMutex.Lock()
+	defer f.tunablesMutex.Unlock()
+
+	if tunables.DataIterationBatchSize > 0 {
+		f.Config.DataIterationBatchSize = tunables.DataIterationBatchSize
+		if f.DataIterator != nil {
+			f.DataIterator.SetBatchSize(tunables.DataIterationBatchSize)
+		}
+	}
+
+	if tunables.DBWriteRetries > 0 {
+		f.Config.DBWriteRetries = tunables.DBWriteRetries
+		if f.BatchWriter != nil {
+			f.BatchWriter.SetWriteRetries(tunables.DBWriteRetries)
+		}
+		if f.BinlogWriter != nil {
+			f.BinlogWriter.SetWriteRetries(tunables.DBWriteRetries)
+		}
+	}
+
+	if tunables.MaxLag > 0 {
+		for _, throttler := range f.lagThrottlers() {
+			throttler.SetMaxLag(tunables.MaxLag)
+		}
+	}
+
+	// the other ferries of the process keep their level, unless they log to
+	// the standard logger as well
+	logger := f.loggerFor("tunables")
+	if tunables.LogLevel != "" {
+		level, _ := logrus.ParseLevel(tunables.LogLevel)
+		logger.Logger.SetLevel(level)
+	}
+
+	logger.WithField("tunables", f.currentTunables()).Info("updated tunables")
+	return nil
+}
+
+// loggerLevel returns the level of the logger, which Logger.SetLevel changes
+// atomically
+func loggerLevel(logger *logrus.Logger) logrus.Level {
+	return logrus.Level(atomic.LoadUint32((*uint32)(&logger.Level)))
+}
+
+func (f *Ferry) lagThrottlers() []*LagThrottler {
+	var throttlers []*LagThrottler
+	_, all := f.throttlers()
+	for _, throttler := range all {
+		if lagThrottler, ok := throttler.(*LagThrottler); ok {
+			throttlers = append(throttlers, lagThrottler)
+		}
+	}
+	return throttlers
+}
+
+// reloadTunablesOnSignal applies the Tunables returned by ReloadTunables
+// whenever the process receives SIGHUP, until stop is closed
+func (f *Ferry) reloadTunablesOnSignal(stop <-chan struct{}) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c:
+		}
+
+		f.loggerFor("tunables").Info("received SIGHUP, reloading tunables")
+		tunables, err := f.ReloadTunables()
+		if err == nil {
+			err = f.UpdateTunables(tunables)
+		}
+		if err != nil {
+			f.loggerFor("tunables").WithError(err).Error("failed to reload tunables")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package ghostferry
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"github.com/sirupsen/logrus"
+)
+
+// How the binlog writer handles an UPDATE or DELETE that matches no row on
+// the target, see Config.UnmatchedDMLPolicy
+const (
+	UnmatchedDMLPolicyIgnore = "ignore"
+	UnmatchedDMLPolicyLog    = "log"
+	UnmatchedDMLPolicyRepair = "repair"
+	UnmatchedDMLPolicyFail   = "fail"
+)
+
+func (b *BinlogWriter) checksUnmatchedDML() bool {
+	return b.UnmatchedDMLPolicy != "" && b.UnmatchedDMLPolicy != UnmatchedDMLPolicyIgnore
+}
+
+func (e *BinlogUpdateEvent) changesRow() bool {
+	for i := range e.newValues {
+		if e.newImage.HasColumn(i) && i < len(e.oldValues) && !reflect.DeepEqual(e.oldValues[i], e.newValues[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleUnmatchedDML applies the UnmatchedDMLPolicy to an UPDATE or DELETE
+// that changed no rows, though expected to, see execAccountingRowsAffected
+func (b *BinlogWriter) handleUnmatchedDML(tx *sql.Tx, ev DMLEvent) error {
+	table := ev.TableSchema()
+	statementType := "DELETE"
+	if _, ok := ev.(*BinlogUpdateEvent); ok {
+		statementType = "UPDATE"
+	}
+
+	b.metrics.Count("BinlogWriter.UnmatchedDML", 1, []MetricTag{
+		{Name: "table", Value: table.String()},
+		{Name: "type", Value: statementType},
+		{Name: "policy", Value: b.UnmatchedDMLPolicy},
+	}, 1.0)
+
+	logger := b.logger.WithFields(logrus.Fields{
+		"table":    table.String(),
+		"type":     statementType,
+		"position": ev.BinlogPosition(),
+	})
+
+	switch b.UnmatchedDMLPolicy {
+	case UnmatchedDMLPolicyFail:
+		return fmt.Errorf("%s of %s at %v matched no row on the target", statementType, table, ev.BinlogPosition())
+	case UnmatchedDMLPolicyRepair:
+		if table.PaginationKey == nil {
+			logger.Warn("binlog event matched no row on the target, cannot repair the row of a table without pagination key")
+			return nil
+		}
+		logger.Warn("binlog event matched no row on the target, copying the row again")
+		return b.repairUnmatchedDML(tx, ev)
+	default:
+		logger.Warn("binlog event matched no row on the target")
+		return nil
+	}
+}
+
+// repairUnmatchedDML deletes the row of the event on the target, and copies
+// it again from the source after an UPDATE, see recopyRow
+func (b *BinlogWriter) repairUnmatchedDML(tx *sql.Tx, ev DMLEvent) error {
+	table := ev.TableSchema()
+	schemaName := table.Schema
+	if rewrite, exists := b.DatabaseRewrites[schemaName]; exists {
+		schemaName = rewrite
+	}
+	tableName := table.Name
+	if rewrite, exists := b.TableRewrites[tableName]; exists {
+		tableName = rewrite
+	}
+
+	keys := make([]*PaginationKeyData, 0, 2)
+	oldKey, err := NewPaginationKeyDataFromRow(ev.OldValues(), table.PaginationKey)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, oldKey)
+
+	updateEv, isUpdate := ev.(*BinlogUpdateEvent)
+	newKey := oldKey
+	if isUpdate {
+		changed, err := updateEv.PaginationKeyChanged()
+		if err != nil {
+			return err
+		}
+		if changed {
+			newKey, err = NewPaginationKeyDataFromRow(updateEv.NewValues(), table.PaginationKey)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, newKey)
+		}
+	}
+
+	conditions := make([]string, len(table.PaginationKey.Columns))
+	for i, column := range table.PaginationKey.Columns {
+		conditions[i] = quoteField(column.Name) + " = ?"
+	}
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE %s", QuotedTableNameFromString(schemaName, tableName), strings.Join(conditions, " AND "))
+	for _, key := range keys {
+		if _, err = tx.Exec(deleteQuery, key.Values...); err != nil {
+			return fmt.Errorf("deleting row %s of %s: %v", key, table, err)
+		}
+	}
+
+	if !isUpdate {
+		return nil
+	}
+
+	inserts, err := b.recopyRow(table, newKey, updateEv)
+	if err != nil {
+		return err
+	}
+	for _, insert := range inserts {
+		query, err := insert.AsSQLString(schemaName, tableName)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(query); err != nil {
+			return fmt.Errorf("copying row %s of %s again: %v", newKey, table, err)
+		}
+	}
+	return nil
+}
@@ -1,17 +1,24 @@
 package ghostferry
 
 import (
+	"container/list"
 	"context"
 	"crypto/rand"
 	sqlorig "database/sql"
+	"database/sql/driver"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	sql "github.com/Shopify/ghostferry/sqlwrapper"
+	"math"
+	mathrand "math/rand"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/squirrel"
+	gomysql "github.com/go-sql-driver/mysql"
 	"github.com/siddontang/go-mysql/mysql"
 	"github.com/sirupsen/logrus"
 )
@@ -56,13 +63,198 @@ func WithRetriesContext(ctx context.Context, maxRetries int, sleep time.Duration
 	return
 }
 
-func randomServerId() uint32 {
-	var buf [4]byte
+type ErrorClass int
+
+const (
+	// errors we know nothing about, retried without delay as before
+	ErrorClassUnknown ErrorClass = iota
+	// deadlocks and lock wait timeouts
+	ErrorClassLockContention
+	// lost, broken or refused connections
+	ErrorClassConnection
+	// errors caused by the statement itself, which no retry can fix
+	ErrorClassSemantic
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassLockContention:
+		return "lock-contention"
+	case ErrorClassConnection:
+		return "connection"
+	case ErrorClassSemantic:
+		return "semantic"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	lockContentionErrorNumbers = map[uint16]bool{
+		1205: true, // ER_LOCK_WAIT_TIMEOUT
+		1213: true, // ER_LOCK_DEADLOCK
+	}
+
+	connectionErrorNumbers = map[uint16]bool{
+		1040: true, // ER_CON_COUNT_ERROR
+		1053: true, // ER_SERVER_SHUTDOWN
+		1152: true, // ER_ABORTING_CONNECTION
+		1158: true, // ER_NET_READ_ERROR
+		1159: true, // ER_NET_READ_INTERRUPTED
+		1160: true, // ER_NET_ERROR_ON_WRITE
+		1161: true, // ER_NET_WRITE_INTERRUPTED
+	}
+
+	semanticErrorNumbers = map[uint16]bool{
+		1048: true, // ER_BAD_NULL_ERROR
+		1054: true, // ER_BAD_FIELD_ERROR
+		1062: true, // ER_DUP_ENTRY
+		1064: true, // ER_PARSE_ERROR
+		1136: true, // ER_WRONG_VALUE_COUNT_ON_ROW
+		1264: true, // ER_WARN_DATA_OUT_OF_RANGE
+		1292: true, // ER_TRUNCATED_WRONG_VALUE
+		1366: true, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+		1406: true, // ER_DATA_TOO_LONG
+		1451: true, // ER_ROW_IS_REFERENCED_2
+		1452: true, // ER_NO_REFERENCED_ROW_2
+	}
+)
+
+// ClassifyError inspects the (possibly wrapped) error returned by a database
+// operation to decide how it should be retried.
+func ClassifyError(err error) ErrorClass {
+	var mysqlErr *gomysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch {
+		case lockContentionErrorNumbers[mysqlErr.Number]:
+			return ErrorClassLockContention
+		case connectionErrorNumbers[mysqlErr.Number]:
+			return ErrorClassConnection
+		case semanticErrorNumbers[mysqlErr.Number]:
+			return ErrorClassSemantic
+		}
+		return ErrorClassUnknown
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, gomysql.ErrInvalidConn) {
+		return ErrorClassConnection
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorClassConnection
+	}
+
+	return ErrorClassUnknown
+}
+
+// IsQueryInterrupted returns whether the (possibly wrapped) error is the
+// error of a statement killed with KILL QUERY, e.g. by the QueryKiller
+func IsQueryInterrupted(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1317 // ER_QUERY_INTERRUPTED
+}
+
+// isUnknownSystemVariable returns whether the (possibly wrapped) error is the
+// error of setting a variable the server does not have, e.g. of a newer version
+func isUnknownSystemVariable(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1193 // ER_UNKNOWN_SYSTEM_VARIABLE
+}
+
+// IsPacketTooLarge returns whether the (possibly wrapped) error is the error
+// of a statement larger than the max_allowed_packet of the client or server
+func IsPacketTooLarge(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1153 || // ER_NET_PACKET_TOO_LARGE
+			mysqlErr.Number == 1301 // ER_WARN_ALLOWED_PACKET_OVERFLOWED
+	}
+	return errors.Is(err, gomysql.ErrPktTooLarge)
+}
+
+// IsSchemaAheadOfCache returns whether the (possibly wrapped) error is
+// ErrSourceSchemaAheadOfCache, or the error of a statement referring to a
+// column or table the database no longer has, as its schema changed after it
+// was cached
+func IsSchemaAheadOfCache(err error) bool {
+	if errors.Is(err, ErrSourceSchemaAheadOfCache) {
+		return true
+	}
+
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) &&
+		(mysqlErr.Number == 1054 || // ER_BAD_FIELD_ERROR
+			mysqlErr.Number == 1146) // ER_NO_SUCH_TABLE
+}
+
+// WithRetryPolicy behaves like WithRetries, but decides how long to wait
+// before the next attempt (and whether to attempt it at all) based on the
+// class of the error returned by f. A nil policy retries all errors
+// immediately.
+func WithRetryPolicy(policy *RetryPolicyConfig, maxRetries int, logger *logrus.Entry, verb string, f func() error) (err error) {
+	if policy == nil {
+		return WithRetries(maxRetries, 0, logger, verb, f)
+	}
+
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	try := 1
+	for {
+		err = f()
+		if err == nil || err == context.Canceled {
+			return err
+		}
+
+		errorClass := ClassifyError(err)
+		if errorClass == ErrorClassSemantic && !policy.RetrySemanticErrors {
+			logger.WithError(err).Errorf("failed to %s, not retrying %s error", verb, errorClass)
+			return err
+		}
+
+		if maxRetries != 0 && try >= maxRetries {
+			break
+		}
+
+		var sleep time.Duration
+		switch errorClass {
+		case ErrorClassLockContention:
+			if policy.lockContentionJitter > 0 {
+				sleep = time.Duration(mathrand.Int63n(int64(policy.lockContentionJitter)))
+			}
+		case ErrorClassConnection:
+			sleep = policy.connectionErrorBackoff
+		}
+
+		logger.WithError(err).Errorf("failed to %s (%s error), %d of %d max retries, retrying in %s", verb, errorClass, try, maxRetries, sleep)
+
+		try++
+		time.Sleep(sleep)
+	}
+
+	logger.WithError(err).Errorf("failed to %s after %d attempts, retry limit exceeded", verb, try)
+
+	return
+}
+
+// randomServerId returns a random server id between min and max (inclusive),
+// where a min or max of 0 stands for the lowest or highest valid server id.
+func randomServerId(min, max uint32) uint32 {
+	var buf [8]byte
 	if _, err := rand.Read(buf[:]); err != nil {
 		panic(err)
 	}
 
-	return binary.LittleEndian.Uint32(buf[:])
+	if min == 0 {
+		min = 1
+	}
+	if max == 0 {
+		max = math.MaxUint32
+	}
+	span := uint64(max) - uint64(min) + 1
+	return min + uint32(binary.LittleEndian.Uint64(buf[:])%span)
 }
 
 type AtomicBoolean int32
@@ -83,6 +275,9 @@ func (a *AtomicBoolean) Get() bool {
 type WorkerPool struct {
 	Concurrency int
 	Process     func(int) (interface{}, error)
+
+	// If set, the panics of the workers are handled, see RecoverPanic
+	ErrorHandler ErrorHandler
 }
 
 // Returns a list of results of the size same as the concurrency number.
@@ -99,6 +294,7 @@ func (p *WorkerPool) Run(n int) ([]interface{}, error) {
 	for j := 0; j < p.Concurrency; j++ {
 		go func(j int) {
 			defer wg.Done()
+			defer RecoverPanic("worker_pool", p.ErrorHandler)
 
 			for workIndex := range workQueue {
 				result, err := p.Process(workIndex)
@@ -145,52 +341,151 @@ loop:
 	return results, err
 }
 
+// StmtCache keeps the prepared statements of queries. If its capacity is
+// non-zero, the least recently used statements are dropped once more
+// statements are cached, and closed once they are released, so the prepared
+// statements of a server are not exhausted by Ghostferry.
 type StmtCache struct {
-	mut        sync.RWMutex
-	statements map[string]*sqlorig.Stmt
+	capacity int
+	name     string
+	metrics  *Metrics
+
+	mut        sync.Mutex
+	statements map[string]*list.Element
+	lru        *list.List
+}
+
+type stmtCacheEntry struct {
+	query string
+	stmt  *sqlorig.Stmt
+
+	// the number of callers using the statement, which is only closed once
+	// it is evicted and released by all of them
+	users   int
+	evicted bool
 }
 
 func NewStmtCache() *StmtCache {
+	return NewBoundedStmtCache(0, "", nil)
+}
+
+// NewBoundedStmtCache returns a cache of at most capacity statements, or an
+// unbounded one if capacity is 0. Its hits, misses and evictions are counted
+// in the StmtCache.Hit, StmtCache.Miss and StmtCache.Eviction metrics, tagged
+// with the name of the cache.
+func NewBoundedStmtCache(capacity int, name string, metrics *Metrics) *StmtCache {
 	return &StmtCache{
-		statements: make(map[string]*sqlorig.Stmt),
+		capacity:   capacity,
+		name:       name,
+		metrics:    metrics,
+		statements: make(map[string]*list.Element),
+		lru:        list.New(),
 	}
 }
 
-func (c *StmtCache) StmtFor(p SqlPreparer, query string) (*sqlorig.Stmt, error) {
-	stmt, exists := c.getStmt(query)
+// StmtFor returns the prepared statement of the query, preparing it if it is
+// not cached, and the function releasing it. The statement must not be used
+// after it is released: an evicted statement is closed once all its users
+// released it.
+func (c *StmtCache) StmtFor(p SqlPreparer, query string) (*sqlorig.Stmt, func(), error) {
+	entry, exists := c.getStmt(query)
 	if !exists {
-		return c.newStmtFor(p, query)
+		c.count("StmtCache.Miss")
+
+		stmt, err := p.Prepare(query)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry = c.storeStmt(query, stmt)
+	} else {
+		c.count("StmtCache.Hit")
 	}
-	return stmt, nil
+
+	var once sync.Once
+	return entry.stmt, func() { once.Do(func() { c.release(entry) }) }, nil
 }
 
-func (c *StmtCache) newStmtFor(p SqlPreparer, query string) (*sqlorig.Stmt, error) {
-	stmt, err := p.Prepare(query)
-	if err != nil {
-		return nil, err
+// Len returns the number of cached statements
+func (c *StmtCache) Len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.lru.Len()
+}
+
+// storeStmt caches the statement, and returns the cached entry of the query
+// used by the caller: if the query was prepared concurrently, the statement
+// prepared first is kept
+func (c *StmtCache) storeStmt(query string, stmt *sqlorig.Stmt) *stmtCacheEntry {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if element, exists := c.statements[query]; exists {
+		stmt.Close()
+		c.lru.MoveToFront(element)
+		entry := element.Value.(*stmtCacheEntry)
+		entry.users++
+		return entry
+	}
+
+	entry := &stmtCacheEntry{query: query, stmt: stmt, users: 1}
+	c.statements[query] = c.lru.PushFront(entry)
+
+	for c.capacity > 0 && c.lru.Len() > c.capacity {
+		evicted := c.lru.Remove(c.lru.Back()).(*stmtCacheEntry)
+		delete(c.statements, evicted.query)
+		evicted.evicted = true
+		if evicted.users == 0 {
+			evicted.stmt.Close()
+		}
+		c.count("StmtCache.Eviction")
 	}
 
-	c.storeStmt(query, stmt)
-	return stmt, nil
+	return entry
 }
 
-func (c *StmtCache) storeStmt(query string, stmt *sqlorig.Stmt) {
+func (c *StmtCache) getStmt(query string) (*stmtCacheEntry, bool) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	c.statements[query] = stmt
+
+	element, exists := c.statements[query]
+	if !exists {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	entry := element.Value.(*stmtCacheEntry)
+	entry.users++
+	return entry, true
 }
 
-func (c *StmtCache) getStmt(query string) (*sqlorig.Stmt, bool) {
-	c.mut.RLock()
-	defer c.mut.RUnlock()
-	stmt, exists := c.statements[query]
-	return stmt, exists
+func (c *StmtCache) release(entry *stmtCacheEntry) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	entry.users--
+	if entry.evicted && entry.users == 0 {
+		entry.stmt.Close()
+	}
+}
+
+func (c *StmtCache) count(key string) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.Count(key, 1, []MetricTag{{"cache", c.name}}, 1.0)
 }
 
 func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
+	pos, _, err := ShowMasterStatus(db)
+	return pos, err
+}
+
+// ShowMasterStatus returns the current binlog position of the database, and
+// its executed GTID set if the server reports one
+func ShowMasterStatus(db *sql.DB) (mysql.Position, string, error) {
 	rows, err := db.Query("SHOW MASTER STATUS")
 	if err != nil {
-		return NewMysqlPosition("", 0, err)
+		pos, err := NewMysqlPosition("", 0, err)
+		return pos, "", err
 	}
 	defer rows.Close()
 	var file string
@@ -200,7 +495,8 @@ func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
 	if rows.Next() {
 		cols, err = rows.Columns()
 		if err != nil {
-			return NewMysqlPosition(file, position, err)
+			pos, err := NewMysqlPosition(file, position, err)
+			return pos, "", err
 		}
 		switch len(cols) {
 		case 4:
@@ -209,7 +505,8 @@ func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
 			err = rows.Scan(&file, &position, &binlog_do_db, &binlog_ignore_db, &executed_gtid_set)
 		}
 	}
-	return NewMysqlPosition(file, position, err)
+	pos, err := NewMysqlPosition(file, position, err)
+	return pos, executed_gtid_set, err
 }
 
 func NewMysqlPosition(file string, position uint32, err error) (mysql.Position, error) {
@@ -230,6 +527,24 @@ func NewMysqlPosition(file string, position uint32, err error) (mysql.Position,
 	}
 }
 
+// createStateTable creates a table Ghostferry keeps its own records in, and
+// its database, unless they exist already, e.g. from a previous run that is
+// resumed. The columns are the body of the CREATE TABLE statement, and the
+// description names the table in the errors.
+func createStateTable(db *sql.DB, database, table, columns, description string) error {
+	_, err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", QuotedDatabaseNameFromString(database)))
+	if err != nil {
+		return fmt.Errorf("creating %s database %s: %v", description, database, err)
+	}
+
+	tableName := QuotedTableNameFromString(database, table)
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + tableName + " (" + columns + ")")
+	if err != nil {
+		return fmt.Errorf("creating %s table %s: %v", description, tableName, err)
+	}
+	return nil
+}
+
 func CheckDbIsAReplica(db *sql.DB) (bool, error) {
 	row := db.QueryRow("SELECT @@read_only")
 	var isReadOnly bool
@@ -94,6 +94,7 @@ type ChecksumTableVerifier struct {
 	TableRewrites    map[string]string
 	SourceDB         *sql.DB
 	TargetDB         *sql.DB
+	ErrorHandler     ErrorHandler
 
 	started *AtomicBoolean
 
@@ -146,6 +147,7 @@ func (v *ChecksumTableVerifier) VerifyDuringCutover() (VerificationResult, error
 		wg.Add(2)
 		go func() {
 			defer wg.Done()
+			defer RecoverPanic("checksum_verifier", v.ErrorHandler)
 			query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", sourceTable)
 			sourceRow := v.SourceDB.QueryRow(query)
 			sourceChecksum, sourceErr = v.fetchChecksumValueFromRow(sourceRow)
@@ -153,6 +155,7 @@ func (v *ChecksumTableVerifier) VerifyDuringCutover() (VerificationResult, error
 
 		go func() {
 			defer wg.Done()
+			defer RecoverPanic("checksum_verifier", v.ErrorHandler)
 			query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", targetTable)
 			targetRow := v.TargetDB.QueryRow(query)
 			targetChecksum, targetErr = v.fetchChecksumValueFromRow(targetRow)
@@ -223,7 +226,9 @@ func (v *ChecksumTableVerifier) StartInBackground() error {
 		DoneTime:  time.Time{},
 	}
 	v.verificationErr = nil
-	v.logger = logrus.WithField("tag", "checksum_verifier")
+	if v.logger == nil {
+		v.logger = logrus.WithField("tag", "checksum_verifier")
+	}
 	v.wg = &sync.WaitGroup{}
 
 	v.logger.Info("checksum table verification started")
@@ -231,6 +236,7 @@ func (v *ChecksumTableVerifier) StartInBackground() error {
 	v.wg.Add(1)
 	go func() {
 		defer v.wg.Done()
+		defer RecoverPanic("checksum_verifier", v.ErrorHandler)
 
 		v.verificationResultAndStatus.VerificationResult, v.verificationErr = v.VerifyDuringCutover()
 		v.verificationResultAndStatus.DoneTime = time.Now()